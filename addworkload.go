@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// appPodsArgs are the kubectl arguments listing the pods of the app in every namespace, as
+// namespace/name
+func appPodsArgs(app string) []string {
+	return []string{"get", "pods", "--all-namespaces", "-l", "app=" + app, "-o", `jsonpath={range .items[*]}{.metadata.namespace}/{.metadata.name}{" "}{end}`}
+}
+
+// parseAppPods returns the namespaces of the output of appPodsArgs, in order, with the first
+// pod of each
+func parseAppPods(out string) (namespaces []string, pods map[string]string) {
+	pods = make(map[string]string)
+	for _, field := range strings.Fields(out) {
+		namespace, pod, ok := strings.Cut(field, "/")
+		if !ok {
+			continue
+		}
+		if _, seen := pods[namespace]; !seen {
+			namespaces = append(namespaces, namespace)
+			pods[namespace] = pod
+		}
+	}
+	return namespaces, pods
+}
+
+// guessProtocol returns the protocol of a port from its name, e.g. grpc for grpc-api and
+// http for http or http-metrics, empty when the name does not tell
+func guessProtocol(port exposedPort) string {
+	name := strings.ToLower(port.Name)
+	switch {
+	case strings.Contains(name, "grpc"):
+		return "grpc"
+	case strings.Contains(name, "http") || name == "web":
+		return "http"
+	}
+	return ""
+}
+
+// usedLocalPorts returns the local ports of every tunnel of the configuration, in every
+// environment since their sessions may run at the same time
+func usedLocalPorts(config Config) []int {
+	var ports []int
+	for _, proxy := range config.Proxies {
+		for _, workload := range proxy.Workloads {
+			ports = append(ports, workload.LocalPort)
+		}
+		for _, connection := range proxy.Bastion.Connections {
+			ports = append(ports, connection.LocalPort)
+		}
+		if proxy.APIProxy.enabled() {
+			ports = append(ports, proxy.APIProxy.LocalPort)
+		}
+	}
+	return ports
+}
+
+// pickLocalPort returns the first port from the remote port on, or from 8080 for ports only
+// root may listen on, that no tunnel of the configuration uses and that is free
+func pickLocalPort(config Config, remotePort int, free func(port int) bool) (int, error) {
+	used := usedLocalPorts(config)
+	start := remotePort
+	if start < 1024 {
+		start = 8080
+	}
+	for port := start; port <= 65535; port++ {
+		if !slices.Contains(used, port) && free(port) {
+			return port, nil
+		}
+	}
+	return 0, fmt.Errorf("no free local port from %d on", start)
+}
+
+// workloadEntry returns the workload as the YAML mapping added to the configuration, with
+// its keys in the order of the configuration template
+func workloadEntry(workload Workload) *yaml.Node {
+	entry := &yaml.Node{Kind: yaml.MappingNode}
+	add := func(key, value string) {
+		entry.Content = append(entry.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, &yaml.Node{Kind: yaml.ScalarNode, Value: value})
+	}
+	add("namespace", workload.Namespace)
+	add("app", workload.App)
+	add("local_port", strconv.Itoa(workload.LocalPort))
+	add("remote_port", strconv.Itoa(workload.RemotePort))
+	if workload.Protocol != "" {
+		add("protocol", workload.Protocol)
+	}
+	if workload.Project != "" {
+		add("project", workload.Project)
+	}
+	if workload.Cluster != "" {
+		add("cluster", workload.Cluster)
+	}
+	return entry
+}
+
+// runAddWorkload implements devcli config add-workload, which looks the app up in the
+// environment's cluster and adds a workload forwarding it to the configuration file
+func runAddWorkload(args []string) {
+	fs := flag.NewFlagSet("devcli config add-workload", flag.ExitOnError)
+	confFile := fs.String("conf", "", "Path to the configuration file")
+	environment := fs.String("env", "", "Environment to add the workload to, the default environment of the configuration file when empty")
+	var workload Workload
+	fs.StringVar(&workload.App, "app", "", "Value of the app label of the workload's pods")
+	fs.StringVar(&workload.Namespace, "namespace", "", "Namespace of the app, looked up in the cluster when empty")
+	fs.IntVar(&workload.RemotePort, "remote-port", 0, "Port of the pods to forward, looked up in the cluster when empty")
+	fs.IntVar(&workload.LocalPort, "local-port", 0, "Local port of the workload, the first free one from the remote port on when empty")
+	fs.StringVar(&workload.Protocol, "protocol", "", "Protocol of the workload, guessed from the name of the port when empty")
+	fs.StringVar(&workload.Project, "project", "", "Project of the workload's cluster, when it is not the environment's")
+	fs.StringVar(&workload.Cluster, "cluster", "", "Name of the workload's cluster, the first cluster of the project when empty")
+	dryRun := fs.Bool("dry-run", false, "Print the workload instead of adding it")
+	fs.Parse(args)
+	if workload.App == "" {
+		fmt.Println("Error: -app is required")
+		os.Exit(2)
+	}
+
+	path, err := configPath(*confFile)
+	if err != nil {
+		fmt.Println("Error getting user home directory:", err)
+		os.Exit(1)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Println("Error reading configuration file:", err)
+		os.Exit(1)
+	}
+	config, err := parseConfig(data)
+	if err == nil {
+		err = expandServiceManifests(&config, filepath.Dir(path))
+	}
+	if err != nil {
+		fmt.Println("Error reading configuration file:", err)
+		os.Exit(1)
+	}
+	if *environment != "" {
+		config.Environment = *environment
+	}
+	proxyConfig, err := findProxyConfig(config)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	for _, existing := range proxyConfig.Workloads {
+		if existing.App == workload.App && (workload.Namespace == "" || existing.Namespace == workload.Namespace) {
+			fmt.Printf("Error: environment %s already forwards app %s in namespace %s on port %d.\n", proxyConfig.Environment, existing.App, existing.Namespace, existing.LocalPort)
+			os.Exit(1)
+		}
+	}
+
+	if workload.Namespace == "" || workload.RemotePort == 0 {
+		ctx := context.Background()
+		runner := newCommandRunner(1, 0).withTimeout(time.Minute, 2)
+		if err := lookupWorkload(ctx, runner, config, proxyConfig, &workload); err != nil {
+			fmt.Println("Error:", err)
+			printHint(err)
+			os.Exit(1)
+		}
+	}
+	if workload.LocalPort == 0 {
+		if workload.LocalPort, err = pickLocalPort(config, workload.RemotePort, checkPortAvailable); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	}
+
+	entry := workloadEntry(workload)
+	if *dryRun {
+		out, _ := yaml.Marshal([]*yaml.Node{entry})
+		fmt.Print(string(out))
+		return
+	}
+	edited, err := appendConfigItem(data, fmt.Sprintf("proxies[%s].workloads", proxyConfig.Environment), entry)
+	if err == nil {
+		var edit Config
+		if edit, err = parseConfig(edited); err == nil {
+			err = expandServiceManifests(&edit, filepath.Dir(path))
+		}
+		if err == nil {
+			if problems := validateConfig(edit); len(problems) > 0 {
+				err = errors.New(strings.Join(problems, "; "))
+			}
+		}
+	}
+	if err == nil {
+		err = writeConfigFile(path, edited)
+	}
+	if err != nil {
+		fmt.Printf("Error adding workload %s: %v\n", workload.App, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Added workload %s of namespace %s to environment %s in %s, forwarding remote port %d to local port %d.\n",
+		workload.App, workload.Namespace, proxyConfig.Environment, filepath.Base(path), workload.RemotePort, workload.LocalPort)
+}
+
+// lookupWorkload fills in the namespace and remote port of the workload from its pods, and
+// its protocol from the name of the port
+func lookupWorkload(ctx context.Context, runner *commandRunner, config Config, proxyConfig ProxyConfig, workload *Workload) error {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	os.Setenv("KUBECONFIG", kubeconfigEnv(kubeconfigPaths(config.Cloud, proxyConfig, home)))
+	if config.Cloud.Gcloudconfig != "" {
+		os.Setenv("CLOUDSDK_CONFIG", config.Cloud.Gcloudconfig)
+	}
+	if proxyConfig.KubeContext != "" {
+		workload.kubeContext = proxyConfig.KubeContext
+	} else {
+		cluster, err := findCluster(ctx, runner, workloadCluster(proxyConfig, *workload))
+		if err != nil {
+			return err
+		}
+		if proxyConfig.ConnectGateway.Enabled {
+			cluster = proxyConfig.ConnectGateway.through(cluster)
+		}
+		if err := fetchClusterCredentials(ctx, runner, cluster); err != nil {
+			return err
+		}
+		workload.kubeContext = cluster.kubeContext()
+	}
+
+	fmt.Printf("Looking up the pods of app %s...\n", workload.App)
+	out, err := runner.output(ctx, kubectlCommand(ctx, *workload, appPodsArgs(workload.App)...))
+	if err != nil {
+		return fmt.Errorf("listing the pods of app %s: %w", workload.App, err)
+	}
+	namespaces, pods := parseAppPods(string(out))
+	if workload.Namespace != "" {
+		namespaces = slices.DeleteFunc(namespaces, func(namespace string) bool { return namespace != workload.Namespace })
+	}
+	switch len(namespaces) {
+	case 0:
+		return fmt.Errorf("no pod with the label app=%s in the cluster, check the app with kubectl get pods -A --show-labels", workload.App)
+	case 1:
+		workload.Namespace = namespaces[0]
+	default:
+		return fmt.Errorf("app %s runs in the namespaces %s, choose one with -namespace", workload.App, strings.Join(namespaces, ", "))
+	}
+	if workload.RemotePort != 0 {
+		return nil
+	}
+
+	out, err = runner.output(ctx, kubectlCommand(ctx, *workload, containerPortsArgs(*workload, pods[workload.Namespace])...))
+	if err != nil {
+		return fmt.Errorf("getting the ports of pod %s: %w", pods[workload.Namespace], err)
+	}
+	ports := parseExposedPorts(string(out))
+	if len(ports) == 0 {
+		// pods that do not declare their ports are often reached through a Service
+		if out, err := runner.output(ctx, kubectlCommand(ctx, *workload, servicePortsArgs(*workload)...)); err == nil {
+			ports = parseExposedPorts(string(out))
+		}
+	}
+	switch len(ports) {
+	case 0:
+		return fmt.Errorf("pod %s exposes no TCP port, choose one with -remote-port", pods[workload.Namespace])
+	case 1:
+	default:
+		var names []string
+		for _, port := range ports {
+			names = append(names, port.String())
+		}
+		return fmt.Errorf("pod %s exposes the ports %s, choose one with -remote-port", pods[workload.Namespace], strings.Join(names, ", "))
+	}
+	workload.RemotePort = ports[0].Port
+	if workload.Protocol == "" {
+		workload.Protocol = guessProtocol(ports[0])
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseAppPods(t *testing.T) {
+	namespaces, pods := parseAppPods("enr/ledger-7d9f-abcde enr/ledger-7d9f-fghij sandbox/ledger-5c4b-klmno ")
+	if !slices.Equal(namespaces, []string{"enr", "sandbox"}) || pods["enr"] != "ledger-7d9f-abcde" || pods["sandbox"] != "ledger-5c4b-klmno" {
+		t.Errorf("parseAppPods failed: unexpected namespaces %v and pods %v", namespaces, pods)
+	}
+	if namespaces, _ := parseAppPods(""); len(namespaces) != 0 {
+		t.Errorf("parseAppPods failed: expected no namespace, got %v", namespaces)
+	}
+}
+
+func TestGuessProtocol(t *testing.T) {
+	for name, expected := range map[string]string{"grpc-api": "grpc", "http": "http", "HTTP-metrics": "http", "web": "http", "postgres": "", "": ""} {
+		if got := guessProtocol(exposedPort{Port: 8080, Name: name}); got != expected {
+			t.Errorf("guessProtocol(%q) failed: expected %q, got %q", name, expected, got)
+		}
+	}
+}
+
+func TestPickLocalPort(t *testing.T) {
+	config := Config{Proxies: []ProxyConfig{
+		{Environment: "staging", Workloads: []Workload{{App: "cashfree", LocalPort: 8080}}},
+		{Environment: "prod", Bastion: Bastion{Connections: []Connection{{LocalPort: 8081}}}},
+	}}
+	free := func(port int) bool { return port != 8082 }
+	if port, err := pickLocalPort(config, 8080, free); err != nil || port != 8083 {
+		t.Errorf("pickLocalPort failed: expected 8083, got %d and error %v", port, err)
+	}
+	if port, err := pickLocalPort(config, 9090, free); err != nil || port != 9090 {
+		t.Errorf("pickLocalPort failed: expected 9090, got %d and error %v", port, err)
+	}
+	// ports only root may listen on are not used locally
+	if port, err := pickLocalPort(config, 80, free); err != nil || port != 8083 {
+		t.Errorf("pickLocalPort failed: expected 8083 for port 80, got %d and error %v", port, err)
+	}
+	if _, err := pickLocalPort(config, 65535, func(int) bool { return false }); err == nil {
+		t.Errorf("pickLocalPort failed: expected an error when no port is free")
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+const (
+	// apiProxyKubectl serves the API server with kubectl proxy, over plain http
+	apiProxyKubectl = "kubectl"
+	// apiProxyBastion forwards the private endpoint of the control plane through the bastion
+	apiProxyBastion = "bastion"
+)
+
+// apiProxyName is the tunnel name of the API server in the status table
+const apiProxyName = "api-server"
+
+// APIProxy exposes the API server of the environment's default cluster on a local port, so
+// that tools like k9s and Lens can reach a private cluster
+type APIProxy struct {
+	LocalPort int `yaml:"local_port"`
+	// Mode is kubectl (the default) or bastion
+	Mode string `yaml:"mode"`
+}
+
+func (p APIProxy) enabled() bool {
+	return p.LocalPort != 0
+}
+
+func (p APIProxy) mode() string {
+	if p.Mode == "" {
+		return apiProxyKubectl
+	}
+	return p.Mode
+}
+
+// validate checks the mode, the bastion mode cannot be combined with the Connect Gateway
+// which already reaches the private endpoint
+func (p APIProxy) validate(config ProxyConfig) error {
+	switch p.mode() {
+	case apiProxyKubectl:
+	case apiProxyBastion:
+		if config.ConnectGateway.Enabled {
+			return fmt.Errorf("api_proxy mode bastion cannot be used with the connect_gateway, use mode kubectl")
+		}
+	default:
+		return fmt.Errorf("unknown api_proxy mode %q, expected kubectl or bastion", p.Mode)
+	}
+	return nil
+}
+
+// apiProxyContext is the kubeconfig context of the API server forwarded through the bastion
+func apiProxyContext(environment string) string {
+	return "devcli-" + environment
+}
+
+// kubectlProxyArgs are the kubectl arguments serving the API server of the cluster
+func kubectlProxyArgs(proxy APIProxy) []string {
+	return []string{"proxy", "--address", listenHost, "--port", strconv.Itoa(proxy.LocalPort)}
+}
+
+// privateEndpoint returns the private address and the CA certificate of the cluster's
+// control plane
+func privateEndpoint(ctx context.Context, runner *commandRunner, cluster gkeCluster) (string, string, error) {
+	cmd := exec.CommandContext(ctx, "gcloud", "container", "clusters", "describe", cluster.Name, "--project", cluster.Project, cluster.locationFlag(), cluster.Location,
+		"--format", "value(privateClusterConfig.privateEndpoint,masterAuth.clusterCaCertificate)")
+	cmd.Stderr = logger.Writer("gcloud")
+	out, err := runner.output(ctx, cmd)
+	if err != nil {
+		return "", "", fmt.Errorf("getting the private endpoint of cluster %s: %w", cluster.Name, err)
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) != 2 {
+		return "", "", fmt.Errorf("cluster %s has no private endpoint", cluster.Name)
+	}
+	return fields[0], fields[1], nil
+}
+
+// apiProxyKubeconfigArgs are the kubectl config commands adding the context of the API
+// server forwarded to the local port. The certificate of the control plane is verified
+// against its private address, and the credentials of the cluster's own context are used.
+func apiProxyKubeconfigArgs(environment string, cluster gkeCluster, proxy APIProxy, endpoint, ca string) [][]string {
+	name := apiProxyContext(environment)
+	return [][]string{
+		{"config", "set-cluster", name, "--server", "https://" + localAddress(proxy.LocalPort), "--tls-server-name", endpoint},
+		{"config", "set", "clusters." + name + ".certificate-authority-data", ca},
+		{"config", "set-context", name, "--cluster", name, "--user", cluster.kubeContext()},
+	}
+}
+
+// setupAPIProxy prepares the API server tunnel of the cluster and returns the function
+// running it under the supervisor
+func setupAPIProxy(ctx context.Context, runner *commandRunner, config ProxyConfig, cluster gkeCluster, zones *zoneResolver) (func(context.Context) error, error) {
+	proxy := config.APIProxy
+	if proxy.mode() == apiProxyKubectl {
+		workload := Workload{kubeContext: cluster.kubeContext()}
+		return func(ctx context.Context) error {
+			cmd := kubectlCommand(ctx, workload, kubectlProxyArgs(proxy)...)
+			cmd.Stdout = logger.Writer(apiProxyName)
+			cmd.Stderr = logger.Writer(apiProxyName)
+			narratef("Serving the API server of cluster %s on http://localhost:%d\n", cluster.Name, proxy.LocalPort)
+			if err := runner.start(ctx, cmd); err != nil {
+				return fmt.Errorf("running kubectl proxy: %w", err)
+			}
+			return nil
+		}, nil
+	}
+
+	endpoint, ca, err := privateEndpoint(ctx, runner, cluster)
+	if err != nil {
+		return nil, err
+	}
+	for _, args := range apiProxyKubeconfigArgs(config.Environment, cluster, proxy, endpoint, ca) {
+		cmd := exec.CommandContext(ctx, "kubectl", args...)
+		cmd.Stdout = logger.Writer(apiProxyName)
+		cmd.Stderr = logger.Writer(apiProxyName)
+		if err := runner.run(ctx, cmd); err != nil {
+			return nil, fmt.Errorf("adding the %s kubeconfig context: %w", apiProxyContext(config.Environment), err)
+		}
+	}
+	connection := Connection{LocalPort: proxy.LocalPort, RemoteHost: endpoint, RemotePort: 443}
+	return func(ctx context.Context) error {
+		narratef("Forwarding the API server of cluster %s to local port %d, use kubectl --context %s\n", cluster.Name, proxy.LocalPort, apiProxyContext(config.Environment))
+		return zones.connectRelocating("", func(zone string) error {
+			bastion := config.Bastion
+			bastion.Zone = zone
+			cmd := connectBastion(ctx, bastion, connection)
+			cmd.Stdout = logger.Writer(apiProxyName)
+			cmd.Stderr = logger.Writer(apiProxyName)
+			if err := runner.start(ctx, cmd); err != nil {
+				return fmt.Errorf("forwarding the API server via bastion server %s: %w", config.Bastion.Name, err)
+			}
+			return nil
+		})
+	}, nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAPIProxyValidate(t *testing.T) {
+	config := ProxyConfig{Environment: "staging"}
+	if err := (APIProxy{LocalPort: 8001}).validate(config); err != nil {
+		t.Errorf("validate failed: unexpected error %v for the default mode", err)
+	}
+	if err := (APIProxy{LocalPort: 8001, Mode: "ssh"}).validate(config); err == nil {
+		t.Error("validate failed: expected an error for an unknown mode")
+	}
+	config.ConnectGateway.Enabled = true
+	if err := (APIProxy{LocalPort: 8001, Mode: apiProxyBastion}).validate(config); err == nil {
+		t.Error("validate failed: expected an error for the bastion mode with the Connect Gateway")
+	}
+}
+
+func TestKubectlProxyArgs(t *testing.T) {
+	expected := "proxy --address localhost --port 8001"
+	if args := strings.Join(kubectlProxyArgs(APIProxy{LocalPort: 8001}), " "); args != expected {
+		t.Errorf("kubectlProxyArgs failed: expected %q, got %q", expected, args)
+	}
+}
+
+func TestAPIProxyKubeconfigArgs(t *testing.T) {
+	cluster := gkeCluster{Project: "p", Location: "asia-south1", Name: "services"}
+	commands := apiProxyKubeconfigArgs("staging", cluster, APIProxy{LocalPort: 8443, Mode: apiProxyBastion}, "172.16.0.2", "Q0E=")
+	expected := []string{
+		"config set-cluster devcli-staging --server https://localhost:8443 --tls-server-name 172.16.0.2",
+		"config set clusters.devcli-staging.certificate-authority-data Q0E=",
+		"config set-context devcli-staging --cluster devcli-staging --user gke_p_asia-south1_services",
+	}
+	if len(commands) != len(expected) {
+		t.Fatalf("apiProxyKubeconfigArgs failed: expected %d commands, got %d", len(expected), len(commands))
+	}
+	for i, args := range commands {
+		if strings.Join(args, " ") != expected[i] {
+			t.Errorf("apiProxyKubeconfigArgs failed: expected %q, got %q", expected[i], strings.Join(args, " "))
+		}
+	}
+}
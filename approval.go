@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+)
+
+// approvalPollInterval is how often the status of an approval request is polled
+var approvalPollInterval = 5 * time.Second
+
+const (
+	// defaultApprovalDuration is how long the access is requested for when the approval
+	// sets no duration
+	defaultApprovalDuration = time.Hour
+	// defaultApprovalTimeout is how long devcli waits for an approval when the approval sets
+	// no timeout
+	defaultApprovalTimeout = 15 * time.Minute
+)
+
+// Approval is the break-glass flow of an environment: starting a session requests an
+// approval from the approval service, the tunnels only start once it is approved and the
+// session ends when the approved duration runs out
+type Approval struct {
+	// URL is the approval service requests are posted to
+	URL string `yaml:"url"`
+	// SlackWebhook is an incoming webhook the requests are announced to
+	SlackWebhook string `yaml:"slack_webhook"`
+	// Duration is how long the access is requested for
+	Duration time.Duration `yaml:"duration"`
+	// Timeout is how long devcli waits for the request to be approved
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+func (a Approval) enabled() bool {
+	return a.URL != ""
+}
+
+func (a Approval) duration() time.Duration {
+	if a.Duration > 0 {
+		return a.Duration
+	}
+	return defaultApprovalDuration
+}
+
+func (a Approval) timeout() time.Duration {
+	if a.Timeout > 0 {
+		return a.Timeout
+	}
+	return defaultApprovalTimeout
+}
+
+// validate checks the endpoints and durations of the approval
+func (a Approval) validate() error {
+	for _, url := range []string{a.URL, a.SlackWebhook} {
+		if url != "" && !strings.HasPrefix(url, "https://") && !strings.HasPrefix(url, "http://") {
+			return fmt.Errorf("approval url %q is not an http(s) URL", url)
+		}
+	}
+	if a.SlackWebhook != "" && a.URL == "" {
+		return fmt.Errorf("approval slack_webhook is set without the url of the approval service")
+	}
+	if a.Duration < 0 || a.Timeout < 0 {
+		return fmt.Errorf("approval duration and timeout must not be negative")
+	}
+	return nil
+}
+
+// approvalRequest is posted to the approval service to request access to an environment
+type approvalRequest struct {
+	ID              string   `json:"id"`
+	User            string   `json:"user"`
+	Account         string   `json:"account,omitempty"`
+	Host            string   `json:"host"`
+	Environment     string   `json:"environment"`
+	Tunnels         []string `json:"tunnels"`
+	Reason          string   `json:"reason"`
+	DurationSeconds float64  `json:"duration_seconds"`
+}
+
+// approvalStatus is the answer of the approval service to a request and to its polls
+type approvalStatus struct {
+	// Status is pending, approved or denied
+	Status   string `json:"status"`
+	Approver string `json:"approver,omitempty"`
+	// DurationSeconds is the approved duration, the requested one when 0
+	DurationSeconds float64 `json:"duration_seconds,omitempty"`
+	// Reason is why the request was denied
+	Reason string `json:"reason,omitempty"`
+	// StatusURL is polled for the status, the service URL followed by the request ID when empty
+	StatusURL string `json:"status_url,omitempty"`
+	// ApproveURL is where approvers decide on the request, announced on Slack
+	ApproveURL string `json:"approve_url,omitempty"`
+}
+
+// newApprovalRequest returns the request of the session with its user, gcloud account,
+// tunnels and reason
+func newApprovalRequest(approval Approval, proxyConfig ProxyConfig, account, reason string) approvalRequest {
+	id := make([]byte, 8)
+	rand.Read(id)
+	request := approvalRequest{
+		ID:              hex.EncodeToString(id),
+		Account:         account,
+		Environment:     proxyConfig.Environment,
+		Tunnels:         sessionTunnels(proxyConfig),
+		Reason:          reason,
+		DurationSeconds: approval.duration().Seconds(),
+	}
+	if current, err := user.Current(); err == nil {
+		request.User = current.Username
+	}
+	request.Host, _ = os.Hostname()
+	return request
+}
+
+// approvalReason returns the reason of -reason, or asks for it in a terminal
+func approvalReason(reason string, in io.Reader, out io.Writer, terminal bool) (string, error) {
+	if reason = strings.TrimSpace(reason); reason != "" {
+		return reason, nil
+	}
+	if !terminal {
+		return "", fmt.Errorf("the environment requires an approval, give the reason of the access with -reason")
+	}
+	fmt.Fprint(out, "Reason for the access, shown to the approvers: ")
+	line, _ := bufio.NewReader(in).ReadString('\n')
+	if reason = strings.TrimSpace(line); reason == "" {
+		return "", fmt.Errorf("the environment requires an approval and no reason was given")
+	}
+	return reason, nil
+}
+
+// requestApproval posts the request to the approval service, announces it on Slack and
+// waits for it to be decided. It returns the approved duration of the session.
+func requestApproval(ctx context.Context, approval Approval, request approvalRequest) (time.Duration, error) {
+	var status approvalStatus
+	postCtx, cancel := context.WithTimeout(ctx, reportTimeout)
+	err := postJSON(postCtx, approval.URL, "", request, &status)
+	cancel()
+	if err != nil {
+		return 0, fmt.Errorf("requesting an approval from %s: %w", approval.URL, err)
+	}
+	statusURL := status.StatusURL
+	if statusURL == "" {
+		statusURL = strings.TrimSuffix(approval.URL, "/") + "/" + request.ID
+	}
+	if approval.SlackWebhook != "" {
+		if err := announceApproval(ctx, approval.SlackWebhook, request, status.ApproveURL); err != nil {
+			fmt.Println("Warning: the approval request cannot be announced on Slack:", err)
+		}
+	}
+	fmt.Printf("Waiting up to %s for the access to %s to be approved (request %s)...\n", approval.timeout(), request.Environment, request.ID)
+
+	deadline := time.After(approval.timeout())
+	for status.Status != "approved" {
+		switch status.Status {
+		case "denied":
+			if status.Reason != "" {
+				return 0, fmt.Errorf("the access to %s was denied by %s: %s", request.Environment, status.Approver, status.Reason)
+			}
+			return 0, fmt.Errorf("the access to %s was denied by %s", request.Environment, status.Approver)
+		case "", "pending":
+		default:
+			return 0, fmt.Errorf("the approval service answered the unknown status %q", status.Status)
+		}
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-deadline:
+			return 0, fmt.Errorf("the access to %s was not approved within %s", request.Environment, approval.timeout())
+		case <-time.After(approvalPollInterval):
+		}
+		// a failed poll is retried, the service may be restarting
+		getCtx, cancel := context.WithTimeout(ctx, reportTimeout)
+		var polled approvalStatus
+		if err := getJSON(getCtx, statusURL, &polled); err == nil {
+			status = polled
+		}
+		cancel()
+	}
+
+	duration := time.Duration(request.DurationSeconds * float64(time.Second))
+	if approved := time.Duration(status.DurationSeconds * float64(time.Second)); approved > 0 && approved < duration {
+		duration = approved
+	}
+	fmt.Printf("The access to %s was approved by %s for %s.\n", request.Environment, status.Approver, duration)
+	return duration, nil
+}
+
+// announceApproval posts the request to the Slack incoming webhook
+func announceApproval(ctx context.Context, webhook string, request approvalRequest, approveURL string) error {
+	text := fmt.Sprintf("*%s* (%s) requests %s of access to *%s* from %s: %s\nTunnels: %s",
+		request.User, request.Account, time.Duration(request.DurationSeconds*float64(time.Second)), request.Environment, request.Host, request.Reason, strings.Join(request.Tunnels, ", "))
+	if approveURL != "" {
+		text += "\nApprove or deny: " + approveURL
+	}
+	ctx, cancel := context.WithTimeout(ctx, reportTimeout)
+	defer cancel()
+	return postJSON(ctx, webhook, "", map[string]string{"text": text}, nil)
+}
+
+// getJSON decodes the JSON response of a GET of the URL into out
+func getJSON(ctx context.Context, url string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRequestApproval(t *testing.T) {
+	defer func(interval time.Duration) { approvalPollInterval = interval }(approvalPollInterval)
+	approvalPollInterval = 10 * time.Millisecond
+
+	var mu sync.Mutex
+	var request approvalRequest
+	var slack string
+	polls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/requests":
+			json.NewDecoder(r.Body).Decode(&request)
+			json.NewEncoder(w).Encode(approvalStatus{Status: "pending", ApproveURL: "https://approvals/" + request.ID})
+		case r.Method == http.MethodPost && r.URL.Path == "/slack":
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			slack = body["text"]
+		case r.Method == http.MethodGet && r.URL.Path == "/requests/"+request.ID:
+			polls++
+			if polls < 2 {
+				json.NewEncoder(w).Encode(approvalStatus{Status: "pending"})
+				return
+			}
+			json.NewEncoder(w).Encode(approvalStatus{Status: "approved", Approver: "oncall@okcredit.in", DurationSeconds: 1800})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	approval := Approval{URL: server.URL + "/requests", SlackWebhook: server.URL + "/slack"}
+	proxyConfig := ProxyConfig{Environment: "prod", Bastion: Bastion{Connections: []Connection{{RemoteHost: "10.120.52.48", RemotePort: 5432}}}}
+	duration, err := requestApproval(context.Background(), approval, newApprovalRequest(approval, proxyConfig, "dev@okcredit.in", "INC-42 stuck payouts"))
+	if err != nil {
+		t.Fatalf("requestApproval failed: %v", err)
+	}
+	if duration != 30*time.Minute {
+		t.Errorf("requestApproval failed: expected the approved 30m instead of the requested 1h, got %s", duration)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if request.Reason != "INC-42 stuck payouts" || request.DurationSeconds != 3600 || len(request.Tunnels) != 1 {
+		t.Errorf("requestApproval failed: unexpected request %+v", request)
+	}
+	if !strings.Contains(slack, "INC-42 stuck payouts") || !strings.Contains(slack, "https://approvals/"+request.ID) {
+		t.Errorf("requestApproval failed: unexpected Slack message %q", slack)
+	}
+}
+
+func TestRequestApprovalDenied(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(approvalStatus{Status: "denied", Approver: "oncall@okcredit.in", Reason: "use the replica"})
+	}))
+	defer server.Close()
+
+	approval := Approval{URL: server.URL}
+	_, err := requestApproval(context.Background(), approval, newApprovalRequest(approval, ProxyConfig{Environment: "prod"}, "", "debugging"))
+	if err == nil || !strings.Contains(err.Error(), "use the replica") {
+		t.Errorf("requestApproval failed: expected the denial with its reason, got %v", err)
+	}
+}
+
+func TestApprovalReason(t *testing.T) {
+	if reason, err := approvalReason(" INC-42 ", nil, nil, false); err != nil || reason != "INC-42" {
+		t.Errorf("approvalReason failed: expected the reason of -reason, got %q, %v", reason, err)
+	}
+	if _, err := approvalReason("", strings.NewReader("INC-42\n"), nil, false); err == nil {
+		t.Error("approvalReason failed: expected -reason to be required without a terminal")
+	}
+	var out strings.Builder
+	if reason, err := approvalReason("", strings.NewReader("INC-42\n"), &out, true); err != nil || reason != "INC-42" {
+		t.Errorf("approvalReason failed: expected the typed reason, got %q, %v", reason, err)
+	}
+}
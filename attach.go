@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// runAttach connects to a running session, streams its output and sends it the commands
+// typed by the user. Ctrl-C detaches from the session without stopping it.
+func runAttach(args []string) {
+	fs := flag.NewFlagSet("devcli attach", flag.ExitOnError)
+	environment := fs.String("env", "", "Environment of the session, optional when a single session is running")
+	tunnel := fs.String("tunnel", "", "Only stream the output of this tunnel")
+	wait := fs.Bool("wait", false, "Wait for the session of -env to start instead of failing")
+	fs.Parse(args)
+
+	var client *controlClient
+	*environment, client = connectSession(*environment)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	for *wait {
+		if _, err := client.status(ctx); err == nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+	logs, err := client.logs(ctx)
+	if err != nil {
+		fmt.Printf("Error attaching to the session of environment %s: %v\n", *environment, err)
+		os.Exit(1)
+	}
+	defer logs.Body.Close()
+	fmt.Printf("Attached to the session of environment %s. Ctrl-C detaches, type help for the commands.\n", *environment)
+
+	ended := make(chan struct{})
+	go func() {
+		if *tunnel == "" {
+			io.Copy(os.Stdout, logs.Body)
+		} else {
+			copyTunnelLines(os.Stdout, logs.Body, *tunnel)
+		}
+		close(ended)
+	}()
+	go func() {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			attachCommand(ctx, client, scanner.Text())
+		}
+	}()
+
+	select {
+	case <-ctx.Done():
+		fmt.Println("\nDetached, the session keeps running in the background.")
+	case <-ended:
+		fmt.Println("Session ended.")
+	}
+}
+
+// copyTunnelLines copies the lines of the tunnel's output, which the logger prefixes with
+// the tunnel's name
+func copyTunnelLines(w io.Writer, r io.Reader, tunnel string) {
+	prefix := "[" + tunnel + "] "
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, prefix) {
+			fmt.Fprintln(w, line)
+		}
+	}
+}
+
+// connectSession returns the control API client of the environment's session, or of the
+// only running session when no environment is given
+func connectSession(environment string) (string, *controlClient) {
+	if environment == "" {
+		environments, err := runningSessions()
+		if err != nil {
+			fmt.Println("Error listing the running sessions:", err)
+			os.Exit(1)
+		}
+		switch len(environments) {
+		case 0:
+			fmt.Println("Error: no session is running, start one with devcli daemon")
+			os.Exit(1)
+		case 1:
+			environment = environments[0]
+		default:
+			fmt.Printf("Error: sessions of environments %s are running, choose one with -env\n", strings.Join(environments, ", "))
+			os.Exit(1)
+		}
+	}
+	socket, err := sessionSocket(environment)
+	if err != nil {
+		fmt.Println("Error getting the session directory:", err)
+		os.Exit(1)
+	}
+	return environment, newControlClient(socket)
+}
+
+// runTunnelAction implements devcli restart, pause and resume, which act on tunnels of a
+// running session. devcli restart -failed restarts every failed tunnel.
+func runTunnelAction(action string, args []string) {
+	fs := flag.NewFlagSet("devcli "+action, flag.ExitOnError)
+	environment := fs.String("env", "", "Environment of the session, optional when a single session is running")
+	var onlyFailed bool
+	if action == "restart" {
+		fs.BoolVar(&onlyFailed, "failed", false, "Restart every tunnel that failed or waits for its next restart")
+	}
+	fs.Usage = func() {
+		fmt.Printf("Usage: devcli %s [-env <environment>] <tunnel>...\n", action)
+		if action == "restart" {
+			fmt.Println("       devcli restart [-env <environment>] -failed")
+		}
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if (fs.NArg() == 0) != onlyFailed {
+		fs.Usage()
+		os.Exit(2)
+	}
+	_, client := connectSession(*environment)
+	ctx, cancel := context.WithTimeout(context.Background(), localCommandTimeout)
+	defer cancel()
+	if onlyFailed {
+		if err := restartFailed(ctx, client); err != nil {
+			fmt.Println("Error restarting the failed tunnels:", err)
+			os.Exit(1)
+		}
+		return
+	}
+	do := client.pause
+	switch action {
+	case "restart":
+		do = client.restart
+	case "resume":
+		do = client.resume
+	}
+	failed := false
+	for _, name := range fs.Args() {
+		if err := do(ctx, name); err != nil {
+			fmt.Printf("Error running %s on tunnel %s: %v\n", action, name, err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// runStop implements devcli stop, which ends a running session like Ctrl-C
+func runStop(args []string) {
+	fs := flag.NewFlagSet("devcli stop", flag.ExitOnError)
+	environment := fs.String("env", "", "Environment of the session, optional when a single session is running")
+	fs.Parse(args)
+	name, client := connectSession(*environment)
+	ctx, cancel := context.WithTimeout(context.Background(), localCommandTimeout)
+	defer cancel()
+	if err := client.stop(ctx); err != nil {
+		fmt.Printf("Error stopping the session of environment %s: %v\n", name, err)
+		os.Exit(1)
+	}
+}
+
+// restartFailed restarts the failed tunnels of the session and prints them
+func restartFailed(ctx context.Context, client *controlClient) error {
+	restarted, err := client.restartFailed(ctx)
+	if err != nil {
+		return err
+	}
+	printRestarted(restarted)
+	return nil
+}
+
+// printRestarted prints the tunnels restarted by restart -failed
+func printRestarted(restarted []string) {
+	if len(restarted) == 0 {
+		fmt.Println("No tunnel has failed.")
+		return
+	}
+	fmt.Println("Restarting tunnels", strings.Join(restarted, ", "))
+}
+
+// attachCommand runs one command typed in devcli attach
+func attachCommand(ctx context.Context, client *controlClient, line string) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return
+	}
+	switch {
+	case fields[0] == "status" && len(fields) == 1:
+		statuses, err := client.status(ctx)
+		if err != nil {
+			fmt.Println("Error getting the session status:", err)
+			return
+		}
+		writeStatusTable(os.Stdout, statuses)
+	case fields[0] == "restart" && len(fields) == 2 && strings.TrimLeft(fields[1], "-") == "failed":
+		if err := restartFailed(ctx, client); err != nil {
+			fmt.Println("Error restarting the failed tunnels:", err)
+		}
+	case fields[0] == "restart" && len(fields) == 2:
+		if err := client.restart(ctx, fields[1]); err != nil {
+			fmt.Println("Error restarting the tunnel:", err)
+		}
+	case fields[0] == "pause" && len(fields) == 2:
+		if err := client.pause(ctx, fields[1]); err != nil {
+			fmt.Println("Error pausing the tunnel:", err)
+		}
+	case fields[0] == "resume" && len(fields) == 2:
+		if err := client.resume(ctx, fields[1]); err != nil {
+			fmt.Println("Error resuming the tunnel:", err)
+		}
+	case fields[0] == "stop" && len(fields) == 1:
+		if err := client.stop(ctx); err != nil {
+			fmt.Println("Error stopping the session:", err)
+		}
+	default:
+		fmt.Println("Commands:")
+		fmt.Println("status           - print the status of every tunnel")
+		fmt.Println("restart <tunnel> - restart the tunnel of an app or remote_host:remote_port")
+		fmt.Println("restart -failed  - restart every failed tunnel right away")
+		fmt.Println("pause <tunnel>   - stop the tunnel and free its local port until it is resumed")
+		fmt.Println("resume <tunnel>  - start a paused tunnel again")
+		fmt.Println("stop             - stop the session")
+	}
+}
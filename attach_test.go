@@ -0,0 +1,16 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCopyTunnelLines(t *testing.T) {
+	output := "[cashfree] Forwarding from 127.0.0.1:8080 -> 8080\n[cashfree-admin] Forwarding from 127.0.0.1:8081 -> 8080\nEvery tunnel is ready:\n[cashfree] Handling connection for 8080\n"
+	var b strings.Builder
+	copyTunnelLines(&b, strings.NewReader(output), "cashfree")
+	expected := "[cashfree] Forwarding from 127.0.0.1:8080 -> 8080\n[cashfree] Handling connection for 8080\n"
+	if b.String() != expected {
+		t.Errorf("copyTunnelLines failed: expected %q, got %q", expected, b.String())
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// auditRecord is one line of the audit log, describing an external command that ran
+type auditRecord struct {
+	Time        time.Time `json:"time"`
+	Environment string    `json:"environment,omitempty"`
+	Command     []string  `json:"command"`
+	ExitCode    int       `json:"exit_code"`
+	DurationMs  int64     `json:"duration_ms"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// auditLog appends a JSON line for every gcloud, kubectl, ssh and hook command of the
+// session to a file that is only ever appended to. It is safe for concurrent use.
+type auditLog struct {
+	mu          sync.Mutex
+	file        *os.File
+	environment string
+}
+
+// audit is the audit log of the session, nil when it is disabled
+var audit *auditLog
+
+// defaultAuditPath is the audit log used unless -audit-log names another file
+func defaultAuditPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, ".devcli", "audit.log"), nil
+}
+
+// openAuditLog opens the audit log at path for appending, creating it readable by the user only
+func openAuditLog(path, environment string) (*auditLog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &auditLog{file: file, environment: environment}, nil
+}
+
+// record appends the outcome of a command that started at started and returned err
+func (a *auditLog) record(cmd *exec.Cmd, started time.Time, err error) {
+	if a == nil {
+		return
+	}
+	entry := auditRecord{
+		Time:        started.UTC(),
+		Environment: a.environment,
+		Command:     cmd.Args,
+		ExitCode:    -1,
+		DurationMs:  time.Since(started).Milliseconds(),
+	}
+	if cmd.ProcessState != nil {
+		entry.ExitCode = cmd.ProcessState.ExitCode()
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	line, marshalErr := json.Marshal(entry)
+	if marshalErr != nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.file.Write(append(line, '\n')); err != nil {
+		fmt.Println("Warning: writing the audit log failed:", err)
+	}
+}
+
+func (a *auditLog) close() {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.file.Close()
+}
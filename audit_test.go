@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuditLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devcli", "audit.log")
+	log, err := openAuditLog(path, "staging")
+	if err != nil {
+		t.Fatalf("openAuditLog failed: %v", err)
+	}
+	succeeded := exec.Command("gcloud", "config", "set", "project", "okcredit-staging-env")
+	log.record(succeeded, time.Now(), nil)
+	failed := exec.Command("kubectl", "get", "pods")
+	log.record(failed, time.Now(), errors.New("exit status 1"))
+	log.close()
+
+	// reopening appends to the existing records
+	log, err = openAuditLog(path, "prod")
+	if err != nil {
+		t.Fatalf("openAuditLog failed: %v", err)
+	}
+	log.record(exec.Command("gcloud", "version"), time.Now(), nil)
+	log.close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("audit log failed: expected 3 records, got %d", len(lines))
+	}
+	var records []auditRecord
+	for _, line := range lines {
+		var record auditRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("audit log failed: invalid record %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	if strings.Join(records[0].Command, " ") != "gcloud config set project okcredit-staging-env" || records[0].Environment != "staging" {
+		t.Errorf("audit log failed: unexpected first record %+v", records[0])
+	}
+	if records[1].Error != "exit status 1" || records[1].ExitCode != -1 {
+		t.Errorf("audit log failed: unexpected failed record %+v", records[1])
+	}
+	if records[2].Environment != "prod" {
+		t.Errorf("audit log failed: unexpected record after reopening %+v", records[2])
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("audit log failed: expected mode 0600, got %v", info.Mode().Perm())
+	}
+}
+
+func TestAuditLogDisabled(t *testing.T) {
+	var log *auditLog
+	log.record(exec.Command("gcloud", "version"), time.Now(), nil)
+	log.close()
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+	"sync"
+)
+
+// zoneResolver holds the zones of the bastion shared by the tunnels reaching it. A zone is
+// looked up again when the instance is not found in it, e.g. after the bastion was
+// recreated in another zone during an incident.
+type zoneResolver struct {
+	mu   sync.Mutex
+	name string
+	// zones are by project, the environment's being the empty one
+	zones map[string]string
+	// lookup returns the zone of the bastion in the project, never from the startup state
+	lookup func(project string) (string, error)
+	// moved is called with the zones after one of them changed
+	moved func(zones map[string]string)
+}
+
+// newZoneResolver returns the zones of the bastion, in zone in the environment's project and
+// in the zones of the other projects
+func newZoneResolver(name, zone string, zones map[string]string, lookup func(project string) (string, error)) *zoneResolver {
+	z := &zoneResolver{name: name, zones: maps.Clone(zones), lookup: lookup}
+	if z.zones == nil {
+		z.zones = make(map[string]string)
+	}
+	z.zones[""] = zone
+	return z
+}
+
+// key returns the project the zone is kept by, the environment's one for the projects not
+// looked up on their own, the caller holds the lock
+func (z *zoneResolver) key(project string) string {
+	if _, ok := z.zones[project]; ok {
+		return project
+	}
+	return ""
+}
+
+// zone returns the zone of the bastion in the project
+func (z *zoneResolver) zone(project string) string {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	return z.zones[z.key(project)]
+}
+
+// relocate looks the zone of the bastion in the project up again after it was not found in
+// the stale zone, and reports whether it is in another zone now. The tunnels failing on the
+// same stale zone look it up once.
+func (z *zoneResolver) relocate(project, stale string) (string, bool, error) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	project = z.key(project)
+	if current := z.zones[project]; current != stale {
+		return current, true, nil
+	}
+	zone, err := z.lookup(project)
+	if err != nil {
+		return stale, false, fmt.Errorf("looking up the zone of bastion %s again: %w", z.name, err)
+	}
+	if zone == "" || zone == stale {
+		return stale, false, nil
+	}
+	z.zones[project] = zone
+	fmt.Printf("Bastion %s moved from zone %s to %s, reconnecting\n", z.name, stale, zone)
+	if z.moved != nil {
+		z.moved(maps.Clone(z.zones))
+	}
+	return zone, true, nil
+}
+
+// instanceNotFound reports whether gcloud compute ssh failed because the bastion instance
+// does not exist in the zone it was given
+func instanceNotFound(err error, name string) bool {
+	var cmdErr *CommandError
+	return errors.As(err, &cmdErr) && cmdErr.Class == ClassNotFound && strings.Contains(cmdErr.Stderr, "/instances/"+name)
+}
+
+// connectRelocating runs the gcloud compute ssh command of connect with the zone of the
+// bastion in the project. When the instance is not found there, the zone is looked up
+// again and the command run once more in its new zone.
+func (z *zoneResolver) connectRelocating(project string, connect func(zone string) error) error {
+	zone := z.zone(project)
+	err := connect(zone)
+	if !instanceNotFound(err, z.name) {
+		return err
+	}
+	moved, ok, lookupErr := z.relocate(project, zone)
+	if lookupErr != nil {
+		fmt.Println("Error:", lookupErr)
+		return err
+	}
+	if !ok {
+		return err
+	}
+	return connect(moved)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+const testInstanceNotFound = "ERROR: (gcloud.compute.ssh) Could not fetch resource:\n" +
+	" - The resource 'projects/okcredit-staging-env/zones/asia-south1-a/instances/bastion' was not found"
+
+func TestConnectRelocating(t *testing.T) {
+	lookups := 0
+	zones := newZoneResolver("bastion", "asia-south1-a", map[string]string{"okcredit-shared": "asia-south1-b"}, func(project string) (string, error) {
+		lookups++
+		return "asia-south1-c", nil
+	})
+	var moved map[string]string
+	zones.moved = func(zones map[string]string) { moved = zones }
+
+	var tried []string
+	connect := func(zone string) error {
+		tried = append(tried, zone)
+		if zone == "asia-south1-a" {
+			return &CommandError{Class: ClassNotFound, Stderr: testInstanceNotFound, Err: errors.New("exit status 1")}
+		}
+		return nil
+	}
+	if err := zones.connectRelocating("", connect); err != nil || !slices.Equal(tried, []string{"asia-south1-a", "asia-south1-c"}) {
+		t.Errorf("connectRelocating failed: expected a retry in the new zone, tried %v, %v", tried, err)
+	}
+	if moved[""] != "asia-south1-c" || moved["okcredit-shared"] != "asia-south1-b" {
+		t.Errorf("connectRelocating failed: unexpected zones %v", moved)
+	}
+
+	// a tunnel failing on the stale zone after the move does not look it up again
+	if zone, ok, err := zones.relocate("okcredit-staging-env", "asia-south1-a"); zone != "asia-south1-c" || !ok || err != nil || lookups != 1 {
+		t.Errorf("relocate failed: expected the known zone without a lookup, got %s, %v, %v after %d lookups", zone, ok, err, lookups)
+	}
+	if zone := zones.zone("okcredit-shared"); zone != "asia-south1-b" {
+		t.Errorf("zone failed: expected the zone of the other project, got %s", zone)
+	}
+
+	// other failures are returned as they are
+	failed := &CommandError{Class: ClassHostUnreachable, Stderr: "Connection timed out", Err: errors.New("exit status 255")}
+	if err := zones.connectRelocating("okcredit-shared", func(string) error { return failed }); err != failed || lookups != 1 {
+		t.Errorf("connectRelocating failed: expected the failure without a lookup, got %v after %d lookups", err, lookups)
+	}
+}
+
+func TestRelocateUnmoved(t *testing.T) {
+	zones := newZoneResolver("bastion", "asia-south1-a", nil, func(string) (string, error) { return "asia-south1-a", nil })
+	notFound := &CommandError{Class: ClassNotFound, Stderr: testInstanceNotFound, Err: errors.New("exit status 1")}
+	attempts := 0
+	err := zones.connectRelocating("", func(string) error {
+		attempts++
+		return notFound
+	})
+	if err != notFound || attempts != 1 {
+		t.Errorf("connectRelocating failed: expected no retry in the same zone, got %v after %d attempts", err, attempts)
+	}
+	if instanceNotFound(notFound, "bastion-2") {
+		t.Error("instanceNotFound failed: expected another instance not to match")
+	}
+}
+
+func TestUpdateBastionZones(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	saved := time.Now().Add(-time.Minute)
+	cache := &startCache{Key: "key", SavedAt: saved, BastionZones: map[string]string{"okcredit-staging-env": "asia-south1-a"}}
+	if err := cache.save("staging"); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	if err := updateBastionZones("staging", "key", map[string]string{"okcredit-staging-env": "asia-south1-c"}); err != nil {
+		t.Fatalf("updateBastionZones failed: %v", err)
+	}
+	updated := loadStartCache("staging", "key")
+	if updated == nil || updated.BastionZones["okcredit-staging-env"] != "asia-south1-c" || !updated.SavedAt.Equal(saved) {
+		t.Errorf("updateBastionZones failed: expected the new zone with the same age, got %+v", updated)
+	}
+	if err := updateBastionZones("production", "key", map[string]string{"okcredit-prod": "asia-south1-a"}); err != nil || loadStartCache("production", "key") != nil {
+		t.Errorf("updateBastionZones failed: expected no startup state to be created, got %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	defaultBreakerRestarts   = 5
+	defaultBreakerWindow     = 10 * time.Minute
+	defaultBreakerRetryAfter = 10 * time.Minute
+	// recentErrorCount is how many of the last errors of a tunnel its status keeps
+	recentErrorCount = 3
+)
+
+// CircuitBreaker stops restarting a flapping tunnel with backoff once it failed more than
+// restarts times within window: the tunnel is degraded and only retried every retry_after,
+// instead of burning CPU and gcloud quota on a target that is down
+type CircuitBreaker struct {
+	Disabled   bool          `yaml:"disabled"`
+	Restarts   int           `yaml:"restarts"`
+	Window     time.Duration `yaml:"window"`
+	RetryAfter time.Duration `yaml:"retry_after"`
+}
+
+func (b CircuitBreaker) restarts() int {
+	if b.Restarts == 0 {
+		return defaultBreakerRestarts
+	}
+	return b.Restarts
+}
+
+func (b CircuitBreaker) window() time.Duration {
+	if b.Window == 0 {
+		return defaultBreakerWindow
+	}
+	return b.Window
+}
+
+func (b CircuitBreaker) retryAfter() time.Duration {
+	if b.RetryAfter == 0 {
+		return defaultBreakerRetryAfter
+	}
+	return b.RetryAfter
+}
+
+// validate checks that the settings are not negative
+func (b CircuitBreaker) validate() error {
+	if b.Restarts < 0 || b.Window < 0 || b.RetryAfter < 0 {
+		return fmt.Errorf("circuit_breaker restarts, window and retry_after must not be negative")
+	}
+	return nil
+}
+
+// record adds a failure of the tunnel at now to its failures within the window, and
+// reports whether the breaker trips
+func (b CircuitBreaker) record(failures []time.Time, now time.Time) ([]time.Time, bool) {
+	recent := failures[:0]
+	for _, failure := range failures {
+		if now.Sub(failure) < b.window() {
+			recent = append(recent, failure)
+		}
+	}
+	recent = append(recent, now)
+	return recent, !b.Disabled && len(recent) > b.restarts()
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerRecord(t *testing.T) {
+	now := time.Now()
+	b := CircuitBreaker{Restarts: 2, Window: time.Minute}
+	failures := []time.Time{now.Add(-2 * time.Minute), now.Add(-30 * time.Second)}
+	failures, tripped := b.record(failures, now)
+	if len(failures) != 2 || tripped {
+		t.Errorf("record failed: expected the old failure to be forgotten, got %v and tripped %v", failures, tripped)
+	}
+	if _, tripped := b.record(failures, now); !tripped {
+		t.Error("record failed: expected the third failure in the window to trip the breaker")
+	}
+	b.Disabled = true
+	if _, tripped := b.record(failures, now); tripped {
+		t.Error("record failed: a disabled breaker must not trip")
+	}
+}
+
+func TestCircuitBreakerDefaults(t *testing.T) {
+	var b CircuitBreaker
+	if b.restarts() != 5 || b.window() != 10*time.Minute || b.retryAfter() != 10*time.Minute {
+		t.Errorf("circuit breaker failed: unexpected defaults %d, %s and %s", b.restarts(), b.window(), b.retryAfter())
+	}
+	if err := (CircuitBreaker{Restarts: -1}).validate(); err == nil {
+		t.Error("validate failed: expected an error for negative restarts")
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// capture records the traffic flowing through one tunnel into a pcap or HAR file
+type capture struct {
+	tunnel   string
+	out      string
+	duration time.Duration
+
+	file *os.File
+	pcap *pcapWriter
+	har  *harLog
+	wg   sync.WaitGroup
+}
+
+// runCapture implements `devcli capture <tunnel> -out dump.pcap`: it starts a session with
+// only the given tunnel and records its traffic for a bounded time
+func runCapture(args []string) {
+	var opts options
+	c := &capture{}
+	fs := flag.NewFlagSet("devcli capture", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: devcli capture <tunnel> -out dump.pcap|dump.har [-duration 1m]")
+		fs.PrintDefaults()
+	}
+	sessionFlags(fs, &opts)
+	fs.StringVar(&c.out, "out", "", "File to write the captured traffic to (.pcap, or .har for protocol: http workloads)")
+	fs.DurationVar(&c.duration, "duration", time.Minute, "How long to capture traffic for")
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		c.tunnel = args[0]
+		args = args[1:]
+	}
+	fs.Parse(args)
+	if c.tunnel == "" {
+		c.tunnel = fs.Arg(0)
+	}
+	if c.tunnel == "" || c.out == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if c.duration <= 0 {
+		fmt.Println("Error: capture duration must be positive.")
+		os.Exit(1)
+	}
+
+	// probes and health checks would show up in the capture
+	opts.probeInterval = 0
+	opts.healthInterval = 0
+	opts.only = c.tunnel
+	opts.capture = c
+	runSession(opts)
+}
+
+// validateCapture checks that the captured tunnel can be recorded. The readiness probes of
+// a health gate would show up in the capture.
+func validateCapture(config ProxyConfig) error {
+	for _, workload := range config.Workloads {
+		if workload.HealthGate {
+			return fmt.Errorf("workload %s has health_gate, which cannot be captured", workload.Name())
+		}
+	}
+	return nil
+}
+
+// serve listens on localPort, the tunnel's local port or the internal port of its meter
+// relay, and records the traffic relayed to the child process listening on targetPort until
+// the context is canceled. The packets are recorded as sent to the tunnel's local port.
+func (c *capture) serve(ctx context.Context, localPort, targetPort, tunnelPort int, protocol string) {
+	var err error
+	c.file, err = os.Create(c.out)
+	if err != nil {
+		fmt.Println("Error creating the capture file:", err)
+		os.Exit(1)
+	}
+
+	if strings.EqualFold(filepath.Ext(c.out), ".har") {
+		if protocol != "http" {
+			fmt.Println("Error: HAR captures are only supported for workloads with protocol: http.")
+			os.Exit(1)
+		}
+		c.har = &harLog{}
+		target := &url.URL{Scheme: "http", Host: internalAddress(targetPort)}
+		server := &http.Server{
+			Addr:    net.JoinHostPort(portHost(localPort, tunnelPort), strconv.Itoa(localPort)),
+			Handler: c.har.wrap(httputil.NewSingleHostReverseProxy(target)),
+		}
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			go func() {
+				<-ctx.Done()
+				server.Close()
+			}()
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				fmt.Println("Error serving the capture proxy:", err)
+			}
+		}()
+		return
+	}
+
+	c.pcap, err = newPCAPWriter(c.file, tunnelPort)
+	if err != nil {
+		fmt.Println("Error writing the capture file:", err)
+		os.Exit(1)
+	}
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		r := &relay{host: portHost(localPort, tunnelPort), listenPort: localPort, targetPort: targetPort, observer: c.pcap}
+		if err := r.run(ctx); err != nil {
+			fmt.Println("Error relaying the captured tunnel:", err)
+		}
+	}()
+}
+
+// finish waits for the relayed connections to end and completes the capture file
+func (c *capture) finish() error {
+	c.wg.Wait()
+	if c.file == nil {
+		return fmt.Errorf("tunnel %s was never started", c.tunnel)
+	}
+	var err error
+	if c.har != nil {
+		err = c.har.write(c.file)
+	} else {
+		err = c.pcap.Close()
+	}
+	if closeErr := c.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println("Wrote the traffic capture to:", c.out)
+	return nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// test for relay recording an echo exchange with pcapWriter
+func TestRelayPCAP(t *testing.T) {
+	echo, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Error creating listener: %v", err)
+	}
+	defer echo.Close()
+	go func() {
+		conn, err := echo.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(conn, conn)
+	}()
+
+	listenPort, err := freeLocalPort()
+	if err != nil {
+		t.Fatalf("Error allocating port: %v", err)
+	}
+	var out bytes.Buffer
+	pcap, err := newPCAPWriter(&out, listenPort)
+	if err != nil {
+		t.Fatalf("newPCAPWriter failed: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		r := &relay{listenPort: listenPort, targetPort: echo.Addr().(*net.TCPAddr).Port, observer: pcap}
+		done <- r.run(ctx)
+	}()
+
+	var conn net.Conn
+	for i := 0; i < 50; i++ {
+		if conn, err = net.Dial("tcp", fmt.Sprintf("localhost:%d", listenPort)); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("Error connecting to the relay: %v", err)
+	}
+	conn.Write([]byte("ping"))
+	reply := make([]byte, 4)
+	if _, err := io.ReadFull(conn, reply); err != nil || string(reply) != "ping" {
+		t.Fatalf("relay failed: expected echo, got %q (%v)", reply, err)
+	}
+	conn.Close()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("relay failed: %v", err)
+	}
+	if err := pcap.Close(); err != nil {
+		t.Fatalf("pcapWriter.Close failed: %v", err)
+	}
+
+	data := out.Bytes()
+	if binary.LittleEndian.Uint32(data[0:4]) != 0xa1b2c3d4 || binary.LittleEndian.Uint32(data[20:24]) != pcapLinkTypeRaw {
+		t.Fatalf("newPCAPWriter failed: unexpected header %x", data[:24])
+	}
+	// handshake, two data segments and teardown
+	packets := 0
+	for offset := 24; offset < len(data); packets++ {
+		offset += 16 + int(binary.LittleEndian.Uint32(data[offset+8:offset+12]))
+	}
+	if packets != 8 {
+		t.Errorf("pcapWriter failed: expected 8 packets, got %d", packets)
+	}
+	if !bytes.Contains(data, []byte("ping")) {
+		t.Error("pcapWriter failed: payload is missing from the capture")
+	}
+}
+
+func TestInternetChecksum(t *testing.T) {
+	// example IPv4 header from RFC 1071 style textbooks
+	header := []byte{0x45, 0x00, 0x00, 0x73, 0x00, 0x00, 0x40, 0x00, 0x40, 0x11, 0x00, 0x00, 0xc0, 0xa8, 0x00, 0x01, 0xc0, 0xa8, 0x00, 0xc7}
+	if sum := internetChecksum(header); sum != 0xb861 {
+		t.Errorf("internetChecksum failed: expected 0xb861, got %#x", sum)
+	}
+}
+
+// test for harLog recording a proxied exchange
+func TestHARLog(t *testing.T) {
+	har := &harLog{}
+	server := httptest.NewServer(har.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true}`))
+	})))
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/v1/orders?page=2", "application/json", strings.NewReader(`{"id":1}`))
+	if err != nil {
+		t.Fatalf("Error calling the server: %v", err)
+	}
+	resp.Body.Close()
+
+	var out bytes.Buffer
+	if err := har.write(&out); err != nil {
+		t.Fatalf("harLog.write failed: %v", err)
+	}
+	var doc struct {
+		Log struct {
+			Entries []harEntry `json:"entries"`
+		} `json:"log"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &doc); err != nil {
+		t.Fatalf("harLog.write failed: invalid JSON: %v", err)
+	}
+	if len(doc.Log.Entries) != 1 {
+		t.Fatalf("harLog failed: expected 1 entry, got %d", len(doc.Log.Entries))
+	}
+	entry := doc.Log.Entries[0]
+	if entry.Request.Method != "POST" || entry.Request.PostData == nil || entry.Request.PostData.Text != `{"id":1}` {
+		t.Errorf("harLog failed: unexpected request %+v", entry.Request)
+	}
+	if entry.Response.Content.Text != `{"ok":true}` || len(entry.Request.QueryString) != 1 {
+		t.Errorf("harLog failed: unexpected entry %+v", entry)
+	}
+}
+
+// test for a capture recording the traffic behind the meter relay of the tunnel
+func TestInterposeCapture(t *testing.T) {
+	localPort, err := freeLocalPort()
+	if err != nil {
+		t.Fatalf("Error allocating port: %v", err)
+	}
+	c := &capture{tunnel: "cashfree", out: filepath.Join(t.TempDir(), "cashfree.pcap")}
+	registry := newStatusRegistry()
+	registry.register("cashfree", kindWorkload, localPort, "")
+	ctx, cancel := context.WithCancel(context.Background())
+	childPort, err := interpose(ctx, nil, options{meter: true, capture: c}, ProxyConfig{}, registry, "cashfree", localPort, "", nil, nil)
+	if err != nil {
+		t.Fatalf("interpose failed: %v", err)
+	}
+	// the tunnel's child process
+	child, err := net.Listen("tcp", fmt.Sprintf("localhost:%d", childPort))
+	if err != nil {
+		t.Fatalf("Error listening on the child port: %v", err)
+	}
+	defer child.Close()
+	go func() {
+		conn, err := child.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(conn, conn)
+	}()
+
+	conn := dialRelay(t, localPort)
+	conn.Write([]byte("ping"))
+	reply := make([]byte, 4)
+	if _, err := io.ReadFull(conn, reply); err != nil || string(reply) != "ping" {
+		t.Fatalf("relay failed: expected echo, got %q (%v)", reply, err)
+	}
+	conn.Close()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := c.finish(); err != nil {
+		t.Fatalf("finish failed: %v", err)
+	}
+	if sent := registry.snapshot()[0].BytesSent; sent != 4 {
+		t.Errorf("interpose failed: expected the meter relay to count 4 bytes, got %d", sent)
+	}
+	data, err := os.ReadFile(c.out)
+	if err != nil || !bytes.Contains(data, []byte("ping")) {
+		t.Errorf("interpose failed: expected the capture to record the payload, got %v", err)
+	}
+	// the packets are recorded as sent to the tunnel's local port
+	if !bytes.Contains(data, binary.BigEndian.AppendUint16(nil, uint16(localPort))) {
+		t.Error("interpose failed: expected the packets to the tunnel's local port")
+	}
+}
+
+func TestValidateCapture(t *testing.T) {
+	config := ProxyConfig{Workloads: []Workload{{App: "cashfree", LocalPort: 8080}}}
+	if err := validateCapture(config); err != nil {
+		t.Errorf("validateCapture failed: %v", err)
+	}
+	config.Workloads[0].HealthGate = true
+	if err := validateCapture(config); err == nil || !strings.Contains(err.Error(), "health_gate") {
+		t.Errorf("validateCapture failed: expected the health gate to be refused, got %v", err)
+	}
+}
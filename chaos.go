@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+var errChaosReset = errors.New("connection reset by chaos mode")
+
+// ChaosRule degrades the traffic of one tunnel when devcli runs with -chaos
+type ChaosRule struct {
+	Tunnel string `yaml:"tunnel"`
+	// Latency is added before every chunk of data is forwarded, plus a random Jitter
+	Latency time.Duration `yaml:"latency"`
+	Jitter  time.Duration `yaml:"jitter"`
+	// Drop is the probability that a new connection is closed right after it is accepted
+	Drop float64 `yaml:"drop"`
+	// Reset is the probability that a connection is reset each time data flows through it
+	Reset float64 `yaml:"reset"`
+}
+
+func (r *ChaosRule) drops() bool {
+	return r.Drop > 0 && rand.Float64() < r.Drop
+}
+
+func (r *ChaosRule) resets() bool {
+	return r.Reset > 0 && rand.Float64() < r.Reset
+}
+
+func (r *ChaosRule) delay() {
+	d := r.Latency
+	if r.Jitter > 0 {
+		d += time.Duration(rand.Int63n(int64(r.Jitter)))
+	}
+	if d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// String describes the faults injected by the rule
+func (r *ChaosRule) String() string {
+	var faults []string
+	if r.Latency > 0 || r.Jitter > 0 {
+		faults = append(faults, fmt.Sprintf("latency %s±%s", r.Latency, r.Jitter))
+	}
+	if r.Drop > 0 {
+		faults = append(faults, fmt.Sprintf("drop %.0f%%", r.Drop*100))
+	}
+	if r.Reset > 0 {
+		faults = append(faults, fmt.Sprintf("reset %.0f%%", r.Reset*100))
+	}
+	if len(faults) == 0 {
+		return "no faults"
+	}
+	return strings.Join(faults, ", ")
+}
+
+// validateChaosRules checks that every rule targets a tunnel of the environment and uses
+// probabilities between 0 and 1
+func validateChaosRules(config ProxyConfig) error {
+	names := make(map[string]bool)
+	for _, workload := range config.Workloads {
+		names[workload.Name()] = true
+	}
+	for _, connection := range config.Bastion.Connections {
+		names[connection.Name()] = true
+	}
+	for _, rule := range config.Chaos {
+		if !names[rule.Tunnel] {
+			return fmt.Errorf("chaos rule for unknown tunnel %s", rule.Tunnel)
+		}
+		if rule.Drop < 0 || rule.Drop > 1 || rule.Reset < 0 || rule.Reset > 1 {
+			return fmt.Errorf("chaos rule for tunnel %s: drop and reset must be between 0 and 1", rule.Tunnel)
+		}
+		if rule.Latency < 0 || rule.Jitter < 0 {
+			return fmt.Errorf("chaos rule for tunnel %s: latency and jitter must not be negative", rule.Tunnel)
+		}
+	}
+	return nil
+}
+
+// chaosRule returns the rule of the named tunnel, or nil if it has none
+func chaosRule(config ProxyConfig, name string) *ChaosRule {
+	for i := range config.Chaos {
+		if config.Chaos[i].Tunnel == name {
+			return &config.Chaos[i]
+		}
+	}
+	return nil
+}
+
+// runChaosRelay serves the tunnel's local port, or the internal port of its meter relay on
+// host, through a relay that injects the rule's faults
+func runChaosRelay(ctx context.Context, name, host string, localPort, targetPort int, rule *ChaosRule) {
+	r := &relay{host: host, listenPort: localPort, targetPort: targetPort, chaos: rule}
+	if err := r.run(ctx); err != nil {
+		fmt.Printf("Error running the chaos relay of %s: %v\n", name, err)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// startChaosRelay starts a relay with the rule in front of an echo server and returns its port
+func startChaosRelay(t *testing.T, rule *ChaosRule) (int, context.CancelFunc) {
+	echo, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Error creating listener: %v", err)
+	}
+	go func() {
+		for {
+			conn, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	port, err := freeLocalPort()
+	if err != nil {
+		t.Fatalf("Error allocating port: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &relay{listenPort: port, targetPort: echo.Addr().(*net.TCPAddr).Port, chaos: rule}
+	go r.run(ctx)
+	t.Cleanup(func() { echo.Close() })
+	return port, cancel
+}
+
+func dialRelay(t *testing.T, port int) net.Conn {
+	for i := 0; i < 50; i++ {
+		conn, err := net.Dial("tcp", localAddress(port))
+		if err == nil {
+			return conn
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Error connecting to the relay on port %d", port)
+	return nil
+}
+
+func TestChaosRelay(t *testing.T) {
+	// latency is added to every chunk in both directions
+	port, cancel := startChaosRelay(t, &ChaosRule{Latency: 50 * time.Millisecond})
+	conn := dialRelay(t, port)
+	start := time.Now()
+	conn.Write([]byte("ping"))
+	reply := make([]byte, 4)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		t.Fatalf("chaos relay failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("chaos relay failed: expected at least 100ms of latency, got %s", elapsed)
+	}
+	conn.Close()
+	cancel()
+
+	// dropped connections are closed without any data
+	port, cancel = startChaosRelay(t, &ChaosRule{Drop: 1})
+	defer cancel()
+	conn = dialRelay(t, port)
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(reply); err == nil {
+		t.Error("chaos relay failed: expected the connection to be dropped")
+	}
+}
+
+func TestValidateChaosRules(t *testing.T) {
+	config := ProxyConfig{
+		Workloads: []Workload{{App: "cashfree", LocalPort: 8080}},
+		Chaos:     []ChaosRule{{Tunnel: "cashfree", Drop: 0.5}},
+	}
+	if err := validateChaosRules(config); err != nil {
+		t.Errorf("validateChaosRules failed: %v", err)
+	}
+	config.Chaos = []ChaosRule{{Tunnel: "ledger"}}
+	if err := validateChaosRules(config); err == nil {
+		t.Error("validateChaosRules failed: expected an error for an unknown tunnel")
+	}
+	config.Chaos = []ChaosRule{{Tunnel: "cashfree", Reset: 2}}
+	if err := validateChaosRules(config); err == nil {
+		t.Error("validateChaosRules failed: expected an error for an invalid probability")
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// children are the process groups of the running tunnel and hook commands, killed on a
+// forced exit so that no ssh or kubectl is left holding a local port. They are also listed
+// in the session's state file, so that the next session cleans them up if this one crashes.
+var children = struct {
+	sync.Mutex
+	groups map[int]childProcess
+	// state is the path of the state file, empty until trackChildren is called
+	state       string
+	environment string
+	started     string
+}{groups: make(map[int]childProcess)}
+
+// childState is the state file of a session
+type childState struct {
+	Environment string         `json:"environment"`
+	PID         int            `json:"pid"`
+	Started     string         `json:"started"`
+	Children    []childProcess `json:"children"`
+}
+
+// childProcess is a process group started by a session, identified by the pid of its
+// leader and the start time of the leader, so that a reused pid is not mistaken for it
+type childProcess struct {
+	PID     int    `json:"pid"`
+	Started string `json:"started"`
+	Command string `json:"command"`
+}
+
+// childStateFile is the state file of the devcli process with the pid
+func childStateFile(pid int) (string, error) {
+	dir, err := sessionDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "children-"+strconv.Itoa(pid)+".json"), nil
+}
+
+// trackChildren keeps the state file of the environment's session from then on. Nothing is
+// tracked on platforms where the start time of processes is not known.
+func trackChildren(environment string) {
+	started, ok := processStarted(os.Getpid())
+	if !ok {
+		return
+	}
+	state, err := childStateFile(os.Getpid())
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(state), 0o700)
+	}
+	if err != nil {
+		fmt.Println("Warning: the processes of the session are not tracked:", err)
+		return
+	}
+	children.Lock()
+	defer children.Unlock()
+	children.state, children.environment, children.started = state, environment, started
+	saveChildState()
+}
+
+// untrackChildren removes the state file once every child exited
+func untrackChildren() {
+	children.Lock()
+	defer children.Unlock()
+	if children.state != "" {
+		os.Remove(children.state)
+		children.state = ""
+	}
+}
+
+// saveChildState writes the state file, the caller holds the lock. The state is best
+// effort: a session that cannot write it runs as before, only without the cleanup.
+func saveChildState() {
+	if children.state == "" {
+		return
+	}
+	state := childState{Environment: children.environment, PID: os.Getpid(), Started: children.started, Children: []childProcess{}}
+	for _, child := range children.groups {
+		state.Children = append(state.Children, child)
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return
+	}
+	tmp := children.state + ".tmp"
+	if os.WriteFile(tmp, data, 0o600) == nil {
+		os.Rename(tmp, children.state)
+	}
+}
+
+// runChild runs the command prepared by terminateGracefully and kills what is left of its
+// process group once it exited, e.g. the ssh started by gcloud compute ssh
+func runChild(cmd *exec.Cmd) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	pid := cmd.Process.Pid
+	child := childProcess{PID: pid, Command: commandLine(cmd)}
+	children.Lock()
+	if children.state != "" {
+		child.Started, _ = processStarted(pid)
+	}
+	children.groups[pid] = child
+	saveChildState()
+	children.Unlock()
+	err := cmd.Wait()
+	killProcessGroup(pid)
+	children.Lock()
+	delete(children.groups, pid)
+	saveChildState()
+	children.Unlock()
+	return err
+}
+
+// killChildren kills the process group of every running child, it returns how many there
+// were
+func killChildren() int {
+	children.Lock()
+	defer children.Unlock()
+	for pid := range children.groups {
+		killProcessGroup(pid)
+	}
+	return len(children.groups)
+}
+
+// cleanStaleSessions kills the process groups left over by the sessions whose devcli
+// process is gone, e.g. after a crash, and removes their state files. Only the processes
+// devcli started are killed: a group whose leader is running but started at another time
+// belongs to a process that reused the pid and is left alone. It returns the groups of the
+// stale sessions, so that their processes still holding a local port are known as devcli's.
+func cleanStaleSessions() []childProcess {
+	dir, err := sessionDir()
+	if err != nil {
+		return nil
+	}
+	var stale []childProcess
+	files, _ := filepath.Glob(filepath.Join(dir, "children-*.json"))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		var state childState
+		if err := json.Unmarshal(data, &state); err != nil {
+			os.Remove(file)
+			continue
+		}
+		if started, ok := processStarted(state.PID); ok && started == state.Started {
+			continue
+		}
+		for _, child := range state.Children {
+			// the group outlives its leader as long as one of its processes runs, and its id is
+			// not given to another process meanwhile
+			if started, ok := processStarted(child.PID); ok && started != child.Started {
+				continue
+			}
+			stale = append(stale, child)
+			if killProcessGroup(child.PID) {
+				fmt.Printf("Killed %s, left over by a session of environment %s that did not exit cleanly.\n", child.Command, state.Environment)
+			}
+		}
+		os.Remove(file)
+	}
+	return stale
+}
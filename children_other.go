@@ -0,0 +1,29 @@
+//go:build !unix
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup does nothing, process groups are not available on this platform
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// terminateProcessGroup signals the command itself on this platform
+func terminateProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Signal(syscall.SIGTERM)
+}
+
+// killProcessGroup kills the process itself on this platform
+func killProcessGroup(pid int) bool {
+	process, err := os.FindProcess(pid)
+	return err == nil && process.Kill() == nil
+}
+
+// processStarted is not known on this platform, which leaves the processes of sessions
+// untracked
+func processStarted(pid int) (string, bool) {
+	return "", false
+}
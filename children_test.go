@@ -0,0 +1,139 @@
+//go:build unix
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRunChildStopsProcessGroup(t *testing.T) {
+	// the background sleep keeps stdout open, it must be stopped with the shell for the
+	// command to finish before childStopTimeout
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := exec.CommandContext(ctx, "sh", "-c", "sleep 30 & wait")
+	cmd.Stdout = &bytes.Buffer{}
+	terminateGracefully(cmd)
+	done := make(chan error, 1)
+	go func() { done <- runChild(cmd) }()
+	time.Sleep(100 * time.Millisecond)
+	start := time.Now()
+	cancel()
+	select {
+	case <-done:
+		if elapsed := time.Since(start); elapsed > childStopTimeout/2 {
+			t.Errorf("runChild failed: expected the process group to stop on SIGTERM, took %s", elapsed)
+		}
+	case <-time.After(2 * childStopTimeout):
+		t.Fatal("runChild failed: the command did not finish")
+	}
+}
+
+func TestKillChildren(t *testing.T) {
+	cmd := exec.CommandContext(context.Background(), "sh", "-c", "sleep 30 & wait")
+	cmd.Stdout = &bytes.Buffer{}
+	terminateGracefully(cmd)
+	done := make(chan error, 1)
+	go func() { done <- runChild(cmd) }()
+	time.Sleep(100 * time.Millisecond)
+	if killed := killChildren(); killed != 1 {
+		t.Errorf("killChildren failed: expected 1 process group, got %d", killed)
+	}
+	select {
+	case <-done:
+	case <-time.After(childStopTimeout / 2):
+		t.Fatal("killChildren failed: the command is still running")
+	}
+}
+
+func TestSupervisorWaitStopped(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	registry := newStatusRegistry()
+	registry.register("cashfree", kindWorkload, 8080, "http")
+	s := newSupervisor(ctx, registry, false)
+	stuck := make(chan struct{})
+	defer close(stuck)
+	s.supervise("cashfree", func(ctx context.Context) error {
+		<-stuck
+		return nil
+	})
+	cancel()
+	if s.waitStopped(100 * time.Millisecond) {
+		t.Error("waitStopped failed: expected a stuck tunnel to time out")
+	}
+}
+
+func TestCleanStaleSessions(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	start := func() *exec.Cmd {
+		cmd := exec.CommandContext(context.Background(), "sleep", "30")
+		terminateGracefully(cmd)
+		if err := cmd.Start(); err != nil {
+			t.Fatalf("Error starting sleep: %v", err)
+		}
+		t.Cleanup(func() { cmd.Process.Kill() })
+		return cmd
+	}
+	orphan, other := start(), start()
+	started, ok := processStarted(orphan.Process.Pid)
+	if !ok {
+		t.Skip("ps is not available")
+	}
+	crashed := exec.Command("true")
+	crashed.Run()
+
+	state := childState{Environment: "staging", PID: crashed.Process.Pid, Started: "Thu Jan  1 00:00:00 1970", Children: []childProcess{
+		{PID: orphan.Process.Pid, Started: started, Command: "kubectl port-forward"},
+		// a process that reused the pid of a child is left alone
+		{PID: other.Process.Pid, Started: "Thu Jan  1 00:00:00 1970", Command: "ssh"},
+	}}
+	file, _ := childStateFile(crashed.Process.Pid)
+	os.MkdirAll(filepath.Dir(file), 0o700)
+	data, _ := json.Marshal(state)
+	os.WriteFile(file, data, 0o600)
+
+	stale := cleanStaleSessions()
+	if len(stale) != 1 || stale[0].PID != orphan.Process.Pid {
+		t.Errorf("cleanStaleSessions failed: expected only the orphaned child to be stale, got %+v", stale)
+	}
+	done := make(chan error, 1)
+	go func() { done <- orphan.Wait() }()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Error("cleanStaleSessions failed: expected the orphaned child to be killed")
+	}
+	if _, ok := processStarted(other.Process.Pid); !ok {
+		t.Error("cleanStaleSessions failed: expected the process with another start time to keep running")
+	}
+	other.Process.Kill()
+	other.Wait()
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("cleanStaleSessions failed: expected the state file to be removed, got %v", err)
+	}
+
+	// the state of a running session is kept
+	trackChildren("staging")
+	defer untrackChildren()
+	cleanStaleSessions()
+	file, _ = childStateFile(os.Getpid())
+	if _, err := os.Stat(file); err != nil {
+		t.Error("cleanStaleSessions failed: expected the state file of the running session to be kept")
+	}
+}
+
+func TestChildWithoutTerminal(t *testing.T) {
+	// reading the terminal fails right away instead of stopping the child in the background
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := runHook(ctx, hookPreStart, Hook{Command: "read line < /dev/tty"}, nil)
+	if ctx.Err() != nil || errorClass(err) != ClassNoTerminal {
+		t.Errorf("runHook failed: expected a failure without a terminal, got %v", err)
+	}
+}
@@ -0,0 +1,43 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// setProcessGroup runs the command in a session of its own, led by the command, so that its
+// children are signaled along with it. The session has no controlling terminal: a child
+// reading /dev/tty, like ssh asking for a passphrase, fails right away instead of hanging
+// stopped by SIGTTIN in a background process group.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
+
+// terminateProcessGroup sends SIGTERM to the process group of the command
+func terminateProcessGroup(cmd *exec.Cmd) error {
+	err := syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+	if errors.Is(err, syscall.ESRCH) {
+		return os.ErrProcessDone
+	}
+	return err
+}
+
+// killProcessGroup sends SIGKILL to the process group led by pid, false when there is no
+// such group
+func killProcessGroup(pid int) bool {
+	return syscall.Kill(-pid, syscall.SIGKILL) == nil
+}
+
+// processStarted returns when the process started as ps prints it, false when it is not
+// running
+func processStarted(pid int) (string, bool) {
+	out, err := exec.Command("ps", "-o", "lstart=", "-p", strconv.Itoa(pid)).Output()
+	started := strings.TrimSpace(string(out))
+	return started, err == nil && started != ""
+}
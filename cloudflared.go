@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+)
+
+const (
+	// bastionIAP reaches the bastion with gcloud compute ssh, through IAP
+	bastionIAP = "iap"
+	// bastionCloudflared forwards every connection with cloudflared access tcp, to the
+	// Cloudflare Access application of its hostname
+	bastionCloudflared = "cloudflared"
+)
+
+func (b Bastion) kind() string {
+	if b.Type == "" {
+		return bastionIAP
+	}
+	return b.Type
+}
+
+// usesIAPBastion reports whether the session reaches the bastion with gcloud compute ssh,
+// which needs its zone, gcloud and ssh
+func usesIAPBastion(config ProxyConfig) bool {
+	return usesBastion(config) && config.Bastion.kind() == bastionIAP
+}
+
+// usesCloudflared reports whether the session forwards connections with cloudflared
+func usesCloudflared(config ProxyConfig) bool {
+	return usesBastion(config) && config.Bastion.kind() == bastionCloudflared
+}
+
+// validateBastionType checks that a cloudflared bastion has the hostname of every
+// connection, and that only cloudflared bastions have hostnames
+func validateBastionType(config ProxyConfig) error {
+	var errs []error
+	switch config.Bastion.kind() {
+	case bastionIAP:
+		for _, connection := range config.Bastion.Connections {
+			if connection.Hostname != "" {
+				errs = append(errs, fmt.Errorf("connection %s: hostname needs a bastion of type %s", connection.Name(), bastionCloudflared))
+			}
+		}
+	case bastionCloudflared:
+		for _, connection := range config.Bastion.Connections {
+			if connection.Hostname == "" {
+				errs = append(errs, fmt.Errorf("connection %s: the hostname of its Cloudflare Access application is not set", connection.Name()))
+			}
+			if connection.Project != "" {
+				errs = append(errs, fmt.Errorf("connection %s: project does not apply to a bastion of type %s", connection.Name(), bastionCloudflared))
+			}
+		}
+		if config.APIProxy.enabled() && config.APIProxy.mode() == apiProxyBastion {
+			errs = append(errs, fmt.Errorf("api_proxy: mode %s does not support a bastion of type %s", apiProxyBastion, bastionCloudflared))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("bastion: unknown type %s, expected %s or %s", config.Bastion.Type, bastionIAP, bastionCloudflared))
+	}
+	return errors.Join(errs...)
+}
+
+// cloudflaredArgs returns the cloudflared arguments serving the connection's Cloudflare
+// Access application on its local port
+func cloudflaredArgs(connection Connection) []string {
+	return []string{"access", "tcp", "--hostname", connection.Hostname, "--url", fmt.Sprintf("%s:%d", connection.host(), connection.LocalPort)}
+}
+
+// checkCloudflared checks that cloudflared is installed
+func checkCloudflared(ctx context.Context) bool {
+	ctx, cancel := context.WithTimeout(ctx, localCommandTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "cloudflared", "--version")
+	started := commandStarted(cmd)
+	err := cmd.Run()
+	commandFinished(cmd, started, err)
+	return err == nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestConnectBastionCloudflared(t *testing.T) {
+	bastion := Bastion{Type: bastionCloudflared}
+	connection := Connection{LocalPort: 5435, RemoteHost: "10.120.52.48", RemotePort: 5432, Hostname: "postgres-staging.okcredit.in"}
+	cmd := connectBastion(context.Background(), bastion, connection)
+	expected := "cloudflared access tcp --hostname postgres-staging.okcredit.in --url localhost:5435"
+	if strings.Join(cmd.Args, " ") != expected {
+		t.Errorf("connectBastion failed: expected %q, got %q", expected, strings.Join(cmd.Args, " "))
+	}
+	if name := (Connection{Hostname: "redis-staging.okcredit.in"}).Name(); name != "redis-staging.okcredit.in" {
+		t.Errorf("Name failed: expected the hostname without remote host, got %s", name)
+	}
+}
+
+func TestValidateBastionType(t *testing.T) {
+	connection := Connection{LocalPort: 5435, Hostname: "postgres-staging.okcredit.in"}
+	config := ProxyConfig{Bastion: Bastion{Type: bastionCloudflared, Connections: []Connection{connection}}}
+	if err := validateBastionType(config); err != nil {
+		t.Errorf("validateBastionType failed: %v", err)
+	}
+	if !usesCloudflared(config) || usesIAPBastion(config) {
+		t.Errorf("usesCloudflared failed: expected the session to use cloudflared only")
+	}
+
+	config.Bastion.Connections = append(config.Bastion.Connections, Connection{LocalPort: 6379, RemoteHost: "10.120.52.50", RemotePort: 6379})
+	config.APIProxy = APIProxy{LocalPort: 8443, Mode: apiProxyBastion}
+	err := validateBastionType(config)
+	if err == nil || !strings.Contains(err.Error(), "10.120.52.50:6379: the hostname") || !strings.Contains(err.Error(), "api_proxy") {
+		t.Errorf("validateBastionType failed: expected the missing hostname and the API server proxy, got %v", err)
+	}
+
+	config = ProxyConfig{Bastion: Bastion{Name: "bastion", Connections: []Connection{connection}}}
+	if err := validateBastionType(config); err == nil || !strings.Contains(err.Error(), "hostname needs a bastion of type cloudflared") {
+		t.Errorf("validateBastionType failed: expected the hostname of an iap bastion, got %v", err)
+	}
+	config.Bastion.Type = "teleport"
+	if err := validateBastionType(config); err == nil || !strings.Contains(err.Error(), "unknown type teleport") {
+		t.Errorf("validateBastionType failed: expected the unknown type, got %v", err)
+	}
+}
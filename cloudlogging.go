@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/user"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// loggingURL is the Cloud Logging API the output of sessions is written with
+var loggingURL = "https://logging.googleapis.com/v2"
+
+const (
+	// logShipInterval is how often the buffered lines are written to Cloud Logging
+	logShipInterval = 5 * time.Second
+	// logBatchSize is the most lines written at once
+	logBatchSize = 500
+	// logBuffer is how many lines wait to be written before new ones are dropped
+	logBuffer = 5000
+	// logTokenLifetime is how long an access token is reused, well below its expiry
+	logTokenLifetime = 30 * time.Minute
+	defaultLogName   = "devcli"
+)
+
+// CloudLogging ships the output of sessions to a Cloud Logging project of the platform
+// team, so that they can debug the tunnel issues of remote users without sharing screens.
+// Sensitive values are redacted from every line first.
+type CloudLogging struct {
+	// Project is the project the logs are written to
+	Project string `yaml:"project"`
+	// LogName is the name of the log, devcli when empty
+	LogName string `yaml:"log_name"`
+	// Environments are the environments whose sessions are shipped, every one when empty
+	Environments []string `yaml:"environments"`
+}
+
+// enabled reports whether the sessions of the environment are shipped
+func (c CloudLogging) enabled(environment string) bool {
+	return c.Project != "" && (len(c.Environments) == 0 || slices.Contains(c.Environments, environment))
+}
+
+func (c CloudLogging) logName() string {
+	if c.LogName == "" {
+		return defaultLogName
+	}
+	return c.LogName
+}
+
+// validate checks the log name, which Cloud Logging restricts to URL-safe characters
+func (c CloudLogging) validate() error {
+	if !regexp.MustCompile(`^[A-Za-z0-9_./-]+$`).MatchString(c.logName()) {
+		return fmt.Errorf("cloud_logging log_name %q may only contain letters, digits, _, -, . and /", c.LogName)
+	}
+	return nil
+}
+
+// redactions replace the sensitive values that may show up in the output of a session:
+// access tokens, passwords in URLs and the values of password, secret, token and key
+// settings
+var redactions = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----.*`), "[REDACTED PRIVATE KEY]"},
+	{regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/=-]+`), "${1}[REDACTED]"},
+	{regexp.MustCompile(`ya29\.[A-Za-z0-9._-]+`), "[REDACTED]"},
+	{regexp.MustCompile(`(://[^:/\s@]+:)[^@\s]+@`), "${1}[REDACTED]@"},
+	{regexp.MustCompile(`(?i)\b((?:password|passwd|pwd|secret|client_secret|token|access_token|refresh_token|api_key|apikey)["']?\s*[:=]\s*["']?)[^\s"'&,;]+`), "${1}[REDACTED]"},
+}
+
+// privateKeyLines is how many lines after its BEGIN line the body of a private key is
+// dropped for at most, when its END line never comes
+const privateKeyLines = 100
+
+var (
+	privateKeyBegin = regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`)
+	privateKeyEnd   = regexp.MustCompile(`-----END [A-Z ]*PRIVATE KEY-----`)
+)
+
+// keyRedactor drops the lines of the private keys spanning several lines of output, whose
+// base64 body follows the BEGIN line the redactions see
+type keyRedactor struct {
+	// remaining is how many more lines of a key are dropped, 0 outside of a key
+	remaining int
+}
+
+// line returns the line, empty when it is part of the body of a private key
+func (r *keyRedactor) line(line string) string {
+	if r.remaining > 0 {
+		r.remaining--
+		if privateKeyEnd.MatchString(line) {
+			r.remaining = 0
+		}
+		return ""
+	}
+	if privateKeyBegin.MatchString(line) && !privateKeyEnd.MatchString(line) {
+		r.remaining = privateKeyLines
+	}
+	return line
+}
+
+// redactLine removes the sensitive values from a line of output
+func redactLine(line string) string {
+	for _, r := range redactions {
+		line = r.pattern.ReplaceAllString(line, r.replacement)
+	}
+	return line
+}
+
+// logLine is a line of output waiting to be shipped
+type logLine struct {
+	time time.Time
+	line string
+}
+
+// logShipper ships the lines written to it to Cloud Logging in batches, in the background
+// so that the session never waits for the API. Lines it cannot keep up with are dropped.
+type logShipper struct {
+	config      CloudLogging
+	environment string
+	labels      map[string]string
+	token       func(ctx context.Context) (string, error)
+	lines       chan logLine
+	done        chan struct{}
+	// cached is the access token reused until cachedUntil, only run uses it
+	cached      string
+	cachedUntil time.Time
+
+	mu      sync.Mutex
+	partial string
+	keys    keyRedactor
+	dropped bool
+	stopped bool
+}
+
+// newLogShipper returns the shipper of the environment's session, labeling its lines with
+// the environment, user and host
+func newLogShipper(config CloudLogging, environment string, token func(ctx context.Context) (string, error)) *logShipper {
+	labels := map[string]string{"environment": environment}
+	if current, err := user.Current(); err == nil {
+		labels["user"] = current.Username
+	}
+	if host, err := os.Hostname(); err == nil {
+		labels["host"] = host
+	}
+	return &logShipper{
+		config:      config,
+		environment: environment,
+		labels:      labels,
+		token:       token,
+		lines:       make(chan logLine, logBuffer),
+		done:        make(chan struct{}),
+	}
+}
+
+// Write queues every complete line of p, it never blocks
+func (s *logShipper) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return len(p), nil
+	}
+	lines := strings.Split(s.partial+string(p), "\n")
+	s.partial = lines[len(lines)-1]
+	now := time.Now()
+	for _, line := range lines[:len(lines)-1] {
+		line = s.keys.line(sanitizeLine(line))
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		select {
+		case s.lines <- logLine{time: now, line: line}:
+		default:
+			s.dropped = true
+		}
+	}
+	return len(p), nil
+}
+
+// run ships the queued lines every logShipInterval until stop is called
+func (s *logShipper) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(logShipInterval)
+	defer ticker.Stop()
+	var batch []logLine
+	failing := false
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), reportTimeout)
+		err := s.ship(ctx, batch)
+		cancel()
+		// a failure is only warned about once until shipping works again, the warning is
+		// itself shipped
+		if err != nil && !failing {
+			fmt.Printf("Warning: shipping the logs to Cloud Logging project %s failed: %v\n", s.config.Project, err)
+		}
+		failing = err != nil
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case line, ok := <-s.lines:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, line)
+			if len(batch) >= logBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// stop ships the lines left, waiting at most reportTimeout
+func (s *logShipper) stop() {
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return
+	}
+	s.stopped = true
+	if s.dropped {
+		fmt.Println("Warning: some lines of output were not shipped to Cloud Logging, it did not keep up.")
+	}
+	close(s.lines)
+	s.mu.Unlock()
+	select {
+	case <-s.done:
+	case <-time.After(reportTimeout):
+	}
+}
+
+// accessToken returns the token the API is called with, reusing it for logTokenLifetime
+// rather than asking gcloud for one with every batch
+func (s *logShipper) accessToken(ctx context.Context) (string, error) {
+	if s.cached != "" && time.Now().Before(s.cachedUntil) {
+		return s.cached, nil
+	}
+	token, err := s.token(ctx)
+	if err != nil {
+		return "", err
+	}
+	s.cached, s.cachedUntil = token, time.Now().Add(logTokenLifetime)
+	return token, nil
+}
+
+// logEntry is an entry of the entries:write request
+type logEntry struct {
+	Timestamp   time.Time         `json:"timestamp"`
+	Severity    string            `json:"severity"`
+	JSONPayload map[string]string `json:"jsonPayload"`
+}
+
+// logEntryOf returns the structured entry of a line of output: its severity from the Error
+// and Warning prefixes of devcli's messages, and the tunnel or tool of the [name] prefix of
+// the output of child processes
+func logEntryOf(line logLine) logEntry {
+	message := redactLine(line.line)
+	payload := map[string]string{}
+	if strings.HasPrefix(message, "[") {
+		if end := strings.Index(message, "] "); end > 0 {
+			payload["source"] = message[1:end]
+			message = message[end+2:]
+		}
+	}
+	payload["message"] = message
+	severity := "INFO"
+	switch {
+	case strings.HasPrefix(message, "Error"):
+		severity = "ERROR"
+	case strings.HasPrefix(message, "Warning"):
+		severity = "WARNING"
+	}
+	return logEntry{Timestamp: line.time.UTC(), Severity: severity, JSONPayload: payload}
+}
+
+// ship writes the lines to Cloud Logging
+func (s *logShipper) ship(ctx context.Context, lines []logLine) error {
+	token, err := s.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+	entries := make([]logEntry, 0, len(lines))
+	for _, line := range lines {
+		entries = append(entries, logEntryOf(line))
+	}
+	body := map[string]interface{}{
+		"logName":  fmt.Sprintf("projects/%s/logs/%s", s.config.Project, strings.ReplaceAll(s.config.logName(), "/", "%2F")),
+		"resource": map[string]string{"type": "global"},
+		"labels":   s.labels,
+		"entries":  entries,
+	}
+	return postJSON(ctx, loggingURL+"/entries:write", token, body, nil)
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// gkeCluster identifies a GKE cluster the workloads are forwarded from
+type gkeCluster struct {
+	Project  string
+	Location string
+	Name     string
+	// Gateway is the location of the cluster's fleet membership when kubectl reaches it
+	// through the Connect Gateway, empty otherwise
+	Gateway string
+	// Context is the existing kubeconfig context of the cluster set with kube_context, used
+	// instead of the one get-credentials creates
+	Context string
+}
+
+// ConnectGateway fetches the credentials of the environment's clusters from the fleet's
+// Connect Gateway, so that kubectl reaches private control planes without a bastion. The
+// memberships are expected to be named after the clusters.
+type ConnectGateway struct {
+	Enabled bool `yaml:"enabled"`
+	// Location of the fleet memberships, global by default
+	Location string `yaml:"location"`
+}
+
+// through returns the cluster reached through the gateway
+func (g ConnectGateway) through(cluster gkeCluster) gkeCluster {
+	cluster.Gateway = g.Location
+	if cluster.Gateway == "" {
+		cluster.Gateway = "global"
+	}
+	return cluster
+}
+
+// zonal reports whether the cluster is located in a zone, such as asia-south1-a, rather
+// than in a region, such as asia-south1
+func (c gkeCluster) zonal() bool {
+	return zonePattern.MatchString(c.Location)
+}
+
+// zonePattern matches zone names, which are region names with a zone letter suffix
+var zonePattern = regexp.MustCompile(`^[a-z]+-[a-z]+[0-9]+-[a-z]$`)
+
+// locationFlag is the gcloud flag selecting the location of the cluster
+func (c gkeCluster) locationFlag() string {
+	if c.zonal() {
+		return "--zone"
+	}
+	return "--region"
+}
+
+// parseClusterList parses the name and location lines of gcloud container clusters list
+func parseClusterList(project string, out []byte) ([]gkeCluster, error) {
+	var clusters []gkeCluster
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("unexpected cluster list line %q", line)
+		}
+		clusters = append(clusters, gkeCluster{Project: project, Name: fields[0], Location: fields[1]})
+	}
+	return clusters, nil
+}
+
+// kubeContext is the name of the kubeconfig context that gcloud get-credentials creates
+func (c gkeCluster) kubeContext() string {
+	if c.Context != "" {
+		return c.Context
+	}
+	if c.Gateway != "" {
+		return fmt.Sprintf("connectgateway_%s_%s_%s", c.Project, c.Gateway, c.Name)
+	}
+	return fmt.Sprintf("gke_%s_%s_%s", c.Project, c.Location, c.Name)
+}
+
+// clusterRef is the cluster a workload is forwarded from as configured: a project and a
+// cluster name, empty for the first cluster of the project
+type clusterRef struct {
+	project string
+	name    string
+}
+
+func (r clusterRef) String() string {
+	if r.name == "" {
+		return "the cluster of project " + r.project
+	}
+	return fmt.Sprintf("cluster %s of project %s", r.name, r.project)
+}
+
+// workloadCluster returns the cluster of the workload, in the environment's project unless
+// the workload overrides it
+func workloadCluster(config ProxyConfig, workload Workload) clusterRef {
+	project := workload.Project
+	if project == "" {
+		project = config.CloudProject
+	}
+	return clusterRef{project: project, name: workload.Cluster}
+}
+
+// referencedClusters returns the clusters of the workloads other than the environment's
+// default cluster, which is discovered separately
+func referencedClusters(config ProxyConfig) []clusterRef {
+	var refs []clusterRef
+	for _, workload := range config.Workloads {
+		ref := workloadCluster(config, workload)
+		if ref != (clusterRef{project: config.CloudProject}) && !slices.Contains(refs, ref) {
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+// findCluster returns the location of the cluster, or the first cluster of the project
+// when the reference has no name
+func findCluster(ctx context.Context, runner *commandRunner, ref clusterRef) (gkeCluster, error) {
+	narrate("Getting the location of", ref)
+	args := []string{"container", "clusters", "list", "--project", ref.project, "--format", "value(name,location)"}
+	if ref.name != "" {
+		args = append(args, "--filter", "name="+ref.name)
+	}
+	cmd := exec.CommandContext(ctx, "gcloud", args...)
+	cmd.Stderr = logger.Writer("gcloud")
+	out, err := runner.output(ctx, cmd)
+	if err != nil {
+		return gkeCluster{}, fmt.Errorf("getting the location of %s: %w", ref, err)
+	}
+	clusters, err := parseClusterList(ref.project, out)
+	if err != nil {
+		return gkeCluster{}, err
+	}
+	if len(clusters) == 0 {
+		return gkeCluster{}, fmt.Errorf("%s not found", ref)
+	}
+	// a name may be used by clusters in several locations of the project
+	if len(clusters) > 1 && ref.name != "" {
+		return gkeCluster{}, fmt.Errorf("%s is ambiguous, it exists in %d locations", ref, len(clusters))
+	}
+	return clusters[0], nil
+}
+
+// fetchClusterCredentials writes the credentials of the cluster to the kubeconfig, as the
+// context named after the cluster
+func fetchClusterCredentials(ctx context.Context, runner *commandRunner, cluster gkeCluster) error {
+	narratef("Getting the credentials for cluster %s of project %s\n", cluster.Name, cluster.Project)
+	cmd := exec.CommandContext(ctx, "gcloud", credentialsArgs(cluster)...)
+	cmd.Stderr = narrationWriter("gcloud")
+	cmd.Stdout = narrationWriter("gcloud")
+	if err := runner.run(ctx, cmd); err != nil {
+		return fmt.Errorf("getting credentials of cluster %s: %w", cluster.Name, err)
+	}
+	return nil
+}
+
+// credentialsArgs are the gcloud arguments writing the credentials of the cluster, with the
+// location flag of its type, or of its fleet membership through the Connect Gateway
+func credentialsArgs(cluster gkeCluster) []string {
+	if cluster.Gateway != "" {
+		return []string{"container", "fleet", "memberships", "get-credentials", cluster.Name, "--project", cluster.Project, "--location", cluster.Gateway}
+	}
+	return []string{"container", "clusters", "get-credentials", cluster.Name, "--project", cluster.Project, cluster.locationFlag(), cluster.Location}
+}
+
+// validateKubeContext checks that an environment using an existing kubeconfig context does
+// not need the GKE clusters devcli would otherwise look up
+func validateKubeContext(config ProxyConfig) error {
+	if config.KubeContext == "" {
+		return nil
+	}
+	if config.ConnectGateway.Enabled {
+		return fmt.Errorf("kube_context %s cannot be used with the connect_gateway", config.KubeContext)
+	}
+	if config.APIProxy.enabled() && config.APIProxy.mode() == apiProxyBastion {
+		return fmt.Errorf("kube_context %s cannot be used with api_proxy mode bastion, use mode kubectl", config.KubeContext)
+	}
+	for _, workload := range config.Workloads {
+		if workload.Project != "" || workload.Cluster != "" {
+			return fmt.Errorf("workload %s sets a project or cluster, but every workload uses kube_context %s", workload.Name(), config.KubeContext)
+		}
+	}
+	return nil
+}
+
+// kubeContextCluster is the cluster of an environment using an existing kubeconfig context,
+// which is neither looked up nor given credentials
+func kubeContextCluster(config ProxyConfig) gkeCluster {
+	return gkeCluster{Project: config.CloudProject, Name: config.KubeContext, Context: config.KubeContext}
+}
+
+// checkKubeContext checks that the kubeconfig has the context
+func checkKubeContext(ctx context.Context, runner *commandRunner, name string) error {
+	narrate("Using the existing kubeconfig context:", name)
+	cmd := exec.CommandContext(ctx, "kubectl", "config", "get-contexts", name, "-o", "name")
+	cmd.Stderr = narrationWriter("kubectl")
+	if _, err := runner.output(ctx, cmd); err != nil {
+		return fmt.Errorf("kube_context %s is not a context of the kubeconfig: %w", name, err)
+	}
+	return nil
+}
+
+// connectionProjects returns the projects set on connections that differ from the
+// environment's project
+func connectionProjects(config ProxyConfig) []string {
+	var projects []string
+	for _, connection := range config.Bastion.Connections {
+		if project := connection.Project; project != "" && project != config.CloudProject && !slices.Contains(projects, project) {
+			projects = append(projects, project)
+		}
+	}
+	return projects
+}
+
+// findClusters returns the location of each cluster, looked up concurrently with find
+func findClusters(refs []clusterRef, find func(clusterRef) (gkeCluster, error)) (map[clusterRef]gkeCluster, error) {
+	var mu sync.Mutex
+	clusters := make(map[clusterRef]gkeCluster)
+	var lookups []func() error
+	for _, ref := range refs {
+		lookups = append(lookups, func() error {
+			cluster, err := find(ref)
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			clusters[ref] = cluster
+			return nil
+		})
+	}
+	return clusters, runParallel(lookups...)
+}
+
+// lookupBastionZones returns the zone of the bastion instance in each project, looked up
+// concurrently with lookup
+func lookupBastionZones(projects []string, lookup func(project string) (string, error)) (map[string]string, error) {
+	var mu sync.Mutex
+	zones := make(map[string]string)
+	var lookups []func() error
+	for _, project := range projects {
+		lookups = append(lookups, func() error {
+			zone, err := lookup(project)
+			if err != nil {
+				return fmt.Errorf("project %s: %w", project, err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			zones[project] = zone
+			return nil
+		})
+	}
+	return zones, runParallel(lookups...)
+}
+
+// kubectlCommand returns a kubectl command run against the workload's cluster
+func kubectlCommand(ctx context.Context, workload Workload, args ...string) *exec.Cmd {
+	if workload.kubeContext != "" {
+		args = append([]string{"--context", workload.kubeContext}, args...)
+	}
+	return exec.CommandContext(ctx, "kubectl", args...)
+}
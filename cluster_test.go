@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConnectionProjects(t *testing.T) {
+	config := ProxyConfig{
+		CloudProject: "okcredit-staging-env",
+		Bastion: Bastion{Connections: []Connection{
+			{RemoteHost: "10.120.52.48", Project: "okcredit-data"},
+			{RemoteHost: "10.120.52.49", Project: "okcredit-data"},
+			{RemoteHost: "10.120.52.50"},
+		}},
+	}
+	if projects := connectionProjects(config); !reflect.DeepEqual(projects, []string{"okcredit-data"}) {
+		t.Errorf("connectionProjects failed: expected [okcredit-data], got %v", projects)
+	}
+}
+
+func TestReferencedClusters(t *testing.T) {
+	config := ProxyConfig{
+		CloudProject: "okcredit-staging-env",
+		Workloads: []Workload{
+			{App: "cashfree"},
+			{App: "payments", Project: "okcredit-staging-env"},
+			{App: "ledger", Project: "okcredit-shared"},
+			{App: "search", Project: "okcredit-shared"},
+			{App: "airflow", Cluster: "data"},
+			{App: "spark", Cluster: "data"},
+		},
+	}
+	expected := []clusterRef{
+		{project: "okcredit-shared"},
+		{project: "okcredit-staging-env", name: "data"},
+	}
+	if refs := referencedClusters(config); !reflect.DeepEqual(refs, expected) {
+		t.Errorf("referencedClusters failed: expected %v, got %v", expected, refs)
+	}
+	if ref := workloadCluster(config, config.Workloads[4]); ref != (clusterRef{project: "okcredit-staging-env", name: "data"}) {
+		t.Errorf("workloadCluster failed: unexpected cluster %v", ref)
+	}
+}
+
+func TestKubectlCommand(t *testing.T) {
+	cluster := gkeCluster{Project: "okcredit-shared", Location: "asia-south1", Name: "services"}
+	workload := Workload{App: "ledger", kubeContext: cluster.kubeContext()}
+	cmd := kubectlCommand(context.Background(), workload, "get", "pods")
+	expected := "kubectl --context gke_okcredit-shared_asia-south1_services get pods"
+	if strings.Join(cmd.Args, " ") != expected {
+		t.Errorf("kubectlCommand failed: expected %q, got %q", expected, strings.Join(cmd.Args, " "))
+	}
+	if cmd := kubectlCommand(context.Background(), Workload{App: "cashfree"}, "get", "pods"); strings.Join(cmd.Args, " ") != "kubectl get pods" {
+		t.Errorf("kubectlCommand failed: unexpected command %q without a context", strings.Join(cmd.Args, " "))
+	}
+}
+
+func TestConnectBastionProject(t *testing.T) {
+	bastion := Bastion{Name: "bastion", Zone: "asia-south1-a"}
+	connection := Connection{LocalPort: 5434, RemoteHost: "10.116.48.59", RemotePort: 5432, Project: "okcredit-data"}
+	cmd := connectBastion(context.Background(), bastion, connection)
+	expected := "gcloud compute ssh bastion --zone asia-south1-a --project okcredit-data -- -L localhost:5434:10.116.48.59:5432 -N"
+	if strings.Join(cmd.Args, " ") != expected {
+		t.Errorf("connectBastion failed: expected %q, got %q", expected, strings.Join(cmd.Args, " "))
+	}
+}
+
+func TestParseClusterList(t *testing.T) {
+	out := []byte("services\tasia-south1\ndata\tasia-south1-a\n\n")
+	clusters, err := parseClusterList("okcredit-staging-env", out)
+	if err != nil {
+		t.Fatalf("parseClusterList failed: %v", err)
+	}
+	expected := []gkeCluster{
+		{Project: "okcredit-staging-env", Name: "services", Location: "asia-south1"},
+		{Project: "okcredit-staging-env", Name: "data", Location: "asia-south1-a"},
+	}
+	if !reflect.DeepEqual(clusters, expected) {
+		t.Errorf("parseClusterList failed: expected %v, got %v", expected, clusters)
+	}
+	if _, err := parseClusterList("okcredit-staging-env", []byte("services\n")); err == nil {
+		t.Error("parseClusterList failed: expected an error for a line without a location")
+	}
+}
+
+func TestCredentialsArgs(t *testing.T) {
+	tests := []struct {
+		cluster  gkeCluster
+		expected string
+	}{
+		{gkeCluster{Project: "p", Name: "services", Location: "asia-south1"}, "container clusters get-credentials services --project p --region asia-south1"},
+		{gkeCluster{Project: "p", Name: "data", Location: "asia-south1-a"}, "container clusters get-credentials data --project p --zone asia-south1-a"},
+		{gkeCluster{Project: "p", Name: "eu", Location: "europe-west4-c"}, "container clusters get-credentials eu --project p --zone europe-west4-c"},
+	}
+	for _, test := range tests {
+		if args := strings.Join(credentialsArgs(test.cluster), " "); args != test.expected {
+			t.Errorf("credentialsArgs failed: expected %q, got %q", test.expected, args)
+		}
+	}
+}
+
+func TestConnectGateway(t *testing.T) {
+	cluster := ConnectGateway{Enabled: true}.through(gkeCluster{Project: "p", Name: "services", Location: "asia-south1"})
+	if context := cluster.kubeContext(); context != "connectgateway_p_global_services" {
+		t.Errorf("kubeContext failed: unexpected gateway context %q", context)
+	}
+	expected := "container fleet memberships get-credentials services --project p --location global"
+	if args := strings.Join(credentialsArgs(cluster), " "); args != expected {
+		t.Errorf("credentialsArgs failed: expected %q, got %q", expected, args)
+	}
+	cluster = ConnectGateway{Enabled: true, Location: "asia-south1"}.through(cluster)
+	if context := cluster.kubeContext(); context != "connectgateway_p_asia-south1_services" {
+		t.Errorf("kubeContext failed: unexpected regional gateway context %q", context)
+	}
+}
+
+func TestKubeContext(t *testing.T) {
+	config := ProxyConfig{CloudProject: "p", KubeContext: "minikube", Workloads: []Workload{{App: "cashfree"}}}
+	if err := validateKubeContext(config); err != nil {
+		t.Fatalf("validateKubeContext failed: %v", err)
+	}
+	if context := kubeContextCluster(config).kubeContext(); context != "minikube" {
+		t.Errorf("kubeContext failed: expected the existing context, got %q", context)
+	}
+	for _, invalid := range []ProxyConfig{
+		{KubeContext: "minikube", Workloads: []Workload{{App: "cashfree", Cluster: "services"}}},
+		{KubeContext: "minikube", ConnectGateway: ConnectGateway{Enabled: true}},
+		{KubeContext: "minikube", APIProxy: APIProxy{LocalPort: 8001, Mode: apiProxyBastion}},
+	} {
+		if err := validateKubeContext(invalid); err == nil {
+			t.Errorf("validateKubeContext(%+v) failed: expected an error", invalid)
+		}
+	}
+}
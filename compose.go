@@ -0,0 +1,204 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// composeHost reaches the tunnels that devcli serves on the host
+	composeHost = "host"
+	// composeProxy adds a devcli service to the stack that serves the tunnels
+	composeProxy = "proxy"
+)
+
+// composeProxyService is the name of the devcli service added in proxy mode
+const composeProxyService = "devcli"
+
+// composeOverride is the docker compose override file generated by devcli compose
+type composeOverride struct {
+	Services map[string]composeService `yaml:"services"`
+}
+
+type composeService struct {
+	Image       string            `yaml:"image,omitempty"`
+	Command     []string          `yaml:"command,omitempty"`
+	Volumes     []string          `yaml:"volumes,omitempty"`
+	ExtraHosts  []string          `yaml:"extra_hosts,omitempty"`
+	DependsOn   []string          `yaml:"depends_on,omitempty"`
+	Environment map[string]string `yaml:"environment,omitempty"`
+}
+
+// runCompose implements `devcli compose`: it writes a compose override file giving the
+// services of a local compose stack the address of every tunnel in environment variables
+func runCompose(args []string) {
+	var confFile, environment, composeFile, out, mode, image string
+	var services stringList
+	fs := flag.NewFlagSet("devcli compose", flag.ExitOnError)
+	fs.StringVar(&confFile, "conf", "", "Path to the configuration file")
+	fs.StringVar(&environment, "env", "", "Environment type (dev, staging, prod)")
+	fs.StringVar(&composeFile, "file", "docker-compose.yml", "Compose file whose services get the tunnel addresses")
+	fs.Var(&services, "service", "Service that gets the tunnel addresses, repeatable (default: every service of -file)")
+	fs.StringVar(&out, "out", "docker-compose.override.yml", "Override file to write, - for stdout")
+	fs.StringVar(&mode, "mode", composeHost, "host: reach the tunnels of devcli running on the host; proxy: add a devcli service to the stack")
+	fs.StringVar(&image, "docker-image", "devcli", "Image of the devcli service in proxy mode, built from the Dockerfile")
+	fs.Parse(args)
+
+	confPath, err := configPath(confFile)
+	if err != nil {
+		fmt.Println("Error getting user home directory:", err)
+		os.Exit(1)
+	}
+	config, err := readConfig(confPath)
+	if err != nil {
+		fmt.Println("Error reading configuration file:", err)
+		os.Exit(1)
+	}
+	if environment != "" {
+		config.Environment = environment
+	}
+	if len(services) == 0 {
+		services, err = composeServices(composeFile)
+		if err != nil {
+			fmt.Println("Error reading the compose file, pass the services with -service:", err)
+			os.Exit(1)
+		}
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		fmt.Println("Error getting user home directory:", err)
+		os.Exit(1)
+	}
+
+	override, err := newComposeOverride(config, services, mode, image, confPath, homeDir)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	data, err := yaml.Marshal(override)
+	if err != nil {
+		fmt.Println("Error generating the compose override:", err)
+		os.Exit(1)
+	}
+	data = append([]byte("# Generated by devcli compose, tunnels of the "+config.Environment+" environment\n"), data...)
+	if out == "-" {
+		os.Stdout.Write(data)
+		return
+	}
+	if err := os.WriteFile(out, data, 0644); err != nil {
+		fmt.Println("Error writing the compose override:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Wrote %s for services %s\n", out, strings.Join(services, ", "))
+	if mode == composeHost {
+		fmt.Println("On linux, start devcli with -bind-address 0.0.0.0 so that containers can reach the tunnels.")
+	}
+}
+
+// newComposeOverride returns the override adding the tunnel addresses to the services. In
+// host mode they point to host.docker.internal, in proxy mode to the devcli service.
+func newComposeOverride(config Config, services []string, mode, image, confFile, homeDir string) (*composeOverride, error) {
+	proxyConfig, err := findProxyConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	host := "host.docker.internal"
+	override := &composeOverride{Services: make(map[string]composeService)}
+	switch mode {
+	case composeHost:
+	case composeProxy:
+		host = composeProxyService
+		override.Services[composeProxyService] = composeService{
+			Image:   image,
+			Command: containerCommand(config.Environment, confFile),
+			Volumes: dockerVolumes(config, confFile, homeDir),
+		}
+	default:
+		return nil, fmt.Errorf("unknown compose mode %s, expected %s or %s", mode, composeHost, composeProxy)
+	}
+
+	environment := make(map[string]string)
+	addTunnel := func(name string, localPort int, protocol string) {
+		prefix := composeVariable(name)
+		environment[prefix+"_HOST"] = host
+		environment[prefix+"_PORT"] = strconv.Itoa(localPort)
+		if protocol == "http" {
+			environment[prefix+"_URL"] = fmt.Sprintf("http://%s:%d", host, localPort)
+		}
+	}
+	for _, workload := range proxyConfig.Workloads {
+		addTunnel(workload.Name(), workload.LocalPort, workload.Protocol)
+	}
+	for _, connection := range proxyConfig.Bastion.Connections {
+		addTunnel(connection.Name(), connection.LocalPort, connection.Protocol)
+	}
+
+	for _, name := range services {
+		if name == composeProxyService && mode == composeProxy {
+			return nil, fmt.Errorf("service %s clashes with the devcli service of proxy mode", name)
+		}
+		service := composeService{Environment: environment}
+		if mode == composeHost {
+			service.ExtraHosts = []string{"host.docker.internal:host-gateway"}
+		} else {
+			service.DependsOn = []string{composeProxyService}
+		}
+		override.Services[name] = service
+	}
+	return override, nil
+}
+
+// composeVariable turns a tunnel name into the prefix of its environment variables,
+// cashfree becomes DEVCLI_CASHFREE and 10.120.52.48:5432 DEVCLI_10_120_52_48_5432
+func composeVariable(name string) string {
+	return "DEVCLI_" + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+		if r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// composeServices returns the names of the services of a compose file
+func composeServices(composeFile string) ([]string, error) {
+	data, err := os.ReadFile(composeFile)
+	if err != nil {
+		return nil, err
+	}
+	var compose struct {
+		Services map[string]yaml.Node `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(data, &compose); err != nil {
+		return nil, err
+	}
+	var services []string
+	for name := range compose.Services {
+		services = append(services, name)
+	}
+	sort.Strings(services)
+	if len(services) == 0 {
+		return nil, fmt.Errorf("no services in %s", composeFile)
+	}
+	return services, nil
+}
+
+// stringList is a repeatable string flag
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+var composeConfig = Config{
+	Environment: "staging",
+	Proxies: []ProxyConfig{{
+		Environment: "staging",
+		Bastion:     Bastion{Connections: []Connection{{LocalPort: 5435, RemoteHost: "10.120.52.48", RemotePort: 5432, Protocol: "postgres"}}},
+		Workloads:   []Workload{{Namespace: "enr", App: "cashfree", LocalPort: 8080, RemotePort: 8080, Protocol: "http"}},
+	}},
+}
+
+func TestComposeOverrideHost(t *testing.T) {
+	override, err := newComposeOverride(composeConfig, []string{"api"}, composeHost, "devcli", "/home/me/config.yaml", "/home/me")
+	if err != nil {
+		t.Fatalf("newComposeOverride failed: %v", err)
+	}
+	data, err := yaml.Marshal(override)
+	if err != nil {
+		t.Fatalf("Error marshaling the override: %v", err)
+	}
+	expected := `services:
+    api:
+        extra_hosts:
+            - host.docker.internal:host-gateway
+        environment:
+            DEVCLI_10_120_52_48_5432_HOST: host.docker.internal
+            DEVCLI_10_120_52_48_5432_PORT: "5435"
+            DEVCLI_CASHFREE_HOST: host.docker.internal
+            DEVCLI_CASHFREE_PORT: "8080"
+            DEVCLI_CASHFREE_URL: http://host.docker.internal:8080
+`
+	if string(data) != expected {
+		t.Errorf("newComposeOverride failed: expected\n%s\ngot\n%s", expected, data)
+	}
+}
+
+func TestComposeOverrideProxy(t *testing.T) {
+	override, err := newComposeOverride(composeConfig, []string{"api", "worker"}, composeProxy, "devcli", "/home/me/config.yaml", "/home/me")
+	if err != nil {
+		t.Fatalf("newComposeOverride failed: %v", err)
+	}
+	proxy := override.Services[composeProxyService]
+	if proxy.Image != "devcli" || !strings.Contains(strings.Join(proxy.Command, " "), "-bind-address 0.0.0.0") || len(proxy.Volumes) != 4 {
+		t.Errorf("newComposeOverride failed: unexpected devcli service %+v", proxy)
+	}
+	worker := override.Services["worker"]
+	if worker.Environment["DEVCLI_CASHFREE_HOST"] != composeProxyService || !reflect.DeepEqual(worker.DependsOn, []string{composeProxyService}) {
+		t.Errorf("newComposeOverride failed: unexpected worker service %+v", worker)
+	}
+	if _, err := newComposeOverride(composeConfig, []string{"devcli"}, composeProxy, "devcli", "/home/me/config.yaml", "/home/me"); err == nil {
+		t.Error("newComposeOverride failed: expected an error for a service named devcli")
+	}
+}
+
+func TestComposeServices(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "docker-compose.yml")
+	os.WriteFile(file, []byte("services:\n  worker:\n    image: worker\n  api:\n    build: .\n"), 0644)
+	services, err := composeServices(file)
+	if err != nil {
+		t.Fatalf("composeServices failed: %v", err)
+	}
+	if !reflect.DeepEqual(services, []string{"api", "worker"}) {
+		t.Errorf("composeServices failed: expected [api worker], got %v", services)
+	}
+}
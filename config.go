@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// projectConfigName is the configuration file a repository ships with the tunnels its
+// services need
+const projectConfigName = ".devcli.yaml"
+
+// findProjectConfig returns the path of the nearest projectConfigName in the directory or
+// one of its parents, empty when there is none
+func findProjectConfig(dir string) string {
+	for {
+		path := filepath.Join(dir, projectConfigName)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// projectConfig returns the project configuration file of the current directory, empty when
+// there is none
+func projectConfig() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	return findProjectConfig(dir)
+}
+
+// configPath returns the absolute path of the configuration file. When none is given it is
+// the project configuration file of the current directory, or else ~/.devcli/config.yaml.
+func configPath(confFile string) (string, error) {
+	if confFile != "" {
+		return filepath.Abs(confFile)
+	}
+	if project := projectConfig(); project != "" {
+		return project, nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, ".devcli", "config.yaml"), nil
+}
+
+// configEnvironment returns the environment a session started with the options runs,
+// or an empty string if it is not known
+func configEnvironment(opts options) string {
+	confFile, err := configPath(opts.confFile)
+	if err != nil {
+		return opts.environment
+	}
+	config, err := readConfig(confFile)
+	if err != nil {
+		return opts.environment
+	}
+	if err := selectEnvironment(&config, opts); err != nil {
+		return opts.environment
+	}
+	if err := chooseEnvironment(&config); err != nil {
+		return ""
+	}
+	return config.Environment
+}
+
+// allowUnknownFieldsEnv is the environment variable that makes devcli ignore the keys of the
+// configuration file it does not know, as it did before the decoding was strict
+const allowUnknownFieldsEnv = "DEVCLI_ALLOW_UNKNOWN_FIELDS"
+
+// unknownFieldPattern matches the yaml errors of keys that are not in the configuration schema
+var unknownFieldPattern = regexp.MustCompile(`field (\S+) not found in type \S+`)
+
+// readConfig reads and parses the configuration file
+func readConfig(confFile string) (Config, error) {
+	configData, err := os.ReadFile(confFile)
+	if err != nil {
+		return Config{}, err
+	}
+	config, err := parseConfig(configData)
+	if err != nil {
+		return config, err
+	}
+	if err := checkConfigTrust(confFile, configData, config); err != nil {
+		return config, err
+	}
+	return config, expandServiceManifests(&config, filepath.Dir(confFile))
+}
+
+// parseConfig decodes the configuration, rejecting unknown keys such as a misspelled
+// local_port with their line numbers unless DEVCLI_ALLOW_UNKNOWN_FIELDS is set
+func parseConfig(data []byte) (Config, error) {
+	var config Config
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(os.Getenv(allowUnknownFieldsEnv) == "")
+	err := decoder.Decode(&config)
+	if errors.Is(err, io.EOF) {
+		// an empty file
+		return config, nil
+	}
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		unknown := false
+		for i, message := range typeErr.Errors {
+			if unknownFieldPattern.MatchString(message) {
+				typeErr.Errors[i] = unknownFieldPattern.ReplaceAllString(message, "unknown field $1")
+				unknown = true
+			}
+		}
+		if unknown {
+			return config, fmt.Errorf("%s\nFix the keys, or set %s=1 to ignore unknown keys", strings.Join(typeErr.Errors, "\n"), allowUnknownFieldsEnv)
+		}
+	}
+	return config, err
+}
+
+// findProxyConfig returns the proxy configuration of the configuration's environment
+func findProxyConfig(config Config) (ProxyConfig, error) {
+	if config.Environment == "" {
+		return ProxyConfig{}, errors.New("environment is not set in the configuration file or passed as a command line argument")
+	}
+	for _, proxy := range config.Proxies {
+		if proxy.Environment == config.Environment {
+			return proxy, nil
+		}
+	}
+	return ProxyConfig{}, fmt.Errorf("proxy configuration for environment %s is not found", config.Environment)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	data := `environment: staging
+proxies:
+  - proxy:
+    environment: staging
+    cloud_project: okcredit-staging-env
+    workloads:
+      - namespace: enr
+        app: cashfree
+        local_prot: 8080
+        remote_port: 8080
+`
+	_, err := parseConfig([]byte(data))
+	if err == nil || !strings.Contains(err.Error(), "line 9: unknown field local_prot") || !strings.Contains(err.Error(), allowUnknownFieldsEnv) {
+		t.Errorf("parseConfig failed: expected the unknown field with its line, got %v", err)
+	}
+
+	t.Setenv(allowUnknownFieldsEnv, "1")
+	config, err := parseConfig([]byte(data))
+	if err != nil || len(config.Proxies) != 1 || config.Proxies[0].Workloads[0].RemotePort != 8080 {
+		t.Errorf("parseConfig failed: expected the unknown field to be ignored, got %+v, %v", config, err)
+	}
+
+	if _, err := parseConfig(nil); err != nil {
+		t.Errorf("parseConfig failed: expected an empty configuration to parse, got %v", err)
+	}
+}
+
+func TestConfigTemplateIsStrict(t *testing.T) {
+	data, err := os.ReadFile("config-template.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseConfig(data); err != nil {
+		t.Errorf("config-template.yaml has keys the configuration does not know: %v", err)
+	}
+}
+
+func TestFindProjectConfig(t *testing.T) {
+	root := t.TempDir()
+	nested := filepath.Join(root, "services", "ledger", "cmd")
+	if err := os.MkdirAll(nested, 0o755); err != nil {
+		t.Fatalf("Error creating directories: %v", err)
+	}
+	if path := findProjectConfig(nested); path != "" && strings.HasPrefix(path, root) {
+		t.Errorf("findProjectConfig failed: expected no project configuration, got %s", path)
+	}
+	project := filepath.Join(root, "services", projectConfigName)
+	if err := os.WriteFile(project, []byte("environment: staging\n"), 0o644); err != nil {
+		t.Fatalf("Error writing configuration: %v", err)
+	}
+	if path := findProjectConfig(nested); path != project {
+		t.Errorf("findProjectConfig failed: expected %s, got %s", project, path)
+	}
+	// the nearest one wins
+	nearest := filepath.Join(nested, projectConfigName)
+	if err := os.WriteFile(nearest, []byte("environment: dev\n"), 0o644); err != nil {
+		t.Fatalf("Error writing configuration: %v", err)
+	}
+	if path := findProjectConfig(nested); path != nearest {
+		t.Errorf("findProjectConfig failed: expected %s, got %s", nearest, path)
+	}
+	// a directory of that name is not a configuration
+	if err := os.Mkdir(filepath.Join(root, "other"), 0o755); err != nil {
+		t.Fatalf("Error creating directories: %v", err)
+	}
+	if err := os.Mkdir(filepath.Join(root, "other", projectConfigName), 0o755); err != nil {
+		t.Fatalf("Error creating directories: %v", err)
+	}
+	if path := findProjectConfig(filepath.Join(root, "other")); path != "" && strings.HasPrefix(path, root) {
+		t.Errorf("findProjectConfig failed: expected the directory to be skipped, got %s", path)
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// runConfig implements devcli config, which inspects and edits the configuration file
+func runConfig(args []string) {
+	usage := func() {
+		fmt.Println("Usage: devcli config render [-conf <file>] [-env <environment>]")
+		fmt.Println("       devcli config get [-conf <file>] <path>")
+		fmt.Println("       devcli config set [-conf <file>] <path> <value>")
+		fmt.Println("       devcli config add-workload [-conf <file>] [-env <environment>] -app <app>")
+		fmt.Println("Paths are like cloud.kubeconfig or proxies[staging].bastion.name, lists take an index or")
+		fmt.Println("the environment, name or app of an item.")
+	}
+	if len(args) == 0 {
+		usage()
+		os.Exit(2)
+	}
+	switch args[0] {
+	case "render":
+		runConfigRender(args[1:])
+	case "get", "set":
+		runConfigEdit(args[0], args[1:], usage)
+	case "add-workload":
+		runAddWorkload(args[1:])
+	default:
+		usage()
+		os.Exit(2)
+	}
+}
+
+// runConfigEdit implements devcli config get and set. set edits the file in place, keeping
+// its comments and formatting, and refuses an edit that makes the configuration invalid.
+func runConfigEdit(action string, args []string, usage func()) {
+	fs := flag.NewFlagSet("devcli config "+action, flag.ExitOnError)
+	confFile := fs.String("conf", "", "Path to the configuration file")
+	fs.Parse(args)
+	if (action == "get" && fs.NArg() != 1) || (action == "set" && fs.NArg() != 2) {
+		usage()
+		os.Exit(2)
+	}
+
+	path, err := configPath(*confFile)
+	if err != nil {
+		fmt.Println("Error getting user home directory:", err)
+		os.Exit(1)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Println("Error reading configuration file:", err)
+		os.Exit(1)
+	}
+	if action == "get" {
+		value, err := getConfig(data, fs.Arg(0))
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		fmt.Println(value)
+		return
+	}
+
+	edited, err := setConfig(data, fs.Arg(0), fs.Arg(1))
+	if err == nil {
+		var config Config
+		if config, err = parseConfig(edited); err == nil {
+			err = expandServiceManifests(&config, filepath.Dir(path))
+		}
+		if err == nil {
+			if problems := validateConfig(config); len(problems) > 0 {
+				err = errors.New(strings.Join(problems, "; "))
+			}
+		}
+	}
+	if err == nil {
+		err = writeConfigFile(path, edited)
+	}
+	if err != nil {
+		fmt.Printf("Error setting %s: %v\n", fs.Arg(0), err)
+		os.Exit(1)
+	}
+}
+
+// runConfigRender implements devcli config render, which prints the configuration of an
+// environment as the session sees it, YAML anchors, aliases and merge keys resolved, with
+// the line every value is set on
+func runConfigRender(args []string) {
+	fs := flag.NewFlagSet("devcli config render", flag.ExitOnError)
+	confFile := fs.String("conf", "", "Path to the configuration file")
+	environment := fs.String("env", "", "Environment to render, the default environment of the configuration file when empty")
+	fs.Parse(args)
+
+	path, err := configPath(*confFile)
+	if err != nil {
+		fmt.Println("Error getting user home directory:", err)
+		os.Exit(1)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Println("Error reading configuration file:", err)
+		os.Exit(1)
+	}
+	if err := renderConfig(os.Stdout, data, filepath.Base(path), filepath.Dir(path), *environment); err != nil {
+		fmt.Println("Error rendering the configuration:", err)
+		os.Exit(1)
+	}
+}
+
+// renderConfig writes the environment's proxy configuration, or the default environment's
+// when it is empty, as YAML commented with the file and line of every value. The workloads
+// derived from the service manifests below base are commented with their manifest.
+func renderConfig(w io.Writer, data []byte, file, base, environment string) error {
+	config, err := parseConfig(data)
+	if err != nil {
+		return err
+	}
+	if err := expandServiceManifests(&config, base); err != nil {
+		return err
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return err
+	}
+	sources := make(map[string]string)
+	configSources(&root, "", file, sources)
+
+	chosenBy := "-env"
+	if environment == "" {
+		environment = config.Environment
+		chosenBy = "the default environment, " + sources["environment"]
+	}
+	if environment == "" {
+		return errors.New("pass the environment with -env, the configuration file has no default environment")
+	}
+	index := -1
+	for i, proxy := range config.Proxies {
+		if proxy.Environment == environment {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return fmt.Errorf("proxy configuration for environment %s is not found", environment)
+	}
+
+	var rendered yaml.Node
+	if err := rendered.Encode(config.Proxies[index]); err != nil {
+		return err
+	}
+	for i, workload := range config.Proxies[index].Workloads {
+		if workload.manifest == "" {
+			continue
+		}
+		source := workload.manifest
+		if rel, err := filepath.Rel(base, source); err == nil {
+			source = rel
+		}
+		workloadPath := fmt.Sprintf("proxies[%d].workloads[%d]", index, i)
+		var node yaml.Node
+		if err := node.Encode(workload); err != nil {
+			return err
+		}
+		manifestSources(&node, workloadPath, source, sources)
+	}
+	annotateConfig(&rendered, fmt.Sprintf("proxies[%d]", index), sources)
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# environment %s (%s)\n", environment, chosenBy)
+	encoder := yaml.NewEncoder(&b)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&rendered); err != nil {
+		return err
+	}
+	encoder.Close()
+	_, err = w.Write(b.Bytes())
+	return err
+}
+
+// configSources records the file and line every value of the YAML node is set on by its
+// path, e.g. proxies[0].workloads[1].local_port. Aliases and merge keys are followed to
+// the values they stand for, so a value inherited from an anchor points at the anchor.
+func configSources(node *yaml.Node, path, file string, sources map[string]string) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			configSources(child, path, file, sources)
+		}
+	case yaml.AliasNode:
+		configSources(node.Alias, path, file, sources)
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			itemPath := path + "[" + strconv.Itoa(i) + "]"
+			sources[itemPath] = fmt.Sprintf("%s:%d", file, item.Line)
+			configSources(item, itemPath, file, sources)
+		}
+	case yaml.MappingNode:
+		// the keys of merged mappings come first, the mapping's own keys override them
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == "<<" {
+				merged := node.Content[i+1]
+				if merged.Kind == yaml.AliasNode {
+					merged = merged.Alias
+				}
+				if merged.Kind == yaml.SequenceNode {
+					for _, item := range merged.Content {
+						configSources(item, path, file, sources)
+					}
+				} else {
+					configSources(merged, path, file, sources)
+				}
+			}
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if key.Value == "<<" {
+				continue
+			}
+			keyPath := key.Value
+			if path != "" {
+				keyPath = path + "." + key.Value
+			}
+			line := key.Line
+			if value.Kind == yaml.AliasNode {
+				line = value.Alias.Line
+			}
+			sources[keyPath] = fmt.Sprintf("%s:%d", file, line)
+			configSources(value, keyPath, file, sources)
+		}
+	}
+}
+
+// manifestSources records the manifest as the source of every value of the YAML node of a
+// workload derived from it, but for its empty values
+func manifestSources(node *yaml.Node, path, manifest string, sources map[string]string) {
+	if emptyNode(node) {
+		return
+	}
+	switch node.Kind {
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			manifestSources(item, path+"["+strconv.Itoa(i)+"]", manifest, sources)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			manifestSources(node.Content[i+1], path+"."+node.Content[i].Value, manifest, sources)
+		}
+	}
+	sources[path] = manifest
+}
+
+// annotateConfig comments every value of the encoded configuration with its source, and
+// leaves out the empty values that are not set in the file
+func annotateConfig(node *yaml.Node, path string, sources map[string]string) {
+	switch node.Kind {
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			itemPath := path + "[" + strconv.Itoa(i) + "]"
+			annotateConfig(item, itemPath, sources)
+			if item.Kind == yaml.ScalarNode {
+				item.LineComment = sources[itemPath]
+			}
+		}
+	case yaml.MappingNode:
+		var content []*yaml.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			keyPath := path + "." + key.Value
+			annotateConfig(value, keyPath, sources)
+			source, set := sources[keyPath]
+			if !set && emptyNode(value) {
+				continue
+			}
+			if !set {
+				source = "default"
+			}
+			if value.Kind == yaml.ScalarNode {
+				value.LineComment = source
+			} else {
+				key.LineComment = source
+			}
+			content = append(content, key, value)
+		}
+		node.Content = content
+	}
+}
+
+// emptyNode reports whether the node is a zero value: an empty string, 0, false, null or
+// an empty sequence or mapping
+func emptyNode(node *yaml.Node) bool {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		switch node.Value {
+		case "", "0", "0s", "false", "null":
+			return true
+		}
+	case yaml.SequenceNode, yaml.MappingNode:
+		return len(node.Content) == 0
+	}
+	return false
+}
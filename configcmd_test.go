@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenderConfig(t *testing.T) {
+	data := []byte(`environment: staging
+proxies:
+  - environment: staging
+    cloud_project: okcredit-staging-env
+    workloads:
+      - &workload
+        namespace: enr
+        app: cashfree
+        local_port: 8080
+        remote_port: 8080
+      - <<: *workload
+        app: payments
+        local_port: 8081
+  - environment: prod
+    cloud_project: okcredit-prod-env
+`)
+	var out bytes.Buffer
+	if err := renderConfig(&out, data, "config.yaml", t.TempDir(), ""); err != nil {
+		t.Fatalf("renderConfig failed: %v", err)
+	}
+	rendered := out.String()
+	for _, expected := range []string{
+		"# environment staging (the default environment, config.yaml:1)\n",
+		"cloud_project: okcredit-staging-env # config.yaml:4\n",
+		// inherited from the anchor
+		"  - namespace: enr # config.yaml:7\n    app: payments # config.yaml:12\n    local_port: 8081 # config.yaml:13\n    remote_port: 8080 # config.yaml:10\n",
+	} {
+		if !strings.Contains(rendered, expected) {
+			t.Errorf("renderConfig failed: expected %q in\n%s", expected, rendered)
+		}
+	}
+	if strings.Contains(rendered, "okcredit-prod-env") || strings.Contains(rendered, "protected") {
+		t.Errorf("renderConfig failed: expected only the values of staging set in the file\n%s", rendered)
+	}
+
+	out.Reset()
+	if err := renderConfig(&out, data, "config.yaml", t.TempDir(), "prod"); err != nil || !strings.HasPrefix(out.String(), "# environment prod (-env)\n") {
+		t.Errorf("renderConfig failed: unexpected output %q and error %v", out.String(), err)
+	}
+	if err := renderConfig(&out, data, "config.yaml", t.TempDir(), "dev"); err == nil {
+		t.Error("renderConfig failed: expected an error for an unknown environment")
+	}
+}
+
+func TestRenderConfigManifests(t *testing.T) {
+	base := t.TempDir()
+	writeManifest(t, filepath.Join(base, "monorepo"), "services/ledger", "name: ledger\nports: [{name: grpc-api, port: 8080}]\n")
+	data := []byte(`proxies:
+  - environment: staging
+    service_manifests: {root: monorepo, namespace: finance}
+`)
+	var out bytes.Buffer
+	if err := renderConfig(&out, data, "config.yaml", base, "staging"); err != nil {
+		t.Fatalf("renderConfig failed: %v", err)
+	}
+	expected := "app: ledger # " + filepath.Join("monorepo", "services", "ledger", "service.yaml") + "\n"
+	if rendered := out.String(); !strings.Contains(rendered, expected) || strings.Contains(rendered, "pod:") {
+		t.Errorf("renderConfig failed: expected the workload of the manifest in\n%s", rendered)
+	}
+}
@@ -0,0 +1,602 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// identityKeys are the keys whose value selects an item of a sequence, e.g. the staging in
+// proxies[staging] or the cashfree in workloads[cashfree]
+var identityKeys = []string{"environment", "name", "app", "statefulset", "pod", "tunnel"}
+
+// configPathSegment is a key of a mapping, or the selector of an item of a sequence
+type configPathSegment struct {
+	key      string
+	selector string
+	item     bool
+}
+
+func (s configPathSegment) String() string {
+	if s.item {
+		return "[" + s.selector + "]"
+	}
+	return s.key
+}
+
+// parseConfigPath splits a path like proxies[staging].bastion.name into its segments
+func parseConfigPath(path string) ([]configPathSegment, error) {
+	var segments []configPathSegment
+	for rest := path; rest != ""; {
+		if rest[0] == '[' {
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("path %s: [ without ]", path)
+			}
+			segments = append(segments, configPathSegment{selector: rest[1:end], item: true})
+			rest = rest[end+1:]
+			if strings.HasPrefix(rest, ".") && len(rest) > 1 {
+				rest = rest[1:]
+			}
+			continue
+		}
+		end := strings.IndexAny(rest, ".[")
+		if end < 0 {
+			end = len(rest)
+		}
+		if end == 0 {
+			return nil, fmt.Errorf("path %s: empty key", path)
+		}
+		segments = append(segments, configPathSegment{key: rest[:end]})
+		rest = rest[end:]
+		if strings.HasPrefix(rest, ".") {
+			if len(rest) == 1 {
+				return nil, fmt.Errorf("path %s: empty key", path)
+			}
+			rest = rest[1:]
+		}
+	}
+	if len(segments) == 0 {
+		return nil, errors.New("the path is empty")
+	}
+	return segments, nil
+}
+
+// resolveAlias returns the node an alias stands for
+func resolveAlias(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	return node
+}
+
+// mappingValue returns the key and value of the mapping's key, also looking into its merge
+// keys when merged is set
+func mappingValue(mapping *yaml.Node, key string, merged bool) (*yaml.Node, *yaml.Node) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i], mapping.Content[i+1]
+		}
+	}
+	if !merged {
+		return nil, nil
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value != "<<" {
+			continue
+		}
+		sources := []*yaml.Node{resolveAlias(mapping.Content[i+1])}
+		if sources[0].Kind == yaml.SequenceNode {
+			sources = sources[0].Content
+		}
+		for _, source := range sources {
+			if k, v := mappingValue(resolveAlias(source), key, true); k != nil {
+				return k, v
+			}
+		}
+	}
+	return nil, nil
+}
+
+// selectItem returns the item of the sequence at the index, or the one whose identity key,
+// remote_host:remote_port or scalar value is the selector
+func selectItem(sequence *yaml.Node, selector string) *yaml.Node {
+	if index, err := strconv.Atoi(selector); err == nil {
+		if index >= 0 && index < len(sequence.Content) {
+			return sequence.Content[index]
+		}
+		return nil
+	}
+	for _, item := range sequence.Content {
+		resolved := resolveAlias(item)
+		switch resolved.Kind {
+		case yaml.ScalarNode:
+			if resolved.Value == selector {
+				return item
+			}
+		case yaml.MappingNode:
+			for _, key := range identityKeys {
+				if _, value := mappingValue(resolved, key, true); value != nil && resolveAlias(value).Value == selector {
+					return item
+				}
+			}
+			_, host := mappingValue(resolved, "remote_host", true)
+			_, port := mappingValue(resolved, "remote_port", true)
+			if host != nil && port != nil && resolveAlias(host).Value+":"+resolveAlias(port).Value == selector {
+				return item
+			}
+		}
+	}
+	return nil
+}
+
+// documentRoot returns the top level mapping of the configuration
+func documentRoot(document *yaml.Node) (*yaml.Node, error) {
+	if document.Kind != yaml.DocumentNode || len(document.Content) == 0 {
+		return nil, errors.New("the configuration file is empty")
+	}
+	root := resolveAlias(document.Content[0])
+	if root.Kind != yaml.MappingNode {
+		return nil, errors.New("the configuration file is not a mapping")
+	}
+	return root, nil
+}
+
+// lookupConfig returns the node at the path, following aliases and merge keys
+func lookupConfig(document *yaml.Node, path string) (*yaml.Node, error) {
+	segments, err := parseConfigPath(path)
+	if err != nil {
+		return nil, err
+	}
+	node, err := documentRoot(document)
+	if err != nil {
+		return nil, err
+	}
+	for i, segment := range segments {
+		var next *yaml.Node
+		switch {
+		case segment.item && node.Kind == yaml.SequenceNode:
+			next = selectItem(node, segment.selector)
+		case !segment.item && node.Kind == yaml.MappingNode:
+			_, next = mappingValue(node, segment.key, true)
+		}
+		if next == nil {
+			return nil, fmt.Errorf("%s is not set", joinConfigPath(segments[:i+1]))
+		}
+		node = resolveAlias(next)
+	}
+	return node, nil
+}
+
+// joinConfigPath formats the segments as a path
+func joinConfigPath(segments []configPathSegment) string {
+	var b strings.Builder
+	for i, segment := range segments {
+		if i > 0 && !segment.item {
+			b.WriteByte('.')
+		}
+		b.WriteString(segment.String())
+	}
+	return b.String()
+}
+
+// getConfig returns the value at the path: a scalar as is, anything else as YAML
+func getConfig(data []byte, path string) (string, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return "", err
+	}
+	node, err := lookupConfig(&document, path)
+	if err != nil {
+		return "", err
+	}
+	if node.Kind == yaml.ScalarNode {
+		return node.Value, nil
+	}
+	// decoding resolves the aliases and merge keys, which may point outside of the node
+	var value interface{}
+	if err := node.Decode(&value); err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	encoder := yaml.NewEncoder(&b)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(value); err != nil {
+		return "", err
+	}
+	encoder.Close()
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+// setConfig returns the configuration with the value at the path set to value, parsed as
+// YAML. The file is edited as text, so that its comments and formatting are kept: an
+// existing value is replaced where it is, and a missing key is added at the end of its
+// mapping along with the mappings leading to it.
+func setConfig(data []byte, path, value string) ([]byte, error) {
+	segments, err := parseConfigPath(path)
+	if err != nil {
+		return nil, err
+	}
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	var newValue yaml.Node
+	if err := yaml.Unmarshal([]byte(value), &newValue); err != nil {
+		return nil, fmt.Errorf("value %q is not valid YAML: %w", value, err)
+	}
+	if len(newValue.Content) == 0 {
+		newValue.Content = []*yaml.Node{{Kind: yaml.ScalarNode, Tag: "!!null", Value: ""}}
+	}
+	leaf := newValue.Content[0]
+
+	root, err := documentRoot(&document)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	node := root
+	var key *yaml.Node
+	for i, segment := range segments {
+		if node.Kind == yaml.AliasNode {
+			return nil, fmt.Errorf("%s is the anchor of line %d, set the value there", joinConfigPath(segments[:i]), node.Alias.Line)
+		}
+		if segment.item {
+			if node.Kind != yaml.SequenceNode {
+				return nil, fmt.Errorf("%s is not a list", joinConfigPath(segments[:i]))
+			}
+			item := selectItem(node, segment.selector)
+			if item == nil {
+				return nil, fmt.Errorf("%s is not set, add the item to the list by hand", joinConfigPath(segments[:i+1]))
+			}
+			node, key = item, nil
+			continue
+		}
+		if node.Kind == yaml.ScalarNode && node.Tag == "!!null" && key != nil {
+			// an empty key, e.g. "bastion:", gets the missing keys below it
+			return insertUnderKey(lines, key, segments[i:], leaf, configIndent(root))
+		}
+		if node.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("%s is not a mapping", joinConfigPath(segments[:i]))
+		}
+		k, v := mappingValue(node, segment.key, false)
+		if k == nil {
+			return insertIntoMapping(lines, node, segments[i:], leaf, configIndent(root))
+		}
+		node, key = v, k
+	}
+	if node.Kind == yaml.AliasNode {
+		return nil, fmt.Errorf("%s is an alias of the anchor of line %d, set the value there", path, node.Alias.Line)
+	}
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!null" && node.Value == "" && key != nil {
+		return insertUnderKey(lines, key, nil, leaf, configIndent(root))
+	}
+	return replaceValue(lines, node, leaf)
+}
+
+// configIndent returns the indentation step of the file, 2 unless its nested mappings say
+// otherwise
+func configIndent(root *yaml.Node) int {
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		value := root.Content[i+1]
+		if value.Kind == yaml.MappingNode && value.Style&yaml.FlowStyle == 0 && len(value.Content) > 0 {
+			if step := value.Content[0].Column - root.Content[i].Column; step > 0 {
+				return step
+			}
+		}
+	}
+	return 2
+}
+
+// renderInline renders a value on a single line, collections in flow style
+func renderInline(node *yaml.Node, style yaml.Style) (string, error) {
+	node.Style |= yaml.FlowStyle
+	if node.Kind == yaml.ScalarNode {
+		node.Style = style &^ yaml.FlowStyle
+	}
+	out, err := yaml.Marshal(node)
+	if err != nil {
+		return "", err
+	}
+	text := strings.TrimSuffix(string(out), "\n")
+	if strings.Contains(text, "\n") {
+		return "", errors.New("the value does not fit on a line")
+	}
+	return text, nil
+}
+
+// renderBlock renders the keys leading to the value, the value last, indented by indent
+func renderBlock(segments []configPathSegment, leaf *yaml.Node, indent, step int) (string, error) {
+	node := leaf
+	for i := len(segments) - 1; i >= 0; i-- {
+		if segments[i].item {
+			return "", fmt.Errorf("%s is not set, add the item to the list by hand", joinConfigPath(segments[:i+1]))
+		}
+		node = &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{{Kind: yaml.ScalarNode, Value: segments[i].key}, node}}
+	}
+	var b bytes.Buffer
+	encoder := yaml.NewEncoder(&b)
+	encoder.SetIndent(step)
+	if err := encoder.Encode(node); err != nil {
+		return "", err
+	}
+	encoder.Close()
+	var out strings.Builder
+	for _, line := range strings.SplitAfter(b.String(), "\n") {
+		if line != "" {
+			out.WriteString(strings.Repeat(" ", indent) + line)
+		}
+	}
+	return out.String(), nil
+}
+
+// nodeLastLine returns the last line the node or its children are on
+func nodeLastLine(node *yaml.Node) int {
+	last := node.Line
+	for _, child := range node.Content {
+		last = max(last, nodeLastLine(child))
+	}
+	return last
+}
+
+// nodeEndLine returns the last line of the block mapping or sequence. The lines of its nodes
+// only tell where a multi-line scalar starts, e.g. a block scalar of its last key, so the
+// node ends before the first line after them that is less indented than its keys or dashes,
+// or for a sequence that is as indented but not an item. The comment lines after it that are
+// not more indented than it are left to what follows.
+func nodeEndLine(lines []string, node *yaml.Node) int {
+	indent := node.Column - 1
+	end := nodeLastLine(node)
+	for i := end; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], "\r\n")
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" {
+			continue
+		}
+		depth := len(line) - len(trimmed)
+		if depth < indent || (depth == 0 && (trimmed == "---" || trimmed == "...")) {
+			break
+		}
+		if depth == indent && node.Kind == yaml.SequenceNode && trimmed != "-" && !strings.HasPrefix(trimmed, "- ") {
+			break
+		}
+		if depth <= indent && strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		end = i + 1
+	}
+	return end
+}
+
+// insertLines inserts text after the line, 1-based
+func insertLines(lines []string, after int, text string) []byte {
+	if after > len(lines) {
+		after = len(lines)
+	}
+	var b strings.Builder
+	for _, line := range lines[:after] {
+		b.WriteString(line)
+	}
+	if after > 0 && !strings.HasSuffix(lines[after-1], "\n") {
+		b.WriteByte('\n')
+	}
+	b.WriteString(text)
+	for _, line := range lines[after:] {
+		b.WriteString(line)
+	}
+	return []byte(b.String())
+}
+
+// insertIntoMapping adds the missing keys and the value at the end of the mapping
+func insertIntoMapping(lines []string, mapping *yaml.Node, segments []configPathSegment, leaf *yaml.Node, step int) ([]byte, error) {
+	if mapping.Style&yaml.FlowStyle != 0 || len(mapping.Content) == 0 {
+		return nil, fmt.Errorf("the mapping of line %d is on a single line, add %s by hand", mapping.Line, segments[0].key)
+	}
+	text, err := renderBlock(segments, leaf, mapping.Content[0].Column-1, step)
+	if err != nil {
+		return nil, err
+	}
+	return insertLines(lines, nodeEndLine(lines, mapping), text), nil
+}
+
+// insertUnderKey adds the missing keys and the value below a key without a value
+func insertUnderKey(lines []string, key *yaml.Node, segments []configPathSegment, leaf *yaml.Node, step int) ([]byte, error) {
+	if len(segments) == 0 && (leaf.Kind == yaml.ScalarNode || leaf.Style&yaml.FlowStyle != 0) {
+		// the value goes on the line of the key, as it was written
+		line := lines[key.Line-1]
+		end := strings.IndexByte(line[columnOffset(line, key.Column):], ':')
+		if end < 0 {
+			return nil, fmt.Errorf("line %d: the key %s is not followed by a colon", key.Line, key.Value)
+		}
+		at := columnOffset(line, key.Column) + end + 1
+		text, err := renderInline(leaf, leaf.Style)
+		if err != nil {
+			return nil, err
+		}
+		lines[key.Line-1] = line[:at] + " " + text + strings.TrimLeft(line[at:], " ")
+		return []byte(strings.Join(lines, "")), nil
+	}
+	// the missing keys, or a block collection, go below the key
+	text, err := renderBlock(segments, leaf, key.Column-1+step, step)
+	if err != nil {
+		return nil, err
+	}
+	return insertLines(lines, key.Line, text), nil
+}
+
+// columnOffset returns the byte offset of the 1-based column of the line
+func columnOffset(line string, column int) int {
+	offset := 0
+	for i := 1; i < column && offset < len(line); i++ {
+		_, size := utf8.DecodeRuneInString(line[offset:])
+		offset += size
+	}
+	return offset
+}
+
+// valueLength returns the length in bytes of the value written at the start of text, for
+// plain and quoted scalars and flow collections on a single line
+func valueLength(node *yaml.Node, text string) (int, error) {
+	switch {
+	case node.Kind == yaml.ScalarNode && node.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0:
+	case node.Kind == yaml.ScalarNode && node.Style&yaml.DoubleQuotedStyle != 0:
+		for i := 1; i < len(text); i++ {
+			switch text[i] {
+			case '\\':
+				i++
+			case '"':
+				return i + 1, nil
+			}
+		}
+	case node.Kind == yaml.ScalarNode && node.Style&yaml.SingleQuotedStyle != 0:
+		for i := 1; i < len(text); i++ {
+			if text[i] == '\'' {
+				if i+1 < len(text) && text[i+1] == '\'' {
+					i++
+					continue
+				}
+				return i + 1, nil
+			}
+		}
+	case node.Kind == yaml.ScalarNode:
+		if strings.HasPrefix(text, node.Value) {
+			return len(node.Value), nil
+		}
+	case node.Style&yaml.FlowStyle != 0:
+		depth := 0
+		quote := byte(0)
+		for i := 0; i < len(text); i++ {
+			c := text[i]
+			switch {
+			case quote != 0:
+				if c == quote {
+					quote = 0
+				}
+			case c == '"' || c == '\'':
+				quote = c
+			case c == '[' || c == '{':
+				depth++
+			case c == ']' || c == '}':
+				depth--
+				if depth == 0 {
+					return i + 1, nil
+				}
+			}
+		}
+	}
+	return 0, fmt.Errorf("line %d: the value is not on a single line, edit it by hand", node.Line)
+}
+
+// replaceValue replaces the value of the node where it is written
+func replaceValue(lines []string, node, leaf *yaml.Node) ([]byte, error) {
+	line := lines[node.Line-1]
+	start := columnOffset(line, node.Column)
+	if node.Anchor != "" {
+		return nil, fmt.Errorf("line %d: the value is the anchor &%s, edit it by hand", node.Line, node.Anchor)
+	}
+	length, err := valueLength(node, line[start:])
+	if err != nil {
+		return nil, err
+	}
+	style := yaml.Style(0)
+	if node.Kind == yaml.ScalarNode {
+		// keep the quotes of the value, unless the new one is not a string
+		style = node.Style
+		if leaf.Kind == yaml.ScalarNode && leaf.ShortTag() != "!!str" {
+			style = 0
+		}
+	}
+	text, err := renderInline(leaf, style)
+	if err != nil {
+		return nil, err
+	}
+	lines[node.Line-1] = line[:start] + text + line[start+length:]
+	return []byte(strings.Join(lines, "")), nil
+}
+
+// appendConfigItem adds the item at the end of the list at the path, creating the list when
+// the key is not set or empty
+func appendConfigItem(data []byte, path string, item *yaml.Node) ([]byte, error) {
+	segments, err := parseConfigPath(path)
+	if err != nil {
+		return nil, err
+	}
+	last := segments[len(segments)-1]
+	if last.item {
+		return nil, fmt.Errorf("path %s: the path of a list ends with its key", path)
+	}
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	root, err := documentRoot(&document)
+	if err != nil {
+		return nil, err
+	}
+	parent := root
+	if len(segments) > 1 {
+		if parent, err = lookupConfig(&document, joinConfigPath(segments[:len(segments)-1])); err != nil {
+			return nil, err
+		}
+	}
+	list := &yaml.Node{Kind: yaml.SequenceNode, Content: []*yaml.Node{item}}
+	key, value := mappingValue(parent, last.key, false)
+	if key == nil {
+		if _, inherited := mappingValue(parent, last.key, true); inherited != nil {
+			return nil, fmt.Errorf("%s comes from the merge key of line %d, add the item there", path, inherited.Line)
+		}
+	}
+	if key == nil || (value.Kind == yaml.ScalarNode && value.Tag == "!!null" && value.Value == "") {
+		text, err := yaml.Marshal(list)
+		if err != nil {
+			return nil, err
+		}
+		return setConfig(data, path, string(text))
+	}
+	switch {
+	case value.Kind == yaml.AliasNode:
+		return nil, fmt.Errorf("%s is an alias of the anchor of line %d, add the item there", path, value.Alias.Line)
+	case value.Kind != yaml.SequenceNode:
+		return nil, fmt.Errorf("%s is not a list", path)
+	case value.Style&yaml.FlowStyle != 0 || len(value.Content) == 0:
+		return nil, fmt.Errorf("the list of line %d is on a single line, add the item by hand", value.Line)
+	}
+	// a block list starts at its first dash, the item is written at the same column
+	text, err := renderBlock(nil, list, value.Column-1, configIndent(root))
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	return insertLines(lines, nodeEndLine(lines, value), text), nil
+}
+
+// writeConfigFile replaces the configuration file, keeping its permissions
+func writeConfigFile(path string, data []byte) error {
+	mode := os.FileMode(0o600)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
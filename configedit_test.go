@@ -0,0 +1,158 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const editedConfig = `# devcli configuration
+cloud:
+  kubeconfig: /home/dev/.kube/config # the default
+proxies:
+  - environment: staging
+    cloud_project: "okcredit-staging-env"
+    bastion:
+      name: bastion
+      connections:
+        - local_port: 5435
+          remote_host: 10.120.52.48
+          remote_port: 5432
+    workloads:
+      - &cashfree
+        namespace: enr
+        app: cashfree
+        local_port: 8080
+        tags: [payments]
+      - <<: *cashfree
+        app: cashfree-admin
+        local_port: 8081
+  - environment: prod
+    cloud_project: okcredit-prod-env
+    bastion:
+`
+
+func TestParseConfigPath(t *testing.T) {
+	segments, err := parseConfigPath("proxies[staging].bastion.connections[10.120.52.48:5432].local_port")
+	if err != nil || joinConfigPath(segments) != "proxies[staging].bastion.connections[10.120.52.48:5432].local_port" || len(segments) != 6 {
+		t.Errorf("parseConfigPath failed: unexpected segments %v and error %v", segments, err)
+	}
+	for _, path := range []string{"", "proxies[staging", "cloud..kubeconfig", "cloud."} {
+		if _, err := parseConfigPath(path); err == nil {
+			t.Errorf("parseConfigPath(%q) failed: expected an error", path)
+		}
+	}
+}
+
+func TestGetConfig(t *testing.T) {
+	for path, expected := range map[string]string{
+		"cloud.kubeconfig":                                                    "/home/dev/.kube/config",
+		"proxies[staging].bastion.name":                                       "bastion",
+		"proxies[0].bastion.connections[0].local_port":                        "5435",
+		"proxies[staging].bastion.connections[10.120.52.48:5432].remote_port": "5432",
+		// inherited through the merge key
+		"proxies[staging].workloads[cashfree-admin].namespace": "enr",
+		"proxies[staging].workloads[cashfree].tags":            "- payments",
+	} {
+		if got, err := getConfig([]byte(editedConfig), path); err != nil || got != expected {
+			t.Errorf("getConfig(%s) failed: expected %q, got %q and error %v", path, expected, got, err)
+		}
+	}
+	if _, err := getConfig([]byte(editedConfig), "proxies[dev].bastion.name"); err == nil || err.Error() != "proxies[dev] is not set" {
+		t.Errorf("getConfig failed: unexpected error %v", err)
+	}
+}
+
+func TestSetConfig(t *testing.T) {
+	for _, test := range []struct {
+		path, value string
+		before      string
+		after       string
+	}{
+		// replaced where it is, keeping the comment and the quotes
+		{"cloud.kubeconfig", "/etc/kube/config", "  kubeconfig: /home/dev/.kube/config # the default\n", "  kubeconfig: /etc/kube/config # the default\n"},
+		{"proxies[staging].cloud_project", "okcredit-42", `    cloud_project: "okcredit-staging-env"`, `    cloud_project: "okcredit-42"`},
+		{"proxies[staging].workloads[cashfree].tags", "[payments, core]", "        tags: [payments]\n", "        tags: [payments, core]\n"},
+		// added at the end of its mapping
+		{"proxies[staging].bastion.connections[0].max_connections", "20", "          remote_port: 5432\n", "          remote_port: 5432\n          max_connections: 20\n"},
+		{"proxies[staging].workloads[cashfree-admin].circuit_breaker.restarts", "3", "        local_port: 8081\n", "        local_port: 8081\n        circuit_breaker:\n          restarts: 3\n"},
+		// below a key without a value
+		{"proxies[prod].bastion", "{name: bastion}", "prod-env\n    bastion:\n", "prod-env\n    bastion: {name: bastion}\n"},
+		{"proxies[prod].bastion.name", "bastion", "prod-env\n    bastion:\n", "prod-env\n    bastion:\n      name: bastion\n"},
+	} {
+		edited, err := setConfig([]byte(editedConfig), test.path, test.value)
+		if err != nil {
+			t.Errorf("setConfig(%s) failed: %v", test.path, err)
+			continue
+		}
+		expected := strings.Replace(editedConfig, test.before, test.after, 1)
+		if string(edited) != expected {
+			t.Errorf("setConfig(%s) failed: expected\n%s\ngot\n%s", test.path, expected, edited)
+		}
+		if got, err := getConfig(edited, test.path); err != nil || (got != test.value && !strings.HasPrefix(test.value, "[") && !strings.HasPrefix(test.value, "{")) {
+			t.Errorf("setConfig(%s) failed: the value read back is %q, error %v", test.path, got, err)
+		}
+	}
+
+	// a key added after a block scalar goes below the scalar
+	script := `proxies:
+  - environment: staging
+    webhooks:
+      - url: https://hooks.slack.com/services/T0
+        payload: |
+          {"text": "{{.Tunnel}} failed",
+
+           "icon_emoji": ":warning:"}
+    # prod
+  - environment: prod
+`
+	edited, err := setConfig([]byte(script), "proxies[staging].webhooks[0].content_type", "application/json")
+	expected := strings.Replace(script, "\":warning:\"}\n", "\":warning:\"}\n        content_type: application/json\n", 1)
+	if err != nil || string(edited) != expected {
+		t.Errorf("setConfig failed: expected\n%s\ngot\n%s (%v)", expected, edited, err)
+	}
+
+	for path, expected := range map[string]string{
+		"proxies[staging].workloads[cashfree]":                "line 14: the value is the anchor &cashfree, edit it by hand",
+		"proxies[dev].cloud_project":                          "proxies[dev] is not set, add the item to the list by hand",
+		"proxies[staging].workloads[cashfree].namespace.name": "proxies[staging].workloads[cashfree].namespace is not a mapping",
+	} {
+		if _, err := setConfig([]byte(editedConfig), path, "x"); err == nil || err.Error() != expected {
+			t.Errorf("setConfig(%s) failed: expected error %q, got %v", path, expected, err)
+		}
+	}
+}
+
+func TestAppendConfigItem(t *testing.T) {
+	item := workloadEntry(Workload{Namespace: "ledger", App: "ledger", LocalPort: 8082, RemotePort: 8080, Protocol: "grpc"})
+	edited, err := appendConfigItem([]byte(editedConfig), "proxies[staging].workloads", item)
+	if err != nil {
+		t.Fatalf("appendConfigItem failed: %v", err)
+	}
+	expected := `        local_port: 8081
+      - namespace: ledger
+        app: ledger
+        local_port: 8082
+        remote_port: 8080
+        protocol: grpc
+  - environment: prod
+`
+	if !strings.Contains(string(edited), expected) {
+		t.Errorf("appendConfigItem failed: unexpected file\n%s", edited)
+	}
+	if got, err := getConfig(edited, "proxies[staging].workloads[ledger].protocol"); err != nil || got != "grpc" {
+		t.Errorf("appendConfigItem failed: expected the item to read back, got %q and error %v", got, err)
+	}
+
+	// the list is created in an environment without workloads
+	edited, err = appendConfigItem([]byte(editedConfig), "proxies[prod].workloads", item)
+	if err != nil {
+		t.Fatalf("appendConfigItem failed: %v", err)
+	}
+	if got, err := getConfig(edited, "proxies[prod].workloads[0].app"); err != nil || got != "ledger" {
+		t.Errorf("appendConfigItem failed: expected the list to be created, got %q and error %v\n%s", got, err, edited)
+	}
+
+	if _, err := appendConfigItem([]byte(editedConfig), "proxies[staging].workloads[0].tags", item); err == nil {
+		t.Errorf("appendConfigItem failed: expected an error for a list on a single line")
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrSessionRunning is returned when another session of the same environment is running
+var ErrSessionRunning = errors.New("a session is already running")
+
+// controlServer serves the control API of a running session on a unix socket, for clients
+// like devcli attach
+type controlServer struct {
+	registry   *statusRegistry
+	supervisor *supervisor
+	output     *outputBroadcast
+	// stop ends the session
+	stop context.CancelFunc
+}
+
+// handler returns the routes of the control API
+func (c *controlServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(c.registry.snapshot())
+	})
+	mux.HandleFunc("GET /v1/api-calls", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(apiCalls.rates(time.Now()))
+	})
+	mux.HandleFunc("GET /v1/logs", c.streamLogs)
+	mux.HandleFunc("POST /v1/tunnels/{name}/restart", c.tunnelAction(c.supervisor.restartTunnel))
+	mux.HandleFunc("POST /v1/tunnels/restart-failed", func(w http.ResponseWriter, r *http.Request) {
+		restarted := c.supervisor.restartFailed()
+		if restarted == nil {
+			restarted = []string{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(restarted)
+	})
+	mux.HandleFunc("POST /v1/tunnels/{name}/pause", c.tunnelAction(c.supervisor.pauseTunnel))
+	mux.HandleFunc("POST /v1/tunnels/{name}/resume", c.tunnelAction(c.supervisor.resumeTunnel))
+	mux.HandleFunc("POST /v1/stop", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Println("Stop requested through the control API. Exiting gracefully...")
+		c.stop()
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return mux
+}
+
+// tunnelAction returns the handler applying the action to the tunnel of the path
+func (c *controlServer) tunnelAction(action func(name string) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := action(r.PathValue("name"))
+		if errors.Is(err, ErrUnknownTunnel) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// streamLogs writes the recent output of the session followed by every new line, until
+// the client goes away or the session ends
+func (c *controlServer) streamLogs(w http.ResponseWriter, r *http.Request) {
+	history, lines, unsubscribe := c.output.subscribe()
+	defer unsubscribe()
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	flusher, _ := w.(http.Flusher)
+	for _, line := range history {
+		fmt.Fprintln(w, line)
+	}
+	for {
+		if flusher != nil {
+			flusher.Flush()
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case line := <-lines:
+			fmt.Fprintln(w, line)
+		}
+	}
+}
+
+// startControl serves the control API of the environment's session in the background until
+// the context is canceled. devcli attach gets everything the logger writes from then on, the
+// session's output must be serialized for it to get the output printed with fmt as well.
+func startControl(ctx context.Context, stop context.CancelFunc, environment string, registry *statusRegistry, supervisor *supervisor) {
+	socket, err := sessionSocket(environment)
+	if err != nil {
+		fmt.Println("Warning: devcli attach is not available:", err)
+		return
+	}
+	listener, err := listenControl(socket)
+	if err != nil {
+		fmt.Println("Warning: devcli attach is not available:", err)
+		return
+	}
+	output := newOutputBroadcast()
+	logger.copyTo(output)
+	control := &controlServer{registry: registry, supervisor: supervisor, output: output, stop: stop}
+	go func() {
+		if err := control.serve(ctx, listener); err != nil {
+			fmt.Println("Error serving the control API:", err)
+		}
+	}()
+
+	grpcSocket, err := sessionGRPCSocket(environment)
+	if err == nil {
+		listener, err = listenControl(grpcSocket)
+	}
+	if err != nil {
+		fmt.Println("Warning: the gRPC control API is not available:", err)
+		return
+	}
+	go func() {
+		if err := control.serveGRPC(ctx, listener); err != nil {
+			fmt.Println("Error serving the gRPC control API:", err)
+		}
+	}()
+}
+
+// serve answers requests on the listener until the context is canceled
+func (c *controlServer) serve(ctx context.Context, listener net.Listener) error {
+	server := &http.Server{Handler: c.handler(), BaseContext: func(net.Listener) context.Context { return ctx }}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// listenControl listens on the socket, replacing the socket of a session that is gone
+func listenControl(socket string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(socket), 0700); err != nil {
+		return nil, err
+	}
+	if conn, err := net.DialTimeout("unix", socket, time.Second); err == nil {
+		conn.Close()
+		return nil, ErrSessionRunning
+	}
+	os.Remove(socket)
+	return net.Listen("unix", socket)
+}
+
+// sessionDir is where running sessions keep their control sockets and logs
+func sessionDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, ".devcli", "sessions"), nil
+}
+
+// sessionSocket is the path of the control socket of the environment's session
+func sessionSocket(environment string) (string, error) {
+	dir, err := sessionDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, environment+".sock"), nil
+}
+
+// runningSessions returns the environments that have a control socket
+func runningSessions() ([]string, error) {
+	dir, err := sessionDir()
+	if err != nil {
+		return nil, err
+	}
+	sockets, err := filepath.Glob(filepath.Join(dir, "*.sock"))
+	if err != nil {
+		return nil, err
+	}
+	var environments []string
+	for _, socket := range sockets {
+		environments = append(environments, strings.TrimSuffix(filepath.Base(socket), ".sock"))
+	}
+	return environments, nil
+}
+
+// controlClient calls the control API of a session
+type controlClient struct {
+	http *http.Client
+}
+
+func newControlClient(socket string) *controlClient {
+	return &controlClient{http: &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}}}
+}
+
+func (c *controlClient) do(ctx context.Context, method, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, "http://devcli"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		body := make([]byte, 512)
+		n, _ := resp.Body.Read(body)
+		return nil, fmt.Errorf("%s %s: %s", method, path, strings.TrimSpace(string(body[:n])))
+	}
+	return resp, nil
+}
+
+// status returns the status of every tunnel of the session
+func (c *controlClient) status(ctx context.Context) ([]tunnelStatus, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/v1/status")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var statuses []tunnelStatus
+	if err := json.NewDecoder(resp.Body).Decode(&statuses); err != nil {
+		return nil, err
+	}
+	return statuses, nil
+}
+
+// apiCalls returns the calls of the session to the Google APIs within the last minute
+func (c *controlClient) apiCalls(ctx context.Context) ([]apiCallRate, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/v1/api-calls")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var rates []apiCallRate
+	if err := json.NewDecoder(resp.Body).Decode(&rates); err != nil {
+		return nil, err
+	}
+	return rates, nil
+}
+
+// logs streams the output of the session, the caller closes the body
+func (c *controlClient) logs(ctx context.Context) (*http.Response, error) {
+	return c.do(ctx, http.MethodGet, "/v1/logs")
+}
+
+// restart restarts one tunnel of the session
+func (c *controlClient) restart(ctx context.Context, name string) error {
+	return c.tunnelAction(ctx, name, "restart")
+}
+
+// restartFailed restarts every failed tunnel of the session and returns their names
+func (c *controlClient) restartFailed(ctx context.Context) ([]string, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/v1/tunnels/restart-failed")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var restarted []string
+	if err := json.NewDecoder(resp.Body).Decode(&restarted); err != nil {
+		return nil, err
+	}
+	return restarted, nil
+}
+
+// pause stops the child process of one tunnel of the session until it is resumed
+func (c *controlClient) pause(ctx context.Context, name string) error {
+	return c.tunnelAction(ctx, name, "pause")
+}
+
+// resume starts a paused tunnel of the session again
+func (c *controlClient) resume(ctx context.Context, name string) error {
+	return c.tunnelAction(ctx, name, "resume")
+}
+
+func (c *controlClient) tunnelAction(ctx context.Context, name, action string) error {
+	resp, err := c.do(ctx, http.MethodPost, "/v1/tunnels/"+url.PathEscape(name)+"/"+action)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// stop ends the session
+func (c *controlClient) stop(ctx context.Context) error {
+	resp, err := c.do(ctx, http.MethodPost, "/v1/stop")
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
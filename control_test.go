@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startTestControl serves the control API of a session with one idle tunnel
+func startTestControl(t *testing.T) (*controlClient, *outputBroadcast, context.Context) {
+	dir, err := os.MkdirTemp("", "devcli")
+	if err != nil {
+		t.Fatalf("Error creating the session directory: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "staging.sock")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	registry := newStatusRegistry()
+	registry.register("cashfree", kindWorkload, 8080, "http")
+	supervisor := newSupervisor(ctx, registry, true)
+	supervisor.supervise("cashfree", func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	})
+	t.Cleanup(func() {
+		cancel()
+		supervisor.wait()
+	})
+
+	listener, err := listenControl(socket)
+	if err != nil {
+		t.Fatalf("listenControl failed: %v", err)
+	}
+	if _, err := listenControl(socket); !errors.Is(err, ErrSessionRunning) {
+		t.Errorf("listenControl failed: expected %v for a second session, got %v", ErrSessionRunning, err)
+	}
+	output := newOutputBroadcast()
+	control := &controlServer{registry: registry, supervisor: supervisor, output: output, stop: cancel}
+	go control.serve(ctx, listener)
+	return newControlClient(socket), output, ctx
+}
+
+func TestControlAPI(t *testing.T) {
+	client, _, ctx := startTestControl(t)
+
+	if err := client.restart(ctx, "cashfree"); err != nil {
+		t.Errorf("restart failed: %v", err)
+	}
+	if err := client.restart(ctx, "payments"); err == nil || !strings.Contains(err.Error(), "unknown tunnel payments") {
+		t.Errorf("restart failed: expected an unknown tunnel error, got %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	statuses, err := client.status(ctx)
+	if err != nil {
+		t.Fatalf("status failed: %v", err)
+	}
+	if len(statuses) != 1 || statuses[0].Name != "cashfree" || statuses[0].State != stateRunning || statuses[0].Restarts != 1 {
+		t.Errorf("status failed: unexpected statuses %+v", statuses)
+	}
+
+	if restarted, err := client.restartFailed(ctx); err != nil || len(restarted) != 0 {
+		t.Errorf("restartFailed failed: expected no failed tunnel, got %v, %v", restarted, err)
+	}
+
+	if err := client.pause(ctx, "cashfree"); err != nil {
+		t.Errorf("pause failed: %v", err)
+	}
+	if err := client.pause(ctx, "cashfree"); err == nil || !strings.Contains(err.Error(), "already paused") {
+		t.Errorf("pause failed: expected a conflict pausing a paused tunnel, got %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if statuses, err := client.status(ctx); err != nil || statuses[0].State != statePaused {
+		t.Errorf("pause failed: expected a paused tunnel, got %+v, %v", statuses, err)
+	}
+	if err := client.resume(ctx, "cashfree"); err != nil {
+		t.Errorf("resume failed: %v", err)
+	}
+
+	if err := client.stop(context.Background()); err != nil {
+		t.Errorf("stop failed: %v", err)
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Error("stop failed: the session was not stopped")
+	}
+}
+
+func TestControlLogs(t *testing.T) {
+	client, output, ctx := startTestControl(t)
+	output.Write([]byte("Initialization complete.\n[cashfree] Forwarding from 127.0.0.1:8080 -> 8080\n"))
+
+	logs, err := client.logs(ctx)
+	if err != nil {
+		t.Fatalf("logs failed: %v", err)
+	}
+	defer logs.Body.Close()
+	output.Write([]byte("Health of app cashfree "))
+	output.Write([]byte("changed from unknown to serving\n"))
+
+	reader := bufio.NewReader(logs.Body)
+	expected := []string{
+		"Initialization complete.",
+		"[cashfree] Forwarding from 127.0.0.1:8080 -> 8080",
+		"Health of app cashfree changed from unknown to serving",
+	}
+	for _, line := range expected {
+		read, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("logs failed: %v", err)
+		}
+		if strings.TrimSuffix(read, "\n") != line {
+			t.Errorf("logs failed: expected %q, got %q", line, read)
+		}
+	}
+}
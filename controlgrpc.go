@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	controlv1 "github.com/okcredit/devcli/proto/devcli/control/v1"
+)
+
+//go:generate protoc -I proto --go_out=proto --go_opt=paths=source_relative --go-grpc_out=proto --go-grpc_opt=paths=source_relative devcli/control/v1/control.proto
+
+// The gRPC control API serves the session of the REST one to clients like the desktop tray
+// app, which stream tunnel changes with WatchTunnels instead of polling /v1/status. Its
+// messages and service are generated from proto/devcli/control/v1/control.proto.
+
+// sessionGRPCSocket is the path of the gRPC control socket of the environment's session.
+// It does not end in .sock so that runningSessions does not list it as a session.
+func sessionGRPCSocket(environment string) (string, error) {
+	dir, err := sessionDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, environment+".grpc"), nil
+}
+
+// serveGRPC answers gRPC calls on the listener until the context is canceled
+func (c *controlServer) serveGRPC(ctx context.Context, listener net.Listener) error {
+	server := grpc.NewServer()
+	controlv1.RegisterControlServer(server, &controlService{control: c})
+	go func() {
+		<-ctx.Done()
+		server.Stop()
+	}()
+	return server.Serve(listener)
+}
+
+// controlService implements the Control service with the session's registry and supervisor
+type controlService struct {
+	controlv1.UnimplementedControlServer
+	control *controlServer
+}
+
+func (s *controlService) ListTunnels(ctx context.Context, _ *controlv1.ListTunnelsRequest) (*controlv1.ListTunnelsResponse, error) {
+	resp := &controlv1.ListTunnelsResponse{}
+	for _, tunnel := range s.control.registry.snapshot() {
+		resp.Tunnels = append(resp.Tunnels, tunnelProto(tunnel))
+	}
+	return resp, nil
+}
+
+func (s *controlService) StartTunnel(ctx context.Context, req *controlv1.TunnelRequest) (*controlv1.Tunnel, error) {
+	return s.tunnelAction(s.control.supervisor.resumeTunnel, req.GetName())
+}
+
+func (s *controlService) StopTunnel(ctx context.Context, req *controlv1.TunnelRequest) (*controlv1.Tunnel, error) {
+	return s.tunnelAction(s.control.supervisor.pauseTunnel, req.GetName())
+}
+
+func (s *controlService) RestartTunnel(ctx context.Context, req *controlv1.TunnelRequest) (*controlv1.Tunnel, error) {
+	return s.tunnelAction(s.control.supervisor.restartTunnel, req.GetName())
+}
+
+// tunnelAction applies the supervisor's action to the tunnel and returns its status, with
+// the same errors as the REST API: NotFound for an unknown tunnel and FailedPrecondition for
+// a tunnel in the wrong state
+func (s *controlService) tunnelAction(action func(name string) error, name string) (*controlv1.Tunnel, error) {
+	err := action(name)
+	if errors.Is(err, ErrUnknownTunnel) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	} else if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	for _, tunnel := range s.control.registry.snapshot() {
+		if tunnel.Name == name {
+			return tunnelProto(tunnel), nil
+		}
+	}
+	return nil, status.Errorf(codes.NotFound, "%v %s", ErrUnknownTunnel, name)
+}
+
+// WatchTunnels sends the status of every tunnel, then the latest status of the tunnels that
+// changed until the client goes away or the session ends
+func (s *controlService) WatchTunnels(_ *controlv1.WatchTunnelsRequest, stream grpc.ServerStreamingServer[controlv1.TunnelEvent]) error {
+	statuses, watcher, unwatch := s.control.registry.watch()
+	defer unwatch()
+	for _, tunnel := range statuses {
+		if err := stream.Send(&controlv1.TunnelEvent{Tunnel: tunnelProto(tunnel), Initial: true}); err != nil {
+			return err
+		}
+	}
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-watcher.changed():
+			for _, tunnel := range watcher.take() {
+				if err := stream.Send(&controlv1.TunnelEvent{Tunnel: tunnelProto(tunnel)}); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// tunnelProto returns the Tunnel message of the status
+func tunnelProto(tunnel tunnelStatus) *controlv1.Tunnel {
+	message := &controlv1.Tunnel{
+		Name:      tunnel.Name,
+		Kind:      tunnel.Kind,
+		LocalPort: int32(tunnel.LocalPort),
+		Protocol:  tunnel.Protocol,
+		State:     tunnel.State,
+		Restarts:  int32(tunnel.Restarts),
+		Health:    tunnel.Health,
+		Liveness:  tunnel.Liveness,
+		LastError: tunnel.LastError,
+	}
+	if !tunnel.UpdatedAt.IsZero() {
+		message.UpdatedAt = timestamppb.New(tunnel.UpdatedAt)
+	}
+	duration := func(d time.Duration) *durationpb.Duration {
+		if d == 0 {
+			return nil
+		}
+		return durationpb.New(d)
+	}
+	message.ConnectP50, message.ConnectP95 = duration(tunnel.ConnectP50), duration(tunnel.ConnectP95)
+	message.RttP50, message.RttP95 = duration(tunnel.RTTP50), duration(tunnel.RTTP95)
+	return message
+}
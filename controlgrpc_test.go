@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	controlv1 "github.com/okcredit/devcli/proto/devcli/control/v1"
+)
+
+func TestTunnelProto(t *testing.T) {
+	tunnel := tunnelStatus{
+		Name: "cashfree", Kind: kindWorkload, LocalPort: 8080, Protocol: "http", State: stateBackoff, Restarts: 2,
+		Health: healthServing, Liveness: livenessAlive, LastError: "connection refused",
+		ConnectP50: 1500 * time.Microsecond, RTTP95: 2*time.Second + 5*time.Millisecond,
+		UpdatedAt: time.Date(2024, 3, 1, 10, 0, 0, 42, time.UTC),
+	}
+	message := tunnelProto(tunnel)
+	if message.GetName() != "cashfree" || message.GetLocalPort() != 8080 || message.GetState() != stateBackoff || message.GetRestarts() != 2 || message.GetLastError() != "connection refused" {
+		t.Errorf("tunnelProto failed: unexpected message %v", message)
+	}
+	if !message.GetUpdatedAt().AsTime().Equal(tunnel.UpdatedAt) || message.GetConnectP50().AsDuration() != tunnel.ConnectP50 || message.GetRttP95().AsDuration() != tunnel.RTTP95 {
+		t.Errorf("tunnelProto failed: unexpected times %v", message)
+	}
+	// proto3 leaves unset durations out rather than sending zero
+	if message.ConnectP95 != nil || message.RttP50 != nil {
+		t.Errorf("tunnelProto failed: expected no unmeasured percentiles, got %v", message)
+	}
+}
+
+func TestControlGRPC(t *testing.T) {
+	dir, err := os.MkdirTemp("", "devcli")
+	if err != nil {
+		t.Fatalf("Error creating the session directory: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "staging.grpc")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	registry := newStatusRegistry()
+	registry.register("cashfree", kindWorkload, 8080, "http")
+	supervisor := newSupervisor(ctx, registry, true)
+	supervisor.supervise("cashfree", func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	})
+	t.Cleanup(func() {
+		cancel()
+		supervisor.wait()
+	})
+	listener, err := listenControl(socket)
+	if err != nil {
+		t.Fatalf("listenControl failed: %v", err)
+	}
+	control := &controlServer{registry: registry, supervisor: supervisor, output: newOutputBroadcast(), stop: cancel}
+	go control.serveGRPC(ctx, listener)
+
+	conn, err := grpc.NewClient("unix://"+socket, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Error connecting to the gRPC control API: %v", err)
+	}
+	defer conn.Close()
+	client := controlv1.NewControlClient(conn)
+
+	time.Sleep(50 * time.Millisecond)
+	list, err := client.ListTunnels(ctx, &controlv1.ListTunnelsRequest{})
+	if err != nil {
+		t.Fatalf("ListTunnels failed: %v", err)
+	}
+	if tunnels := list.GetTunnels(); len(tunnels) != 1 || tunnels[0].GetName() != "cashfree" || tunnels[0].GetState() != stateRunning {
+		t.Errorf("ListTunnels failed: unexpected tunnels %v", tunnels)
+	}
+
+	stream, err := client.WatchTunnels(ctx, &controlv1.WatchTunnelsRequest{})
+	if err != nil {
+		t.Fatalf("WatchTunnels failed: %v", err)
+	}
+	event, err := stream.Recv()
+	if err != nil || !event.GetInitial() || event.GetTunnel().GetState() != stateRunning {
+		t.Fatalf("WatchTunnels failed: expected the initial running status, got %v, %v", event, err)
+	}
+
+	if _, err := client.StopTunnel(ctx, &controlv1.TunnelRequest{Name: "cashfree"}); err != nil {
+		t.Errorf("StopTunnel failed: %v", err)
+	}
+	if event, err := stream.Recv(); err != nil || event.GetInitial() || event.GetTunnel().GetState() != statePaused {
+		t.Errorf("WatchTunnels failed: expected the paused status, got %v, %v", event, err)
+	}
+	if _, err := client.StopTunnel(ctx, &controlv1.TunnelRequest{Name: "cashfree"}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("StopTunnel failed: expected FailedPrecondition for a paused tunnel, got %v", err)
+	}
+	if _, err := client.StartTunnel(ctx, &controlv1.TunnelRequest{Name: "payments"}); status.Code(err) != codes.NotFound {
+		t.Errorf("StartTunnel failed: expected NotFound for an unknown tunnel, got %v", err)
+	}
+	if tunnel, err := client.StartTunnel(ctx, &controlv1.TunnelRequest{Name: "cashfree"}); err != nil || tunnel.GetName() != "cashfree" {
+		t.Errorf("StartTunnel failed: %v, %v", tunnel, err)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// daemonStartTimeout is how long devcli daemon waits for the session to initialize
+const daemonStartTimeout = 5 * time.Minute
+
+// runDaemon starts a session in the background, detached from the terminal, with its
+// output written to a log file in the session directory
+func runDaemon(args []string) {
+	var opts options
+	fs := flag.NewFlagSet("devcli daemon", flag.ExitOnError)
+	startFlags(fs, &opts)
+	parseStartArgs(fs, &opts, args)
+
+	environment := configEnvironment(opts)
+	if environment == "" {
+		fmt.Println("Error: environment is not set in the configuration file or passed as a command line argument.")
+		os.Exit(1)
+	}
+	socket, err := sessionSocket(environment)
+	if err != nil {
+		fmt.Println("Error getting the session directory:", err)
+		os.Exit(1)
+	}
+	if conn, err := net.DialTimeout("unix", socket, time.Second); err == nil {
+		conn.Close()
+		fmt.Printf("Error: a session of environment %s is already running, use devcli attach -env %s\n", environment, environment)
+		os.Exit(1)
+	}
+	if err := os.MkdirAll(filepath.Dir(socket), 0700); err != nil {
+		fmt.Println("Error creating the session directory:", err)
+		os.Exit(1)
+	}
+	logPath := filepath.Join(filepath.Dir(socket), environment+".log")
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		fmt.Println("Error opening the session log:", err)
+		os.Exit(1)
+	}
+	defer logFile.Close()
+
+	executable, err := os.Executable()
+	if err != nil {
+		fmt.Println("Error finding the devcli executable:", err)
+		os.Exit(1)
+	}
+	cmd := exec.Command(executable, append([]string{"start", "-env", environment}, args...)...)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	detach(cmd)
+	if err := cmd.Start(); err != nil {
+		fmt.Println("Error starting the session:", err)
+		os.Exit(1)
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	fmt.Printf("Starting the %s session in the background (pid %d), logging to %s\n", environment, cmd.Process.Pid, logPath)
+	deadline := time.After(daemonStartTimeout)
+	for {
+		select {
+		case err := <-exited:
+			fmt.Printf("Error: the session exited during initialization (%v), see %s\n", err, logPath)
+			os.Exit(1)
+		case <-deadline:
+			fmt.Printf("Error: the session did not finish initializing within %s, see %s\n", daemonStartTimeout, logPath)
+			os.Exit(1)
+		case <-time.After(200 * time.Millisecond):
+		}
+		if conn, err := net.DialTimeout("unix", socket, time.Second); err == nil {
+			conn.Close()
+			break
+		}
+	}
+	fmt.Printf("Session started. Run devcli attach -env %s to follow it.\n", environment)
+}
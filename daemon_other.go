@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+import "os/exec"
+
+// detach does nothing, sessions cannot be detached from the terminal on this platform
+func detach(cmd *exec.Cmd) {}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// direnvMarker starts the snippet devcli direnv setup adds to .envrc, so that it is only
+// added once
+const direnvMarker = "# devcli: tunnel endpoints of the running session"
+
+// direnvEnvFile is the env file a session of the environment keeps up to date for direnv,
+// relative to the home directory
+func direnvEnvFile(environment string) string {
+	return filepath.Join(".devcli", "env", environment+".env")
+}
+
+// direnvSnippet is the .envrc snippet loading the env file of the environment's session
+// while it runs. direnv reloads it when the session writes or removes the file.
+func direnvSnippet(environment string) string {
+	path := `"$HOME/` + filepath.ToSlash(direnvEnvFile(environment)) + `"`
+	return direnvMarker + "\nwatch_file " + path + "\ndotenv_if_exists " + path + "\n"
+}
+
+// runDirenv implements devcli direnv setup, which adds the snippet loading the session's
+// variables to the .envrc of a directory
+func runDirenv(args []string) {
+	usage := func() {
+		fmt.Println("Usage: devcli direnv setup [-env <environment>] [-dir <directory>]")
+	}
+	if len(args) == 0 || args[0] != "setup" {
+		usage()
+		os.Exit(2)
+	}
+	var opts options
+	fs := flag.NewFlagSet("devcli direnv setup", flag.ExitOnError)
+	fs.StringVar(&opts.confFile, "conf", "", "Path to the configuration file")
+	fs.StringVar(&opts.environment, "env", "", "Environment whose session the directory uses")
+	dir := fs.String("dir", ".", "Directory of the .envrc")
+	fs.Parse(args[1:])
+	environment := configEnvironment(opts)
+	if environment == "" {
+		fmt.Println("Error: environment is not set in the configuration file or passed as a command line argument.")
+		os.Exit(1)
+	}
+
+	envrc := filepath.Join(*dir, ".envrc")
+	added, err := addDirenvSnippet(envrc, environment)
+	if err != nil {
+		fmt.Println("Error updating", envrc+":", err)
+		os.Exit(1)
+	}
+	if !added {
+		fmt.Printf("%s already loads the variables of a devcli session.\n", envrc)
+		return
+	}
+	fmt.Printf("Added the variables of the %s session to %s.\n", environment, envrc)
+	fmt.Println("Hint: run direnv allow in", *dir, "to load them.")
+}
+
+// addDirenvSnippet appends the snippet of the environment to the .envrc, false when it has
+// a devcli snippet already
+func addDirenvSnippet(envrc, environment string) (bool, error) {
+	data, err := os.ReadFile(envrc)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	if bytes.Contains(data, []byte(direnvMarker)) {
+		return false, nil
+	}
+	if len(data) > 0 && !bytes.HasSuffix(data, []byte("\n")) {
+		data = append(data, '\n')
+	}
+	if len(data) > 0 {
+		data = append(data, '\n')
+	}
+	data = append(data, direnvSnippet(environment)...)
+	return true, os.WriteFile(envrc, data, 0o644)
+}
+
+// writeDirenvEnv writes the variables of the running session to the env file direnv loads,
+// replacing it at once so that direnv never reads half of it
+func writeDirenvEnv(homeDir, environment string, env []string) error {
+	path := filepath.Join(homeDir, direnvEnvFile(environment))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	var b strings.Builder
+	writeEnv(&b, env, false)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(b.String()), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// removeDirenvEnv removes the env file of the environment once its session ended, which
+// makes direnv unload its variables
+func removeDirenvEnv(homeDir, environment string) {
+	os.Remove(filepath.Join(homeDir, direnvEnvFile(environment)))
+}
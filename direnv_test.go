@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAddDirenvSnippet(t *testing.T) {
+	envrc := filepath.Join(t.TempDir(), ".envrc")
+	if err := os.WriteFile(envrc, []byte("export GOFLAGS=-mod=mod"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	added, err := addDirenvSnippet(envrc, "staging")
+	if err != nil || !added {
+		t.Fatalf("addDirenvSnippet failed: expected the snippet to be added, got %v", err)
+	}
+	data, _ := os.ReadFile(envrc)
+	expected := "export GOFLAGS=-mod=mod\n\n" + direnvMarker + "\n" +
+		`watch_file "$HOME/.devcli/env/staging.env"` + "\n" + `dotenv_if_exists "$HOME/.devcli/env/staging.env"` + "\n"
+	if string(data) != expected {
+		t.Errorf("addDirenvSnippet failed: expected\n%s\ngot\n%s", expected, data)
+	}
+	if added, err := addDirenvSnippet(envrc, "prod"); err != nil || added {
+		t.Errorf("addDirenvSnippet failed: expected the snippet to be added once, got %v, %v", added, err)
+	}
+}
+
+func TestWriteDirenvEnv(t *testing.T) {
+	home := t.TempDir()
+	if err := writeDirenvEnv(home, "staging", []string{"DEVCLI_ENV=staging", "DEVCLI_PAYMENTS_PORT=15001"}); err != nil {
+		t.Fatalf("writeDirenvEnv failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(home, ".devcli", "env", "staging.env"))
+	if err != nil || !strings.Contains(string(data), "DEVCLI_PAYMENTS_PORT=15001\n") {
+		t.Errorf("writeDirenvEnv failed: unexpected env file %q, %v", data, err)
+	}
+	removeDirenvEnv(home, "staging")
+	if _, err := os.Stat(filepath.Join(home, ".devcli", "env", "staging.env")); !os.IsNotExist(err) {
+		t.Errorf("removeDirenvEnv failed: expected the env file to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// healthUnresolved is the health of a bastion connection whose remote_host does not resolve
+// on the bastion
+const healthUnresolved = "unresolved"
+
+// resolvableHost matches the host names the resolution check passes to the bastion's shell
+var resolvableHost = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// remoteHostNames returns the connections of the project whose remote_host is a host name
+// rather than an address, by host name
+func remoteHostNames(config ProxyConfig, project string) map[string][]Connection {
+	hosts := make(map[string][]Connection)
+	for _, connection := range config.Bastion.Connections {
+		if connection.Project != project || connection.RemoteHost == "" || net.ParseIP(connection.RemoteHost) != nil {
+			continue
+		}
+		if resolvableHost.MatchString(connection.RemoteHost) {
+			hosts[connection.RemoteHost] = append(hosts[connection.RemoteHost], connection)
+		}
+	}
+	return hosts
+}
+
+// connectionProjectSet returns the projects of the bastion connections, the environment's
+// being the empty one, in the order of the connections
+func connectionProjectSet(config ProxyConfig) []string {
+	projects := []string{""}
+	for _, connection := range config.Bastion.Connections {
+		if !slices.Contains(projects, connection.Project) {
+			projects = append(projects, connection.Project)
+		}
+	}
+	return projects
+}
+
+// resolveScript is the shell command run on the bastion printing whether every host resolves,
+// a line per host
+func resolveScript(hosts []string) string {
+	return fmt.Sprintf(`for host in %s; do if getent hosts "$host" >/dev/null; then echo "resolved $host"; else echo "unresolved $host"; fi; done`,
+		strings.Join(hosts, " "))
+}
+
+// resolveCommand returns the program and arguments running the resolution check of the hosts
+// on the bastion
+func resolveCommand(bastion Bastion, project string, hosts []string) (string, []string) {
+	return bastionSSH(bastion, project, resolveScript(hosts), "-o", fmt.Sprintf("ConnectTimeout=%d", bastionConnectTimeout))
+}
+
+// unresolvedHosts returns the hosts the output of resolveScript reports as unresolved
+func unresolvedHosts(out string) []string {
+	var hosts []string
+	for _, line := range strings.Split(out, "\n") {
+		if host, ok := strings.CutPrefix(strings.TrimSpace(line), "unresolved "); ok {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// checkRemoteHosts resolves the remote_host names of the bastion connections on the bastion,
+// once per project, so that a typo in an internal host name is reported as such instead of
+// as a connection refused later. The connections of the hosts that do not resolve are
+// flagged in the status.
+func checkRemoteHosts(ctx context.Context, runner *commandRunner, config ProxyConfig, zones *zoneResolver, registry *statusRegistry) {
+	for _, project := range connectionProjectSet(config) {
+		hosts := remoteHostNames(config, project)
+		if len(hosts) == 0 {
+			continue
+		}
+		names := slices.Sorted(maps.Keys(hosts))
+		bastion := config.Bastion
+		bastion.Zone = zones.zone(project)
+		name, args := resolveCommand(bastion, project, names)
+		cmd := exec.CommandContext(ctx, name, args...)
+		cmd.Stderr = logger.Writer(bastion.Name)
+		out, err := runner.output(ctx, cmd)
+		if err != nil {
+			if ctx.Err() == nil {
+				narrate("Checking the remote hosts on the bastion failed:", err)
+			}
+			continue
+		}
+		for _, host := range unresolvedHosts(string(out)) {
+			for _, connection := range hosts[host] {
+				fmt.Printf("Warning: remote host %s of connection %s does not resolve on bastion %s, check it for typos.\n", host, connection.Name(), bastion.Name)
+				registry.setHealth(connection.Name(), healthUnresolved, fmt.Errorf("remote host %s does not resolve on the bastion", host))
+			}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRemoteHostNames(t *testing.T) {
+	config := ProxyConfig{Bastion: Bastion{Connections: []Connection{
+		{LocalPort: 5432, RemoteHost: "postgres.internal", RemotePort: 5432},
+		{LocalPort: 5433, RemoteHost: "10.120.52.48", RemotePort: 5432},
+		{LocalPort: 6379, RemoteHost: "redis.internal", RemotePort: 6379, Project: "okcredit-shared"},
+		{LocalPort: 6380, RemoteHost: "redis.internal; reboot", RemotePort: 6379},
+	}}}
+	hosts := remoteHostNames(config, "")
+	if len(hosts) != 1 || len(hosts["postgres.internal"]) != 1 {
+		t.Errorf("remoteHostNames failed: expected only postgres.internal, got %v", hosts)
+	}
+	if projects := connectionProjectSet(config); !slices.Equal(projects, []string{"", "okcredit-shared"}) {
+		t.Errorf("connectionProjectSet failed: unexpected projects %q", projects)
+	}
+	if hosts := unresolvedHosts("resolved postgres.internal\nunresolved postgress.internal\n"); !slices.Equal(hosts, []string{"postgress.internal"}) {
+		t.Errorf("unresolvedHosts failed: unexpected hosts %v", hosts)
+	}
+	name, args := resolveCommand(Bastion{Name: "bastion", Zone: "asia-south1-a"}, "okcredit-shared", []string{"redis.internal"})
+	if args := strings.Join(args, " "); name != "gcloud" || !strings.HasPrefix(args, "compute ssh bastion --zone asia-south1-a --project okcredit-shared --command for host in redis.internal;") {
+		t.Errorf("resolveCommand failed: unexpected command %s %s", name, args)
+	}
+}
+
+func TestCheckRemoteHosts(t *testing.T) {
+	dir := t.TempDir()
+	gcloud := `#!/bin/sh
+while [ $# -gt 0 ]; do
+	if [ "$1" = "--command" ]; then exec sh -c "$2"; fi
+	shift
+done
+exit 1
+`
+	getent := `#!/bin/sh
+[ "$2" = "postgres.internal" ]
+`
+	for name, script := range map[string]string{"gcloud": gcloud, "getent": getent} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0755); err != nil {
+			t.Fatalf("Error writing the fake %s: %v", name, err)
+		}
+	}
+	t.Setenv("PATH", dir+string(filepath.ListSeparator)+os.Getenv("PATH"))
+
+	config := ProxyConfig{Bastion: Bastion{Name: "bastion", Connections: []Connection{
+		{LocalPort: 5432, RemoteHost: "postgres.internal", RemotePort: 5432},
+		{LocalPort: 5433, RemoteHost: "postgress.internal", RemotePort: 5432},
+	}}}
+	registry := newStatusRegistry()
+	for _, connection := range config.Bastion.Connections {
+		registry.register(connection.Name(), kindBastion, connection.LocalPort, "")
+	}
+	zones := newZoneResolver("bastion", "asia-south1-a", nil, nil)
+	checkRemoteHosts(context.Background(), newCommandRunner(2, 0).withTimeout(time.Minute, 0), config, zones, registry)
+	statuses := registry.snapshot()
+	if statuses[0].Health == healthUnresolved {
+		t.Errorf("checkRemoteHosts failed: expected the resolved host not to be flagged, got %+v", statuses[0])
+	}
+	if statuses[1].Health != healthUnresolved || !strings.Contains(statuses[1].LastError, "does not resolve") {
+		t.Errorf("checkRemoteHosts failed: expected the typo to be flagged, got %+v", statuses[1])
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+)
+
+// containerHome is the home directory of the user of the devcli image
+const containerHome = "/root"
+
+// runDocker runs the session in a container of the devcli image, which bundles the
+// gcloud and kubectl versions pinned in the Dockerfile, and publishes the local ports of
+// the environment's tunnels to the host
+func runDocker(opts options, args []string) {
+	if !checkDocker(context.Background()) {
+		fmt.Println("Error: docker is not installed or not in the system's PATH.")
+		os.Exit(1)
+	}
+	confFile, err := configPath(opts.confFile)
+	if err != nil {
+		fmt.Println("Error getting user home directory:", err)
+		os.Exit(1)
+	}
+	config, err := readConfig(confFile)
+	if err != nil {
+		fmt.Println("Error reading configuration file:", err)
+		os.Exit(1)
+	}
+	if err := selectEnvironment(&config, opts); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if err := chooseEnvironment(&config); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		fmt.Println("Error getting user home directory:", err)
+		os.Exit(1)
+	}
+	dockerArgs, err := dockerRunArgs(opts, config, confFile, homeDir, args, isTerminal(os.Stdin))
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Running the %s session in a container of image %s\n", config.Environment, opts.dockerImage)
+	cmd := exec.Command("docker", dockerArgs...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		fmt.Println("Error starting the container:", err)
+		os.Exit(1)
+	}
+	// docker forwards the signals to the session in the container, which exits gracefully
+	ch := make(chan os.Signal, 2)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		for sig := range ch {
+			cmd.Process.Signal(sig)
+		}
+	}()
+	if err := cmd.Wait(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.ExitCode())
+		}
+		fmt.Println("Error running the container:", err)
+		os.Exit(1)
+	}
+}
+
+func checkDocker(ctx context.Context) bool {
+	ctx, cancel := context.WithTimeout(ctx, localCommandTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "docker", "version")
+	if err := cmd.Run(); err != nil {
+		return false
+	}
+	return true
+}
+
+// dockerRunArgs returns the docker run command line of the session. The session's prompts
+// need a terminal, allocated when the user runs devcli from one.
+func dockerRunArgs(opts options, config Config, confFile, homeDir string, args []string, terminal bool) ([]string, error) {
+	proxyConfig, err := findProxyConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	proxyConfig, err = applyProfile(config, proxyConfig, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	dockerArgs := []string{"run", "--rm", "-i", "--name", serviceName(config.Environment)}
+	if terminal {
+		dockerArgs = append(dockerArgs, "-t")
+	}
+	for _, volume := range dockerVolumes(config, confFile, homeDir) {
+		dockerArgs = append(dockerArgs, "-v", volume)
+	}
+
+	hostAddress := opts.bindAddress
+	if hostAddress == "" || hostAddress == "localhost" {
+		hostAddress = "127.0.0.1"
+	}
+	publish := func(port int) {
+		dockerArgs = append(dockerArgs, "-p", fmt.Sprintf("%s:%d:%d", hostAddress, port, port))
+	}
+	for _, workload := range proxyConfig.Workloads {
+		publish(workload.LocalPort)
+	}
+	for _, connection := range proxyConfig.Bastion.Connections {
+		publish(connection.LocalPort)
+	}
+
+	dockerArgs = append(dockerArgs, opts.dockerImage)
+	dockerArgs = append(dockerArgs, containerCommand(config.Environment, confFile)...)
+	return append(dockerArgs, withoutFlags(args, "docker", "docker-image", "conf", "env", "bind-address")...), nil
+}
+
+// dockerVolumes returns the volumes of the devcli container: the configuration file at the
+// same path, along with the gcloud and kubectl configurations and the ssh keys of gcloud
+// compute ssh, so that the container uses the user's credentials
+func dockerVolumes(config Config, confFile, homeDir string) []string {
+	volumes := []string{confFile + ":" + confFile + ":ro"}
+	if config.Cloud.Gcloudconfig == "" {
+		volumes = append(volumes, filepath.Join(homeDir, ".config", "gcloud")+":"+filepath.Join(containerHome, ".config", "gcloud"))
+	} else {
+		volumes = append(volumes, config.Cloud.Gcloudconfig+":"+config.Cloud.Gcloudconfig)
+	}
+	if config.Cloud.Kubeconfig == "" && len(config.Cloud.Kubeconfigs) == 0 {
+		volumes = append(volumes, filepath.Join(homeDir, ".kube")+":"+filepath.Join(containerHome, ".kube"))
+	}
+	// the kubeconfig files of every environment, as the container may start any of them
+	kubeconfigs := append([]string{config.Cloud.Kubeconfig}, config.Cloud.Kubeconfigs...)
+	for _, proxy := range config.Proxies {
+		kubeconfigs = append(kubeconfigs, proxy.Kubeconfigs...)
+	}
+	var dirs []string
+	for _, path := range kubeconfigs {
+		if dir := filepath.Dir(path); path != "" && !slices.Contains(dirs, dir) {
+			dirs = append(dirs, dir)
+			volumes = append(volumes, dir+":"+dir)
+		}
+	}
+	return append(volumes, filepath.Join(homeDir, ".ssh")+":"+filepath.Join(containerHome, ".ssh"))
+}
+
+// containerCommand is the command of the devcli container, listening on all its addresses
+func containerCommand(environment, confFile string) []string {
+	return []string{"start", "-conf", confFile, "-env", environment, "-bind-address", "0.0.0.0"}
+}
+
+// withoutFlags removes the named flags and their values from a command line
+func withoutFlags(args []string, names ...string) []string {
+	var kept []string
+	for i := 0; i < len(args); i++ {
+		name, _, hasValue := strings.Cut(strings.TrimLeft(args[i], "-"), "=")
+		removed := false
+		for _, n := range names {
+			if strings.HasPrefix(args[i], "-") && name == n {
+				removed = true
+			}
+		}
+		if !removed {
+			kept = append(kept, args[i])
+			continue
+		}
+		// boolean flags have no separate value
+		if !hasValue && name != "docker" && i+1 < len(args) {
+			i++
+		}
+	}
+	return kept
+}
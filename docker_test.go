@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDockerRunArgs(t *testing.T) {
+	config := Config{
+		Environment: "staging",
+		Proxies: []ProxyConfig{{
+			Environment: "staging",
+			Bastion:     Bastion{Connections: []Connection{{LocalPort: 5435, RemoteHost: "10.120.52.48", RemotePort: 5432}}},
+			Workloads:   []Workload{{Namespace: "enr", App: "cashfree", LocalPort: 8080, RemotePort: 8080}},
+		}},
+	}
+	opts := options{bindAddress: "localhost", dockerImage: "devcli"}
+	args := []string{"-docker", "-conf", "config.yaml", "-http-log", "-docker-image=devcli", "-probe-interval", "1m"}
+	dockerArgs, err := dockerRunArgs(opts, config, "/home/me/config.yaml", "/home/me", args, false)
+	if err != nil {
+		t.Fatalf("dockerRunArgs failed: %v", err)
+	}
+	expected := "run --rm -i --name devcli-staging -v /home/me/config.yaml:/home/me/config.yaml:ro " +
+		"-v /home/me/.config/gcloud:/root/.config/gcloud -v /home/me/.kube:/root/.kube -v /home/me/.ssh:/root/.ssh " +
+		"-p 127.0.0.1:8080:8080 -p 127.0.0.1:5435:5435 " +
+		"devcli start -conf /home/me/config.yaml -env staging -bind-address 0.0.0.0 -http-log -probe-interval 1m"
+	if strings.Join(dockerArgs, " ") != expected {
+		t.Errorf("dockerRunArgs failed:\nexpected %s\ngot      %s", expected, strings.Join(dockerArgs, " "))
+	}
+
+	config.Environment = "prod"
+	if _, err := dockerRunArgs(opts, config, "/home/me/config.yaml", "/home/me", nil, false); err == nil {
+		t.Error("dockerRunArgs failed: expected an error for an environment without proxy configuration")
+	}
+}
+
+func TestDockerVolumesKubeconfigs(t *testing.T) {
+	config := Config{
+		Cloud:   CloudConfig{Kubeconfig: "/home/me/kube/main.yaml"},
+		Proxies: []ProxyConfig{{Environment: "staging", Kubeconfigs: []string{"/home/me/kube/data.yaml", "/srv/kube/spark.yaml"}}},
+	}
+	volumes := strings.Join(dockerVolumes(config, "/home/me/config.yaml", "/home/me"), " ")
+	for _, expected := range []string{"/home/me/kube:/home/me/kube", "/srv/kube:/srv/kube"} {
+		if !strings.Contains(volumes, expected) {
+			t.Errorf("dockerVolumes failed: expected %s in %s", expected, volumes)
+		}
+	}
+	if strings.Count(volumes, "/home/me/kube:") != 1 || strings.Contains(volumes, ".kube") {
+		t.Errorf("dockerVolumes failed: expected each kubeconfig directory once, got %s", volumes)
+	}
+}
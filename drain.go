@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// drainPollInterval is how often the open connections are counted while draining
+var drainPollInterval = 100 * time.Millisecond
+
+// shutdownGrace is how long the in-flight connections get to finish when the session ends,
+// the -shutdown-grace flag or else the environment's shutdown_grace. Tunnels are cut right
+// away when it is zero.
+func shutdownGrace(opts options, config ProxyConfig) time.Duration {
+	if opts.shutdownGrace > 0 {
+		return opts.shutdownGrace
+	}
+	return config.ShutdownGrace
+}
+
+// validateShutdownGrace checks that the grace period is not negative
+func validateShutdownGrace(config ProxyConfig) error {
+	if config.ShutdownGrace < 0 {
+		return fmt.Errorf("shutdown_grace must not be negative, got %s", config.ShutdownGrace)
+	}
+	return nil
+}
+
+// openConnections counts the connections open through the metered tunnels
+func openConnections(statuses []tunnelStatus) int {
+	open := 0
+	for _, status := range statuses {
+		open += status.Connections
+	}
+	return open
+}
+
+// drainConnections waits until no connection is open through the tunnels, for at most the
+// grace period. The meter relays stopped accepting connections by then, so only the
+// in-flight ones are waited for.
+func drainConnections(registry *statusRegistry, grace time.Duration) {
+	deadline := time.Now().Add(grace)
+	open := openConnections(registry.snapshot())
+	if open == 0 {
+		return
+	}
+	fmt.Printf("Waiting up to %s for %d open connections to finish, interrupt again to exit now...\n", grace, open)
+	for open > 0 {
+		if !time.Now().Before(deadline) {
+			fmt.Printf("Warning: closing %d connections still open after %s.\n", open, grace)
+			return
+		}
+		time.Sleep(drainPollInterval)
+		open = openConnections(registry.snapshot())
+	}
+	fmt.Println("Every connection finished.")
+}
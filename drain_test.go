@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestDrainConnections(t *testing.T) {
+	registry := newStatusRegistry()
+	registry.register("cashfree", kindWorkload, 8080, "http")
+	registry.recordTraffic("cashfree", 1, 0, 0)
+	go func() {
+		time.Sleep(150 * time.Millisecond)
+		registry.recordTraffic("cashfree", -1, 0, 0)
+	}()
+	start := time.Now()
+	drainConnections(registry, 5*time.Second)
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("drainConnections failed: expected to return once the connection closed, took %s", elapsed)
+	}
+
+	registry.recordTraffic("cashfree", 1, 0, 0)
+	start = time.Now()
+	drainConnections(registry, 200*time.Millisecond)
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("drainConnections failed: expected to give up after the grace period, took %s", elapsed)
+	}
+}
+
+func TestRelayDraining(t *testing.T) {
+	echo, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Error creating listener: %v", err)
+	}
+	defer echo.Close()
+	go func() {
+		for {
+			conn, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	port, err := freeLocalPort()
+	if err != nil {
+		t.Fatalf("Error allocating port: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	draining := make(chan struct{})
+	go (&relay{listenPort: port, targetPort: echo.Addr().(*net.TCPAddr).Port, draining: draining}).run(ctx)
+
+	conn := dialRelay(t, port)
+	defer conn.Close()
+	close(draining)
+	time.Sleep(50 * time.Millisecond)
+	if _, err := net.Dial("tcp", conn.RemoteAddr().String()); err == nil {
+		t.Error("relay failed: expected new connections to be refused while draining")
+	}
+	conn.Write([]byte("ping"))
+	reply := make([]byte, 4)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		t.Errorf("relay failed: expected the open connection to keep working while draining, got %v", err)
+	}
+}
+
+func TestShutdownGrace(t *testing.T) {
+	config := ProxyConfig{ShutdownGrace: 10 * time.Second}
+	if grace := shutdownGrace(options{}, config); grace != 10*time.Second {
+		t.Errorf("shutdownGrace failed: expected the environment's 10s, got %s", grace)
+	}
+	if grace := shutdownGrace(options{shutdownGrace: 30 * time.Second}, config); grace != 30*time.Second {
+		t.Errorf("shutdownGrace failed: expected the flag's 30s, got %s", grace)
+	}
+	if err := validateShutdownGrace(ProxyConfig{ShutdownGrace: -time.Second}); err == nil {
+		t.Error("validateShutdownGrace failed: expected a negative grace period to be rejected")
+	}
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Placeholders of the values a session only learns from gcloud and kubectl
+const (
+	dryRunCluster    = "<CLUSTER>"
+	dryRunLocation   = "<LOCATION>"
+	dryRunZone       = "<ZONE>"
+	dryRunUser       = "<USER>"
+	dryRunIdentity   = "<IDENTITY>"
+	dryRunPod        = "<POD>"
+	dryRunRemotePort = "<REMOTE_PORT>"
+)
+
+// dryRunPlan is what a session would do: the environment variables it sets, the commands
+// it runs in order and the local ports it binds. It is the schema of -dry-run -output json|yaml.
+type dryRunPlan struct {
+	Environment string       `json:"environment" yaml:"environment"`
+	Env         []string     `json:"env" yaml:"env"`
+	Commands    []string     `json:"commands" yaml:"commands"`
+	Ports       []dryRunPort `json:"ports" yaml:"ports"`
+	// HostKeyPolicy is how the host key of an iap bastion is verified
+	HostKeyPolicy string `json:"host_key_policy,omitempty" yaml:"host_key_policy,omitempty"`
+}
+
+// dryRunPort is a local port of the session and what serves it when it is not the
+// tunnel's child process
+type dryRunPort struct {
+	Address  string `json:"address" yaml:"address"`
+	Port     int    `json:"port" yaml:"port"`
+	Tunnel   string `json:"tunnel" yaml:"tunnel"`
+	ServedBy string `json:"served_by,omitempty" yaml:"served_by,omitempty"`
+}
+
+func (p dryRunPort) String() string {
+	line := fmt.Sprintf("%s:%d %s", p.Address, p.Port, p.Tunnel)
+	if p.ServedBy != "" {
+		line += " (" + p.ServedBy + ")"
+	}
+	return line
+}
+
+// runDryRun prints the plan of a session started with the options, without running anything
+func runDryRun(opts options) {
+	if opts.bindAddress != "" {
+		listenHost = opts.bindAddress
+	}
+	if err := checkPortForwardProtocol(opts.portForwardProtocol); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(2)
+	}
+	confFile, err := configPath(opts.confFile)
+	if err != nil {
+		fmt.Println("Error getting user home directory:", err)
+		os.Exit(1)
+	}
+	config, err := readConfig(confFile)
+	if err != nil {
+		fmt.Println("Error reading configuration file:", err)
+		os.Exit(1)
+	}
+	if err := selectEnvironment(&config, opts); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if err := chooseEnvironment(&config); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	proxyConfig, err := findProxyConfig(config)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if errs := validateSession(config, proxyConfig); len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Println("Error:", err)
+		}
+		os.Exit(1)
+	}
+	proxyConfig, err = applyProfile(config, proxyConfig, opts)
+	if err == nil {
+		proxyConfig, err = chooseTunnels(proxyConfig, opts)
+	}
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	proxyConfig, _ = dropDisallowed(proxyConfig)
+	if err := checkPolicies(config.Policies, proxyConfig); err != nil {
+		var violations *PolicyError
+		if errors.As(err, &violations) {
+			violations.report(os.Stdout)
+		}
+		os.Exit(1)
+	}
+	if _, err := validateLocalPorts(proxyConfig); err != nil {
+		var duplicates *DuplicatePortsError
+		if errors.As(err, &duplicates) {
+			duplicates.report(os.Stdout)
+		}
+		os.Exit(1)
+	}
+	if opts.remapPrivileged {
+		if _, err := remapPrivilegedPorts(&proxyConfig, unprivilegedPortStart()); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		fmt.Println("Error getting user home directory:", err)
+		os.Exit(1)
+	}
+
+	plan := newDryRunPlan(config, proxyConfig, opts, homeDir)
+	err = writeOutput(os.Stdout, opts.output, plan, func(w io.Writer) {
+		fmt.Fprintf(w, "Dry run of the %s session, nothing is run. Values only known at run time are shown as %s.\n", plan.Environment, strings.Join([]string{dryRunCluster, dryRunLocation, dryRunZone, dryRunPod}, ", "))
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Environment variables:")
+		for _, env := range plan.Env {
+			fmt.Fprintln(w, "  "+env)
+		}
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Commands:")
+		for _, command := range plan.Commands {
+			fmt.Fprintln(w, "  "+command)
+		}
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Local ports:")
+		for _, port := range plan.Ports {
+			fmt.Fprintln(w, "  "+port.String())
+		}
+		if plan.HostKeyPolicy != "" {
+			fmt.Fprintln(w)
+			fmt.Fprintln(w, "Host keys of the bastion:", plan.HostKeyPolicy)
+		}
+	})
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(2)
+	}
+}
+
+// newDryRunPlan returns the plan of the session, following the phases of runSession
+func newDryRunPlan(config Config, proxyConfig ProxyConfig, opts options, homeDir string) dryRunPlan {
+	plan := dryRunPlan{Environment: proxyConfig.Environment}
+	kubeconfig := kubeconfigEnv(kubeconfigPaths(config.Cloud, proxyConfig, homeDir))
+	gcloudConfig := config.Cloud.Gcloudconfig
+	if gcloudConfig == "" {
+		gcloudConfig = filepath.Join(homeDir, ".config", "gcloud")
+	}
+	plan.Env = []string{"KUBECONFIG=" + kubeconfig, "CLOUDSDK_CONFIG=" + gcloudConfig, "USE_GKE_GCLOUD_AUTH_PLUGIN=True"}
+
+	run := func(name string, args ...string) {
+		plan.Commands = append(plan.Commands, name+" "+strings.Join(args, " "))
+	}
+	runCommand := func(cmd *exec.Cmd) {
+		plan.Commands = append(plan.Commands, commandLine(cmd))
+	}
+	// the requests of the Kubernetes API client are shown like commands
+	request := func(request string) {
+		plan.Commands = append(plan.Commands, request)
+	}
+	ctx := context.Background()
+	project := proxyConfig.CloudProject
+	if opts.noGcloud {
+		plan.Env = append(plan.Env, "CLOUDSDK_CORE_PROJECT="+project)
+	} else {
+		run("gcloud", "version")
+		run("gcloud", "config", "set", "project", project)
+		if opts.preflight {
+			run("gcloud", "auth", "print-access-token")
+		}
+	}
+	hooks := func(stage string, hooks []Hook) {
+		for _, hook := range hooks {
+			plan.Commands = append(plan.Commands, fmt.Sprintf("sh -c %q (%s hook)", hook.Command, stage))
+		}
+	}
+	bastionMode := proxyConfig.APIProxy.enabled() && proxyConfig.APIProxy.mode() == apiProxyBastion
+	if usesIAPBastion(proxyConfig) {
+		plan.HostKeyPolicy = proxyConfig.Bastion.hostKeyPolicy()
+		if plan.HostKeyPolicy == hostKeysPinned {
+			proxyConfig.Bastion.knownHosts = knownHostsFile(homeDir, proxyConfig.Bastion)
+			proxyConfig.Bastion.login, proxyConfig.Bastion.identity = dryRunUser, dryRunIdentity
+		}
+		for _, bastionProject := range append([]string{project}, connectionProjects(proxyConfig)...) {
+			if opts.noGcloud {
+				run("GET", bastionZoneURL(bastionProject, proxyConfig.Bastion.Name))
+				continue
+			}
+			run("gcloud", "compute", "instances", "list", "--project", bastionProject, "--filter", "name="+proxyConfig.Bastion.Name, "--format", "value(zone)")
+		}
+		bastion := proxyConfig.Bastion
+		bastion.Zone = dryRunZone
+		if plan.HostKeyPolicy == hostKeysPinned {
+			run("gcloud", append(bastionArgs(bastion, ""), "--dry-run")...)
+		}
+		if opts.preflight {
+			for _, bastionProject := range append([]string{""}, connectionProjects(proxyConfig)...) {
+				name, args := bastionCheckCommand(bastion, bastionProject)
+				run(name, args...)
+			}
+		}
+	}
+
+	cluster := func(ref clusterRef) gkeCluster {
+		if proxyConfig.KubeContext != "" {
+			return kubeContextCluster(proxyConfig)
+		}
+		cluster := gkeCluster{Project: ref.project, Name: ref.name, Location: dryRunLocation}
+		if cluster.Name == "" {
+			cluster.Name = dryRunCluster
+		}
+		if proxyConfig.ConnectGateway.Enabled {
+			cluster = proxyConfig.ConnectGateway.through(cluster)
+		}
+		return cluster
+	}
+	credentials := func(cluster gkeCluster) {
+		if opts.noGcloud {
+			for _, args := range clusterCredentialsArgs(cluster, clusterEndpoint{address: "<ENDPOINT>", ca: "<CA>"}) {
+				run("kubectl", args...)
+			}
+			return
+		}
+		args := credentialsArgs(cluster)
+		// the location flag depends on whether the cluster turns out to be zonal or regional
+		for i := range args {
+			if args[i] == "--region" {
+				args[i] = "--region|--zone"
+			}
+		}
+		run("gcloud", args...)
+	}
+	defaultCluster := cluster(clusterRef{project: project})
+	if usesClusters(proxyConfig) && proxyConfig.KubeContext != "" {
+		run("kubectl", "config", "get-contexts", proxyConfig.KubeContext, "-o", "name")
+	} else if usesClusters(proxyConfig) && opts.noGcloud {
+		projects := []string{project}
+		for _, ref := range referencedClusters(proxyConfig) {
+			if !slices.Contains(projects, ref.project) {
+				projects = append(projects, ref.project)
+			}
+		}
+		for _, clusterProject := range projects {
+			run("GET", clustersURL(clusterProject))
+		}
+		credentials(defaultCluster)
+		for _, ref := range referencedClusters(proxyConfig) {
+			credentials(cluster(ref))
+		}
+	} else if usesClusters(proxyConfig) {
+		run("gcloud", "container", "clusters", "list", "--project", project, "--format", "value(name,location)")
+		for _, ref := range referencedClusters(proxyConfig) {
+			args := []string{"container", "clusters", "list", "--project", ref.project, "--format", "value(name,location)"}
+			if ref.name != "" {
+				args = append(args, "--filter", "name="+ref.name)
+			}
+			run("gcloud", args...)
+		}
+		run("gcloud", "config", "set", "container/cluster", dryRunCluster)
+		run("gcloud", "config", "set", "compute/region|compute/zone", dryRunLocation)
+		credentials(defaultCluster)
+		for _, ref := range referencedClusters(proxyConfig) {
+			credentials(cluster(ref))
+		}
+	}
+
+	listed := make(map[string]bool)
+	for _, workload := range proxyConfig.Workloads {
+		workload.kubeContext = cluster(workloadCluster(proxyConfig, workload)).kubeContext()
+		if !listed[workload.kubeContext] {
+			listed[workload.kubeContext] = true
+			runCommand(kubectlCommand(ctx, workload, namespacesArgs()...))
+		}
+	}
+
+	if opts.preflight {
+		checked := make(map[string]bool)
+		for _, workload := range proxyConfig.Workloads {
+			workload.kubeContext = cluster(workloadCluster(proxyConfig, workload)).kubeContext()
+			if checked[workload.kubeContext+"/"+workload.Namespace] {
+				continue
+			}
+			checked[workload.kubeContext+"/"+workload.Namespace] = true
+			for _, check := range rbacChecks {
+				args := append([]string{"auth", "can-i"}, check...)
+				runCommand(kubectlCommand(ctx, workload, append(args, "-n", workload.Namespace)...))
+			}
+		}
+	}
+
+	if bastionMode {
+		run("gcloud", "container", "clusters", "describe", dryRunCluster, "--project", project, "--region|--zone", dryRunLocation,
+			"--format", "value(privateClusterConfig.privateEndpoint,masterAuth.clusterCaCertificate)")
+		for _, args := range apiProxyKubeconfigArgs(proxyConfig.Environment, defaultCluster, proxyConfig.APIProxy, "<ENDPOINT>", "<CA>") {
+			run("kubectl", args...)
+		}
+	}
+
+	for _, item := range proxyConfig.Sync {
+		runCommand(kubectlCommand(ctx, Workload{kubeContext: defaultCluster.kubeContext()}, syncArgs(item)...))
+	}
+
+	hooks(hookPreStart, proxyConfig.Hooks.PreStart)
+
+	port := func(localPort int, name, servedBy string) {
+		plan.Ports = append(plan.Ports, dryRunPort{Address: listenHost, Port: localPort, Tunnel: name, ServedBy: servedBy})
+	}
+	workloads := slices.Clone(proxyConfig.Workloads)
+	for i, workload := range workloads {
+		workloads[i].kubeContext = cluster(workloadCluster(proxyConfig, workload)).kubeContext()
+	}
+	groups := podGroups(workloads)
+	for _, workload := range workloads {
+		// the apps of a wildcard are only known once its deployments are listed
+		if workload.wildcard() {
+			runCommand(kubectlCommand(ctx, workload, deploymentsArgs(workload.Namespace)...))
+			continue
+		}
+		forwardPort := workload.LocalPort
+		servedBy := dryRunInterposer(opts, proxyConfig, workload.Name(), workload.Protocol, workload.MaxConnections > 0 || workload.HealthGate)
+		if servedBy != "" {
+			forwardPort = 0
+		}
+		// the pods of a namespace are looked up together, before its first workload starts
+		group := podKey{kubeContext: workload.kubeContext, namespace: workload.Namespace}
+		if apps, ok := groups[group]; ok && workload.pinnedPod() == "" {
+			if apps != nil {
+				request(kubeRequest(workload.kubeContext, "GET", podsPath(workload.Namespace, batchSelector(apps))))
+				groups[group] = nil
+			}
+		} else {
+			request(findPodRequest(workload))
+		}
+		remotePort := strconv.Itoa(workload.RemotePort)
+		if workload.RemotePort == 0 {
+			request(kubeRequest(workload.kubeContext, "GET", podPath(workload.Namespace, dryRunPod)))
+			remotePort = dryRunRemotePort
+		}
+		request(portForwardRequest(workload.kubeContext, workload.Namespace, dryRunPod, portHost(forwardPort, workload.LocalPort), forwardPort, remotePort))
+		port(workload.LocalPort, workload.Name(), servedBy)
+	}
+	for _, connection := range proxyConfig.Bastion.Connections {
+		bastion := proxyConfig.Bastion
+		bastion.Zone = dryRunZone
+		forwarded := connection
+		servedBy := dryRunInterposer(opts, proxyConfig, connection.Name(), connection.Protocol, connection.MaxConnections > 0)
+		if servedBy != "" {
+			forwarded.LocalPort = 0
+			forwarded.internal = true
+		}
+		runCommand(connectBastion(ctx, bastion, forwarded))
+		port(connection.LocalPort, connection.Name(), servedBy)
+	}
+	if opts.preflight && usesIAPBastion(proxyConfig) {
+		bastion := proxyConfig.Bastion
+		bastion.Zone = dryRunZone
+		for _, project := range connectionProjectSet(proxyConfig) {
+			if hosts := remoteHostNames(proxyConfig, project); len(hosts) > 0 {
+				name, args := resolveCommand(bastion, project, slices.Sorted(maps.Keys(hosts)))
+				run(name, args...)
+			}
+		}
+	}
+	if proxyConfig.APIProxy.enabled() {
+		if bastionMode {
+			bastion := proxyConfig.Bastion
+			bastion.Zone = dryRunZone
+			connection := Connection{LocalPort: proxyConfig.APIProxy.LocalPort, RemoteHost: "<ENDPOINT>", RemotePort: 443}
+			runCommand(connectBastion(ctx, bastion, connection))
+		} else {
+			runCommand(kubectlCommand(ctx, Workload{kubeContext: defaultCluster.kubeContext()}, kubectlProxyArgs(proxyConfig.APIProxy)...))
+		}
+		port(proxyConfig.APIProxy.LocalPort, apiProxyName, "")
+	}
+
+	hooks(hookPostStart, proxyConfig.Hooks.PostStart)
+	hooks(hookPreStop, proxyConfig.Hooks.PreStop)
+	hooks(hookPostStop, proxyConfig.Hooks.PostStop)
+	return plan
+}
+
+// dryRunInterposer describes what serves the tunnel's local port when devcli relays its
+// traffic to the child process, which then listens on an internal port shown as 0. relayed
+// tunnels limit their connections or gate their port on their health.
+func dryRunInterposer(opts options, config ProxyConfig, name, protocol string, relayed bool) string {
+	switch {
+	case opts.meter || shutdownGrace(opts, config) > 0 || relayed:
+		return "meter relay"
+	case opts.chaos && chaosRule(config, name) != nil:
+		return "chaos relay"
+	case opts.httpLog && protocol == "http":
+		return "http request log"
+	}
+	return ""
+}
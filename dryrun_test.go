@@ -0,0 +1,117 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNewDryRunPlan(t *testing.T) {
+	config := Config{Environment: "staging"}
+	proxyConfig := ProxyConfig{
+		Environment:  "staging",
+		CloudProject: "okcredit-staging-env",
+		Bastion: Bastion{Name: "bastion", Connections: []Connection{
+			{LocalPort: 5435, RemoteHost: "10.120.52.48", RemotePort: 5432},
+		}},
+		Workloads: []Workload{
+			{Namespace: "enr", App: "cashfree", LocalPort: 8080, RemotePort: 8080, Protocol: "http"},
+			{Namespace: "analytics", App: "airflow", LocalPort: 8091, RemotePort: 8080, Cluster: "data"},
+		},
+		Hooks: Hooks{PreStart: []Hook{{Command: "make seed"}}},
+	}
+	plan := newDryRunPlan(config, proxyConfig, options{httpLog: true, preflight: true, portForwardProtocol: portForwardWebSocket}, "/home/dev")
+
+	if !slices.Contains(plan.Env, "KUBECONFIG=/home/dev/.kube/config") || !slices.Contains(plan.Env, "CLOUDSDK_CONFIG=/home/dev/.config/gcloud") {
+		t.Errorf("newDryRunPlan failed: unexpected environment variables %v", plan.Env)
+	}
+	for _, expected := range []string{
+		"gcloud config set project okcredit-staging-env",
+		"gcloud compute instances list --project okcredit-staging-env --filter name=bastion --format value(zone)",
+		"gcloud auth print-access-token",
+		"gcloud compute ssh bastion --zone <ZONE> --command true -- -o ConnectTimeout=15",
+		"gcloud container clusters list --project okcredit-staging-env --format value(name,location) --filter name=data",
+		"gcloud container clusters get-credentials data --project okcredit-staging-env --region|--zone <LOCATION>",
+		"kubectl --context gke_okcredit-staging-env_<LOCATION>_data auth can-i create pods --subresource=portforward -n analytics",
+		`sh -c "make seed" (pre_start hook)`,
+		"kube-api --context gke_okcredit-staging-env_<LOCATION>_data GET /api/v1/namespaces/analytics/pods?labelSelector=app%3Dairflow",
+		"kube-api --context gke_okcredit-staging-env_<LOCATION>_data POST /api/v1/namespaces/analytics/pods/<POD>/portforward --address localhost 8091:8080",
+		// the http request log listens on the local port, the port-forward on an internal one
+		"kube-api --context gke_okcredit-staging-env_<LOCATION>_<CLUSTER> POST /api/v1/namespaces/enr/pods/<POD>/portforward --address 127.0.0.1 0:8080",
+		"gcloud compute ssh bastion --zone <ZONE> -- -L localhost:5435:10.120.52.48:5432 -N",
+	} {
+		if !slices.Contains(plan.Commands, expected) {
+			t.Errorf("newDryRunPlan failed: missing command %q in %v", expected, plan.Commands)
+		}
+	}
+	expectedPorts := []string{"localhost:8080 cashfree (http request log)", "localhost:8091 airflow", "localhost:5435 10.120.52.48:5432"}
+	var ports []string
+	for _, port := range plan.Ports {
+		ports = append(ports, port.String())
+	}
+	if !slices.Equal(ports, expectedPorts) {
+		t.Errorf("newDryRunPlan failed: expected ports %v, got %v", expectedPorts, ports)
+	}
+}
+
+func TestNewDryRunPlanWithoutWorkloads(t *testing.T) {
+	proxyConfig := ProxyConfig{
+		Environment:  "staging",
+		CloudProject: "okcredit-staging-env",
+		Bastion: Bastion{Name: "bastion", Connections: []Connection{
+			{LocalPort: 5435, RemoteHost: "10.120.52.48", RemotePort: 5432},
+		}},
+	}
+	plan := newDryRunPlan(Config{}, proxyConfig, options{}, "/home/dev")
+	for _, command := range plan.Commands {
+		if strings.Contains(command, "container clusters") || strings.HasPrefix(command, "kubectl") || strings.HasPrefix(command, "kube-api") {
+			t.Errorf("newDryRunPlan failed: unexpected cluster command %q without workloads", command)
+		}
+	}
+}
+
+func TestNewDryRunPlanWithoutGcloud(t *testing.T) {
+	proxyConfig := ProxyConfig{
+		Environment:  "staging",
+		CloudProject: "okcredit-staging-env",
+		Bastion: Bastion{Name: "bastion", Connections: []Connection{
+			{LocalPort: 5435, RemoteHost: "10.120.52.48", RemotePort: 5432},
+		}},
+		Workloads: []Workload{{Namespace: "enr", App: "cashfree", LocalPort: 8080, RemotePort: 8080}},
+	}
+	plan := newDryRunPlan(Config{}, proxyConfig, options{noGcloud: true}, "/home/dev")
+	for _, expected := range []string{
+		"GET " + bastionZoneURL("okcredit-staging-env", "bastion"),
+		"GET " + clustersURL("okcredit-staging-env"),
+	} {
+		if !slices.Contains(plan.Commands, expected) {
+			t.Errorf("newDryRunPlan failed: missing request %q in %v", expected, plan.Commands)
+		}
+	}
+	for _, command := range plan.Commands {
+		if strings.HasPrefix(command, "gcloud config") || strings.HasPrefix(command, "gcloud container") {
+			t.Errorf("newDryRunPlan failed: unexpected gcloud command %q with -no-gcloud", command)
+		}
+	}
+}
+
+func TestNewDryRunPlanWithKubeContext(t *testing.T) {
+	proxyConfig := ProxyConfig{
+		Environment:  "staging",
+		CloudProject: "okcredit-staging-env",
+		KubeContext:  "staging-admin",
+		Workloads:    []Workload{{Namespace: "enr", App: "cashfree", LocalPort: 8080, RemotePort: 8080}},
+	}
+	plan := newDryRunPlan(Config{}, proxyConfig, options{}, "/home/dev")
+	if !slices.Contains(plan.Commands, "kubectl config get-contexts staging-admin -o name") {
+		t.Errorf("newDryRunPlan failed: expected the context to be checked, got %v", plan.Commands)
+	}
+	for _, command := range plan.Commands {
+		if strings.HasPrefix(command, "gcloud container") || strings.HasPrefix(command, "gcloud config set container") {
+			t.Errorf("newDryRunPlan failed: unexpected cluster command %q with kube_context", command)
+		}
+		if strings.HasPrefix(command, "kube-api") && !strings.Contains(command, "--context staging-admin") {
+			t.Errorf("newDryRunPlan failed: expected %q to use the existing context", command)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// runEnv implements devcli env, which prints the environment variables of the session of an
+// environment, as export statements for eval "$(devcli env -shell)" with -shell
+func runEnv(args []string) {
+	fs := flag.NewFlagSet("devcli env", flag.ExitOnError)
+	confFile := fs.String("conf", "", "Path to the configuration file")
+	environment := fs.String("env", "", "Environment of the session, the running one or else the configuration's default when empty")
+	shell := fs.Bool("shell", false, "Print export statements to eval in a POSIX shell")
+	fs.Parse(args)
+
+	env, config, proxyConfig, err := sessionEnv(*confFile, *environment)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		fmt.Println("Error getting user home directory:", err)
+		os.Exit(1)
+	}
+	writeEnv(os.Stdout, append(toolEnv(config, proxyConfig, homeDir), env...), *shell)
+}
+
+// toolEnv returns the variables devcli runs gcloud and kubectl with
+func toolEnv(config Config, proxyConfig ProxyConfig, homeDir string) []string {
+	gcloudConfig := config.Cloud.Gcloudconfig
+	if gcloudConfig == "" {
+		gcloudConfig = filepath.Join(homeDir, ".config", "gcloud")
+	}
+	return []string{
+		"KUBECONFIG=" + kubeconfigEnv(kubeconfigPaths(config.Cloud, proxyConfig, homeDir)),
+		"CLOUDSDK_CONFIG=" + gcloudConfig,
+		"USE_GKE_GCLOUD_AUTH_PLUGIN=True",
+	}
+}
+
+// writeEnv prints the NAME=value variables one per line, or as export statements with
+// single-quoted values when shell is set
+func writeEnv(w io.Writer, env []string, shell bool) {
+	for _, variable := range env {
+		if !shell {
+			fmt.Fprintln(w, variable)
+			continue
+		}
+		name, value, _ := strings.Cut(variable, "=")
+		fmt.Fprintf(w, "export %s=%s\n", name, shellQuote(value))
+	}
+}
+
+// shellQuote quotes the value for a POSIX shell
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestWriteEnv(t *testing.T) {
+	env := []string{"DEVCLI_ENV=staging", "DEVCLI_CONFIG=/home/me/it's/config.yaml"}
+	var b strings.Builder
+	writeEnv(&b, env, false)
+	if b.String() != "DEVCLI_ENV=staging\nDEVCLI_CONFIG=/home/me/it's/config.yaml\n" {
+		t.Errorf("writeEnv failed: unexpected variables %q", b.String())
+	}
+	b.Reset()
+	writeEnv(&b, env, true)
+	if b.String() != "export DEVCLI_ENV='staging'\nexport DEVCLI_CONFIG='/home/me/it'\\''s/config.yaml'\n" {
+		t.Errorf("writeEnv failed: unexpected export statements %q", b.String())
+	}
+}
+
+func TestSessionEnv(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	confFile := filepath.Join(home, "config.yaml")
+	config := `environment: staging
+cloud:
+  gcloudconfig: /etc/gcloud
+proxies:
+  - environment: staging
+    cloud_project: okcredit-staging-env
+    kubeconfigs: [/etc/kube/staging.yaml]
+    workloads:
+      - namespace: enr
+        app: payments
+        local_port: 15001
+        remote_port: 8080
+`
+	if err := os.WriteFile(confFile, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	env, parsed, proxyConfig, err := sessionEnv(confFile, "")
+	if err != nil {
+		t.Fatalf("sessionEnv failed: %v", err)
+	}
+	env = append(toolEnv(parsed, proxyConfig, home), env...)
+	for _, expected := range []string{
+		"KUBECONFIG=/etc/kube/staging.yaml",
+		"CLOUDSDK_CONFIG=/etc/gcloud",
+		"DEVCLI_ENV=staging",
+		"DEVCLI_PROJECT=okcredit-staging-env",
+		"DEVCLI_PAYMENTS_PORT=15001",
+	} {
+		if !slices.Contains(env, expected) {
+			t.Errorf("sessionEnv failed: expected %s in %v", expected, env)
+		}
+	}
+	if _, _, _, err := sessionEnv(confFile, "prod"); err == nil {
+		t.Error("sessionEnv failed: expected an error for an environment that is not configured")
+	}
+}
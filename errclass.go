@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrorClass is the cause of a failed gcloud, ssh or kubectl command
+type ErrorClass string
+
+const (
+	ClassUnknown          ErrorClass = "unknown"
+	ClassNoTerminal       ErrorClass = "no_terminal"
+	ClassAuthExpired      ErrorClass = "auth_expired"
+	ClassPermissionDenied ErrorClass = "permission_denied"
+	ClassNotFound         ErrorClass = "not_found"
+	ClassHostUnreachable  ErrorClass = "host_unreachable"
+	ClassBrokenPipe       ErrorClass = "broken_pipe"
+	ClassQuota            ErrorClass = "quota"
+	ClassServerError      ErrorClass = "server_error"
+)
+
+// errorSignatures maps stderr fragments to error classes. They are checked in order, so
+// more specific signatures come first (an expired token is often reported as a 401).
+var errorSignatures = []struct {
+	class     ErrorClass
+	fragments []string
+}{
+	// the commands of tunnels and hooks have no terminal to prompt on
+	{ClassNoTerminal, []string{
+		"/dev/tty", "read_passphrase", "a terminal is required", "no tty present",
+	}},
+	{ClassAuthExpired, []string{
+		"reauthentication required", "problem refreshing your current auth tokens", "invalid_grant",
+		"do not currently have an active account", "you must be logged in to the server",
+		"gke-gcloud-auth-plugin failed", "unauthorized", "token has been expired or revoked",
+	}},
+	{ClassQuota, []string{
+		"quota exceeded", "resource_exhausted", "ratelimitexceeded", "rate limit exceeded", "too many requests",
+	}},
+	{ClassPermissionDenied, []string{
+		"permission_denied", "permission denied", "forbidden", "does not have permission",
+		"required '", "iap.tunnelinstances.accessviaiap",
+	}},
+	{ClassNotFound, []string{
+		"(notfound)", "was not found", "not found", "could not fetch resource",
+	}},
+	{ClassBrokenPipe, []string{
+		"broken pipe", "connection reset by peer", "lost connection", "error copying from local connection",
+		"an error occurred forwarding", "connection closed by remote host",
+	}},
+	{ClassHostUnreachable, []string{
+		"connection timed out", "no route to host", "connection refused", "could not resolve hostname",
+		"network is unreachable", "failed to connect to backend", "unable to connect to the server", "i/o timeout",
+	}},
+	{ClassServerError, []string{
+		"internal error", "backenderror", "unavailable", "serviceunavailable", "http 500", "http 502",
+		"http 503", "http 504", "code=500", "code=502", "code=503", "code=504", "server error",
+	}},
+}
+
+// classifyFailure returns the class of a failed command from its exit code and stderr
+func classifyFailure(exitCode int, stderr string) ErrorClass {
+	lower := strings.ToLower(stderr)
+	for _, signature := range errorSignatures {
+		for _, fragment := range signature.fragments {
+			if strings.Contains(lower, fragment) {
+				return signature.class
+			}
+		}
+	}
+	// ssh exits with 255 when the connection itself failed
+	if exitCode == 255 {
+		return ClassHostUnreachable
+	}
+	return ClassUnknown
+}
+
+// retryable reports whether a command failing with this class may succeed when run again
+func (c ErrorClass) retryable() bool {
+	switch c {
+	case ClassQuota, ClassServerError, ClassHostUnreachable, ClassBrokenPipe:
+		return true
+	}
+	return false
+}
+
+// CommandError is a failed external command with the classified cause of the failure
+type CommandError struct {
+	Command  string
+	ExitCode int
+	Stderr   string
+	Class    ErrorClass
+	Err      error
+}
+
+func (e *CommandError) Error() string {
+	msg := fmt.Sprintf("%s: %v [%s]", e.Command, e.Err, e.Class)
+	if line := lastLine(e.Stderr); line != "" {
+		msg += ": " + line
+	}
+	return msg
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// newCommandError classifies the failure of cmd, or returns err unchanged if the command
+// could not be run at all
+func newCommandError(cmd *exec.Cmd, err error, stderr string) error {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return err
+	}
+	return &CommandError{
+		Command:  commandLine(cmd),
+		ExitCode: exitErr.ExitCode(),
+		Stderr:   stderr,
+		Class:    classifyFailure(exitErr.ExitCode(), stderr),
+		Err:      err,
+	}
+}
+
+// errorClass returns the class of err, or ClassUnknown if it is not a CommandError
+func errorClass(err error) ErrorClass {
+	var cmdErr *CommandError
+	if errors.As(err, &cmdErr) {
+		return cmdErr.Class
+	}
+	return ClassUnknown
+}
+
+// tool is the program that failed, with gcloud compute ssh reported as ssh and the requests
+// of the Kubernetes API client as kubectl, whose lookups and port-forwards they replace
+func (e *CommandError) tool() string {
+	fields := strings.Fields(e.Command)
+	if len(fields) == 0 {
+		return ""
+	}
+	if len(fields) >= 3 && fields[0] == "gcloud" && fields[1] == "compute" && fields[2] == "ssh" {
+		return "ssh"
+	}
+	if fields[0] == "kube-api" {
+		return "kubectl"
+	}
+	return fields[0]
+}
+
+// remediationHints maps a failing tool and error class to what usually fixes it. They are
+// checked in order, an empty tool matches every tool.
+var remediationHints = []struct {
+	tool  string
+	class ErrorClass
+	hint  string
+}{
+	{"", ClassNoTerminal, "tunnels and hooks run without a terminal and cannot prompt: add the ssh key to the agent with ssh-add, and set interactive: true on a hook that prompts, like sudo does"},
+	{"", ClassAuthExpired, "log in again with gcloud auth login, and gcloud auth application-default login if it keeps failing"},
+	{"", ClassQuota, "the project's API quota is exhausted, wait a minute or lower -max-concurrency and -rate-limit"},
+	{"ssh", ClassHostUnreachable, "check that the bastion instance is running and that the firewall allows IAP (35.235.240.0/20) on port 22, gcloud compute ssh <bastion> --troubleshoot explains the failure"},
+	{"ssh", ClassPermissionDenied, "ask for roles/iap.tunnelResourceAccessor and roles/compute.osLogin on the bastion's project"},
+	{"ssh", ClassBrokenPipe, "the bastion dropped the connection, devcli restarts the tunnel; check the remote host and port if it keeps happening"},
+	{"kubectl", ClassPermissionDenied, "your Kubernetes RBAC role does not allow this, kubectl auth can-i --list -n <namespace> shows what it allows"},
+	{"kubectl", ClassNotFound, "check the namespace and app of the workload, kubectl get pods -n <namespace> -l app=<app> should list its pods"},
+	{"kubectl", ClassHostUnreachable, "the cluster's control plane is not reachable, private clusters need the VPN or connect_gateway"},
+	{"kubectl", ClassBrokenPipe, "the port-forward lost its connection to the pod, devcli restarts the tunnel; check the pod if it keeps happening"},
+	{"gcloud", ClassNotFound, "check cloud_project, the bastion name and the cluster names in the configuration file, and that your account can see the project"},
+	{"gcloud", ClassPermissionDenied, "ask for roles/container.viewer and roles/compute.viewer on the project"},
+	{"", ClassServerError, "Google Cloud returned a server error, try again in a few minutes"},
+	{"", ClassHostUnreachable, "check your network connection"},
+}
+
+// remediationHint returns a short hint on how to fix err, or an empty string if there is
+// none for its cause
+func remediationHint(err error) string {
+	var cmdErr *CommandError
+	if !errors.As(err, &cmdErr) {
+		return ""
+	}
+	tool := cmdErr.tool()
+	for _, h := range remediationHints {
+		if h.class == cmdErr.Class && (h.tool == "" || h.tool == tool) {
+			return h.hint
+		}
+	}
+	return ""
+}
+
+// printHint prints the remediation hint of err, if it has one
+func printHint(err error) {
+	if hint := remediationHint(err); hint != "" {
+		fmt.Println("Hint:", hint)
+	}
+}
+
+// lastLine returns the last non-empty line of s
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// tailBuffer keeps the last max bytes written to it
+type tailBuffer struct {
+	max  int
+	data []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.data = append(b.data, p...)
+	if len(b.data) > b.max {
+		b.data = b.data[len(b.data)-b.max:]
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	return string(b.data)
+}
+
+// reauthPrompt asks the user to log in to gcloud again when their credentials expired.
+// Commands running concurrently share one prompt.
+type reauthPrompt struct {
+	mu         sync.Mutex
+	loggedInAt time.Time
+}
+
+// prompt returns true if the user logged in again and the failed command should be retried
+func (p *reauthPrompt) prompt(ctx context.Context) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// another command already went through the login while this one was waiting
+	if time.Since(p.loggedInAt) < time.Minute {
+		return true
+	}
+	loggedIn := false
+	withTerminal(func() { loggedIn = p.login(ctx) })
+	return loggedIn
+}
+
+// login asks the user whether to log in again and runs gcloud auth login, the caller holds
+// the lock
+func (p *reauthPrompt) login(ctx context.Context) bool {
+	fmt.Println("Your gcloud credentials have expired. Do you want to log in again now? (y/n)")
+	var input string
+	fmt.Scanln(&input)
+	if strings.ToLower(strings.TrimSpace(input)) != "y" {
+		return false
+	}
+	cmd := exec.CommandContext(ctx, "gcloud", "auth", "login")
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	started := commandStarted(cmd)
+	err := cmd.Run()
+	commandFinished(cmd, started, err)
+	if err != nil {
+		fmt.Println("Error logging in to gcloud:", err)
+		return false
+	}
+	p.loggedInAt = time.Now()
+	return true
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestClassifyFailure(t *testing.T) {
+	tests := []struct {
+		exitCode int
+		stderr   string
+		expected ErrorClass
+	}{
+		{1, "ERROR: (gcloud.container.clusters.list) There was a problem refreshing your current auth tokens: Reauthentication failed.", ClassAuthExpired},
+		{1, "ERROR: (gcloud.compute.instances.list) Some requests did not succeed:\n - Required 'compute.instances.list' permission for 'projects/okcredit-42'", ClassPermissionDenied},
+		{1, `Error from server (Forbidden): pods "cashfree-1" is forbidden: User cannot create resource "pods/portforward"`, ClassPermissionDenied},
+		{1, `Error from server (NotFound): namespaces "enrr" not found`, ClassNotFound},
+		{1, "ERROR: (gcloud.compute.instances.list) Quota exceeded for quota metric 'Read requests'", ClassQuota},
+		{1, "ERROR: (gcloud.container.clusters.list) ResponseError: code=503, message=The service is currently unavailable.", ClassServerError},
+		{255, "ssh: connect to host 34.1.2.3 port 22: Connection timed out", ClassHostUnreachable},
+		{255, "", ClassHostUnreachable},
+		{1, "E0101 portforward.go:413] an error occurred forwarding 8080 -> 8080: error forwarding port 8080 to pod", ClassBrokenPipe},
+		{255, "read_passphrase: can't open /dev/tty: No such device or address\ngit@10.120.52.48: Permission denied (publickey).", ClassNoTerminal},
+		{1, "sudo: a terminal is required to read the password", ClassNoTerminal},
+		{1, "something unexpected", ClassUnknown},
+	}
+	for _, test := range tests {
+		if class := classifyFailure(test.exitCode, test.stderr); class != test.expected {
+			t.Errorf("classifyFailure failed for %q: expected %s, got %s", test.stderr, test.expected, class)
+		}
+	}
+}
+
+// test for commandRunner returning classified errors and deciding on retries by class
+func TestCommandRunnerClassifiedErrors(t *testing.T) {
+	runner := newCommandRunner(1, 0).withTimeout(0, 1)
+	ctx := context.Background()
+
+	_, err := runner.output(ctx, exec.CommandContext(ctx, "sh", "-c", "echo \"ERROR: Required 'compute.instances.get' permission\" >&2; exit 1"))
+	var cmdErr *CommandError
+	if !errors.As(err, &cmdErr) || cmdErr.Class != ClassPermissionDenied || cmdErr.ExitCode != 1 {
+		t.Fatalf("commandRunner.output failed: expected a permission_denied CommandError, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "[permission_denied]: ERROR: Required 'compute.instances.get' permission") {
+		t.Errorf("CommandError failed: unexpected message %q", err)
+	}
+
+	// auth errors prompt for a login and the command is run again
+	prompts := 0
+	runner.reauthenticate = func(ctx context.Context) bool {
+		prompts++
+		return false
+	}
+	_, err = runner.output(ctx, exec.CommandContext(ctx, "sh", "-c", "echo 'Reauthentication required.' >&2; exit 1"))
+	if errorClass(err) != ClassAuthExpired || prompts != 1 {
+		t.Errorf("commandRunner.output failed: expected one login prompt for auth_expired, got %d (%v)", prompts, err)
+	}
+}
+
+func TestRemediationHint(t *testing.T) {
+	tests := []struct {
+		command  string
+		class    ErrorClass
+		expected string
+	}{
+		{"gcloud compute ssh bastion --zone asia-south1-a -- -L localhost:5435:10.120.52.48:5432 -N", ClassHostUnreachable, "--troubleshoot"},
+		{"kubectl --context gke_okcredit-42_asia-south1_prod port-forward -n enr cashfree-1 8080:8080", ClassPermissionDenied, "kubectl auth can-i"},
+		{"kubectl get pods -n enrr -l app=cashfree", ClassNotFound, "kubectl get pods -n <namespace> -l app=<app>"},
+		{"gcloud compute instances list --project okcredit-42", ClassNotFound, "check cloud_project"},
+		{"kubectl get pods", ClassAuthExpired, "gcloud auth login"},
+		{"gcloud container clusters list", ClassUnknown, ""},
+	}
+	for _, test := range tests {
+		err := &CommandError{Command: test.command, ExitCode: 1, Class: test.class, Err: errors.New("exit status 1")}
+		hint := remediationHint(err)
+		if test.expected == "" && hint != "" || !strings.Contains(hint, test.expected) {
+			t.Errorf("remediationHint failed for %s [%s]: expected %q in %q", test.command, test.class, test.expected, hint)
+		}
+	}
+	if hint := remediationHint(errors.New("exit status 1")); hint != "" {
+		t.Errorf("remediationHint failed: expected no hint for an unclassified error, got %q", hint)
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	eventTunnelStarted = "tunnel_started"
+	eventTunnelFailed  = "tunnel_failed"
+	eventTunnelStopped = "tunnel_stopped"
+	eventPodSwitched   = "pod_switched"
+	eventSessionReady  = "session_ready"
+	eventSessionEnded  = "session_ended"
+	// eventBuffer is how many events wait for a slow reader before they are dropped
+	eventBuffer = 256
+	// eventFlushTimeout is how long the session waits for the last events to be written
+	eventFlushTimeout = time.Second
+)
+
+// lifecycleEvent is one line of the events file, describing a lifecycle change of the session
+type lifecycleEvent struct {
+	Time        time.Time `json:"time"`
+	Type        string    `json:"type"`
+	Environment string    `json:"environment,omitempty"`
+	Tunnel      string    `json:"tunnel,omitempty"`
+	State       string    `json:"state,omitempty"`
+	Pod         string    `json:"pod,omitempty"`
+	PreviousPod string    `json:"previous_pod,omitempty"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// eventLog delivers every lifecycle change of the session to its outputs, the events file
+// and the webhooks, for integrations that do not need the control API. Every output delivers
+// in the background, so that a slow reader or endpoint never holds the session up: the
+// events it is too slow for are dropped. It is safe for concurrent use.
+type eventLog struct {
+	environment string
+	mu          sync.Mutex
+	outputs     []*eventOutput
+	// pods are the last pods the workloads forwarded to
+	pods   map[string]string
+	closed bool
+}
+
+// eventOutput is one destination of the events, with its own queue
+type eventOutput struct {
+	name         string
+	events       chan lifecycleEvent
+	done         chan struct{}
+	flushTimeout time.Duration
+	dropped      bool
+}
+
+// events is the event log of the session, nil when it has no events file nor webhooks
+var events *eventLog
+
+func newEventLog(environment string) *eventLog {
+	return &eventLog{environment: environment, pods: make(map[string]string)}
+}
+
+// addOutput starts delivering the events with deliver, which returns once the events
+// channel is closed. The session waits up to flushTimeout for the last events on exit.
+func (l *eventLog) addOutput(name string, flushTimeout time.Duration, deliver func(events <-chan lifecycleEvent)) {
+	output := &eventOutput{name: name, events: make(chan lifecycleEvent, eventBuffer), done: make(chan struct{}), flushTimeout: flushTimeout}
+	go func() {
+		defer close(output.done)
+		deliver(output.events)
+	}()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.outputs = append(l.outputs, output)
+}
+
+// writeTo writes a JSON line for every event to path. A unix socket is connected to and a
+// fifo is opened once a reader opens it, anything else is appended to.
+func (l *eventLog) writeTo(path string) error {
+	var open func() (io.WriteCloser, error)
+	info, err := os.Stat(path)
+	switch {
+	case err == nil && info.Mode()&os.ModeSocket != 0:
+		conn, err := net.Dial("unix", path)
+		if err != nil {
+			return err
+		}
+		open = func() (io.WriteCloser, error) { return conn, nil }
+	case err == nil && info.Mode()&os.ModeNamedPipe != 0:
+		// opening a fifo for writing blocks until it has a reader
+		open = func() (io.WriteCloser, error) { return os.OpenFile(path, os.O_WRONLY, 0) }
+	default:
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return err
+		}
+		open = func() (io.WriteCloser, error) { return file, nil }
+	}
+	l.addOutput("the events file", eventFlushTimeout, func(events <-chan lifecycleEvent) {
+		writeEvents(open, events)
+	})
+	return nil
+}
+
+// writeEvents writes the events as JSON lines until the channel is closed
+func writeEvents(open func() (io.WriteCloser, error), events <-chan lifecycleEvent) {
+	w, err := open()
+	if err != nil {
+		fmt.Println("Warning: opening the events file failed:", err)
+		for range events {
+		}
+		return
+	}
+	defer w.Close()
+	failed := false
+	for event := range events {
+		line, err := json.Marshal(event)
+		if err != nil || failed {
+			continue
+		}
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			// the reader of a fifo or socket went away, the session goes on without it
+			fmt.Println("Warning: writing the events file failed:", err)
+			failed = true
+		}
+	}
+}
+
+// emit queues the event for every output, dropping it for the ones that are behind
+func (l *eventLog) emit(event lifecycleEvent) {
+	if l == nil {
+		return
+	}
+	event.Time = time.Now().UTC()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return
+	}
+	event.Environment = l.environment
+	for _, output := range l.outputs {
+		select {
+		case output.events <- event:
+		default:
+			if !output.dropped {
+				fmt.Printf("Warning: %s does not keep up with the events of the session, events are dropped.\n", output.name)
+				output.dropped = true
+			}
+		}
+	}
+}
+
+// tunnelState emits the event of a tunnel entering the state, unless it already was in it.
+// Every failure is an event, also when the tunnel was already failing.
+func (l *eventLog) tunnelState(name, previous, state string, err error) {
+	event := lifecycleEvent{Tunnel: name, State: state}
+	switch state {
+	case stateRunning:
+		event.Type = eventTunnelStarted
+	case stateBackoff, stateFailed, stateDegraded:
+		event.Type = eventTunnelFailed
+	case stateStopped:
+		event.Type = eventTunnelStopped
+	default:
+		return
+	}
+	if err != nil {
+		event.Error = err.Error()
+	} else if state == previous {
+		return
+	}
+	l.emit(event)
+}
+
+// podSelected emits a pod_switched event when the workload forwards to another pod than
+// the last time it started
+func (l *eventLog) podSelected(name, pod string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	previous, ok := l.pods[name]
+	l.pods[name] = pod
+	l.mu.Unlock()
+	if ok && previous != pod {
+		l.emit(lifecycleEvent{Type: eventPodSwitched, Tunnel: name, Pod: pod, PreviousPod: previous})
+	}
+}
+
+// close delivers the queued events, waiting at most the flush timeout of the outputs for
+// the slow ones
+func (l *eventLog) close() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return
+	}
+	l.closed = true
+	outputs := l.outputs
+	for _, output := range outputs {
+		close(output.events)
+	}
+	l.mu.Unlock()
+	var flushTimeout time.Duration
+	for _, output := range outputs {
+		flushTimeout = max(flushTimeout, output.flushTimeout)
+	}
+	deadline := time.After(flushTimeout)
+	for _, output := range outputs {
+		select {
+		case <-output.done:
+		case <-deadline:
+			return
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEventLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+	log := newEventLog("staging")
+	if err := log.writeTo(path); err != nil {
+		t.Fatalf("writeTo failed: %v", err)
+	}
+	log.tunnelState("cashfree", stateStarting, stateRunning, nil)
+	log.tunnelState("cashfree", stateRunning, stateRunning, nil)
+	log.tunnelState("cashfree", stateRunning, stateBackoff, errors.New("port-forward exited"))
+	log.tunnelState("cashfree", stateBackoff, stateBackoff, errors.New("port-forward exited"))
+	log.podSelected("cashfree", "cashfree-1")
+	log.podSelected("cashfree", "cashfree-1")
+	log.podSelected("cashfree", "cashfree-2")
+	log.emit(lifecycleEvent{Type: eventSessionReady})
+	log.close()
+	log.emit(lifecycleEvent{Type: eventSessionEnded})
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Error reading the events file: %v", err)
+	}
+	var types []string
+	var switched lifecycleEvent
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var event lifecycleEvent
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("event log failed: %q is not JSON: %v", line, err)
+		}
+		if event.Environment != "staging" {
+			t.Errorf("event log failed: unexpected environment in %q", line)
+		}
+		if event.Type == eventPodSwitched {
+			switched = event
+		}
+		types = append(types, event.Type)
+	}
+	expected := "tunnel_started,tunnel_failed,tunnel_failed,pod_switched,session_ready"
+	if strings.Join(types, ",") != expected {
+		t.Errorf("event log failed: expected events %s, got %s", expected, strings.Join(types, ","))
+	}
+	if switched.Pod != "cashfree-2" || switched.PreviousPod != "cashfree-1" {
+		t.Errorf("podSelected failed: unexpected event %+v", switched)
+	}
+}
+
+func TestEventLogSocket(t *testing.T) {
+	// unix socket paths are limited to about 100 bytes, shorter than some temporary directories
+	dir, err := os.MkdirTemp("", "devcli")
+	if err != nil {
+		t.Fatalf("Error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "events.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Error creating listener: %v", err)
+	}
+	defer listener.Close()
+	lines := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		lines <- line
+	}()
+
+	log := newEventLog("staging")
+	if err := log.writeTo(path); err != nil {
+		t.Fatalf("writeTo failed: %v", err)
+	}
+	log.emit(lifecycleEvent{Type: eventSessionReady})
+	log.close()
+	if line := <-lines; !strings.Contains(line, `"type":"session_ready"`) {
+		t.Errorf("event log failed: unexpected line %q", line)
+	}
+}
+
+func TestEventLogNil(t *testing.T) {
+	var log *eventLog
+	log.emit(lifecycleEvent{Type: eventSessionReady})
+	log.tunnelState("cashfree", stateStarting, stateRunning, nil)
+	log.podSelected("cashfree", "cashfree-1")
+	log.close()
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	compute "cloud.google.com/go/compute/apiv1"
+	"cloud.google.com/go/compute/apiv1/computepb"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	container "google.golang.org/api/container/v1"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+	"google.golang.org/protobuf/proto"
+)
+
+// Endpoints of the Google APIs devcli calls with -no-gcloud
+var (
+	computeURL   = "https://compute.googleapis.com"
+	containerURL = "https://container.googleapis.com"
+)
+
+// cloudPlatformScope is the OAuth scope of the access tokens devcli requests
+const cloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// googleAPI looks up bastions and clusters with the Compute Engine and GKE clients, using
+// the Application Default Credentials, instead of running gcloud for every lookup
+type googleAPI struct {
+	// client sends the requests of the API clients and the token requests, recording them
+	client *http.Client
+
+	mu        sync.Mutex
+	tokens    oauth2.TokenSource
+	instances *compute.InstancesClient
+	clusters  *container.Service
+	// keychain caches the access token in the OS keychain across sessions
+	keychain bool
+	// retries is how many times a request failing with a transient error is sent again
+	retries int
+	// endpoints are the control plane addresses and CA certificates of the listed clusters
+	endpoints map[gkeCluster]clusterEndpoint
+}
+
+// clusterEndpoint is the address and CA certificate of a cluster's control plane
+type clusterEndpoint struct {
+	address string
+	ca      string
+}
+
+func newGoogleAPI() *googleAPI {
+	client := &http.Client{Timeout: time.Minute, Transport: recordingTransport{base: http.DefaultTransport}}
+	return &googleAPI{client: client, keychain: true, retries: 2, endpoints: make(map[gkeCluster]clusterEndpoint)}
+}
+
+// recordingTransport reports every request like the external commands to -debug, the audit
+// log and the API quota, as the command line of its method and URL
+type recordingTransport struct {
+	base http.RoundTripper
+}
+
+func (t recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	cmd := &exec.Cmd{Args: []string{req.Method, req.URL.Redacted()}}
+	started := commandStarted(cmd)
+	resp, err := t.base.RoundTrip(req)
+	failure := err
+	if err == nil && resp.StatusCode >= http.StatusBadRequest {
+		failure = errors.New(resp.Status)
+	}
+	commandFinished(cmd, started, failure)
+	return resp, err
+}
+
+// adcFile is the Application Default Credentials file, set by GOOGLE_APPLICATION_CREDENTIALS
+// or written by gcloud auth application-default login to the gcloud configuration directory
+func adcFile() string {
+	if file := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); file != "" {
+		return file
+	}
+	dir := os.Getenv("CLOUDSDK_CONFIG")
+	if dir == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(homeDir, ".config", "gcloud")
+	}
+	return filepath.Join(dir, "application_default_credentials.json")
+}
+
+// tokenSource returns the access tokens of the Application Default Credentials, refreshed a
+// minute before they expire. The token a previous session stored in the keychain is used
+// until it expires, and every new one is stored there.
+func (a *googleAPI) tokenSource(ctx context.Context) (oauth2.TokenSource, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.tokens != nil {
+		return a.tokens, nil
+	}
+	// the token requests outlive the call that finds the credentials
+	ctx = context.WithValue(context.WithoutCancel(ctx), oauth2.HTTPClient, a.client)
+	credentials, err := google.FindDefaultCredentials(ctx, cloudPlatformScope)
+	if err != nil {
+		return nil, fmt.Errorf("finding the application default credentials, run gcloud auth application-default login: %w", err)
+	}
+	source := credentials.TokenSource
+	var cached *oauth2.Token
+	if a.keychain {
+		cached = readCachedToken(ctx)
+		source = keychainTokens{ctx: ctx, source: source}
+	}
+	a.tokens = oauth2.ReuseTokenSourceWithExpiry(cached, source, time.Minute)
+	return a.tokens, nil
+}
+
+// accessToken returns a valid access token of the Application Default Credentials
+func (a *googleAPI) accessToken(ctx context.Context) (string, error) {
+	tokens, err := a.tokenSource(ctx)
+	if err != nil {
+		return "", err
+	}
+	token, err := tokens.Token()
+	if err != nil {
+		return "", fmt.Errorf("getting an access token of the application default credentials: %w", err)
+	}
+	return token.AccessToken, nil
+}
+
+// keychainTokens stores every access token of the source in the keychain
+type keychainTokens struct {
+	ctx    context.Context
+	source oauth2.TokenSource
+}
+
+func (k keychainTokens) Token() (*oauth2.Token, error) {
+	token, err := k.source.Token()
+	if err == nil {
+		storeCachedToken(k.ctx, token.AccessToken, token.Expiry)
+	}
+	return token, err
+}
+
+// cachedToken is an access token stored in the keychain
+type cachedToken struct {
+	Token  string    `json:"token"`
+	Expiry time.Time `json:"expiry"`
+}
+
+// tokenAccount is the keychain account of the access token of the credentials. It is
+// named after a hash of the credentials file, so that a new login does not reuse the token
+// of the previous account.
+func tokenAccount() string {
+	data, err := os.ReadFile(adcFile())
+	if err != nil {
+		return "adc-token:metadata"
+	}
+	sum := sha256.Sum256(data)
+	return fmt.Sprintf("adc-token:%x", sum[:8])
+}
+
+// readCachedToken returns the access token a previous session stored in the keychain, nil
+// when there is none
+func readCachedToken(ctx context.Context) *oauth2.Token {
+	secret, err := readSecret(ctx, tokenAccount())
+	if err != nil {
+		return nil
+	}
+	var cached cachedToken
+	if err := json.Unmarshal([]byte(secret), &cached); err != nil || cached.Token == "" {
+		return nil
+	}
+	return &oauth2.Token{AccessToken: cached.Token, TokenType: "Bearer", Expiry: cached.Expiry}
+}
+
+// storeCachedToken stores the access token in the keychain for the next sessions. Without
+// a keychain the token is only kept in memory.
+func storeCachedToken(ctx context.Context, token string, expiry time.Time) {
+	secret, err := json.Marshal(cachedToken{Token: token, Expiry: expiry})
+	if err != nil {
+		return
+	}
+	if err := storeSecret(ctx, tokenAccount(), string(secret)); err != nil && !errors.Is(err, ErrNoKeychain) {
+		fmt.Println("Warning: the access token cannot be stored in the keychain:", err)
+	}
+}
+
+// apiClients returns the Compute Engine instances client and the GKE service, created once
+// with the access tokens of the Application Default Credentials
+func (a *googleAPI) apiClients(ctx context.Context) (*compute.InstancesClient, *container.Service, error) {
+	tokens, err := a.tokenSource(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.instances != nil {
+		return a.instances, a.clusters, nil
+	}
+	client := &http.Client{Timeout: a.client.Timeout, Transport: &oauth2.Transport{Source: tokens, Base: a.client.Transport}}
+	instances, err := compute.NewInstancesRESTClient(ctx, option.WithHTTPClient(client), option.WithEndpoint(computeURL))
+	if err != nil {
+		return nil, nil, err
+	}
+	// the requests are retried like the commands, by withRetries
+	instances.CallOptions.AggregatedList = nil
+	clusters, err := container.NewService(ctx, option.WithHTTPClient(client), option.WithEndpoint(containerURL+"/"))
+	if err != nil {
+		return nil, nil, err
+	}
+	a.instances, a.clusters = instances, clusters
+	return instances, clusters, nil
+}
+
+// withRetries calls the API until it succeeds, fails with a permanent error or was retried
+// as many times as the commands are
+func (a *googleAPI) withRetries(ctx context.Context, call func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := call()
+		if err == nil || !transientAPIError(err) || attempt >= a.retries || ctx.Err() != nil {
+			return err
+		}
+		wait := retryDelay(attempt)
+		fmt.Printf("Error: %v, retrying in %s (%d/%d)\n", err, wait.Round(100*time.Millisecond), attempt+1, a.retries)
+		if !sleepContext(ctx, wait) {
+			return err
+		}
+	}
+}
+
+// transientAPIError reports whether the request may succeed when sent again: it was
+// throttled, the API failed, or the connection did. Permanent errors, e.g. a permission
+// denied or a missing resource, are not retried.
+func transientAPIError(err error) bool {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code == http.StatusTooManyRequests || apiErr.Code >= 500
+	}
+	var retrieveErr *oauth2.RetrieveError
+	if errors.As(err, &retrieveErr) && retrieveErr.Response != nil {
+		return retrieveErr.Response.StatusCode == http.StatusTooManyRequests || retrieveErr.Response.StatusCode >= 500
+	}
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+// bastionZone returns the zone of the bastion instance in the project
+func (a *googleAPI) bastionZone(ctx context.Context, project, name string) (string, error) {
+	instances, _, err := a.apiClients(ctx)
+	if err != nil {
+		return "", err
+	}
+	var zone string
+	err = a.withRetries(ctx, func() error {
+		list := instances.AggregatedList(ctx, &computepb.AggregatedListInstancesRequest{Project: project, Filter: proto.String(bastionFilter(name))})
+		for {
+			pair, err := list.Next()
+			if errors.Is(err, iterator.Done) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			for _, instance := range pair.Value.GetInstances() {
+				zone = path.Base(instance.GetZone())
+				return nil
+			}
+		}
+	})
+	if err != nil {
+		return "", fmt.Errorf("getting zone of the bastion instance: %w", err)
+	}
+	if zone == "" {
+		return "", fmt.Errorf("bastion instance %s is not found in project %s", name, project)
+	}
+	return zone, nil
+}
+
+// bastionFilter is the Compute Engine filter of the instances named after the bastion
+func bastionFilter(name string) string {
+	return fmt.Sprintf("name=%q", name)
+}
+
+// bastionZoneURL is the Compute Engine request listing the instances named after the bastion
+func bastionZoneURL(project, name string) string {
+	return fmt.Sprintf("%s/compute/v1/projects/%s/aggregated/instances?filter=%s", computeURL, project, url.QueryEscape(bastionFilter(name)))
+}
+
+// clustersURL is the GKE request listing the clusters of every location of the project
+func clustersURL(project string) string {
+	return fmt.Sprintf("%s/v1/projects/%s/locations/-/clusters", containerURL, project)
+}
+
+// findCluster returns the cluster, or the first cluster of the project when the reference
+// has no name, and keeps its control plane endpoint for writeCredentials
+func (a *googleAPI) findCluster(ctx context.Context, ref clusterRef) (gkeCluster, error) {
+	narrate("Getting the location of", ref)
+	_, service, err := a.apiClients(ctx)
+	if err != nil {
+		return gkeCluster{}, err
+	}
+	var list *container.ListClustersResponse
+	err = a.withRetries(ctx, func() error {
+		list, err = service.Projects.Locations.Clusters.List("projects/" + ref.project + "/locations/-").Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		return gkeCluster{}, fmt.Errorf("getting the location of %s: %w", ref, err)
+	}
+	var clusters []gkeCluster
+	for _, c := range list.Clusters {
+		if ref.name != "" && c.Name != ref.name {
+			continue
+		}
+		cluster := gkeCluster{Project: ref.project, Name: c.Name, Location: c.Location}
+		clusters = append(clusters, cluster)
+		endpoint := clusterEndpoint{address: c.Endpoint}
+		if c.MasterAuth != nil {
+			endpoint.ca = c.MasterAuth.ClusterCaCertificate
+		}
+		a.mu.Lock()
+		a.endpoints[cluster] = endpoint
+		a.mu.Unlock()
+	}
+	switch {
+	case len(clusters) == 0 && ref.name == "":
+		return gkeCluster{}, fmt.Errorf("no cluster in project %s", ref.project)
+	case len(clusters) == 0:
+		return gkeCluster{}, fmt.Errorf("%s not found", ref)
+	case len(clusters) > 1 && ref.name != "":
+		return gkeCluster{}, fmt.Errorf("%s is ambiguous, it exists in %d locations", ref, len(clusters))
+	case len(clusters) > 1:
+		fmt.Printf("Warning: project %s has %d clusters, using %s by default. Set cluster on the workloads of the other clusters.\n", ref.project, len(clusters), clusters[0].Name)
+	}
+	return clusters[0], nil
+}
+
+// writeCredentials adds the context of the cluster to the kubeconfig under the name gcloud
+// get-credentials gives it, authenticating with the application default credentials. A
+// cluster this session did not look up, e.g. one of the startup state of -fast, is looked
+// up for its endpoint first.
+func (a *googleAPI) writeCredentials(ctx context.Context, runner *commandRunner, cluster gkeCluster) error {
+	narratef("Writing the credentials for cluster %s of project %s\n", cluster.Name, cluster.Project)
+	endpoint, ok := a.endpoint(cluster)
+	if !ok {
+		_, err := a.findCluster(ctx, clusterRef{project: cluster.Project, name: cluster.Name})
+		if endpoint, ok = a.endpoint(cluster); !ok {
+			if err == nil {
+				err = fmt.Errorf("cluster %s of project %s is not in location %s", cluster.Name, cluster.Project, cluster.Location)
+			}
+			return err
+		}
+	}
+	for _, args := range clusterCredentialsArgs(cluster, endpoint) {
+		cmd := exec.CommandContext(ctx, "kubectl", args...)
+		cmd.Stderr = narrationWriter("kubectl")
+		cmd.Stdout = narrationWriter("kubectl")
+		if err := runner.run(ctx, cmd); err != nil {
+			return fmt.Errorf("writing credentials of cluster %s: %w", cluster.Name, err)
+		}
+	}
+	return nil
+}
+
+// endpoint returns the control plane endpoint of a cluster that was looked up
+func (a *googleAPI) endpoint(cluster gkeCluster) (clusterEndpoint, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	endpoint, ok := a.endpoints[cluster]
+	return endpoint, ok
+}
+
+// clusterCredentialsArgs are the kubectl config commands writing the context of the
+// cluster, whose user runs gke-gcloud-auth-plugin with the application default credentials
+func clusterCredentialsArgs(cluster gkeCluster, endpoint clusterEndpoint) [][]string {
+	name := cluster.kubeContext()
+	return [][]string{
+		{"config", "set-cluster", name, "--server", "https://" + endpoint.address},
+		{"config", "set", "clusters." + name + ".certificate-authority-data", endpoint.ca},
+		{"config", "set-credentials", name, "--exec-api-version=client.authentication.k8s.io/v1beta1", "--exec-command=gke-gcloud-auth-plugin", "--exec-arg=--use_application_default_credentials"},
+		{"config", "set-context", name, "--cluster", name, "--user", name},
+	}
+}
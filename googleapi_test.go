@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeGoogleAPI serves the token endpoint and the compute and container requests of a
+// project with a bastion and two clusters
+func fakeGoogleAPI(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			r.ParseForm()
+			if r.Form.Get("grant_type") != "refresh_token" || r.Form.Get("refresh_token") != "refresh" {
+				http.Error(w, `{"error": "invalid_grant"}`, http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"access_token": "token", "token_type": "Bearer", "expires_in": 3599}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/compute/compute/v1/projects/okcredit-42/aggregated/instances":
+			if r.URL.Query().Get("filter") != `name="bastion"` {
+				w.Write([]byte(`{"items": {}}`))
+				return
+			}
+			w.Write([]byte(`{"items": {"zones/asia-south1-a": {"warning": {"code": "NO_RESULTS_ON_PAGE"}}, "zones/asia-south1-b": {"instances": [{"name": "bastion", "zone": "https://www.googleapis.com/compute/v1/projects/okcredit-42/zones/asia-south1-b"}]}}}`))
+		case "/container/v1/projects/okcredit-42/locations/-/clusters":
+			w.Write([]byte(`{"clusters": [
+				{"name": "prod", "location": "asia-south1", "endpoint": "34.1.2.3", "masterAuth": {"clusterCaCertificate": "Q0E="}},
+				{"name": "data", "location": "asia-south1-a", "endpoint": "34.1.2.4", "masterAuth": {"clusterCaCertificate": "Q0E="}}
+			]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	savedCompute, savedContainer := computeURL, containerURL
+	t.Cleanup(func() { computeURL, containerURL = savedCompute, savedContainer })
+	computeURL, containerURL = server.URL+"/compute", server.URL+"/container"
+
+	credentials := filepath.Join(t.TempDir(), "adc.json")
+	adc := `{"type": "authorized_user", "client_id": "id", "client_secret": "secret", "refresh_token": "refresh", "token_uri": "` + server.URL + `/token"}`
+	if err := os.WriteFile(credentials, []byte(adc), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", credentials)
+	return server
+}
+
+func TestGoogleAPILookups(t *testing.T) {
+	fakeGoogleAPI(t)
+	api := newGoogleAPI()
+	api.keychain = false
+	ctx := context.Background()
+
+	if zone, err := api.bastionZone(ctx, "okcredit-42", "bastion"); err != nil || zone != "asia-south1-b" {
+		t.Errorf("bastionZone failed: expected asia-south1-b, got %q, %v", zone, err)
+	}
+	if _, err := api.bastionZone(ctx, "okcredit-42", "jump"); err == nil || !strings.Contains(err.Error(), "bastion instance jump is not found") {
+		t.Errorf("bastionZone failed: expected a missing bastion, got %v", err)
+	}
+
+	cluster, err := api.findCluster(ctx, clusterRef{project: "okcredit-42", name: "data"})
+	if err != nil || cluster != (gkeCluster{Project: "okcredit-42", Location: "asia-south1-a", Name: "data"}) {
+		t.Errorf("findCluster failed: unexpected cluster %v, %v", cluster, err)
+	}
+	if cluster, err := api.findCluster(ctx, clusterRef{project: "okcredit-42"}); err != nil || cluster.Name != "prod" {
+		t.Errorf("findCluster failed: expected the first cluster as the default, got %v, %v", cluster, err)
+	}
+	if _, err := api.findCluster(ctx, clusterRef{project: "okcredit-42", name: "staging"}); err == nil {
+		t.Error("findCluster failed: expected an error for a missing cluster")
+	}
+	if _, err := api.findCluster(ctx, clusterRef{project: "okcredit-staging-env"}); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("findCluster failed: expected the 404 of the API, got %v", err)
+	}
+
+	args := clusterCredentialsArgs(cluster, api.endpoints[cluster])
+	if strings.Join(args[0], " ") != "config set-cluster gke_okcredit-42_asia-south1-a_data --server https://34.1.2.4" || args[1][3] != "Q0E=" {
+		t.Errorf("clusterCredentialsArgs failed: unexpected arguments %v", args)
+	}
+}
+
+func TestGoogleAPIWriteCachedCredentials(t *testing.T) {
+	fakeGoogleAPI(t)
+	dir := t.TempDir()
+	script := "#!/bin/sh\necho \"$*\" >> " + filepath.Join(dir, "args") + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "kubectl"), []byte(script), 0755); err != nil {
+		t.Fatalf("Error writing the fake kubectl: %v", err)
+	}
+	t.Setenv("PATH", dir+string(filepath.ListSeparator)+os.Getenv("PATH"))
+
+	// the cluster comes from the startup state, it was not looked up by the session
+	api := newGoogleAPI()
+	api.keychain = false
+	runner := newCommandRunner(1, 0).withTimeout(time.Minute, 0)
+	cluster := gkeCluster{Project: "okcredit-42", Location: "asia-south1-a", Name: "data"}
+	if err := api.writeCredentials(context.Background(), runner, cluster); err != nil {
+		t.Fatalf("writeCredentials failed: %v", err)
+	}
+	args, _ := os.ReadFile(filepath.Join(dir, "args"))
+	if !strings.Contains(string(args), "--server https://34.1.2.4") {
+		t.Errorf("writeCredentials failed: expected the looked up endpoint, got %s", args)
+	}
+	moved := gkeCluster{Project: "okcredit-42", Location: "asia-south1-b", Name: "data"}
+	if err := api.writeCredentials(context.Background(), runner, moved); err == nil {
+		t.Error("writeCredentials failed: expected an error for a cluster in another location")
+	}
+}
+
+func TestGoogleAPIToken(t *testing.T) {
+	fakeGoogleAPI(t)
+	api := newGoogleAPI()
+	api.keychain = false
+	token, err := api.accessToken(context.Background())
+	if err != nil || token != "token" {
+		t.Errorf("accessToken failed: got %q, %v", token, err)
+	}
+	tokens, _ := api.tokenSource(context.Background())
+	if cached, _ := tokens.Token(); cached == nil || time.Until(cached.Expiry) < 57*time.Minute {
+		t.Errorf("tokenSource failed: expected the token to expire in an hour, got %v", cached)
+	}
+
+	credentials := filepath.Join(t.TempDir(), "adc.json")
+	os.WriteFile(credentials, []byte(`{"type": "unknown"}`), 0600)
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", credentials)
+	api = newGoogleAPI()
+	api.keychain = false
+	if _, err := api.accessToken(context.Background()); err == nil || !strings.Contains(err.Error(), "application-default login") {
+		t.Errorf("accessToken failed: expected unsupported credentials, got %v", err)
+	}
+}
+
+// test for googleAPI retrying the requests failing with transient errors, including the
+// POST of the token request
+func TestGoogleAPIRetries(t *testing.T) {
+	original := retryBaseDelay
+	retryBaseDelay = 10 * time.Millisecond
+	defer func() { retryBaseDelay = original }()
+	server := fakeGoogleAPI(t)
+	handler := server.Config.Handler
+	failed := make(map[string]bool)
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/compute/compute/v1/projects/okcredit-denied/aggregated/instances":
+			http.Error(w, "permission denied", http.StatusForbidden)
+		case !failed[r.URL.Path]:
+			failed[r.URL.Path] = true
+			http.Error(w, "backend error", http.StatusServiceUnavailable)
+		default:
+			handler.ServeHTTP(w, r)
+		}
+	})
+	api := newGoogleAPI()
+	api.keychain = false
+	ctx := context.Background()
+
+	if zone, err := api.bastionZone(ctx, "okcredit-42", "bastion"); err != nil || zone != "asia-south1-b" {
+		t.Errorf("bastionZone failed: expected the retries to succeed, got %q, %v", zone, err)
+	}
+	if _, err := api.bastionZone(ctx, "okcredit-denied", "bastion"); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("bastionZone failed: expected the 403 of the API, got %v", err)
+	}
+	api.retries = 0
+	delete(failed, "/container/v1/projects/okcredit-42/locations/-/clusters")
+	if _, err := api.findCluster(ctx, clusterRef{project: "okcredit-42"}); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("findCluster failed: expected the 503 of the API without retries, got %v", err)
+	}
+}
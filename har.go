@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// harMaxBody is the maximum number of body bytes kept per request and response
+const harMaxBody = 1 << 20
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+type harEntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+}
+
+// harLog records HTTP exchanges and writes them in the HTTP Archive format
+type harLog struct {
+	mu      sync.Mutex
+	entries []harEntry
+}
+
+// bodyRecorder keeps a copy of the response while passing it through to the client
+type bodyRecorder struct {
+	statusRecorder
+	body bytes.Buffer
+	size int
+}
+
+func (r *bodyRecorder) Write(p []byte) (int, error) {
+	r.size += len(p)
+	if r.body.Len() < harMaxBody {
+		r.body.Write(p[:min(len(p), harMaxBody-r.body.Len())])
+	}
+	return r.ResponseWriter.Write(p)
+}
+
+// wrap returns a handler that records every exchange served by next
+func (h *harLog) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		var requestBody []byte
+		if r.Body != nil {
+			requestBody, _ = io.ReadAll(io.LimitReader(r.Body, harMaxBody))
+			r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(requestBody), r.Body))
+		}
+		rec := &bodyRecorder{statusRecorder: statusRecorder{ResponseWriter: w, status: http.StatusOK}}
+		next.ServeHTTP(rec, r)
+		elapsed := float64(time.Since(start).Microseconds()) / 1000
+
+		url := *r.URL
+		url.Scheme, url.Host = "http", r.Host
+		entry := harEntry{
+			StartedDateTime: start,
+			Time:            elapsed,
+			Request: harRequest{
+				Method:      r.Method,
+				URL:         url.String(),
+				HTTPVersion: r.Proto,
+				Cookies:     []harNameValue{},
+				Headers:     harHeaders(r.Header),
+				QueryString: harQuery(r),
+				HeadersSize: -1,
+				BodySize:    len(requestBody),
+			},
+			Response: harResponse{
+				Status:      rec.status,
+				StatusText:  http.StatusText(rec.status),
+				HTTPVersion: r.Proto,
+				Cookies:     []harNameValue{},
+				Headers:     harHeaders(rec.Header()),
+				Content:     harContent{Size: rec.size, MimeType: rec.Header().Get("Content-Type"), Text: rec.body.String()},
+				HeadersSize: -1,
+				BodySize:    rec.size,
+			},
+			Timings: harTimings{Wait: elapsed},
+		}
+		if len(requestBody) > 0 {
+			entry.Request.PostData = &harPostData{MimeType: r.Header.Get("Content-Type"), Text: string(requestBody)}
+		}
+		h.mu.Lock()
+		h.entries = append(h.entries, entry)
+		h.mu.Unlock()
+	})
+}
+
+// write writes the recorded exchanges as a HAR document
+func (h *harLog) write(w io.Writer) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	doc := map[string]interface{}{
+		"log": map[string]interface{}{
+			"version": "1.2",
+			"creator": map[string]string{"name": "devcli", "version": "1.0.0"},
+			"entries": append([]harEntry{}, h.entries...),
+		},
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(doc)
+}
+
+func harHeaders(header http.Header) []harNameValue {
+	values := []harNameValue{}
+	for name, list := range header {
+		for _, value := range list {
+			values = append(values, harNameValue{Name: name, Value: value})
+		}
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i].Name < values[j].Name })
+	return values
+}
+
+func harQuery(r *http.Request) []harNameValue {
+	values := []harNameValue{}
+	for name, list := range r.URL.Query() {
+		for _, value := range list {
+			values = append(values, harNameValue{Name: name, Value: value})
+		}
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i].Name < values[j].Name })
+	return values
+}
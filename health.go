@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	healthServing     = "serving"
+	healthNotServing  = "not_serving"
+	healthUnreachable = "unreachable"
+	healthUnsupported = "unsupported"
+)
+
+// checkGRPCHealth calls grpc.health.v1.Health/Check through the tunnel.
+// A service that answers NOT_SERVING means the tunnel works but the service is unhealthy,
+// while a transport error means the tunnel itself is broken.
+func checkGRPCHealth(ctx context.Context, client healthpb.HealthClient, service string, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+	if err != nil {
+		if status.Code(err) == codes.Unimplemented {
+			return healthUnsupported, nil
+		}
+		return healthUnreachable, err
+	}
+	if resp.GetStatus() == healthpb.HealthCheckResponse_SERVING {
+		return healthServing, nil
+	}
+	return healthNotServing, fmt.Errorf("health status %s", resp.GetStatus())
+}
+
+// watchGRPCHealth checks the health of a grpc workload every interval until the context
+// is canceled, recording the result in the registry and printing every change
+func watchGRPCHealth(ctx context.Context, registry *statusRegistry, workload Workload, interval time.Duration) {
+	conn, err := grpc.NewClient(localAddress(workload.LocalPort), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		fmt.Printf("Error creating the health check client for workload %s: %v\n", workload.Name(), err)
+		return
+	}
+	defer conn.Close()
+	client := healthpb.NewHealthClient(conn)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		start := time.Now()
+		health, err := checkGRPCHealth(ctx, client, workload.HealthService, interval)
+		if ctx.Err() != nil {
+			return
+		}
+		// the health check doubles as the round-trip measurement of grpc tunnels
+		if health == healthServing || health == healthNotServing {
+			registry.recordLatency(workload.Name(), 0, time.Since(start))
+		}
+		if previous := registry.setHealth(workload.Name(), health, err); previous != health {
+			fmt.Printf("Health of workload %s changed from %s to %s\n", workload.Name(), previous, health)
+		}
+	}
+}
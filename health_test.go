@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// test for checkGRPCHealth against a local grpc health server
+func TestCheckGRPCHealth(t *testing.T) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Error creating listener: %v", err)
+	}
+	server := grpc.NewServer()
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(server, healthServer)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Error creating client: %v", err)
+	}
+	defer conn.Close()
+	client := healthpb.NewHealthClient(conn)
+	ctx := context.Background()
+
+	healthServer.SetServingStatus("payments", healthpb.HealthCheckResponse_SERVING)
+	if result, err := checkGRPCHealth(ctx, client, "payments", time.Second); result != healthServing {
+		t.Errorf("checkGRPCHealth failed: expected %s, got %s (%v)", healthServing, result, err)
+	}
+
+	healthServer.SetServingStatus("payments", healthpb.HealthCheckResponse_NOT_SERVING)
+	if result, _ := checkGRPCHealth(ctx, client, "payments", time.Second); result != healthNotServing {
+		t.Errorf("checkGRPCHealth failed: expected %s, got %s", healthNotServing, result)
+	}
+
+	server.Stop()
+	if result, _ := checkGRPCHealth(ctx, client, "payments", time.Second); result != healthUnreachable {
+		t.Errorf("checkGRPCHealth failed: expected %s, got %s", healthUnreachable, result)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	// gatePollInterval is how often a closed gate probes the tunnel, and an open gate checks
+	// the state of the tunnel
+	gatePollInterval = time.Second
+	gateProbeTimeout = 2 * time.Second
+)
+
+// healthGate keeps the local port of a workload closed, refusing connections, until its
+// readiness probe passes through the tunnel, and closes it again when the probe fails or the
+// tunnel stops running, so that clients fail fast instead of hanging on a half-dead forward
+type healthGate struct {
+	name string
+	// interval is how often an open gate probes the tunnel, poll how often a closed one does
+	interval time.Duration
+	poll     time.Duration
+	// probe checks the workload through the address of the tunnel's internal port
+	probe func(ctx context.Context, address string) error
+}
+
+// newHealthGate returns the gate of the workload, nil when it has no health_gate. Workloads
+// with protocol grpc are ready when their health service is serving, the other ones when
+// the tunnel holds a connection open.
+func newHealthGate(workload Workload, interval time.Duration) *healthGate {
+	if !workload.HealthGate {
+		return nil
+	}
+	if interval <= 0 {
+		interval = gatePollInterval
+	}
+	gate := &healthGate{name: workload.Name(), interval: interval, poll: gatePollInterval, probe: func(_ context.Context, address string) error {
+		return probeTunnel(address, gateProbeTimeout)
+	}}
+	if workload.Protocol == "grpc" {
+		gate.probe = func(ctx context.Context, address string) error {
+			return probeGRPCHealth(ctx, address, workload.HealthService)
+		}
+	}
+	return gate
+}
+
+// probeGRPCHealth checks that the health service of the grpc server at the address is serving
+func probeGRPCHealth(ctx context.Context, address, service string) error {
+	conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	health, err := checkGRPCHealth(ctx, healthpb.NewHealthClient(conn), service, gateProbeTimeout)
+	if health == healthUnsupported {
+		// a server without the health service is ready once it answers
+		return nil
+	}
+	return err
+}
+
+// run serves the local port through the relay while the tunnel is ready, until the context
+// is canceled or the session drains. The relay keeps its open connections while draining.
+func (g *healthGate) run(ctx context.Context, draining <-chan struct{}, registry *statusRegistry, r *relay) {
+	var stop context.CancelFunc
+	var stopped chan struct{}
+	open := func() {
+		var relayCtx context.Context
+		relayCtx, stop = context.WithCancel(ctx)
+		stopped = make(chan struct{})
+		go func() {
+			defer close(stopped)
+			if err := r.run(relayCtx); err != nil {
+				fmt.Printf("Error serving the local port %d of %s: %v\n", r.listenPort, g.name, err)
+			}
+		}()
+	}
+	shut := func() {
+		stop()
+		<-stopped
+		stop = nil
+	}
+	defer func() {
+		if stop != nil {
+			stop()
+		}
+	}()
+
+	ticker := time.NewTicker(g.poll)
+	defer ticker.Stop()
+	var probed time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-draining:
+			// the relay drains the connections it already accepted
+			stop = nil
+			return
+		case <-ticker.C:
+		}
+		state := registry.state(g.name)
+		switch {
+		case stop != nil && state != stateRunning:
+			shut()
+			fmt.Printf("Closed local port %d of %s, the tunnel is %s\n", r.listenPort, g.name, state)
+		case stop != nil && time.Since(probed) >= g.interval:
+			probed = time.Now()
+			if err := g.probe(ctx, internalAddress(r.targetPort)); err != nil && ctx.Err() == nil {
+				shut()
+				fmt.Printf("Closed local port %d of %s, its readiness probe failed: %v\n", r.listenPort, g.name, err)
+			}
+		case stop == nil && state == stateRunning:
+			if g.probe(ctx, internalAddress(r.targetPort)) == nil && ctx.Err() == nil {
+				probed = time.Now()
+				open()
+				fmt.Printf("Opened local port %d of %s, its readiness probe passed\n", r.listenPort, g.name)
+			}
+		}
+	}
+}
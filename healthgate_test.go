@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// test for healthGate opening the local port once the probe passes and closing it when the
+// probe fails or the tunnel stops running
+func TestHealthGate(t *testing.T) {
+	target, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Error creating listener: %v", err)
+	}
+	defer target.Close()
+	port, err := freeLocalPort()
+	if err != nil {
+		t.Fatalf("Error allocating port: %v", err)
+	}
+	registry := newStatusRegistry()
+	registry.register("cashfree", kindWorkload, port, "http")
+	registry.setState("cashfree", stateRunning, nil)
+	var ready atomic.Bool
+	gate := &healthGate{name: "cashfree", interval: 10 * time.Millisecond, poll: 10 * time.Millisecond, probe: func(context.Context, string) error {
+		if !ready.Load() {
+			return errors.New("not ready")
+		}
+		return nil
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := &relay{listenPort: port, targetPort: target.Addr().(*net.TCPAddr).Port}
+	go gate.run(ctx, nil, registry, r)
+
+	listening := func() bool {
+		conn, err := net.Dial("tcp", net.JoinHostPort(listenHost, strconv.Itoa(port)))
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}
+	eventually := func(expected bool, step string) {
+		t.Helper()
+		for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if listening() == expected {
+				return
+			}
+		}
+		t.Fatalf("healthGate failed: expected the port to be listening %v %s", expected, step)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	eventually(false, "before the probe passed")
+	ready.Store(true)
+	eventually(true, "once the probe passed")
+	ready.Store(false)
+	eventually(false, "once the probe failed")
+	ready.Store(true)
+	eventually(true, "once the probe passed again")
+	registry.setState("cashfree", stateDegraded, errors.New("pod not found"))
+	eventually(false, "while the tunnel is degraded")
+}
+
+func TestNewHealthGate(t *testing.T) {
+	if gate := newHealthGate(Workload{App: "cashfree"}, time.Second); gate != nil {
+		t.Error("newHealthGate failed: expected no gate without health_gate")
+	}
+	if gate := newHealthGate(Workload{App: "cashfree", HealthGate: true}, 0); gate == nil || gate.interval != gatePollInterval {
+		t.Errorf("newHealthGate failed: expected a gate probing every %s, got %+v", gatePollInterval, gate)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"time"
+)
+
+const (
+	hookPreStart  = "pre_start"
+	hookPostStart = "post_start"
+	hookPreStop   = "pre_stop"
+	hookPostStop  = "post_stop"
+)
+
+// defaultHookTimeout is the deadline of hooks that do not set one
+const defaultHookTimeout = 5 * time.Minute
+
+// readyTimeout is how long post_start hooks wait for the tunnels to be ready
+const readyTimeout = 2 * time.Minute
+
+// Hook is a shell command run at one stage of the session. A fatal hook that fails stops
+// the session, other failures are only reported. An interactive hook may prompt on the
+// terminal, the others run without one.
+type Hook struct {
+	Command     string        `yaml:"command"`
+	Fatal       bool          `yaml:"fatal"`
+	Timeout     time.Duration `yaml:"timeout"`
+	Interactive bool          `yaml:"interactive"`
+}
+
+// Hooks are the commands run before the tunnels start, once they are all ready, when the
+// session is interrupted before the tunnels stop, and after they stopped
+type Hooks struct {
+	PreStart  []Hook `yaml:"pre_start"`
+	PostStart []Hook `yaml:"post_start"`
+	PreStop   []Hook `yaml:"pre_stop"`
+	PostStop  []Hook `yaml:"post_stop"`
+}
+
+// runHooks runs the hooks of a stage in order and returns the error of the first fatal
+// hook that fails, the hooks after it are not run
+func runHooks(ctx context.Context, stage string, hooks []Hook, env []string) error {
+	for _, hook := range hooks {
+		narratef("Running %s hook: %s\n", stage, hook.Command)
+		err := runHook(ctx, stage, hook, env)
+		if err == nil {
+			continue
+		}
+		if hook.Fatal {
+			return fmt.Errorf("%s hook %q failed: %w", stage, hook.Command, err)
+		}
+		fmt.Printf("Warning: %s hook %q failed: %v\n", stage, hook.Command, err)
+		printHint(err)
+	}
+	return nil
+}
+
+// runHook runs the hook's command in a shell, with its output logged under the stage name
+func runHook(ctx context.Context, stage string, hook Hook, env []string) error {
+	timeout := hook.Timeout
+	if timeout <= 0 {
+		timeout = defaultHookTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	cmd := shellCommand(ctx, hook.Command)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = logger.Writer(stage)
+	cmd.Stderr = logger.Writer(stage)
+	started := commandStarted(cmd)
+	var err error
+	if hook.Interactive {
+		// the hook stays in devcli's process group, in the foreground of the terminal, so
+		// that it can read it like sudo does
+		cmd.Stdin = os.Stdin
+		cmd.WaitDelay = childStopTimeout
+		withTerminal(func() { err = cmd.Run() })
+	} else {
+		terminateGracefully(cmd)
+		stderr := captureStderr(cmd)
+		if err = runChild(cmd); err != nil {
+			err = newCommandError(cmd, err, stderr.String())
+		}
+	}
+	commandFinished(cmd, started, err)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return &CommandTimeoutError{Command: hook.Command, Timeout: timeout}
+	}
+	return err
+}
+
+// shellCommand runs a command line with the user's shell
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
+
+// hookEnv describes the session to hooks, with the same variables as plugins get
+func hookEnv(proxyConfig ProxyConfig) []string {
+	env := []string{"DEVCLI_ENV=" + proxyConfig.Environment, "DEVCLI_PROJECT=" + proxyConfig.CloudProject}
+	return append(env, tunnelEnv(proxyConfig)...)
+}
+
+// waitReady blocks until every registered tunnel but the paused ones answers a probe, and
+// returns false if some are still not ready when the timeout expires or the context is
+// canceled. progress, when not nil, gets the number of ready tunnels after every round.
+func waitReady(ctx context.Context, registry *statusRegistry, timeout time.Duration, progress func(ready, total int)) bool {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		ready, total := 0, 0
+		for _, status := range registry.snapshot() {
+			if status.State == statePaused {
+				continue
+			}
+			total++
+			if probeTunnel(localAddress(status.LocalPort), 500*time.Millisecond) == nil {
+				ready++
+			}
+		}
+		if progress != nil {
+			progress(ready, total)
+		}
+		if ready == total {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+}
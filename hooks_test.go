@@ -0,0 +1,81 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunHooks(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "hooks.txt")
+	hooks := []Hook{
+		{Command: "echo $DEVCLI_ENV $DEVCLI_CASHFREE_PORT >> " + out},
+		{Command: "exit 3"},
+		{Command: "echo after >> " + out},
+	}
+	if err := runHooks(context.Background(), hookPreStart, hooks, hookEnv(composeConfig.Proxies[0])); err != nil {
+		t.Fatalf("runHooks failed: a hook that is not fatal stopped the stage: %v", err)
+	}
+	data, _ := os.ReadFile(out)
+	if string(data) != "staging 8080\nafter\n" {
+		t.Errorf("runHooks failed: unexpected hook output %q", data)
+	}
+
+	hooks[1].Fatal = true
+	os.Remove(out)
+	err := runHooks(context.Background(), hookPostStart, hooks, nil)
+	if err == nil || !strings.Contains(err.Error(), `post_start hook "exit 3" failed`) {
+		t.Errorf("runHooks failed: expected the fatal hook error, got %v", err)
+	}
+	if data, _ := os.ReadFile(out); strings.Contains(string(data), "after") {
+		t.Error("runHooks failed: hooks after a fatal failure were run")
+	}
+
+	err = runHooks(context.Background(), hookPreStop, []Hook{{Command: "sleep 5", Fatal: true, Timeout: 100 * time.Millisecond}}, nil)
+	var timeoutErr *CommandTimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Errorf("runHooks failed: expected a timeout error, got %v", err)
+	}
+}
+
+func TestWaitReady(t *testing.T) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	registry := newStatusRegistry()
+	registry.register("cashfree", kindWorkload, listener.Addr().(*net.TCPAddr).Port, "http")
+	if !waitReady(context.Background(), registry, 2*time.Second, nil) {
+		t.Error("waitReady failed: expected a listening tunnel to be ready")
+	}
+
+	port, err := freeLocalPort()
+	if err != nil {
+		t.Fatalf("Error getting a free port: %v", err)
+	}
+	registry.register("10.120.52.48:5432", kindBastion, port, "postgres")
+	var ready, total int
+	if waitReady(context.Background(), registry, time.Second, func(r, n int) { ready, total = r, n }) {
+		t.Error("waitReady failed: expected a closed port not to be ready")
+	}
+	if ready != 1 || total != 2 {
+		t.Errorf("waitReady failed: expected progress 1/2, got %d/%d", ready, total)
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// hostKeysTOFU trusts the host key of a bastion on the first connection and refuses a
+	// changed one afterwards, the default of gcloud compute ssh
+	hostKeysTOFU = "tofu"
+	// hostKeysGcloud only trusts the host keys gcloud manages: the keys the instance publishes
+	// in its guest attributes, or that an earlier connection recorded
+	hostKeysGcloud = "gcloud"
+	// hostKeysPinned only trusts the known_hosts entries of the configuration. The bastion is
+	// reached with ssh itself through gcloud compute start-iap-tunnel, as gcloud compute ssh
+	// always has ssh trust the keys gcloud recorded too.
+	hostKeysPinned = "pinned"
+)
+
+// hostKeyPolicy returns the host key verification of the bastion, tofu when it sets none
+func (b Bastion) hostKeyPolicy() string {
+	if b.HostKeyPolicy == "" {
+		return hostKeysTOFU
+	}
+	return b.HostKeyPolicy
+}
+
+// validateHostKeys checks the host key policy of an iap bastion, and that the bastion pins
+// valid keys exactly when its policy is pinned
+func validateHostKeys(config ProxyConfig) error {
+	bastion := config.Bastion
+	if bastion.HostKeyPolicy == "" && len(bastion.KnownHosts) == 0 {
+		return nil
+	}
+	if bastion.kind() != bastionIAP {
+		return fmt.Errorf("host_key_policy and known_hosts do not apply to a bastion of type %s", bastion.kind())
+	}
+	switch bastion.hostKeyPolicy() {
+	case hostKeysTOFU, hostKeysGcloud:
+		if len(bastion.KnownHosts) > 0 {
+			return fmt.Errorf("known_hosts needs host_key_policy %s", hostKeysPinned)
+		}
+	case hostKeysPinned:
+		if len(bastion.KnownHosts) == 0 {
+			return errors.New("host_key_policy pinned needs the known_hosts entries of the bastion")
+		}
+		for _, entry := range bastion.KnownHosts {
+			if err := validateKnownHost(entry); err != nil {
+				return fmt.Errorf("known_hosts entry %q: %w", entry, err)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown host_key_policy %s, expected %s, %s or %s", bastion.HostKeyPolicy, hostKeysTOFU, hostKeysGcloud, hostKeysPinned)
+	}
+	return nil
+}
+
+// validateKnownHost checks that the entry is a key type and its base64 encoded key, as in
+// known_hosts or the ssh-keyscan output without the host name
+func validateKnownHost(entry string) error {
+	fields := strings.Fields(entry)
+	if len(fields) < 2 {
+		return errors.New("expected the key type and the base64 encoded key")
+	}
+	key, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return fmt.Errorf("decoding the key: %w", err)
+	}
+	// the key starts with its type, as a length-prefixed string
+	if len(key) < 4 {
+		return errors.New("the key is too short")
+	}
+	n := int(binary.BigEndian.Uint32(key))
+	if n > len(key)-4 || string(key[4:4+n]) != fields[0] {
+		return fmt.Errorf("the key is not of type %s", fields[0])
+	}
+	return nil
+}
+
+// knownHostsFile returns the file of the pinned keys of the bastion. It is named after the
+// keys, so that environments with bastions of the same name keep files of their own.
+func knownHostsFile(homeDir string, bastion Bastion) string {
+	sum := sha256.Sum256([]byte(strings.Join(bastion.KnownHosts, "\n")))
+	return filepath.Join(homeDir, ".devcli", "known_hosts", bastion.Name+"-"+hex.EncodeToString(sum[:6]))
+}
+
+// knownHostsContent returns the pinned keys as known_hosts lines. The lines match any host,
+// as the file is only used to reach the bastion.
+func knownHostsContent(bastion Bastion) []byte {
+	var content bytes.Buffer
+	for _, entry := range bastion.KnownHosts {
+		fmt.Fprintf(&content, "* %s\n", strings.TrimSpace(entry))
+	}
+	return content.Bytes()
+}
+
+// writeKnownHosts writes the pinned keys of the bastion to its file and returns the file
+func writeKnownHosts(bastion Bastion) (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	path := knownHostsFile(homeDir, bastion)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, knownHostsContent(bastion), 0o600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// hostKeyArgs are the gcloud compute ssh flags of the bastion's host key policy. gcloud
+// checks the host key strictly once it knows the bastion, but accepts the key of a bastion
+// it does not know unless it is told otherwise.
+func hostKeyArgs(bastion Bastion) []string {
+	if bastion.hostKeyPolicy() == hostKeysTOFU {
+		return nil
+	}
+	return []string{"--strict-host-key-checking=yes"}
+}
+
+// bastionSSH returns the program and arguments running ssh with the options on the bastion
+// in the project, and the remote command unless it is empty: gcloud compute ssh, or ssh
+// itself for a pinned bastion
+func bastionSSH(bastion Bastion, project, command string, options ...string) (string, []string) {
+	if bastion.hostKeyPolicy() == hostKeysPinned {
+		return "ssh", pinnedSSHArgs(bastion, project, command, options)
+	}
+	args := bastionArgs(bastion, project)
+	if command != "" {
+		args = append(args, "--command", command)
+	}
+	return "gcloud", append(append(args, "--"), options...)
+}
+
+// iapTunnelCommand is the ssh ProxyCommand reaching port 22 of the bastion through IAP
+func iapTunnelCommand(bastion Bastion, project string) string {
+	command := fmt.Sprintf("gcloud compute start-iap-tunnel %s 22 --listen-on-stdin --zone %s", shellQuote(bastion.Name), shellQuote(bastion.Zone))
+	if project != "" {
+		command += " --project " + shellQuote(project)
+	}
+	return command + " --verbosity=warning"
+}
+
+// pinnedSSHArgs are the ssh arguments reaching a pinned bastion. Its host key is looked up
+// under the bastion's name in the file of the pinned keys only, so that no key recorded in
+// another known hosts file is trusted.
+func pinnedSSHArgs(bastion Bastion, project, command string, options []string) []string {
+	var args []string
+	if bastion.identity != "" {
+		args = append(args, "-i", bastion.identity, "-o", "IdentitiesOnly=yes")
+	}
+	args = append(args,
+		"-o", "StrictHostKeyChecking=yes",
+		"-o", "UserKnownHostsFile="+bastion.knownHosts,
+		"-o", "GlobalKnownHostsFile=/dev/null",
+		"-o", "HostKeyAlias="+bastion.Name,
+		"-o", "CheckHostIP=no",
+		"-o", "ProxyCommand="+iapTunnelCommand(bastion, project),
+		"-o", "ProxyUseFdpass=no")
+	args = append(args, options...)
+	destination := bastion.Name
+	if bastion.login != "" {
+		destination = bastion.login + "@" + destination
+	}
+	args = append(args, destination)
+	if command != "" {
+		args = append(args, command)
+	}
+	return args
+}
+
+// lookupPinnedLogin returns the user and the identity file gcloud compute ssh logs into the
+// bastion with, from the ssh command it prints with --dry-run. gcloud adds the key to the
+// project or the OS Login profile on the way, as it does before connecting.
+func lookupPinnedLogin(ctx context.Context, runner *commandRunner, bastion Bastion) (string, string, error) {
+	cmd := exec.CommandContext(ctx, "gcloud", append(bastionArgs(bastion, ""), "--dry-run")...)
+	cmd.Stderr = logger.Writer(bastion.Name)
+	out, err := runner.output(ctx, cmd)
+	if err != nil {
+		return "", "", fmt.Errorf("looking up the ssh login of bastion %s: %w", bastion.Name, err)
+	}
+	return parseSSHLogin(string(out))
+}
+
+// parseSSHLogin returns the user and the identity file of the ssh command line gcloud
+// compute ssh --dry-run prints, whose last argument is the user@host destination
+func parseSSHLogin(out string) (string, string, error) {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	args := strings.Fields(lines[len(lines)-1])
+	if len(args) == 0 {
+		return "", "", errors.New("gcloud printed no ssh command")
+	}
+	user, _, ok := strings.Cut(args[len(args)-1], "@")
+	if !ok || user == "" {
+		return "", "", fmt.Errorf("no user in the ssh command %q", lines[len(lines)-1])
+	}
+	var identity string
+	for i, arg := range args[:len(args)-1] {
+		if arg == "-i" {
+			identity = args[i+1]
+		}
+	}
+	return user, identity, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+const testHostKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAICMcbMnw+Qh9D9nQTspTqbhCYuGHxgp2J2vvPPRHBeqb"
+
+func TestValidateHostKeys(t *testing.T) {
+	for _, tc := range []struct {
+		bastion Bastion
+		err     string
+	}{
+		{Bastion{Name: "bastion"}, ""},
+		{Bastion{Name: "bastion", HostKeyPolicy: "gcloud"}, ""},
+		{Bastion{Name: "bastion", HostKeyPolicy: "pinned", KnownHosts: []string{testHostKey + " bastion"}}, ""},
+		{Bastion{Name: "bastion", HostKeyPolicy: "pinned"}, "needs the known_hosts entries"},
+		{Bastion{Name: "bastion", HostKeyPolicy: "tofu", KnownHosts: []string{testHostKey}}, "known_hosts needs host_key_policy pinned"},
+		{Bastion{Name: "bastion", HostKeyPolicy: "pinned", KnownHosts: []string{"ssh-rsa " + strings.Fields(testHostKey)[1]}}, "not of type ssh-rsa"},
+		{Bastion{Name: "bastion", HostKeyPolicy: "pinned", KnownHosts: []string{"ssh-ed25519 not-base64"}}, "decoding the key"},
+		{Bastion{Name: "bastion", HostKeyPolicy: "strict"}, "unknown host_key_policy strict"},
+		{Bastion{Type: "cloudflared", HostKeyPolicy: "gcloud"}, "do not apply to a bastion of type cloudflared"},
+	} {
+		err := validateHostKeys(ProxyConfig{Bastion: tc.bastion})
+		if (tc.err == "") != (err == nil) || err != nil && !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("validateHostKeys(%+v) failed: expected %q, got %v", tc.bastion, tc.err, err)
+		}
+	}
+}
+
+func TestHostKeyArgs(t *testing.T) {
+	bastion := Bastion{Name: "bastion", Zone: "asia-south1-a"}
+	if args := strings.Join(bastionArgs(bastion, ""), " "); args != "compute ssh bastion --zone asia-south1-a" {
+		t.Errorf("bastionArgs failed: expected gcloud's default for tofu, got %s", args)
+	}
+	bastion.HostKeyPolicy = hostKeysGcloud
+	if args := strings.Join(bastionArgs(bastion, ""), " "); !strings.HasSuffix(args, "--strict-host-key-checking=yes") {
+		t.Errorf("bastionArgs failed: expected strict host key checking, got %s", args)
+	}
+	if name, _ := bastionCheckCommand(bastion, ""); name != "gcloud" {
+		t.Errorf("bastionCheckCommand failed: expected gcloud compute ssh for policy gcloud, got %s", name)
+	}
+
+	bastion.HostKeyPolicy = hostKeysPinned
+	bastion.KnownHosts = []string{testHostKey}
+	bastion.knownHosts = knownHostsFile("/home/dev", bastion)
+	bastion.login, bastion.identity = "dev_okcredit_in", "/home/dev/.ssh/google_compute_engine"
+	if !strings.HasPrefix(bastion.knownHosts, "/home/dev/.devcli/known_hosts/bastion-") {
+		t.Errorf("knownHostsFile failed: unexpected file %s", bastion.knownHosts)
+	}
+	// only the pinned keys are trusted, gcloud's known hosts file is not used at all
+	name, args := bastionCheckCommand(bastion, "okcredit-shared")
+	expected := "ssh -i /home/dev/.ssh/google_compute_engine -o IdentitiesOnly=yes -o StrictHostKeyChecking=yes -o UserKnownHostsFile=" + bastion.knownHosts +
+		" -o GlobalKnownHostsFile=/dev/null -o HostKeyAlias=bastion -o CheckHostIP=no" +
+		" -o ProxyCommand=gcloud compute start-iap-tunnel 'bastion' 22 --listen-on-stdin --zone 'asia-south1-a' --project 'okcredit-shared' --verbosity=warning" +
+		" -o ProxyUseFdpass=no -o ConnectTimeout=15 dev_okcredit_in@bastion true"
+	if command := name + " " + strings.Join(args, " "); command != expected {
+		t.Errorf("bastionCheckCommand failed: expected %q, got %q", expected, command)
+	}
+	cmd := connectBastion(context.Background(), bastion, Connection{LocalPort: 5432, RemoteHost: "10.120.52.48", RemotePort: 5432})
+	if !strings.HasSuffix(strings.Join(cmd.Args, " "), "-L localhost:5432:10.120.52.48:5432 -N dev_okcredit_in@bastion") {
+		t.Errorf("connectBastion failed: expected the forward through the pinned ssh, got %q", strings.Join(cmd.Args, " "))
+	}
+	if content := string(knownHostsContent(bastion)); content != "* "+testHostKey+"\n" {
+		t.Errorf("knownHostsContent failed: unexpected content %q", content)
+	}
+}
+
+func TestParseSSHLogin(t *testing.T) {
+	out := "/usr/bin/ssh -t -i /home/dev/.ssh/google_compute_engine -o CheckHostIP=no -o HostKeyAlias=compute.4242 -o IdentitiesOnly=yes -o StrictHostKeyChecking=yes -o UserKnownHostsFile=/home/dev/.ssh/google_compute_known_hosts dev_okcredit_in@34.93.1.2\n"
+	user, identity, err := parseSSHLogin(out)
+	if err != nil || user != "dev_okcredit_in" || identity != "/home/dev/.ssh/google_compute_engine" {
+		t.Errorf("parseSSHLogin failed: unexpected login %s, %s, %v", user, identity, err)
+	}
+	if _, _, err := parseSSHLogin("Updating project ssh metadata...done.\n"); err == nil {
+		t.Error("parseSSHLogin failed: expected an error without a destination")
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// statusRecorder remembers the status code written by the proxied handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Flush keeps streaming responses working through the recorder
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// newHTTPLogHandler returns a reverse proxy to target that writes one access log line
+// per request to out: app, method, path, status and latency
+func newHTTPLogHandler(app string, target *url.URL, out io.Writer) http.Handler {
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		fmt.Fprintf(out, "[%s] proxy error for %s %s: %v\n", app, r.Method, r.URL.Path, err)
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		proxy.ServeHTTP(rec, r)
+		fmt.Fprintf(out, "[%s] %s %s %d %s\n", app, r.Method, r.URL.RequestURI(), rec.status, time.Since(start).Round(time.Millisecond))
+	})
+}
+
+// freeLocalPort asks the kernel for a free port on localhost
+func freeLocalPort() (int, error) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+// startHTTPLogProxy serves the workload's local port and proxies every request to the
+// port-forward listening on targetPort, logging each request. It returns when
+// the context is canceled.
+func startHTTPLogProxy(ctx context.Context, app, host string, localPort, targetPort int) error {
+	target := &url.URL{Scheme: "http", Host: internalAddress(targetPort)}
+	server := &http.Server{
+		Addr:    net.JoinHostPort(host, strconv.Itoa(localPort)),
+		Handler: newHTTPLogHandler(app, target, logger),
+	}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	fmt.Printf("Logging HTTP requests for app %s on local port %d\n", app, localPort)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
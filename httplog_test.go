@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// test for newHTTPLogHandler, one log line per proxied request
+func TestHTTPLogHandler(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer backend.Close()
+
+	target, err := url.Parse(backend.URL)
+	if err != nil {
+		t.Fatalf("Error parsing backend url: %v", err)
+	}
+	var out bytes.Buffer
+	proxy := httptest.NewServer(newHTTPLogHandler("cashfree", target, &out))
+	defer proxy.Close()
+
+	resp, err := http.Get(proxy.URL + "/v1/payments?id=1")
+	if err != nil {
+		t.Fatalf("Error calling the proxy: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTeapot {
+		t.Errorf("newHTTPLogHandler failed: expected status %d, got %d", http.StatusTeapot, resp.StatusCode)
+	}
+	line := out.String()
+	if !strings.HasPrefix(line, "[cashfree] GET /v1/payments?id=1 418 ") {
+		t.Errorf("newHTTPLogHandler failed: unexpected log line %q", line)
+	}
+}
+
+func TestFreeLocalPort(t *testing.T) {
+	port, err := freeLocalPort()
+	if err != nil {
+		t.Fatalf("freeLocalPort failed: %v", err)
+	}
+	if !checkPortAvailable(port) {
+		t.Errorf("freeLocalPort failed: port %d is in use", port)
+	}
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// vscodeTaskPrefix starts the labels of the tasks devcli ide vscode writes, the tasks with
+// another label are kept as they are
+const vscodeTaskPrefix = "devcli: "
+
+// vscodeTasks returns the tasks starting, stopping and printing the status of the session
+// of the environment. The start task is a background task that is ready once every tunnel
+// is, so that other tasks can depend on it.
+func vscodeTasks(environment string) []map[string]interface{} {
+	task := func(name string, args ...string) map[string]interface{} {
+		return map[string]interface{}{
+			"label":          vscodeTaskPrefix + name + " " + environment,
+			"type":           "process",
+			"command":        "devcli",
+			"args":           append(args, "-env", environment),
+			"problemMatcher": []interface{}{},
+		}
+	}
+	start := task("start", "start", "-keys=false")
+	start["isBackground"] = true
+	// the session prints no line when it begins setting up, the task is active from its start
+	start["problemMatcher"] = map[string]interface{}{
+		"owner":   "devcli",
+		"pattern": map[string]interface{}{"regexp": "^(Error.*)$", "message": 1},
+		"background": map[string]interface{}{
+			"activeBegins":  true,
+			"beginsPattern": "^devcli ",
+			"endsPattern":   "^(Every tunnel is ready|Warning: not every tunnel is ready)",
+		},
+	}
+	return []map[string]interface{}{start, task("stop", "stop"), task("status", "status")}
+}
+
+// vscodePortsAttributes returns the remote.portsAttributes labeling the local port of every
+// tunnel of the environment in the Ports view
+func vscodePortsAttributes(proxyConfig ProxyConfig) map[string]interface{} {
+	attributes := make(map[string]interface{})
+	add := func(port int, name string) {
+		attributes[strconv.Itoa(port)] = map[string]interface{}{
+			"label":         fmt.Sprintf("devcli %s: %s", proxyConfig.Environment, name),
+			"onAutoForward": "silent",
+		}
+	}
+	for _, workload := range proxyConfig.Workloads {
+		add(workload.LocalPort, workload.Name())
+	}
+	for _, connection := range proxyConfig.Bastion.Connections {
+		add(connection.LocalPort, connection.Name())
+	}
+	if proxyConfig.APIProxy.enabled() {
+		add(proxyConfig.APIProxy.LocalPort, apiProxyName)
+	}
+	return attributes
+}
+
+// jsonObject is a JSON object keeping the order of its keys, so that rewriting a file the
+// user edits only changes the keys devcli sets
+type jsonObject struct {
+	keys   []string
+	values map[string]json.RawMessage
+}
+
+func newJSONObject() *jsonObject {
+	return &jsonObject{values: make(map[string]json.RawMessage)}
+}
+
+// UnmarshalJSON decodes the object with the keys in the order of the data
+func (o *jsonObject) UnmarshalJSON(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return errors.New("not a JSON object")
+	}
+	o.keys, o.values = nil, make(map[string]json.RawMessage)
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		key, _ := token.(string)
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return err
+		}
+		if _, ok := o.values[key]; !ok {
+			o.keys = append(o.keys, key)
+		}
+		o.values[key] = value
+	}
+	_, err = decoder.Token()
+	return err
+}
+
+// MarshalJSON encodes the object with the keys in their order
+func (o *jsonObject) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		name, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(name)
+		b.WriteByte(':')
+		b.Write(o.values[key])
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// get decodes the value of the key into v and reports whether the object has the key
+func (o *jsonObject) get(key string, v interface{}) (bool, error) {
+	value, ok := o.values[key]
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(value, v)
+}
+
+// set sets the key to v, in its place when the object has it and else last
+func (o *jsonObject) set(key string, v interface{}) error {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+	return nil
+}
+
+// stripJSONC removes the comments and trailing commas of JSON with comments, the format of
+// the VS Code files, and reports whether it had comments
+func stripJSONC(data []byte) ([]byte, bool) {
+	var out []byte
+	comments := false
+	for i := 0; i < len(data); i++ {
+		switch c := data[i]; {
+		case c == '"':
+			// copy the string up to its closing quote, past escaped quotes
+			j := i + 1
+			for j < len(data) && data[j] != '"' {
+				if data[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			end := min(j+1, len(data))
+			out = append(out, data[i:end]...)
+			i = end - 1
+		case c == '/' && i+1 < len(data) && data[i+1] == '/':
+			comments = true
+			for i < len(data) && data[i] != '\n' {
+				i++
+			}
+			i--
+		case c == '/' && i+1 < len(data) && data[i+1] == '*':
+			comments = true
+			end := bytes.Index(data[i+2:], []byte("*/"))
+			if end < 0 {
+				i = len(data)
+			} else {
+				i += end + 3
+			}
+		default:
+			out = append(out, c)
+		}
+	}
+	// a comma followed by the end of its object or array is a trailing comma
+	var stripped []byte
+	inString := false
+	for i := 0; i < len(out); i++ {
+		c := out[i]
+		switch {
+		case inString && c == '\\':
+			stripped = append(stripped, c)
+			i++
+			if i < len(out) {
+				stripped = append(stripped, out[i])
+			}
+			continue
+		case c == '"':
+			inString = !inString
+		case !inString && c == ',':
+			next := bytes.TrimLeft(out[i+1:], " \t\r\n")
+			if len(next) > 0 && (next[0] == '}' || next[0] == ']') {
+				continue
+			}
+		}
+		stripped = append(stripped, c)
+	}
+	return stripped, comments
+}
+
+// vscodeFile is a VS Code tasks or settings file
+type vscodeFile struct {
+	// header is the comment lines before the object, such as the link to the documentation
+	// VS Code writes at the top of tasks.json, kept as they are
+	header []byte
+	object *jsonObject
+	// comments reports whether the object has comments, which are not kept
+	comments bool
+}
+
+// readVSCodeFile returns the file, with an empty object when it does not exist. The file
+// may have comments and trailing commas like VS Code allows.
+func readVSCodeFile(path string) (*vscodeFile, error) {
+	file := &vscodeFile{object: newJSONObject()}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return file, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for len(data) > 0 {
+		line, rest, _ := bytes.Cut(data, []byte("\n"))
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 && !bytes.HasPrefix(trimmed, []byte("//")) {
+			break
+		}
+		file.header = append(file.header, line...)
+		file.header = append(file.header, '\n')
+		data = rest
+	}
+	data, file.comments = stripJSONC(data)
+	if len(bytes.TrimSpace(data)) == 0 {
+		return file, nil
+	}
+	if err := json.Unmarshal(data, file.object); err != nil {
+		return nil, fmt.Errorf("%s is not a JSON object: %w", path, err)
+	}
+	return file, nil
+}
+
+// writeVSCodeFile writes the file indented like VS Code does
+func writeVSCodeFile(path string, file *vscodeFile) error {
+	data, err := json.MarshalIndent(file.object, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(append(file.header, data...), '\n'), 0o644)
+}
+
+// mergeVSCodeTasks replaces the devcli tasks of the environment in the tasks.json object
+// and keeps every other task as it is
+func mergeVSCodeTasks(object *jsonObject, environment string) error {
+	var existing []json.RawMessage
+	if _, err := object.get("tasks", &existing); err != nil {
+		return fmt.Errorf("tasks is not a list: %w", err)
+	}
+	var tasks []interface{}
+	for _, task := range existing {
+		// a task that is not an object has no label and is kept
+		var labeled struct {
+			Label string `json:"label"`
+		}
+		json.Unmarshal(task, &labeled)
+		if strings.HasPrefix(labeled.Label, vscodeTaskPrefix) && strings.HasSuffix(labeled.Label, " "+environment) {
+			continue
+		}
+		tasks = append(tasks, task)
+	}
+	for _, task := range vscodeTasks(environment) {
+		tasks = append(tasks, task)
+	}
+	if err := object.set("version", "2.0.0"); err != nil {
+		return err
+	}
+	return object.set("tasks", tasks)
+}
+
+// mergeVSCodePortsAttributes adds the port labels of the environment to the settings.json
+// object, keeping the attributes of other ports
+func mergeVSCodePortsAttributes(object *jsonObject, proxyConfig ProxyConfig) error {
+	attributes := newJSONObject()
+	if _, err := object.get("remote.portsAttributes", attributes); err != nil {
+		return fmt.Errorf("remote.portsAttributes is not an object: %w", err)
+	}
+	labels := vscodePortsAttributes(proxyConfig)
+	for _, port := range slices.Sorted(maps.Keys(labels)) {
+		if err := attributes.set(port, labels[port]); err != nil {
+			return err
+		}
+	}
+	return object.set("remote.portsAttributes", attributes)
+}
+
+// runIDE implements devcli ide vscode, which writes the VS Code tasks of an environment's
+// session, and with -ports the labels of its ports
+func runIDE(args []string) {
+	if len(args) == 0 || args[0] != "vscode" {
+		fmt.Println("Usage: devcli ide vscode [-env <environment>] [-dir <workspace>] [-ports]")
+		os.Exit(2)
+	}
+	var opts options
+	fs := flag.NewFlagSet("devcli ide vscode", flag.ExitOnError)
+	fs.StringVar(&opts.confFile, "conf", "", "Path to the configuration file")
+	fs.StringVar(&opts.environment, "env", "", "Environment of the tasks")
+	dir := fs.String("dir", ".", "Workspace folder of the .vscode directory")
+	ports := fs.Bool("ports", false, "Also label the local ports of the tunnels in .vscode/settings.json")
+	fs.Parse(args[1:])
+
+	confFile, err := configPath(opts.confFile)
+	if err != nil {
+		fmt.Println("Error getting user home directory:", err)
+		os.Exit(1)
+	}
+	config, err := readConfig(confFile)
+	if err != nil {
+		fmt.Println("Error reading configuration file:", err)
+		os.Exit(1)
+	}
+	err = selectEnvironment(&config, opts)
+	if err == nil {
+		err = chooseEnvironment(&config)
+	}
+	var proxyConfig ProxyConfig
+	if err == nil {
+		proxyConfig, err = findProxyConfig(config)
+	}
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	update := func(name string, merge func(*jsonObject) error) {
+		path := filepath.Join(*dir, ".vscode", name)
+		file, err := readVSCodeFile(path)
+		if err == nil {
+			err = merge(file.object)
+		}
+		if err == nil {
+			err = writeVSCodeFile(path, file)
+		}
+		if err != nil {
+			fmt.Println("Error updating", path+":", err)
+			os.Exit(1)
+		}
+		if file.comments {
+			fmt.Println("Warning: the comments inside", path, "were not kept.")
+		}
+		fmt.Println("Updated", path)
+	}
+	update("tasks.json", func(object *jsonObject) error { return mergeVSCodeTasks(object, proxyConfig.Environment) })
+	if *ports {
+		update("settings.json", func(object *jsonObject) error { return mergeVSCodePortsAttributes(object, proxyConfig) })
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMergeVSCodeTasks(t *testing.T) {
+	object := newJSONObject()
+	if err := object.UnmarshalJSON([]byte(`{"version": "2.0.0", "tasks": [
+		{"label": "build"}, {"label": "devcli: start staging"}, {"label": "devcli: start prod"}, "echo"]}`)); err != nil {
+		t.Fatalf("UnmarshalJSON failed: %v", err)
+	}
+	if err := mergeVSCodeTasks(object, "staging"); err != nil {
+		t.Fatalf("mergeVSCodeTasks failed: %v", err)
+	}
+	var tasks []json.RawMessage
+	if _, err := object.get("tasks", &tasks); err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	var labels []string
+	for _, task := range tasks {
+		var labeled struct {
+			Label string `json:"label"`
+		}
+		json.Unmarshal(task, &labeled)
+		labels = append(labels, labeled.Label)
+	}
+	// the task that is not an object is kept without a label
+	expected := "build,devcli: start prod,,devcli: start staging,devcli: stop staging,devcli: status staging"
+	if strings.Join(labels, ",") != expected {
+		t.Errorf("mergeVSCodeTasks failed: expected %s, got %s", expected, strings.Join(labels, ","))
+	}
+}
+
+func TestVSCodePortsAttributes(t *testing.T) {
+	proxyConfig := ProxyConfig{
+		Environment: "staging",
+		Workloads:   []Workload{{App: "cashfree", LocalPort: 8080}},
+		Bastion:     Bastion{Connections: []Connection{{RemoteHost: "10.120.52.48", RemotePort: 5432, LocalPort: 5432}}},
+	}
+	object := newJSONObject()
+	object.UnmarshalJSON([]byte(`{"remote.portsAttributes": {"3000": {"label": "web"}}}`))
+	if err := mergeVSCodePortsAttributes(object, proxyConfig); err != nil {
+		t.Fatalf("mergeVSCodePortsAttributes failed: %v", err)
+	}
+	attributes := newJSONObject()
+	object.get("remote.portsAttributes", attributes)
+	if strings.Join(attributes.keys, ",") != "3000,5432,8080" {
+		t.Fatalf("mergeVSCodePortsAttributes failed: expected 3 ports, got %v", attributes.keys)
+	}
+	var label struct {
+		Label string `json:"label"`
+	}
+	if attributes.get("5432", &label); label.Label != "devcli staging: 10.120.52.48:5432" {
+		t.Errorf("mergeVSCodePortsAttributes failed: unexpected label %v", label.Label)
+	}
+	object.set("remote.portsAttributes", []string{})
+	if err := mergeVSCodePortsAttributes(object, proxyConfig); err == nil {
+		t.Error("mergeVSCodePortsAttributes failed: expected an error for attributes that are not an object")
+	}
+}
+
+func TestReadVSCodeFile(t *testing.T) {
+	dir := t.TempDir()
+	file, err := readVSCodeFile(filepath.Join(dir, "tasks.json"))
+	if err != nil || len(file.object.keys) != 0 {
+		t.Errorf("readVSCodeFile failed: expected an empty object for a missing file, got %v, %v", file, err)
+	}
+
+	// the header of VS Code's tasks.json is kept, the keys keep their order
+	path := filepath.Join(dir, "settings.json")
+	os.WriteFile(path, []byte(`// See https://go.microsoft.com/fwlink/?LinkId=733558
+// for the documentation about the tasks.json format
+{
+	"editor.tabSize": 4, // spaces
+	/* the formatter */
+	"editor.defaultFormatter": "golang.go",
+	"files.exclude": {"**/bin": true,},
+	"url": "http://localhost:8080/*",
+}
+`), 0o644)
+	file, err = readVSCodeFile(path)
+	if err != nil {
+		t.Fatalf("readVSCodeFile failed: %v", err)
+	}
+	if !file.comments || strings.Join(file.object.keys, ",") != "editor.tabSize,editor.defaultFormatter,files.exclude,url" {
+		t.Errorf("readVSCodeFile failed: unexpected keys %v", file.object.keys)
+	}
+	file.object.set("a.new.key", true)
+	if err := writeVSCodeFile(path, file); err != nil {
+		t.Fatalf("writeVSCodeFile failed: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	expected := `// See https://go.microsoft.com/fwlink/?LinkId=733558
+// for the documentation about the tasks.json format
+{
+	"editor.tabSize": 4,
+	"editor.defaultFormatter": "golang.go",
+	"files.exclude": {
+		"**/bin": true
+	},
+	"url": "http://localhost:8080/*",
+	"a.new.key": true
+}
+`
+	if string(data) != expected {
+		t.Errorf("writeVSCodeFile failed: expected\n%s\ngot\n%s", expected, data)
+	}
+
+	os.WriteFile(path, []byte(`["not", "an", "object"]`), 0o644)
+	if _, err := readVSCodeFile(path); err == nil {
+		t.Error("readVSCodeFile failed: expected an error for a file that is not an object")
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// keyCommand is a single-key command of a session running in the foreground
+type keyCommand struct {
+	key  byte
+	name string
+	help string
+	run  func()
+}
+
+// terminalState is the stty state of the terminal saved while the keyboard controls read
+// single keys, restored when the session ends
+var terminalState struct {
+	mu    sync.Mutex
+	saved string
+}
+
+// keyReader is read-locked by the key reader while it reads a key, and locked by
+// withTerminal to pause it
+var keyReader sync.RWMutex
+
+// singleKeyArgs are the stty arguments reading single keys without echoing them. A read
+// returns without a key after a tenth of a second, so that the key reader can be paused.
+var singleKeyArgs = []string{"-icanon", "-echo", "min", "0", "time", "1"}
+
+// stty runs stty on the terminal of the standard input
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// readSingleKeys switches the terminal to read keys without waiting for Enter and without
+// echoing them. Ctrl-C still interrupts the session.
+func readSingleKeys() error {
+	terminalState.mu.Lock()
+	defer terminalState.mu.Unlock()
+	saved, err := stty("-g")
+	if err != nil {
+		return err
+	}
+	if _, err := stty(singleKeyArgs...); err != nil {
+		return err
+	}
+	terminalState.saved = saved
+	return nil
+}
+
+// restoreTerminal restores the terminal state saved by readSingleKeys, if any
+func restoreTerminal() {
+	terminalState.mu.Lock()
+	defer terminalState.mu.Unlock()
+	if terminalState.saved == "" {
+		return
+	}
+	if _, err := stty(terminalState.saved); err != nil {
+		fmt.Println("Warning: the terminal settings cannot be restored, run stty sane:", err)
+	}
+	terminalState.saved = ""
+}
+
+// withTerminal runs fn with the key reader paused and the terminal in the state it had
+// before the keyboard controls, so that fn can prompt the user or run a command reading the
+// terminal. The keyboard controls resume afterwards, unless the terminal was restored.
+func withTerminal(fn func()) {
+	keyReader.Lock()
+	defer keyReader.Unlock()
+	terminalState.mu.Lock()
+	saved := terminalState.saved
+	terminalState.mu.Unlock()
+	if saved == "" {
+		fn()
+		return
+	}
+	if _, err := stty(saved); err != nil {
+		fmt.Println("Warning: the terminal settings cannot be restored for the prompt:", err)
+	}
+	defer func() {
+		terminalState.mu.Lock()
+		defer terminalState.mu.Unlock()
+		if terminalState.saved != "" {
+			stty(singleKeyArgs...)
+		}
+	}()
+	fn()
+}
+
+// sessionKeys returns the single-key commands of a session
+func sessionKeys(registry *statusRegistry, supervisor *supervisor, quit func()) []keyCommand {
+	return []keyCommand{
+		{'s', "status", "print the status of every tunnel", func() {
+			writeStatusTable(os.Stdout, registry.snapshot())
+		}},
+		{'r', "restart failed", "restart the failed tunnels", func() {
+			printRestarted(supervisor.restartFailed())
+		}},
+		{'p', "ports", "print the local address of every tunnel", func() {
+			writePortTable(os.Stdout, registry.snapshot())
+		}},
+		{'q', "quit", "stop the session", func() {
+			fmt.Println("Quit requested. Exiting gracefully...")
+			quit()
+		}},
+	}
+}
+
+// readKeys runs the command of every key read from in until it is closed or the context is
+// canceled. Other keys print the list of commands to out. The commands run with the key
+// reader unlocked, so that they can prompt.
+func readKeys(ctx context.Context, in io.Reader, out io.Writer, commands []keyCommand) {
+	buf := make([]byte, 1)
+	for ctx.Err() == nil {
+		keyReader.RLock()
+		n, err := in.Read(buf)
+		keyReader.RUnlock()
+		if err != nil {
+			return
+		}
+		if n == 0 || ctx.Err() != nil {
+			continue
+		}
+		if buf[0] == '\n' || buf[0] == '\r' {
+			continue
+		}
+		found := false
+		for _, command := range commands {
+			if command.key == buf[0] {
+				command.run()
+				found = true
+				break
+			}
+		}
+		if !found {
+			printKeys(out, commands)
+		}
+	}
+}
+
+// printKeys prints the single-key commands
+func printKeys(w io.Writer, commands []keyCommand) {
+	fmt.Fprintln(w, "Keys:")
+	for _, command := range commands {
+		fmt.Fprintf(w, "%c - %s\n", command.key, command.help)
+	}
+}
+
+// startKeyboardControls reads the single-key commands of a session running in a terminal
+// in the background. The terminal is restored by restoreTerminal.
+func startKeyboardControls(ctx context.Context, commands []keyCommand) {
+	if !isTerminal(os.Stdin) || !stdoutTerminal {
+		return
+	}
+	if err := readSingleKeys(); err != nil {
+		fmt.Println("Warning: keyboard controls are not available:", err)
+		return
+	}
+	var keys []string
+	for _, command := range commands {
+		keys = append(keys, fmt.Sprintf("%c %s", command.key, command.name))
+	}
+	fmt.Printf("Keys: %s.\n", strings.Join(keys, ", "))
+	go readKeys(ctx, terminalKeys{}, os.Stdout, commands)
+}
+
+// terminalKeys reads the keys of the standard input in the state of singleKeyArgs, where a
+// read without a key is not the end of the input
+type terminalKeys struct{}
+
+func (terminalKeys) Read(p []byte) (int, error) {
+	n, err := os.Stdin.Read(p)
+	if n == 0 && err == io.EOF {
+		return 0, nil
+	}
+	return n, err
+}
+
+// writePortTable prints the local address of every tunnel, in a single write like
+// writeStatusTable
+func writePortTable(w io.Writer, statuses []tunnelStatus) {
+	var b bytes.Buffer
+	tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ADDRESS\tTUNNEL\tKIND\tPROTOCOL\tSTATE")
+	for _, s := range statuses {
+		protocol := s.Protocol
+		if protocol == "" {
+			protocol = "tcp"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", net.JoinHostPort(listenHost, strconv.Itoa(s.LocalPort)), s.Name, s.Kind, protocol, s.State)
+	}
+	tw.Flush()
+	w.Write(b.Bytes())
+}
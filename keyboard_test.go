@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReadKeys(t *testing.T) {
+	var ran []string
+	commands := []keyCommand{
+		{'s', "status", "print the status of every tunnel", func() { ran = append(ran, "status") }},
+		{'q', "quit", "stop the session", func() { ran = append(ran, "quit") }},
+	}
+	var out bytes.Buffer
+	readKeys(context.Background(), strings.NewReader("s\nxq"), &out, commands)
+	if strings.Join(ran, ",") != "status,quit" {
+		t.Errorf("readKeys failed: expected status and quit, ran %v", ran)
+	}
+	if !strings.Contains(out.String(), "s - print the status of every tunnel") {
+		t.Errorf("readKeys failed: expected the list of keys for an unknown key, got %q", out.String())
+	}
+}
+
+func TestWritePortTable(t *testing.T) {
+	var out bytes.Buffer
+	writePortTable(&out, []tunnelStatus{
+		{Name: "cashfree", Kind: kindWorkload, LocalPort: 8080, Protocol: "http", State: stateRunning},
+		{Name: "10.120.52.48:5432", Kind: kindBastion, LocalPort: 5435, State: stateBackoff},
+	})
+	for _, expected := range []string{"localhost:8080  cashfree", "localhost:5435  10.120.52.48:5432  bastion   tcp       backoff"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("writePortTable failed: missing %q in %q", expected, out.String())
+		}
+	}
+}
+
+// readFunc is an io.Reader calling the function
+type readFunc func(p []byte) (int, error)
+
+func (f readFunc) Read(p []byte) (int, error) {
+	return f(p)
+}
+
+func TestWithTerminalPausesKeys(t *testing.T) {
+	var paused, readWhilePaused atomic.Bool
+	in := readFunc(func(p []byte) (int, error) {
+		if paused.Load() {
+			readWhilePaused.Store(true)
+		}
+		time.Sleep(time.Millisecond)
+		return 0, nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		readKeys(ctx, in, io.Discard, nil)
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	withTerminal(func() {
+		paused.Store(true)
+		time.Sleep(20 * time.Millisecond)
+		paused.Store(false)
+	})
+	cancel()
+	<-done
+	if readWhilePaused.Load() {
+		t.Error("withTerminal failed: the key reader read the terminal during the prompt")
+	}
+}
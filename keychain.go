@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// keychainService is the service the secrets of devcli are stored under in the keychain
+const keychainService = "devcli"
+
+var (
+	// ErrNoKeychain is returned when there is no keychain to store secrets in. Secrets are
+	// then kept in memory only, never written to plaintext files.
+	ErrNoKeychain = errors.New("no keychain available")
+	// errSecretNotFound is returned for an account without a stored secret
+	errSecretNotFound = errors.New("secret not found")
+)
+
+// keychainTool returns the command of the OS keychain: security for the macOS Keychain,
+// secret-tool for the Secret Service of linux desktops (GNOME Keyring, KWallet)
+func keychainTool() (string, error) {
+	var tool string
+	switch runtime.GOOS {
+	case "darwin":
+		tool = "security"
+	case "linux":
+		tool = "secret-tool"
+	default:
+		return "", ErrNoKeychain
+	}
+	if _, err := exec.LookPath(tool); err != nil {
+		return "", ErrNoKeychain
+	}
+	return tool, nil
+}
+
+// readSecret returns the secret of the account from the keychain
+func readSecret(ctx context.Context, account string) (string, error) {
+	tool, err := keychainTool()
+	if err != nil {
+		return "", err
+	}
+	var cmd *exec.Cmd
+	if tool == "security" {
+		cmd = exec.CommandContext(ctx, tool, "find-generic-password", "-s", keychainService, "-a", account, "-w")
+	} else {
+		cmd = exec.CommandContext(ctx, tool, "lookup", "service", keychainService, "account", account)
+	}
+	out, err := runKeychain(cmd, "")
+	if err != nil {
+		return "", err
+	}
+	// secrets are stored base64 encoded, so that they survive the quoting of security -i
+	secret, err := base64.StdEncoding.DecodeString(strings.TrimSpace(out))
+	if err != nil {
+		return "", fmt.Errorf("reading secret %s from the keychain: %w", account, err)
+	}
+	return string(secret), nil
+}
+
+// storeSecret stores the secret of the account in the keychain, replacing the previous one.
+// The secret is passed on the standard input, never on the command line.
+func storeSecret(ctx context.Context, account, secret string) error {
+	tool, err := keychainTool()
+	if err != nil {
+		return err
+	}
+	encoded := base64.StdEncoding.EncodeToString([]byte(secret))
+	if tool == "security" {
+		cmd := exec.CommandContext(ctx, tool, "-i")
+		_, err = runKeychain(cmd, fmt.Sprintf("add-generic-password -U -s %s -a %q -w %s\n", keychainService, account, encoded))
+	} else {
+		cmd := exec.CommandContext(ctx, tool, "store", "--label", "devcli "+account, "service", keychainService, "account", account)
+		_, err = runKeychain(cmd, encoded)
+	}
+	return err
+}
+
+// deleteSecret removes the secret of the account from the keychain
+func deleteSecret(ctx context.Context, account string) error {
+	tool, err := keychainTool()
+	if err != nil {
+		return err
+	}
+	var cmd *exec.Cmd
+	if tool == "security" {
+		cmd = exec.CommandContext(ctx, tool, "delete-generic-password", "-s", keychainService, "-a", account)
+	} else {
+		cmd = exec.CommandContext(ctx, tool, "clear", "service", keychainService, "account", account)
+	}
+	_, err = runKeychain(cmd, "")
+	return err
+}
+
+// runKeychain runs a keychain command with the input on its standard input. Both tools
+// fail without output when the account has no secret, which is errSecretNotFound.
+func runKeychain(cmd *exec.Cmd, input string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = strings.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	started := commandStarted(cmd)
+	err := cmd.Run()
+	commandFinished(cmd, started, err)
+	if err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" || strings.Contains(message, "could not be found") {
+			return "", errSecretNotFound
+		}
+		return "", fmt.Errorf("%s: %s", cmd.Args[0], message)
+	}
+	return stdout.String(), nil
+}
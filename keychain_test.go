@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// fakeSecretTool puts a secret-tool on the PATH keeping the secrets in files of a directory
+func fakeSecretTool(t *testing.T) string {
+	if runtime.GOOS != "linux" {
+		t.Skip("the Secret Service is only used on linux")
+	}
+	dir, secrets := t.TempDir(), t.TempDir()
+	script := "#!/bin/sh\ncase \"$1\" in\n" +
+		"store) cat > \"" + secrets + "/$7\" ;;\n" +
+		"lookup) [ -f \"" + secrets + "/$5\" ] || exit 1; cat \"" + secrets + "/$5\" ;;\n" +
+		"clear) rm -f \"" + secrets + "/$5\" ;;\n" +
+		"esac\n"
+	if err := os.WriteFile(filepath.Join(dir, "secret-tool"), []byte(script), 0755); err != nil {
+		t.Fatalf("Error writing the fake secret-tool: %v", err)
+	}
+	t.Setenv("PATH", dir+string(filepath.ListSeparator)+os.Getenv("PATH"))
+	return secrets
+}
+
+func TestSecrets(t *testing.T) {
+	secrets := fakeSecretTool(t)
+	ctx := context.Background()
+
+	if _, err := readSecret(ctx, "token"); !errors.Is(err, errSecretNotFound) {
+		t.Errorf("readSecret failed: expected errSecretNotFound, got %v", err)
+	}
+	if err := storeSecret(ctx, "token", `{"token": "ya29"}`); err != nil {
+		t.Fatalf("storeSecret failed: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(secrets, "token")); string(data) == `{"token": "ya29"}` {
+		t.Error("storeSecret failed: the secret is not encoded")
+	}
+	if secret, err := readSecret(ctx, "token"); err != nil || secret != `{"token": "ya29"}` {
+		t.Errorf("readSecret failed: got %q, %v", secret, err)
+	}
+	if err := deleteSecret(ctx, "token"); err != nil {
+		t.Fatalf("deleteSecret failed: %v", err)
+	}
+	if _, err := readSecret(ctx, "token"); !errors.Is(err, errSecretNotFound) {
+		t.Errorf("readSecret failed: expected errSecretNotFound after deleteSecret, got %v", err)
+	}
+}
+
+func TestNoKeychain(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	if err := storeSecret(context.Background(), "token", "ya29"); !errors.Is(err, ErrNoKeychain) {
+		t.Errorf("storeSecret failed: expected ErrNoKeychain, got %v", err)
+	}
+}
+
+func TestCachedToken(t *testing.T) {
+	fakeSecretTool(t)
+	server := fakeGoogleAPI(t)
+	api := newGoogleAPI()
+	if _, err := api.accessToken(context.Background()); err != nil {
+		t.Fatalf("accessToken failed: %v", err)
+	}
+	// a new session reads the token from the keychain instead of the token endpoint
+	server.Close()
+	if token, err := newGoogleAPI().accessToken(context.Background()); err != nil || token != "token" {
+		t.Errorf("accessToken failed: expected the cached token, got %q, %v", token, err)
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+	"k8s.io/klog/v2"
+)
+
+// kubeClients are the Kubernetes API clients of the session, one per kubeconfig context.
+// The workloads of a cluster share its client: their pod lookups, watches and port-forwards
+// go through its connection pool, and the token of its credential plugin, e.g.
+// gke-gcloud-auth-plugin, is fetched once and refreshed for all of them, instead of by a
+// kubectl process each.
+type kubeClients struct {
+	mu      sync.Mutex
+	clients map[string]*kubeClient
+	// protocol is the protocol of the port-forwards, websocket or spdy
+	protocol string
+	logs     sync.Once
+}
+
+// kubeAPI is the session's Kubernetes API clients
+var kubeAPI = newKubeClients()
+
+func newKubeClients() *kubeClients {
+	return &kubeClients{clients: make(map[string]*kubeClient), protocol: portForwardWebSocket}
+}
+
+// kubeClient is the Kubernetes API client of a kubeconfig context
+type kubeClient struct {
+	context   string
+	protocol  string
+	config    *rest.Config
+	clientset kubernetes.Interface
+}
+
+// client returns the client of the kubeconfig context, of the current context when it is
+// empty. Like kubectl, it reads the kubeconfig files of KUBECONFIG.
+func (k *kubeClients) client(kubeContext string) (*kubeClient, error) {
+	k.logs.Do(func() {
+		// client-go reports e.g. the failures of a port-forward's connections through klog,
+		// which kubectl printed on its stderr
+		klog.LogToStderr(false)
+		klog.SetOutput(logger.Writer("kubernetes"))
+	})
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if client, ok := k.clients[kubeContext]; ok {
+		return client, nil
+	}
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: kubeContext}
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(clientcmd.NewDefaultClientConfigLoadingRules(), overrides).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("loading the kubeconfig of context %s: %w", kubeContext, err)
+	}
+	config.UserAgent = "devcli"
+	// the requests are rate limited by the runner, like the commands
+	config.QPS = -1
+	config.Wrap(func(base http.RoundTripper) http.RoundTripper { return recordingTransport{base: base} })
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("creating the Kubernetes client of context %s: %w", kubeContext, err)
+	}
+	client := &kubeClient{context: kubeContext, protocol: k.protocol, config: config, clientset: clientset}
+	k.clients[kubeContext] = client
+	return client, nil
+}
+
+// kubeRequest describes a request of the Kubernetes API client of the context like a
+// command, in its errors and in the dry run, e.g. kube-api GET /api/v1/namespaces/enr/pods
+func kubeRequest(kubeContext, method, path string) string {
+	request := "kube-api"
+	if kubeContext != "" {
+		request += " --context " + kubeContext
+	}
+	return request + " " + method + " " + path
+}
+
+// podsPath is the API path of the pods of the namespace matching the options
+func podsPath(namespace string, opts metav1.ListOptions) string {
+	query := url.Values{}
+	if opts.LabelSelector != "" {
+		query.Set("labelSelector", opts.LabelSelector)
+	}
+	if opts.FieldSelector != "" {
+		query.Set("fieldSelector", opts.FieldSelector)
+	}
+	if opts.Watch {
+		query.Set("watch", "true")
+	}
+	path := "/api/v1/namespaces/" + namespace + "/pods"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	return path
+}
+
+// podPath is the API path of the pod, or of its subresource when one is given
+func podPath(namespace, pod string, subresource ...string) string {
+	path := "/api/v1/namespaces/" + namespace + "/pods/" + pod
+	for _, s := range subresource {
+		path += "/" + s
+	}
+	return path
+}
+
+// portForwardRequest describes the port-forward from the address and local port to the
+// remote port of the pod, like kubectl port-forward's arguments
+func portForwardRequest(kubeContext, namespace, pod, address string, localPort int, remotePort string) string {
+	return fmt.Sprintf("%s --address %s %d:%s", kubeRequest(kubeContext, "POST", podPath(namespace, pod, "portforward")), address, localPort, remotePort)
+}
+
+// listPods returns the pods of the namespace matching the options
+func (c *kubeClient) listPods(ctx context.Context, runner *commandRunner, namespace string, opts metav1.ListOptions) ([]corev1.Pod, error) {
+	var pods *corev1.PodList
+	err := runner.call(ctx, kubeRequest(c.context, "GET", podsPath(namespace, opts)), func(ctx context.Context) (err error) {
+		pods, err = c.clientset.CoreV1().Pods(namespace).List(ctx, opts)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pods.Items, nil
+}
+
+// getPod returns the pod of the namespace
+func (c *kubeClient) getPod(ctx context.Context, runner *commandRunner, namespace, name string) (*corev1.Pod, error) {
+	var pod *corev1.Pod
+	err := runner.call(ctx, kubeRequest(c.context, "GET", podPath(namespace, name)), func(ctx context.Context) (err error) {
+		pod, err = c.clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+		return err
+	})
+	return pod, err
+}
+
+// getService returns the Service of the namespace
+func (c *kubeClient) getService(ctx context.Context, runner *commandRunner, namespace, name string) (*corev1.Service, error) {
+	var service *corev1.Service
+	err := runner.call(ctx, kubeRequest(c.context, "GET", "/api/v1/namespaces/"+namespace+"/services/"+name), func(ctx context.Context) (err error) {
+		service, err = c.clientset.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+		return err
+	})
+	return service, err
+}
+
+// watchPods watches the pods of the namespace matching the options until the context ends
+func (c *kubeClient) watchPods(ctx context.Context, namespace string, opts metav1.ListOptions) (watch.Interface, error) {
+	opts.Watch = true
+	watcher, err := c.clientset.CoreV1().Pods(namespace).Watch(ctx, opts)
+	if err != nil {
+		return nil, newKubeError(kubeRequest(c.context, "GET", podsPath(namespace, opts)), err)
+	}
+	return watcher, nil
+}
+
+// portForward forwards the local port on the address to the remote port of the pod until
+// the context ends or the port-forward fails. Like kubectl port-forward, it reports every
+// accepted connection on out.
+func (c *kubeClient) portForward(ctx context.Context, runner *commandRunner, namespace, pod, address string, localPort, remotePort int, out, errOut io.Writer) error {
+	request := portForwardRequest(c.context, namespace, pod, address, localPort, fmt.Sprint(remotePort))
+	if err := runner.limiter.wait(ctx); err != nil {
+		return err
+	}
+	dialer, err := c.portForwardDialer(namespace, pod)
+	if err != nil {
+		return err
+	}
+	stop := make(chan struct{})
+	forwarder, err := portforward.NewOnAddresses(dialer, []string{address}, []string{fmt.Sprintf("%d:%d", localPort, remotePort)}, stop, nil, out, errOut)
+	if err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			close(stop)
+		case <-done:
+		}
+	}()
+	if err := forwarder.ForwardPorts(); err != nil && ctx.Err() == nil {
+		return newKubeError(request, err)
+	}
+	return nil
+}
+
+// portForwardDialer returns the dialer of the port-forwards to the pod. Like kubectl, the
+// WebSocket dialer falls back to SPDY on API servers without WebSocket port-forwarding.
+func (c *kubeClient) portForwardDialer(namespace, pod string) (httpstream.Dialer, error) {
+	url := c.clientset.CoreV1().RESTClient().Post().Resource("pods").Namespace(namespace).Name(pod).SubResource("portforward").URL()
+	transport, upgrader, err := spdy.RoundTripperFor(c.config)
+	if err != nil {
+		return nil, err
+	}
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, url)
+	if c.protocol == portForwardSPDY {
+		return dialer, nil
+	}
+	websocket, err := portforward.NewSPDYOverWebsocketDialer(url, c.config)
+	if err != nil {
+		return nil, err
+	}
+	return portforward.NewFallbackDialer(websocket, dialer, func(err error) bool {
+		return httpstream.IsUpgradeFailure(err) || httpstream.IsHTTPSProxyError(err)
+	}), nil
+}
+
+// newKubeError returns the failure of the request of the Kubernetes API client as a
+// CommandError, with the class of the kubectl command it replaces, so that it is retried
+// and explained the same way
+func newKubeError(request string, err error) error {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return err
+	}
+	return &CommandError{Command: request, ExitCode: -1, Class: kubeErrorClass(err), Err: err}
+}
+
+// kubeErrorClass classifies the failure of a request of the Kubernetes API client by its
+// status, or else by its message like the stderr of kubectl
+func kubeErrorClass(err error) ErrorClass {
+	switch {
+	case apierrors.IsUnauthorized(err):
+		return ClassAuthExpired
+	case apierrors.IsForbidden(err):
+		return ClassPermissionDenied
+	case apierrors.IsNotFound(err):
+		return ClassNotFound
+	case apierrors.IsTooManyRequests(err):
+		return ClassQuota
+	case apierrors.IsInternalError(err), apierrors.IsServiceUnavailable(err), apierrors.IsServerTimeout(err),
+		apierrors.IsTimeout(err), apierrors.IsUnexpectedServerError(err):
+		return ClassServerError
+	}
+	return classifyFailure(-1, err.Error())
+}
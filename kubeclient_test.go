@@ -0,0 +1,387 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/apimachinery/pkg/util/httpstream/spdy"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/portforward"
+)
+
+// fakeCluster is an API server serving the pods and Services of its namespaces, and the
+// port-forwards to its pods, echoing their traffic
+type fakeCluster struct {
+	pods     []corev1.Pod
+	services []corev1.Service
+	// events are sent to the watches of pods, which then stay open like the API server's
+	events []watch.Event
+	// forbidden denies the port-forwards
+	forbidden bool
+
+	mu       sync.Mutex
+	requests []string
+}
+
+// testPod returns a pod of the app in namespace enr, created at the minute of the test day
+func testPod(name, app string, minute int, phase corev1.PodPhase, ready bool) corev1.Pod {
+	pod := corev1.Pod{
+		TypeMeta: metav1.TypeMeta{Kind: "Pod", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name, Namespace: "enr", Labels: map[string]string{"app": app},
+			CreationTimestamp: metav1.NewTime(time.Date(2026, 10, 1, 10, minute, 0, 0, time.UTC)),
+		},
+		Status: corev1.PodStatus{Phase: phase},
+	}
+	if owner := name[:max(strings.LastIndex(name, "-"), 0)]; owner != "" {
+		pod.OwnerReferences = []metav1.OwnerReference{{Kind: "ReplicaSet", Name: owner}}
+	}
+	status := corev1.ConditionFalse
+	if ready {
+		status = corev1.ConditionTrue
+	}
+	pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: status}}
+	return pod
+}
+
+// terminating marks the pod as deleted
+func terminating(pod corev1.Pod) corev1.Pod {
+	deleted := metav1.NewTime(time.Date(2026, 10, 15, 9, 0, 0, 0, time.UTC))
+	pod.DeletionTimestamp = &deleted
+	return pod
+}
+
+// startFakeCluster serves the cluster and points KUBECONFIG and the session's clients at it
+func startFakeCluster(t *testing.T, cluster *fakeCluster) {
+	server := httptest.NewServer(cluster)
+	t.Cleanup(server.Close)
+	kubeconfig := filepath.Join(t.TempDir(), "config")
+	config := fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: fake
+  cluster:
+    server: %s
+contexts:
+- name: fake
+  context:
+    cluster: fake
+    user: fake
+current-context: fake
+users:
+- name: fake
+  user:
+    token: fake-token
+`, server.URL)
+	if err := os.WriteFile(kubeconfig, []byte(config), 0600); err != nil {
+		t.Fatalf("Error writing the kubeconfig: %v", err)
+	}
+	t.Setenv("KUBECONFIG", kubeconfig)
+	saved := kubeAPI
+	kubeAPI = newKubeClients()
+	t.Cleanup(func() { kubeAPI = saved })
+}
+
+// requested returns the requests the cluster received
+func (c *fakeCluster) requested() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.requests...)
+}
+
+func (c *fakeCluster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	c.requests = append(c.requests, r.Method+" "+r.URL.RequestURI())
+	c.mu.Unlock()
+	// /api/v1/namespaces/<namespace>/<resource>[/<name>[/<subresource>]]
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/namespaces/"), "/")
+	if len(parts) < 2 {
+		http.NotFound(w, r)
+		return
+	}
+	namespace, resource := parts[0], parts[1]
+	switch {
+	case resource == "pods" && len(parts) == 4 && parts[3] == "portforward":
+		c.portForward(w, r, parts[2])
+	case resource == "pods" && len(parts) == 3:
+		for _, pod := range c.pods {
+			if pod.Namespace == namespace && pod.Name == parts[2] {
+				writeObject(w, http.StatusOK, &pod)
+				return
+			}
+		}
+		writeStatus(w, apierrors.NewNotFound(schema.GroupResource{Resource: "pods"}, parts[2]))
+	case resource == "pods" && r.URL.Query().Get("watch") == "true":
+		w.Header().Set("Content-Type", "application/json")
+		for _, event := range c.events {
+			json.NewEncoder(w).Encode(map[string]any{"type": event.Type, "object": event.Object})
+		}
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	case resource == "pods":
+		labelSelector, err := labels.Parse(r.URL.Query().Get("labelSelector"))
+		if err != nil {
+			writeStatus(w, apierrors.NewBadRequest(err.Error()))
+			return
+		}
+		fieldSelector, err := fields.ParseSelector(r.URL.Query().Get("fieldSelector"))
+		if err != nil {
+			writeStatus(w, apierrors.NewBadRequest(err.Error()))
+			return
+		}
+		list := &corev1.PodList{TypeMeta: metav1.TypeMeta{Kind: "PodList", APIVersion: "v1"}}
+		for _, pod := range c.pods {
+			if pod.Namespace == namespace && labelSelector.Matches(labels.Set(pod.Labels)) && fieldSelector.Matches(fields.Set{"metadata.name": pod.Name}) {
+				list.Items = append(list.Items, pod)
+			}
+		}
+		writeObject(w, http.StatusOK, list)
+	case resource == "services" && len(parts) == 3:
+		for _, service := range c.services {
+			if service.Namespace == namespace && service.Name == parts[2] {
+				writeObject(w, http.StatusOK, &service)
+				return
+			}
+		}
+		writeStatus(w, apierrors.NewNotFound(schema.GroupResource{Resource: "services"}, parts[2]))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// portForward serves a port-forward to the pod over SPDY, echoing the traffic of its
+// connections
+func (c *fakeCluster) portForward(w http.ResponseWriter, r *http.Request, pod string) {
+	if c.forbidden {
+		writeStatus(w, apierrors.NewForbidden(schema.GroupResource{Resource: "pods/portforward"}, pod, errors.New("user cannot create pods/portforward")))
+		return
+	}
+	if _, err := httpstream.Handshake(r, w, []string{portforward.PortForwardProtocolV1Name}); err != nil {
+		return
+	}
+	streams := make(chan httpstream.Stream)
+	conn := spdy.NewResponseUpgrader().UpgradeResponse(w, r, func(stream httpstream.Stream, replySent <-chan struct{}) error {
+		streams <- stream
+		return nil
+	})
+	if conn == nil {
+		return
+	}
+	defer conn.Close()
+	for {
+		select {
+		case stream := <-streams:
+			if stream.Headers().Get(corev1.StreamType) != corev1.StreamTypeData {
+				// no error to report
+				stream.Close()
+				continue
+			}
+			go func() {
+				defer stream.Close()
+				io.Copy(stream, stream)
+			}()
+		case <-conn.CloseChan():
+			return
+		}
+	}
+}
+
+// writeObject writes the object as JSON with the status code
+func writeObject(w http.ResponseWriter, code int, object any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(object)
+}
+
+// writeStatus writes the Status of the API error
+func writeStatus(w http.ResponseWriter, err *apierrors.StatusError) {
+	status := err.ErrStatus
+	status.TypeMeta = metav1.TypeMeta{Kind: "Status", APIVersion: "v1"}
+	writeObject(w, int(status.Code), &status)
+}
+
+func TestKubeClientShared(t *testing.T) {
+	cluster := &fakeCluster{pods: []corev1.Pod{testPod("cashfree-7d9f-abcde", "cashfree", 0, corev1.PodRunning, true)}}
+	startFakeCluster(t, cluster)
+	first, err := kubeAPI.client("fake")
+	if err != nil {
+		t.Fatalf("client failed: %v", err)
+	}
+	if second, err := kubeAPI.client("fake"); err != nil || second != first {
+		t.Errorf("client failed: expected the workloads of a context to share its client, got %v", err)
+	}
+	if _, err := kubeAPI.client("missing"); err == nil {
+		t.Errorf("client failed: expected an error for a context missing from the kubeconfig")
+	}
+
+	// the requests are recorded like the commands
+	path := filepath.Join(t.TempDir(), "audit.log")
+	saved := audit
+	if audit, err = openAuditLog(path, "staging"); err != nil {
+		t.Fatalf("Error opening the audit log: %v", err)
+	}
+	defer func() {
+		audit.close()
+		audit = saved
+	}()
+	pods, err := first.listPods(context.Background(), newCommandRunner(2, 0), "enr", metav1.ListOptions{LabelSelector: "app=cashfree"})
+	if err != nil || len(pods) != 1 {
+		t.Fatalf("listPods failed: expected the pod of the app, got %v, %v", pods, err)
+	}
+	records, _ := os.ReadFile(path)
+	if !strings.Contains(string(records), `"command":["GET","http://`) || !strings.Contains(string(records), "/api/v1/namespaces/enr/pods?labelSelector=app%3Dcashfree") {
+		t.Errorf("listPods failed: expected the request in the audit log, got %s", records)
+	}
+}
+
+func TestKubeErrorClass(t *testing.T) {
+	pods := schema.GroupResource{Resource: "pods"}
+	for _, tc := range []struct {
+		err      error
+		expected ErrorClass
+	}{
+		{apierrors.NewUnauthorized("token expired"), ClassAuthExpired},
+		{apierrors.NewForbidden(pods, "cashfree-0", errors.New("denied")), ClassPermissionDenied},
+		{apierrors.NewNotFound(pods, "cashfree-0"), ClassNotFound},
+		{apierrors.NewTooManyRequests("slow down", 1), ClassQuota},
+		{apierrors.NewServiceUnavailable("overloaded"), ClassServerError},
+		{apierrors.NewInternalError(errors.New("etcd")), ClassServerError},
+		{errors.New("dial tcp 10.0.0.1:443: connect: connection refused"), ClassHostUnreachable},
+		{errors.New("lost connection to pod"), ClassBrokenPipe},
+		{errors.New("error upgrading connection: Unauthorized"), ClassAuthExpired},
+	} {
+		err := newKubeError("kube-api GET /api/v1/namespaces/enr/pods/cashfree-0", tc.err)
+		if class := errorClass(err); class != tc.expected {
+			t.Errorf("newKubeError(%v) failed: expected class %s, got %s", tc.err, tc.expected, class)
+		}
+	}
+	var cmdErr *CommandError
+	if err := newKubeError("kube-api GET /api/v1/namespaces/enr/pods", apierrors.NewNotFound(pods, "x")); !errors.As(err, &cmdErr) || cmdErr.tool() != "kubectl" {
+		t.Errorf("newKubeError failed: expected the kubectl hints for the request, got %v", err)
+	}
+	if err := newKubeError("kube-api GET /", context.Canceled); err != context.Canceled {
+		t.Errorf("newKubeError failed: expected a canceled request to stay canceled, got %v", err)
+	}
+}
+
+// test for the retries of the requests, like the commands'
+func TestKubeCallRetries(t *testing.T) {
+	saved := retryBaseDelay
+	retryBaseDelay = time.Millisecond
+	defer func() { retryBaseDelay = saved }()
+	runner := newCommandRunner(2, 0).withTimeout(time.Minute, 2)
+	calls := 0
+	err := runner.call(context.Background(), "kube-api GET /", func(context.Context) error {
+		calls++
+		if calls < 3 {
+			return apierrors.NewServiceUnavailable("overloaded")
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("call failed: expected the request to succeed on its last retry, got %d calls, %v", calls, err)
+	}
+	calls = 0
+	err = runner.call(context.Background(), "kube-api GET /", func(context.Context) error {
+		calls++
+		return apierrors.NewNotFound(schema.GroupResource{Resource: "pods"}, "x")
+	})
+	if errorClass(err) != ClassNotFound || calls != 1 {
+		t.Errorf("call failed: expected a missing pod not to be retried, got %d calls, %v", calls, err)
+	}
+
+	runner = newCommandRunner(2, 0).withTimeout(50*time.Millisecond, 0)
+	err = runner.call(context.Background(), "kube-api GET /", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	var timeoutErr *CommandTimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Errorf("call failed: expected a timeout, got %v", err)
+	}
+}
+
+func TestPortForward(t *testing.T) {
+	cluster := &fakeCluster{}
+	startFakeCluster(t, cluster)
+	kubeAPI.protocol = portForwardSPDY
+	client, err := kubeAPI.client("")
+	if err != nil {
+		t.Fatalf("client failed: %v", err)
+	}
+	localPort, err := freeLocalPort()
+	if err != nil {
+		t.Fatalf("Error allocating port: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- client.portForward(ctx, newCommandRunner(2, 0), "enr", "cashfree-0", "127.0.0.1", localPort, 8080, io.Discard, io.Discard)
+	}()
+
+	var conn net.Conn
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		if conn, err = net.Dial("tcp", internalAddress(localPort)); err == nil {
+			break
+		}
+	}
+	if conn == nil {
+		t.Fatalf("portForward failed: the local port never listened: %v", err)
+	}
+	conn.Write([]byte("ping"))
+	reply := make([]byte, 4)
+	if _, err := io.ReadFull(conn, reply); err != nil || string(reply) != "ping" {
+		t.Errorf("portForward failed: expected echo through the pod, got %q (%v)", reply, err)
+	}
+	conn.Close()
+	if requests := strings.Join(cluster.requested(), "\n"); !strings.Contains(requests, "POST /api/v1/namespaces/enr/pods/cashfree-0/portforward") {
+		t.Errorf("portForward failed: unexpected requests %s", requests)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("portForward failed: expected no error once the context ended, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("portForward failed: the port-forward did not stop with its context")
+	}
+}
+
+func TestPortForwardForbidden(t *testing.T) {
+	startFakeCluster(t, &fakeCluster{forbidden: true})
+	client, err := kubeAPI.client("")
+	if err != nil {
+		t.Fatalf("client failed: %v", err)
+	}
+	localPort, err := freeLocalPort()
+	if err != nil {
+		t.Fatalf("Error allocating port: %v", err)
+	}
+	// the WebSocket port-forward is refused too, and falls back to SPDY
+	err = client.portForward(context.Background(), newCommandRunner(2, 0), "enr", "cashfree-0", "127.0.0.1", localPort, 8080, io.Discard, io.Discard)
+	if errorClass(err) != ClassPermissionDenied || !strings.Contains(err.Error(), "--address 127.0.0.1 "+strconv.Itoa(localPort)+":8080") {
+		t.Errorf("portForward failed: expected a denied port-forward, got %v", err)
+	}
+}
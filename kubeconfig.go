@@ -0,0 +1,30 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// kubeconfigPaths returns the kubeconfig files of the environment: the kubeconfig and
+// kubeconfigs of the cloud configuration followed by the environment's own, or
+// ~/.kube/config when none is set. kubectl merges them like the paths of KUBECONFIG, and
+// gcloud get-credentials writes to the first one.
+func kubeconfigPaths(cloud CloudConfig, proxyConfig ProxyConfig, homeDir string) []string {
+	var paths []string
+	for _, path := range append(append([]string{cloud.Kubeconfig}, cloud.Kubeconfigs...), proxyConfig.Kubeconfigs...) {
+		if path != "" && !slices.Contains(paths, path) {
+			paths = append(paths, path)
+		}
+	}
+	if len(paths) == 0 {
+		paths = []string{filepath.Join(homeDir, ".kube", "config")}
+	}
+	return paths
+}
+
+// kubeconfigEnv is the KUBECONFIG value merging the kubeconfig files
+func kubeconfigEnv(paths []string) string {
+	return strings.Join(paths, string(os.PathListSeparator))
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestKubeconfigPaths(t *testing.T) {
+	if paths := kubeconfigPaths(CloudConfig{}, ProxyConfig{}, "/home/me"); !slices.Equal(paths, []string{"/home/me/.kube/config"}) {
+		t.Errorf("kubeconfigPaths failed: expected the default kubeconfig, got %v", paths)
+	}
+	cloud := CloudConfig{Kubeconfig: "/etc/kube/main.yaml", Kubeconfigs: []string{"/etc/kube/data.yaml", "/etc/kube/main.yaml"}}
+	proxyConfig := ProxyConfig{Kubeconfigs: []string{"/etc/kube/spark.yaml"}}
+	paths := kubeconfigPaths(cloud, proxyConfig, "/home/me")
+	if expected := []string{"/etc/kube/main.yaml", "/etc/kube/data.yaml", "/etc/kube/spark.yaml"}; !slices.Equal(paths, expected) {
+		t.Errorf("kubeconfigPaths failed: expected %v, got %v", expected, paths)
+	}
+	if env := kubeconfigEnv(paths); env != "/etc/kube/main.yaml"+string(os.PathListSeparator)+"/etc/kube/data.yaml"+string(os.PathListSeparator)+"/etc/kube/spark.yaml" {
+		t.Errorf("kubeconfigEnv failed: unexpected KUBECONFIG %q", env)
+	}
+}
+
+func TestKubeconfigHasContextsMerged(t *testing.T) {
+	dir := t.TempDir()
+	for name, context := range map[string]string{"main": "gke_dev-project_asia-south1_main", "data": "gke_data-project_asia-south1_spark"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("contexts:\n- name: "+context+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	clusters := map[clusterRef]gkeCluster{
+		{project: "dev-project"}:  {Project: "dev-project", Location: "asia-south1", Name: "main"},
+		{project: "data-project"}: {Project: "data-project", Location: "asia-south1", Name: "spark"},
+	}
+	if !kubeconfigHasContexts(kubeconfigEnv([]string{filepath.Join(dir, "main"), filepath.Join(dir, "data")}), clusters) {
+		t.Error("kubeconfigHasContexts failed: expected the contexts of both files to be found")
+	}
+	if kubeconfigHasContexts(filepath.Join(dir, "main"), clusters) {
+		t.Error("kubeconfigHasContexts failed: expected the context of the other file to be missing")
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// maxLatencySamples is the number of recent samples kept per tunnel
+const maxLatencySamples = 100
+
+// latencySamples is a ring buffer of the most recent latency measurements
+type latencySamples struct {
+	values []time.Duration
+	next   int
+}
+
+func (l *latencySamples) add(d time.Duration) {
+	if len(l.values) < maxLatencySamples {
+		l.values = append(l.values, d)
+		return
+	}
+	l.values[l.next] = d
+	l.next = (l.next + 1) % maxLatencySamples
+}
+
+// percentile returns the p-th percentile (0-100) of the samples by nearest rank, the
+// smallest sample at least p percent of the samples are not above, or 0 if there are none
+func (l *latencySamples) percentile(p float64) time.Duration {
+	if l == nil || len(l.values) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), l.values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	index := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	return sorted[max(index, 0)]
+}
+
+// measureLatency opens a fresh connection through the tunnel and returns the time until the
+// remote service first answered (connection establishment through the tunnel) and the
+// round-trip time of a second request on the same connection. Only protocols with a cheap
+// request/response exchange are measured; for the others both values are zero.
+func measureLatency(protocol, address string, timeout time.Duration) (time.Duration, time.Duration, error) {
+	var request func(conn net.Conn, reader *bufio.Reader) error
+	switch protocol {
+	case "http":
+		request = func(conn net.Conn, reader *bufio.Reader) error {
+			if _, err := fmt.Fprintf(conn, "HEAD / HTTP/1.1\r\nHost: localhost\r\n\r\n"); err != nil {
+				return err
+			}
+			resp, err := http.ReadResponse(reader, nil)
+			if err != nil {
+				return err
+			}
+			return resp.Body.Close()
+		}
+	case "redis":
+		request = func(conn net.Conn, reader *bufio.Reader) error {
+			if _, err := conn.Write([]byte("PING\r\n")); err != nil {
+				return err
+			}
+			_, err := reader.ReadString('\n')
+			return err
+		}
+	case "postgres":
+		// the SSLRequest message is answered with a single byte and cannot be repeated,
+		// so postgres tunnels only report the connection establishment latency
+		start := time.Now()
+		conn, err := net.DialTimeout("tcp", address, timeout)
+		if err != nil {
+			return 0, 0, err
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(timeout))
+		sslRequest := make([]byte, 8)
+		binary.BigEndian.PutUint32(sslRequest[0:4], 8)
+		binary.BigEndian.PutUint32(sslRequest[4:8], 80877103)
+		if _, err := conn.Write(sslRequest); err != nil {
+			return 0, 0, err
+		}
+		if _, err := conn.Read(make([]byte, 1)); err != nil {
+			return 0, 0, err
+		}
+		return time.Since(start), 0, nil
+	default:
+		return 0, 0, nil
+	}
+
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * timeout))
+	reader := bufio.NewReader(conn)
+	if err := request(conn, reader); err != nil {
+		return 0, 0, err
+	}
+	connect := time.Since(start)
+	start = time.Now()
+	if err := request(conn, reader); err != nil {
+		return connect, 0, err
+	}
+	return connect, time.Since(start), nil
+}
+
+// formatPercentiles renders p50/p95 of the samples, e.g. "12ms/40ms"
+func formatPercentiles(p50, p95 time.Duration) string {
+	if p50 == 0 && p95 == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%s/%s", p50.Round(time.Millisecond), p95.Round(time.Millisecond))
+}
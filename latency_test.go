@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestLatencySamples(t *testing.T) {
+	var samples latencySamples
+	for i := 1; i <= maxLatencySamples+10; i++ {
+		samples.add(time.Duration(i) * time.Millisecond)
+	}
+	if len(samples.values) != maxLatencySamples {
+		t.Fatalf("latencySamples failed: expected %d samples, got %d", maxLatencySamples, len(samples.values))
+	}
+	if p50 := samples.percentile(50); p50 != 60*time.Millisecond {
+		t.Errorf("percentile failed: expected p50 60ms, got %s", p50)
+	}
+	if p95 := samples.percentile(95); p95 != 105*time.Millisecond {
+		t.Errorf("percentile failed: expected p95 105ms, got %s", p95)
+	}
+
+	// the p95 of few samples is the largest one
+	few := latencySamples{values: []time.Duration{20 * time.Millisecond, 10 * time.Millisecond}}
+	if p95 := few.percentile(95); p95 != 20*time.Millisecond {
+		t.Errorf("percentile failed: expected p95 20ms of 2 samples, got %s", p95)
+	}
+	if p50 := few.percentile(50); p50 != 10*time.Millisecond {
+		t.Errorf("percentile failed: expected p50 10ms of 2 samples, got %s", p50)
+	}
+}
+
+// test for measureLatency against a fake redis server
+func TestMeasureLatency(t *testing.T) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Error creating listener: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		for {
+			if _, err := reader.ReadString('\n'); err != nil {
+				return
+			}
+			conn.Write([]byte("+PONG\r\n"))
+		}
+	}()
+
+	connect, rtt, err := measureLatency("redis", listener.Addr().String(), time.Second)
+	if err != nil {
+		t.Fatalf("measureLatency failed: %v", err)
+	}
+	if connect <= 0 || rtt <= 0 {
+		t.Errorf("measureLatency failed: expected positive latencies, got %s and %s", connect, rtt)
+	}
+}
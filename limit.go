@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// connectionLimit bounds the connections open through a tunnel at once, so that a loop or a
+// load test through the tunnel cannot overwhelm a fragile service
+type connectionLimit struct {
+	name  string
+	max   int
+	queue bool
+	slots chan struct{}
+}
+
+// newConnectionLimit returns the limit of the tunnel, nil when max is zero
+func newConnectionLimit(name string, max int, queue bool) *connectionLimit {
+	if max <= 0 {
+		return nil
+	}
+	return &connectionLimit{name: name, max: max, queue: queue, slots: make(chan struct{}, max)}
+}
+
+// acquire takes a slot for a new connection, waiting for one if connections are queued. It
+// reports false when the connection must be refused.
+func (l *connectionLimit) acquire(ctx context.Context) bool {
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+	}
+	if !l.queue {
+		fmt.Printf("Warning: refused a connection to %s, its %d connections are already open (max_connections).\n", l.name, l.max)
+		return false
+	}
+	fmt.Printf("Queued a connection to %s until one of its %d open connections closes (max_connections).\n", l.name, l.max)
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// release frees the slot of a closed connection
+func (l *connectionLimit) release() {
+	<-l.slots
+}
+
+// validateConnectionLimits checks that the connection limits of the tunnels are not negative
+func validateConnectionLimits(config ProxyConfig) error {
+	for _, workload := range config.Workloads {
+		if workload.MaxConnections < 0 {
+			return fmt.Errorf("workload %s: max_connections must not be negative, got %d", workload.Name(), workload.MaxConnections)
+		}
+	}
+	for _, connection := range config.Bastion.Connections {
+		if connection.MaxConnections < 0 {
+			return fmt.Errorf("connection %s: max_connections must not be negative, got %d", connection.Name(), connection.MaxConnections)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestConnectionLimit(t *testing.T) {
+	if newConnectionLimit("cashfree", 0, false) != nil {
+		t.Error("newConnectionLimit failed: expected no limit for max_connections 0")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	refused := newConnectionLimit("cashfree", 1, false)
+	if !refused.acquire(ctx) || refused.acquire(ctx) {
+		t.Error("acquire failed: expected the second connection to be refused")
+	}
+	refused.release()
+	if !refused.acquire(ctx) {
+		t.Error("acquire failed: expected a slot once the connection closed")
+	}
+
+	queued := newConnectionLimit("cashfree", 1, true)
+	queued.acquire(ctx)
+	acquired := make(chan bool)
+	go func() { acquired <- queued.acquire(ctx) }()
+	select {
+	case <-acquired:
+		t.Fatal("acquire failed: expected the second connection to be queued")
+	case <-time.After(50 * time.Millisecond):
+	}
+	queued.release()
+	if !<-acquired {
+		t.Error("acquire failed: expected the queued connection to get the slot")
+	}
+}
+
+func TestRelayConnectionLimit(t *testing.T) {
+	echo, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Error creating listener: %v", err)
+	}
+	defer echo.Close()
+	go func() {
+		for {
+			conn, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	port, err := freeLocalPort()
+	if err != nil {
+		t.Fatalf("Error allocating port: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go runMeterRelay(ctx, nil, "cashfree", port, echo.Addr().(*net.TCPAddr).Port, nil, newConnectionLimit("cashfree", 1, false))
+
+	first := dialRelay(t, port)
+	defer first.Close()
+	first.Write([]byte("ping"))
+	reply := make([]byte, 4)
+	if _, err := io.ReadFull(first, reply); err != nil {
+		t.Fatalf("relay failed: %v", err)
+	}
+	second := dialRelay(t, port)
+	defer second.Close()
+	second.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := second.Read(reply); err == nil {
+		t.Error("relay failed: expected the connection beyond max_connections to be closed")
+	}
+}
+
+func TestValidateConnectionLimits(t *testing.T) {
+	config := ProxyConfig{Workloads: []Workload{{App: "cashfree", MaxConnections: -1}}}
+	if err := validateConnectionLimits(config); err == nil {
+		t.Error("validateConnectionLimits failed: expected an error for a negative max_connections")
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// environmentOutput is the schema of an environment in devcli list output
+type environmentOutput struct {
+	Environment string             `json:"environment" yaml:"environment"`
+	Default     bool               `json:"default" yaml:"default"`
+	Project     string             `json:"project" yaml:"project"`
+	Bastion     string             `json:"bastion" yaml:"bastion"`
+	Workloads   []workloadOutput   `json:"workloads" yaml:"workloads"`
+	Connections []connectionOutput `json:"connections" yaml:"connections"`
+}
+
+// workloadOutput is the schema of a workload in devcli list output
+type workloadOutput struct {
+	Name       string   `json:"name" yaml:"name"`
+	Namespace  string   `json:"namespace" yaml:"namespace"`
+	LocalPort  int      `json:"local_port" yaml:"local_port"`
+	RemotePort int      `json:"remote_port" yaml:"remote_port"`
+	Protocol   string   `json:"protocol" yaml:"protocol"`
+	Project    string   `json:"project" yaml:"project"`
+	Cluster    string   `json:"cluster" yaml:"cluster"`
+	Tags       []string `json:"tags" yaml:"tags"`
+}
+
+// connectionOutput is the schema of a bastion connection in devcli list output
+type connectionOutput struct {
+	Name       string   `json:"name" yaml:"name"`
+	LocalPort  int      `json:"local_port" yaml:"local_port"`
+	RemoteHost string   `json:"remote_host" yaml:"remote_host"`
+	RemotePort int      `json:"remote_port" yaml:"remote_port"`
+	Protocol   string   `json:"protocol" yaml:"protocol"`
+	Project    string   `json:"project" yaml:"project"`
+	Tags       []string `json:"tags" yaml:"tags"`
+}
+
+// runList implements devcli list, which prints the environments of the configuration and
+// the workloads and connections of each one
+func runList(args []string) {
+	fs := flag.NewFlagSet("devcli list", flag.ExitOnError)
+	confFile := fs.String("conf", "", "Path to the configuration file")
+	environment := fs.String("env", "", "Only list this environment")
+	var format string
+	outputFlag(fs, &format)
+	fs.Parse(args)
+	if err := checkOutputFormat(format); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(2)
+	}
+
+	path, err := configPath(*confFile)
+	if err != nil {
+		fmt.Println("Error getting user home directory:", err)
+		os.Exit(1)
+	}
+	config, err := readConfig(path)
+	if err != nil {
+		fmt.Println("Error reading configuration file:", err)
+		os.Exit(1)
+	}
+	environments := listEnvironments(config, *environment)
+	if *environment != "" && len(environments) == 0 {
+		fmt.Printf("Error: proxy configuration for environment %s is not found\n", *environment)
+		os.Exit(1)
+	}
+	if err := writeOutput(os.Stdout, format, environments, func(w io.Writer) { writeEnvironments(w, environments) }); err != nil {
+		fmt.Println("Error writing the list:", err)
+		os.Exit(1)
+	}
+}
+
+// listEnvironments returns the environments of the configuration, or only the named one
+func listEnvironments(config Config, only string) []environmentOutput {
+	environments := []environmentOutput{}
+	for _, proxy := range config.Proxies {
+		if only != "" && proxy.Environment != only {
+			continue
+		}
+		environment := environmentOutput{
+			Environment: proxy.Environment,
+			Default:     proxy.Environment == config.Environment,
+			Project:     proxy.CloudProject,
+			Bastion:     proxy.Bastion.Name,
+			Workloads:   []workloadOutput{},
+			Connections: []connectionOutput{},
+		}
+		for _, workload := range proxy.Workloads {
+			environment.Workloads = append(environment.Workloads, workloadOutput{
+				Name:       workload.Name(),
+				Namespace:  workload.Namespace,
+				LocalPort:  workload.LocalPort,
+				RemotePort: workload.RemotePort,
+				Protocol:   workload.Protocol,
+				Project:    workload.Project,
+				Cluster:    workload.Cluster,
+				Tags:       append([]string{}, workload.Tags...),
+			})
+		}
+		for _, connection := range proxy.Bastion.Connections {
+			environment.Connections = append(environment.Connections, connectionOutput{
+				Name:       connection.Name(),
+				LocalPort:  connection.LocalPort,
+				RemoteHost: connection.RemoteHost,
+				RemotePort: connection.RemotePort,
+				Protocol:   connection.Protocol,
+				Project:    connection.Project,
+				Tags:       append([]string{}, connection.Tags...),
+			})
+		}
+		environments = append(environments, environment)
+	}
+	return environments
+}
+
+// writeEnvironments prints the environments with a table of their tunnels
+func writeEnvironments(w io.Writer, environments []environmentOutput) {
+	if len(environments) == 0 {
+		fmt.Fprintln(w, "The configuration file has no environments.")
+	}
+	for i, environment := range environments {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		title := fmt.Sprintf("Environment %s: project %s", environment.Environment, environment.Project)
+		if environment.Bastion != "" {
+			title += ", bastion " + environment.Bastion
+		}
+		if environment.Default {
+			title += " (default)"
+		}
+		fmt.Fprintln(w, title)
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "  TUNNEL\tKIND\tLOCAL PORT\tREMOTE\tPROTOCOL\tTAGS")
+		for _, workload := range environment.Workloads {
+			remotePort := strconv.Itoa(workload.RemotePort)
+			if workload.RemotePort == 0 {
+				remotePort = "auto"
+			}
+			remote := fmt.Sprintf("%s/%s:%s", workload.Namespace, workload.Name, remotePort)
+			if workload.Cluster != "" {
+				remote = workload.Cluster + ":" + remote
+			}
+			if workload.Project != "" {
+				remote = workload.Project + "/" + remote
+			}
+			fmt.Fprintf(tw, "  %s\t%s\t%d\t%s\t%s\t%s\n", workload.Name, kindWorkload, workload.LocalPort, remote, workload.Protocol, strings.Join(workload.Tags, ","))
+		}
+		for _, connection := range environment.Connections {
+			remote := connection.Name
+			if connection.Project != "" {
+				remote = connection.Project + "/" + remote
+			}
+			fmt.Fprintf(tw, "  %s\t%s\t%d\t%s\t%s\t%s\n", connection.Name, kindBastion, connection.LocalPort, remote, connection.Protocol, strings.Join(connection.Tags, ","))
+		}
+		tw.Flush()
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestListEnvironments(t *testing.T) {
+	config := Config{
+		Environment: "staging",
+		Proxies: []ProxyConfig{
+			{
+				Environment:  "staging",
+				CloudProject: "okcredit-staging-env",
+				Bastion: Bastion{Name: "bastion", Connections: []Connection{
+					{LocalPort: 5435, RemoteHost: "10.120.52.48", RemotePort: 5432, Protocol: "postgres", Tags: []string{"db"}},
+				}},
+				Workloads: []Workload{{Namespace: "enr", App: "cashfree", LocalPort: 8080, RemotePort: 8080, Protocol: "http", Cluster: "services"}},
+			},
+			{Environment: "prod", CloudProject: "okcredit-42"},
+		},
+	}
+	environments := listEnvironments(config, "")
+	if len(environments) != 2 || !environments[0].Default || environments[1].Default {
+		t.Fatalf("listEnvironments failed: unexpected environments %+v", environments)
+	}
+	if workload := environments[0].Workloads[0]; workload.Name != "cashfree" || workload.Cluster != "services" || workload.LocalPort != 8080 {
+		t.Errorf("listEnvironments failed: unexpected workload %+v", workload)
+	}
+	if connection := environments[0].Connections[0]; connection.Name != "10.120.52.48:5432" || connection.Tags[0] != "db" {
+		t.Errorf("listEnvironments failed: unexpected connection %+v", connection)
+	}
+	if environments[1].Workloads == nil || environments[1].Connections == nil {
+		t.Error("listEnvironments failed: empty lists should not be null in json output")
+	}
+	if only := listEnvironments(config, "prod"); len(only) != 1 || only[0].Project != "okcredit-42" {
+		t.Errorf("listEnvironments failed: unexpected environments for prod %+v", only)
+	}
+
+	var out bytes.Buffer
+	writeEnvironments(&out, environments)
+	for _, expected := range []string{"Environment staging: project okcredit-staging-env, bastion bastion (default)", "services:enr/cashfree:8080", "Environment prod: project okcredit-42\n"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("writeEnvironments failed: missing %q in\n%s", expected, out.String())
+		}
+	}
+}
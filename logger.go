@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// logger is devcli's logger. Output of child processes goes through it as well, one line at
+// a time and tagged with the tunnel (or tool) it came from, instead of being written
+// straight to the terminal.
+var logger = newConsoleLogger(os.Stdout)
+
+// quiet suppresses the narration of the session's steps, set by -quiet
+var quiet bool
+
+// stdoutTerminal is whether devcli writes to a terminal, decorative output is left out otherwise
+var stdoutTerminal = isTerminal(os.Stdout)
+
+// isTerminal reports whether the file is a terminal
+func isTerminal(f *os.File) bool {
+	stat, err := f.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+// narrate prints a step of the session with -verbose, the progress display shows the
+// phases of the session otherwise
+func narrate(args ...interface{}) {
+	if verbose && !quiet {
+		fmt.Println(args...)
+	}
+}
+
+// narratef is narrate with a format
+func narratef(format string, args ...interface{}) {
+	if verbose && !quiet {
+		fmt.Printf(format, args...)
+	}
+}
+
+// decorate prints output that only helps someone watching a terminal, such as the banner
+func decorate(args ...interface{}) {
+	if !quiet && stdoutTerminal {
+		fmt.Println(args...)
+	}
+}
+
+// narrationWriter returns the writer of command output that only narrates, such as
+// version dumps, which is discarded unless running with -verbose. Failures are still
+// reported from the command's error.
+func narrationWriter(name string) io.Writer {
+	if !verbose || quiet {
+		return io.Discard
+	}
+	return logger.Writer(name)
+}
+
+// consoleLogger writes whole lines to an output, safe for concurrent use. Once the output
+// is serialized it is the only writer of the process' output.
+type consoleLogger struct {
+	mu  sync.Mutex
+	out io.Writer
+	// copies receive everything written as well, like the output broadcast of devcli attach
+	copies []io.Writer
+}
+
+func newConsoleLogger(out io.Writer) *consoleLogger {
+	return &consoleLogger{out: out}
+}
+
+// Printf writes a formatted message
+func (l *consoleLogger) Printf(format string, args ...interface{}) {
+	l.write(fmt.Sprintf(format, args...))
+}
+
+// Println writes its arguments separated by spaces, like fmt.Println
+func (l *consoleLogger) Println(args ...interface{}) {
+	l.write(fmt.Sprintln(args...))
+}
+
+// Write writes p as it is, callers are expected to write whole lines
+func (l *consoleLogger) Write(p []byte) (int, error) {
+	l.write(string(p))
+	return len(p), nil
+}
+
+func (l *consoleLogger) write(s string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	io.WriteString(l.out, s)
+	for _, w := range l.copies {
+		io.WriteString(w, s)
+	}
+}
+
+// copyTo writes everything written from now on to w as well
+func (l *consoleLogger) copyTo(w io.Writer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.copies = append(l.copies, w)
+}
+
+// Writer returns a writer for a child process' stdout or stderr. Every line written to it
+// is sanitized and logged with a [name] prefix, except lines containing one of the ignore
+// fragments.
+func (l *consoleLogger) Writer(name string, ignore ...string) io.Writer {
+	return &lineWriter{logger: l, prefix: "[" + name + "] ", ignore: ignore}
+}
+
+// lineWriter buffers partial lines until they are complete
+type lineWriter struct {
+	mu      sync.Mutex
+	logger  *consoleLogger
+	prefix  string
+	ignore  []string
+	partial []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.partial = append(w.partial, p...)
+	for {
+		i := strings.IndexByte(string(w.partial), '\n')
+		if i < 0 {
+			break
+		}
+		line := sanitizeLine(string(w.partial[:i]))
+		w.partial = w.partial[i+1:]
+		if line != "" && !w.ignored(line) {
+			w.logger.write(w.prefix + line + "\n")
+		}
+	}
+	return len(p), nil
+}
+
+func (w *lineWriter) ignored(line string) bool {
+	for _, fragment := range w.ignore {
+		if strings.Contains(line, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// ansiEscape matches terminal escape sequences (colors, cursor movement, title changes)
+var ansiEscape = regexp.MustCompile(`\x1b(\[[0-9;?]*[ -/]*[@-~]|\][^\x07\x1b]*(\x07|\x1b\\)|[@-Z\\-_])`)
+
+// sanitizeLine removes escape sequences and control characters that could mess up the
+// user's terminal, keeping only what follows the last carriage return
+func sanitizeLine(line string) string {
+	line = ansiEscape.ReplaceAllString(line, "")
+	if i := strings.LastIndexByte(strings.TrimRight(line, "\r"), '\r'); i >= 0 {
+		line = line[i+1:]
+	}
+	return strings.TrimRightFunc(strings.Map(func(r rune) rune {
+		if r == '\t' || r >= 0x20 && r != 0x7f {
+			return r
+		}
+		return -1
+	}, line), func(r rune) bool { return r == ' ' })
+}
+
+// logHistory is the number of lines of output kept for clients that attach to the session
+const logHistory = 200
+
+// outputBroadcast copies the process' output to clients attached to the session, keeping
+// the last lines for the ones that attach later. It is safe for concurrent use.
+type outputBroadcast struct {
+	mu          sync.Mutex
+	history     []string
+	partial     string
+	subscribers map[chan string]struct{}
+}
+
+func newOutputBroadcast() *outputBroadcast {
+	return &outputBroadcast{subscribers: make(map[chan string]struct{})}
+}
+
+// Write splits p into lines and sends every complete line to the subscribers
+func (b *outputBroadcast) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	lines := strings.Split(b.partial+string(p), "\n")
+	b.partial = lines[len(lines)-1]
+	for _, line := range lines[:len(lines)-1] {
+		line = sanitizeLine(line)
+		b.history = append(b.history, line)
+		if len(b.history) > logHistory {
+			b.history = b.history[len(b.history)-logHistory:]
+		}
+		for ch := range b.subscribers {
+			// a subscriber that does not keep up misses lines rather than blocking the session
+			select {
+			case ch <- line:
+			default:
+			}
+		}
+	}
+	return len(p), nil
+}
+
+// subscribe returns the recent lines of output and a channel receiving every new line,
+// until unsubscribe is called
+func (b *outputBroadcast) subscribe() (history []string, lines <-chan string, unsubscribe func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ch := make(chan string, 256)
+	b.subscribers[ch] = struct{}{}
+	return append([]string(nil), b.history...), ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subscribers, ch)
+	}
+}
+
+// serializeOutput makes the logger the single writer of the process' output. What goroutines
+// print with fmt goes through a pipe read by one goroutine, which hands it to the logger one
+// whole line at a time, so that concurrent lines and child process output never mix. restore
+// writes out what is left in the pipe and puts the original stdout back.
+func serializeOutput() (restore func(), err error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout := os.Stdout
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		reader := bufio.NewReader(r)
+		for {
+			line, err := reader.ReadString('\n')
+			if line != "" {
+				if err != nil {
+					line += "\n"
+				}
+				logger.write(line)
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	os.Stdout = w
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			os.Stdout = stdout
+			w.Close()
+			<-done
+		})
+	}, nil
+}
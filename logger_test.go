@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestLoggerWriter(t *testing.T) {
+	var out bytes.Buffer
+	l := newConsoleLogger(&out)
+	w := l.Writer("cashfree", "Handling connection for")
+
+	w.Write([]byte("Forwarding from 127.0.0.1:8080 -> 8080\nHandling connection for 8080\nE0101 error "))
+	w.Write([]byte("forwarding port\n"))
+	expected := "[cashfree] Forwarding from 127.0.0.1:8080 -> 8080\n[cashfree] E0101 error forwarding port\n"
+	if out.String() != expected {
+		t.Errorf("Writer failed: expected %q, got %q", expected, out.String())
+	}
+}
+
+func TestSanitizeLine(t *testing.T) {
+	tests := map[string]string{
+		"\x1b[1;31mERROR:\x1b[0m permission denied": "ERROR: permission denied",
+		"\x1b]0;bastion: ~\x07Welcome":              "Welcome",
+		"progress 10%\rprogress 100%\r":             "progress 100%",
+		"bell\x07 and\ttab  ":                       "bell and\ttab",
+	}
+	for line, expected := range tests {
+		if sanitized := sanitizeLine(line); sanitized != expected {
+			t.Errorf("sanitizeLine failed for %q: expected %q, got %q", line, expected, sanitized)
+		}
+	}
+}
+
+func TestNarrationWriter(t *testing.T) {
+	var out bytes.Buffer
+	original := logger
+	logger = newConsoleLogger(&out)
+	defer func() {
+		logger = original
+		quiet = false
+		verbose = false
+	}()
+
+	fmt.Fprintln(narrationWriter("gcloud"), "Google Cloud SDK 469.0.0")
+	verbose = true
+	fmt.Fprintln(narrationWriter("gcloud"), "Google Cloud SDK 470.0.0")
+	quiet = true
+	fmt.Fprintln(narrationWriter("gcloud"), "Updated property [core/project].")
+	if out.String() != "[gcloud] Google Cloud SDK 470.0.0\n" {
+		t.Errorf("narrationWriter failed: unexpected output %q", out.String())
+	}
+}
+
+func TestSerializeOutput(t *testing.T) {
+	var out, copied bytes.Buffer
+	original := logger
+	logger = newConsoleLogger(&out)
+	defer func() { logger = original }()
+	logger.copyTo(&copied)
+
+	restore, err := serializeOutput()
+	if err != nil {
+		t.Fatalf("serializeOutput failed: %v", err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := logger.Writer(fmt.Sprintf("tunnel-%d", i))
+			for j := 0; j < 50; j++ {
+				fmt.Println("goroutine", i, "prints line", j)
+				w.Write([]byte("child output "))
+				w.Write([]byte("of the tunnel\n"))
+			}
+		}()
+	}
+	wg.Wait()
+	fmt.Print("last line without a newline")
+	restore()
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 8*50*2+1 {
+		t.Errorf("serializeOutput failed: expected %d lines, got %d", 8*50*2+1, len(lines))
+	}
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "goroutine ") && !strings.HasSuffix(line, "] child output of the tunnel") && line != "last line without a newline" {
+			t.Errorf("serializeOutput failed: mixed line %q", line)
+		}
+	}
+	if copied.String() != out.String() {
+		t.Error("copyTo failed: the copy differs from the output")
+	}
+}
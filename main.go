@@ -5,134 +5,454 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"maps"
 	"os"
 	"os/exec"
 	"os/signal"
+	"path/filepath"
+	"slices"
 	"strings"
-	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 
-	"gopkg.in/yaml.v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 type Connection struct {
-	LocalPort  int    `yaml:"local_port"`
-	RemoteHost string `yaml:"remote_host"`
-	RemotePort int    `yaml:"remote_port"`
+	LocalPort  int      `yaml:"local_port"`
+	RemoteHost string   `yaml:"remote_host"`
+	RemotePort int      `yaml:"remote_port"`
+	Protocol   string   `yaml:"protocol"`
+	Tags       []string `yaml:"tags"`
+	// Project is the project of the bastion this connection goes through, when it is not
+	// the environment's
+	Project string `yaml:"project"`
+	// Hostname is the hostname of the connection's Cloudflare Access application, with a
+	// cloudflared bastion
+	Hostname string `yaml:"hostname"`
+	// DisallowProtected leaves the connection out of the session when its environment is protected
+	DisallowProtected bool `yaml:"disallow_protected"`
+	// ReadOnlyHint is shown in the banner of protected environments, e.g. the read-only user
+	ReadOnlyHint string `yaml:"read_only_hint"`
+	// MaxConnections limits the connections open through the tunnel at once, unlimited when zero
+	MaxConnections int `yaml:"max_connections"`
+	// QueueConnections queues the connections beyond MaxConnections instead of refusing them
+	QueueConnections bool `yaml:"queue_connections"`
+
+	// internal is set when LocalPort is an internal port behind the connection's local port
+	internal bool
+}
+
+// host returns the address the connection's local port listens on
+func (c Connection) host() string {
+	if c.internal {
+		return internalHost
+	}
+	return listenHost
+}
+
+// Name identifies the connection in logs and status output
+func (c Connection) Name() string {
+	if c.RemoteHost == "" && c.Hostname != "" {
+		return c.Hostname
+	}
+	return fmt.Sprintf("%s:%d", c.RemoteHost, c.RemotePort)
 }
 
 type Bastion struct {
 	Name        string       `yaml:"name"`
 	Zone        string       `yaml:"zone"`
 	Connections []Connection `yaml:"connections"`
+	// Type is iap (the default), the bastion instance reached with gcloud compute ssh, or
+	// cloudflared, the Cloudflare Access applications of the connections' hostnames
+	Type string `yaml:"type"`
+	// HostKeyPolicy is how the host key of an iap bastion is verified: tofu (the default),
+	// gcloud or pinned to the KnownHosts entries, each a key type and base64 encoded key
+	HostKeyPolicy string   `yaml:"host_key_policy"`
+	KnownHosts    []string `yaml:"known_hosts"`
+	// knownHosts is the file the pinned keys are written to at startup
+	knownHosts string
+	// login and identity are the user and the identity file a pinned bastion is reached
+	// with, those of gcloud compute ssh
+	login    string
+	identity string
 }
 
 type Workload struct {
-	Namespace  string `yaml:"namespace"`
-	App        string `yaml:"app"`
-	LocalPort  int    `yaml:"local_port"`
-	RemotePort int    `yaml:"remote_port"`
+	Namespace     string   `yaml:"namespace"`
+	App           string   `yaml:"app"`
+	LocalPort     int      `yaml:"local_port"`
+	RemotePort    int      `yaml:"remote_port"`
+	Protocol      string   `yaml:"protocol"`
+	HealthService string   `yaml:"health_service"`
+	Tags          []string `yaml:"tags"`
+	// Project is the project of the workload's cluster, when it is not the environment's
+	Project string `yaml:"project"`
+	// Cluster is the name of the workload's cluster, the first cluster of the project when empty
+	Cluster string `yaml:"cluster"`
+	// StatefulSet and Ordinal select a single replica of a StatefulSet, e.g. the primary of a
+	// database, instead of a ready pod of the app
+	StatefulSet string `yaml:"statefulset"`
+	Ordinal     int    `yaml:"ordinal"`
+	// Pod is the exact name of the pod to forward to, e.g. to debug a specific replica
+	Pod string `yaml:"pod"`
+	// DisallowProtected leaves the workload out of the session when its environment is protected
+	DisallowProtected bool `yaml:"disallow_protected"`
+	// ReadOnlyHint is shown in the banner of protected environments
+	ReadOnlyHint string `yaml:"read_only_hint"`
+	// MaxConnections limits the connections open through the tunnel at once, unlimited when zero
+	MaxConnections int `yaml:"max_connections"`
+	// QueueConnections queues the connections beyond MaxConnections instead of refusing them
+	QueueConnections bool `yaml:"queue_connections"`
+	// HealthGate keeps the local port closed while the workload is not ready through the tunnel
+	HealthGate bool `yaml:"health_gate"`
+
+	// kubeContext is the kubeconfig context of the workload's cluster
+	kubeContext string
+	// manifest is the service manifest the workload is derived from, empty for the workloads
+	// of the configuration file
+	manifest string
+}
+
+// Name identifies the workload in logs and status output, the app or else the pod it
+// forwards to
+func (w Workload) Name() string {
+	if w.App == "" {
+		return w.pinnedPod()
+	}
+	return w.App
+}
+
+// pinnedPod is the name of the single pod the workload forwards to with pod or statefulset,
+// empty when it forwards to any pod of its app
+func (w Workload) pinnedPod() string {
+	switch {
+	case w.Pod != "":
+		return w.Pod
+	case w.StatefulSet != "":
+		return w.statefulSetPod()
+	}
+	return ""
+}
+
+// statefulSetPod is the name of the pod of the workload's StatefulSet replica
+func (w Workload) statefulSetPod() string {
+	return fmt.Sprintf("%s-%d", w.StatefulSet, w.Ordinal)
+}
+
+// podSelector selects the pods of the workload in the requests listing or watching them
+func (w Workload) podSelector() metav1.ListOptions {
+	if pod := w.pinnedPod(); pod != "" {
+		return metav1.ListOptions{FieldSelector: "metadata.name=" + pod}
+	}
+	return metav1.ListOptions{LabelSelector: "app=" + w.App}
+}
+
+// pods describes the pods of the workload in messages, e.g. app=cashfree or pod kafka-0
+func (w Workload) pods() string {
+	if pod := w.pinnedPod(); pod != "" {
+		return "pod " + pod
+	}
+	return "app=" + w.App
+}
+
+// validateWorkloads checks that every workload selects its pods
+func validateWorkloads(config ProxyConfig) error {
+	for _, workload := range config.Workloads {
+		if workload.App == "" && workload.pinnedPod() == "" {
+			return fmt.Errorf("workload on local port %d sets none of app, statefulset and pod", workload.LocalPort)
+		}
+		if workload.Pod != "" && workload.StatefulSet != "" {
+			return fmt.Errorf("workload %s sets both pod and statefulset", workload.Name())
+		}
+		if workload.Ordinal < 0 {
+			return fmt.Errorf("workload %s has the negative ordinal %d", workload.Name(), workload.Ordinal)
+		}
+		if workload.Ordinal != 0 && workload.StatefulSet == "" {
+			return fmt.Errorf("workload %s sets an ordinal without a statefulset", workload.Name())
+		}
+		if err := validateWildcard(workload); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 type CloudConfig struct {
 	Gcloudconfig string `yaml:"gcloudconfig"`
 	Kubeconfig   string `yaml:"kubeconfig"`
+	// Kubeconfigs are more kubeconfig files merged with kubeconfig, like the paths of KUBECONFIG
+	Kubeconfigs []string `yaml:"kubeconfigs"`
 }
 
 type ProxyConfig struct {
-	Environment  string     `yaml:"environment"`
-	CloudProject string     `yaml:"cloud_project"`
-	Bastion      Bastion    `yaml:"bastion"`
-	Workloads    []Workload `yaml:"workloads"`
+	Environment  string      `yaml:"environment"`
+	CloudProject string      `yaml:"cloud_project"`
+	Bastion      Bastion     `yaml:"bastion"`
+	Workloads    []Workload  `yaml:"workloads"`
+	Chaos        []ChaosRule `yaml:"chaos"`
+	Hooks        Hooks       `yaml:"hooks"`
+	// Proxy is the empty "- proxy:" key the configuration template starts every environment
+	// with, it is accepted and ignored
+	Proxy interface{} `yaml:"proxy,omitempty"`
+	// ConnectGateway reaches the private clusters of the environment without a bastion
+	ConnectGateway ConnectGateway `yaml:"connect_gateway"`
+	APIProxy       APIProxy       `yaml:"api_proxy"`
+	// MaxSession tears the session down after it ran this long, mandatory for production
+	MaxSession time.Duration `yaml:"max_session"`
+	// AllowedHours are the only hours the environment may be connected to
+	AllowedHours AllowedHours `yaml:"allowed_hours"`
+	// Kubeconfigs are the kubeconfig files of the environment's clusters, merged with the
+	// ones of the cloud configuration
+	Kubeconfigs []string `yaml:"kubeconfigs"`
+	// KubeContext is an existing kubeconfig context the workloads use, instead of the
+	// clusters devcli looks up and fetches the credentials of
+	KubeContext string `yaml:"kube_context"`
+	// Tmux lays out the session of devcli tmux
+	Tmux Tmux `yaml:"tmux"`
+	// Approval requests the access to the environment from the approvers before every session
+	Approval Approval `yaml:"approval"`
+	// Protected asks to type the environment's name before connecting to it and shows a
+	// banner while the session runs
+	Protected bool `yaml:"protected"`
+	// ShutdownGrace is how long the connections in flight get to finish when the session ends
+	ShutdownGrace time.Duration `yaml:"shutdown_grace"`
+	// CircuitBreaker degrades the tunnels that keep failing instead of restarting them
+	CircuitBreaker CircuitBreaker `yaml:"circuit_breaker"`
+	// Webhooks are posted the lifecycle events of the sessions
+	Webhooks []Webhook `yaml:"webhooks"`
+	// ServiceManifests adds the workloads of the monorepo's service manifests
+	ServiceManifests ServiceManifests `yaml:"service_manifests"`
+	// APIQuota are the per-minute quotas of the project's Google APIs, by service
+	APIQuota APIQuota `yaml:"api_quota"`
+	// Sync writes ConfigMaps and Secrets of the default cluster to local files
+	Sync []SyncItem `yaml:"sync"`
 }
 
 type Config struct {
 	Cloud       CloudConfig   `yaml:"cloud"`
 	Proxies     []ProxyConfig `yaml:"proxies"`
 	Environment string        `yaml:"environment"`
+	Profiles    []Profile     `yaml:"profiles"`
+	MinVersions MinVersions   `yaml:"min_versions"`
+	Reporting   Reporting     `yaml:"reporting"`
+	// CloudLogging ships the output of sessions to the platform team
+	CloudLogging CloudLogging `yaml:"cloud_logging"`
+	Policies     []Policy     `yaml:"policies"`
 }
 
 var ErrDuplicateLocalPorts = errors.New("duplicate_local_ports")
 
+// usesBastion reports whether the session connects to the bastion, for its connections or
+// for the API server proxy in bastion mode
+func usesBastion(config ProxyConfig) bool {
+	return len(config.Bastion.Connections) > 0 || (config.APIProxy.enabled() && config.APIProxy.mode() == apiProxyBastion)
+}
+
+// usesClusters reports whether the session needs cluster credentials and kubectl, for its
+// workloads or for the API server proxy
+func usesClusters(config ProxyConfig) bool {
+	return len(config.Workloads) > 0 || config.APIProxy.enabled() || len(config.Sync) > 0
+}
+
 func checkKubectl(ctx context.Context) bool {
+	ctx, cancel := context.WithTimeout(ctx, localCommandTimeout)
+	defer cancel()
 	cmd := exec.CommandContext(ctx, "kubectl", "version", "--client")
-	if err := cmd.Run(); err != nil {
+	started := commandStarted(cmd)
+	err := cmd.Run()
+	commandFinished(cmd, started, err)
+	if err != nil {
 		return false
 	}
 	return true
 }
 
 func checkGcloud(ctx context.Context) bool {
+	ctx, cancel := context.WithTimeout(ctx, localCommandTimeout)
+	defer cancel()
 	cmd := exec.CommandContext(ctx, "gcloud", "version")
-	if err := cmd.Run(); err != nil {
+	started := commandStarted(cmd)
+	err := cmd.Run()
+	commandFinished(cmd, started, err)
+	if err != nil {
 		return false
 	}
 	return true
 }
 
-// validateLocalPorts checks if there are duplicate local ports and returns true if there are duplicate local ports
-func validateLocalPorts(config ProxyConfig) ([]int, error) {
-	localPorts := make(map[int]bool)
+// checkSSH reports whether the ssh client gcloud compute ssh runs is installed
+func checkSSH(ctx context.Context) bool {
+	ctx, cancel := context.WithTimeout(ctx, localCommandTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "ssh", "-V")
+	started := commandStarted(cmd)
+	err := cmd.Run()
+	commandFinished(cmd, started, err)
+	return err == nil
+}
 
-	for _, workload := range config.Workloads {
-		if localPorts[workload.LocalPort] {
-			fmt.Println("Error: duplicate local ports in the configuration file.", workload.LocalPort)
-			return nil, ErrDuplicateLocalPorts
-		}
-		localPorts[workload.LocalPort] = true
+// portConflict is a local port used by more than one tunnel of the environment
+type portConflict struct {
+	Port    int
+	Tunnels []string
+}
+
+// DuplicatePortsError lists every local port of the configuration used by more than one
+// tunnel. It matches ErrDuplicateLocalPorts with errors.Is.
+type DuplicatePortsError struct {
+	Conflicts []portConflict
+}
+
+func (e *DuplicatePortsError) Error() string {
+	var conflicts []string
+	for _, conflict := range e.Conflicts {
+		conflicts = append(conflicts, fmt.Sprintf("%d (%s)", conflict.Port, strings.Join(conflict.Tunnels, ", ")))
 	}
+	return "duplicate local ports " + strings.Join(conflicts, "; ")
+}
 
-	for _, connection := range config.Bastion.Connections {
-		if localPorts[connection.LocalPort] {
-			fmt.Println("Error: duplicate local ports in the configuration file.", connection.LocalPort)
-			return nil, ErrDuplicateLocalPorts
+func (e *DuplicatePortsError) Is(target error) bool {
+	return target == ErrDuplicateLocalPorts
+}
+
+// report prints one line per conflicting port with the tunnels using it
+func (e *DuplicatePortsError) report(w io.Writer) {
+	fmt.Fprintf(w, "Error: %d local ports are used by more than one tunnel in the configuration file:\n", len(e.Conflicts))
+	for _, conflict := range e.Conflicts {
+		fmt.Fprintf(w, "  %d: %s\n", conflict.Port, strings.Join(conflict.Tunnels, ", "))
+	}
+}
+
+// validateLocalPorts returns the local ports of the workloads, connections and API server
+// proxy in order, or a *DuplicatePortsError with every port used more than once
+func validateLocalPorts(config ProxyConfig) ([]int, error) {
+	var localPorts []int
+	tunnels := make(map[int][]string)
+	add := func(port int, tunnel string) {
+		if len(tunnels[port]) == 0 {
+			localPorts = append(localPorts, port)
 		}
-		localPorts[connection.LocalPort] = true
+		tunnels[port] = append(tunnels[port], tunnel)
+	}
+	for _, workload := range config.Workloads {
+		add(workload.LocalPort, "workload "+workload.Name())
+	}
+	for _, connection := range config.Bastion.Connections {
+		add(connection.LocalPort, "connection "+connection.Name())
+	}
+	if config.APIProxy.enabled() {
+		add(config.APIProxy.LocalPort, "api_proxy")
 	}
 
-	// return list of local ports from localPorts map
-	var localPortsList []int
-	for localPort := range localPorts {
-		localPortsList = append(localPortsList, localPort)
+	duplicates := &DuplicatePortsError{}
+	for _, port := range localPorts {
+		if len(tunnels[port]) > 1 {
+			duplicates.Conflicts = append(duplicates.Conflicts, portConflict{Port: port, Tunnels: tunnels[port]})
+		}
+	}
+	if len(duplicates.Conflicts) > 0 {
+		return nil, duplicates
 	}
-	return localPortsList, nil
+	return localPorts, nil
 }
 
 func connectBastion(ctx context.Context, bastion Bastion, connection Connection) *exec.Cmd {
-	sshCmd := exec.CommandContext(ctx, "gcloud", "compute", "ssh", bastion.Name, "--zone", bastion.Zone, "--", "-L", fmt.Sprintf("localhost:%d:%s:%d", connection.LocalPort, connection.RemoteHost, connection.RemotePort), "-t")
-	sshCmd.Stderr = os.Stderr
+	if bastion.kind() == bastionCloudflared {
+		cmd := exec.CommandContext(ctx, "cloudflared", cloudflaredArgs(connection)...)
+		cmd.Stdout = logger.Writer(connection.Name())
+		cmd.Stderr = logger.Writer(connection.Name())
+		return cmd
+	}
+	name, args := bastionSSH(bastion, connection.Project, "", "-L", fmt.Sprintf("%s:%d:%s:%d", connection.host(), connection.LocalPort, connection.RemoteHost, connection.RemotePort), "-N")
+	sshCmd := exec.CommandContext(ctx, name, args...)
+	sshCmd.Stdout = logger.Writer(connection.Name())
+	sshCmd.Stderr = logger.Writer(connection.Name())
 	return sshCmd
 }
 
+// lookupBastionZone returns the zone of the bastion instance using gcloud
+func lookupBastionZone(ctx context.Context, runner *commandRunner, project, name string) (string, error) {
+	cmd := exec.CommandContext(ctx, "gcloud", "compute", "instances", "list", "--project", project, "--filter", fmt.Sprintf("name=%v", name), "--format", "value(zone)")
+	cmd.Stderr = logger.Writer("gcloud")
+	zone, err := runner.output(ctx, cmd)
+	if err != nil {
+		return "", fmt.Errorf("getting zone of the bastion instance: %w", err)
+	}
+	return strings.Replace(string(zone), "\n", "", -1), nil
+}
+
+// discoverCluster returns the default cluster, the first cluster of the project, and sets
+// it in the gcloud config
+func discoverCluster(ctx context.Context, runner *commandRunner, project string) (gkeCluster, error) {
+	narrate("Getting the default cluster and its location:")
+	cmd := exec.CommandContext(ctx, "gcloud", "container", "clusters", "list", "--project", project, "--format", "value(name,location)")
+	cmd.Stderr = logger.Writer("gcloud")
+	out, err := runner.output(ctx, cmd)
+	if err != nil {
+		return gkeCluster{}, fmt.Errorf("getting cluster list: %w", err)
+	}
+	clusters, err := parseClusterList(project, out)
+	if err != nil {
+		return gkeCluster{}, err
+	}
+	if len(clusters) == 0 {
+		return gkeCluster{}, fmt.Errorf("no cluster in project %s", project)
+	}
+	cluster := clusters[0]
+	if len(clusters) > 1 {
+		fmt.Printf("Warning: project %s has %d clusters, using %s by default. Set cluster on the workloads of the other clusters.\n", project, len(clusters), cluster.Name)
+	}
+
+	// gcloud config set calls write the same file, so they are not run concurrently
+	narrate("Setting the default cluster:", cluster.Name)
+	cmd = exec.CommandContext(ctx, "gcloud", "config", "set", "container/cluster", cluster.Name)
+	cmd.Stderr = narrationWriter("gcloud")
+	cmd.Stdout = narrationWriter("gcloud")
+	if err := runner.run(ctx, cmd); err != nil {
+		return gkeCluster{}, fmt.Errorf("setting gcloud cluster: %w", err)
+	}
+	property := "compute/region"
+	if cluster.zonal() {
+		property = "compute/zone"
+	}
+	narratef("Setting the default cluster location (%s): %s\n", property, cluster.Location)
+	cmd = exec.CommandContext(ctx, "gcloud", "config", "set", property, cluster.Location)
+	cmd.Stderr = narrationWriter("gcloud")
+	cmd.Stdout = narrationWriter("gcloud")
+	if err := runner.run(ctx, cmd); err != nil {
+		return gkeCluster{}, fmt.Errorf("setting gcloud %s: %w", property, err)
+	}
+	return cluster, nil
+}
+
 // checkPortAvailable checks if the port on local machine is available
 func checkPortAvailable(port int) bool {
-	cmd := exec.Command("lsof", "-i", fmt.Sprintf(":%d", port))
+	ctx, cancel := context.WithTimeout(context.Background(), localCommandTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "lsof", "-i", fmt.Sprintf(":%d", port))
 	if err := cmd.Run(); err != nil {
 		return true
 	}
 	return false
 }
 
+// killProcess kills the processes listening on the port, unless one of them is critical
 func killProcess(port int) error {
-	fmt.Println("Killing the process using port:", port)
-	// find the pid for the port
-	portCmd := exec.Command("lsof", "-t", fmt.Sprintf("-i:%d", port))
-	out, err := portCmd.Output()
+	holders, err := portHolders(port)
 	if err != nil {
 		return err
 	}
-	pid := strings.Replace(string(out), "\n", "", -1)
-	// kill the process using the pid
-	killCmd := exec.Command("kill", "-9", pid)
-	if err := killCmd.Run(); err != nil {
-		return err
-	}
-	fmt.Println("Successfully killed the process using port:", port)
-	return nil
+	return killPortHolders(port, holders)
 }
 
-func getPortReuseConfirmation(port int) string {
-	fmt.Printf("Error: port %d is being used by another process.\n", port)
+func getPortReuseConfirmation(port int, holders []portHolder) string {
+	fmt.Printf("Error: port %d is being used by another process:\n", port)
+	for _, holder := range holders {
+		fmt.Println("  " + holder.String())
+	}
 	fmt.Println("Do you want to kill the process using this port?")
 	fmt.Println(`Warning: If you kill this process, you will not be able to access the application running on this port.`)
 	fmt.Println("Please choose one of the action: (a/y/n/e)")
@@ -141,32 +461,268 @@ func getPortReuseConfirmation(port int) string {
 	fmt.Println("n - do not kill the process using this port")
 	fmt.Println("e - exit the program")
 	var input string
-	fmt.Scanln(&input)
+	if _, err := fmt.Scanln(&input); err == io.EOF {
+		// services and daemons have no terminal to answer from
+		fmt.Println("No input available, exiting.")
+		return "e"
+	}
 	input = strings.TrimSpace(input)
 	input = strings.ToLower(input)
 	if input != "a" && input != "y" && input != "n" && input != "e" {
 		fmt.Println("Invalid input. retry...")
-		return getPortReuseConfirmation(port)
+		return getPortReuseConfirmation(port, holders)
 	}
 	return input
 }
 
+// options are the command line options of a devcli session
+type options struct {
+	confFile       string
+	environment    string
+	httpLog        bool
+	chaos          bool
+	meter          bool
+	shutdownGrace  time.Duration
+	restart        bool
+	probeInterval  time.Duration
+	healthInterval time.Duration
+	maxConcurrency int
+	rateLimit      float64
+	commandTimeout time.Duration
+	commandRetries int
+	// only restricts the session to the tunnel with this name
+	only string
+	// refreshCredentials refreshes the gcloud access token before it expires
+	refreshCredentials bool
+	// syncInterval is how often the ConfigMaps and Secrets of sync are fetched again
+	syncInterval time.Duration
+	// capture records the traffic of the session's tunnel when set
+	capture *capture
+	// profile is the name of the profile to start
+	profile string
+	// tags restrict the session to the tunnels with one of these comma separated tags
+	tags string
+	// bindAddress is the address the local ports listen on
+	bindAddress string
+	// portForwardProtocol is the protocol of the workloads' port-forwards, websocket or spdy
+	portForwardProtocol string
+	// mdns advertises the tunnels on the local network over mDNS
+	mdns bool
+	// docker runs the session in a container built from dockerImage
+	docker      bool
+	dockerImage string
+	// auditLog is the file the executed commands are recorded in
+	auditLog string
+	// eventsFile is the file, fifo or unix socket the lifecycle events are written to
+	eventsFile string
+	// cloudLogging ships the output to the Cloud Logging project of the configuration
+	cloudLogging bool
+	// dryRun prints what the session would do instead of starting it
+	dryRun bool
+	// debug prints the external commands and their timing
+	debug bool
+	// quiet only prints errors, warnings and the port table
+	quiet bool
+	// verbose prints every step instead of the progress of the startup phases
+	verbose bool
+	// profileFile is where the durations of the startup phases are written as JSON
+	profileFile string
+	// output is the format of the -dry-run plan
+	output string
+	// interactive lets the user pick the tunnels of the session
+	interactive bool
+	// preflight checks the permissions of the session before starting it
+	preflight bool
+	// keys reads single-key commands from the terminal
+	keys bool
+	// noGcloud calls the Google APIs with the application default credentials instead of gcloud
+	noGcloud bool
+	// podWait is how long a workload without a running pod waits for one to become ready
+	podWait time.Duration
+	// remapPrivileged moves the local ports only root may listen on to unprivileged ones
+	remapPrivileged bool
+	// fast reuses the startup state of a session of the environment started moments ago
+	fast bool
+	// confirmEnv confirms a protected environment without typing its name
+	confirmEnv string
+	// reason is why the access to an environment requiring an approval is needed
+	reason string
+	// force kills the processes holding the local ports without asking
+	force bool
+}
+
+// sessionFlags registers the flags shared by every command that starts a session
+func sessionFlags(fs *flag.FlagSet, opts *options) {
+	fs.StringVar(&opts.confFile, "conf", "", "Path to the configuration file")
+	fs.StringVar(&opts.environment, "env", "", "Environment type (dev, staging, prod)")
+	fs.DurationVar(&opts.probeInterval, "probe-interval", 30*time.Second, "Interval between liveness probes of every forwarded port (0 disables probing)")
+	fs.DurationVar(&opts.healthInterval, "health-interval", 15*time.Second, "Interval between health checks of workloads with protocol: grpc")
+	fs.IntVar(&opts.maxConcurrency, "max-concurrency", 8, "Maximum number of gcloud/kubectl commands and Kubernetes API requests running at the same time")
+	fs.Float64Var(&opts.rateLimit, "rate-limit", 10, "Maximum number of gcloud/kubectl commands and Kubernetes API requests started per second (0 disables the limit)")
+	fs.DurationVar(&opts.commandTimeout, "command-timeout", time.Minute, "Deadline of each gcloud/kubectl command and Kubernetes API request, port-forwards excluded (0 disables the deadline)")
+	fs.IntVar(&opts.commandRetries, "command-retries", 2, "Number of times a gcloud/kubectl command, Google or Kubernetes API call that timed out or failed with a transient error is retried")
+	fs.DurationVar(&opts.podWait, "pod-wait", 5*time.Minute, "How long a workload without a running pod, e.g. right after a deploy, waits for one to become ready (0 fails right away)")
+	fs.BoolVar(&opts.restart, "restart", true, "Restart tunnels whose port-forward exits, with exponential backoff")
+	fs.BoolVar(&opts.refreshCredentials, "refresh-credentials", true, "Refresh the gcloud credentials before they expire, and restart the tunnels that failed on expired ones")
+	fs.DurationVar(&opts.syncInterval, "sync-interval", 5*time.Minute, "Interval between refreshes of the ConfigMaps and Secrets of sync (0 only syncs them at startup)")
+	fs.BoolVar(&opts.quiet, "quiet", false, "Only print errors, warnings and the port table once the tunnels are ready")
+	fs.BoolVar(&opts.verbose, "verbose", false, "Print every step of the session instead of the progress of its startup phases")
+	fs.StringVar(&opts.profileFile, "profile", "", "Write the durations of the startup phases to this file as JSON")
+	fs.BoolVar(&opts.debug, "debug", false, "Print every external command before it runs and how long it took")
+	fs.BoolVar(&opts.noGcloud, "no-gcloud", false, "Look up bastions and clusters with the Google Cloud APIs and the application default credentials instead of gcloud, which only the bastion connections then run")
+	fs.BoolVar(&opts.keys, "keys", true, "Accept single-key commands when running in a terminal: s status, r restart failed tunnels, p ports, q quit")
+	fs.BoolVar(&opts.remapPrivileged, "remap-privileged", false, fmt.Sprintf("Listen on the local port plus %d for tunnels whose port only root may listen on, e.g. 10443 for 443", remappedPortOffset))
+	fs.BoolVar(&opts.fast, "fast", false, "Reuse the project, bastion zones, clusters, credentials and passed preflight checks of a session of the environment started in the last 10 minutes")
+	fs.StringVar(&opts.confirmEnv, "confirm-env", "", "Name of the protected environment being connected to, instead of typing it, e.g. for services and daemons")
+	fs.StringVar(&opts.reason, "reason", "", "Why the access is needed, sent to the approvers of environments requiring an approval (asked for in a terminal when empty)")
+	fs.BoolVar(&opts.preflight, "preflight", true, "Check the IAM and Kubernetes RBAC permissions of the session and that its bastions are reachable before starting it")
+	fs.BoolVar(&opts.force, "force", false, "Kill the processes holding the local ports of the session without asking, except critical system processes")
+	fs.StringVar(&opts.auditLog, "audit-log", "", "File the executed gcloud, kubectl, ssh and hook commands are appended to (default ~/.devcli/audit.log, \"none\" disables it)")
+	fs.BoolVar(&opts.cloudLogging, "cloud-logging", false, "Ship the output of the session, redacted, to the Cloud Logging project of the configuration's cloud_logging")
+	fs.StringVar(&opts.eventsFile, "events-file", "", "File, fifo or unix socket a JSON line is written to for every tunnel started, failed or stopped, pod switched and the session ready")
+}
+
 func main() {
+	args := os.Args[1:]
+	if len(args) > 0 {
+		switch args[0] {
+		case "capture":
+			runCapture(args[1:])
+			return
+		case "daemon":
+			runDaemon(args[1:])
+			return
+		case "attach":
+			runAttach(args[1:])
+			return
+		case "restart", "pause", "resume":
+			runTunnelAction(args[0], args[1:])
+			return
+		case "service":
+			runService(args[1:])
+			return
+		case "compose":
+			runCompose(args[1:])
+			return
+		case "plugins":
+			listPlugins(args[1:])
+			return
+		case "status":
+			runStatus(args[1:])
+			return
+		case "list":
+			runList(args[1:])
+			return
+		case "validate":
+			runValidate(args[1:])
+			return
+		case "config":
+			runConfig(args[1:])
+			return
+		case "relay":
+			runRelay(args[1:])
+			return
+		case "env":
+			runEnv(args[1:])
+			return
+		case "direnv":
+			runDirenv(args[1:])
+			return
+		case "allow", "deny":
+			runAllow(args[0], args[1:])
+			return
+		case "prompt":
+			runPrompt(args[1:])
+			return
+		case "tmux":
+			runTmux(args[1:])
+			return
+		case "ide":
+			runIDE(args[1:])
+			return
+		case "stop":
+			runStop(args[1:])
+			return
+		case "top":
+			runTop(args[1:])
+			return
+		case "start":
+			args = args[1:]
+		default:
+			if !strings.HasPrefix(args[0], "-") {
+				if path, ok := findPlugin(args[0]); ok {
+					runPlugin(path, args[1:])
+				}
+				fmt.Printf("Error: unknown command %s, and no %s%s plugin on the PATH.\n", args[0], pluginPrefix, args[0])
+				os.Exit(2)
+			}
+		}
+	}
+
 	// Parse command line arguments
-	confFile := flag.String("conf", "", "Path to the configuration file")
-	environment := flag.String("env", "", "Environment type (dev, staging, prod)")
-	flag.Parse()
+	var opts options
+	fs := flag.NewFlagSet("devcli", flag.ExitOnError)
+	startFlags(fs, &opts)
+	fs.BoolVar(&opts.dryRun, "dry-run", false, "Print the commands the session would run, the ports it would bind and the environment variables it would set, without running anything")
+	outputFlag(fs, &opts.output)
+	fs.BoolVar(&opts.interactive, "i", false, "Pick the workloads and connections to start from a searchable list")
+	parseStartArgs(fs, &opts, args)
+	if opts.dryRun {
+		runDryRun(opts)
+		return
+	}
+	if opts.docker {
+		runDocker(opts, args)
+		return
+	}
+	runSession(opts)
+}
 
-	if *confFile == "" {
+// startFlags registers the flags of devcli start, which are also the ones of devcli daemon
+func startFlags(fs *flag.FlagSet, opts *options) {
+	sessionFlags(fs, opts)
+	fs.BoolVar(&opts.httpLog, "http-log", false, "Log requests proxied through workloads with protocol: http")
+	fs.BoolVar(&opts.chaos, "chaos", false, "Inject the faults configured in the environment's chaos rules")
+	fs.BoolVar(&opts.meter, "meter", false, "Relay the traffic of every tunnel through devcli to count it for devcli top")
+	fs.DurationVar(&opts.shutdownGrace, "shutdown-grace", 0, "How long open connections get to finish when the session ends, overrides the environment's shutdown_grace")
+	fs.StringVar(&opts.tags, "tags", "", "Comma separated tags, only the workloads and connections with one of them are started")
+	fs.StringVar(&opts.bindAddress, "bind-address", "localhost", "Address the local ports listen on")
+	fs.StringVar(&opts.portForwardProtocol, "port-forward-protocol", portForwardWebSocket, "Protocol of the workloads' port-forwards: websocket, falling back to SPDY on older clusters, or spdy")
+	fs.BoolVar(&opts.mdns, "mdns", false, "Advertise the tunnels on the local network over mDNS as <tunnel>.local, needs a -bind-address other devices can reach")
+	fs.BoolVar(&opts.docker, "docker", false, "Run the session in a container with pinned gcloud/kubectl versions, publishing the local ports")
+	fs.StringVar(&opts.dockerImage, "docker-image", "devcli", "Image of the container run with -docker, built from the Dockerfile")
+}
+
+// runSession initializes the environment and runs its tunnels until the program is interrupted
+func runSession(opts options) {
+	started := time.Now()
+	debugCommands = opts.debug
+	quiet = opts.quiet
+	verbose = opts.verbose
+	if opts.bindAddress != "" {
+		listenHost = opts.bindAddress
+	}
+	if err := checkPortForwardProtocol(opts.portForwardProtocol); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(2)
+	}
+	kubeAPI.protocol = opts.portForwardProtocol
+	if opts.confFile == "" {
+		if project := projectConfig(); project != "" {
+			opts.confFile = project
+			decorate("Using project configuration file:", project)
+		}
+	}
+	if opts.confFile == "" {
 		// take default configuration file path from home directory
 		homeDir, err := os.UserHomeDir()
 		if err != nil {
 			fmt.Println("Error getting user home directory:", err)
 			os.Exit(1)
 		}
-		*confFile = fmt.Sprintf("%s/.devcli/config.yaml", homeDir)
+		opts.confFile = fmt.Sprintf("%s/.devcli/config.yaml", homeDir)
 		// check if default configuration file exists
-		if _, err := os.Stat(*confFile); os.IsNotExist(err) {
+		if _, err := os.Stat(opts.confFile); os.IsNotExist(err) {
 			// if default configuration file does not exist, create it
 			err := os.MkdirAll(fmt.Sprintf("%s/.devcli", homeDir), 0755)
 			if err != nil {
@@ -175,7 +731,7 @@ func main() {
 			}
 			// default configuration file content
 			defaultConfig := ``
-			err = os.WriteFile(*confFile, []byte(defaultConfig), 0644)
+			err = os.WriteFile(opts.confFile, []byte(defaultConfig), 0644)
 			if err != nil {
 				fmt.Println("Error writing default configuration file:", err)
 				os.Exit(1)
@@ -183,67 +739,114 @@ func main() {
 		}
 	} else {
 		// print configuration file path
-		fmt.Println("Using configuration file:", *confFile)
+		narrate("Using configuration file:", opts.confFile)
 		// check if configuration file exists
-		if _, err := os.Stat(*confFile); os.IsNotExist(err) {
+		if _, err := os.Stat(opts.confFile); os.IsNotExist(err) {
 			fmt.Println("Error: configuration file does not exist at given path.")
 			os.Exit(1)
 		}
 	}
 
 	// Print devcli program header
-	fmt.Println("devcli - Development CLI")
-	fmt.Println("Initializing...")
+	decorate("devcli - Development CLI")
+	decorate("Initializing...")
 
 	// Create a context that will be used to cancel the port-forward commands
 	// when the program is interrupted
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// check if gcloud is installed and configured
-	if !checkGcloud(ctx) {
-		fmt.Println("Error: gcloud is not installed or not in the system's PATH.")
-		os.Exit(1)
+	// every external command is recorded in the audit log
+	if opts.auditLog != "none" {
+		path := opts.auditLog
+		var err error
+		if path == "" {
+			path, err = defaultAuditPath()
+		}
+		if err == nil {
+			audit, err = openAuditLog(path, opts.environment)
+		}
+		if err != nil {
+			fmt.Println("Error opening the audit log:", err)
+			os.Exit(1)
+		}
+		defer audit.close()
 	}
-
-	// Check if kubectl is installed and configured
-	if !checkKubectl(ctx) {
-		fmt.Println("Error: kubectl is not installed or not in the system's PATH.")
-		os.Exit(1)
+	// integrations follow the session through its lifecycle events
+	if opts.eventsFile != "" {
+		events = newEventLog(opts.environment)
+		if err := events.writeTo(opts.eventsFile); err != nil {
+			fmt.Println("Error opening the events file:", err)
+			os.Exit(1)
+		}
+		defer events.close()
 	}
 
-	// log gcloud version
-	cmd := exec.CommandContext(ctx, "gcloud", "version")
-	fmt.Println("Using gcloud version:")
-	cmd.Stderr = os.Stderr
-	cmd.Stdout = os.Stdout
-	if err := cmd.Run(); err != nil {
-		fmt.Println("Error getting gcloud version:", err)
-		os.Exit(1)
+	// gcloud and kubectl calls and the Kubernetes API requests share a concurrency and rate limit
+	runner := newCommandRunner(opts.maxConcurrency, opts.rateLimit).withTimeout(opts.commandTimeout, opts.commandRetries)
+	runner.reauthenticate = (&reauthPrompt{}).prompt
+
+	// check if gcloud is installed and configured, with -no-gcloud only bastions need it
+	if !opts.noGcloud {
+		if !checkGcloud(ctx) {
+			fmt.Println("Error: gcloud is not installed or not in the system's PATH.")
+			os.Exit(1)
+		}
+
+		// log gcloud version, -fast trusts that it did not change since the last session
+		if !opts.fast {
+			cmd := exec.CommandContext(ctx, "gcloud", "version")
+			narrate("Using gcloud version:")
+			cmd.Stderr = narrationWriter("gcloud")
+			cmd.Stdout = narrationWriter("gcloud")
+			if err := runner.run(ctx, cmd); err != nil {
+				fmt.Println("Error getting gcloud version:", err)
+				printHint(err)
+				os.Exit(1)
+			}
+		}
 	}
 
 	// Read and parse the configuration file
-	configData, err := os.ReadFile(*confFile)
+	configData, err := os.ReadFile(opts.confFile)
 	if err != nil {
 		fmt.Println("Error reading configuration file:", err)
 		os.Exit(1)
 	}
 
-	var config Config
-	err = yaml.Unmarshal(configData, &config)
+	config, err := parseConfig(configData)
 	if err != nil {
 		fmt.Println("Error parsing configuration file:", err)
 		os.Exit(1)
 	}
+	if err := checkConfigTrust(opts.confFile, configData, config); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if err := expandServiceManifests(&config, filepath.Dir(opts.confFile)); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
 
 	// check if environment is set
-	if config.Environment == "" && *environment == "" {
-		fmt.Println("Error: environment is not set in the configuration file or passed as a command line argument.")
+	if err := selectEnvironment(&config, opts); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if err := chooseEnvironment(&config); err != nil {
+		fmt.Println("Error:", err)
 		os.Exit(1)
-	} else if *environment != "" {
-		config.Environment = *environment
 	}
-	fmt.Println("Setting up Environment:", config.Environment)
+	if opts.profile != "" {
+		narrate("Using profile:", opts.profile)
+	}
+	narrate("Setting up Environment:", config.Environment)
+	if audit != nil {
+		audit.environment = config.Environment
+	}
+	if events != nil {
+		events.environment = config.Environment
+	}
 
 	// get the proxy configuration for the environment
 	var proxyConfig ProxyConfig
@@ -258,88 +861,271 @@ func main() {
 		fmt.Println("Error: proxy configuration for environment", config.Environment, "is not found.")
 		os.Exit(1)
 	}
+	if errs := validateSession(config, proxyConfig); len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Println("Error:", err)
+		}
+		os.Exit(1)
+	}
+	if len(proxyConfig.Webhooks) > 0 {
+		if events == nil {
+			events = newEventLog(config.Environment)
+			defer events.close()
+		}
+		events.postTo(proxyConfig.Webhooks)
+	}
+
+	// keep the tunnels tagged by the profile or -tags, and the ones picked with -i
+	proxyConfig, err = applyProfile(config, proxyConfig, opts)
+	if err == nil {
+		proxyConfig, err = chooseTunnels(proxyConfig, opts)
+	}
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	// protected environments are confirmed by name and some tunnels are left out of them
+	if proxyConfig.Protected {
+		var dropped []string
+		proxyConfig, dropped = dropDisallowed(proxyConfig)
+		for _, name := range dropped {
+			fmt.Printf("Warning: %s is disallowed in protected environment %s and is not started.\n", name, proxyConfig.Environment)
+		}
+		if len(proxyConfig.Workloads) == 0 && len(proxyConfig.Bastion.Connections) == 0 && !proxyConfig.APIProxy.enabled() {
+			fmt.Println("Error: every tunnel of environment", proxyConfig.Environment, "is disallowed in protected environments.")
+			os.Exit(1)
+		}
+		fmt.Print(protectedBanner(proxyConfig))
+		if err := confirmProtected(proxyConfig.Environment, opts.confirmEnv, os.Stdin, os.Stdout, isTerminal(os.Stdin)); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		setTerminalTitle(os.Stdout, "devcli: PROTECTED "+proxyConfig.Environment)
+		defer setTerminalTitle(os.Stdout, "")
+	}
+
+	// restrict the session to a single tunnel, before its ports are checked and freed so
+	// that the ports of the other tunnels, e.g. of a running session, are left alone
+	if opts.only != "" {
+		proxyConfig, err = onlyTunnel(proxyConfig, opts.only)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	}
 
 	// Check if there are duplicate local ports
 	localPorts, err := validateLocalPorts(proxyConfig)
-	if err == ErrDuplicateLocalPorts {
-		fmt.Println("Error: there are duplicate local ports in the configuration file.")
+	var duplicates *DuplicatePortsError
+	if errors.As(err, &duplicates) {
+		duplicates.report(os.Stdout)
+		os.Exit(1)
+	}
+
+	if opts.mdns {
+		if err := validateMDNS(proxyConfig, listenHost); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	}
+
+	// ports below 1024 would fail with a bare permission denied once the tunnels start
+	err = checkPrivilegedPorts(&proxyConfig, opts.remapPrivileged)
+	var privileged *PrivilegedPortsError
+	if errors.As(err, &privileged) {
+		privileged.report(os.Stdout)
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Println("Error:", err)
 		os.Exit(1)
 	}
+	localPorts, _ = validateLocalPorts(proxyConfig)
+
+	// refuse to connect outside the allowed hours of the environment
+	var allowedUntil time.Time
+	if proxyConfig.AllowedHours.enabled() {
+		schedule, err := proxyConfig.AllowedHours.parse()
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		now := time.Now()
+		end, ok := schedule.allowed(now)
+		if !ok {
+			fmt.Printf("Error: environment %s may only be connected to in its allowed hours, the next ones start %s.\n", proxyConfig.Environment, schedule.next(now).Format("Mon 02 Jan 15:04 MST"))
+			os.Exit(1)
+		}
+		allowedUntil = end
+	}
+
+	// the processes of a crashed session may still hold the local ports
+	stale := cleanStaleSessions()
+	trackChildren(proxyConfig.Environment)
 
 	var reusePorts bool
 
-	// check if the port on local machine is available
+	// free the local ports held by other processes, those left over by a stale session of
+	// devcli without asking, and never the critical ones
 	for _, port := range localPorts {
-		if !checkPortAvailable(port) {
-			// check if reusePorts is set to true
-			if !reusePorts {
-				// ask user if they want to reuse ports
-				input := getPortReuseConfirmation(port)
-				if input == "a" {
-					reusePorts = true
-				} else if input == "e" {
-					fmt.Println("Exiting devcli...")
-					os.Exit(1)
-				} else if input == "n" {
-					continue
-				} else if input == "y" {
-					// kill the process using the port
-					err := killProcess(port)
-					if err != nil {
-						fmt.Println("Error killing process using port:", err)
-						os.Exit(1)
-					}
-				}
-			}
-			if reusePorts {
-				// kill the process using the port
-				err := killProcess(port)
-				if err != nil {
-					fmt.Println("Error killing process using port:", err)
-					os.Exit(1)
-				}
+		if checkPortAvailable(port) {
+			continue
+		}
+		holders, err := portHolders(port)
+		if err != nil {
+			fmt.Println("Warning:", err)
+		}
+		if len(holders) == 0 {
+			continue
+		}
+		if i := slices.IndexFunc(holders, portHolder.critical); i >= 0 {
+			fmt.Printf("Warning: port %d is used by %s, which devcli never kills. Its tunnel fails until the port is freed.\n", port, holders[i])
+			continue
+		}
+		ownForwards := !slices.ContainsFunc(holders, func(h portHolder) bool { return !h.leftOver(stale) })
+		if !opts.force && !reusePorts && !ownForwards {
+			switch getPortReuseConfirmation(port, holders) {
+			case "a":
+				reusePorts = true
+			case "e":
+				fmt.Println("Exiting devcli...")
+				os.Exit(1)
+			case "n":
+				continue
 			}
 		}
+		if err := killPortHolders(port, holders); err != nil {
+			fmt.Println("Error killing process using port:", err)
+			os.Exit(1)
+		}
 	}
 
-	// print when proxy configuration is found
-	fmt.Println("Setting up proxy for environment", proxyConfig.Environment)
+	if opts.capture != nil {
+		if err := validateCapture(proxyConfig); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	}
 
-	// get zone of the bastion instance using gcloud
-	cmd = exec.CommandContext(ctx, "gcloud", "compute", "instances", "list", "--filter", fmt.Sprintf("name=%v", proxyConfig.Bastion.Name), "--format", "value(zone)")
-	cmd.Stderr = os.Stderr
-	zone, err := cmd.Output()
-	if err != nil {
-		fmt.Println("Error getting zone of the bastion instance:", err)
+	// the shared configuration's policies may forbid some tunnels in the environment
+	err = checkPolicies(config.Policies, proxyConfig)
+	var violations *PolicyError
+	if errors.As(err, &violations) {
+		violations.report(os.Stdout)
 		os.Exit(1)
-	} else {
-		proxyConfig.Bastion.Zone = strings.Replace(string(zone), "\n", "", -1)
-		fmt.Println("Setting the Zone of the bastion instance:", proxyConfig.Bastion.Zone)
 	}
 
-	// Set the KUBECONFIG environment variable
-	if config.Cloud.Kubeconfig == "" {
-		fmt.Println("kubeconfig is not set in the configuration file.")
-		// get default kubeconfig path from home directory
-		fmt.Println("Using default kubeconfig path: $HOME/.kube/config")
-		home, err := os.UserHomeDir()
+	// break-glass environments only start once the access is approved, for the approved duration
+	var approvedUntil time.Time
+	if proxyConfig.Approval.enabled() {
+		reason, err := approvalReason(opts.reason, os.Stdin, os.Stdout, isTerminal(os.Stdin))
 		if err != nil {
-			fmt.Println("Error getting home directory:", err)
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		account := ""
+		if !opts.noGcloud {
+			account = gcloudAccount(ctx, runner)
+		}
+		duration, err := requestApproval(ctx, proxyConfig.Approval, newApprovalRequest(proxyConfig.Approval, proxyConfig, account, reason))
+		if err != nil {
+			fmt.Println("Error:", err)
 			os.Exit(1)
 		}
-		config.Cloud.Kubeconfig = fmt.Sprintf("%s/.kube/config", home)
+		approvedUntil = time.Now().Add(duration)
 	}
-	fmt.Println("Using the KUBECONFIG from:", config.Cloud.Kubeconfig)
-	os.Setenv("KUBECONFIG", config.Cloud.Kubeconfig)
+
+	// only the tools the session's tunnels run are required
+	if usesClusters(proxyConfig) && !checkKubectl(ctx) {
+		fmt.Println("Error: kubectl is not installed or not in the system's PATH.")
+		os.Exit(1)
+	}
+	if opts.noGcloud && usesIAPBastion(proxyConfig) && !checkGcloud(ctx) {
+		fmt.Println("Error: gcloud is not installed or not in the system's PATH, gcloud compute ssh reaches the bastion even with -no-gcloud.")
+		os.Exit(1)
+	}
+	if usesIAPBastion(proxyConfig) && !checkSSH(ctx) {
+		fmt.Println("Error: ssh is not installed or not in the system's PATH, it reaches the bastion.")
+		os.Exit(1)
+	}
+	if usesCloudflared(proxyConfig) && !checkCloudflared(ctx) {
+		fmt.Println("Error: cloudflared is not installed or not in the system's PATH, it forwards the connections of the bastion.")
+		os.Exit(1)
+	}
+	if usesIAPBastion(proxyConfig) {
+		narratef("Verifying the host key of the bastion with policy %s\n", proxyConfig.Bastion.hostKeyPolicy())
+		if proxyConfig.Bastion.hostKeyPolicy() == hostKeysPinned {
+			proxyConfig.Bastion.knownHosts, err = writeKnownHosts(proxyConfig.Bastion)
+			if err != nil {
+				fmt.Println("Error writing the pinned host keys of the bastion:", err)
+				os.Exit(1)
+			}
+		}
+	}
+
+	// old tools break port-forwards in subtle ways
+	if outdated := checkToolVersions(ctx, config.MinVersions, proxyConfig); len(outdated) > 0 {
+		for _, line := range outdated {
+			if config.MinVersions.Enforce {
+				fmt.Println("Error:", line)
+			} else {
+				fmt.Println("Warning:", line)
+			}
+		}
+		if config.MinVersions.Enforce {
+			os.Exit(1)
+		}
+	}
+
+	// validate the fault injection rules of chaos mode
+	if opts.chaos {
+		if err := validateChaosRules(proxyConfig); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		if len(proxyConfig.Chaos) == 0 {
+			fmt.Println("Warning: chaos mode is enabled but the environment has no chaos rules.")
+		}
+		for _, rule := range proxyConfig.Chaos {
+			fmt.Printf("Chaos mode: injecting %s on tunnel %s\n", rule.String(), rule.Tunnel)
+		}
+	} else {
+		proxyConfig.Chaos = nil
+	}
+
+	if proxyConfig.APIProxy.enabled() {
+		if err := proxyConfig.APIProxy.validate(proxyConfig); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	}
+
+	// print when proxy configuration is found
+	narrate("Setting up proxy for environment", proxyConfig.Environment)
+
+	// Set the KUBECONFIG environment variable, merging the kubeconfig files of the environment
+	if config.Cloud.Kubeconfig == "" && len(config.Cloud.Kubeconfigs) == 0 && len(proxyConfig.Kubeconfigs) == 0 {
+		narrate("kubeconfig is not set in the configuration file.")
+		narrate("Using default kubeconfig path: $HOME/.kube/config")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		fmt.Println("Error getting home directory:", err)
+		os.Exit(1)
+	}
+	kubeconfig := kubeconfigEnv(kubeconfigPaths(config.Cloud, proxyConfig, home))
+	narrate("Using the KUBECONFIG from:", kubeconfig)
+	os.Setenv("KUBECONFIG", kubeconfig)
 
 	gcloudProjectName := proxyConfig.CloudProject
 	gcloudConfigPath := config.Cloud.Gcloudconfig
 
 	// Set the CLOUDSDK_CONFIG environment variable
 	if gcloudConfigPath == "" {
-		fmt.Println("gcloud config path is not set in the configuration file.")
+		narrate("gcloud config path is not set in the configuration file.")
 		// get default gcloud config path from home directory
-		fmt.Println("Using default gcloud config path: $HOME/.config/gcloud")
+		narrate("Using default gcloud config path: $HOME/.config/gcloud")
 		home, err := os.UserHomeDir()
 		if err != nil {
 			fmt.Println("Error getting home directory:", err)
@@ -347,7 +1133,7 @@ func main() {
 		}
 		gcloudConfigPath = fmt.Sprintf("%s/.config/gcloud", home)
 	}
-	fmt.Println("Using the gcloud config from:", gcloudConfigPath)
+	narrate("Using the gcloud config from:", gcloudConfigPath)
 	os.Setenv("CLOUDSDK_CONFIG", gcloudConfigPath)
 
 	// check if the project is set
@@ -356,71 +1142,344 @@ func main() {
 		os.Exit(1)
 	}
 
-	// set gcloud project
-	fmt.Println("Setting the gcloud project:", gcloudProjectName)
-	cmd = exec.CommandContext(ctx, "gcloud", "config", "set", "project", gcloudProjectName)
-	cmd.Stderr = os.Stderr
-	cmd.Stdout = os.Stdout
-	if err := cmd.Run(); err != nil {
-		fmt.Println("Error setting gcloud project:", err)
-		os.Exit(1)
+	// set env for gcloud export USE_GKE_GCLOUD_AUTH_PLUGIN=True
+	narrate("Setting the environment variable for gcloud auth plugin.")
+	os.Setenv("USE_GKE_GCLOUD_AUTH_PLUGIN", "True")
+	if debugCommands && usesClusters(proxyConfig) {
+		logger.Printf("[debug] %s\n", describePortForwardProtocol(opts.portForwardProtocol))
+	}
+
+	phases := &phaseTimer{display: newProgressDisplay(), started: started}
+
+	// with -no-gcloud the Google APIs are called directly, and the gcloud commands still run
+	// take the project from the environment instead of the gcloud configuration
+	var api *googleAPI
+	if opts.noGcloud {
+		if proxyConfig.ConnectGateway.Enabled {
+			fmt.Println("Error: the connect_gateway cannot be used with -no-gcloud.")
+			os.Exit(1)
+		}
+		api = newGoogleAPI()
+		api.retries = opts.commandRetries
+		os.Setenv("CLOUDSDK_CORE_PROJECT", gcloudProjectName)
 	}
 
-	// get cluster list and set the first cluster as the default cluster
-	var defaultClusterName string
-	fmt.Println("Getting the default cluster:")
-	cmd = exec.CommandContext(ctx, "gcloud", "container", "clusters", "list", "--format", "value(name)")
-	if out, err := cmd.Output(); err != nil {
-		fmt.Println("Error getting cluster list:", err)
+	// with -fast a session started again moments after the last one reuses its startup
+	// state instead of looking it up again
+	var cache *startCache
+	cacheKey := startCacheKey(configData, kubeconfig, gcloudConfigPath)
+	if opts.fast {
+		cache = loadStartCache(proxyConfig.Environment, cacheKey)
+		if cache == nil {
+			narrate("No recent startup state of environment", proxyConfig.Environment, "to reuse, running every step.")
+		} else {
+			narrate("Reusing the startup state of environment", proxyConfig.Environment, "from", cache.SavedAt.Format("15:04:05"))
+		}
+	}
+
+	// set gcloud project, every later phase depends on it
+	err = phases.run("gcloud project", func() error {
+		if api != nil || cache.projectSet(gcloudProjectName) {
+			return nil
+		}
+		narrate("Setting the gcloud project:", gcloudProjectName)
+		cmd := exec.CommandContext(ctx, "gcloud", "config", "set", "project", gcloudProjectName)
+		cmd.Stderr = narrationWriter("gcloud")
+		cmd.Stdout = narrationWriter("gcloud")
+		if err := runner.run(ctx, cmd); err != nil {
+			return fmt.Errorf("setting gcloud project: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Println("Error", err)
+		printHint(err)
 		os.Exit(1)
-	} else {
-		defaultClusterName = strings.Replace(string(out), "\n", "", -1)
-		fmt.Println("Setting the default cluster:", defaultClusterName)
-		cmd = exec.CommandContext(ctx, "gcloud", "config", "set", "container/cluster", defaultClusterName)
-		cmd.Stderr = os.Stderr
-		cmd.Stdout = os.Stdout
-		if err := cmd.Run(); err != nil {
-			fmt.Println("Error setting gcloud cluster:", err)
+	}
+
+	// report missing permissions by name before any step fails on them
+	if opts.preflight && !cache.preflightPassed() {
+		err = phases.run("preflight", func() error {
+			narrate("Checking the IAM permissions of the session.")
+			var token string
+			var err error
+			if api != nil {
+				token, err = api.accessToken(ctx)
+			} else {
+				token, err = gcloudAccessToken(ctx, runner)
+			}
+			if err != nil {
+				return err
+			}
+			return checkPermissions(ctx, token, proxyConfig)
+		})
+		if err != nil {
+			fmt.Println("Error:", err)
+			printHint(err)
+			var missing *MissingPermissionsError
+			if errors.As(err, &missing) {
+				fmt.Println("Hint: ask for a role with these permissions, or run with -preflight=false if they are granted on the instances and clusters themselves")
+			}
 			os.Exit(1)
 		}
 	}
 
-	// get cluster region
-	var defaultClusterRegion string
-	fmt.Println("Getting the default cluster region:")
-	cmd = exec.CommandContext(ctx, "gcloud", "container", "clusters", "list", "--format", "value(location)")
-	if out, err := cmd.Output(); err != nil {
-		fmt.Println("Error getting cluster region:", err)
+	// the bastion zone lookup and the cluster setup are independent of each other.
+	// Workloads and connections may live in other projects and clusters than the environment's.
+	var bastionZones map[string]string
+	var clusters map[clusterRef]gkeCluster
+	lookup := func(project string) (string, error) {
+		return lookupBastionZone(ctx, runner, project, proxyConfig.Bastion.Name)
+	}
+	if api != nil {
+		lookup = func(project string) (string, error) {
+			return api.bastionZone(ctx, project, proxyConfig.Bastion.Name)
+		}
+	}
+	// a pinned bastion is reached with ssh itself, as the user gcloud compute ssh logs in as
+	pinnedLogin := func() error {
+		if proxyConfig.Bastion.hostKeyPolicy() != hostKeysPinned {
+			return nil
+		}
+		var err error
+		proxyConfig.Bastion.login, proxyConfig.Bastion.identity, err = lookupPinnedLogin(ctx, runner, proxyConfig.Bastion)
+		return err
+	}
+	err = runParallel(
+		func() error {
+			// with the Connect Gateway there may be no bastion at all, and a cloudflared
+			// bastion has no instance
+			if !usesIAPBastion(proxyConfig) {
+				return nil
+			}
+			return phases.run("bastion zone", func() error {
+				if zones, ok := cache.bastionZones(append(connectionProjects(proxyConfig), gcloudProjectName)); ok {
+					proxyConfig.Bastion.Zone = zones[gcloudProjectName]
+					delete(zones, gcloudProjectName)
+					bastionZones = zones
+					return pinnedLogin()
+				}
+				zone, err := lookup(gcloudProjectName)
+				if err != nil {
+					return err
+				}
+				proxyConfig.Bastion.Zone = zone
+				narrate("Setting the Zone of the bastion instance:", proxyConfig.Bastion.Zone)
+				if err := pinnedLogin(); err != nil {
+					return err
+				}
+				bastionZones, err = lookupBastionZones(connectionProjects(proxyConfig), lookup)
+				if err != nil || !opts.preflight {
+					return err
+				}
+				narrate("Checking that the bastion is reachable.")
+				return checkBastions(ctx, runner, proxyConfig.Bastion, bastionZones)
+			})
+		},
+		func() error {
+			// without workloads and API server proxy no cluster is used
+			if !usesClusters(proxyConfig) {
+				return nil
+			}
+			find := func(ref clusterRef) (gkeCluster, error) {
+				return findCluster(ctx, runner, ref)
+			}
+			discover := func() (gkeCluster, error) {
+				return discoverCluster(ctx, runner, gcloudProjectName)
+			}
+			if api != nil {
+				find = func(ref clusterRef) (gkeCluster, error) {
+					return api.findCluster(ctx, ref)
+				}
+				discover = func() (gkeCluster, error) {
+					return find(clusterRef{project: gcloudProjectName})
+				}
+			}
+			// a kubeconfig managed with other tools is used as it is
+			if proxyConfig.KubeContext != "" {
+				clusters = map[clusterRef]gkeCluster{{project: gcloudProjectName}: kubeContextCluster(proxyConfig)}
+				return phases.run("cluster credentials", func() error {
+					return checkKubeContext(ctx, runner, proxyConfig.KubeContext)
+				})
+			}
+			err := phases.run("cluster discovery", func() error {
+				if cached, ok := cache.clusters(append(referencedClusters(proxyConfig), clusterRef{project: gcloudProjectName})); ok {
+					clusters = cached
+					return nil
+				}
+				var defaultCluster gkeCluster
+				err := runParallel(
+					func() error {
+						var err error
+						defaultCluster, err = discover()
+						return err
+					},
+					func() error {
+						var err error
+						clusters, err = findClusters(referencedClusters(proxyConfig), find)
+						return err
+					},
+				)
+				clusters[clusterRef{project: gcloudProjectName}] = defaultCluster
+				if proxyConfig.ConnectGateway.Enabled {
+					for ref, cluster := range clusters {
+						clusters[ref] = proxyConfig.ConnectGateway.through(cluster)
+					}
+				}
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			// get-credentials calls write the same kubeconfig, so they are not run concurrently
+			return phases.run("cluster credentials", func() error {
+				if cache != nil && kubeconfigHasContexts(kubeconfig, clusters) {
+					return nil
+				}
+				fetch := fetchClusterCredentials
+				if api != nil {
+					fetch = api.writeCredentials
+				}
+				fetched := make(map[gkeCluster]bool)
+				for _, cluster := range clusters {
+					if fetched[cluster] {
+						continue
+					}
+					if err := fetch(ctx, runner, cluster); err != nil {
+						return err
+					}
+					fetched[cluster] = true
+				}
+				return nil
+			})
+		},
+	)
+	if err != nil {
+		fmt.Println("Error", err)
+		printHint(err)
+		var unreachable *BastionUnreachableError
+		if errors.As(err, &unreachable) {
+			troubleshootBastion(ctx, unreachable)
+		}
 		os.Exit(1)
-	} else {
-		defaultClusterRegion = strings.Replace(string(out), "\n", "", -1)
-		fmt.Println("Setting the default cluster region:", defaultClusterRegion)
-		cmd = exec.CommandContext(ctx, "gcloud", "config", "set", "compute/region", defaultClusterRegion)
-		cmd.Stderr = os.Stderr
-		cmd.Stdout = os.Stdout
-		if err := cmd.Run(); err != nil {
-			fmt.Println("Error setting gcloud region:", err)
+	}
+	if usesClusters(proxyConfig) && proxyConfig.KubeContext == "" {
+		narrate("Successfully got the credentials for the default cluster.")
+	}
+
+	// every workload runs kubectl against the context of its cluster
+	for i, workload := range proxyConfig.Workloads {
+		proxyConfig.Workloads[i].kubeContext = clusters[workloadCluster(proxyConfig, workload)].kubeContext()
+	}
+
+	// a misspelled namespace would otherwise look like a workload without pods
+	if len(proxyConfig.Workloads) > 0 {
+		err = phases.run("namespaces", func() error {
+			narrate("Checking that the namespaces of the workloads exist.")
+			return checkNamespaces(ctx, runner, proxyConfig.Workloads)
+		})
+		var unknown *UnknownNamespacesError
+		if errors.As(err, &unknown) {
+			unknown.report(os.Stdout)
+			fmt.Println("Hint: fix the namespace of these workloads in the configuration file")
+			os.Exit(1)
+		}
+		if err != nil {
+			fmt.Println("Error:", err)
+			printHint(err)
 			os.Exit(1)
 		}
 	}
 
-	// set env for gcloud export USE_GKE_GCLOUD_AUTH_PLUGIN=True
-	fmt.Println("Setting the environment variable for gcloud auth plugin.")
-	os.Setenv("USE_GKE_GCLOUD_AUTH_PLUGIN", "True")
+	// a workload like app: payments-* forwards every matching Deployment of its namespace
+	if slices.ContainsFunc(proxyConfig.Workloads, Workload.wildcard) {
+		err = phases.run("wildcard workloads", func() error {
+			narrate("Listing the deployments matching the wildcard workloads.")
+			var err error
+			proxyConfig.Workloads, err = expandWildcards(ctx, runner, proxyConfig, checkPortAvailable)
+			return err
+		})
+		if err != nil {
+			fmt.Println("Error:", err)
+			printHint(err)
+			os.Exit(1)
+		}
+	}
 
-	// get credentials for the default cluster
-	fmt.Println("Getting the credentials for the default cluster:", defaultClusterName)
-	cmd = exec.CommandContext(ctx, "gcloud", "container", "clusters", "get-credentials", defaultClusterName)
-	cmd.Stderr = os.Stderr
-	cmd.Stdout = os.Stdout
-	if err := cmd.Run(); err != nil {
-		fmt.Println("Error getting cluster credentials:", err)
-		os.Exit(1)
+	// list the namespaces the user cannot port-forward in before half the workloads fail
+	if opts.preflight && len(proxyConfig.Workloads) > 0 {
+		err = phases.run("rbac", func() error {
+			narrate("Checking the Kubernetes RBAC permissions of the workloads.")
+			return checkRBAC(ctx, runner, proxyConfig.Workloads)
+		})
+		if err != nil {
+			fmt.Println("Error:", err)
+			printHint(err)
+			var denied *RBACDeniedError
+			if errors.As(err, &denied) {
+				fmt.Println("Hint: ask the cluster administrators for a role binding in these namespaces, or start the session with -tags or -i without their workloads")
+			}
+			os.Exit(1)
+		}
+	}
+
+	// remember the state looked up for the next -fast start. A reused state is not saved
+	// again, so that it is never trusted for longer than startCacheTTL.
+	if cache == nil {
+		state := &startCache{Key: cacheKey, SavedAt: time.Now(), Project: gcloudProjectName, Preflight: opts.preflight}
+		if usesIAPBastion(proxyConfig) {
+			state.BastionZones = map[string]string{gcloudProjectName: proxyConfig.Bastion.Zone}
+			maps.Copy(state.BastionZones, bastionZones)
+		}
+		state.setClusters(clusters)
+		if err := state.save(proxyConfig.Environment); err != nil {
+			narrate("Saving the startup state for -fast failed:", err)
+		}
+	}
+
+	// the tunnels through the bastion look its zone up again when it moved, which corrects
+	// the startup state of -fast as well
+	zones := newZoneResolver(proxyConfig.Bastion.Name, proxyConfig.Bastion.Zone, bastionZones, func(project string) (string, error) {
+		if project == "" {
+			project = gcloudProjectName
+		}
+		return lookup(project)
+	})
+	zones.moved = func(moved map[string]string) {
+		moved[gcloudProjectName] = moved[""]
+		delete(moved, "")
+		if err := updateBastionZones(proxyConfig.Environment, cacheKey, moved); err != nil {
+			narrate("Updating the startup state for -fast failed:", err)
+		}
+	}
+
+	// the API server of the default cluster is exposed for tools like k9s and Lens
+	var runAPIProxy func(context.Context) error
+	if proxyConfig.APIProxy.enabled() {
+		runAPIProxy, err = setupAPIProxy(ctx, runner, proxyConfig, clusters[clusterRef{project: gcloudProjectName}], zones)
+		if err != nil {
+			fmt.Println("Error setting up the API server proxy:", err)
+			printHint(err)
+			os.Exit(1)
+		}
+	}
+
+	// the configuration of the pods is written locally before the tunnels start
+	syncContext := clusters[clusterRef{project: gcloudProjectName}].kubeContext()
+	if len(proxyConfig.Sync) > 0 {
+		narrate("Syncing the ConfigMaps and Secrets of the environment.")
+		syncResources(ctx, runner, syncContext, proxyConfig.Sync)
 	}
-	fmt.Println("Successfully got the credentials for the default cluster.")
 
 	// Print initialization complete
-	fmt.Println("Initialization complete.")
+	decorate("Initialization complete.")
+
+	// goroutines print concurrently from here on, every line goes through a single writer
+	restoreOutput, err := serializeOutput()
+	if err != nil {
+		fmt.Println("Warning: the output is not serialized:", err)
+		restoreOutput = func() {}
+	}
 
 	// Listen for SIGINT and SIGTERM signals
 	ch := make(chan os.Signal, 2)
@@ -434,66 +1493,314 @@ func main() {
 		cancel()
 		<-ch
 		fmt.Println("Interrupted again. Force exiting immediately...")
+		killChildren()
+		restoreTerminal()
+		restoreOutput()
 		os.Exit(1)
 	}()
 
-	// Run the kubectl port-forward command for each workload
-	var wg sync.WaitGroup
-	fmt.Println("Starting the port-forwarding proxy...")
+	// Register every tunnel so that its status can be reported
+	registry := newStatusRegistry()
 	for _, workload := range proxyConfig.Workloads {
-		wg.Add(1)
-		go func(workload Workload) {
-			defer wg.Done()
-
-			// get first pod using workload name
-			var podName string
-			fmt.Println("Getting the first pod for workload:", workload.App)
-			// get the first running pod for the workload
-			cmd := exec.CommandContext(ctx, "kubectl", "get", "pods", "-n", workload.Namespace, "-l", fmt.Sprintf("app=%s", workload.App), "-o", "jsonpath={.items[?(@.status.phase=='Running')].metadata.name}")
-			if out, err := cmd.Output(); err != nil {
-				fmt.Printf("Error getting pod name for app %s: %v\n", workload.App, err)
-			} else {
-				podList := strings.Split(strings.Replace(string(out), "\n", "", -1), " ")
-				if len(podList) == 0 {
-					fmt.Printf("No running pod found for app %s in namespace %s with label app=%s in the cluster.\n", workload.App, workload.Namespace, workload.App)
-					return
-				} else {
-					podName = podList[0]
-				}
-				if podName == "" {
-					fmt.Printf("No running pod found for app %s in namespace %s with label app=%s in the cluster.\n", workload.App, workload.Namespace, workload.App)
-					return
-				}
-				fmt.Printf("Got the first pod for workload %s: %s in namespace %s \n", workload.App, podName, workload.Namespace)
-				// run kubectl port-forward
-				cmd = exec.CommandContext(ctx, "kubectl", "port-forward", fmt.Sprintf("--namespace=%s", workload.Namespace), podName, fmt.Sprintf("%d:%d", workload.LocalPort, workload.RemotePort))
-				cmd.Stderr = os.Stderr
-				fmt.Printf("Connecting kubectl port-forward for app %s from remote port %d to local port %d\n", workload.App, workload.RemotePort, workload.LocalPort)
-				if err := cmd.Run(); err != nil {
-					// If the context was canceled, don't print an error
-					if ctx.Err() != nil {
-						return
-					}
-					fmt.Printf("Error running kubectl port-forward for pod %s: %v\n", podName, err)
-				}
+		registry.register(workload.Name(), kindWorkload, workload.LocalPort, workload.Protocol)
+	}
+	for _, connection := range proxyConfig.Bastion.Connections {
+		registry.register(connection.Name(), kindBastion, connection.LocalPort, connection.Protocol)
+	}
+	if runAPIProxy != nil {
+		registry.register(apiProxyName, kindAPI, proxyConfig.APIProxy.LocalPort, "")
+	}
+
+	// Print the status of every tunnel on SIGUSR1, or Ctrl-T on macOS
+	go dumpStatusOnSignal(ctx, registry, logger)
+
+	// Probe every forwarded port to catch tunnels whose remote side silently went away
+	if opts.probeInterval > 0 {
+		go watchLiveness(ctx, registry, opts.probeInterval, 2*time.Second)
+	}
+
+	// tear the session down once it reached its max_session
+	if proxyConfig.MaxSession > 0 {
+		limitSession(ctx, proxyConfig.MaxSession, maxSessionWarning, cancel)
+	}
+
+	// tear the session down when the allowed hours of the environment end
+	if !allowedUntil.IsZero() {
+		fmt.Printf("The allowed hours of environment %s end at %s.\n", proxyConfig.Environment, allowedUntil.Format("15:04 MST"))
+		endSessionAt(ctx, allowedUntil, maxSessionWarning, fmt.Sprintf("the end of the allowed hours of environment %s", proxyConfig.Environment), cancel)
+	}
+
+	// tear the session down when its approved access expires
+	if !approvedUntil.IsZero() {
+		fmt.Printf("The access to environment %s is approved until %s.\n", proxyConfig.Environment, approvedUntil.Format("15:04 MST"))
+		endSessionAt(ctx, approvedUntil, maxSessionWarning, fmt.Sprintf("the end of its approved access to environment %s", proxyConfig.Environment), cancel)
+	}
+
+	// stop capturing traffic after the requested duration
+	if opts.capture != nil {
+		fmt.Printf("Capturing traffic of %s for %s into %s\n", opts.capture.tunnel, opts.capture.duration, opts.capture.out)
+		time.AfterFunc(opts.capture.duration, cancel)
+	}
+
+	// Run the pre_start hooks before any tunnel starts
+	env := hookEnv(proxyConfig)
+	if err := runHooks(ctx, hookPreStart, proxyConfig.Hooks.PreStart, env); err != nil {
+		fmt.Println("Error:", err)
+		printHint(err)
+		restoreOutput()
+		os.Exit(1)
+	}
+
+	// The tunnels outlive the session's context until the pre_stop hooks ran and the open
+	// connections drained. Draining relays every tunnel to stop accepting new connections.
+	grace := shutdownGrace(opts, proxyConfig)
+	if grace > 0 {
+		opts.meter = true
+	}
+	tunnelCtx, stopTunnels := context.WithCancel(context.WithoutCancel(ctx))
+	draining := make(chan struct{})
+	var hookFailed atomic.Bool
+	go func() {
+		<-ctx.Done()
+		if err := runHooks(context.Background(), hookPreStop, proxyConfig.Hooks.PreStop, env); err != nil {
+			fmt.Println("Error:", err)
+			printHint(err)
+			hookFailed.Store(true)
+		}
+		close(draining)
+		if grace > 0 {
+			drainConnections(registry, grace)
+		}
+		stopTunnels()
+	}()
+
+	// every tunnel's child process is run, restarted and terminated by the supervisor
+	supervisor := newSupervisor(tunnelCtx, registry, opts.restart)
+	supervisor.breaker = proxyConfig.CircuitBreaker
+	apiCalls.setLimits(proxyConfig.APIQuota)
+
+	// the credentials of long sessions are refreshed before they expire, rather than every
+	// tunnel failing at once when they do
+	if opts.refreshCredentials && !opts.noGcloud && (usesIAPBastion(proxyConfig) || (usesClusters(proxyConfig) && proxyConfig.KubeContext == "")) {
+		go refreshCredentials(ctx, runner, supervisor)
+	}
+	if len(proxyConfig.Sync) > 0 && opts.syncInterval > 0 {
+		go refreshSynced(ctx, runner, syncContext, proxyConfig.Sync, opts.syncInterval)
+	}
+
+	// Serve the control API used by devcli attach, traffic captures are not attachable
+	if opts.capture == nil {
+		startControl(ctx, cancel, proxyConfig.Environment, registry, supervisor)
+	}
+
+	// Run the port-forward of each workload through the shared client of its cluster, the
+	// workloads of a namespace looking their pods up together
+	narrate("Starting the port-forwarding proxy...")
+	pods := prefetchPods(ctx, runner, proxyConfig.Workloads)
+	for _, workload := range proxyConfig.Workloads {
+		forwardPort, err := interpose(tunnelCtx, draining, opts, proxyConfig, registry, workload.Name(), workload.LocalPort, workload.Protocol,
+			newConnectionLimit(workload.Name(), workload.MaxConnections, workload.QueueConnections), newHealthGate(workload, opts.healthInterval))
+		if err != nil {
+			fmt.Printf("Error setting up the local port of workload %s: %v\n", workload.Name(), err)
+			restoreOutput()
+			os.Exit(1)
+		}
+		// check the health of grpc services through the tunnel while the session is running
+		if workload.Protocol == "grpc" && opts.healthInterval > 0 {
+			go watchGRPCHealth(ctx, registry, workload, opts.healthInterval)
+		}
+		supervisor.supervise(workload.Name(), func(workload Workload) func(context.Context) error {
+			return func(ctx context.Context) error {
+				return runWorkload(ctx, runner, workload, pods, forwardPort, opts.podWait)
 			}
-		}(workload)
+		}(workload))
 	}
 
 	// Connect to the bastion server and forward the connections
-	fmt.Println("Starting the bastion server connection proxy...")
+	narrate("Starting the bastion server connection proxy...")
 	for _, connection := range proxyConfig.Bastion.Connections {
-		cmd := connectBastion(ctx, proxyConfig.Bastion, connection)
-		fmt.Printf("Connecting to remote host %s via bastion server from remote port %d to local port %d\n", connection.RemoteHost, connection.RemotePort, connection.LocalPort)
-		go func(connection Connection) {
-			if err := cmd.Run(); err != nil {
-				// If the context was canceled, don't print an error
-				if ctx.Err() != nil {
-					return
+		forwarded := connection
+		forwarded.LocalPort, err = interpose(tunnelCtx, draining, opts, proxyConfig, registry, connection.Name(), connection.LocalPort, connection.Protocol,
+			newConnectionLimit(connection.Name(), connection.MaxConnections, connection.QueueConnections), nil)
+		forwarded.internal = forwarded.LocalPort != connection.LocalPort
+		if err != nil {
+			fmt.Printf("Error setting up the local port of %s: %v\n", connection.Name(), err)
+			restoreOutput()
+			os.Exit(1)
+		}
+		supervisor.supervise(connection.Name(), func(connection Connection) func(context.Context) error {
+			return func(ctx context.Context) error {
+				bastion := proxyConfig.Bastion
+				if bastion.kind() == bastionCloudflared {
+					narratef("Connecting to Cloudflare Access application %s on local port %d\n", connection.Hostname, connection.LocalPort)
+					if err := runner.start(ctx, connectBastion(ctx, bastion, forwarded)); err != nil {
+						return fmt.Errorf("connecting to Cloudflare Access application %s: %w", connection.Hostname, err)
+					}
+					return nil
 				}
-				fmt.Printf("Error connecting to the remote host %s via bastion server %s: %v\n", connection.RemoteHost, proxyConfig.Bastion.Name, err)
+				narratef("Connecting to remote host %s via bastion server from remote port %d to local port %d\n", connection.RemoteHost, connection.RemotePort, connection.LocalPort)
+				return zones.connectRelocating(connection.Project, func(zone string) error {
+					bastion.Zone = zone
+					if err := runner.start(ctx, connectBastion(ctx, bastion, forwarded)); err != nil {
+						return fmt.Errorf("connecting to the remote host %s via bastion server %s: %w", connection.RemoteHost, proxyConfig.Bastion.Name, err)
+					}
+					return nil
+				})
 			}
-		}(connection)
+		}(connection))
+	}
+	// typos in the remote hosts' names are reported while the connections start
+	if opts.preflight && usesIAPBastion(proxyConfig) {
+		go checkRemoteHosts(ctx, runner, proxyConfig, zones, registry)
+	}
+
+	if runAPIProxy != nil {
+		supervisor.supervise(apiProxyName, runAPIProxy)
+	}
+
+	// the platform team's APIs are called with the application default credentials of the
+	// API client, or else the token of gcloud
+	token := func(ctx context.Context) (string, error) {
+		return gcloudAccessToken(ctx, runner)
+	}
+	if api != nil {
+		token = api.accessToken
+	}
+
+	// ship the output of the session to Cloud Logging, redacted
+	var shipper *logShipper
+	if config.CloudLogging.enabled(proxyConfig.Environment) && opts.cloudLogging {
+		shipper = newLogShipper(config.CloudLogging, proxyConfig.Environment, token)
+		logger.copyTo(shipper)
+		go shipper.run()
+	}
+
+	// report who tunneled into the environment and when to the platform team
+	var reporter *sessionReporter
+	if config.Reporting.enabled(proxyConfig.Environment) {
+		account := ""
+		if api == nil {
+			account = gcloudAccount(ctx, runner)
+		}
+		reporter = newSessionReporter(config.Reporting, proxyConfig, account, token)
+		reporter.start(ctx)
+	}
+
+	// read single-key commands when the session runs in a terminal
+	if opts.keys {
+		startKeyboardControls(ctx, sessionKeys(registry, supervisor, cancel))
+	}
+
+	// Print the port table once every tunnel is ready, even with -quiet, then run the
+	// post_start hooks. A fatal hook failure ends the session.
+	go func() {
+		var ready bool
+		phases.run("forwards", func() error {
+			ready = waitReady(ctx, registry, readyTimeout, func(started, total int) {
+				phases.display.update("forwards", fmt.Sprintf("starting %d forwards [%d/%d]", total, started, total))
+			})
+			if !ready {
+				return fmt.Errorf("not every tunnel is ready")
+			}
+			return nil
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		if !quiet {
+			fmt.Println(phases.report())
+		}
+		if opts.profileFile != "" {
+			if err := phases.writeProfile(opts.profileFile, proxyConfig.Environment); err != nil {
+				fmt.Println("Error writing the startup profile:", err)
+			}
+		}
+		if ready {
+			fmt.Println("Every tunnel is ready:")
+			events.emit(lifecycleEvent{Type: eventSessionReady})
+		} else {
+			fmt.Printf("Warning: not every tunnel is ready after %s:\n", readyTimeout)
+			events.emit(lifecycleEvent{Type: eventSessionReady, Error: "not every tunnel is ready"})
+		}
+		writeStatusTable(os.Stdout, registry.snapshot())
+		if proxyConfig.Protected {
+			fmt.Print(protectedBanner(proxyConfig))
+		}
+		// direnv loads the variables of the session from its env file while it runs
+		if err := writeDirenvEnv(home, proxyConfig.Environment, append(toolEnv(config, proxyConfig, home), hookEnv(proxyConfig)...)); err != nil {
+			narrate("Writing the env file for direnv failed:", err)
+		}
+		if opts.mdns {
+			services := mdnsServices(proxyConfig)
+			if err := advertiseMDNS(ctx, services); err != nil {
+				fmt.Println("Warning: the tunnels cannot be advertised over mDNS:", err)
+			} else {
+				printMDNSServices(services)
+			}
+		}
+		if len(proxyConfig.Hooks.PostStart) == 0 {
+			return
+		}
+		if err := runHooks(ctx, hookPostStart, proxyConfig.Hooks.PostStart, env); err != nil && ctx.Err() == nil {
+			fmt.Println("Error:", err)
+			printHint(err)
+			hookFailed.Store(true)
+			cancel()
+		}
+	}()
+	// the children get childStopTimeout to exit after SIGTERM before they are killed, the
+	// tunnels that are still running after that are stuck and their processes are killed
+	if !supervisor.waitStopped(childStopTimeout + time.Second) {
+		fmt.Printf("Warning: killed %d processes of tunnels that did not stop in time.\n", killChildren())
+	}
+	untrackChildren()
+	restoreTerminal()
+	removeDirenvEnv(home, proxyConfig.Environment)
+	if reporter != nil {
+		reporter.stop(context.Background())
+	}
+
+	if err := runHooks(context.Background(), hookPostStop, proxyConfig.Hooks.PostStop, env); err != nil {
+		fmt.Println("Error:", err)
+		printHint(err)
+		hookFailed.Store(true)
+	}
+	restoreOutput()
+	// the session may exit right after, without the deferred close
+	events.emit(lifecycleEvent{Type: eventSessionEnded})
+	events.close()
+	if shipper != nil {
+		shipper.stop()
+	}
+
+	// write the captured traffic once the capture duration is over
+	if opts.capture != nil {
+		<-ctx.Done()
+		if err := opts.capture.finish(); err != nil {
+			fmt.Println("Error writing the traffic capture:", err)
+			os.Exit(1)
+		}
+	}
+	if hookFailed.Load() {
+		os.Exit(1)
+	}
+}
+
+// onlyTunnel returns the proxy configuration reduced to the workload or connection with the given name
+func onlyTunnel(config ProxyConfig, name string) (ProxyConfig, error) {
+	for _, workload := range config.Workloads {
+		if workload.Name() == name {
+			config.Workloads = []Workload{workload}
+			config.Bastion.Connections = nil
+			return config, nil
+		}
+	}
+	for _, connection := range config.Bastion.Connections {
+		if connection.Name() == name {
+			config.Workloads = nil
+			config.Bastion.Connections = []Connection{connection}
+			return config, nil
+		}
 	}
-	wg.Wait()
+	return config, fmt.Errorf("no workload or connection named %s in environment %s", name, config.Environment)
 }
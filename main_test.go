@@ -1,7 +1,9 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"os/exec"
 	"strconv"
 	"testing"
@@ -94,6 +96,60 @@ proxies:
 	}
 }
 
+func TestDuplicateLocalPorts(t *testing.T) {
+	config := ProxyConfig{
+		Workloads: []Workload{{App: "cashfree", LocalPort: 8080}, {App: "ledger", LocalPort: 8080}, {App: "khata", LocalPort: 8082}},
+		Bastion: Bastion{Connections: []Connection{
+			{LocalPort: 8082, RemoteHost: "10.120.52.48", RemotePort: 5432},
+			{LocalPort: 8080, RemoteHost: "10.116.50.3", RemotePort: 6379},
+		}},
+	}
+	_, err := validateLocalPorts(config)
+	if !errors.Is(err, ErrDuplicateLocalPorts) {
+		t.Fatalf("validateLocalPorts failed: expected ErrDuplicateLocalPorts, got %v", err)
+	}
+	var duplicates *DuplicatePortsError
+	if !errors.As(err, &duplicates) || len(duplicates.Conflicts) != 2 {
+		t.Fatalf("validateLocalPorts failed: expected both conflicts, got %v", err)
+	}
+	var out bytes.Buffer
+	duplicates.report(&out)
+	expected := `Error: 2 local ports are used by more than one tunnel in the configuration file:
+  8080: workload cashfree, workload ledger, connection 10.116.50.3:6379
+  8082: workload khata, connection 10.120.52.48:5432
+`
+	if out.String() != expected {
+		t.Errorf("report failed: expected\n%s\ngot\n%s", expected, out.String())
+	}
+
+	config.Workloads = config.Workloads[:1]
+	config.Bastion.Connections = config.Bastion.Connections[:1]
+	ports, err := validateLocalPorts(config)
+	if err != nil || len(ports) != 2 || ports[0] != 8080 || ports[1] != 8082 {
+		t.Errorf("validateLocalPorts failed: expected ports [8080 8082], got %v, %v", ports, err)
+	}
+}
+
+func TestRequiredTools(t *testing.T) {
+	connections := ProxyConfig{Bastion: Bastion{Connections: []Connection{{LocalPort: 5435, RemoteHost: "10.120.52.48", RemotePort: 5432}}}}
+	workloads := ProxyConfig{Workloads: []Workload{{App: "cashfree", LocalPort: 8080}}}
+	apiProxy := ProxyConfig{APIProxy: APIProxy{LocalPort: 8001, Mode: apiProxyBastion}}
+	tests := []struct {
+		config            ProxyConfig
+		bastion, clusters bool
+	}{
+		{connections, true, false},
+		{workloads, false, true},
+		{apiProxy, true, true},
+		{ProxyConfig{}, false, false},
+	}
+	for i, test := range tests {
+		if usesBastion(test.config) != test.bastion || usesClusters(test.config) != test.clusters {
+			t.Errorf("test %d: expected usesBastion %v and usesClusters %v", i, test.bastion, test.clusters)
+		}
+	}
+}
+
 func TestConnectBastion(t *testing.T) {
 	bastion := Bastion{Name: "bastion"}
 	connection := Connection{
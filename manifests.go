@@ -0,0 +1,193 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultManifestFile is the name of the service manifests of the monorepo
+const defaultManifestFile = "service.yaml"
+
+// ServiceManifests derives the workloads of an environment from the service manifests of a
+// monorepo, so that the tunnels follow the service definitions
+type ServiceManifests struct {
+	// Root is the directory searched for manifests, relative to the configuration file
+	Root string `yaml:"root"`
+	// File is the name of the manifests, service.yaml when empty
+	File string `yaml:"file"`
+	// Namespace is the namespace of the services whose manifest does not set one
+	Namespace string `yaml:"namespace"`
+	// Tags are added to the tags of every derived workload
+	Tags []string `yaml:"tags"`
+}
+
+func (m ServiceManifests) enabled() bool {
+	return m.Root != ""
+}
+
+func (m ServiceManifests) file() string {
+	if m.File == "" {
+		return defaultManifestFile
+	}
+	return m.File
+}
+
+// validate checks that the manifests have a root when they are configured
+func (m ServiceManifests) validate() error {
+	if !m.enabled() && (m.File != "" || m.Namespace != "" || len(m.Tags) > 0) {
+		return errors.New("service_manifests needs a root")
+	}
+	if strings.ContainsRune(m.File, filepath.Separator) {
+		return fmt.Errorf("service_manifests: file must be a file name, got %s", m.File)
+	}
+	return nil
+}
+
+// serviceManifest is the part of a service manifest a workload is derived from, the rest
+// of the manifest is ignored
+type serviceManifest struct {
+	// Name is the app label of the service's pods
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace"`
+	Ports     []struct {
+		Name     string `yaml:"name"`
+		Port     int    `yaml:"port"`
+		Protocol string `yaml:"protocol"`
+	} `yaml:"ports"`
+	// LocalPort is the local port of the service's tunnel, its first port when empty
+	LocalPort int      `yaml:"local_port"`
+	Tags      []string `yaml:"tags"`
+	// Environments are the environments the service runs in, every one when empty
+	Environments []string `yaml:"environments"`
+}
+
+// workload returns the workload forwarding the first port of the service
+func (m serviceManifest) workload(manifests ServiceManifests) (Workload, error) {
+	if m.Name == "" {
+		return Workload{}, errors.New("name is not set")
+	}
+	if len(m.Ports) == 0 {
+		return Workload{}, errors.New("no port is declared")
+	}
+	port := m.Ports[0]
+	workload := Workload{
+		Namespace:  m.Namespace,
+		App:        m.Name,
+		LocalPort:  m.LocalPort,
+		RemotePort: port.Port,
+		Protocol:   strings.ToLower(port.Protocol),
+		Tags:       append(slices.Clone(m.Tags), manifests.Tags...),
+	}
+	if workload.Namespace == "" {
+		workload.Namespace = manifests.Namespace
+	}
+	if workload.Namespace == "" {
+		return Workload{}, errors.New("namespace is not set, in the manifest nor in service_manifests")
+	}
+	if workload.LocalPort == 0 {
+		workload.LocalPort = port.Port
+	}
+	if workload.Protocol == "tcp" || workload.Protocol == "" {
+		workload.Protocol = guessProtocol(exposedPort{Port: port.Port, Name: port.Name})
+	}
+	return workload, nil
+}
+
+// manifestRoot returns the directory of the manifests, ~ standing for the home directory
+// and relative paths starting from the directory of the configuration file
+func manifestRoot(root, base string) (string, error) {
+	if root == "~" || strings.HasPrefix(root, "~/") {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		root = filepath.Join(homeDir, root[1:])
+	}
+	if !filepath.IsAbs(root) {
+		root = filepath.Join(base, root)
+	}
+	return root, nil
+}
+
+// readServiceManifests returns the manifests below the root by path, skipping hidden
+// directories and the vendored dependencies. A malformed manifest is warned about and
+// skipped, a broken service must not stop the sessions forwarding the others.
+func readServiceManifests(root, file string) (map[string]serviceManifest, error) {
+	manifests := make(map[string]serviceManifest)
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			name := entry.Name()
+			if path != root && (strings.HasPrefix(name, ".") || name == "node_modules" || name == "vendor") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.Name() != file {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var manifest serviceManifest
+		if err := yaml.Unmarshal(data, &manifest); err != nil {
+			fmt.Printf("Warning: skipping service manifest %s: %v\n", path, err)
+			return nil
+		}
+		manifests[path] = manifest
+		return nil
+	})
+	return manifests, err
+}
+
+// expandServiceManifests adds the workloads derived from the service manifests to every
+// environment using them. A workload of the configuration file forwarding the same app in
+// the same namespace takes precedence over the manifest's, e.g. to change its local port.
+func expandServiceManifests(config *Config, base string) error {
+	for i := range config.Proxies {
+		proxy := &config.Proxies[i]
+		if !proxy.ServiceManifests.enabled() {
+			continue
+		}
+		root, err := manifestRoot(proxy.ServiceManifests.Root, base)
+		if err != nil {
+			return err
+		}
+		manifests, err := readServiceManifests(root, proxy.ServiceManifests.file())
+		if err != nil {
+			return fmt.Errorf("environment %s: reading the service manifests: %w", proxy.Environment, err)
+		}
+		paths := make([]string, 0, len(manifests))
+		for path := range manifests {
+			paths = append(paths, path)
+		}
+		slices.Sort(paths)
+		for _, path := range paths {
+			manifest := manifests[path]
+			if len(manifest.Environments) > 0 && !slices.Contains(manifest.Environments, proxy.Environment) {
+				continue
+			}
+			workload, err := manifest.workload(proxy.ServiceManifests)
+			if err != nil {
+				fmt.Printf("Warning: skipping service manifest %s in environment %s: %v\n", path, proxy.Environment, err)
+				continue
+			}
+			workload.manifest = path
+			if slices.ContainsFunc(proxy.Workloads, func(w Workload) bool { return w.App == workload.App && w.Namespace == workload.Namespace }) {
+				continue
+			}
+			proxy.Workloads = append(proxy.Workloads, workload)
+		}
+	}
+	return nil
+}
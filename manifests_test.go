@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func writeManifest(t *testing.T, root, dir, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+		t.Fatalf("Error creating directories: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, dir, defaultManifestFile), []byte(content), 0o644); err != nil {
+		t.Fatalf("Error writing manifest: %v", err)
+	}
+}
+
+func TestExpandServiceManifests(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "monorepo")
+	writeManifest(t, root, "services/ledger", `name: ledger
+namespace: finance
+build: {dockerfile: Dockerfile}
+ports:
+  - {name: grpc-api, port: 8080}
+  - {name: metrics, port: 9090}
+local_port: 9080
+`)
+	writeManifest(t, root, "services/cashfree", `name: cashfree
+ports: [{name: http, port: 8080}]
+`)
+	writeManifest(t, root, "services/reports", `name: reports
+ports: [{port: 5000, protocol: http}]
+environments: [prod]
+`)
+	writeManifest(t, root, "node_modules/left-pad", "name: left-pad\n")
+
+	config := Config{Proxies: []ProxyConfig{{
+		Environment:      "staging",
+		Workloads:        []Workload{{Namespace: "enr", App: "cashfree", LocalPort: 8081, RemotePort: 8080}},
+		ServiceManifests: ServiceManifests{Root: "monorepo", Namespace: "enr", Tags: []string{"monorepo"}},
+	}}}
+	if err := expandServiceManifests(&config, base); err != nil {
+		t.Fatalf("expandServiceManifests failed: %v", err)
+	}
+	workloads := config.Proxies[0].Workloads
+	if len(workloads) != 2 {
+		t.Fatalf("expandServiceManifests failed: expected 2 workloads, got %+v", workloads)
+	}
+	// the configuration file's cashfree is kept, reports does not run in staging
+	if workloads[0].LocalPort != 8081 {
+		t.Errorf("expandServiceManifests failed: expected the configured workload to win, got %+v", workloads[0])
+	}
+	ledger := workloads[1]
+	if ledger.App != "ledger" || ledger.Namespace != "finance" || ledger.LocalPort != 9080 || ledger.RemotePort != 8080 ||
+		ledger.Protocol != "grpc" || !slices.Equal(ledger.Tags, []string{"monorepo"}) {
+		t.Errorf("expandServiceManifests failed: unexpected workload %+v", ledger)
+	}
+
+	// the broken manifests are skipped, the others still forwarded
+	writeManifest(t, root, "services/broken", "name: broken\n")
+	writeManifest(t, root, "services/malformed", "name: [malformed\n")
+	config.Proxies[0].Workloads = nil
+	if err := expandServiceManifests(&config, base); err != nil || len(config.Proxies[0].Workloads) != 2 {
+		t.Errorf("expandServiceManifests failed: expected the broken manifests to be skipped, got %+v and %v", config.Proxies[0].Workloads, err)
+	}
+}
+
+func TestServiceManifestsValidate(t *testing.T) {
+	if err := (ServiceManifests{Namespace: "enr"}).validate(); err == nil {
+		t.Errorf("validate failed: expected an error without root")
+	}
+	if err := (ServiceManifests{Root: ".", File: "deploy/service.yaml"}).validate(); err == nil {
+		t.Errorf("validate failed: expected an error for a file with a directory")
+	}
+	if err := (ServiceManifests{Root: "."}).validate(); err != nil {
+		t.Errorf("validate failed: %v", err)
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// mdnsAddr is the multicast group and port of mDNS
+var mdnsAddr = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+const (
+	// mdnsTTL is the TTL of the advertised records, in seconds
+	mdnsTTL = 120
+	// mdnsCacheFlush marks the records only devcli answers for, in the class field
+	mdnsCacheFlush = 1 << 15
+	// mdnsServiceType is the DNS-SD type the tunnels are browsable as, besides _http._tcp
+	// for protocol: http workloads
+	mdnsServiceType = "_devcli._tcp"
+)
+
+// mdnsService is a tunnel advertised over mDNS as <name>.local and as a DNS-SD service
+type mdnsService struct {
+	Name        string
+	Port        int
+	ServiceType string
+	// Tunnel is the tunnel's name, in the TXT record of the service
+	Tunnel string
+}
+
+func (s mdnsService) host() string {
+	return s.Name + ".local."
+}
+
+func (s mdnsService) instance() string {
+	return s.Name + "." + s.ServiceType + ".local."
+}
+
+// mdnsLabel turns the name of a tunnel into a DNS label, e.g. 10.120.52.48:5432 into
+// 10-120-52-48-5432
+func mdnsLabel(name string) string {
+	label := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return '-'
+	}, name)
+	return strings.Trim(label, "-")
+}
+
+// mdnsServices returns the services advertising the tunnels of the session
+func mdnsServices(config ProxyConfig) []mdnsService {
+	var services []mdnsService
+	for _, workload := range config.Workloads {
+		serviceType := mdnsServiceType
+		if workload.Protocol == "http" {
+			serviceType = "_http._tcp"
+		}
+		services = append(services, mdnsService{Name: mdnsLabel(workload.Name()), Port: workload.LocalPort, ServiceType: serviceType, Tunnel: workload.Name()})
+	}
+	for _, connection := range config.Bastion.Connections {
+		services = append(services, mdnsService{Name: mdnsLabel(connection.Name()), Port: connection.LocalPort, ServiceType: mdnsServiceType, Tunnel: connection.Name()})
+	}
+	return services
+}
+
+// validateMDNS checks that the tunnels of the session may be advertised: they must listen
+// on an address other devices reach, and production tunnels are never shared
+func validateMDNS(config ProxyConfig, host string) error {
+	if isProduction(config.Environment) {
+		return fmt.Errorf("the tunnels of production environment %s cannot be advertised with -mdns", config.Environment)
+	}
+	if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+		return fmt.Errorf("-mdns advertises the tunnels to the local network, but they only listen on %s; run with -bind-address 0.0.0.0", host)
+	}
+	return nil
+}
+
+// printMDNSServices prints the names the tunnels are advertised as
+func printMDNSServices(services []mdnsService) {
+	var names []string
+	for _, service := range services {
+		names = append(names, fmt.Sprintf("%s:%d", strings.TrimSuffix(service.host(), "."), service.Port))
+	}
+	fmt.Printf("Advertising the tunnels over mDNS as %s.\n", strings.Join(names, ", "))
+}
+
+// mdnsResponder answers the mDNS queries for the advertised services with the address of
+// the interface the query arrived on
+type mdnsResponder struct {
+	services []mdnsService
+}
+
+// records returns the records of the service: its PTR in the service type, SRV, TXT and A
+func (r *mdnsResponder) records(service mdnsService, ip net.IP, ttl uint32) (ptr, srv, txt, a dnsmessage.Resource) {
+	header := func(name string, kind dnsmessage.Type, class dnsmessage.Class) dnsmessage.ResourceHeader {
+		return dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Type: kind, Class: class, TTL: ttl}
+	}
+	ptr = dnsmessage.Resource{Header: header(service.ServiceType+".local.", dnsmessage.TypePTR, dnsmessage.ClassINET),
+		Body: &dnsmessage.PTRResource{PTR: dnsmessage.MustNewName(service.instance())}}
+	srv = dnsmessage.Resource{Header: header(service.instance(), dnsmessage.TypeSRV, dnsmessage.ClassINET|mdnsCacheFlush),
+		Body: &dnsmessage.SRVResource{Port: uint16(service.Port), Target: dnsmessage.MustNewName(service.host())}}
+	txt = dnsmessage.Resource{Header: header(service.instance(), dnsmessage.TypeTXT, dnsmessage.ClassINET|mdnsCacheFlush),
+		Body: &dnsmessage.TXTResource{TXT: []string{"tunnel=" + service.Tunnel}}}
+	var addr [4]byte
+	copy(addr[:], ip.To4())
+	a = dnsmessage.Resource{Header: header(service.host(), dnsmessage.TypeA, dnsmessage.ClassINET|mdnsCacheFlush),
+		Body: &dnsmessage.AResource{A: addr}}
+	return ptr, srv, txt, a
+}
+
+// answer returns the response to an mDNS query, false when it asks for nothing advertised
+func (r *mdnsResponder) answer(query []byte, ip net.IP) ([]byte, bool) {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(query); err != nil || msg.Header.Response {
+		return nil, false
+	}
+	response := dnsmessage.Message{Header: dnsmessage.Header{Response: true, Authoritative: true}}
+	added := make(map[string]bool)
+	add := func(section *[]dnsmessage.Resource, record dnsmessage.Resource) {
+		key := record.Header.Name.String() + "/" + record.Header.Type.String()
+		if !added[key] {
+			added[key] = true
+			*section = append(*section, record)
+		}
+	}
+	for _, question := range msg.Questions {
+		name := strings.ToLower(question.Name.String())
+		all := question.Type == dnsmessage.TypeALL
+		if name == "_services._dns-sd._udp.local." && (all || question.Type == dnsmessage.TypePTR) {
+			for _, service := range r.services {
+				add(&response.Answers, dnsmessage.Resource{
+					Header: dnsmessage.ResourceHeader{Name: question.Name, Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET, TTL: mdnsTTL},
+					Body:   &dnsmessage.PTRResource{PTR: dnsmessage.MustNewName(service.ServiceType + ".local.")},
+				})
+			}
+			continue
+		}
+		for _, service := range r.services {
+			ptr, srv, txt, a := r.records(service, ip, mdnsTTL)
+			switch {
+			case name == strings.ToLower(service.ServiceType+".local.") && (all || question.Type == dnsmessage.TypePTR):
+				add(&response.Answers, ptr)
+				add(&response.Additionals, srv)
+				add(&response.Additionals, txt)
+				add(&response.Additionals, a)
+			case name == service.instance() && (all || question.Type == dnsmessage.TypeSRV || question.Type == dnsmessage.TypeTXT):
+				if all || question.Type == dnsmessage.TypeSRV {
+					add(&response.Answers, srv)
+					add(&response.Additionals, a)
+				}
+				if all || question.Type == dnsmessage.TypeTXT {
+					add(&response.Answers, txt)
+				}
+			case name == service.host() && (all || question.Type == dnsmessage.TypeA):
+				add(&response.Answers, a)
+			}
+		}
+	}
+	if len(response.Answers) == 0 {
+		return nil, false
+	}
+	packed, err := response.Pack()
+	return packed, err == nil
+}
+
+// announcement returns the unsolicited response announcing every service, or withdrawing
+// them with a ttl of 0
+func (r *mdnsResponder) announcement(ip net.IP, ttl uint32) ([]byte, error) {
+	response := dnsmessage.Message{Header: dnsmessage.Header{Response: true, Authoritative: true}}
+	for _, service := range r.services {
+		ptr, srv, txt, a := r.records(service, ip, ttl)
+		response.Answers = append(response.Answers, ptr, srv, txt, a)
+	}
+	return response.Pack()
+}
+
+// mdnsInterfaces returns the interfaces mDNS is advertised on with their IPv4 address
+func mdnsInterfaces() (map[*net.Interface]net.IP, error) {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[*net.Interface]net.IP)
+	for i := range interfaces {
+		iface := &interfaces[i]
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagMulticast == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.To4() != nil {
+				found[iface] = ipnet.IP.To4()
+				break
+			}
+		}
+	}
+	return found, nil
+}
+
+// advertiseMDNS announces the services on every multicast interface and answers the
+// queries for them until the context is canceled, when they are withdrawn
+func advertiseMDNS(ctx context.Context, services []mdnsService) error {
+	interfaces, err := mdnsInterfaces()
+	if err != nil {
+		return err
+	}
+	if len(interfaces) == 0 {
+		return fmt.Errorf("no network interface supports multicast")
+	}
+	responder := &mdnsResponder{services: services}
+	for iface, ip := range interfaces {
+		conn, err := net.ListenMulticastUDP("udp4", iface, mdnsAddr)
+		if err != nil {
+			return fmt.Errorf("listening for mDNS queries on %s: %w", iface.Name, err)
+		}
+		go func() {
+			<-ctx.Done()
+			if goodbye, err := responder.announcement(ip, 0); err == nil {
+				conn.WriteToUDP(goodbye, mdnsAddr)
+			}
+			conn.Close()
+		}()
+		// the announcement is repeated once, as multicast packets may be lost
+		go func() {
+			for i := 0; i < 2 && ctx.Err() == nil; i++ {
+				if announcement, err := responder.announcement(ip, mdnsTTL); err == nil {
+					conn.WriteToUDP(announcement, mdnsAddr)
+				}
+				select {
+				case <-ctx.Done():
+				case <-time.After(time.Second):
+				}
+			}
+		}()
+		go func() {
+			buf := make([]byte, 9000)
+			for {
+				n, _, err := conn.ReadFromUDP(buf)
+				if err != nil {
+					return
+				}
+				if response, ok := responder.answer(buf[:n], ip); ok {
+					conn.WriteToUDP(response, mdnsAddr)
+				}
+			}
+		}()
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// mdnsQuery packs a query for the name and type, with the unicast-response bit mDNS
+// clients set in the class
+func mdnsQuery(t *testing.T, name string, kind dnsmessage.Type) []byte {
+	query := dnsmessage.Message{Questions: []dnsmessage.Question{{Name: dnsmessage.MustNewName(name), Type: kind, Class: dnsmessage.ClassINET | 1<<15}}}
+	packed, err := query.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return packed
+}
+
+func TestMDNSResponder(t *testing.T) {
+	config := ProxyConfig{
+		Workloads: []Workload{{App: "payments", LocalPort: 15001, Protocol: "http"}},
+		Bastion:   Bastion{Connections: []Connection{{LocalPort: 5435, RemoteHost: "10.120.52.48", RemotePort: 5432}}},
+	}
+	services := mdnsServices(config)
+	if len(services) != 2 || services[1].Name != "10-120-52-48-5432" || services[0].ServiceType != "_http._tcp" {
+		t.Fatalf("mdnsServices failed: unexpected services %+v", services)
+	}
+	responder := &mdnsResponder{services: services}
+	ip := net.IPv4(192, 168, 1, 20)
+
+	response, ok := responder.answer(mdnsQuery(t, "payments.local.", dnsmessage.TypeA), ip)
+	if !ok {
+		t.Fatal("answer failed: expected the A record of payments.local")
+	}
+	var msg dnsmessage.Message
+	if err := msg.Unpack(response); err != nil {
+		t.Fatal(err)
+	}
+	if len(msg.Answers) != 1 || msg.Answers[0].Body.(*dnsmessage.AResource).A != [4]byte{192, 168, 1, 20} {
+		t.Errorf("answer failed: unexpected answers %v", msg.Answers)
+	}
+
+	response, ok = responder.answer(mdnsQuery(t, "_http._tcp.local.", dnsmessage.TypePTR), ip)
+	if !ok {
+		t.Fatal("answer failed: expected the PTR record of the http services")
+	}
+	if err := msg.Unpack(response); err != nil {
+		t.Fatal(err)
+	}
+	if len(msg.Answers) != 1 || msg.Answers[0].Body.(*dnsmessage.PTRResource).PTR.String() != "payments._http._tcp.local." {
+		t.Errorf("answer failed: unexpected answers %v", msg.Answers)
+	}
+	var port uint16
+	for _, additional := range msg.Additionals {
+		if srv, ok := additional.Body.(*dnsmessage.SRVResource); ok {
+			port = srv.Port
+		}
+	}
+	if port != 15001 {
+		t.Errorf("answer failed: expected the SRV record of port 15001, got %d", port)
+	}
+
+	if _, ok := responder.answer(mdnsQuery(t, "printer.local.", dnsmessage.TypeA), ip); ok {
+		t.Error("answer failed: expected no answer for a name that is not advertised")
+	}
+}
+
+func TestValidateMDNS(t *testing.T) {
+	for _, tc := range []struct {
+		environment, host string
+		valid             bool
+	}{
+		{"staging", "0.0.0.0", true},
+		{"staging", "192.168.1.20", true},
+		{"staging", "localhost", false},
+		{"staging", "127.0.0.1", false},
+		{"prod", "0.0.0.0", false},
+	} {
+		err := validateMDNS(ProxyConfig{Environment: tc.environment}, tc.host)
+		if (err == nil) != tc.valid {
+			t.Errorf("validateMDNS(%s, %s) failed: expected valid %v, got %v", tc.environment, tc.host, tc.valid, err)
+		}
+	}
+}
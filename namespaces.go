@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// maxNamespaceSuggestions is how many close matches of an unknown namespace are suggested
+const maxNamespaceSuggestions = 3
+
+// unknownNamespace is a namespace of the workloads that does not exist in its cluster
+type unknownNamespace struct {
+	Context   string
+	Namespace string
+	Workloads []string
+	// Suggestions are the existing namespaces closest to it, closest first
+	Suggestions []string
+	// Available are every namespace of the cluster
+	Available []string
+}
+
+// UnknownNamespacesError lists the namespaces of the workloads that do not exist, which
+// would otherwise show up as workloads without pods
+type UnknownNamespacesError struct {
+	Unknown []unknownNamespace
+}
+
+func (e *UnknownNamespacesError) Error() string {
+	var namespaces []string
+	for _, unknown := range e.Unknown {
+		namespace := fmt.Sprintf("%s in %s", unknown.Namespace, unknown.Context)
+		if len(unknown.Suggestions) > 0 {
+			namespace += fmt.Sprintf(" (did you mean %s?)", strings.Join(unknown.Suggestions, ", "))
+		}
+		namespaces = append(namespaces, namespace)
+	}
+	return "namespace does not exist: " + strings.Join(namespaces, "; ")
+}
+
+// report prints every unknown namespace with its workloads, close matches and the
+// namespaces of its cluster
+func (e *UnknownNamespacesError) report(w io.Writer) {
+	fmt.Fprintf(w, "Error: %d namespaces of the workloads do not exist:\n", len(e.Unknown))
+	for _, unknown := range e.Unknown {
+		fmt.Fprintf(w, "  %s in %s, used by %s\n", unknown.Namespace, unknown.Context, strings.Join(unknown.Workloads, ", "))
+		if len(unknown.Suggestions) > 0 {
+			fmt.Fprintf(w, "    did you mean %s?\n", strings.Join(unknown.Suggestions, ", "))
+		}
+		fmt.Fprintf(w, "    available: %s\n", strings.Join(unknown.Available, ", "))
+	}
+}
+
+// namespacesArgs are the kubectl arguments listing the namespaces of a cluster
+func namespacesArgs() []string {
+	return []string{"get", "namespaces", "-o", "jsonpath={.items[*].metadata.name}"}
+}
+
+// checkNamespaces verifies that the namespace of every workload exists in its cluster,
+// listing the namespaces once per cluster. A cluster whose namespaces the user may not
+// list is not checked.
+func checkNamespaces(ctx context.Context, runner *commandRunner, workloads []Workload) error {
+	var contexts []string
+	for _, workload := range workloads {
+		if !slices.Contains(contexts, workload.kubeContext) {
+			contexts = append(contexts, workload.kubeContext)
+		}
+	}
+	namespaces := make([][]string, len(contexts))
+	var lists []func() error
+	for i, kubeContext := range contexts {
+		lists = append(lists, func() error {
+			cmd := kubectlCommand(ctx, Workload{kubeContext: kubeContext}, namespacesArgs()...)
+			cmd.Stderr = narrationWriter("kubectl")
+			out, err := runner.output(ctx, cmd)
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				narrate("Not checking the namespaces of", kubeContext, "as they cannot be listed:", err)
+				return nil
+			}
+			namespaces[i] = strings.Fields(string(out))
+			return nil
+		})
+	}
+	if err := runParallel(lists...); err != nil {
+		return err
+	}
+
+	unknown := &UnknownNamespacesError{}
+	for _, workload := range workloads {
+		available := namespaces[slices.Index(contexts, workload.kubeContext)]
+		if available == nil || slices.Contains(available, workload.Namespace) {
+			continue
+		}
+		i := slices.IndexFunc(unknown.Unknown, func(u unknownNamespace) bool {
+			return u.Context == workload.kubeContext && u.Namespace == workload.Namespace
+		})
+		if i < 0 {
+			unknown.Unknown = append(unknown.Unknown, unknownNamespace{Context: workload.kubeContext, Namespace: workload.Namespace,
+				Suggestions: suggestNamespaces(workload.Namespace, available), Available: available})
+			i = len(unknown.Unknown) - 1
+		}
+		unknown.Unknown[i].Workloads = append(unknown.Unknown[i].Workloads, workload.Name())
+	}
+	if len(unknown.Unknown) > 0 {
+		return unknown
+	}
+	return nil
+}
+
+// suggestNamespaces returns the namespaces close enough to the unknown one to be what was
+// meant, by edit distance, closest first
+func suggestNamespaces(namespace string, available []string) []string {
+	type candidate struct {
+		name     string
+		distance int
+	}
+	var candidates []candidate
+	limit := max(2, len(namespace)/3)
+	for _, name := range available {
+		distance := editDistance(namespace, name)
+		if distance <= limit || strings.Contains(name, namespace) || strings.Contains(namespace, name) {
+			candidates = append(candidates, candidate{name, distance})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].distance < candidates[j].distance
+	})
+	var suggestions []string
+	for _, c := range candidates[:min(len(candidates), maxNamespaceSuggestions)] {
+		suggestions = append(suggestions, c.name)
+	}
+	return suggestions
+}
+
+// editDistance is the Levenshtein distance of two strings
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
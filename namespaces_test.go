@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCheckNamespaces(t *testing.T) {
+	// a kubectl whose data cluster does not let the user list namespaces
+	dir := t.TempDir()
+	script := `#!/bin/sh
+case "$*" in
+*"--context data"*) echo 'Error from server (Forbidden): namespaces is forbidden' >&2; exit 1 ;;
+esac
+echo "default enr payments kube-system"
+`
+	if err := os.WriteFile(filepath.Join(dir, "kubectl"), []byte(script), 0755); err != nil {
+		t.Fatalf("Error writing the fake kubectl: %v", err)
+	}
+	t.Setenv("PATH", dir+string(filepath.ListSeparator)+os.Getenv("PATH"))
+	runner := newCommandRunner(2, 0)
+
+	workloads := []Workload{
+		{App: "cashfree", Namespace: "enr", kubeContext: "main"},
+		{App: "ledger", Namespace: "payment", kubeContext: "main"},
+		{App: "refunds", Namespace: "payment", kubeContext: "main"},
+		{App: "spark", Namespace: "missing", kubeContext: "data"},
+	}
+	err := checkNamespaces(context.Background(), runner, workloads)
+	var unknown *UnknownNamespacesError
+	if !errors.As(err, &unknown) || len(unknown.Unknown) != 1 {
+		t.Fatalf("checkNamespaces failed: expected one unknown namespace, got %v", err)
+	}
+	got := unknown.Unknown[0]
+	if got.Namespace != "payment" || !slices.Equal(got.Workloads, []string{"ledger", "refunds"}) || !slices.Equal(got.Suggestions, []string{"payments"}) {
+		t.Errorf("checkNamespaces failed: unexpected unknown namespace %+v", got)
+	}
+	var b bytes.Buffer
+	unknown.report(&b)
+	if !strings.Contains(b.String(), "did you mean payments?") || !strings.Contains(b.String(), "available: default, enr, payments, kube-system") {
+		t.Errorf("report failed: unexpected output %q", b.String())
+	}
+
+	if err := checkNamespaces(context.Background(), runner, workloads[:1]); err != nil {
+		t.Errorf("checkNamespaces failed: expected existing namespaces to pass, got %v", err)
+	}
+}
+
+func TestSuggestNamespaces(t *testing.T) {
+	available := []string{"default", "enr", "enr-staging", "payments", "kube-system"}
+	for _, tc := range []struct {
+		namespace string
+		expected  []string
+	}{
+		{"ern", []string{"enr"}},
+		{"staging", []string{"enr-staging"}},
+		{"paymnets", []string{"payments"}},
+		{"kube", []string{"kube-system"}},
+		{"billing", nil},
+	} {
+		if got := suggestNamespaces(tc.namespace, available); !slices.Equal(got, tc.expected) {
+			t.Errorf("suggestNamespaces(%q) failed: expected %v, got %v", tc.namespace, tc.expected, got)
+		}
+	}
+	if editDistance("kitten", "sitting") != 3 {
+		t.Errorf("editDistance failed: expected 3, got %d", editDistance("kitten", "sitting"))
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Formats of the -output flag of informational commands
+const (
+	outputText = "text"
+	outputJSON = "json"
+	outputYAML = "yaml"
+)
+
+// outputFlag registers the -output flag of an informational command
+func outputFlag(fs *flag.FlagSet, format *string) {
+	fs.StringVar(format, "output", outputText, "Output format: text, json or yaml")
+}
+
+// checkOutputFormat returns an error for unknown -output values
+func checkOutputFormat(format string) error {
+	switch format {
+	case outputText, outputJSON, outputYAML:
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q, expected text, json or yaml", format)
+}
+
+// writeOutput writes value as json or yaml, or calls text for the text format. The json and
+// yaml documents of a command are its stable schema, fields are only ever added to them.
+func writeOutput(w io.Writer, format string, value interface{}, text func(io.Writer)) error {
+	switch format {
+	case outputJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	case outputYAML:
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(value); err != nil {
+			return err
+		}
+		return encoder.Close()
+	case outputText:
+		text(w)
+		return nil
+	}
+	return checkOutputFormat(format)
+}
+
+// sessionOutput is the schema of the status of a running session
+type sessionOutput struct {
+	Environment string         `json:"environment" yaml:"environment"`
+	Tunnels     []tunnelOutput `json:"tunnels" yaml:"tunnels"`
+	// APICalls are the calls of the session to the Google APIs within the last minute
+	APICalls []apiCallRate `json:"api_calls" yaml:"api_calls"`
+}
+
+// tunnelOutput is the schema of the status of one tunnel, latencies are in milliseconds
+type tunnelOutput struct {
+	Name         string    `json:"name" yaml:"name"`
+	Kind         string    `json:"kind" yaml:"kind"`
+	LocalPort    int       `json:"local_port" yaml:"local_port"`
+	Protocol     string    `json:"protocol" yaml:"protocol"`
+	State        string    `json:"state" yaml:"state"`
+	Restarts     int       `json:"restarts" yaml:"restarts"`
+	Liveness     string    `json:"liveness" yaml:"liveness"`
+	Health       string    `json:"health" yaml:"health"`
+	ConnectP50Ms float64   `json:"connect_p50_ms" yaml:"connect_p50_ms"`
+	ConnectP95Ms float64   `json:"connect_p95_ms" yaml:"connect_p95_ms"`
+	RTTP50Ms     float64   `json:"rtt_p50_ms" yaml:"rtt_p50_ms"`
+	RTTP95Ms     float64   `json:"rtt_p95_ms" yaml:"rtt_p95_ms"`
+	LastError    string    `json:"last_error" yaml:"last_error"`
+	UpdatedAt    time.Time `json:"updated_at" yaml:"updated_at"`
+}
+
+func newSessionOutput(environment string, statuses []tunnelStatus) sessionOutput {
+	milliseconds := func(d time.Duration) float64 {
+		return float64(d) / float64(time.Millisecond)
+	}
+	session := sessionOutput{Environment: environment, Tunnels: []tunnelOutput{}, APICalls: []apiCallRate{}}
+	for _, s := range statuses {
+		session.Tunnels = append(session.Tunnels, tunnelOutput{
+			Name:         s.Name,
+			Kind:         s.Kind,
+			LocalPort:    s.LocalPort,
+			Protocol:     s.Protocol,
+			State:        s.State,
+			Restarts:     s.Restarts,
+			Liveness:     s.Liveness,
+			Health:       s.Health,
+			ConnectP50Ms: milliseconds(s.ConnectP50),
+			ConnectP95Ms: milliseconds(s.ConnectP95),
+			RTTP50Ms:     milliseconds(s.RTTP50),
+			RTTP95Ms:     milliseconds(s.RTTP95),
+			LastError:    s.LastError,
+			UpdatedAt:    s.UpdatedAt,
+		})
+	}
+	return session
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestWriteOutput(t *testing.T) {
+	statuses := []tunnelStatus{{Name: "cashfree", Kind: kindWorkload, LocalPort: 8080, Protocol: "http", State: stateRunning, ConnectP50: 1500 * time.Microsecond}}
+	sessions := []sessionOutput{newSessionOutput("staging", statuses)}
+
+	var out bytes.Buffer
+	if err := writeOutput(&out, outputJSON, sessions, nil); err != nil {
+		t.Fatalf("writeOutput failed: %v", err)
+	}
+	var decoded []map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("writeOutput failed: invalid json %q: %v", out.String(), err)
+	}
+	tunnel := decoded[0]["tunnels"].([]interface{})[0].(map[string]interface{})
+	if decoded[0]["environment"] != "staging" || tunnel["local_port"] != float64(8080) || tunnel["connect_p50_ms"] != 1.5 {
+		t.Errorf("writeOutput failed: unexpected json %s", out.String())
+	}
+
+	out.Reset()
+	if err := writeOutput(&out, outputYAML, sessions, nil); err != nil {
+		t.Fatalf("writeOutput failed: %v", err)
+	}
+	var fromYAML []sessionOutput
+	if err := yaml.Unmarshal(out.Bytes(), &fromYAML); err != nil {
+		t.Fatalf("writeOutput failed: invalid yaml %q: %v", out.String(), err)
+	}
+	if len(fromYAML) != 1 || fromYAML[0].Tunnels[0].State != stateRunning {
+		t.Errorf("writeOutput failed: unexpected yaml %s", out.String())
+	}
+
+	out.Reset()
+	writeOutput(&out, outputText, sessions, func(w io.Writer) { io.WriteString(w, "text\n") })
+	if out.String() != "text\n" {
+		t.Errorf("writeOutput failed: unexpected text output %q", out.String())
+	}
+	if err := writeOutput(&out, "xml", sessions, nil); err == nil || !strings.Contains(err.Error(), "xml") {
+		t.Errorf("writeOutput failed: expected an error for an unknown format, got %v", err)
+	}
+}
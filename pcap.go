@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	pcapLinkTypeRaw = 101
+	pcapMaxSegment  = 16384
+
+	tcpFlagFin = 0x01
+	tcpFlagSyn = 0x02
+	tcpFlagPsh = 0x08
+	tcpFlagAck = 0x10
+)
+
+// pcapConn is the synthesized TCP state of one relayed connection
+type pcapConn struct {
+	clientPort uint16
+	clientSeq  uint32
+	serverSeq  uint32
+}
+
+// pcapWriter writes the traffic of a relay as a pcap file. The bytes are seen above the
+// socket layer, so IPv4/TCP headers (handshake, sequence numbers and teardown) are
+// synthesized for each connection so that Wireshark can follow the streams.
+type pcapWriter struct {
+	mu         sync.Mutex
+	w          *bufio.Writer
+	serverPort uint16
+	conns      map[int]*pcapConn
+	err        error
+}
+
+// newPCAPWriter writes the pcap file header and returns a writer for connections to serverPort
+func newPCAPWriter(w io.Writer, serverPort int) (*pcapWriter, error) {
+	p := &pcapWriter{w: bufio.NewWriter(w), serverPort: uint16(serverPort), conns: make(map[int]*pcapConn)}
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header[0:4], 0xa1b2c3d4)
+	binary.LittleEndian.PutUint16(header[4:6], 2)
+	binary.LittleEndian.PutUint16(header[6:8], 4)
+	binary.LittleEndian.PutUint32(header[16:20], 65535)
+	binary.LittleEndian.PutUint32(header[20:24], pcapLinkTypeRaw)
+	if _, err := p.w.Write(header); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *pcapWriter) connOpened(id int, client net.Addr) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	conn := &pcapConn{clientPort: uint16(49152 + id%16384), clientSeq: 1000, serverSeq: 5000}
+	if tcp, ok := client.(*net.TCPAddr); ok {
+		conn.clientPort = uint16(tcp.Port)
+	}
+	p.conns[id] = conn
+	p.packet(conn, true, tcpFlagSyn, nil)
+	conn.clientSeq++
+	p.packet(conn, false, tcpFlagSyn|tcpFlagAck, nil)
+	conn.serverSeq++
+	p.packet(conn, true, tcpFlagAck, nil)
+}
+
+func (p *pcapWriter) connData(id int, fromClient bool, data []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	conn, ok := p.conns[id]
+	if !ok {
+		return
+	}
+	for len(data) > 0 {
+		segment := data
+		if len(segment) > pcapMaxSegment {
+			segment = segment[:pcapMaxSegment]
+		}
+		data = data[len(segment):]
+		p.packet(conn, fromClient, tcpFlagPsh|tcpFlagAck, segment)
+		if fromClient {
+			conn.clientSeq += uint32(len(segment))
+		} else {
+			conn.serverSeq += uint32(len(segment))
+		}
+	}
+}
+
+func (p *pcapWriter) connClosed(id int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	conn, ok := p.conns[id]
+	if !ok {
+		return
+	}
+	delete(p.conns, id)
+	p.packet(conn, true, tcpFlagFin|tcpFlagAck, nil)
+	conn.clientSeq++
+	p.packet(conn, false, tcpFlagFin|tcpFlagAck, nil)
+	conn.serverSeq++
+	p.packet(conn, true, tcpFlagAck, nil)
+}
+
+// Close flushes the buffered packets and returns the first write error, if any
+func (p *pcapWriter) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.w.Flush(); err != nil && p.err == nil {
+		p.err = err
+	}
+	return p.err
+}
+
+// packet writes one synthesized IPv4/TCP packet between 127.0.0.1:clientPort and
+// 127.0.0.1:serverPort. The caller must hold the lock.
+func (p *pcapWriter) packet(conn *pcapConn, fromClient bool, flags byte, payload []byte) {
+	srcPort, dstPort := conn.clientPort, p.serverPort
+	seq, ack := conn.clientSeq, conn.serverSeq
+	if !fromClient {
+		srcPort, dstPort = dstPort, srcPort
+		seq, ack = ack, seq
+	}
+	loopback := []byte{127, 0, 0, 1}
+
+	segment := make([]byte, 20+len(payload))
+	binary.BigEndian.PutUint16(segment[0:2], srcPort)
+	binary.BigEndian.PutUint16(segment[2:4], dstPort)
+	binary.BigEndian.PutUint32(segment[4:8], seq)
+	if flags&tcpFlagAck != 0 {
+		binary.BigEndian.PutUint32(segment[8:12], ack)
+	}
+	segment[12] = 5 << 4
+	segment[13] = flags
+	binary.BigEndian.PutUint16(segment[14:16], 65535)
+	copy(segment[20:], payload)
+	pseudo := make([]byte, 12, 12+len(segment))
+	copy(pseudo[0:4], loopback)
+	copy(pseudo[4:8], loopback)
+	pseudo[9] = 6
+	binary.BigEndian.PutUint16(pseudo[10:12], uint16(len(segment)))
+	binary.BigEndian.PutUint16(segment[16:18], internetChecksum(append(pseudo, segment...)))
+
+	ip := make([]byte, 20, 20+len(segment))
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:4], uint16(20+len(segment)))
+	ip[8] = 64
+	ip[9] = 6
+	copy(ip[12:16], loopback)
+	copy(ip[16:20], loopback)
+	binary.BigEndian.PutUint16(ip[10:12], internetChecksum(ip))
+	ip = append(ip, segment...)
+
+	now := time.Now()
+	record := make([]byte, 16)
+	binary.LittleEndian.PutUint32(record[0:4], uint32(now.Unix()))
+	binary.LittleEndian.PutUint32(record[4:8], uint32(now.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(record[8:12], uint32(len(ip)))
+	binary.LittleEndian.PutUint32(record[12:16], uint32(len(ip)))
+	if p.err != nil {
+		return
+	}
+	if _, err := p.w.Write(record); err != nil {
+		p.err = err
+		return
+	}
+	if _, err := p.w.Write(ip); err != nil {
+		p.err = err
+	}
+}
+
+// internetChecksum is the ones' complement checksum used by IPv4 and TCP headers
+func internetChecksum(data []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(data); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(data[i : i+2]))
+	}
+	if len(data)%2 == 1 {
+		sum += uint32(data[len(data)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = (sum & 0xffff) + (sum >> 16)
+	}
+	return ^uint16(sum)
+}
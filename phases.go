@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// phaseTiming is the duration of one named startup phase
+type phaseTiming struct {
+	Name string
+	// Start is when the phase started, after the start of the session
+	Start    time.Duration
+	Duration time.Duration
+}
+
+// phaseTimer records the duration of startup phases, which may run concurrently
+type phaseTimer struct {
+	// display shows the progress of the phases, nil when the session narrates its steps
+	display *progressDisplay
+	// started is the start of the session
+	started time.Time
+
+	mu     sync.Mutex
+	phases []phaseTiming
+}
+
+// run runs fn as the named phase and records its duration
+func (t *phaseTimer) run(name string, fn func() error) error {
+	start := time.Now()
+	t.display.start(name)
+	err := fn()
+	duration := time.Since(start)
+	t.display.finish(name, duration, err)
+	t.mu.Lock()
+	t.phases = append(t.phases, phaseTiming{Name: name, Start: start.Sub(t.started), Duration: duration})
+	t.mu.Unlock()
+	return err
+}
+
+// String renders the breakdown, e.g. "gcloud project 1.2s, bastion zone 2.1s"
+func (t *phaseTimer) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	parts := make([]string, 0, len(t.phases))
+	for _, phase := range t.phases {
+		parts = append(parts, fmt.Sprintf("%s %s", phase.Name, phase.Duration.Round(100*time.Millisecond)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// report renders the time the session took to start followed by the breakdown, e.g.
+// "Started in 9.6s: bastion zone 2.1s, cluster credentials 4.3s, forwards 3.2s"
+func (t *phaseTimer) report() string {
+	return fmt.Sprintf("Started in %s: %s", time.Since(t.started).Round(100*time.Millisecond), t)
+}
+
+// startupProfile is the JSON document of -profile
+type startupProfile struct {
+	Environment string         `json:"environment"`
+	StartedAt   time.Time      `json:"started_at"`
+	Seconds     float64        `json:"seconds"`
+	Phases      []profilePhase `json:"phases"`
+}
+
+// profilePhase is a startup phase of the profile, in seconds after the start of the session
+type profilePhase struct {
+	Name    string  `json:"name"`
+	Start   float64 `json:"start"`
+	Seconds float64 `json:"seconds"`
+}
+
+// writeProfile writes the startup phases of the session to the file as JSON
+func (t *phaseTimer) writeProfile(path, environment string) error {
+	t.mu.Lock()
+	profile := startupProfile{Environment: environment, StartedAt: t.started, Seconds: time.Since(t.started).Seconds(), Phases: []profilePhase{}}
+	for _, phase := range t.phases {
+		profile.Phases = append(profile.Phases, profilePhase{Name: phase.Name, Start: phase.Start.Seconds(), Seconds: phase.Duration.Seconds()})
+	}
+	t.mu.Unlock()
+	data, err := json.MarshalIndent(profile, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// runParallel runs the functions concurrently and returns the first error
+func runParallel(fns ...func() error) error {
+	errs := make([]error, len(fns))
+	var wg sync.WaitGroup
+	for i, fn := range fns {
+		wg.Add(1)
+		go func(i int, fn func() error) {
+			defer wg.Done()
+			errs[i] = fn()
+		}(i, fn)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunParallel(t *testing.T) {
+	start := time.Now()
+	err := runParallel(
+		func() error { time.Sleep(100 * time.Millisecond); return nil },
+		func() error { time.Sleep(100 * time.Millisecond); return errors.New("cluster discovery failed") },
+	)
+	if err == nil || err.Error() != "cluster discovery failed" {
+		t.Errorf("runParallel failed: unexpected error %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 190*time.Millisecond {
+		t.Errorf("runParallel failed: functions did not run concurrently (%s)", elapsed)
+	}
+}
+
+func TestPhaseTimer(t *testing.T) {
+	phases := &phaseTimer{}
+	phases.run("gcloud project", func() error { time.Sleep(100 * time.Millisecond); return nil })
+	phases.run("bastion zone", func() error { return nil })
+	if breakdown := phases.String(); !strings.HasPrefix(breakdown, "gcloud project ") || !strings.HasSuffix(breakdown, ", bastion zone 0s") {
+		t.Errorf("phaseTimer failed: unexpected breakdown %q", breakdown)
+	}
+}
+
+func TestPhaseTimerProfile(t *testing.T) {
+	phases := &phaseTimer{started: time.Now().Add(-time.Second)}
+	phases.run("bastion zone", func() error { return nil })
+	if report := phases.report(); !strings.HasPrefix(report, "Started in 1s: bastion zone 0s") {
+		t.Errorf("report failed: unexpected report %q", report)
+	}
+
+	path := filepath.Join(t.TempDir(), "profile.json")
+	if err := phases.writeProfile(path, "staging"); err != nil {
+		t.Fatalf("writeProfile failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var profile startupProfile
+	if err := json.Unmarshal(data, &profile); err != nil {
+		t.Fatalf("writeProfile failed: invalid JSON %s: %v", data, err)
+	}
+	if profile.Environment != "staging" || profile.Seconds < 1 || len(profile.Phases) != 1 || profile.Phases[0].Name != "bastion zone" || profile.Phases[0].Start < 1 {
+		t.Errorf("writeProfile failed: unexpected profile %+v", profile)
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// lastEnvironmentPath is the file remembering the environment picked last
+func lastEnvironmentPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, ".devcli", "last-environment"), nil
+}
+
+// readLastEnvironment returns the environment picked last, or an empty string
+func readLastEnvironment() string {
+	path, err := lastEnvironmentPath()
+	if err != nil {
+		return ""
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func saveLastEnvironment(environment string) error {
+	path, err := lastEnvironmentPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(environment+"\n"), 0600)
+}
+
+// chooseEnvironment asks the user for the environment when neither the command line, the
+// profile nor the configuration sets one. The choice is remembered and offered as the
+// default the next time, and used as it is when there is no terminal to ask on.
+func chooseEnvironment(config *Config) error {
+	if config.Environment != "" {
+		return nil
+	}
+	last := readLastEnvironment()
+	if _, err := findProxyConfig(Config{Environment: last, Proxies: config.Proxies}); err != nil {
+		last = ""
+	}
+	if !isTerminal(os.Stdin) {
+		if last == "" {
+			return errors.New("environment is not set in the configuration file or passed as a command line argument")
+		}
+		fmt.Println("Using the last chosen environment:", last)
+		config.Environment = last
+		return nil
+	}
+	environment, err := pickEnvironment(bufio.NewReader(os.Stdin), os.Stdout, config.Proxies, last)
+	if err != nil {
+		return err
+	}
+	if err := saveLastEnvironment(environment); err != nil {
+		fmt.Println("Warning: remembering the environment failed:", err)
+	}
+	config.Environment = environment
+	return nil
+}
+
+// pickEnvironment prints the environments with their projects and reads the choice, by
+// number or by name. An empty answer picks the default, the last chosen environment.
+func pickEnvironment(in *bufio.Reader, out io.Writer, proxies []ProxyConfig, preselected string) (string, error) {
+	if len(proxies) == 0 {
+		return "", errors.New("the configuration file has no environments")
+	}
+	fmt.Fprintln(out, "Choose the environment:")
+	for i, proxy := range proxies {
+		marker := " "
+		if proxy.Environment == preselected {
+			marker = "*"
+		}
+		fmt.Fprintf(out, "%s %d) %s (%s)\n", marker, i+1, proxy.Environment, proxy.CloudProject)
+	}
+	for {
+		if preselected != "" {
+			fmt.Fprintf(out, "Environment [%s]: ", preselected)
+		} else {
+			fmt.Fprint(out, "Environment: ")
+		}
+		line, err := in.ReadString('\n')
+		answer := strings.TrimSpace(line)
+		if answer == "" && preselected != "" {
+			return preselected, nil
+		}
+		if n, convErr := strconv.Atoi(answer); convErr == nil && n >= 1 && n <= len(proxies) {
+			return proxies[n-1].Environment, nil
+		}
+		for _, proxy := range proxies {
+			if answer != "" && proxy.Environment == answer {
+				return answer, nil
+			}
+		}
+		if err != nil {
+			return "", fmt.Errorf("no environment chosen: %w", err)
+		}
+		fmt.Fprintf(out, "Invalid choice %q, enter a number from 1 to %d or an environment name.\n", answer, len(proxies))
+	}
+}
+
+// chooseTunnels reduces the proxy configuration to the tunnels the user picks with -i
+func chooseTunnels(config ProxyConfig, opts options) (ProxyConfig, error) {
+	if !opts.interactive {
+		return config, nil
+	}
+	if !isTerminal(os.Stdin) {
+		return config, errors.New("choosing the tunnels with -i needs a terminal")
+	}
+	return pickTunnels(bufio.NewReader(os.Stdin), os.Stdout, config)
+}
+
+// tunnelChoice is a workload or connection offered by the tunnel picker
+type tunnelChoice struct {
+	label      string
+	workload   int
+	connection int
+	selected   bool
+}
+
+// fuzzyMatch reports whether the characters of the query appear in the text in order,
+// ignoring case
+func fuzzyMatch(query, text string) bool {
+	text = strings.ToLower(text)
+	for _, r := range strings.ToLower(query) {
+		i := strings.IndexRune(text, r)
+		if i < 0 {
+			return false
+		}
+		text = text[i+len(string(r)):]
+	}
+	return true
+}
+
+// parseSelection parses a list of numbers and ranges such as "1 3 5-7", returning false if
+// the answer is not one
+func parseSelection(answer string, max int) ([]int, bool) {
+	var numbers []int
+	for _, field := range strings.Fields(strings.ReplaceAll(answer, ",", " ")) {
+		from, to, isRange := strings.Cut(field, "-")
+		if !isRange {
+			to = from
+		}
+		first, err := strconv.Atoi(from)
+		if err != nil {
+			return nil, false
+		}
+		last, err := strconv.Atoi(to)
+		if err != nil || first < 1 || last > max || first > last {
+			return nil, false
+		}
+		for n := first; n <= last; n++ {
+			numbers = append(numbers, n)
+		}
+	}
+	return numbers, len(numbers) > 0
+}
+
+// pickTunnels lets the user choose the workloads and connections of the session. Typing
+// text filters the list with a fuzzy match on the tunnel's name, kind, port and tags,
+// numbers toggle the tunnels shown with them, * toggles every shown tunnel and an empty
+// line starts the selected tunnels.
+func pickTunnels(in *bufio.Reader, out io.Writer, config ProxyConfig) (ProxyConfig, error) {
+	var choices []tunnelChoice
+	for i, workload := range config.Workloads {
+		label := fmt.Sprintf("%s\tworkload\t%d\t%s", workload.Name(), workload.LocalPort, strings.Join(workload.Tags, ","))
+		choices = append(choices, tunnelChoice{label: label, workload: i, connection: -1})
+	}
+	for i, connection := range config.Bastion.Connections {
+		label := fmt.Sprintf("%s\tbastion\t%d\t%s", connection.Name(), connection.LocalPort, strings.Join(connection.Tags, ","))
+		choices = append(choices, tunnelChoice{label: label, workload: -1, connection: i})
+	}
+	if len(choices) == 0 {
+		return config, fmt.Errorf("environment %s has no workloads or connections", config.Environment)
+	}
+
+	filter := ""
+	for {
+		var shown []int
+		for i, choice := range choices {
+			if fuzzyMatch(filter, choice.label) {
+				shown = append(shown, i)
+			}
+		}
+		if filter != "" {
+			fmt.Fprintf(out, "Tunnels matching %q:\n", filter)
+		} else {
+			fmt.Fprintln(out, "Tunnels:")
+		}
+		tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		for n, i := range shown {
+			mark := " "
+			if choices[i].selected {
+				mark = "x"
+			}
+			fmt.Fprintf(tw, "  [%s] %d)\t%s\n", mark, n+1, choices[i].label)
+		}
+		tw.Flush()
+		fmt.Fprint(out, "Type to filter (/ clears it), numbers (1 3 5-7) or * to toggle, Enter to start: ")
+
+		line, err := in.ReadString('\n')
+		answer := strings.TrimSpace(line)
+		switch numbers, ok := parseSelection(answer, len(shown)); {
+		case answer == "" && err != nil:
+			return config, fmt.Errorf("no tunnels chosen: %w", err)
+		case answer == "":
+			selected := config
+			selected.Workloads = nil
+			selected.Bastion.Connections = nil
+			for _, choice := range choices {
+				if !choice.selected {
+					continue
+				}
+				if choice.workload >= 0 {
+					selected.Workloads = append(selected.Workloads, config.Workloads[choice.workload])
+				} else {
+					selected.Bastion.Connections = append(selected.Bastion.Connections, config.Bastion.Connections[choice.connection])
+				}
+			}
+			if len(selected.Workloads) == 0 && len(selected.Bastion.Connections) == 0 {
+				fmt.Fprintln(out, "No tunnel is selected yet.")
+				continue
+			}
+			return selected, nil
+		case answer == "*":
+			for _, i := range shown {
+				choices[i].selected = !choices[i].selected
+			}
+		case ok:
+			for _, n := range numbers {
+				choices[shown[n-1]].selected = !choices[shown[n-1]].selected
+			}
+		default:
+			filter = answer
+			if filter == "/" {
+				filter = ""
+			}
+		}
+	}
+}
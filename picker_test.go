@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPickEnvironment(t *testing.T) {
+	proxies := []ProxyConfig{
+		{Environment: "staging", CloudProject: "okcredit-staging-env"},
+		{Environment: "prod", CloudProject: "okcredit-42"},
+	}
+	tests := []struct {
+		input       string
+		preselected string
+		expected    string
+	}{
+		{"2\n", "", "prod"},
+		{"staging\n", "prod", "staging"},
+		{"\n", "prod", "prod"},
+		{"7\ndev\n1\n", "", "staging"},
+		{"prod", "", "prod"},
+	}
+	for _, test := range tests {
+		var out bytes.Buffer
+		environment, err := pickEnvironment(bufio.NewReader(strings.NewReader(test.input)), &out, proxies, test.preselected)
+		if err != nil || environment != test.expected {
+			t.Errorf("pickEnvironment failed for input %q: expected %s, got %q (%v)", test.input, test.expected, environment, err)
+		}
+	}
+
+	var out bytes.Buffer
+	pickEnvironment(bufio.NewReader(strings.NewReader("1\n")), &out, proxies, "prod")
+	if !strings.Contains(out.String(), "* 2) prod (okcredit-42)") || !strings.Contains(out.String(), "Environment [prod]: ") {
+		t.Errorf("pickEnvironment failed: unexpected prompt\n%s", out.String())
+	}
+	if _, err := pickEnvironment(bufio.NewReader(strings.NewReader("")), &out, proxies, ""); err == nil {
+		t.Error("pickEnvironment failed: expected an error without input")
+	}
+}
+
+func TestLastEnvironment(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	if environment := readLastEnvironment(); environment != "" {
+		t.Errorf("readLastEnvironment failed: expected no environment, got %q", environment)
+	}
+	if err := saveLastEnvironment("staging"); err != nil {
+		t.Fatalf("saveLastEnvironment failed: %v", err)
+	}
+	if environment := readLastEnvironment(); environment != "staging" {
+		t.Errorf("readLastEnvironment failed: expected staging, got %q", environment)
+	}
+}
+
+func TestFuzzyMatch(t *testing.T) {
+	tests := []struct {
+		query, text string
+		expected    bool
+	}{
+		{"", "cashfree", true},
+		{"csf", "cashfree\tworkload\t8080", true},
+		{"CASH", "cashfree", true},
+		{"pg5435", "10.120.52.48:5432\tbastion\t5435\tpostgres", false},
+		{"5435", "10.120.52.48:5432\tbastion\t5435", true},
+		{"fc", "cashfree", false},
+	}
+	for _, test := range tests {
+		if matched := fuzzyMatch(test.query, test.text); matched != test.expected {
+			t.Errorf("fuzzyMatch(%q, %q) failed: expected %v", test.query, test.text, test.expected)
+		}
+	}
+}
+
+func TestParseSelection(t *testing.T) {
+	if numbers, ok := parseSelection("1 3-4,6", 6); !ok || len(numbers) != 4 || numbers[2] != 4 {
+		t.Errorf("parseSelection failed: unexpected numbers %v", numbers)
+	}
+	for _, answer := range []string{"", "7", "0", "2-1", "cash"} {
+		if _, ok := parseSelection(answer, 6); ok {
+			t.Errorf("parseSelection failed: expected %q to not be a selection", answer)
+		}
+	}
+}
+
+func TestPickTunnels(t *testing.T) {
+	config := ProxyConfig{
+		Environment: "staging",
+		Workloads: []Workload{
+			{App: "cashfree", LocalPort: 8080, Tags: []string{"payments"}},
+			{App: "ledger", LocalPort: 8081},
+		},
+		Bastion: Bastion{Connections: []Connection{{LocalPort: 5435, RemoteHost: "10.120.52.48", RemotePort: 5432}}},
+	}
+	// an empty selection is refused, then the filter narrows the list to the connection,
+	// which is selected from it, and cashfree is selected from the full list
+	input := "\n5432\n1\n/\n1\n\n"
+	var out bytes.Buffer
+	selected, err := pickTunnels(bufio.NewReader(strings.NewReader(input)), &out, config)
+	if err != nil {
+		t.Fatalf("pickTunnels failed: %v", err)
+	}
+	if len(selected.Workloads) != 1 || selected.Workloads[0].App != "cashfree" || len(selected.Bastion.Connections) != 1 {
+		t.Errorf("pickTunnels failed: unexpected selection %+v\n%s", selected, out.String())
+	}
+	if !strings.Contains(out.String(), "No tunnel is selected yet.") || !strings.Contains(out.String(), `Tunnels matching "5432":`) {
+		t.Errorf("pickTunnels failed: unexpected output\n%s", out.String())
+	}
+	if len(config.Workloads) != 2 {
+		t.Error("pickTunnels failed: the original configuration was modified")
+	}
+	if _, err := pickTunnels(bufio.NewReader(strings.NewReader("1\n")), &out, config); err == nil {
+		t.Error("pickTunnels failed: expected an error when the input ends")
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// pluginPrefix is the prefix of the executables that extend devcli, devcli foo runs devcli-foo
+const pluginPrefix = "devcli-"
+
+// findPlugin returns the path of the devcli-<name> executable on PATH, if there is one
+func findPlugin(name string) (string, bool) {
+	path, err := exec.LookPath(pluginPrefix + name)
+	return path, err == nil
+}
+
+// runPlugin runs a plugin with the session context in its environment, and exits with its
+// exit code
+func runPlugin(path string, args []string) {
+	env, err := pluginEnv()
+	if err != nil {
+		fmt.Println("Warning: the session context is not available to the plugin:", err)
+	}
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), env...)
+	if err := cmd.Start(); err != nil {
+		fmt.Printf("Error running plugin %s: %v\n", path, err)
+		os.Exit(1)
+	}
+	// the plugin gets Ctrl-C from the terminal itself, devcli waits for it to exit
+	ch := make(chan os.Signal, 2)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		for sig := range ch {
+			if sig == syscall.SIGTERM {
+				cmd.Process.Signal(sig)
+			}
+		}
+	}()
+	if err := cmd.Wait(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.ExitCode())
+		}
+		fmt.Printf("Error running plugin %s: %v\n", path, err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// pluginEnv returns the environment variables describing the session to plugins
+func pluginEnv() ([]string, error) {
+	env, _, _, err := sessionEnv(os.Getenv("DEVCLI_CONFIG"), os.Getenv("DEVCLI_ENV"))
+	return env, err
+}
+
+// sessionEnv returns the environment variables describing the session of the environment,
+// the running one or else the configuration's default when empty: the configuration, the
+// environment and its project, the kubeconfig, the control socket of the running session
+// and the local port of every tunnel. It also returns the configuration and the
+// environment's proxy configuration.
+func sessionEnv(confFile, environment string) ([]string, Config, ProxyConfig, error) {
+	confFile, err := configPath(confFile)
+	if err != nil {
+		return nil, Config{}, ProxyConfig{}, err
+	}
+	config, err := readConfig(confFile)
+	if err != nil {
+		return nil, Config{}, ProxyConfig{}, err
+	}
+	// the environment of the running session wins over the default of the configuration
+	if environments, err := runningSessions(); err == nil && len(environments) == 1 {
+		config.Environment = environments[0]
+	}
+	if environment != "" {
+		config.Environment = environment
+	}
+	proxyConfig, err := findProxyConfig(config)
+	if err != nil {
+		return nil, config, ProxyConfig{}, err
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, config, proxyConfig, err
+	}
+	kubeconfig := kubeconfigEnv(kubeconfigPaths(config.Cloud, proxyConfig, homeDir))
+	env := []string{
+		"DEVCLI_CONFIG=" + confFile,
+		"DEVCLI_ENV=" + config.Environment,
+		"DEVCLI_PROJECT=" + proxyConfig.CloudProject,
+		"DEVCLI_KUBECONFIG=" + kubeconfig,
+	}
+	if socket, err := sessionSocket(config.Environment); err == nil {
+		if _, err := os.Stat(socket); err == nil {
+			env = append(env, "DEVCLI_SOCKET="+socket)
+		}
+	}
+	return append(env, tunnelEnv(proxyConfig)...), config, proxyConfig, nil
+}
+
+// tunnelEnv returns DEVCLI_PORTS, the name=port list of every tunnel, and the
+// DEVCLI_<TUNNEL>_PORT variable of each one
+func tunnelEnv(proxyConfig ProxyConfig) []string {
+	var ports, env []string
+	add := func(name string, localPort int) {
+		ports = append(ports, fmt.Sprintf("%s=%d", name, localPort))
+		env = append(env, composeVariable(name)+"_PORT="+strconv.Itoa(localPort))
+	}
+	for _, workload := range proxyConfig.Workloads {
+		add(workload.Name(), workload.LocalPort)
+	}
+	for _, connection := range proxyConfig.Bastion.Connections {
+		add(connection.Name(), connection.LocalPort)
+	}
+	return append([]string{"DEVCLI_PORTS=" + strings.Join(ports, ",")}, env...)
+}
+
+// pluginOutput is the schema of a plugin in devcli plugins output
+type pluginOutput struct {
+	Name string `json:"name" yaml:"name"`
+	Path string `json:"path" yaml:"path"`
+}
+
+// findPlugins returns the plugins found on PATH, sorted by name. A plugin earlier on the
+// PATH hides the ones with the same name after it.
+func findPlugins() []pluginOutput {
+	seen := make(map[string]string)
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		matches, _ := filepath.Glob(filepath.Join(dir, pluginPrefix+"*"))
+		for _, path := range matches {
+			name := strings.TrimPrefix(filepath.Base(path), pluginPrefix)
+			if _, ok := seen[name]; ok {
+				continue
+			}
+			if info, err := os.Stat(path); err != nil || info.IsDir() {
+				continue
+			}
+			if _, err := exec.LookPath(path); err != nil {
+				continue
+			}
+			seen[name] = path
+		}
+	}
+	plugins := []pluginOutput{}
+	for name, path := range seen {
+		plugins = append(plugins, pluginOutput{Name: name, Path: path})
+	}
+	sort.Slice(plugins, func(i, j int) bool { return plugins[i].Name < plugins[j].Name })
+	return plugins
+}
+
+// listPlugins implements devcli plugins, which prints the plugins found on PATH
+func listPlugins(args []string) {
+	fs := flag.NewFlagSet("devcli plugins", flag.ExitOnError)
+	var format string
+	outputFlag(fs, &format)
+	fs.Parse(args)
+
+	plugins := findPlugins()
+	err := writeOutput(os.Stdout, format, plugins, func(w io.Writer) {
+		if len(plugins) == 0 {
+			fmt.Fprintln(w, "No plugins found, add devcli-<name> executables to the PATH to extend devcli.")
+			return
+		}
+		fmt.Fprintln(w, "Plugins found on the PATH:")
+		for _, plugin := range plugins {
+			fmt.Fprintf(w, "devcli %s\n", plugin.Name)
+		}
+	})
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(2)
+	}
+}
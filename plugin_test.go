@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTunnelEnv(t *testing.T) {
+	env := tunnelEnv(composeConfig.Proxies[0])
+	expected := []string{
+		"DEVCLI_PORTS=cashfree=8080,10.120.52.48:5432=5435",
+		"DEVCLI_CASHFREE_PORT=8080",
+		"DEVCLI_10_120_52_48_5432_PORT=5435",
+	}
+	if !reflect.DeepEqual(env, expected) {
+		t.Errorf("tunnelEnv failed: expected %v, got %v", expected, env)
+	}
+}
+
+func TestFindPlugin(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "devcli-seed"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatalf("Error writing the plugin: %v", err)
+	}
+	t.Setenv("PATH", dir)
+	if path, ok := findPlugin("seed"); !ok || path != filepath.Join(dir, "devcli-seed") {
+		t.Errorf("findPlugin failed: expected %s, got %q", filepath.Join(dir, "devcli-seed"), path)
+	}
+	if _, ok := findPlugin("missing"); ok {
+		t.Error("findPlugin failed: found a plugin that does not exist")
+	}
+}
+
+func TestFindPlugins(t *testing.T) {
+	first, second := t.TempDir(), t.TempDir()
+	for _, path := range []string{filepath.Join(first, "devcli-seed"), filepath.Join(second, "devcli-seed"), filepath.Join(second, "devcli-db")} {
+		if err := os.WriteFile(path, []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatalf("Error writing the plugin: %v", err)
+		}
+	}
+	t.Setenv("PATH", first+string(filepath.ListSeparator)+second)
+	expected := []pluginOutput{{Name: "db", Path: filepath.Join(second, "devcli-db")}, {Name: "seed", Path: filepath.Join(first, "devcli-seed")}}
+	if plugins := findPlugins(); !reflect.DeepEqual(plugins, expected) {
+		t.Errorf("findPlugins failed: expected %v, got %v", expected, plugins)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// podKey identifies the pods of an app in a namespace of a cluster
+type podKey struct {
+	kubeContext string
+	namespace   string
+	app         string
+}
+
+// podDirectory holds the pod selected for the workloads looked up together at startup,
+// with one request per cluster and namespace instead of one per workload. A pod is
+// only handed out once: a restarted tunnel looks its pod up again, as it may be gone.
+type podDirectory struct {
+	mu   sync.Mutex
+	pods map[podKey]string
+}
+
+// take returns the pod looked up for the workload, if any, and forgets it
+func (d *podDirectory) take(workload Workload) (string, bool) {
+	if d == nil || workload.pinnedPod() != "" {
+		return "", false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	key := podKey{workload.kubeContext, workload.Namespace, workload.App}
+	pod, ok := d.pods[key]
+	delete(d.pods, key)
+	return pod, ok
+}
+
+// batchSelector selects the pods of the apps in the request listing them together
+func batchSelector(apps []string) metav1.ListOptions {
+	return metav1.ListOptions{LabelSelector: "app in (" + strings.Join(apps, ",") + ")"}
+}
+
+// batchPods returns the pod selected for every app of the pods listed with batchSelector,
+// the apps without a pod to forward to left out
+func batchPods(pods []corev1.Pod) map[string]string {
+	candidates := make(map[string][]podCandidate)
+	for _, pod := range pods {
+		if app := pod.Labels["app"]; app != "" && pod.Status.Phase == corev1.PodRunning {
+			candidates[app] = append(candidates[app], newPodCandidate(pod))
+		}
+	}
+	selected := make(map[string]string)
+	for app := range candidates {
+		if pod, ok := selectPod(candidates[app]); ok {
+			selected[app] = pod
+		}
+	}
+	return selected
+}
+
+// podGroups returns the apps of the workloads looked up together by cluster and namespace,
+// the namespaces with a single app left out as batching them gains nothing
+func podGroups(workloads []Workload) map[podKey][]string {
+	groups := make(map[podKey][]string)
+	for _, workload := range workloads {
+		if workload.pinnedPod() != "" || workload.wildcard() {
+			continue
+		}
+		group := podKey{kubeContext: workload.kubeContext, namespace: workload.Namespace}
+		if !slices.Contains(groups[group], workload.App) {
+			groups[group] = append(groups[group], workload.App)
+		}
+	}
+	maps.DeleteFunc(groups, func(_ podKey, apps []string) bool { return len(apps) < 2 })
+	return groups
+}
+
+// prefetchPods looks up the pods of the workloads sharing a cluster and a namespace
+// together. Workloads whose lookup failed, or whose app has no running pod, are left to
+// look their pod up themselves.
+func prefetchPods(ctx context.Context, runner *commandRunner, workloads []Workload) *podDirectory {
+	directory := &podDirectory{pods: make(map[podKey]string)}
+	var lookups []func() error
+	for group, apps := range podGroups(workloads) {
+		lookups = append(lookups, func() error {
+			client, err := kubeAPI.client(group.kubeContext)
+			if err != nil {
+				narratef("Looking up the pods of namespace %s together failed, each workload looks its pod up: %v\n", group.namespace, err)
+				return nil
+			}
+			pods, err := client.listPods(ctx, runner, group.namespace, batchSelector(apps))
+			if err != nil {
+				narratef("Looking up the pods of namespace %s together failed, each workload looks its pod up: %v\n", group.namespace, err)
+				return nil
+			}
+			directory.mu.Lock()
+			defer directory.mu.Unlock()
+			for app, pod := range batchPods(pods) {
+				directory.pods[podKey{group.kubeContext, group.namespace, app}] = pod
+			}
+			return nil
+		})
+	}
+	runParallel(lookups...)
+	return directory
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestPodGroups(t *testing.T) {
+	workloads := []Workload{
+		{Namespace: "enr", App: "cashfree", kubeContext: "staging"},
+		{Namespace: "enr", App: "cashfree-admin", kubeContext: "staging"},
+		{Namespace: "enr", App: "cashfree", LocalPort: 8090, kubeContext: "staging"},
+		{Namespace: "enr", StatefulSet: "kafka", kubeContext: "staging"},
+		{Namespace: "analytics", App: "airflow", kubeContext: "staging"},
+		{Namespace: "enr", App: "ledger", kubeContext: "data"},
+	}
+	groups := podGroups(workloads)
+	if len(groups) != 1 || !slices.Equal(groups[podKey{kubeContext: "staging", namespace: "enr"}], []string{"cashfree", "cashfree-admin"}) {
+		t.Errorf("podGroups failed: unexpected groups %v", groups)
+	}
+	if selector := batchSelector([]string{"cashfree", "cashfree-admin"}).LabelSelector; selector != "app in (cashfree,cashfree-admin)" {
+		t.Errorf("batchSelector failed: unexpected selector %s", selector)
+	}
+}
+
+func TestPodDirectory(t *testing.T) {
+	pods := batchPods([]corev1.Pod{
+		testPod("cashfree-7d9f-abcde", "cashfree", 0, corev1.PodRunning, true),
+		testPod("cashfree-7d9f-fghij", "cashfree", 1, corev1.PodRunning, true),
+		testPod("cashfree-admin-5c4b-klmno", "cashfree-admin", 0, corev1.PodRunning, true),
+		testPod("ledger-8e1a-pqrst", "ledger", 0, corev1.PodRunning, false),
+		testPod("refunds-3f2c-uvwxy", "refunds", 0, corev1.PodPending, true),
+	})
+	if len(pods) != 2 || pods["cashfree"] != "cashfree-7d9f-abcde" || pods["cashfree-admin"] != "cashfree-admin-5c4b-klmno" {
+		t.Errorf("batchPods failed: unexpected pods %v", pods)
+	}
+
+	directory := &podDirectory{pods: map[podKey]string{{"staging", "enr", "cashfree"}: "cashfree-7d9f-abcde"}}
+	workload := Workload{Namespace: "enr", App: "cashfree", kubeContext: "staging"}
+	if pod, ok := directory.take(workload); !ok || pod != "cashfree-7d9f-abcde" {
+		t.Errorf("take failed: expected the looked up pod, got %q", pod)
+	}
+	// a restarted tunnel looks its pod up again
+	if _, ok := directory.take(workload); ok {
+		t.Errorf("take failed: expected the pod to be handed out once")
+	}
+	if _, ok := (*podDirectory)(nil).take(workload); ok {
+		t.Errorf("take failed: expected no pod without a directory")
+	}
+}
+
+func TestPrefetchPods(t *testing.T) {
+	cluster := &fakeCluster{pods: []corev1.Pod{
+		testPod("cashfree-7d9f-abcde", "cashfree", 0, corev1.PodRunning, true),
+		testPod("cashfree-admin-5c4b-klmno", "cashfree-admin", 0, corev1.PodRunning, true),
+	}}
+	startFakeCluster(t, cluster)
+	workloads := []Workload{{Namespace: "enr", App: "cashfree"}, {Namespace: "enr", App: "cashfree-admin"}, {Namespace: "enr", App: "ledger"}}
+	directory := prefetchPods(context.Background(), newCommandRunner(2, 0), workloads)
+	if pod, ok := directory.take(workloads[1]); !ok || pod != "cashfree-admin-5c4b-klmno" {
+		t.Errorf("prefetchPods failed: expected the pod of the app, got %q", pod)
+	}
+	if _, ok := directory.take(workloads[2]); ok {
+		t.Errorf("prefetchPods failed: expected no pod for an app without one")
+	}
+	if requests := cluster.requested(); len(requests) != 1 || !strings.Contains(requests[0], "labelSelector=app+in+%28cashfree%2Ccashfree-admin%2Cledger%29") {
+		t.Errorf("prefetchPods failed: expected a single request for the namespace, got %v", requests)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// podCandidate is a running pod a workload may forward to
+type podCandidate struct {
+	name    string
+	created time.Time
+	// owner is the ReplicaSet or StatefulSet of the pod
+	owner string
+	ready bool
+	// terminating pods are deleted and about to stop, e.g. during a deploy
+	terminating bool
+}
+
+// newPodCandidate returns the candidate of the pod
+func newPodCandidate(pod corev1.Pod) podCandidate {
+	owner := ""
+	if len(pod.OwnerReferences) > 0 {
+		owner = pod.OwnerReferences[0].Name
+	}
+	return podCandidate{name: pod.Name, created: pod.CreationTimestamp.Time, owner: owner, ready: podReady(pod), terminating: pod.DeletionTimestamp != nil}
+}
+
+// podCandidates returns the candidates of the pods in the Running phase
+func podCandidates(pods []corev1.Pod) []podCandidate {
+	var candidates []podCandidate
+	for _, pod := range pods {
+		if pod.Status.Phase == corev1.PodRunning {
+			candidates = append(candidates, newPodCandidate(pod))
+		}
+	}
+	return candidates
+}
+
+// podReady reports whether the pod's Ready condition is true
+func podReady(pod corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// selectPod returns the pod to forward to: a ready pod that is not terminating, of the
+// newest ReplicaSet during a rolling deploy, as the pods of the older ones are about to be
+// deleted. The newest ReplicaSet is the one whose first pod was created last.
+func selectPod(candidates []podCandidate) (string, bool) {
+	eligible := slices.DeleteFunc(slices.Clone(candidates), func(c podCandidate) bool { return c.terminating || !c.ready })
+	if len(eligible) == 0 {
+		return "", false
+	}
+	firstCreated := make(map[string]time.Time)
+	for _, c := range eligible {
+		if first, ok := firstCreated[c.owner]; !ok || c.created.Before(first) {
+			firstCreated[c.owner] = c.created
+		}
+	}
+	newest := eligible[0]
+	for _, c := range eligible[1:] {
+		if firstCreated[c.owner].After(firstCreated[newest.owner]) {
+			newest = c
+		}
+	}
+	return newest.name, true
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestSelectPod(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		pods     []corev1.Pod
+		expected string
+	}{
+		{"first ready pod", []corev1.Pod{testPod("cashfree-7d9f-abcde", "cashfree", 0, corev1.PodRunning, true), testPod("cashfree-7d9f-fghij", "cashfree", 1, corev1.PodRunning, true)}, "cashfree-7d9f-abcde"},
+		{"terminating pod", []corev1.Pod{terminating(testPod("cashfree-7d9f-abcde", "cashfree", 0, corev1.PodRunning, true)), testPod("cashfree-7d9f-fghij", "cashfree", 1, corev1.PodRunning, true)}, "cashfree-7d9f-fghij"},
+		{"unready pod", []corev1.Pod{testPod("cashfree-7d9f-abcde", "cashfree", 0, corev1.PodRunning, false), testPod("cashfree-7d9f-fghij", "cashfree", 1, corev1.PodRunning, true)}, "cashfree-7d9f-fghij"},
+		{"pending pod", []corev1.Pod{testPod("cashfree-7d9f-abcde", "cashfree", 0, corev1.PodPending, true), testPod("cashfree-7d9f-fghij", "cashfree", 1, corev1.PodRunning, true)}, "cashfree-7d9f-fghij"},
+		// during a deploy, an old pod recreated after the new ReplicaSet started is still old
+		{"newest replicaset", []corev1.Pod{testPod("cashfree-5b21-vwxyz", "cashfree", 30, corev1.PodRunning, true),
+			testPod("cashfree-7d9f-abcde", "cashfree", 0, corev1.PodRunning, true), testPod("cashfree-7d9f-klmno", "cashfree", 59, corev1.PodRunning, true)}, "cashfree-5b21-vwxyz"},
+		{"no ready pod", []corev1.Pod{testPod("cashfree-7d9f-abcde", "cashfree", 0, corev1.PodRunning, false)}, ""},
+	} {
+		pod, ok := selectPod(podCandidates(tc.pods))
+		if pod != tc.expected || ok != (tc.expected != "") {
+			t.Errorf("selectPod failed for the %s: expected %q, got %q", tc.name, tc.expected, pod)
+		}
+	}
+	if candidates := podCandidates([]corev1.Pod{testPod("cashfree-7d9f-abcde", "cashfree", 0, corev1.PodSucceeded, false)}); len(candidates) != 0 {
+		t.Errorf("podCandidates failed: expected no candidate, got %v", candidates)
+	}
+}
+
+func TestFindPodRequest(t *testing.T) {
+	request := findPodRequest(Workload{Namespace: "enr", App: "cashfree", kubeContext: "staging"})
+	if request != "kube-api --context staging GET /api/v1/namespaces/enr/pods?labelSelector=app%3Dcashfree" {
+		t.Errorf("findPodRequest failed: unexpected request %s", request)
+	}
+	request = findPodRequest(Workload{Namespace: "enr", Pod: "cashfree-debug"})
+	if request != "kube-api GET /api/v1/namespaces/enr/pods/cashfree-debug" {
+		t.Errorf("findPodRequest failed: unexpected request %s", request)
+	}
+}
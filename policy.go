@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// Policy restricts the tunnels the sessions of some environments may start, e.g. no direct
+// database connections or only observability tools in prod. devcli refuses to start a
+// session that breaks a policy of the shared configuration.
+type Policy struct {
+	Name string `yaml:"name"`
+	// Environments are the environments the policy applies to, every one when empty
+	Environments []string `yaml:"environments"`
+	// DenyBastion forbids the connections through the bastion
+	DenyBastion bool `yaml:"deny_bastion"`
+	// DenyProtocols forbids the tunnels with one of these protocols, e.g. postgres
+	DenyProtocols []string `yaml:"deny_protocols"`
+	// AllowTags only allows the tunnels with one of these tags
+	AllowTags []string `yaml:"allow_tags"`
+	// DenyTags forbids the tunnels with one of these tags
+	DenyTags []string `yaml:"deny_tags"`
+	// Message tells why the policy exists, printed with its violations
+	Message string `yaml:"message"`
+}
+
+// appliesTo reports whether the policy restricts the sessions of the environment
+func (p Policy) appliesTo(environment string) bool {
+	return len(p.Environments) == 0 || slices.Contains(p.Environments, environment)
+}
+
+// violation returns why the tunnel breaks the policy, empty when it does not
+func (p Policy) violation(bastion bool, protocol string, tags []string) string {
+	switch {
+	case p.DenyBastion && bastion:
+		return "bastion connections are not allowed"
+	case protocol != "" && slices.Contains(p.DenyProtocols, protocol):
+		return fmt.Sprintf("protocol %s is not allowed", protocol)
+	case len(p.AllowTags) > 0 && !slices.ContainsFunc(tags, func(tag string) bool { return slices.Contains(p.AllowTags, tag) }):
+		return fmt.Sprintf("only tunnels tagged %s are allowed", strings.Join(p.AllowTags, ", "))
+	}
+	for _, tag := range tags {
+		if slices.Contains(p.DenyTags, tag) {
+			return fmt.Sprintf("tag %s is not allowed", tag)
+		}
+	}
+	return ""
+}
+
+// validate checks that the policy is named and restricts something
+func (p Policy) validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("a policy has no name")
+	}
+	if !p.DenyBastion && len(p.DenyProtocols) == 0 && len(p.AllowTags) == 0 && len(p.DenyTags) == 0 {
+		return fmt.Errorf("policy %s restricts nothing", p.Name)
+	}
+	return nil
+}
+
+// policyViolation is a tunnel of the session that breaks a policy
+type policyViolation struct {
+	Tunnel string
+	Policy Policy
+	Reason string
+}
+
+// PolicyError is returned when the tunnels of a session break the policies of its environment
+type PolicyError struct {
+	Environment string
+	Violations  []policyViolation
+}
+
+func (e *PolicyError) Error() string {
+	var violations []string
+	for _, violation := range e.Violations {
+		violations = append(violations, fmt.Sprintf("%s (policy %s)", violation.Tunnel, violation.Policy.Name))
+	}
+	return "tunnels break the policies of environment " + e.Environment + ": " + strings.Join(violations, "; ")
+}
+
+// report prints one line per tunnel breaking a policy, followed by the messages of the
+// policies
+func (e *PolicyError) report(w io.Writer) {
+	fmt.Fprintf(w, "Error: %d tunnels break the policies of environment %s:\n", len(e.Violations), e.Environment)
+	var messages []string
+	for _, violation := range e.Violations {
+		fmt.Fprintf(w, "  %s: %s (policy %s)\n", violation.Tunnel, violation.Reason, violation.Policy.Name)
+		if message := violation.Policy.Message; message != "" && !slices.Contains(messages, message) {
+			messages = append(messages, message)
+		}
+	}
+	for _, message := range messages {
+		fmt.Fprintln(w, "Policy:", message)
+	}
+	fmt.Fprintln(w, "Hint: start only the allowed tunnels with -tags, -i or a profile.")
+}
+
+// checkPolicies returns a *PolicyError with every tunnel of the session breaking a policy of
+// its environment
+func checkPolicies(policies []Policy, config ProxyConfig) error {
+	err := &PolicyError{Environment: config.Environment}
+	for _, policy := range policies {
+		if !policy.appliesTo(config.Environment) {
+			continue
+		}
+		for _, workload := range config.Workloads {
+			if reason := policy.violation(false, workload.Protocol, workload.Tags); reason != "" {
+				err.Violations = append(err.Violations, policyViolation{"workload " + workload.Name(), policy, reason})
+			}
+		}
+		for _, connection := range config.Bastion.Connections {
+			if reason := policy.violation(true, connection.Protocol, connection.Tags); reason != "" {
+				err.Violations = append(err.Violations, policyViolation{"connection " + connection.Name(), policy, reason})
+			}
+		}
+	}
+	if len(err.Violations) == 0 {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCheckPolicies(t *testing.T) {
+	policies := []Policy{
+		{Name: "no-direct-db", Environments: []string{"prod"}, DenyBastion: true, Message: "Use the read replicas dashboard."},
+		{Name: "observability-only", Environments: []string{"prod"}, AllowTags: []string{"observability"}},
+		{Name: "no-redis", DenyProtocols: []string{"redis"}},
+	}
+	config := ProxyConfig{
+		Environment: "prod",
+		Workloads:   []Workload{{App: "grafana", Tags: []string{"observability"}}, {App: "cashfree", Tags: []string{"payments"}}},
+		Bastion:     Bastion{Connections: []Connection{{RemoteHost: "10.120.52.48", RemotePort: 5432, Tags: []string{"observability"}}}},
+	}
+	err := checkPolicies(policies, config)
+	var violations *PolicyError
+	if !errors.As(err, &violations) || len(violations.Violations) != 2 {
+		t.Fatalf("checkPolicies failed: expected the connection and cashfree to break the policies, got %v", err)
+	}
+	var b bytes.Buffer
+	violations.report(&b)
+	for _, expected := range []string{
+		"connection 10.120.52.48:5432: bastion connections are not allowed (policy no-direct-db)",
+		"workload cashfree: only tunnels tagged observability are allowed (policy observability-only)",
+		"Policy: Use the read replicas dashboard.",
+	} {
+		if !strings.Contains(b.String(), expected) {
+			t.Errorf("report failed: expected %q in %q", expected, b.String())
+		}
+	}
+
+	config.Environment = "staging"
+	if err := checkPolicies(policies, config); err != nil {
+		t.Errorf("checkPolicies failed: expected the prod policies not to apply to staging, got %v", err)
+	}
+	config.Workloads = append(config.Workloads, Workload{App: "cache", Protocol: "redis"})
+	if err := checkPolicies(policies, config); err == nil {
+		t.Error("checkPolicies failed: expected a policy without environments to apply to staging")
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	for _, tc := range []struct {
+		policy Policy
+		valid  bool
+	}{
+		{Policy{Name: "no-db", DenyBastion: true}, true},
+		{Policy{Name: "observability-only", AllowTags: []string{"observability"}}, true},
+		{Policy{DenyBastion: true}, false},
+		{Policy{Name: "empty", Environments: []string{"prod"}}, false},
+	} {
+		if err := tc.policy.validate(); (err == nil) != tc.valid {
+			t.Errorf("validate(%+v) failed: expected valid %v, got %v", tc.policy, tc.valid, err)
+		}
+	}
+}
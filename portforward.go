@@ -0,0 +1,28 @@
+package main
+
+import "fmt"
+
+const (
+	// portForwardWebSocket forwards over WebSockets, faster and passing through HTTP proxies.
+	// The port-forward falls back to SPDY when the API server does not support them.
+	portForwardWebSocket = "websocket"
+	// portForwardSPDY forwards over SPDY, as kubectl did before 1.30
+	portForwardSPDY = "spdy"
+)
+
+// checkPortForwardProtocol checks the protocol of -port-forward-protocol
+func checkPortForwardProtocol(protocol string) error {
+	switch protocol {
+	case portForwardWebSocket, portForwardSPDY:
+		return nil
+	}
+	return fmt.Errorf("unknown port-forward protocol %s, expected %s or %s", protocol, portForwardWebSocket, portForwardSPDY)
+}
+
+// describePortForwardProtocol explains the protocol the port-forwards use, for -debug
+func describePortForwardProtocol(protocol string) string {
+	if protocol == portForwardSPDY {
+		return "the port-forwards use SPDY"
+	}
+	return "the port-forwards use WebSockets, or SPDY on API servers without WebSocket port-forwarding"
+}
@@ -0,0 +1,14 @@
+package main
+
+import "testing"
+
+func TestCheckPortForwardProtocol(t *testing.T) {
+	for _, protocol := range []string{portForwardWebSocket, portForwardSPDY} {
+		if err := checkPortForwardProtocol(protocol); err != nil {
+			t.Errorf("checkPortForwardProtocol(%s) failed: %v", protocol, err)
+		}
+	}
+	if err := checkPortForwardProtocol("http2"); err == nil {
+		t.Errorf("checkPortForwardProtocol failed: expected an error for an unknown protocol")
+	}
+}
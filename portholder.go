@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// criticalProcesses are the processes devcli refuses to kill to free a port, even with
+// -force: system services, and the ones macOS and Docker listen on common ports with
+var criticalProcesses = []string{
+	"launchd", "systemd", "init", "kernel_task", "sshd", "WindowServer", "loginwindow", "Finder",
+	"ControlCenter", "rapportd", "mDNSResponder", "dockerd", "containerd", "com.docker.backend",
+	"com.docker.vpnkit", "vpnkit", "docker-proxy",
+}
+
+// portHolder is a process listening on a local port
+type portHolder struct {
+	PID int
+	// Group is the process group of the process, 0 when it is not known
+	Group   int
+	Name    string
+	Command string
+}
+
+func (h portHolder) String() string {
+	return fmt.Sprintf("%s (pid %d): %s", h.Name, h.PID, h.Command)
+}
+
+// critical reports whether the process must never be killed to free a port: pid 1,
+// devcli itself and its parent, and the criticalProcesses
+func (h portHolder) critical() bool {
+	return h.PID <= 1 || h.PID == os.Getpid() || h.PID == os.Getppid() || slices.Contains(criticalProcesses, h.Name)
+}
+
+// leftOver reports whether the process belongs to one of the process groups a session that
+// did not exit cleanly left over, as listed in its state file. A forward that only looks
+// like devcli's, e.g. a kubectl port-forward started by hand, is not.
+func (h portHolder) leftOver(stale []childProcess) bool {
+	return slices.ContainsFunc(stale, func(child childProcess) bool {
+		return h.PID == child.PID || (h.Group > 0 && h.Group == child.PID)
+	})
+}
+
+// portHolders returns the processes listening on the local port
+func portHolders(port int) ([]portHolder, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), localCommandTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "lsof", "-n", "-P", "-t", fmt.Sprintf("-iTCP:%d", port), "-sTCP:LISTEN").Output()
+	if err != nil {
+		// lsof exits with 1 when no process matches, e.g. for a port only connected from
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 && len(out) == 0 {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("listing the processes listening on port %d: %w", port, err)
+	}
+	var holders []portHolder
+	for _, field := range strings.Fields(string(out)) {
+		pid, err := strconv.Atoi(field)
+		if err != nil || slices.ContainsFunc(holders, func(h portHolder) bool { return h.PID == pid }) {
+			continue
+		}
+		holders = append(holders, describeProcess(ctx, pid))
+	}
+	return holders, nil
+}
+
+// describeProcess returns the name, process group and command line of the process, as far
+// as ps knows them
+func describeProcess(ctx context.Context, pid int) portHolder {
+	holder := portHolder{PID: pid, Name: "unknown", Command: "unknown"}
+	if out, err := exec.CommandContext(ctx, "ps", "-o", "pgid=", "-p", strconv.Itoa(pid)).Output(); err == nil {
+		holder.Group, _ = strconv.Atoi(strings.TrimSpace(string(out)))
+	}
+	if out, err := exec.CommandContext(ctx, "ps", "-o", "comm=", "-p", strconv.Itoa(pid)).Output(); err == nil {
+		if name := strings.TrimSpace(string(out)); name != "" {
+			holder.Name = filepath.Base(name)
+		}
+	}
+	if out, err := exec.CommandContext(ctx, "ps", "-ww", "-o", "command=", "-p", strconv.Itoa(pid)).Output(); err == nil {
+		if command := strings.TrimSpace(string(out)); command != "" {
+			holder.Command = command
+		}
+	}
+	return holder
+}
+
+// killPortHolders kills the processes listening on the port, refusing the critical ones
+func killPortHolders(port int, holders []portHolder) error {
+	for _, holder := range holders {
+		if holder.critical() {
+			return fmt.Errorf("port %d is used by %s, which devcli never kills", port, holder)
+		}
+	}
+	for _, holder := range holders {
+		process, err := os.FindProcess(holder.PID)
+		if err == nil {
+			err = process.Kill()
+		}
+		if err != nil {
+			return fmt.Errorf("killing %s (pid %d): %w", holder.Name, holder.PID, err)
+		}
+		fmt.Printf("Killed %s (pid %d), which was using port %d.\n", holder.Name, holder.PID, port)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func TestPortHolderCritical(t *testing.T) {
+	for _, holder := range []portHolder{{PID: 1, Name: "systemd"}, {PID: 4242, Name: "ControlCenter"}, {PID: os.Getpid(), Name: "devcli"}} {
+		if !holder.critical() {
+			t.Errorf("critical failed: expected %s to be critical", holder)
+		}
+	}
+	if (portHolder{PID: 4242, Name: "node", Command: "node server.js"}).critical() {
+		t.Error("critical failed: expected node not to be critical")
+	}
+}
+
+func TestPortHolderLeftOver(t *testing.T) {
+	stale := []childProcess{{PID: 4242, Command: "gcloud compute ssh bastion"}}
+	tests := []struct {
+		holder   portHolder
+		expected bool
+	}{
+		{portHolder{PID: 4242, Name: "python3", Command: "python3 /usr/lib/google-cloud-sdk/lib/gcloud.py compute ssh bastion -- -L 5432:10.120.52.48:5432 -N"}, true},
+		{portHolder{PID: 4250, Group: 4242, Name: "ssh", Command: "/usr/bin/ssh -L 5432:10.120.52.48:5432 -N dev@34.93.1.2"}, true},
+		{portHolder{PID: 5151, Group: 5151, Name: "kubectl", Command: "kubectl --context gke_okcredit port-forward pod/cashfree-7d9f 8080:8080 -n default"}, false},
+		{portHolder{PID: 5252, Name: "ssh", Command: "ssh -L 5432:localhost:5432 dev@build-box"}, false},
+	}
+	for _, test := range tests {
+		if got := test.holder.leftOver(stale); got != test.expected {
+			t.Errorf("leftOver(%s) failed: expected %v, got %v", test.holder.Command, test.expected, got)
+		}
+	}
+	if (portHolder{PID: 4242, Group: 4242}).leftOver(nil) {
+		t.Error("leftOver failed: expected no process to be left over without a stale session")
+	}
+}
+
+func TestPortHolders(t *testing.T) {
+	if _, err := exec.LookPath("lsof"); err != nil {
+		t.Skip("lsof is not available")
+	}
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Error creating listener: %v", err)
+	}
+	defer listener.Close()
+	holders, err := portHolders(listener.Addr().(*net.TCPAddr).Port)
+	if err != nil {
+		t.Fatalf("portHolders failed: %v", err)
+	}
+	if len(holders) != 1 || holders[0].PID != os.Getpid() || !holders[0].critical() {
+		t.Errorf("portHolders failed: expected the test process, got %v", holders)
+	}
+	if err := killPortHolders(listener.Addr().(*net.TCPAddr).Port, holders); err == nil {
+		t.Error("killPortHolders failed: expected devcli itself not to be killed")
+	}
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+)
+
+// resourceManagerURL is the Cloud Resource Manager API the IAM permissions are tested against
+var resourceManagerURL = "https://cloudresourcemanager.googleapis.com/v1"
+
+// iamClient tests the IAM permissions, bounded so that an unresponsive API does not hold up
+// the start of the session
+var iamClient = &http.Client{Timeout: 30 * time.Second}
+
+// Permissions the steps of a session need, in the project of the resource they act on. The
+// pods are not among them: RBAC can grant them in a namespace without any project role, so
+// they are left to the kubectl auth can-i check.
+var (
+	clusterPermissions = []string{"container.clusters.get", "container.clusters.list"}
+	bastionPermissions = []string{"compute.instances.get", "compute.instances.list", "iap.tunnelInstances.accessViaIAP"}
+	gatewayPermissions = []string{"gkehub.memberships.get", "gkehub.gateway.get"}
+)
+
+// requiredPermissions returns the IAM permissions the session needs in each project
+func requiredPermissions(config ProxyConfig) map[string][]string {
+	required := make(map[string][]string)
+	add := func(project string, permissions []string) {
+		for _, permission := range permissions {
+			if !slices.Contains(required[project], permission) {
+				required[project] = append(required[project], permission)
+			}
+		}
+	}
+	cluster := func(project string) {
+		add(project, clusterPermissions)
+		if config.ConnectGateway.Enabled {
+			add(project, gatewayPermissions)
+		}
+	}
+	// the cluster of an existing kubeconfig context may not even be a GKE cluster
+	if usesClusters(config) && config.KubeContext == "" {
+		cluster(config.CloudProject)
+		for _, workload := range config.Workloads {
+			project := config.CloudProject
+			if workload.Project != "" {
+				project = workload.Project
+			}
+			cluster(project)
+		}
+	}
+	if usesIAPBastion(config) {
+		add(config.CloudProject, bastionPermissions)
+	}
+	for _, connection := range config.Bastion.Connections {
+		if connection.Project != "" {
+			add(connection.Project, bastionPermissions)
+		}
+	}
+	return required
+}
+
+// MissingPermissionsError lists the IAM permissions the user lacks in each project
+type MissingPermissionsError struct {
+	Missing map[string][]string
+}
+
+func (e *MissingPermissionsError) Error() string {
+	var projects []string
+	for project := range e.Missing {
+		projects = append(projects, project)
+	}
+	slices.Sort(projects)
+	var parts []string
+	for _, project := range projects {
+		parts = append(parts, fmt.Sprintf("%s (%s)", project, strings.Join(e.Missing[project], ", ")))
+	}
+	return "missing IAM permissions in project " + strings.Join(parts, "; ")
+}
+
+// gcloudAccessToken returns the access token of the gcloud account
+func gcloudAccessToken(ctx context.Context, runner *commandRunner) (string, error) {
+	cmd := exec.CommandContext(ctx, "gcloud", "auth", "print-access-token")
+	cmd.Stderr = logger.Writer("gcloud")
+	token, err := runner.output(ctx, cmd)
+	if err != nil {
+		return "", fmt.Errorf("getting an access token: %w", err)
+	}
+	return strings.TrimSpace(string(token)), nil
+}
+
+// checkPermissions tests the IAM permissions the session needs before anything is started,
+// so that a missing role is reported by name instead of failing a step half-way. Only the
+// permissions granted on the projects are seen, a session can still work with permissions
+// granted on single instances or clusters, which is what -preflight=false is for.
+func checkPermissions(ctx context.Context, token string, config ProxyConfig) error {
+	missing := make(map[string][]string)
+	for project, permissions := range requiredPermissions(config) {
+		granted, err := testIAMPermissions(ctx, token, project, permissions)
+		if err != nil {
+			fmt.Printf("Warning: the IAM permissions in project %s cannot be checked: %v\n", project, err)
+			continue
+		}
+		for _, permission := range permissions {
+			if !slices.Contains(granted, permission) {
+				missing[project] = append(missing[project], permission)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		return &MissingPermissionsError{Missing: missing}
+	}
+	return nil
+}
+
+// testIAMPermissions returns the permissions the user holds of the given ones in the project
+func testIAMPermissions(ctx context.Context, token, project string, permissions []string) ([]string, error) {
+	body, err := json.Marshal(map[string][]string{"permissions": permissions})
+	if err != nil {
+		return nil, err
+	}
+	url := fmt.Sprintf("%s/projects/%s:testIamPermissions", resourceManagerURL, project)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := iamClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	var result struct {
+		Permissions []string `json:"permissions"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	return result.Permissions, nil
+}
+
+// bastionConnectTimeout bounds the ssh connection of the bastion reachability check
+const bastionConnectTimeout = 15
+
+// BastionUnreachableError is a bastion the reachability check could not ssh into
+type BastionUnreachableError struct {
+	Bastion Bastion
+	// Project is the bastion's project, empty for the environment's
+	Project string
+	Err     error
+}
+
+func (e *BastionUnreachableError) Error() string {
+	name := e.Bastion.Name
+	if e.Project != "" {
+		name = e.Project + "/" + name
+	}
+	return fmt.Sprintf("bastion %s in zone %s is not reachable: %v", name, e.Bastion.Zone, e.Err)
+}
+
+func (e *BastionUnreachableError) Unwrap() error {
+	return e.Err
+}
+
+// bastionArgs returns the gcloud compute ssh arguments reaching the bastion
+func bastionArgs(bastion Bastion, project string) []string {
+	args := []string{"compute", "ssh", bastion.Name, "--zone", bastion.Zone}
+	if project != "" {
+		args = append(args, "--project", project)
+	}
+	return append(args, hostKeyArgs(bastion)...)
+}
+
+// checkBastions runs a command on the bastion of the environment and on the bastions of
+// the connections' projects, so that a firewall or IAP problem is found once before any
+// connection is started instead of by every one of them
+func checkBastions(ctx context.Context, runner *commandRunner, bastion Bastion, zones map[string]string) error {
+	checks := []func() error{func() error { return checkBastion(ctx, runner, bastion, "") }}
+	for project, zone := range zones {
+		other := bastion
+		other.Zone = zone
+		checks = append(checks, func() error { return checkBastion(ctx, runner, other, project) })
+	}
+	return runParallel(checks...)
+}
+
+// bastionCheckCommand returns the program and arguments running true on the bastion
+func bastionCheckCommand(bastion Bastion, project string) (string, []string) {
+	return bastionSSH(bastion, project, "true", "-o", fmt.Sprintf("ConnectTimeout=%d", bastionConnectTimeout))
+}
+
+// checkBastion connects to the bastion over ssh and runs true on it
+func checkBastion(ctx context.Context, runner *commandRunner, bastion Bastion, project string) error {
+	name, args := bastionCheckCommand(bastion, project)
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = logger.Writer(bastion.Name)
+	cmd.Stderr = logger.Writer(bastion.Name)
+	if err := runner.run(ctx, cmd); err != nil {
+		return &BastionUnreachableError{Bastion: bastion, Project: project, Err: err}
+	}
+	return nil
+}
+
+// troubleshootBastion runs the gcloud diagnostics of the ssh connection to the bastion:
+// the instance's status, the firewall rules, IAP and the user's IAM permissions
+func troubleshootBastion(ctx context.Context, e *BastionUnreachableError) {
+	fmt.Println("Running the gcloud ssh troubleshooter for the bastion:")
+	args := append(bastionArgs(e.Bastion, e.Project), "--tunnel-through-iap", "--troubleshoot")
+	cmd := exec.CommandContext(ctx, "gcloud", args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	started := commandStarted(cmd)
+	err := cmd.Run()
+	commandFinished(cmd, started, err)
+	if err != nil {
+		fmt.Println("Error running the troubleshooter:", err)
+	}
+}
+
+// rbacChecks are the kubectl auth can-i arguments of what a workload's port-forward needs
+var rbacChecks = [][]string{
+	{"get", "pods"},
+	{"create", "pods", "--subresource=portforward"},
+}
+
+// rbacDenial is a namespace of a cluster the user cannot port-forward in
+type rbacDenial struct {
+	Context   string
+	Namespace string
+	// Denied are the denied actions, e.g. "create pods/portforward"
+	Denied []string
+}
+
+// RBACDeniedError lists the namespaces whose workloads the user cannot port-forward to
+type RBACDeniedError struct {
+	Denials []rbacDenial
+}
+
+func (e *RBACDeniedError) Error() string {
+	var namespaces []string
+	for _, denial := range e.Denials {
+		namespaces = append(namespaces, fmt.Sprintf("%s in %s (%s)", denial.Namespace, denial.Context, strings.Join(denial.Denied, ", ")))
+	}
+	return "Kubernetes RBAC denies port-forwarding in namespace " + strings.Join(namespaces, "; ")
+}
+
+// rbacAction renders can-i arguments as an action, e.g. "create pods/portforward"
+func rbacAction(check []string) string {
+	action := check[0] + " " + check[1]
+	for _, arg := range check[2:] {
+		if subresource, ok := strings.CutPrefix(arg, "--subresource="); ok {
+			action += "/" + subresource
+		}
+	}
+	return action
+}
+
+// checkRBAC asks the API servers whether the user may list and port-forward to the pods of
+// every namespace of the workloads, once per cluster and namespace
+func checkRBAC(ctx context.Context, runner *commandRunner, workloads []Workload) error {
+	type target struct{ context, namespace string }
+	var targets []target
+	for _, workload := range workloads {
+		t := target{workload.kubeContext, workload.Namespace}
+		if !slices.Contains(targets, t) {
+			targets = append(targets, t)
+		}
+	}
+	denials := make([]rbacDenial, len(targets))
+	var checks []func() error
+	for i, t := range targets {
+		checks = append(checks, func() error {
+			denials[i] = rbacDenial{Context: t.context, Namespace: t.namespace}
+			for _, check := range rbacChecks {
+				allowed, err := canI(ctx, runner, Workload{kubeContext: t.context, Namespace: t.namespace}, check)
+				if err != nil {
+					return err
+				}
+				if !allowed {
+					denials[i].Denied = append(denials[i].Denied, rbacAction(check))
+				}
+			}
+			return nil
+		})
+	}
+	if err := runParallel(checks...); err != nil {
+		return err
+	}
+	denied := &RBACDeniedError{}
+	for _, denial := range denials {
+		if len(denial.Denied) > 0 {
+			denied.Denials = append(denied.Denials, denial)
+		}
+	}
+	if len(denied.Denials) > 0 {
+		return denied
+	}
+	return nil
+}
+
+// canI runs kubectl auth can-i in the workload's cluster and namespace. It prints no and
+// exits with 1 when the action is denied.
+func canI(ctx context.Context, runner *commandRunner, workload Workload, check []string) (bool, error) {
+	args := append([]string{"auth", "can-i"}, check...)
+	cmd := kubectlCommand(ctx, workload, append(args, "-n", workload.Namespace)...)
+	cmd.Stderr = logger.Writer("kubectl")
+	out, err := runner.output(ctx, cmd)
+	answer := strings.TrimSpace(string(out))
+	if answer == "no" {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("checking whether you can %s in namespace %s: %w", rbacAction(check), workload.Namespace, err)
+	}
+	return answer == "yes", nil
+}
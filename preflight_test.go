@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRequiredPermissions(t *testing.T) {
+	config := ProxyConfig{
+		CloudProject: "okcredit-staging-env",
+		Workloads:    []Workload{{App: "cashfree"}, {App: "warehouse", Project: "okcredit-data"}},
+		Bastion:      Bastion{Connections: []Connection{{RemoteHost: "10.120.52.48", RemotePort: 5432, Project: "okcredit-shared"}}},
+	}
+	required := requiredPermissions(config)
+	if len(required) != 3 {
+		t.Fatalf("requiredPermissions failed: expected 3 projects, got %v", required)
+	}
+	for project, permissions := range map[string][]string{
+		"okcredit-staging-env": {"container.clusters.get", "iap.tunnelInstances.accessViaIAP"},
+		"okcredit-data":        {"container.clusters.get", "container.clusters.list"},
+		"okcredit-shared":      {"compute.instances.get", "iap.tunnelInstances.accessViaIAP"},
+	} {
+		for _, permission := range permissions {
+			if !slices.Contains(required[project], permission) {
+				t.Errorf("requiredPermissions failed: expected %s in project %s, got %v", permission, project, required[project])
+			}
+		}
+	}
+	if slices.Contains(required["okcredit-data"], "compute.instances.get") || slices.Contains(required["okcredit-staging-env"], "gkehub.gateway.get") ||
+		slices.Contains(required["okcredit-data"], "container.pods.portForward") {
+		t.Errorf("requiredPermissions failed: unexpected permissions %v", required)
+	}
+
+	config.ConnectGateway.Enabled = true
+	if !slices.Contains(requiredPermissions(config)["okcredit-data"], "gkehub.gateway.get") {
+		t.Error("requiredPermissions failed: expected the gateway permissions with connect_gateway")
+	}
+}
+
+func TestTestIAMPermissions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/projects/okcredit-42:testIamPermissions" || r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "unexpected request "+r.URL.Path, http.StatusForbidden)
+			return
+		}
+		var body struct {
+			Permissions []string `json:"permissions"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		// the user holds every permission but listing the clusters
+		var granted []string
+		for _, permission := range body.Permissions {
+			if permission != "container.clusters.list" {
+				granted = append(granted, permission)
+			}
+		}
+		json.NewEncoder(w).Encode(map[string][]string{"permissions": granted})
+	}))
+	defer server.Close()
+	defer func(url string) { resourceManagerURL = url }(resourceManagerURL)
+	resourceManagerURL = server.URL
+
+	granted, err := testIAMPermissions(context.Background(), "token", "okcredit-42", clusterPermissions)
+	if err != nil || len(granted) != 1 || granted[0] != "container.clusters.get" {
+		t.Errorf("testIAMPermissions failed: expected container.clusters.get, got %v, %v", granted, err)
+	}
+	if _, err := testIAMPermissions(context.Background(), "token", "okcredit-staging-env", clusterPermissions); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("testIAMPermissions failed: expected the 403 of the API, got %v", err)
+	}
+
+	err = &MissingPermissionsError{Missing: map[string][]string{"okcredit-42": {"container.clusters.list"}, "okcredit-data": {"container.clusters.get"}}}
+	if err.Error() != "missing IAM permissions in project okcredit-42 (container.clusters.list); okcredit-data (container.clusters.get)" {
+		t.Errorf("MissingPermissionsError failed: unexpected message %q", err)
+	}
+}
+
+func TestBastionUnreachableError(t *testing.T) {
+	cause := &CommandError{Command: "gcloud compute ssh bastion --zone asia-south1-a --project okcredit-shared --command true", ExitCode: 255, Class: ClassHostUnreachable, Err: errors.New("exit status 255")}
+	err := fmt.Errorf("bastion zone: %w", &BastionUnreachableError{Bastion: Bastion{Name: "bastion", Zone: "asia-south1-a"}, Project: "okcredit-shared", Err: cause})
+	if !strings.HasPrefix(err.Error(), "bastion zone: bastion okcredit-shared/bastion in zone asia-south1-a is not reachable: ") {
+		t.Errorf("BastionUnreachableError failed: unexpected message %q", err)
+	}
+	var unreachable *BastionUnreachableError
+	if !errors.As(err, &unreachable) || unreachable.Project != "okcredit-shared" {
+		t.Errorf("BastionUnreachableError failed: expected to find it in %v", err)
+	}
+	if !strings.Contains(remediationHint(err), "--troubleshoot") {
+		t.Errorf("BastionUnreachableError failed: expected the ssh hint, got %q", remediationHint(err))
+	}
+	name, args := bastionCheckCommand(Bastion{Name: "bastion", Zone: "asia-south1-a"}, "okcredit-shared")
+	if command := name + " " + strings.Join(args, " "); command != "gcloud compute ssh bastion --zone asia-south1-a --project okcredit-shared --command true -- -o ConnectTimeout=15" {
+		t.Errorf("bastionCheckCommand failed: unexpected command %s", command)
+	}
+}
+
+func TestCheckRBAC(t *testing.T) {
+	// a kubectl that denies port-forwarding in the payments namespace
+	dir := t.TempDir()
+	script := `#!/bin/sh
+case "$*" in
+*portforward*"-n payments") echo no; exit 1 ;;
+*"-n broken") echo "error: You must be logged in to the server (Unauthorized)" >&2; exit 1 ;;
+esac
+echo yes
+`
+	if err := os.WriteFile(filepath.Join(dir, "kubectl"), []byte(script), 0755); err != nil {
+		t.Fatalf("Error writing the fake kubectl: %v", err)
+	}
+	t.Setenv("PATH", dir+string(filepath.ListSeparator)+os.Getenv("PATH"))
+	runner := newCommandRunner(2, 0)
+	ctx := context.Background()
+
+	workloads := []Workload{
+		{App: "cashfree", Namespace: "payments", kubeContext: "gke_okcredit-42_asia-south1_prod"},
+		{App: "ledger", Namespace: "payments", kubeContext: "gke_okcredit-42_asia-south1_prod"},
+		{App: "khata", Namespace: "enr", kubeContext: "gke_okcredit-42_asia-south1_prod"},
+	}
+	err := checkRBAC(ctx, runner, workloads)
+	var denied *RBACDeniedError
+	if !errors.As(err, &denied) || len(denied.Denials) != 1 {
+		t.Fatalf("checkRBAC failed: expected the payments namespace to be denied, got %v", err)
+	}
+	if err.Error() != "Kubernetes RBAC denies port-forwarding in namespace payments in gke_okcredit-42_asia-south1_prod (create pods/portforward)" {
+		t.Errorf("RBACDeniedError failed: unexpected message %q", err)
+	}
+	if err := checkRBAC(ctx, runner, workloads[2:]); err != nil {
+		t.Errorf("checkRBAC failed: expected the enr namespace to be allowed, got %v", err)
+	}
+	err = checkRBAC(ctx, runner, []Workload{{App: "khata", Namespace: "broken"}})
+	if errors.As(err, &denied) || errorClass(err) != ClassAuthExpired {
+		t.Errorf("checkRBAC failed: expected the kubectl error, got %v", err)
+	}
+}
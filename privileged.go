@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// remappedPortOffset is added to the privileged local ports remapped by -remap-privileged,
+// e.g. 443 listens on 10443
+const remappedPortOffset = 10000
+
+// capNetBindService is the bit of CAP_NET_BIND_SERVICE in the capability sets of a process
+const capNetBindService = 10
+
+// unprivilegedPortStart returns the lowest local port devcli may listen on, 0 when it may
+// listen on any port. macOS lets every user listen on privileged ports, linux only root,
+// processes with CAP_NET_BIND_SERVICE, or the ports from net.ipv4.ip_unprivileged_port_start.
+var unprivilegedPortStart = func() int {
+	if runtime.GOOS != "linux" || os.Geteuid() == 0 || hasCapability(capNetBindService) {
+		return 0
+	}
+	data, err := os.ReadFile("/proc/sys/net/ipv4/ip_unprivileged_port_start")
+	if err != nil {
+		return 1024
+	}
+	start, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 1024
+	}
+	return start
+}
+
+// hasCapability reports whether the effective capabilities of devcli include the bit
+func hasCapability(bit uint) bool {
+	data, err := os.ReadFile("/proc/self/status")
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if value, ok := strings.CutPrefix(line, "CapEff:"); ok {
+			caps, err := strconv.ParseUint(strings.TrimSpace(value), 16, 64)
+			return err == nil && caps&(1<<bit) != 0
+		}
+	}
+	return false
+}
+
+// privilegedPort is a local port of a tunnel devcli may not listen on
+type privilegedPort struct {
+	Tunnel string
+	Port   int
+}
+
+// privilegedPorts returns the local ports of the session below start
+func privilegedPorts(config ProxyConfig, start int) []privilegedPort {
+	var ports []privilegedPort
+	for _, workload := range config.Workloads {
+		if workload.LocalPort < start {
+			ports = append(ports, privilegedPort{"workload " + workload.Name(), workload.LocalPort})
+		}
+	}
+	for _, connection := range config.Bastion.Connections {
+		if connection.LocalPort < start {
+			ports = append(ports, privilegedPort{"connection " + connection.Name(), connection.LocalPort})
+		}
+	}
+	if config.APIProxy.enabled() && config.APIProxy.LocalPort < start {
+		ports = append(ports, privilegedPort{"api_proxy", config.APIProxy.LocalPort})
+	}
+	return ports
+}
+
+// PrivilegedPortsError lists the local ports of the session only root may listen on, which
+// would otherwise fail with a bare permission denied when the tunnels start
+type PrivilegedPortsError struct {
+	Ports []privilegedPort
+	Start int
+}
+
+func (e *PrivilegedPortsError) Error() string {
+	var ports []string
+	for _, port := range e.Ports {
+		ports = append(ports, fmt.Sprintf("%d (%s)", port.Port, port.Tunnel))
+	}
+	return fmt.Sprintf("local ports below %d need root: %s", e.Start, strings.Join(ports, ", "))
+}
+
+// report explains the error and the ways around it
+func (e *PrivilegedPortsError) report(w io.Writer) {
+	fmt.Fprintf(w, "Error: only root may listen on local ports below %d, which these tunnels use:\n", e.Start)
+	var relays []string
+	for _, port := range e.Ports {
+		fmt.Fprintf(w, "  %d: %s\n", port.Port, port.Tunnel)
+		relays = append(relays, fmt.Sprintf("%d:%d", port.Port, port.Port+remappedPortOffset))
+	}
+	fmt.Fprintf(w, "Hint: run with -remap-privileged to listen on the port plus %d instead, e.g. %d on %d.\n", remappedPortOffset, e.Ports[0].Port, e.Ports[0].Port+remappedPortOffset)
+	fmt.Fprintf(w, "Hint: to keep the ports, also run sudo devcli relay %s in another terminal, which only listens on them and relays to the remapped ones.\n", strings.Join(relays, " "))
+	fmt.Fprintln(w, "Hint: or let devcli listen on them with sudo setcap cap_net_bind_service=+ep $(which devcli), or lower net.ipv4.ip_unprivileged_port_start with sysctl.")
+}
+
+// portRemap is a privileged local port moved to an unprivileged one by -remap-privileged
+type portRemap struct {
+	Tunnel   string
+	From, To int
+}
+
+// remapPrivilegedPorts moves the local ports of the session below start to the port plus
+// remappedPortOffset, unless that port is used by another tunnel
+func remapPrivilegedPorts(config *ProxyConfig, start int) ([]portRemap, error) {
+	used := make(map[int]bool)
+	for _, workload := range config.Workloads {
+		used[workload.LocalPort] = true
+	}
+	for _, connection := range config.Bastion.Connections {
+		used[connection.LocalPort] = true
+	}
+	if config.APIProxy.enabled() {
+		used[config.APIProxy.LocalPort] = true
+	}
+
+	var remaps []portRemap
+	remap := func(tunnel string, port *int) error {
+		if *port >= start {
+			return nil
+		}
+		to := *port + remappedPortOffset
+		if used[to] {
+			return fmt.Errorf("privileged local port %d of %s cannot be remapped to %d, which another tunnel uses", *port, tunnel, to)
+		}
+		used[to] = true
+		remaps = append(remaps, portRemap{Tunnel: tunnel, From: *port, To: to})
+		*port = to
+		return nil
+	}
+	for i := range config.Workloads {
+		if err := remap("workload "+config.Workloads[i].Name(), &config.Workloads[i].LocalPort); err != nil {
+			return nil, err
+		}
+	}
+	for i := range config.Bastion.Connections {
+		if err := remap("connection "+config.Bastion.Connections[i].Name(), &config.Bastion.Connections[i].LocalPort); err != nil {
+			return nil, err
+		}
+	}
+	if config.APIProxy.enabled() {
+		if err := remap("api_proxy", &config.APIProxy.LocalPort); err != nil {
+			return nil, err
+		}
+	}
+	return remaps, nil
+}
+
+// checkPrivilegedPorts returns a *PrivilegedPortsError for the local ports of the session
+// devcli may not listen on, or remaps them with -remap-privileged
+func checkPrivilegedPorts(config *ProxyConfig, remap bool) error {
+	start := unprivilegedPortStart()
+	ports := privilegedPorts(*config, start)
+	if len(ports) == 0 {
+		return nil
+	}
+	if !remap {
+		return &PrivilegedPortsError{Ports: ports, Start: start}
+	}
+	remaps, err := remapPrivilegedPorts(config, start)
+	if err != nil {
+		return err
+	}
+	for _, remap := range remaps {
+		fmt.Printf("Listening on port %d instead of %d for %s, as only root may listen on %d.\n", remap.To, remap.From, remap.Tunnel, remap.From)
+	}
+	return nil
+}
+
+// runRelay implements devcli relay, which is run as root to listen on privileged local
+// ports and relay them to the unprivileged ports of a session run with -remap-privileged
+func runRelay(args []string) {
+	fs := flag.NewFlagSet("devcli relay", flag.ExitOnError)
+	host := fs.String("host", listenHost, "Address to listen on")
+	fs.Usage = func() {
+		fmt.Println("Usage: sudo devcli relay [-host <address>] <port>:<target port>...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	listenHost = *host
+	var relays []*relay
+	for _, arg := range fs.Args() {
+		from, to, ok := strings.Cut(arg, ":")
+		listenPort, err1 := strconv.Atoi(from)
+		targetPort, err2 := strconv.Atoi(to)
+		if !ok || err1 != nil || err2 != nil {
+			fmt.Printf("Error: %s is not a port and a target port like 443:10443\n", arg)
+			os.Exit(2)
+		}
+		// the target is the local port of the remapped session, on the same address
+		relays = append(relays, &relay{listenPort: listenPort, target: localAddress(targetPort), targetPort: targetPort})
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	errs := make(chan error, len(relays))
+	for _, r := range relays {
+		go func() {
+			if err := r.run(ctx); err != nil {
+				errs <- fmt.Errorf("relaying port %d: %w", r.listenPort, err)
+			}
+		}()
+		fmt.Printf("Relaying %s:%d to local port %d.\n", listenHost, r.listenPort, r.targetPort)
+	}
+	select {
+	case <-ctx.Done():
+	case err := <-errs:
+		fmt.Println("Error", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCheckPrivilegedPorts(t *testing.T) {
+	start := unprivilegedPortStart
+	t.Cleanup(func() { unprivilegedPortStart = start })
+	unprivilegedPortStart = func() int { return 1024 }
+
+	config := ProxyConfig{
+		Workloads: []Workload{{App: "web", LocalPort: 443}, {App: "cashfree", LocalPort: 8080}},
+		Bastion:   Bastion{Connections: []Connection{{LocalPort: 80, RemoteHost: "10.0.0.1", RemotePort: 80}}},
+	}
+	err := checkPrivilegedPorts(&config, false)
+	var privileged *PrivilegedPortsError
+	if !errors.As(err, &privileged) || len(privileged.Ports) != 2 {
+		t.Fatalf("checkPrivilegedPorts failed: expected the two privileged ports, got %v", err)
+	}
+	var b bytes.Buffer
+	privileged.report(&b)
+	if !strings.Contains(b.String(), "443: workload web") || !strings.Contains(b.String(), "sudo devcli relay 443:10443 80:10080") {
+		t.Errorf("report failed: unexpected output %q", b.String())
+	}
+
+	if err := checkPrivilegedPorts(&config, true); err != nil {
+		t.Fatalf("checkPrivilegedPorts failed: expected the ports to be remapped, got %v", err)
+	}
+	if config.Workloads[0].LocalPort != 10443 || config.Workloads[1].LocalPort != 8080 || config.Bastion.Connections[0].LocalPort != 10080 {
+		t.Errorf("checkPrivilegedPorts failed: unexpected local ports %+v %+v", config.Workloads, config.Bastion.Connections)
+	}
+
+	taken := ProxyConfig{Workloads: []Workload{{App: "web", LocalPort: 443}, {App: "admin", LocalPort: 10443}}}
+	if _, err := remapPrivilegedPorts(&taken, 1024); err == nil {
+		t.Error("remapPrivilegedPorts failed: expected a remapped port used by another tunnel to be rejected")
+	}
+
+	unprivilegedPortStart = func() int { return 0 }
+	root := ProxyConfig{Workloads: []Workload{{App: "web", LocalPort: 443}}}
+	if err := checkPrivilegedPorts(&root, false); err != nil || root.Workloads[0].LocalPort != 443 {
+		t.Errorf("checkPrivilegedPorts failed: expected no change when every port may be used, got %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+const (
+	livenessAlive = "alive"
+	livenessDead  = "dead"
+)
+
+var ErrTunnelClosed = errors.New("tunnel closed the connection")
+
+// probeTunnel dials a forwarded local port and verifies that the remote side is still there.
+// ssh and kubectl accept local connections even when the remote channel is gone and then
+// close them right away, so a connection that is closed within the timeout is a zombie
+// tunnel. A connection that stays open (or receives a greeting) is alive.
+func probeTunnel(address string, timeout time.Duration) error {
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	_, err = conn.Read(make([]byte, 1))
+	if err == nil {
+		return nil
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return nil
+	}
+	if errors.Is(err, io.EOF) {
+		return ErrTunnelClosed
+	}
+	return err
+}
+
+// watchLiveness probes every registered tunnel each interval until the context is canceled,
+// printing tunnels that stop (or start) responding
+func watchLiveness(ctx context.Context, registry *statusRegistry, interval, timeout time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for _, tunnel := range registry.snapshot() {
+			if tunnel.State == statePaused {
+				continue
+			}
+			err := probeTunnel(localAddress(tunnel.LocalPort), timeout)
+			if ctx.Err() != nil {
+				return
+			}
+			liveness := livenessAlive
+			if err != nil {
+				liveness = livenessDead
+			} else if connect, rtt, err := measureLatency(tunnel.Protocol, localAddress(tunnel.LocalPort), timeout); err == nil {
+				registry.recordLatency(tunnel.Name, connect, rtt)
+			}
+			previous := registry.setLiveness(tunnel.Name, liveness, err)
+			if previous == liveness || (previous == "unknown" && liveness == livenessAlive) {
+				continue
+			}
+			if liveness == livenessDead {
+				fmt.Printf("Tunnel %s on local port %d is not responding: %v\n", tunnel.Name, tunnel.LocalPort, err)
+			} else {
+				fmt.Printf("Tunnel %s on local port %d is responding again\n", tunnel.Name, tunnel.LocalPort)
+			}
+		}
+	}
+}
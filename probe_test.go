@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestProbeTunnel(t *testing.T) {
+	// a live tunnel keeps the connection open
+	alive, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Error creating listener: %v", err)
+	}
+	defer alive.Close()
+	go func() {
+		for {
+			conn, err := alive.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	if err := probeTunnel(alive.Addr().String(), 200*time.Millisecond); err != nil {
+		t.Errorf("probeTunnel failed: expected live tunnel, got %v", err)
+	}
+
+	// a zombie tunnel accepts and closes the connection right away
+	zombie, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Error creating listener: %v", err)
+	}
+	defer zombie.Close()
+	go func() {
+		for {
+			conn, err := zombie.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	if err := probeTunnel(zombie.Addr().String(), time.Second); err != ErrTunnelClosed {
+		t.Errorf("probeTunnel failed: expected %v, got %v", ErrTunnelClosed, err)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Profile is a named working setup: an environment, the tags of the tunnels to start and
+// extra hooks, started with devcli start <profile>
+type Profile struct {
+	Name        string   `yaml:"name"`
+	Environment string   `yaml:"environment"`
+	Tags        []string `yaml:"tags"`
+	Hooks       Hooks    `yaml:"hooks"`
+}
+
+// parseStartArgs parses the flags of devcli start, which may be preceded or followed by
+// the name of a profile
+func parseStartArgs(fs *flag.FlagSet, opts *options, args []string) {
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		opts.profile = fs.Arg(0)
+		fs.Parse(fs.Args()[1:])
+	}
+	if fs.NArg() > 0 {
+		fmt.Printf("Error: unexpected argument %s, only one profile can be started.\n", fs.Arg(0))
+		os.Exit(2)
+	}
+}
+
+// findProfile returns the profile with the given name
+func findProfile(config Config, name string) (Profile, error) {
+	for _, profile := range config.Profiles {
+		if profile.Name == name {
+			return profile, nil
+		}
+	}
+	var names []string
+	for _, profile := range config.Profiles {
+		names = append(names, profile.Name)
+	}
+	if len(names) == 0 {
+		return Profile{}, fmt.Errorf("no profile named %s, the configuration file has no profiles", name)
+	}
+	return Profile{}, fmt.Errorf("no profile named %s, expected one of %s", name, strings.Join(names, ", "))
+}
+
+// selectEnvironment sets the environment of the configuration from the command line, the
+// profile, or keeps the configuration's default, in this order
+func selectEnvironment(config *Config, opts options) error {
+	if opts.profile != "" {
+		profile, err := findProfile(*config, opts.profile)
+		if err != nil {
+			return err
+		}
+		if profile.Environment != "" {
+			config.Environment = profile.Environment
+		}
+	}
+	if opts.environment != "" {
+		config.Environment = opts.environment
+	}
+	return nil
+}
+
+// applyProfile reduces the proxy configuration to the tunnels with one of the tags of the
+// command line and the profile, and adds the profile's hooks after the environment's
+func applyProfile(config Config, proxyConfig ProxyConfig, opts options) (ProxyConfig, error) {
+	tags := splitTags(opts.tags)
+	if opts.profile != "" {
+		profile, err := findProfile(config, opts.profile)
+		if err != nil {
+			return proxyConfig, err
+		}
+		tags = append(tags, profile.Tags...)
+		proxyConfig.Hooks.PreStart = append(proxyConfig.Hooks.PreStart, profile.Hooks.PreStart...)
+		proxyConfig.Hooks.PostStart = append(proxyConfig.Hooks.PostStart, profile.Hooks.PostStart...)
+		proxyConfig.Hooks.PreStop = append(proxyConfig.Hooks.PreStop, profile.Hooks.PreStop...)
+		proxyConfig.Hooks.PostStop = append(proxyConfig.Hooks.PostStop, profile.Hooks.PostStop...)
+	}
+	if len(tags) == 0 {
+		return proxyConfig, nil
+	}
+	return filterTags(proxyConfig, tags)
+}
+
+// filterTags returns the proxy configuration reduced to the workloads and connections with
+// at least one of the tags
+func filterTags(config ProxyConfig, tags []string) (ProxyConfig, error) {
+	tagged := func(tunnelTags []string) bool {
+		for _, tag := range tags {
+			if slices.Contains(tunnelTags, tag) {
+				return true
+			}
+		}
+		return false
+	}
+	var workloads []Workload
+	for _, workload := range config.Workloads {
+		if tagged(workload.Tags) {
+			workloads = append(workloads, workload)
+		}
+	}
+	var connections []Connection
+	for _, connection := range config.Bastion.Connections {
+		if tagged(connection.Tags) {
+			connections = append(connections, connection)
+		}
+	}
+	if len(workloads) == 0 && len(connections) == 0 {
+		return config, fmt.Errorf("no workload or connection tagged %s in environment %s", strings.Join(tags, ", "), config.Environment)
+	}
+	config.Workloads = workloads
+	config.Bastion.Connections = connections
+	return config, nil
+}
+
+// splitTags splits the comma separated tags of the command line
+func splitTags(tags string) []string {
+	var split []string
+	for _, tag := range strings.Split(tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			split = append(split, tag)
+		}
+	}
+	return split
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"testing"
+)
+
+var profileConfig = Config{
+	Environment: "staging",
+	Proxies: []ProxyConfig{{
+		Environment: "dev",
+		Bastion: Bastion{Connections: []Connection{
+			{LocalPort: 5435, RemoteHost: "10.120.52.48", RemotePort: 5432, Tags: []string{"db"}},
+			{LocalPort: 6378, RemoteHost: "10.116.50.3", RemotePort: 6379, Tags: []string{"cache"}},
+		}},
+		Workloads: []Workload{
+			{Namespace: "enr", App: "cashfree", LocalPort: 8080, RemotePort: 8080, Tags: []string{"payments"}},
+			{Namespace: "enr", App: "ledger", LocalPort: 8081, RemotePort: 8080, Tags: []string{"accounting"}},
+		},
+		Hooks: Hooks{PreStart: []Hook{{Command: "make env"}}},
+	}},
+	Profiles: []Profile{{
+		Name:        "payments-dev",
+		Environment: "dev",
+		Tags:        []string{"payments", "db"},
+		Hooks:       Hooks{PostStart: []Hook{{Command: "make migrate", Fatal: true}}},
+	}},
+}
+
+func TestSelectEnvironment(t *testing.T) {
+	config := profileConfig
+	if err := selectEnvironment(&config, options{profile: "payments-dev"}); err != nil || config.Environment != "dev" {
+		t.Errorf("selectEnvironment failed: expected the profile environment dev, got %s (%v)", config.Environment, err)
+	}
+	config = profileConfig
+	if err := selectEnvironment(&config, options{profile: "payments-dev", environment: "prod"}); err != nil || config.Environment != "prod" {
+		t.Errorf("selectEnvironment failed: expected -env to win, got %s (%v)", config.Environment, err)
+	}
+	config = profileConfig
+	if err := selectEnvironment(&config, options{profile: "payments"}); err == nil {
+		t.Error("selectEnvironment failed: expected an error for an unknown profile")
+	}
+}
+
+func TestApplyProfile(t *testing.T) {
+	proxyConfig, err := applyProfile(profileConfig, profileConfig.Proxies[0], options{profile: "payments-dev"})
+	if err != nil {
+		t.Fatalf("applyProfile failed: %v", err)
+	}
+	if len(proxyConfig.Workloads) != 1 || proxyConfig.Workloads[0].App != "cashfree" ||
+		len(proxyConfig.Bastion.Connections) != 1 || proxyConfig.Bastion.Connections[0].LocalPort != 5435 {
+		t.Errorf("applyProfile failed: unexpected tunnels %+v %+v", proxyConfig.Workloads, proxyConfig.Bastion.Connections)
+	}
+	if len(proxyConfig.Hooks.PreStart) != 1 || len(proxyConfig.Hooks.PostStart) != 1 {
+		t.Errorf("applyProfile failed: expected the environment and profile hooks, got %+v", proxyConfig.Hooks)
+	}
+
+	proxyConfig, err = applyProfile(profileConfig, profileConfig.Proxies[0], options{tags: "cache, accounting"})
+	if err != nil || len(proxyConfig.Workloads) != 1 || len(proxyConfig.Bastion.Connections) != 1 {
+		t.Errorf("applyProfile failed: expected ledger and the cache with -tags, got %+v (%v)", proxyConfig, err)
+	}
+	if _, err := applyProfile(profileConfig, profileConfig.Proxies[0], options{tags: "search"}); err == nil {
+		t.Error("applyProfile failed: expected an error when no tunnel has the tags")
+	}
+}
+
+func TestParseStartArgs(t *testing.T) {
+	for _, args := range [][]string{
+		{"payments-dev", "-http-log"},
+		{"-http-log", "payments-dev"},
+	} {
+		var opts options
+		fs := flag.NewFlagSet("devcli", flag.ContinueOnError)
+		startFlags(fs, &opts)
+		parseStartArgs(fs, &opts, args)
+		if opts.profile != "payments-dev" || !opts.httpLog {
+			t.Errorf("parseStartArgs failed for %v: got profile %q and http log %v", args, opts.profile, opts.httpLog)
+		}
+	}
+}
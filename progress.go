@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// verbose prints the narration of every step of the session instead of the progress of
+// its startup phases, set by -verbose
+var verbose bool
+
+// spinnerFrames are the frames of the spinner of the running phases
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// progressDisplay shows the startup phases of a session: a line per finished phase and, on
+// a terminal, a spinner line of the running ones redrawn in place
+type progressDisplay struct {
+	animate bool
+
+	mu sync.Mutex
+	// running are the running phases in the order they started, with their labels
+	running []string
+	labels  map[string]string
+	frame   int
+	// stop ends the spinner, nil while it is not spinning
+	stop chan struct{}
+}
+
+// newProgressDisplay returns the progress display of the session, nil when it narrates its
+// steps with -verbose or prints nothing with -quiet
+func newProgressDisplay() *progressDisplay {
+	if quiet || verbose {
+		return nil
+	}
+	return &progressDisplay{animate: stdoutTerminal, labels: make(map[string]string)}
+}
+
+// start shows the phase as running
+func (p *progressDisplay) start(name string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.running = append(p.running, name)
+	p.labels[name] = name
+	if p.animate && p.stop == nil {
+		p.stop = make(chan struct{})
+		go p.spin(p.stop)
+	}
+	p.draw()
+}
+
+// update replaces the label of a running phase, e.g. with its count of finished steps
+func (p *progressDisplay) update(name, label string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.labels[name]; ok {
+		p.labels[name] = label
+		p.draw()
+	}
+}
+
+// finish prints the phase as finished, or failed
+func (p *progressDisplay) finish(name string, duration time.Duration, err error) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, running := range p.running {
+		if running == name {
+			p.running = append(p.running[:i], p.running[i+1:]...)
+			break
+		}
+	}
+	mark := "✓"
+	if err != nil {
+		mark = "✗"
+	}
+	p.clear()
+	logger.write(fmt.Sprintf("%s %s %s\n", mark, p.labels[name], duration.Round(100*time.Millisecond)))
+	delete(p.labels, name)
+	if len(p.running) == 0 && p.stop != nil {
+		close(p.stop)
+		p.stop = nil
+	}
+	p.draw()
+}
+
+// spin redraws the spinner until stop is closed
+func (p *progressDisplay) spin(stop chan struct{}) {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		p.mu.Lock()
+		p.frame++
+		p.draw()
+		p.mu.Unlock()
+	}
+}
+
+// draw writes the spinner line of the running phases, the caller holds p.mu. The cursor is
+// put back at the start of the line, so that other output overwrites it.
+func (p *progressDisplay) draw() {
+	if !p.animate || len(p.running) == 0 {
+		return
+	}
+	labels := make([]string, 0, len(p.running))
+	for _, name := range p.running {
+		labels = append(labels, p.labels[name])
+	}
+	logger.write(fmt.Sprintf("\r\x1b[K%s %s\r", spinnerFrames[p.frame%len(spinnerFrames)], strings.Join(labels, ", ")))
+}
+
+// clear erases the spinner line, the caller holds p.mu
+func (p *progressDisplay) clear() {
+	if p.animate {
+		logger.write("\r\x1b[K")
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgressDisplay(t *testing.T) {
+	var out bytes.Buffer
+	original := logger
+	logger = newConsoleLogger(&out)
+	defer func() { logger = original }()
+
+	phases := &phaseTimer{display: &progressDisplay{labels: make(map[string]string)}}
+	phases.run("bastion zone", func() error { return nil })
+	phases.run("forwards", func() error {
+		phases.display.update("forwards", "starting 2 forwards [1/2]")
+		return errors.New("not every tunnel is ready")
+	})
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 2 || lines[0] != "✓ bastion zone 0s" || lines[1] != "✗ starting 2 forwards [1/2] 0s" {
+		t.Errorf("progressDisplay failed: unexpected output %q", out.String())
+	}
+
+	out.Reset()
+	animated := &progressDisplay{animate: true, labels: make(map[string]string)}
+	animated.start("cluster discovery")
+	animated.start("bastion zone")
+	animated.finish("bastion zone", 2100*time.Millisecond, nil)
+	animated.finish("cluster discovery", time.Second, nil)
+	for _, expected := range []string{"⠋ cluster discovery, bastion zone\r", "\r\x1b[K✓ bastion zone 2.1s\n", "⠋ cluster discovery\r", "✓ cluster discovery 1s\n"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("progressDisplay failed: missing %q in %q", expected, out.String())
+		}
+	}
+	if animated.stop != nil {
+		t.Error("progressDisplay failed: the spinner is still running")
+	}
+
+	// a session narrating its steps has no display
+	(&phaseTimer{}).run("rbac", func() error { return nil })
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// promptTimeout bounds the status request to each session, so that a stuck session never
+// slows the shell prompt down
+const promptTimeout = 50 * time.Millisecond
+
+const (
+	promptGreen  = "32"
+	promptYellow = "33"
+	promptRed    = "31"
+)
+
+// runPrompt implements devcli prompt, which prints the environment and up/total tunnel count
+// of every running session, for a PS1 or starship segment. Nothing is printed without a
+// running session.
+func runPrompt(args []string) {
+	fs := flag.NewFlagSet("devcli prompt", flag.ExitOnError)
+	environment := fs.String("env", "", "Environment of the session, all running sessions when empty")
+	color := fs.Bool("color", true, "Color the segments green when every tunnel is up, yellow when some are and red when none is")
+	shell := fs.String("shell", "", "Shell whose prompt the colors are escaped for: bash, zsh, or none for starship and fish")
+	fs.Parse(args)
+
+	environments := []string{*environment}
+	if *environment == "" {
+		var err error
+		if environments, err = runningSessions(); err != nil {
+			return
+		}
+	}
+	var segments []string
+	for _, environment := range environments {
+		socket, err := sessionSocket(environment)
+		if err != nil {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), promptTimeout)
+		statuses, err := newControlClient(socket).status(ctx)
+		cancel()
+		text, colorCode := promptSegment(environment, statuses, err)
+		if *color {
+			text = promptColor(text, colorCode, *shell)
+		}
+		segments = append(segments, text)
+	}
+	if len(segments) > 0 {
+		fmt.Fprintln(os.Stdout, strings.Join(segments, " "))
+	}
+}
+
+// promptSegment returns the segment of a session, e.g. staging 3/4, and its color. A
+// session that does not answer is shown as staging ?.
+func promptSegment(environment string, statuses []tunnelStatus, err error) (string, string) {
+	if err != nil {
+		return environment + " ?", promptRed
+	}
+	up, total := 0, 0
+	for _, status := range statuses {
+		if status.State == statePaused {
+			continue
+		}
+		total++
+		if status.State == stateRunning && status.Liveness != livenessDead {
+			up++
+		}
+	}
+	colorCode := promptYellow
+	switch {
+	case up == total:
+		colorCode = promptGreen
+	case up == 0:
+		colorCode = promptRed
+	}
+	return fmt.Sprintf("%s %d/%d", environment, up, total), colorCode
+}
+
+// promptColor colors the text, with the escapes the shell's prompt needs around
+// non-printing characters so that it computes the prompt's width right
+func promptColor(text, colorCode, shell string) string {
+	start, end := "\x1b["+colorCode+"m", "\x1b[0m"
+	switch shell {
+	case "bash":
+		start, end = "\x01"+start+"\x02", "\x01"+end+"\x02"
+	case "zsh":
+		start, end = "%{"+start+"%}", "%{"+end+"%}"
+	}
+	return start + text + end
+}
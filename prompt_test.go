@@ -0,0 +1,37 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPromptSegment(t *testing.T) {
+	for _, tc := range []struct {
+		statuses []tunnelStatus
+		err      error
+		text     string
+		color    string
+	}{
+		{[]tunnelStatus{{State: stateRunning}, {State: stateRunning, Liveness: livenessAlive}}, nil, "staging 2/2", promptGreen},
+		{[]tunnelStatus{{State: stateRunning}, {State: stateBackoff}, {State: statePaused}}, nil, "staging 1/2", promptYellow},
+		{[]tunnelStatus{{State: stateRunning, Liveness: livenessDead}}, nil, "staging 0/1", promptRed},
+		{nil, errors.New("timeout"), "staging ?", promptRed},
+	} {
+		text, color := promptSegment("staging", tc.statuses, tc.err)
+		if text != tc.text || color != tc.color {
+			t.Errorf("promptSegment failed: expected %q in %s, got %q in %s", tc.text, tc.color, text, color)
+		}
+	}
+}
+
+func TestPromptColor(t *testing.T) {
+	for shell, expected := range map[string]string{
+		"":     "\x1b[32mstaging 2/2\x1b[0m",
+		"bash": "\x01\x1b[32m\x02staging 2/2\x01\x1b[0m\x02",
+		"zsh":  "%{\x1b[32m%}staging 2/2%{\x1b[0m%}",
+	} {
+		if colored := promptColor("staging 2/2", promptGreen, shell); colored != expected {
+			t.Errorf("promptColor(%q) failed: expected %q, got %q", shell, expected, colored)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// protectedBanner is the banner printed when a session of a protected environment starts
+// and once its tunnels are ready, with the read-only hints of its tunnels
+func protectedBanner(config ProxyConfig) string {
+	line := strings.Repeat("!", 64)
+	var b strings.Builder
+	b.WriteString(line + "\n")
+	fmt.Fprintf(&b, "!!  PROTECTED ENVIRONMENT %s\n", strings.ToUpper(config.Environment))
+	b.WriteString("!!  The tunnels reach live data, prefer read-only access.\n")
+	for _, hint := range readOnlyHints(config) {
+		fmt.Fprintf(&b, "!!  %s\n", hint)
+	}
+	b.WriteString(line + "\n")
+	if stdoutTerminal {
+		return "\x1b[1;41;97m" + strings.TrimSuffix(b.String(), "\n") + "\x1b[0m\n"
+	}
+	return b.String()
+}
+
+// readOnlyHints returns the read_only_hint of every tunnel that sets one
+func readOnlyHints(config ProxyConfig) []string {
+	var hints []string
+	for _, workload := range config.Workloads {
+		if workload.ReadOnlyHint != "" {
+			hints = append(hints, fmt.Sprintf("%s: %s", workload.Name(), workload.ReadOnlyHint))
+		}
+	}
+	for _, connection := range config.Bastion.Connections {
+		if connection.ReadOnlyHint != "" {
+			hints = append(hints, fmt.Sprintf("%s: %s", connection.Name(), connection.ReadOnlyHint))
+		}
+	}
+	return hints
+}
+
+// setTerminalTitle shows the title in the title bar of the terminal, so that a protected
+// session stays recognizable while it runs
+func setTerminalTitle(w io.Writer, title string) {
+	if stdoutTerminal {
+		fmt.Fprintf(w, "\x1b]0;%s\x07", title)
+	}
+}
+
+// confirmProtected asks to type the name of the protected environment before connecting to
+// it. confirmed is the name passed with -confirm-env, for sessions without a terminal.
+func confirmProtected(environment, confirmed string, in io.Reader, out io.Writer, terminal bool) error {
+	if confirmed != "" {
+		if confirmed != environment {
+			return fmt.Errorf("-confirm-env %s does not match the protected environment %s", confirmed, environment)
+		}
+		return nil
+	}
+	if !terminal {
+		return fmt.Errorf("environment %s is protected, confirm it with -confirm-env %s when not running in a terminal", environment, environment)
+	}
+	fmt.Fprintf(out, "Type the name of the environment to connect to it: ")
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && line == "" {
+		return fmt.Errorf("environment %s is protected and was not confirmed", environment)
+	}
+	if strings.TrimSpace(line) != environment {
+		return fmt.Errorf("%q is not %s, the session is not started", strings.TrimSpace(line), environment)
+	}
+	return nil
+}
+
+// dropDisallowed removes the tunnels marked disallow_protected from a protected environment
+// and returns their names
+func dropDisallowed(config ProxyConfig) (ProxyConfig, []string) {
+	if !config.Protected {
+		return config, nil
+	}
+	var dropped []string
+	var workloads []Workload
+	for _, workload := range config.Workloads {
+		if workload.DisallowProtected {
+			dropped = append(dropped, workload.Name())
+			continue
+		}
+		workloads = append(workloads, workload)
+	}
+	var connections []Connection
+	for _, connection := range config.Bastion.Connections {
+		if connection.DisallowProtected {
+			dropped = append(dropped, connection.Name())
+			continue
+		}
+		connections = append(connections, connection)
+	}
+	config.Workloads = workloads
+	config.Bastion.Connections = connections
+	return config, dropped
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestConfirmProtected(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		confirmed string
+		input     string
+		terminal  bool
+		valid     bool
+	}{
+		{"typed", "", "prod\n", true, true},
+		{"typed with spaces", "", "  prod \n", true, true},
+		{"mistyped", "", "staging\n", true, false},
+		{"no input", "", "", true, false},
+		{"flag", "prod", "", false, true},
+		{"wrong flag", "staging", "", false, false},
+		{"no terminal", "", "prod\n", false, false},
+	} {
+		var out bytes.Buffer
+		err := confirmProtected("prod", tc.confirmed, strings.NewReader(tc.input), &out, tc.terminal)
+		if (err == nil) != tc.valid {
+			t.Errorf("confirmProtected(%s) failed: expected valid %v, got %v", tc.name, tc.valid, err)
+		}
+	}
+}
+
+func TestDropDisallowed(t *testing.T) {
+	config := ProxyConfig{
+		Environment: "prod",
+		Workloads:   []Workload{{App: "cashfree", DisallowProtected: true}, {App: "payments", ReadOnlyHint: "GET requests only"}},
+		Bastion:     Bastion{Connections: []Connection{{RemoteHost: "10.120.52.48", RemotePort: 5432, ReadOnlyHint: "connect as devcli_readonly"}}},
+	}
+	if kept, dropped := dropDisallowed(config); len(dropped) != 0 || len(kept.Workloads) != 2 {
+		t.Errorf("dropDisallowed failed: expected nothing dropped from an unprotected environment, got %v", dropped)
+	}
+
+	config.Protected = true
+	kept, dropped := dropDisallowed(config)
+	if len(dropped) != 1 || dropped[0] != "cashfree" || len(kept.Workloads) != 1 || len(kept.Bastion.Connections) != 1 {
+		t.Errorf("dropDisallowed failed: expected only cashfree dropped, got %v", dropped)
+	}
+	banner := protectedBanner(kept)
+	for _, expected := range []string{"PROTECTED ENVIRONMENT PROD", "payments: GET requests only", "10.120.52.48:5432: connect as devcli_readonly"} {
+		if !strings.Contains(banner, expected) {
+			t.Errorf("protectedBanner failed: expected %q in %q", expected, banner)
+		}
+	}
+}
@@ -0,0 +1,509 @@
+// The gRPC control API of a running devcli session. A session serves it on the unix socket
+// ~/.devcli/sessions/<environment>.grpc, next to the REST API of devcli attach on
+// <environment>.sock.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: devcli/control/v1/control.proto
+
+package controlv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	durationpb "google.golang.org/protobuf/types/known/durationpb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type ListTunnelsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListTunnelsRequest) Reset() {
+	*x = ListTunnelsRequest{}
+	mi := &file_devcli_control_v1_control_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListTunnelsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListTunnelsRequest) ProtoMessage() {}
+
+func (x *ListTunnelsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_devcli_control_v1_control_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListTunnelsRequest.ProtoReflect.Descriptor instead.
+func (*ListTunnelsRequest) Descriptor() ([]byte, []int) {
+	return file_devcli_control_v1_control_proto_rawDescGZIP(), []int{0}
+}
+
+type ListTunnelsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Tunnels       []*Tunnel              `protobuf:"bytes,1,rep,name=tunnels,proto3" json:"tunnels,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListTunnelsResponse) Reset() {
+	*x = ListTunnelsResponse{}
+	mi := &file_devcli_control_v1_control_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListTunnelsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListTunnelsResponse) ProtoMessage() {}
+
+func (x *ListTunnelsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_devcli_control_v1_control_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListTunnelsResponse.ProtoReflect.Descriptor instead.
+func (*ListTunnelsResponse) Descriptor() ([]byte, []int) {
+	return file_devcli_control_v1_control_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ListTunnelsResponse) GetTunnels() []*Tunnel {
+	if x != nil {
+		return x.Tunnels
+	}
+	return nil
+}
+
+type TunnelRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// name is the tunnel's name in devcli status, e.g. cashfree or 10.120.52.48:5432.
+	Name          string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TunnelRequest) Reset() {
+	*x = TunnelRequest{}
+	mi := &file_devcli_control_v1_control_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TunnelRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TunnelRequest) ProtoMessage() {}
+
+func (x *TunnelRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_devcli_control_v1_control_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TunnelRequest.ProtoReflect.Descriptor instead.
+func (*TunnelRequest) Descriptor() ([]byte, []int) {
+	return file_devcli_control_v1_control_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *TunnelRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+type WatchTunnelsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchTunnelsRequest) Reset() {
+	*x = WatchTunnelsRequest{}
+	mi := &file_devcli_control_v1_control_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchTunnelsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchTunnelsRequest) ProtoMessage() {}
+
+func (x *WatchTunnelsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_devcli_control_v1_control_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchTunnelsRequest.ProtoReflect.Descriptor instead.
+func (*WatchTunnelsRequest) Descriptor() ([]byte, []int) {
+	return file_devcli_control_v1_control_proto_rawDescGZIP(), []int{3}
+}
+
+type TunnelEvent struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Tunnel *Tunnel                `protobuf:"bytes,1,opt,name=tunnel,proto3" json:"tunnel,omitempty"`
+	// initial is set on the statuses sent when the watch starts.
+	Initial       bool `protobuf:"varint,2,opt,name=initial,proto3" json:"initial,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TunnelEvent) Reset() {
+	*x = TunnelEvent{}
+	mi := &file_devcli_control_v1_control_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TunnelEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TunnelEvent) ProtoMessage() {}
+
+func (x *TunnelEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_devcli_control_v1_control_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TunnelEvent.ProtoReflect.Descriptor instead.
+func (*TunnelEvent) Descriptor() ([]byte, []int) {
+	return file_devcli_control_v1_control_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *TunnelEvent) GetTunnel() *Tunnel {
+	if x != nil {
+		return x.Tunnel
+	}
+	return nil
+}
+
+func (x *TunnelEvent) GetInitial() bool {
+	if x != nil {
+		return x.Initial
+	}
+	return false
+}
+
+type Tunnel struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Name  string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// kind is workload, bastion or api.
+	Kind      string `protobuf:"bytes,2,opt,name=kind,proto3" json:"kind,omitempty"`
+	LocalPort int32  `protobuf:"varint,3,opt,name=local_port,json=localPort,proto3" json:"local_port,omitempty"`
+	Protocol  string `protobuf:"bytes,4,opt,name=protocol,proto3" json:"protocol,omitempty"`
+	// state is starting, running, backoff, degraded, failed, stopped or paused.
+	State    string `protobuf:"bytes,5,opt,name=state,proto3" json:"state,omitempty"`
+	Restarts int32  `protobuf:"varint,6,opt,name=restarts,proto3" json:"restarts,omitempty"`
+	// health is unknown, serving, not_serving, unreachable or unsupported.
+	Health string `protobuf:"bytes,7,opt,name=health,proto3" json:"health,omitempty"`
+	// liveness is unknown, alive or dead.
+	Liveness      string                 `protobuf:"bytes,8,opt,name=liveness,proto3" json:"liveness,omitempty"`
+	LastError     string                 `protobuf:"bytes,9,opt,name=last_error,json=lastError,proto3" json:"last_error,omitempty"`
+	UpdatedAt     *timestamppb.Timestamp `protobuf:"bytes,10,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	ConnectP50    *durationpb.Duration   `protobuf:"bytes,11,opt,name=connect_p50,json=connectP50,proto3" json:"connect_p50,omitempty"`
+	ConnectP95    *durationpb.Duration   `protobuf:"bytes,12,opt,name=connect_p95,json=connectP95,proto3" json:"connect_p95,omitempty"`
+	RttP50        *durationpb.Duration   `protobuf:"bytes,13,opt,name=rtt_p50,json=rttP50,proto3" json:"rtt_p50,omitempty"`
+	RttP95        *durationpb.Duration   `protobuf:"bytes,14,opt,name=rtt_p95,json=rttP95,proto3" json:"rtt_p95,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Tunnel) Reset() {
+	*x = Tunnel{}
+	mi := &file_devcli_control_v1_control_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Tunnel) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Tunnel) ProtoMessage() {}
+
+func (x *Tunnel) ProtoReflect() protoreflect.Message {
+	mi := &file_devcli_control_v1_control_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Tunnel.ProtoReflect.Descriptor instead.
+func (*Tunnel) Descriptor() ([]byte, []int) {
+	return file_devcli_control_v1_control_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Tunnel) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Tunnel) GetKind() string {
+	if x != nil {
+		return x.Kind
+	}
+	return ""
+}
+
+func (x *Tunnel) GetLocalPort() int32 {
+	if x != nil {
+		return x.LocalPort
+	}
+	return 0
+}
+
+func (x *Tunnel) GetProtocol() string {
+	if x != nil {
+		return x.Protocol
+	}
+	return ""
+}
+
+func (x *Tunnel) GetState() string {
+	if x != nil {
+		return x.State
+	}
+	return ""
+}
+
+func (x *Tunnel) GetRestarts() int32 {
+	if x != nil {
+		return x.Restarts
+	}
+	return 0
+}
+
+func (x *Tunnel) GetHealth() string {
+	if x != nil {
+		return x.Health
+	}
+	return ""
+}
+
+func (x *Tunnel) GetLiveness() string {
+	if x != nil {
+		return x.Liveness
+	}
+	return ""
+}
+
+func (x *Tunnel) GetLastError() string {
+	if x != nil {
+		return x.LastError
+	}
+	return ""
+}
+
+func (x *Tunnel) GetUpdatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return nil
+}
+
+func (x *Tunnel) GetConnectP50() *durationpb.Duration {
+	if x != nil {
+		return x.ConnectP50
+	}
+	return nil
+}
+
+func (x *Tunnel) GetConnectP95() *durationpb.Duration {
+	if x != nil {
+		return x.ConnectP95
+	}
+	return nil
+}
+
+func (x *Tunnel) GetRttP50() *durationpb.Duration {
+	if x != nil {
+		return x.RttP50
+	}
+	return nil
+}
+
+func (x *Tunnel) GetRttP95() *durationpb.Duration {
+	if x != nil {
+		return x.RttP95
+	}
+	return nil
+}
+
+var File_devcli_control_v1_control_proto protoreflect.FileDescriptor
+
+const file_devcli_control_v1_control_proto_rawDesc = "" +
+	"\n" +
+	"\x1fdevcli/control/v1/control.proto\x12\x11devcli.control.v1\x1a\x1egoogle/protobuf/duration.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"\x14\n" +
+	"\x12ListTunnelsRequest\"J\n" +
+	"\x13ListTunnelsResponse\x123\n" +
+	"\atunnels\x18\x01 \x03(\v2\x19.devcli.control.v1.TunnelR\atunnels\"#\n" +
+	"\rTunnelRequest\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\"\x15\n" +
+	"\x13WatchTunnelsRequest\"Z\n" +
+	"\vTunnelEvent\x121\n" +
+	"\x06tunnel\x18\x01 \x01(\v2\x19.devcli.control.v1.TunnelR\x06tunnel\x12\x18\n" +
+	"\ainitial\x18\x02 \x01(\bR\ainitial\"\x8b\x04\n" +
+	"\x06Tunnel\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x12\n" +
+	"\x04kind\x18\x02 \x01(\tR\x04kind\x12\x1d\n" +
+	"\n" +
+	"local_port\x18\x03 \x01(\x05R\tlocalPort\x12\x1a\n" +
+	"\bprotocol\x18\x04 \x01(\tR\bprotocol\x12\x14\n" +
+	"\x05state\x18\x05 \x01(\tR\x05state\x12\x1a\n" +
+	"\brestarts\x18\x06 \x01(\x05R\brestarts\x12\x16\n" +
+	"\x06health\x18\a \x01(\tR\x06health\x12\x1a\n" +
+	"\bliveness\x18\b \x01(\tR\bliveness\x12\x1d\n" +
+	"\n" +
+	"last_error\x18\t \x01(\tR\tlastError\x129\n" +
+	"\n" +
+	"updated_at\x18\n" +
+	" \x01(\v2\x1a.google.protobuf.TimestampR\tupdatedAt\x12:\n" +
+	"\vconnect_p50\x18\v \x01(\v2\x19.google.protobuf.DurationR\n" +
+	"connectP50\x12:\n" +
+	"\vconnect_p95\x18\f \x01(\v2\x19.google.protobuf.DurationR\n" +
+	"connectP95\x122\n" +
+	"\artt_p50\x18\r \x01(\v2\x19.google.protobuf.DurationR\x06rttP50\x122\n" +
+	"\artt_p95\x18\x0e \x01(\v2\x19.google.protobuf.DurationR\x06rttP952\xa6\x03\n" +
+	"\aControl\x12\\\n" +
+	"\vListTunnels\x12%.devcli.control.v1.ListTunnelsRequest\x1a&.devcli.control.v1.ListTunnelsResponse\x12J\n" +
+	"\vStartTunnel\x12 .devcli.control.v1.TunnelRequest\x1a\x19.devcli.control.v1.Tunnel\x12I\n" +
+	"\n" +
+	"StopTunnel\x12 .devcli.control.v1.TunnelRequest\x1a\x19.devcli.control.v1.Tunnel\x12L\n" +
+	"\rRestartTunnel\x12 .devcli.control.v1.TunnelRequest\x1a\x19.devcli.control.v1.Tunnel\x12X\n" +
+	"\fWatchTunnels\x12&.devcli.control.v1.WatchTunnelsRequest\x1a\x1e.devcli.control.v1.TunnelEvent0\x01B>Z<github.com/okcredit/devcli/proto/devcli/control/v1;controlv1b\x06proto3"
+
+var (
+	file_devcli_control_v1_control_proto_rawDescOnce sync.Once
+	file_devcli_control_v1_control_proto_rawDescData []byte
+)
+
+func file_devcli_control_v1_control_proto_rawDescGZIP() []byte {
+	file_devcli_control_v1_control_proto_rawDescOnce.Do(func() {
+		file_devcli_control_v1_control_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_devcli_control_v1_control_proto_rawDesc), len(file_devcli_control_v1_control_proto_rawDesc)))
+	})
+	return file_devcli_control_v1_control_proto_rawDescData
+}
+
+var file_devcli_control_v1_control_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_devcli_control_v1_control_proto_goTypes = []any{
+	(*ListTunnelsRequest)(nil),    // 0: devcli.control.v1.ListTunnelsRequest
+	(*ListTunnelsResponse)(nil),   // 1: devcli.control.v1.ListTunnelsResponse
+	(*TunnelRequest)(nil),         // 2: devcli.control.v1.TunnelRequest
+	(*WatchTunnelsRequest)(nil),   // 3: devcli.control.v1.WatchTunnelsRequest
+	(*TunnelEvent)(nil),           // 4: devcli.control.v1.TunnelEvent
+	(*Tunnel)(nil),                // 5: devcli.control.v1.Tunnel
+	(*timestamppb.Timestamp)(nil), // 6: google.protobuf.Timestamp
+	(*durationpb.Duration)(nil),   // 7: google.protobuf.Duration
+}
+var file_devcli_control_v1_control_proto_depIdxs = []int32{
+	5,  // 0: devcli.control.v1.ListTunnelsResponse.tunnels:type_name -> devcli.control.v1.Tunnel
+	5,  // 1: devcli.control.v1.TunnelEvent.tunnel:type_name -> devcli.control.v1.Tunnel
+	6,  // 2: devcli.control.v1.Tunnel.updated_at:type_name -> google.protobuf.Timestamp
+	7,  // 3: devcli.control.v1.Tunnel.connect_p50:type_name -> google.protobuf.Duration
+	7,  // 4: devcli.control.v1.Tunnel.connect_p95:type_name -> google.protobuf.Duration
+	7,  // 5: devcli.control.v1.Tunnel.rtt_p50:type_name -> google.protobuf.Duration
+	7,  // 6: devcli.control.v1.Tunnel.rtt_p95:type_name -> google.protobuf.Duration
+	0,  // 7: devcli.control.v1.Control.ListTunnels:input_type -> devcli.control.v1.ListTunnelsRequest
+	2,  // 8: devcli.control.v1.Control.StartTunnel:input_type -> devcli.control.v1.TunnelRequest
+	2,  // 9: devcli.control.v1.Control.StopTunnel:input_type -> devcli.control.v1.TunnelRequest
+	2,  // 10: devcli.control.v1.Control.RestartTunnel:input_type -> devcli.control.v1.TunnelRequest
+	3,  // 11: devcli.control.v1.Control.WatchTunnels:input_type -> devcli.control.v1.WatchTunnelsRequest
+	1,  // 12: devcli.control.v1.Control.ListTunnels:output_type -> devcli.control.v1.ListTunnelsResponse
+	5,  // 13: devcli.control.v1.Control.StartTunnel:output_type -> devcli.control.v1.Tunnel
+	5,  // 14: devcli.control.v1.Control.StopTunnel:output_type -> devcli.control.v1.Tunnel
+	5,  // 15: devcli.control.v1.Control.RestartTunnel:output_type -> devcli.control.v1.Tunnel
+	4,  // 16: devcli.control.v1.Control.WatchTunnels:output_type -> devcli.control.v1.TunnelEvent
+	12, // [12:17] is the sub-list for method output_type
+	7,  // [7:12] is the sub-list for method input_type
+	7,  // [7:7] is the sub-list for extension type_name
+	7,  // [7:7] is the sub-list for extension extendee
+	0,  // [0:7] is the sub-list for field type_name
+}
+
+func init() { file_devcli_control_v1_control_proto_init() }
+func file_devcli_control_v1_control_proto_init() {
+	if File_devcli_control_v1_control_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_devcli_control_v1_control_proto_rawDesc), len(file_devcli_control_v1_control_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   6,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_devcli_control_v1_control_proto_goTypes,
+		DependencyIndexes: file_devcli_control_v1_control_proto_depIdxs,
+		MessageInfos:      file_devcli_control_v1_control_proto_msgTypes,
+	}.Build()
+	File_devcli_control_v1_control_proto = out.File
+	file_devcli_control_v1_control_proto_goTypes = nil
+	file_devcli_control_v1_control_proto_depIdxs = nil
+}
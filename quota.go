@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// quotaWindow is the period the API calls are counted over, the period of the gcloud
+	// per-minute quotas
+	quotaWindow = time.Minute
+	// quotaThreshold is the share of a quota from which reconnections are throttled
+	quotaThreshold = 0.8
+)
+
+// APIQuota are the calls per minute allowed to the project by service, e.g. compute: 600.
+// Reconnections are throttled when the calls of the session near a quota.
+type APIQuota map[string]int
+
+// validate checks that the quotas are positive
+func (q APIQuota) validate() error {
+	for service, limit := range q {
+		if limit <= 0 {
+			return fmt.Errorf("api_quota of %s must be positive, got %d", service, limit)
+		}
+	}
+	return nil
+}
+
+// localGcloudGroups are the gcloud command groups that do not call a Google API
+var localGcloudGroups = []string{"config", "components", "info", "version", "help", "topic"}
+
+// apiService returns the Google API service the command calls, e.g. compute for gcloud
+// compute ssh or a request to the Compute Engine API, empty for the other commands
+func apiService(cmd *exec.Cmd) string {
+	if len(cmd.Args) == 0 {
+		return ""
+	}
+	if filepath.Base(cmd.Args[0]) == "gcloud" {
+		for _, arg := range cmd.Args[1:] {
+			if strings.HasPrefix(arg, "-") || arg == "alpha" || arg == "beta" {
+				continue
+			}
+			if slices.Contains(localGcloudGroups, arg) {
+				return ""
+			}
+			return arg
+		}
+		return ""
+	}
+	// the requests of googleAPI are recorded as their method and URL
+	if len(cmd.Args) == 2 {
+		switch {
+		case strings.HasPrefix(cmd.Args[1], computeURL):
+			return "compute"
+		case strings.HasPrefix(cmd.Args[1], containerURL):
+			return "container"
+		}
+	}
+	return ""
+}
+
+// apiCallRate is the number of calls to a service within the last minute
+type apiCallRate struct {
+	Service string `json:"service" yaml:"service"`
+	Calls   int    `json:"calls" yaml:"calls"`
+	// Limit is the configured quota of the service, 0 when none is
+	Limit int `json:"limit" yaml:"limit"`
+}
+
+// near reports whether the calls reached the share of the quota throttling reconnections
+func (r apiCallRate) near() bool {
+	return r.Limit > 0 && float64(r.Calls) >= quotaThreshold*float64(r.Limit)
+}
+
+func (r apiCallRate) String() string {
+	if r.Limit == 0 {
+		return fmt.Sprintf("%s %d", r.Service, r.Calls)
+	}
+	if r.near() {
+		return fmt.Sprintf("%s %d/%d (near the quota)", r.Service, r.Calls, r.Limit)
+	}
+	return fmt.Sprintf("%s %d/%d", r.Service, r.Calls, r.Limit)
+}
+
+// writeAPICalls prints the calls of a session to the Google APIs on one line, nothing when
+// it did not call any
+func writeAPICalls(w io.Writer, rates []apiCallRate) {
+	if len(rates) == 0 {
+		return
+	}
+	parts := make([]string, 0, len(rates))
+	for _, rate := range rates {
+		parts = append(parts, rate.String())
+	}
+	fmt.Fprintf(w, "API calls in the last minute: %s\n", strings.Join(parts, ", "))
+}
+
+// apiUsage counts the calls of the session to the Google APIs, by gcloud or directly,
+// within the last minute
+type apiUsage struct {
+	mu     sync.Mutex
+	calls  map[string][]time.Time
+	limits APIQuota
+}
+
+// apiCalls is the usage of the session, every external command is counted by commandStarted
+var apiCalls = newAPIUsage()
+
+func newAPIUsage() *apiUsage {
+	return &apiUsage{calls: make(map[string][]time.Time)}
+}
+
+// setLimits sets the quotas the reconnections are throttled by
+func (u *apiUsage) setLimits(limits APIQuota) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.limits = limits
+}
+
+// record counts the command started at now if it calls a Google API
+func (u *apiUsage) record(cmd *exec.Cmd, now time.Time) {
+	service := apiService(cmd)
+	if service == "" {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.calls[service] = append(u.prune(service, now), now)
+}
+
+// prune drops the calls to the service older than the window, the caller holds the lock
+func (u *apiUsage) prune(service string, now time.Time) []time.Time {
+	calls := u.calls[service]
+	i := 0
+	for i < len(calls) && now.Sub(calls[i]) >= quotaWindow {
+		i++
+	}
+	calls = calls[i:]
+	u.calls[service] = calls
+	return calls
+}
+
+// rates returns the calls of every service called or with a quota within the last minute,
+// by service name
+func (u *apiUsage) rates(now time.Time) []apiCallRate {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	services := make(map[string]bool)
+	for service := range u.calls {
+		services[service] = true
+	}
+	for service := range u.limits {
+		services[service] = true
+	}
+	rates := make([]apiCallRate, 0, len(services))
+	for service := range services {
+		rates = append(rates, apiCallRate{Service: service, Calls: len(u.prune(service, now)), Limit: u.limits[service]})
+	}
+	slices.SortFunc(rates, func(a, b apiCallRate) int { return strings.Compare(a.Service, b.Service) })
+	return rates
+}
+
+// throttle returns how long to wait until the calls of every service with a quota are
+// below the threshold again, and the rate of the service waited for. It is 0 when no
+// quota is near.
+func (u *apiUsage) throttle(now time.Time) (time.Duration, apiCallRate) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	var wait time.Duration
+	var waitedFor apiCallRate
+	for service, limit := range u.limits {
+		calls := u.prune(service, now)
+		rate := apiCallRate{Service: service, Calls: len(calls), Limit: limit}
+		if !rate.near() {
+			continue
+		}
+		// the calls leave the window oldest first, until fewer than the threshold are left
+		allowed := max(int(math.Ceil(quotaThreshold*float64(limit)))-1, 0)
+		if d := calls[len(calls)-1-allowed].Add(quotaWindow).Sub(now); d > wait {
+			wait, waitedFor = d, rate
+		}
+	}
+	return wait, waitedFor
+}
+
+// waitQuota delays the reconnection of the tunnel while the session's calls near a quota,
+// it returns false when the context ends first
+func waitQuota(ctx context.Context, name string) bool {
+	wait, rate := apiCalls.throttle(time.Now())
+	if wait <= 0 {
+		return true
+	}
+	fmt.Printf("Warning: %d %s calls in the last minute, near the quota of %d, delaying the restart of tunnel %s by %s\n",
+		rate.Calls, rate.Service, rate.Limit, name, wait.Round(time.Second))
+	return sleepContext(ctx, wait)
+}
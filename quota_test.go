@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPIService(t *testing.T) {
+	for _, tc := range []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"gcloud", "compute", "ssh", "bastion", "--tunnel-through-iap"}, "compute"},
+		{[]string{"/usr/bin/gcloud", "--quiet", "beta", "container", "clusters", "list"}, "container"},
+		{[]string{"gcloud", "config", "set", "project", "okcredit-42"}, ""},
+		{[]string{"kubectl", "get", "pods"}, ""},
+		{[]string{"GET", computeURL + "/compute/v1/projects/okcredit-42/aggregated/instances"}, "compute"},
+		{[]string{"POST", "https://oauth2.googleapis.com/token"}, ""},
+	} {
+		if got := apiService(&exec.Cmd{Args: tc.args}); got != tc.expected {
+			t.Errorf("apiService(%v) failed: expected %q, got %q", tc.args, tc.expected, got)
+		}
+	}
+}
+
+func TestAPIUsage(t *testing.T) {
+	usage := newAPIUsage()
+	usage.setLimits(APIQuota{"compute": 10})
+	ssh := &exec.Cmd{Args: []string{"gcloud", "compute", "ssh", "bastion"}}
+	start := time.Now()
+	for i := range 8 {
+		usage.record(ssh, start.Add(time.Duration(i)*time.Second))
+	}
+	usage.record(&exec.Cmd{Args: []string{"gcloud", "container", "clusters", "list"}}, start)
+	usage.record(&exec.Cmd{Args: []string{"kubectl", "port-forward"}}, start)
+
+	now := start.Add(10 * time.Second)
+	rates := usage.rates(now)
+	if len(rates) != 2 || rates[0] != (apiCallRate{Service: "compute", Calls: 8, Limit: 10}) || rates[1] != (apiCallRate{Service: "container", Calls: 1}) {
+		t.Fatalf("apiUsage.rates failed: unexpected rates %+v", rates)
+	}
+	// 8 calls reach 80% of the quota, the first one must leave the window
+	if wait, rate := usage.throttle(now); wait != 50*time.Second || rate.Service != "compute" {
+		t.Errorf("apiUsage.throttle failed: expected to wait 50s for compute, got %s for %q", wait, rate.Service)
+	}
+	if wait, _ := usage.throttle(start.Add(time.Minute)); wait != 0 {
+		t.Errorf("apiUsage.throttle failed: expected no wait once the first call is a minute old, got %s", wait)
+	}
+	if rates := usage.rates(start.Add(2 * time.Minute)); rates[0].Calls != 0 || len(rates) != 2 {
+		t.Errorf("apiUsage.rates failed: expected the calls to leave the window, got %+v", rates)
+	}
+
+	var b strings.Builder
+	writeAPICalls(&b, []apiCallRate{{Service: "compute", Calls: 9, Limit: 10}, {Service: "container", Calls: 1}})
+	if b.String() != "API calls in the last minute: compute 9/10 (near the quota), container 1\n" {
+		t.Errorf("writeAPICalls failed: unexpected output %q", b.String())
+	}
+}
+
+func TestAPIQuotaValidate(t *testing.T) {
+	if err := (APIQuota{"compute": 600}).validate(); err != nil {
+		t.Errorf("APIQuota.validate failed: %v", err)
+	}
+	if err := (APIQuota{"compute": 0}).validate(); err == nil {
+		t.Error("APIQuota.validate failed: expected an error for a quota of 0")
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// relayObserver is notified of the traffic flowing through a relay
+type relayObserver interface {
+	connOpened(id int, client net.Addr)
+	connData(id int, fromClient bool, data []byte)
+	connClosed(id int)
+}
+
+// relay owns a tunnel's local port and pipes every connection to the tunnel's child process
+// listening on an internal port. Interposing on the traffic lets devcli observe it (capture)
+// or degrade it (chaos) without the child process knowing.
+type relay struct {
+	// host is the address the relay listens on, listenHost when empty
+	host       string
+	listenPort int
+	// target is the address of targetPort, an internal port when empty
+	target     string
+	targetPort int
+	observer   relayObserver
+	chaos      *ChaosRule
+	// limit bounds the connections open at once, when set
+	limit *connectionLimit
+	// draining stops accepting connections when closed, the open ones are relayed until the
+	// context is canceled
+	draining <-chan struct{}
+}
+
+// run accepts connections until the context is canceled or the relay drains, and returns
+// once the connections are closed
+func (r *relay) run(ctx context.Context) error {
+	host := r.host
+	if host == "" {
+		host = listenHost
+	}
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(r.listenPort)))
+	if err != nil {
+		return err
+	}
+	var closed atomic.Bool
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-r.draining:
+		}
+		closed.Store(true)
+		listener.Close()
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for id := 1; ; id++ {
+		client, err := listener.Accept()
+		if err != nil {
+			if closed.Load() {
+				return nil
+			}
+			return err
+		}
+		if r.chaos != nil && r.chaos.drops() {
+			client.Close()
+			continue
+		}
+		wg.Add(1)
+		go func(id int, client net.Conn) {
+			defer wg.Done()
+			if r.limit != nil {
+				if !r.limit.acquire(ctx) {
+					client.Close()
+					return
+				}
+				defer r.limit.release()
+			}
+			r.relayConn(ctx, id, client)
+		}(id, client)
+	}
+}
+
+// relayConn pipes one client connection to the target port in both directions
+func (r *relay) relayConn(ctx context.Context, id int, client net.Conn) {
+	defer client.Close()
+	target := r.target
+	if target == "" {
+		target = internalAddress(r.targetPort)
+	}
+	upstream, err := net.Dial("tcp", target)
+	if err != nil {
+		fmt.Printf("Error relaying connection to local port %d: %v\n", r.targetPort, err)
+		return
+	}
+	defer upstream.Close()
+
+	if r.observer != nil {
+		r.observer.connOpened(id, client.RemoteAddr())
+		defer r.observer.connClosed(id)
+	}
+
+	done := make(chan error, 2)
+	pipe := func(dst, src net.Conn, fromClient bool) {
+		_, err := io.Copy(dst, &observedReader{reader: src, id: id, fromClient: fromClient, relay: r})
+		if tcp, ok := dst.(*net.TCPConn); ok {
+			tcp.CloseWrite()
+		}
+		done <- err
+	}
+	go pipe(upstream, client, true)
+	go pipe(client, upstream, false)
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-done:
+			if err == errChaosReset {
+				resetConn(client)
+				resetConn(upstream)
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// observedReader reports everything read from the underlying connection to the relay's
+// observer, and applies the relay's fault injection rule
+type observedReader struct {
+	reader     io.Reader
+	id         int
+	fromClient bool
+	relay      *relay
+}
+
+func (r *observedReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		if chaos := r.relay.chaos; chaos != nil {
+			if chaos.resets() {
+				return 0, errChaosReset
+			}
+			chaos.delay()
+		}
+		if r.relay.observer != nil {
+			r.relay.observer.connData(r.id, r.fromClient, p[:n])
+		}
+	}
+	return n, err
+}
+
+// resetConn closes a connection with an RST instead of a FIN
+func resetConn(conn net.Conn) {
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.SetLinger(0)
+	}
+	conn.Close()
+}
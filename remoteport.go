@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// exposedPort is a TCP port a pod or Service exposes
+type exposedPort struct {
+	Port int
+	Name string
+}
+
+func (p exposedPort) String() string {
+	if p.Name == "" {
+		return strconv.Itoa(p.Port)
+	}
+	return fmt.Sprintf("%d (%s)", p.Port, p.Name)
+}
+
+// containerPortsArgs are the kubectl arguments printing the container ports of the pod as
+// port/protocol/name
+func containerPortsArgs(workload Workload, podName string) []string {
+	return []string{"get", "pod", podName, "-n", workload.Namespace, "-o", `jsonpath={range .spec.containers[*].ports[*]}{.containerPort}/{.protocol}/{.name}{" "}{end}`}
+}
+
+// servicePortsArgs are the kubectl arguments printing the ports of the workload's Service
+// as target port/protocol/name/port
+func servicePortsArgs(workload Workload) []string {
+	return []string{"get", "service", workload.App, "-n", workload.Namespace, "-o", `jsonpath={range .spec.ports[*]}{.targetPort}/{.protocol}/{.name}/{.port}{" "}{end}`}
+}
+
+// parseExposedPorts returns the TCP ports of the output of containerPortsArgs or
+// servicePortsArgs. A Service port whose target port is named is skipped, as the name only
+// resolves in the pod's spec.
+func parseExposedPorts(out string) []exposedPort {
+	var ports []exposedPort
+	for _, field := range strings.Fields(out) {
+		parts := strings.Split(field, "/")
+		if len(parts) < 3 || (parts[1] != "" && parts[1] != "TCP") {
+			continue
+		}
+		port, err := strconv.Atoi(parts[0])
+		if err != nil && len(parts) == 4 && parts[0] == "" {
+			// a Service port without a target port forwards to the same port
+			port, err = strconv.Atoi(parts[3])
+		}
+		if err != nil || port <= 0 {
+			continue
+		}
+		ports = append(ports, exposedPort{Port: port, Name: parts[2]})
+	}
+	return ports
+}
+
+// podPorts returns the TCP ports of the pod's containers, like parseExposedPorts the
+// output of containerPortsArgs
+func podPorts(pod *corev1.Pod) []exposedPort {
+	var ports []exposedPort
+	for _, container := range pod.Spec.Containers {
+		for _, port := range container.Ports {
+			if (port.Protocol == "" || port.Protocol == corev1.ProtocolTCP) && port.ContainerPort > 0 {
+				ports = append(ports, exposedPort{Port: int(port.ContainerPort), Name: port.Name})
+			}
+		}
+	}
+	return ports
+}
+
+// servicePorts returns the TCP target ports of the Service, like parseExposedPorts the
+// output of servicePortsArgs
+func servicePorts(service *corev1.Service) []exposedPort {
+	var ports []exposedPort
+	for _, port := range service.Spec.Ports {
+		if port.Protocol != "" && port.Protocol != corev1.ProtocolTCP {
+			continue
+		}
+		target := int(port.Port)
+		if port.TargetPort.Type == intstr.String {
+			continue
+		}
+		if port.TargetPort.IntVal > 0 {
+			target = int(port.TargetPort.IntVal)
+		}
+		if target > 0 {
+			ports = append(ports, exposedPort{Port: target, Name: port.Name})
+		}
+	}
+	return ports
+}
+
+// detectRemotePort returns the single TCP port of the workload's pod, or else of the
+// Service named after its app, for workloads without remote_port
+func detectRemotePort(ctx context.Context, runner *commandRunner, workload Workload, podName string) (int, error) {
+	client, err := kubeAPI.client(workload.kubeContext)
+	if err != nil {
+		return 0, err
+	}
+	pod, err := client.getPod(ctx, runner, workload.Namespace, podName)
+	if err != nil {
+		return 0, fmt.Errorf("getting the ports of pod %s of workload %s: %w", podName, workload.Name(), err)
+	}
+	source := "pod " + podName
+	ports := podPorts(pod)
+	if len(ports) == 0 && workload.App != "" {
+		if service, err := client.getService(ctx, runner, workload.Namespace, workload.App); err == nil {
+			source = "service " + workload.App
+			ports = servicePorts(service)
+		}
+	}
+	switch len(ports) {
+	case 0:
+		exposing := fmt.Sprintf("pod %s exposes no TCP port", podName)
+		if workload.App != "" {
+			exposing = fmt.Sprintf("neither pod %s nor service %s exposes a TCP port", podName, workload.App)
+		}
+		return 0, fmt.Errorf("workload %s has no remote_port and %s; set remote_port in the configuration file", workload.Name(), exposing)
+	case 1:
+		narratef("Using port %s of %s for workload %s\n", ports[0], source, workload.Name())
+		return ports[0].Port, nil
+	}
+	var names []string
+	for _, port := range ports {
+		names = append(names, port.String())
+	}
+	return 0, fmt.Errorf("workload %s has no remote_port and %s exposes ports %s; set remote_port to one of them in the configuration file", workload.Name(), source, strings.Join(names, ", "))
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestParseExposedPorts(t *testing.T) {
+	for _, tc := range []struct {
+		out      string
+		expected []exposedPort
+	}{
+		{"8080/TCP/http ", []exposedPort{{8080, "http"}}},
+		{"8080/TCP/http 9090/TCP/grpc 5353/UDP/dns ", []exposedPort{{8080, "http"}, {9090, "grpc"}}},
+		{"8080// ", []exposedPort{{8080, ""}}},
+		// Service ports: a named target port is skipped, a missing one is the port itself
+		{"http/TCP/web/80 /TCP/metrics/9100 ", []exposedPort{{9100, "metrics"}}},
+		{"", nil},
+	} {
+		if got := parseExposedPorts(tc.out); !slices.Equal(got, tc.expected) {
+			t.Errorf("parseExposedPorts(%q) failed: expected %v, got %v", tc.out, tc.expected, got)
+		}
+	}
+}
+
+// portsPod returns the pod of the app exposing the container ports
+func portsPod(name, app string, ports ...corev1.ContainerPort) corev1.Pod {
+	pod := testPod(name, app, 0, corev1.PodRunning, true)
+	pod.Spec.Containers = []corev1.Container{{Name: app, Ports: ports}}
+	return pod
+}
+
+func TestServicePorts(t *testing.T) {
+	service := &corev1.Service{Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{
+		{Name: "web", Port: 80, TargetPort: intstr.FromString("http")},
+		{Name: "metrics", Port: 9100},
+		{Name: "api", Port: 80, TargetPort: intstr.FromInt32(8081), Protocol: corev1.ProtocolTCP},
+		{Name: "dns", Port: 53, Protocol: corev1.ProtocolUDP},
+	}}}
+	// a named target port is skipped, a missing one is the port itself
+	if got, expected := servicePorts(service), []exposedPort{{9100, "metrics"}, {8081, "api"}}; !slices.Equal(got, expected) {
+		t.Errorf("servicePorts failed: expected %v, got %v", expected, got)
+	}
+	pod := portsPod("ledger-1", "ledger", corev1.ContainerPort{Name: "http", ContainerPort: 8080}, corev1.ContainerPort{Name: "dns", ContainerPort: 5353, Protocol: corev1.ProtocolUDP})
+	if got, expected := podPorts(&pod), []exposedPort{{8080, "http"}}; !slices.Equal(got, expected) {
+		t.Errorf("podPorts failed: expected %v, got %v", expected, got)
+	}
+}
+
+func TestDetectRemotePort(t *testing.T) {
+	// pods of one, two and no ports, and a Service for the pod without ports
+	startFakeCluster(t, &fakeCluster{
+		pods: []corev1.Pod{
+			portsPod("cashfree-1", "cashfree", corev1.ContainerPort{Name: "http", ContainerPort: 8080, Protocol: corev1.ProtocolTCP}),
+			portsPod("ledger-1", "ledger", corev1.ContainerPort{Name: "http", ContainerPort: 8080}, corev1.ContainerPort{Name: "grpc", ContainerPort: 9090}),
+			portsPod("refunds-1", "refunds"),
+		},
+		services: []corev1.Service{{
+			TypeMeta:   metav1.TypeMeta{Kind: "Service", APIVersion: "v1"},
+			ObjectMeta: metav1.ObjectMeta{Name: "refunds", Namespace: "enr"},
+			Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 80, TargetPort: intstr.FromInt32(8081)}}},
+		}},
+	})
+	runner := newCommandRunner(2, 0)
+	ctx := context.Background()
+
+	if port, err := detectRemotePort(ctx, runner, Workload{Namespace: "enr", App: "cashfree"}, "cashfree-1"); err != nil || port != 8080 {
+		t.Errorf("detectRemotePort failed: expected the port of the pod, got %d, %v", port, err)
+	}
+	if port, err := detectRemotePort(ctx, runner, Workload{Namespace: "enr", App: "refunds"}, "refunds-1"); err != nil || port != 8081 {
+		t.Errorf("detectRemotePort failed: expected the target port of the service, got %d, %v", port, err)
+	}
+	_, err := detectRemotePort(ctx, runner, Workload{Namespace: "enr", App: "ledger"}, "ledger-1")
+	if err == nil || !strings.Contains(err.Error(), "8080 (http), 9090 (grpc)") {
+		t.Errorf("detectRemotePort failed: expected the ambiguous ports to be listed, got %v", err)
+	}
+	_, err = detectRemotePort(ctx, runner, Workload{Namespace: "enr", App: "none"}, "refunds-1")
+	if err == nil || !strings.Contains(err.Error(), "set remote_port") {
+		t.Errorf("detectRemotePort failed: expected a missing port to be reported, got %v", err)
+	}
+}
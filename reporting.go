@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/user"
+	"slices"
+	"strings"
+	"time"
+)
+
+// bigQueryURL is the BigQuery API session events are inserted with
+var bigQueryURL = "https://bigquery.googleapis.com/bigquery/v2"
+
+// reportTimeout is how long sending a session event may take
+const reportTimeout = 10 * time.Second
+
+// Reporting sends the start and stop of sessions to an endpoint or BigQuery table of the
+// platform team, the audit trail of who tunneled into which environment and when
+type Reporting struct {
+	// URL receives every event as a JSON POST
+	URL string `yaml:"url"`
+	// BigQuery is the table events are inserted into, as project.dataset.table
+	BigQuery string `yaml:"bigquery"`
+	// Environments are the reported environments, every one when empty
+	Environments []string `yaml:"environments"`
+}
+
+// enabled reports whether the sessions of the environment are reported
+func (r Reporting) enabled(environment string) bool {
+	if r.URL == "" && r.BigQuery == "" {
+		return false
+	}
+	return len(r.Environments) == 0 || slices.Contains(r.Environments, environment)
+}
+
+// validate checks the endpoint and table of the reporting
+func (r Reporting) validate() error {
+	if r.URL != "" && !strings.HasPrefix(r.URL, "https://") && !strings.HasPrefix(r.URL, "http://") {
+		return fmt.Errorf("reporting url %q is not an http(s) URL", r.URL)
+	}
+	if r.BigQuery != "" && len(strings.Split(r.BigQuery, ".")) != 3 {
+		return fmt.Errorf("reporting bigquery %q is not a table like project.dataset.table", r.BigQuery)
+	}
+	return nil
+}
+
+// sessionEvent is a reported start or stop of a session, a row of the BigQuery table
+type sessionEvent struct {
+	Event       string    `json:"event"`
+	SessionID   string    `json:"session_id"`
+	Time        time.Time `json:"time"`
+	User        string    `json:"user"`
+	Account     string    `json:"account,omitempty"`
+	Host        string    `json:"host"`
+	Environment string    `json:"environment"`
+	Tunnels     []string  `json:"tunnels"`
+	// DurationSeconds is how long the session ran, in stop events
+	DurationSeconds float64 `json:"duration_seconds,omitempty"`
+}
+
+// sessionReporter reports the events of a session
+type sessionReporter struct {
+	config  Reporting
+	session sessionEvent
+	started time.Time
+	// token returns the access token BigQuery is called with
+	token func(ctx context.Context) (string, error)
+}
+
+// newSessionReporter returns the reporter of the session with its user, gcloud account and
+// tunnels
+func newSessionReporter(config Reporting, proxyConfig ProxyConfig, account string, token func(ctx context.Context) (string, error)) *sessionReporter {
+	id := make([]byte, 8)
+	rand.Read(id)
+	session := sessionEvent{SessionID: hex.EncodeToString(id), Account: account, Environment: proxyConfig.Environment}
+	if current, err := user.Current(); err == nil {
+		session.User = current.Username
+	}
+	session.Host, _ = os.Hostname()
+	session.Tunnels = sessionTunnels(proxyConfig)
+	return &sessionReporter{config: config, session: session, token: token}
+}
+
+// sessionTunnels returns the names of the tunnels of the session
+func sessionTunnels(proxyConfig ProxyConfig) []string {
+	var tunnels []string
+	for _, workload := range proxyConfig.Workloads {
+		tunnels = append(tunnels, workload.Name())
+	}
+	for _, connection := range proxyConfig.Bastion.Connections {
+		tunnels = append(tunnels, connection.Name())
+	}
+	if proxyConfig.APIProxy.enabled() {
+		tunnels = append(tunnels, apiProxyName)
+	}
+	return tunnels
+}
+
+// gcloudAccount returns the account gcloud is logged in with, empty when it is unknown
+func gcloudAccount(ctx context.Context, runner *commandRunner) string {
+	cmd := exec.CommandContext(ctx, "gcloud", "config", "get-value", "account")
+	cmd.Stderr = narrationWriter("gcloud")
+	out, err := runner.output(ctx, cmd)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// start reports the start of the session
+func (r *sessionReporter) start(ctx context.Context) {
+	r.started = time.Now()
+	event := r.session
+	event.Event = "start"
+	event.Time = r.started.UTC()
+	r.send(ctx, event)
+}
+
+// stop reports the end of the session and how long it ran
+func (r *sessionReporter) stop(ctx context.Context) {
+	event := r.session
+	event.Event = "stop"
+	event.Time = time.Now().UTC()
+	event.DurationSeconds = time.Since(r.started).Round(time.Second).Seconds()
+	r.send(ctx, event)
+}
+
+// send delivers the event to the endpoint and the table. A failure is only warned about,
+// reporting never stops a session.
+func (r *sessionReporter) send(ctx context.Context, event sessionEvent) {
+	ctx, cancel := context.WithTimeout(ctx, reportTimeout)
+	defer cancel()
+	if r.config.URL != "" {
+		if err := postJSON(ctx, r.config.URL, "", event, nil); err != nil {
+			fmt.Printf("Warning: reporting the session %s to %s failed: %v\n", event.Event, r.config.URL, err)
+		}
+	}
+	if r.config.BigQuery != "" {
+		if err := r.insertBigQuery(ctx, event); err != nil {
+			fmt.Printf("Warning: reporting the session %s to BigQuery table %s failed: %v\n", event.Event, r.config.BigQuery, err)
+		}
+	}
+}
+
+// insertBigQuery streams the event into the BigQuery table
+func (r *sessionReporter) insertBigQuery(ctx context.Context, event sessionEvent) error {
+	token, err := r.token(ctx)
+	if err != nil {
+		return err
+	}
+	table := strings.Split(r.config.BigQuery, ".")
+	if len(table) != 3 {
+		return fmt.Errorf("bigquery %q is not a table like project.dataset.table", r.config.BigQuery)
+	}
+	url := fmt.Sprintf("%s/projects/%s/datasets/%s/tables/%s/insertAll", bigQueryURL, table[0], table[1], table[2])
+	body := map[string]interface{}{
+		"rows": []map[string]interface{}{{"insertId": event.SessionID + "-" + event.Event, "json": event}},
+	}
+	var response struct {
+		InsertErrors []struct {
+			Errors []struct {
+				Message string `json:"message"`
+			} `json:"errors"`
+		} `json:"insertErrors"`
+	}
+	if err := postJSON(ctx, url, token, body, &response); err != nil {
+		return err
+	}
+	for _, insertError := range response.InsertErrors {
+		if len(insertError.Errors) > 0 {
+			return fmt.Errorf("row rejected: %s", insertError.Errors[0].Message)
+		}
+	}
+	return nil
+}
+
+// postJSON posts the body as JSON, with the bearer token unless it is empty, and decodes
+// the response into out unless it is nil
+func postJSON(ctx context.Context, url, token string, body, out interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
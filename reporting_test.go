@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestSessionReporter(t *testing.T) {
+	var mu sync.Mutex
+	var events []sessionEvent
+	var rows []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/sessions":
+			var event sessionEvent
+			json.NewDecoder(r.Body).Decode(&event)
+			events = append(events, event)
+		case "/projects/okcredit-platform/datasets/devcli/tables/sessions/insertAll":
+			if r.Header.Get("Authorization") != "Bearer token" {
+				http.Error(w, "unauthenticated", http.StatusUnauthorized)
+				return
+			}
+			var body struct {
+				Rows []struct {
+					InsertID string `json:"insertId"`
+				} `json:"rows"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			for _, row := range body.Rows {
+				rows = append(rows, row.InsertID)
+			}
+			w.Write([]byte(`{}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	defer func(url string) { bigQueryURL = url }(bigQueryURL)
+	bigQueryURL = server.URL
+
+	config := Reporting{URL: server.URL + "/sessions", BigQuery: "okcredit-platform.devcli.sessions", Environments: []string{"prod"}}
+	if config.enabled("staging") || !config.enabled("prod") {
+		t.Errorf("enabled failed: expected only prod to be reported")
+	}
+	proxyConfig := ProxyConfig{
+		Environment: "prod",
+		Workloads:   []Workload{{App: "cashfree"}},
+		Bastion:     Bastion{Connections: []Connection{{RemoteHost: "10.120.52.48", RemotePort: 5432}}},
+	}
+	token := func(context.Context) (string, error) { return "token", nil }
+	reporter := newSessionReporter(config, proxyConfig, "dev@okcredit.in", token)
+	reporter.start(context.Background())
+	reporter.stop(context.Background())
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 2 || events[0].Event != "start" || events[1].Event != "stop" {
+		t.Fatalf("sessionReporter failed: expected a start and a stop event, got %+v", events)
+	}
+	start := events[0]
+	if start.Account != "dev@okcredit.in" || start.Environment != "prod" || len(start.Tunnels) != 2 || start.SessionID != events[1].SessionID {
+		t.Errorf("sessionReporter failed: unexpected start event %+v", start)
+	}
+	if len(rows) != 2 || rows[0] != start.SessionID+"-start" {
+		t.Errorf("sessionReporter failed: unexpected BigQuery rows %v", rows)
+	}
+
+	// a table that was not validated is refused instead of panicking
+	malformed := newSessionReporter(Reporting{BigQuery: "devcli.sessions"}, proxyConfig, "dev@okcredit.in", token)
+	if err := malformed.insertBigQuery(context.Background(), sessionEvent{Event: "start"}); err == nil {
+		t.Error("insertBigQuery failed: expected an error for a table without a project")
+	}
+}
+
+func TestReportingValidate(t *testing.T) {
+	for _, tc := range []struct {
+		reporting Reporting
+		valid     bool
+	}{
+		{Reporting{}, true},
+		{Reporting{URL: "https://devcli-sessions.okcredit.in/v1/sessions"}, true},
+		{Reporting{URL: "devcli-sessions.okcredit.in"}, false},
+		{Reporting{BigQuery: "okcredit-platform.devcli.sessions"}, true},
+		{Reporting{BigQuery: "devcli.sessions"}, false},
+	} {
+		if err := tc.reporting.validate(); (err == nil) != tc.valid {
+			t.Errorf("validate(%+v) failed: expected valid %v, got %v", tc.reporting, tc.valid, err)
+		}
+	}
+}
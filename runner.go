@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// localCommandTimeout bounds quick local commands such as lsof and tool version checks
+const localCommandTimeout = 10 * time.Second
+
+// retryBaseDelay is the wait before the first retry of a transient failure, doubled for
+// every further retry up to retryMaxDelay
+var retryBaseDelay = time.Second
+
+const retryMaxDelay = 30 * time.Second
+
+// retryDelay returns the wait before the retry following the 0-based attempt. Up to half of
+// it is random, so that parallel lookups failing together do not retry together. The delay
+// doubles until it reaches the maximum, rather than shifting by the attempt, which overflows
+// with many retries.
+func retryDelay(attempt int) time.Duration {
+	delay := retryBaseDelay
+	for i := 0; i < attempt && delay < retryMaxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, retryMaxDelay)
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// sleepContext waits for the duration, returning false if the context ends first
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// CommandTimeoutError is returned when an external command does not finish in time
+type CommandTimeoutError struct {
+	Command string
+	Timeout time.Duration
+}
+
+func (e *CommandTimeoutError) Error() string {
+	return fmt.Sprintf("timed out after %s running %s", e.Timeout, e.Command)
+}
+
+// rateLimiter is a token bucket: tokens refill at rate per second up to burst
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// reserve takes a token and returns how long the caller has to wait before using it
+func (l *rateLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// wait blocks until a token is available or the context is canceled
+func (l *rateLimiter) wait(ctx context.Context) error {
+	if l == nil || l.rate <= 0 {
+		return nil
+	}
+	delay := l.reserve()
+	if delay == 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// commandRunner executes gcloud and kubectl commands with bounded concurrency and a rate
+// limit, so that sessions with many workloads do not trip the APIs' rate limits. Short-lived
+// commands get a deadline and are retried when they time out.
+type commandRunner struct {
+	slots   chan struct{}
+	limiter *rateLimiter
+	timeout time.Duration
+	retries int
+	// reauthenticate is called when a command fails because the credentials expired, and
+	// returns whether the command should be run again
+	reauthenticate func(ctx context.Context) bool
+}
+
+// newCommandRunner returns a runner allowing concurrency commands at a time and rate
+// command starts per second. A rate of 0 disables rate limiting.
+func newCommandRunner(concurrency int, rate float64) *commandRunner {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &commandRunner{
+		slots:   make(chan struct{}, concurrency),
+		limiter: newRateLimiter(rate, concurrency),
+	}
+}
+
+// withTimeout sets the deadline of short-lived commands and how many times a command that
+// timed out is retried. A timeout of 0 disables the deadline.
+func (r *commandRunner) withTimeout(timeout time.Duration, retries int) *commandRunner {
+	r.timeout = timeout
+	r.retries = retries
+	return r
+}
+
+// acquire waits for a free slot and a rate limit token and returns the function releasing the slot
+func (r *commandRunner) acquire(ctx context.Context) (func(), error) {
+	select {
+	case r.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if err := r.limiter.wait(ctx); err != nil {
+		<-r.slots
+		return nil, err
+	}
+	return func() { <-r.slots }, nil
+}
+
+// run runs a short-lived command within the runner's limits
+func (r *commandRunner) run(ctx context.Context, cmd *exec.Cmd) error {
+	_, err := r.exec(ctx, cmd, false)
+	return err
+}
+
+// output runs a short-lived command within the runner's limits and returns its stdout
+func (r *commandRunner) output(ctx context.Context, cmd *exec.Cmd) ([]byte, error) {
+	return r.exec(ctx, cmd, true)
+}
+
+// exec runs the command, retrying it when it times out or fails with a transient error
+// class. Every short-lived command devcli runs either reads state or idempotently sets it,
+// so running it again is safe.
+func (r *commandRunner) exec(ctx context.Context, cmd *exec.Cmd, capture bool) ([]byte, error) {
+	var out []byte
+	err := r.retry(ctx, func(attempt int) error {
+		if attempt > 0 {
+			cmd = cloneCommand(ctx, cmd)
+		}
+		var err error
+		out, err = r.once(ctx, cmd, capture)
+		return err
+	})
+	return out, err
+}
+
+// call sends a request of the Kubernetes API client within the runner's limits, like a
+// short-lived command: it takes a slot and a rate limit token, gets the runner's timeout,
+// and is retried the same way. Its failure is classified like the command's it replaces.
+func (r *commandRunner) call(ctx context.Context, request string, send func(ctx context.Context) error) error {
+	return r.retry(ctx, func(int) error {
+		release, err := r.acquire(ctx)
+		if err != nil {
+			return err
+		}
+		defer release()
+		callCtx := ctx
+		if r.timeout > 0 {
+			var cancel context.CancelFunc
+			callCtx, cancel = context.WithTimeout(ctx, r.timeout)
+			defer cancel()
+		}
+		err = send(callCtx)
+		if err != nil && ctx.Err() == nil && callCtx.Err() != nil {
+			return &CommandTimeoutError{Command: request, Timeout: r.timeout}
+		}
+		return newKubeError(request, err)
+	})
+}
+
+// retry runs the attempt until it succeeds, retrying it when it times out or fails with a
+// transient error class, and once more after logging in again when the credentials expired
+func (r *commandRunner) retry(ctx context.Context, run func(attempt int) error) error {
+	reauthenticated := false
+	for attempt, runs := 0, 0; ; attempt, runs = attempt+1, runs+1 {
+		err := run(runs)
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+		var timeoutErr *CommandTimeoutError
+		class := errorClass(err)
+		switch {
+		case class == ClassAuthExpired && !reauthenticated && r.reauthenticate != nil:
+			// the credentials expired, ask the user to log in again instead of failing
+			reauthenticated = true
+			if !r.reauthenticate(ctx) {
+				return err
+			}
+			attempt--
+		case (errors.As(err, &timeoutErr) || class.retryable()) && attempt < r.retries:
+			if !class.retryable() {
+				// the command already took its whole timeout
+				fmt.Printf("Error: %v, retrying (%d/%d)\n", err, attempt+1, r.retries)
+				break
+			}
+			wait := retryDelay(attempt)
+			fmt.Printf("Error: %v, retrying in %s (%d/%d)\n", err, wait.Round(100*time.Millisecond), attempt+1, r.retries)
+			if !sleepContext(ctx, wait) {
+				return err
+			}
+		default:
+			return err
+		}
+	}
+}
+
+// once runs the command a single time, killing it when it exceeds the runner's timeout
+func (r *commandRunner) once(ctx context.Context, cmd *exec.Cmd, capture bool) ([]byte, error) {
+	release, err := r.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	var stdout bytes.Buffer
+	if capture {
+		if cmd.Stdout != nil {
+			return nil, errors.New("exec: Stdout already set")
+		}
+		cmd.Stdout = &stdout
+	}
+	stderr := captureStderr(cmd)
+	started := commandStarted(cmd)
+	if err := cmd.Start(); err != nil {
+		commandFinished(cmd, started, err)
+		return nil, err
+	}
+	var timedOut atomic.Bool
+	if r.timeout > 0 {
+		timer := time.AfterFunc(r.timeout, func() {
+			timedOut.Store(true)
+			cmd.Process.Kill()
+		})
+		defer timer.Stop()
+	}
+	err = cmd.Wait()
+	commandFinished(cmd, started, err)
+	if timedOut.Load() {
+		return nil, &CommandTimeoutError{Command: commandLine(cmd), Timeout: r.timeout}
+	}
+	if err != nil {
+		return stdout.Bytes(), newCommandError(cmd, err, stderr.String())
+	}
+	return stdout.Bytes(), nil
+}
+
+// captureStderr keeps the tail of the command's stderr for error classification while
+// still passing it to the original writer
+func captureStderr(cmd *exec.Cmd) *tailBuffer {
+	stderr := &tailBuffer{max: 4096}
+	if cmd.Stderr != nil {
+		cmd.Stderr = &stderrTee{original: cmd.Stderr, tail: stderr}
+	} else {
+		cmd.Stderr = stderr
+	}
+	return stderr
+}
+
+// stderrTee writes a command's stderr both to its original writer and to a tail buffer
+type stderrTee struct {
+	original io.Writer
+	tail     *tailBuffer
+}
+
+func (t *stderrTee) Write(p []byte) (int, error) {
+	t.tail.Write(p)
+	return t.original.Write(p)
+}
+
+// cloneCommand returns a fresh, unstarted copy of cmd bound to ctx
+func cloneCommand(ctx context.Context, cmd *exec.Cmd) *exec.Cmd {
+	clone := exec.CommandContext(ctx, cmd.Path, cmd.Args[1:]...)
+	clone.Args = cmd.Args
+	clone.Env = cmd.Env
+	clone.Dir = cmd.Dir
+	clone.Stdin = cmd.Stdin
+	if _, captured := cmd.Stdout.(*bytes.Buffer); !captured {
+		clone.Stdout = cmd.Stdout
+	}
+	clone.Stderr = originalStderr(cmd.Stderr)
+	return clone
+}
+
+// originalStderr undoes captureStderr so that clones do not capture twice
+func originalStderr(w io.Writer) io.Writer {
+	if _, ok := w.(*tailBuffer); ok {
+		return nil
+	}
+	if tee, ok := w.(*stderrTee); ok {
+		return tee.original
+	}
+	return w
+}
+
+// commandLine renders the command as it would be typed in a shell
+func commandLine(cmd *exec.Cmd) string {
+	return strings.Join(cmd.Args, " ")
+}
+
+// debugCommands prints every external command before it runs and how long it took, set by -debug
+var debugCommands bool
+
+// commandStarted is called right before an external command starts and returns its start time
+func commandStarted(cmd *exec.Cmd) time.Time {
+	if debugCommands {
+		logger.Printf("[debug] running %s\n", commandLine(cmd))
+	}
+	started := time.Now()
+	apiCalls.record(cmd, started)
+	return started
+}
+
+// commandFinished reports a command that started at started and returned err, to the
+// audit log and with -debug to the output
+func commandFinished(cmd *exec.Cmd, started time.Time, err error) {
+	audit.record(cmd, started, err)
+	if !debugCommands {
+		return
+	}
+	elapsed := time.Since(started).Round(time.Millisecond)
+	if err != nil {
+		logger.Printf("[debug] %s failed after %s: %v\n", commandLine(cmd), elapsed, err)
+		return
+	}
+	logger.Printf("[debug] %s took %s\n", commandLine(cmd), elapsed)
+}
+
+// start runs a long-lived command such as a port-forward. It only waits for the rate
+// limit, as holding a concurrency slot for the life of a tunnel would starve other calls.
+func (r *commandRunner) start(ctx context.Context, cmd *exec.Cmd) error {
+	if err := r.limiter.wait(ctx); err != nil {
+		return err
+	}
+	stderr := captureStderr(cmd)
+	terminateGracefully(cmd)
+	started := commandStarted(cmd)
+	err := runChild(cmd)
+	commandFinished(cmd, started, err)
+	if err != nil {
+		return newCommandError(cmd, err, stderr.String())
+	}
+	return nil
+}
+
+// childStopTimeout is how long a tunnel's child process gets to exit after SIGTERM
+const childStopTimeout = 5 * time.Second
+
+// terminateGracefully runs the command in its own process group, which receives SIGTERM
+// instead of SIGKILL when the command's context is canceled. The command is killed if it is
+// still running childStopTimeout later. Run it with runChild.
+func terminateGracefully(cmd *exec.Cmd) {
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error {
+		return terminateProcessGroup(cmd)
+	}
+	cmd.WaitDelay = childStopTimeout
+}
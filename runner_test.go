@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter(20, 1)
+	ctx := context.Background()
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := limiter.wait(ctx); err != nil {
+			t.Fatalf("rateLimiter.wait failed: %v", err)
+		}
+	}
+	// the first token is available immediately, the next two take 50ms each
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("rateLimiter failed: expected at least 100ms for 3 tokens, got %s", elapsed)
+	}
+}
+
+// test for commandRunner bounding the number of concurrent commands
+func TestCommandRunnerConcurrency(t *testing.T) {
+	runner := newCommandRunner(2, 0)
+	ctx := context.Background()
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := runner.run(ctx, exec.Command("sleep", "0.2")); err != nil {
+				t.Errorf("commandRunner.run failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("commandRunner failed: expected 4 commands to take two rounds, took %s", elapsed)
+	}
+}
+
+func TestCommandRunnerCanceled(t *testing.T) {
+	runner := newCommandRunner(1, 0)
+	release, err := runner.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("commandRunner.acquire failed: %v", err)
+	}
+	defer release()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := runner.output(ctx, exec.Command("true")); err != context.DeadlineExceeded {
+		t.Errorf("commandRunner.output failed: expected %v, got %v", context.DeadlineExceeded, err)
+	}
+}
+
+// test for commandRunner killing and retrying commands that exceed the timeout
+func TestCommandRunnerTimeout(t *testing.T) {
+	runner := newCommandRunner(1, 0).withTimeout(100*time.Millisecond, 1)
+	ctx := context.Background()
+	start := time.Now()
+	_, err := runner.output(ctx, exec.CommandContext(ctx, "sleep", "5"))
+	var timeoutErr *CommandTimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("commandRunner.output failed: expected a timeout error, got %v", err)
+	}
+	if timeoutErr.Command != "sleep 5" || !strings.Contains(err.Error(), "timed out after 100ms running sleep 5") {
+		t.Errorf("commandRunner.output failed: unexpected error %q", err)
+	}
+	// the command is attempted twice
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("commandRunner.output failed: unexpected duration %s", elapsed)
+	}
+
+	out, err := runner.output(ctx, exec.CommandContext(ctx, "echo", "us-central1-a"))
+	if err != nil || strings.TrimSpace(string(out)) != "us-central1-a" {
+		t.Errorf("commandRunner.output failed: got %q, %v", out, err)
+	}
+}
+
+// test for commandRunner retrying transient failures and giving up on permanent ones
+func TestCommandRunnerTransientFailure(t *testing.T) {
+	original := retryBaseDelay
+	retryBaseDelay = 10 * time.Millisecond
+	defer func() { retryBaseDelay = original }()
+	runner := newCommandRunner(1, 0).withTimeout(time.Minute, 2)
+	ctx := context.Background()
+
+	// the command fails with a 503 the first time only
+	marker := filepath.Join(t.TempDir(), "attempted")
+	script := `[ -e "$0" ] && echo asia-south1-a && exit 0; touch "$0"; echo "ERROR: code=503, message=The service is currently unavailable." >&2; exit 1`
+	out, err := runner.output(ctx, exec.Command("sh", "-c", script, marker))
+	if err != nil || strings.TrimSpace(string(out)) != "asia-south1-a" {
+		t.Errorf("commandRunner.output failed: expected the retry to succeed, got %q, %v", out, err)
+	}
+
+	counter := filepath.Join(t.TempDir(), "attempts")
+	script = `echo x >> "$0"; echo "ERROR: (gcloud.compute.instances.list) PERMISSION_DENIED" >&2; exit 1`
+	if _, err := runner.output(ctx, exec.Command("sh", "-c", script, counter)); errorClass(err) != ClassPermissionDenied {
+		t.Errorf("commandRunner.output failed: expected a permission denied, got %v", err)
+	}
+	if data, _ := os.ReadFile(counter); len(data) != 2 {
+		t.Errorf("commandRunner.output failed: expected a single attempt, got %d", len(data)/2)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	for attempt, bounds := range [][2]time.Duration{{500 * time.Millisecond, time.Second}, {time.Second, 2 * time.Second}, {15 * time.Second, 30 * time.Second}} {
+		if attempt == 2 {
+			attempt = 10
+		}
+		for range 20 {
+			if delay := retryDelay(attempt); delay < bounds[0] || delay > bounds[1] {
+				t.Errorf("retryDelay(%d) failed: expected between %s and %s, got %s", attempt, bounds[0], bounds[1], delay)
+			}
+		}
+	}
+	// many retries stay at the maximum instead of overflowing
+	for _, attempt := range []int{33, 64, 1000} {
+		if delay := retryDelay(attempt); delay < retryMaxDelay/2 || delay > retryMaxDelay {
+			t.Errorf("retryDelay(%d) failed: expected at most %s, got %s", attempt, retryMaxDelay, delay)
+		}
+	}
+}
+
+func TestDebugCommands(t *testing.T) {
+	var out bytes.Buffer
+	original := logger
+	logger = newConsoleLogger(&out)
+	debugCommands = true
+	defer func() {
+		logger = original
+		debugCommands = false
+	}()
+
+	cmd := exec.Command("true")
+	started := commandStarted(cmd)
+	commandFinished(cmd, started, nil)
+	failed := exec.Command("false")
+	commandFinished(failed, commandStarted(failed), errors.New("exit status 1"))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("debug output failed: expected 4 lines, got %q", out.String())
+	}
+	if lines[0] != "[debug] running true" || !strings.HasPrefix(lines[1], "[debug] true took ") {
+		t.Errorf("debug output failed: unexpected lines %q", lines[:2])
+	}
+	if !strings.HasPrefix(lines[3], "[debug] false failed after ") || !strings.HasSuffix(lines[3], ": exit status 1") {
+		t.Errorf("debug output failed: unexpected line %q", lines[3])
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AllowedHours are the hours an environment may be connected to, e.g. weekdays from 09:00
+// to 20:00 IST. Outside of them devcli refuses to start a session of the environment, and
+// a running session is torn down when they end.
+type AllowedHours struct {
+	// Days are the days the hours apply to, mon to sun, every day when empty
+	Days []string `yaml:"days"`
+	// From and To are the times of day as HH:MM. A To before From ends the next day.
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+	// Timezone is the IANA time zone of the hours, e.g. Asia/Kolkata, the local one when empty
+	Timezone string `yaml:"timezone"`
+}
+
+func (h AllowedHours) enabled() bool {
+	return h.From != "" || h.To != ""
+}
+
+// weekdays are the day names of AllowedHours.Days
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// schedule is the parsed form of AllowedHours
+type schedule struct {
+	// days are the allowed days, every day when nil
+	days     map[time.Weekday]bool
+	from, to int // minutes after midnight
+	location *time.Location
+}
+
+// parse checks the allowed hours and returns their schedule
+func (h AllowedHours) parse() (schedule, error) {
+	s := schedule{location: time.Local}
+	var err error
+	if s.from, err = parseTimeOfDay(h.From); err != nil {
+		return s, fmt.Errorf("allowed_hours from: %w", err)
+	}
+	if s.to, err = parseTimeOfDay(h.To); err != nil {
+		return s, fmt.Errorf("allowed_hours to: %w", err)
+	}
+	if s.from == s.to {
+		return s, fmt.Errorf("allowed_hours from and to are both %s", h.From)
+	}
+	for _, day := range h.Days {
+		weekday, ok := weekdays[strings.ToLower(day)]
+		if !ok {
+			return s, fmt.Errorf("allowed_hours day %q is not one of mon, tue, wed, thu, fri, sat and sun", day)
+		}
+		if s.days == nil {
+			s.days = make(map[time.Weekday]bool)
+		}
+		s.days[weekday] = true
+	}
+	if h.Timezone != "" {
+		if s.location, err = time.LoadLocation(h.Timezone); err != nil {
+			return s, fmt.Errorf("allowed_hours timezone: %w", err)
+		}
+	}
+	return s, nil
+}
+
+// parseTimeOfDay returns the minutes after midnight of HH:MM
+func parseTimeOfDay(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a time of day like 09:00", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// windowOf returns the allowed window starting on the given day
+func (s schedule) windowOf(day time.Time) (start, end time.Time) {
+	start = time.Date(day.Year(), day.Month(), day.Day(), s.from/60, s.from%60, 0, 0, s.location)
+	end = time.Date(day.Year(), day.Month(), day.Day(), s.to/60, s.to%60, 0, 0, s.location)
+	if s.to < s.from {
+		end = end.AddDate(0, 0, 1)
+	}
+	return start, end
+}
+
+// allowed reports whether t is in an allowed window, and when that window ends. A window
+// crossing midnight belongs to the day it starts on.
+func (s schedule) allowed(t time.Time) (time.Time, bool) {
+	t = t.In(s.location)
+	for _, offset := range []int{-1, 0} {
+		day := t.AddDate(0, 0, offset)
+		if s.days != nil && !s.days[day.Weekday()] {
+			continue
+		}
+		start, end := s.windowOf(day)
+		if !t.Before(start) && t.Before(end) {
+			return end, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// next returns the start of the first allowed window after t
+func (s schedule) next(t time.Time) time.Time {
+	t = t.In(s.location)
+	for offset := 0; offset <= 7; offset++ {
+		day := t.AddDate(0, 0, offset)
+		if s.days != nil && !s.days[day.Weekday()] {
+			continue
+		}
+		if start, _ := s.windowOf(day); start.After(t) {
+			return start
+		}
+	}
+	return time.Time{}
+}
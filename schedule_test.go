@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleAllowed(t *testing.T) {
+	ist := time.FixedZone("IST", 5*3600+1800)
+	weekdays := schedule{days: map[time.Weekday]bool{time.Monday: true, time.Tuesday: true, time.Wednesday: true, time.Thursday: true, time.Friday: true}, from: 9 * 60, to: 20 * 60, location: ist}
+	night := schedule{from: 22 * 60, to: 6 * 60, location: ist}
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, time.October, day, hour, minute, 0, 0, ist)
+	}
+
+	tests := []struct {
+		name     string
+		schedule schedule
+		t        time.Time
+		allowed  bool
+		end      time.Time
+	}{
+		{"weekday morning", weekdays, at(14, 9, 0), true, at(14, 20, 0)},
+		{"weekday evening", weekdays, at(14, 20, 0), false, time.Time{}},
+		{"weekday early", weekdays, at(14, 8, 59), false, time.Time{}},
+		{"saturday", weekdays, at(17, 12, 0), false, time.Time{}},
+		{"in UTC", weekdays, time.Date(2026, time.October, 14, 4, 0, 0, 0, time.UTC), true, at(14, 20, 0)},
+		{"night before midnight", night, at(14, 23, 0), true, at(15, 6, 0)},
+		{"night after midnight", night, at(15, 5, 0), true, at(15, 6, 0)},
+		{"night day", night, at(15, 12, 0), false, time.Time{}},
+	}
+	for _, test := range tests {
+		end, allowed := test.schedule.allowed(test.t)
+		if allowed != test.allowed || !end.Equal(test.end) {
+			t.Errorf("allowed failed for %s: expected %v until %v, got %v until %v", test.name, test.allowed, test.end, allowed, end)
+		}
+	}
+
+	// friday evening opens again on monday morning
+	if next := weekdays.next(at(16, 21, 0)); !next.Equal(at(19, 9, 0)) {
+		t.Errorf("next failed: expected monday 09:00, got %v", next)
+	}
+	if next := weekdays.next(at(14, 8, 0)); !next.Equal(at(14, 9, 0)) {
+		t.Errorf("next failed: expected 09:00 the same day, got %v", next)
+	}
+}
+
+func TestAllowedHoursParse(t *testing.T) {
+	s, err := AllowedHours{Days: []string{"Mon", "fri"}, From: "09:00", To: "20:30", Timezone: "Asia/Kolkata"}.parse()
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if s.from != 540 || s.to != 1230 || len(s.days) != 2 || !s.days[time.Friday] || s.location.String() != "Asia/Kolkata" {
+		t.Errorf("parse failed: unexpected schedule %+v", s)
+	}
+	for _, invalid := range []AllowedHours{
+		{From: "9am", To: "20:00"},
+		{From: "09:00"},
+		{From: "09:00", To: "09:00"},
+		{Days: []string{"monday"}, From: "09:00", To: "20:00"},
+		{From: "09:00", To: "20:00", Timezone: "Mars/Olympus"},
+	} {
+		if _, err := invalid.parse(); err == nil {
+			t.Errorf("parse failed: expected an error for %+v", invalid)
+		}
+	}
+}
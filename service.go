@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"html"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// serviceName is the name of the systemd unit or launchd agent of the environment
+func serviceName(environment string) string {
+	return "devcli-" + environment
+}
+
+// launchdLabel is the label of the launchd agent of the environment
+func launchdLabel(environment string) string {
+	return "com.okcredit.devcli." + environment
+}
+
+// runService implements `devcli service install|uninstall`, which registers a session as
+// a systemd user service on linux or a launchd agent on macOS, started at login and
+// restarted when it crashes
+func runService(args []string) {
+	usage := func() {
+		fmt.Println("Usage: devcli service install -env <environment> [start flags]")
+		fmt.Println("       devcli service uninstall -env <environment>")
+	}
+	if len(args) == 0 {
+		usage()
+		os.Exit(2)
+	}
+	action := args[0]
+
+	var opts options
+	fs := flag.NewFlagSet("devcli service "+action, flag.ExitOnError)
+	startFlags(fs, &opts)
+	parseStartArgs(fs, &opts, args[1:])
+	environment := configEnvironment(opts)
+	if environment == "" {
+		fmt.Println("Error: environment is not set in the configuration file or passed as a command line argument.")
+		os.Exit(1)
+	}
+
+	var err error
+	switch action {
+	case "install":
+		err = installService(environment, args[1:])
+	case "uninstall":
+		err = uninstallService(environment)
+	default:
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Printf("Error running service %s: %v\n", action, err)
+		os.Exit(1)
+	}
+}
+
+// serviceArgs returns the command line of the service's session. The configuration file
+// path is made absolute since services do not run in the current directory, for the same
+// reason the project configuration file of the current directory is passed explicitly.
+func serviceArgs(environment string, args []string) ([]string, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	command := []string{executable, "start", "-env", environment}
+	hasConf := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case (arg == "-conf" || arg == "--conf") && i+1 < len(args):
+			hasConf = true
+			i++
+			conf, err := filepath.Abs(args[i])
+			if err != nil {
+				return nil, err
+			}
+			command = append(command, arg, conf)
+		case strings.HasPrefix(arg, "-conf=") || strings.HasPrefix(arg, "--conf="):
+			hasConf = true
+			name, value, _ := strings.Cut(arg, "=")
+			conf, err := filepath.Abs(value)
+			if err != nil {
+				return nil, err
+			}
+			command = append(command, name+"="+conf)
+		default:
+			command = append(command, arg)
+		}
+	}
+	if project := projectConfig(); !hasConf && project != "" {
+		command = append(command, "-conf", project)
+	}
+	return command, nil
+}
+
+// systemdQuote quotes a word of an ExecStart line when it contains spaces or quotes
+func systemdQuote(word string) string {
+	if !strings.ContainsAny(word, " \t\"'\\") {
+		return word
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(word) + `"`
+}
+
+// systemdUnit returns the user unit running the session, restarted when it fails.
+// The PATH of the installing shell is kept so that gcloud and kubectl are found.
+func systemdUnit(environment string, command []string, path string) string {
+	quoted := make([]string, len(command))
+	for i, word := range command {
+		quoted[i] = systemdQuote(word)
+	}
+	return fmt.Sprintf(`[Unit]
+Description=devcli tunnels of the %s environment
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+ExecStart=%s
+Environment=%s
+Restart=on-failure
+RestartSec=10
+
+[Install]
+WantedBy=default.target
+`, environment, strings.Join(quoted, " "), systemdQuote("PATH="+path))
+}
+
+// launchdPlist returns the agent running the session at login, restarted when it exits
+// with an error. Its output goes to logPath.
+func launchdPlist(environment string, command []string, path, logPath string) string {
+	var b strings.Builder
+	fmt.Fprintln(&b, `<?xml version="1.0" encoding="UTF-8"?>`)
+	fmt.Fprintln(&b, `<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">`)
+	fmt.Fprintln(&b, `<plist version="1.0">`)
+	fmt.Fprintln(&b, `<dict>`)
+	fmt.Fprintf(&b, "\t<key>Label</key>\n\t<string>%s</string>\n", html.EscapeString(launchdLabel(environment)))
+	fmt.Fprintln(&b, "\t<key>ProgramArguments</key>\n\t<array>")
+	for _, word := range command {
+		fmt.Fprintf(&b, "\t\t<string>%s</string>\n", html.EscapeString(word))
+	}
+	fmt.Fprintln(&b, "\t</array>")
+	fmt.Fprintf(&b, "\t<key>EnvironmentVariables</key>\n\t<dict>\n\t\t<key>PATH</key>\n\t\t<string>%s</string>\n\t</dict>\n", html.EscapeString(path))
+	fmt.Fprintln(&b, "\t<key>RunAtLoad</key>\n\t<true/>")
+	fmt.Fprintln(&b, "\t<key>KeepAlive</key>\n\t<dict>\n\t\t<key>SuccessfulExit</key>\n\t\t<false/>\n\t</dict>")
+	fmt.Fprintln(&b, "\t<key>ThrottleInterval</key>\n\t<integer>10</integer>")
+	fmt.Fprintf(&b, "\t<key>StandardOutPath</key>\n\t<string>%s</string>\n", html.EscapeString(logPath))
+	fmt.Fprintf(&b, "\t<key>StandardErrorPath</key>\n\t<string>%s</string>\n", html.EscapeString(logPath))
+	fmt.Fprintln(&b, `</dict>`)
+	fmt.Fprintln(&b, `</plist>`)
+	return b.String()
+}
+
+// serviceFile is where the unit or agent of the environment is installed
+func serviceFile(environment string) (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	switch runtime.GOOS {
+	case "linux":
+		return filepath.Join(homeDir, ".config", "systemd", "user", serviceName(environment)+".service"), nil
+	case "darwin":
+		return filepath.Join(homeDir, "Library", "LaunchAgents", launchdLabel(environment)+".plist"), nil
+	}
+	return "", fmt.Errorf("services are not supported on %s", runtime.GOOS)
+}
+
+func installService(environment string, args []string) error {
+	file, err := serviceFile(environment)
+	if err != nil {
+		return err
+	}
+	command, err := serviceArgs(environment, args)
+	if err != nil {
+		return err
+	}
+	var content string
+	if runtime.GOOS == "darwin" {
+		dir, err := sessionDir()
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+		content = launchdPlist(environment, command, os.Getenv("PATH"), filepath.Join(dir, environment+".log"))
+	} else {
+		content = systemdUnit(environment, command, os.Getenv("PATH"))
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		return err
+	}
+	fmt.Println("Wrote", file)
+
+	if runtime.GOOS == "darwin" {
+		// reinstalling replaces the agent that is already loaded
+		serviceCommand("launchctl", "bootout", launchdDomain(), file)
+		err = serviceCommand("launchctl", "bootstrap", launchdDomain(), file)
+	} else {
+		err = serviceCommand("systemctl", "--user", "daemon-reload")
+		if err == nil {
+			err = serviceCommand("systemctl", "--user", "enable", "--now", serviceName(environment)+".service")
+		}
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("The %s session now starts at login. Run devcli attach -env %s to follow it.\n", environment, environment)
+	return nil
+}
+
+func uninstallService(environment string) error {
+	file, err := serviceFile(environment)
+	if err != nil {
+		return err
+	}
+	if runtime.GOOS == "darwin" {
+		err = serviceCommand("launchctl", "bootout", launchdDomain(), file)
+	} else {
+		err = serviceCommand("systemctl", "--user", "disable", "--now", serviceName(environment)+".service")
+	}
+	if err != nil {
+		fmt.Println("Warning: stopping the service failed:", err)
+	}
+	if err := os.Remove(file); err != nil {
+		return err
+	}
+	if runtime.GOOS == "linux" {
+		serviceCommand("systemctl", "--user", "daemon-reload")
+	}
+	fmt.Println("Removed", file)
+	return nil
+}
+
+// launchdDomain is the launchd domain of the user's login session
+func launchdDomain() string {
+	return fmt.Sprintf("gui/%d", os.Getuid())
+}
+
+// serviceCommand runs systemctl or launchctl, returning their error output on failure
+func serviceCommand(name string, args ...string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), localCommandTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s: %w: %s", name, strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestServiceArgs(t *testing.T) {
+	command, err := serviceArgs("dev", []string{"-conf", "config.yaml", "-http-log", "--conf=other.yaml"})
+	if err != nil {
+		t.Fatalf("serviceArgs failed: %v", err)
+	}
+	wd, _ := os.Getwd()
+	expected := []string{"start", "-env", "dev", "-conf", filepath.Join(wd, "config.yaml"), "-http-log", "--conf=" + filepath.Join(wd, "other.yaml")}
+	if strings.Join(command[1:], " ") != strings.Join(expected, " ") {
+		t.Errorf("serviceArgs failed: expected %q, got %q", expected, command[1:])
+	}
+}
+
+func TestSystemdUnit(t *testing.T) {
+	unit := systemdUnit("dev", []string{"/opt/my tools/devcli", "start", "-env", "dev"}, "/usr/bin:/opt/google-cloud-sdk/bin")
+	for _, line := range []string{
+		`ExecStart="/opt/my tools/devcli" start -env dev`,
+		"Environment=PATH=/usr/bin:/opt/google-cloud-sdk/bin",
+		"Restart=on-failure",
+		"WantedBy=default.target",
+	} {
+		if !strings.Contains(unit, line+"\n") {
+			t.Errorf("systemdUnit failed: missing %q in\n%s", line, unit)
+		}
+	}
+}
+
+func TestLaunchdPlist(t *testing.T) {
+	plist := launchdPlist("dev", []string{"/usr/local/bin/devcli", "start", "-env", "dev"}, "/usr/bin", "/Users/me/.devcli/sessions/dev.log")
+	for _, fragment := range []string{
+		"<string>com.okcredit.devcli.dev</string>",
+		"<string>/usr/local/bin/devcli</string>\n\t\t<string>start</string>",
+		"<key>SuccessfulExit</key>\n\t\t<false/>",
+		"<string>/Users/me/.devcli/sessions/dev.log</string>",
+	} {
+		if !strings.Contains(plist, fragment) {
+			t.Errorf("launchdPlist failed: missing %q in\n%s", fragment, plist)
+		}
+	}
+}
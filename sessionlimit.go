@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// maxSessionWarning is how long before the end of a limited session it is announced
+const maxSessionWarning = 10 * time.Minute
+
+// isProduction reports whether the environment is a production one, whose sessions must
+// be limited with max_session
+func isProduction(environment string) bool {
+	environment = strings.ToLower(environment)
+	return environment == "prod" || environment == "production"
+}
+
+// validateMaxSession checks the session limit of the environment, which production
+// environments must set so that nobody leaves a production tunnel open overnight
+func validateMaxSession(config ProxyConfig) error {
+	if config.MaxSession < 0 {
+		return fmt.Errorf("max_session %s is negative", config.MaxSession)
+	}
+	if config.MaxSession == 0 && isProduction(config.Environment) {
+		return fmt.Errorf("environment %s is a production environment and must set max_session, e.g. max_session: 4h", config.Environment)
+	}
+	return nil
+}
+
+// limitSession ends the session once it ran for limit, warning the given time before.
+// Ending the session runs the pre_stop and post_stop hooks like an interrupt.
+func limitSession(ctx context.Context, limit, warning time.Duration, end func()) {
+	deadline := time.Now().Add(limit)
+	fmt.Printf("The session is limited to %s by max_session and ends at %s.\n", limit, deadline.Format("15:04"))
+	endSessionAt(ctx, deadline, warning, fmt.Sprintf("its max_session of %s", limit), end)
+}
+
+// endSessionAt ends the session at the deadline, warning the given time before, unless
+// it ended already
+func endSessionAt(ctx context.Context, deadline time.Time, warning time.Duration, reason string, end func()) {
+	go func() {
+		if warning > 0 && time.Until(deadline) > warning {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Until(deadline) - warning):
+			}
+			fmt.Printf("Warning: the session ends in %s at %s and its tunnels are torn down. Restart it to keep working.\n", warning, deadline.Format("15:04"))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(deadline)):
+		}
+		fmt.Printf("The session reached %s, tearing down the tunnels.\n", reason)
+		end()
+	}()
+}
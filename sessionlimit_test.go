@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestValidateMaxSession(t *testing.T) {
+	tests := []struct {
+		config ProxyConfig
+		valid  bool
+	}{
+		{ProxyConfig{Environment: "staging"}, true},
+		{ProxyConfig{Environment: "prod"}, false},
+		{ProxyConfig{Environment: "Production"}, false},
+		{ProxyConfig{Environment: "prod", MaxSession: 4 * time.Hour}, true},
+		{ProxyConfig{Environment: "staging", MaxSession: -time.Hour}, false},
+	}
+	for _, test := range tests {
+		if err := validateMaxSession(test.config); (err == nil) != test.valid {
+			t.Errorf("validateMaxSession failed for %s with max_session %s: got %v", test.config.Environment, test.config.MaxSession, err)
+		}
+	}
+}
+
+func TestLimitSession(t *testing.T) {
+	ended := make(chan time.Time, 1)
+	started := time.Now()
+	limitSession(context.Background(), 50*time.Millisecond, 20*time.Millisecond, func() { ended <- time.Now() })
+	select {
+	case end := <-ended:
+		if end.Sub(started) < 50*time.Millisecond {
+			t.Errorf("limitSession failed: the session ended after %s", end.Sub(started))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("limitSession failed: the session did not end")
+	}
+
+	// a session ended before its limit is not ended again
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	limitSession(ctx, 10*time.Millisecond, 0, func() { ended <- time.Now() })
+	select {
+	case <-ended:
+		t.Error("limitSession failed: a canceled session was ended")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
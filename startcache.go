@@ -0,0 +1,186 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// startCacheTTL is how long the startup state of a session is reused by -fast
+const startCacheTTL = 10 * time.Minute
+
+// startCache is the startup state of the last session of an environment started without
+// -fast, reused by -fast to skip the lookups whose results cannot have changed since
+type startCache struct {
+	// Key identifies the configuration the state was looked up with
+	Key     string    `json:"key"`
+	SavedAt time.Time `json:"saved_at"`
+	Project string    `json:"project"`
+	// BastionZones are the zones of the bastion by project, the environment's included
+	BastionZones map[string]string `json:"bastion_zones,omitempty"`
+	Clusters     []cachedCluster   `json:"clusters,omitempty"`
+	// Preflight reports whether the preflight checks ran and passed
+	Preflight bool `json:"preflight"`
+}
+
+// cachedCluster is a cluster of the startup state by the reference it was looked up with
+type cachedCluster struct {
+	Project string     `json:"project"`
+	Name    string     `json:"name,omitempty"`
+	Cluster gkeCluster `json:"cluster"`
+}
+
+// startCacheKey identifies the configuration of a session and the kubeconfig and gcloud
+// configuration it writes to
+func startCacheKey(configData []byte, kubeconfig, gcloudConfig string) string {
+	h := sha256.New()
+	h.Write(configData)
+	h.Write([]byte("\x00" + kubeconfig + "\x00" + gcloudConfig))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// startCachePath is the file of the environment's startup state
+func startCachePath(environment string) (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, ".devcli", "cache", environment+".json"), nil
+}
+
+// loadStartCache returns the startup state of the environment, nil when there is none
+// younger than startCacheTTL for the same configuration
+func loadStartCache(environment, key string) *startCache {
+	path, err := startCachePath(environment)
+	if err != nil {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var cache startCache
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return nil
+	}
+	if cache.Key != key || time.Since(cache.SavedAt) > startCacheTTL || cache.SavedAt.After(time.Now()) {
+		return nil
+	}
+	return &cache
+}
+
+// save writes the startup state of the environment
+func (c *startCache) save(environment string) error {
+	path, err := startCachePath(environment)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+// projectSet reports whether the gcloud project was set to the project
+func (c *startCache) projectSet(project string) bool {
+	return c != nil && c.Project == project
+}
+
+// preflightPassed reports whether the preflight checks passed
+func (c *startCache) preflightPassed() bool {
+	return c != nil && c.Preflight
+}
+
+// bastionZones returns the zones of the bastion in the projects, false unless all of them
+// are known
+func (c *startCache) bastionZones(projects []string) (map[string]string, bool) {
+	if c == nil {
+		return nil, false
+	}
+	zones := make(map[string]string)
+	for _, project := range projects {
+		zone, ok := c.BastionZones[project]
+		if !ok {
+			return nil, false
+		}
+		zones[project] = zone
+	}
+	return zones, true
+}
+
+// updateBastionZones replaces the bastion zones of the environment's startup state, keeping
+// its age, so that -fast does not reuse a zone the bastion moved away from
+func updateBastionZones(environment, key string, zones map[string]string) error {
+	cache := loadStartCache(environment, key)
+	if cache == nil {
+		return nil
+	}
+	cache.BastionZones = zones
+	return cache.save(environment)
+}
+
+// clusters returns the referenced clusters, false unless all of them are known
+func (c *startCache) clusters(refs []clusterRef) (map[clusterRef]gkeCluster, bool) {
+	if c == nil {
+		return nil, false
+	}
+	known := make(map[clusterRef]gkeCluster)
+	for _, cached := range c.Clusters {
+		known[clusterRef{project: cached.Project, name: cached.Name}] = cached.Cluster
+	}
+	clusters := make(map[clusterRef]gkeCluster)
+	for _, ref := range refs {
+		cluster, ok := known[ref]
+		if !ok {
+			return nil, false
+		}
+		clusters[ref] = cluster
+	}
+	return clusters, true
+}
+
+// setClusters records the clusters of the session
+func (c *startCache) setClusters(clusters map[clusterRef]gkeCluster) {
+	c.Clusters = nil
+	for ref, cluster := range clusters {
+		c.Clusters = append(c.Clusters, cachedCluster{Project: ref.project, Name: ref.name, Cluster: cluster})
+	}
+}
+
+// kubeconfigHasContexts reports whether the kubeconfig files of the KUBECONFIG value still
+// hold the contexts of the clusters, so that their credentials need not be fetched again
+func kubeconfigHasContexts(kubeconfigs string, clusters map[clusterRef]gkeCluster) bool {
+	contexts := make(map[string]bool)
+	for _, path := range filepath.SplitList(kubeconfigs) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var kubeconfig struct {
+			Contexts []struct {
+				Name string `yaml:"name"`
+			} `yaml:"contexts"`
+		}
+		if err := yaml.Unmarshal(data, &kubeconfig); err != nil {
+			return false
+		}
+		for _, context := range kubeconfig.Contexts {
+			contexts[context.Name] = true
+		}
+	}
+	for _, cluster := range clusters {
+		if !contexts[cluster.kubeContext()] {
+			return false
+		}
+	}
+	return true
+}
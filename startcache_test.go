@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStartCache(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	key := startCacheKey([]byte("proxies: []"), "/kubeconfig", "/gcloud")
+	if cache := loadStartCache("dev", key); cache != nil {
+		t.Fatalf("loadStartCache failed: expected no state, got %+v", cache)
+	}
+
+	clusters := map[clusterRef]gkeCluster{
+		{project: "dev-project"}:                 {Project: "dev-project", Location: "asia-south1", Name: "main"},
+		{project: "data-project", name: "spark"}: {Project: "data-project", Location: "asia-south1-a", Name: "spark"},
+	}
+	state := &startCache{Key: key, SavedAt: time.Now(), Project: "dev-project", Preflight: true,
+		BastionZones: map[string]string{"dev-project": "asia-south1-a", "shared-project": "asia-south1-b"}}
+	state.setClusters(clusters)
+	if err := state.save("dev"); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	cache := loadStartCache("dev", key)
+	if cache == nil {
+		t.Fatal("loadStartCache failed: expected the saved state")
+	}
+	if !cache.projectSet("dev-project") || cache.projectSet("other-project") || !cache.preflightPassed() {
+		t.Errorf("loadStartCache failed: unexpected state %+v", cache)
+	}
+	if zones, ok := cache.bastionZones([]string{"shared-project", "dev-project"}); !ok || zones["shared-project"] != "asia-south1-b" {
+		t.Errorf("bastionZones failed: got %v, %v", zones, ok)
+	}
+	if _, ok := cache.bastionZones([]string{"other-project"}); ok {
+		t.Error("bastionZones failed: expected an unknown project to miss")
+	}
+	got, ok := cache.clusters([]clusterRef{{project: "dev-project"}, {project: "data-project", name: "spark"}})
+	if !ok || got[clusterRef{project: "data-project", name: "spark"}] != clusters[clusterRef{project: "data-project", name: "spark"}] {
+		t.Errorf("clusters failed: got %v, %v", got, ok)
+	}
+	if _, ok := cache.clusters([]clusterRef{{project: "data-project"}}); ok {
+		t.Error("clusters failed: expected an unknown cluster to miss")
+	}
+
+	if cache := loadStartCache("dev", startCacheKey([]byte("proxies: []\n"), "/kubeconfig", "/gcloud")); cache != nil {
+		t.Error("loadStartCache failed: expected a changed configuration to miss")
+	}
+	state.SavedAt = time.Now().Add(-startCacheTTL - time.Minute)
+	if err := state.save("dev"); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	if cache := loadStartCache("dev", key); cache != nil {
+		t.Error("loadStartCache failed: expected an old state to miss")
+	}
+
+	var missing *startCache
+	if missing.projectSet("dev-project") || missing.preflightPassed() {
+		t.Error("nil startCache failed: expected nothing to be reused")
+	}
+}
+
+func TestKubeconfigHasContexts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	kubeconfig := `apiVersion: v1
+contexts:
+- context:
+    cluster: gke_dev-project_asia-south1_main
+  name: gke_dev-project_asia-south1_main
+`
+	if err := os.WriteFile(path, []byte(kubeconfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	main := map[clusterRef]gkeCluster{{project: "dev-project"}: {Project: "dev-project", Location: "asia-south1", Name: "main"}}
+	if !kubeconfigHasContexts(path, main) {
+		t.Error("kubeconfigHasContexts failed: expected the context of the cluster to be found")
+	}
+	main[clusterRef{project: "data-project"}] = gkeCluster{Project: "data-project", Location: "asia-south1", Name: "spark"}
+	if kubeconfigHasContexts(path, main) {
+		t.Error("kubeconfigHasContexts failed: expected a missing context to be reported")
+	}
+	if kubeconfigHasContexts(filepath.Join(t.TempDir(), "missing"), main) {
+		t.Error("kubeconfigHasContexts failed: expected a missing kubeconfig to be reported")
+	}
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	kindWorkload = "workload"
+	kindBastion  = "bastion"
+	kindAPI      = "api"
+)
+
+// tunnelStatus is the last known state of one forwarded local port
+type tunnelStatus struct {
+	Name       string
+	Kind       string
+	LocalPort  int
+	Protocol   string
+	State      string
+	Restarts   int
+	Health     string
+	Liveness   string
+	ConnectP50 time.Duration
+	ConnectP95 time.Duration
+	RTTP50     time.Duration
+	RTTP95     time.Duration
+	LastError  string
+	// RecentErrors are the last errors of the tunnel, the most recent last
+	RecentErrors []string
+	UpdatedAt    time.Time
+	// Metered is set when devcli relays the tunnel's traffic with -meter, which counts the
+	// bytes sent to and received from the remote end and the open connections
+	Metered       bool
+	BytesSent     int64
+	BytesReceived int64
+	Connections   int
+}
+
+// statusRegistry keeps the status of every tunnel of the session, in the order the
+// tunnels were registered. It is safe for concurrent use.
+type statusRegistry struct {
+	mu      sync.Mutex
+	order   []string
+	tunnels map[string]*tunnelStatus
+	connect map[string]*latencySamples
+	rtt     map[string]*latencySamples
+	// watchers get the status of a tunnel every time its state, health or liveness changes
+	watchers map[*statusWatcher]struct{}
+}
+
+// statusWatcher keeps the latest status of every tunnel that changed since the watcher last
+// took the changes. A slow watcher gets fewer changes, never a stale status.
+type statusWatcher struct {
+	registry *statusRegistry
+	// pending are the changed statuses, by tunnel, and the tunnels in the order they changed
+	pending map[string]tunnelStatus
+	order   []string
+	// ready has a value while there are pending changes
+	ready chan struct{}
+}
+
+// changed returns the channel that has a value once there are changes to take
+func (w *statusWatcher) changed() <-chan struct{} {
+	return w.ready
+}
+
+// take returns the latest status of the tunnels that changed, in the order they changed
+func (w *statusWatcher) take() []tunnelStatus {
+	w.registry.mu.Lock()
+	defer w.registry.mu.Unlock()
+	statuses := make([]tunnelStatus, 0, len(w.order))
+	for _, name := range w.order {
+		statuses = append(statuses, w.pending[name])
+	}
+	clear(w.pending)
+	w.order = w.order[:0]
+	return statuses
+}
+
+func newStatusRegistry() *statusRegistry {
+	return &statusRegistry{
+		tunnels:  make(map[string]*tunnelStatus),
+		connect:  make(map[string]*latencySamples),
+		rtt:      make(map[string]*latencySamples),
+		watchers: make(map[*statusWatcher]struct{}),
+	}
+}
+
+// register adds a tunnel to the registry, keeping the existing entry if there is one
+func (r *statusRegistry) register(name, kind string, localPort int, protocol string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.tunnels[name]; ok {
+		return
+	}
+	r.order = append(r.order, name)
+	r.tunnels[name] = &tunnelStatus{Name: name, Kind: kind, LocalPort: localPort, Protocol: protocol, State: stateStarting, Health: "unknown", Liveness: "unknown", UpdatedAt: time.Now()}
+	r.connect[name] = &latencySamples{}
+	r.rtt[name] = &latencySamples{}
+}
+
+// setState records the lifecycle state of a tunnel and the error that caused it, if any
+func (r *statusRegistry) setState(name, state string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.tunnels[name]
+	if !ok {
+		return
+	}
+	events.tunnelState(name, t.State, state, err)
+	t.State = state
+	if err != nil {
+		t.LastError = err.Error()
+		t.RecentErrors = append(t.RecentErrors, err.Error())
+		if len(t.RecentErrors) > recentErrorCount {
+			t.RecentErrors = t.RecentErrors[len(t.RecentErrors)-recentErrorCount:]
+		}
+	}
+	t.UpdatedAt = time.Now()
+	r.notify(name)
+}
+
+// addRestart counts a restart of the tunnel
+func (r *statusRegistry) addRestart(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if t, ok := r.tunnels[name]; ok {
+		t.Restarts++
+	}
+}
+
+// setHealth records the health of a tunnel and returns the previous value
+func (r *statusRegistry) setHealth(name, health string, err error) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.tunnels[name]
+	if !ok {
+		return ""
+	}
+	previous := t.Health
+	t.Health = health
+	if err != nil {
+		t.LastError = err.Error()
+	}
+	t.UpdatedAt = time.Now()
+	if health != previous {
+		r.notify(name)
+	}
+	return previous
+}
+
+// setLiveness records the result of the last liveness probe and returns the previous value
+func (r *statusRegistry) setLiveness(name, liveness string, err error) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.tunnels[name]
+	if !ok {
+		return ""
+	}
+	previous := t.Liveness
+	t.Liveness = liveness
+	if err != nil {
+		t.LastError = err.Error()
+	}
+	t.UpdatedAt = time.Now()
+	if liveness != previous {
+		r.notify(name)
+	}
+	return previous
+}
+
+// recordLatency adds latency samples of a tunnel, zero values are not recorded
+func (r *statusRegistry) recordLatency(name string, connect, rtt time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.tunnels[name]; !ok {
+		return
+	}
+	if connect > 0 {
+		r.connect[name].add(connect)
+	}
+	if rtt > 0 {
+		r.rtt[name].add(rtt)
+	}
+}
+
+// meter marks the tunnel as metered and returns the relay observer counting its traffic
+func (r *statusRegistry) meter(name string) relayObserver {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if t, ok := r.tunnels[name]; ok {
+		t.Metered = true
+	}
+	return &tunnelMeter{registry: r, name: name}
+}
+
+// recordTraffic adds the bytes and change in open connections of a metered tunnel
+func (r *statusRegistry) recordTraffic(name string, connections int, sent, received int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if t, ok := r.tunnels[name]; ok {
+		t.Connections += connections
+		t.BytesSent += sent
+		t.BytesReceived += received
+	}
+}
+
+// snapshot returns a copy of all tunnel statuses
+func (r *statusRegistry) snapshot() []tunnelStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.statuses()
+}
+
+// state returns the lifecycle state of a tunnel, empty for an unknown tunnel
+func (r *statusRegistry) state(name string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if status, ok := r.tunnels[name]; ok {
+		return status.State
+	}
+	return ""
+}
+
+// statuses returns a copy of all tunnel statuses, the caller holds the lock
+func (r *statusRegistry) statuses() []tunnelStatus {
+	statuses := make([]tunnelStatus, 0, len(r.order))
+	for _, name := range r.order {
+		statuses = append(statuses, r.status(name))
+	}
+	return statuses
+}
+
+// status returns a copy of the tunnel's status, the caller holds the lock
+func (r *statusRegistry) status(name string) tunnelStatus {
+	status := *r.tunnels[name]
+	status.ConnectP50, status.ConnectP95 = r.connect[name].percentile(50), r.connect[name].percentile(95)
+	status.RTTP50, status.RTTP95 = r.rtt[name].percentile(50), r.rtt[name].percentile(95)
+	return status
+}
+
+// watch returns the statuses of all tunnels and the watcher getting every change from then
+// on, until unwatch is called
+func (r *statusRegistry) watch() (statuses []tunnelStatus, watcher *statusWatcher, unwatch func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	watcher = &statusWatcher{registry: r, pending: make(map[string]tunnelStatus), ready: make(chan struct{}, 1)}
+	r.watchers[watcher] = struct{}{}
+	return r.statuses(), watcher, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.watchers, watcher)
+	}
+}
+
+// notify records the tunnel's status as a change of every watcher, the caller holds the
+// lock. The session never waits for a watcher: a change the watcher did not take yet is
+// replaced by the tunnel's latest status.
+func (r *statusRegistry) notify(name string) {
+	if len(r.watchers) == 0 {
+		return
+	}
+	status := r.status(name)
+	for watcher := range r.watchers {
+		if _, ok := watcher.pending[name]; !ok {
+			watcher.order = append(watcher.order, name)
+		}
+		watcher.pending[name] = status
+		select {
+		case watcher.ready <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// writeStatusTable prints the statuses as an aligned table, in a single write so that the
+// lines of the table are not mixed with the output of other goroutines
+func writeStatusTable(w io.Writer, statuses []tunnelStatus) {
+	var b bytes.Buffer
+	tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TUNNEL\tKIND\tLOCAL PORT\tSTATE\tRESTARTS\tLIVENESS\tHEALTH\tCONNECT P50/P95\tRTT P50/P95\tLAST ERROR")
+	for _, s := range statuses {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%d\t%s\t%s\t%s\t%s\t%s\n", s.Name, s.Kind, s.LocalPort, s.State, s.Restarts, s.Liveness, s.Health,
+			formatPercentiles(s.ConnectP50, s.ConnectP95), formatPercentiles(s.RTTP50, s.RTTP95), s.LastError)
+	}
+	tw.Flush()
+	// the errors of degraded tunnels stand out below the table, the last one alone may not
+	// tell why the tunnel keeps failing
+	for _, s := range statuses {
+		if s.State != stateDegraded {
+			continue
+		}
+		fmt.Fprintf(&b, "Tunnel %s is degraded, its last errors:\n", s.Name)
+		for _, err := range s.RecentErrors {
+			fmt.Fprintf(&b, "  %s\n", err)
+		}
+	}
+	w.Write(b.Bytes())
+}
+
+// runStatus implements devcli status, which prints the tunnels of the running sessions, or
+// of the session of one environment
+func runStatus(args []string) {
+	fs := flag.NewFlagSet("devcli status", flag.ExitOnError)
+	environment := fs.String("env", "", "Environment of the session, all running sessions when empty")
+	var format string
+	outputFlag(fs, &format)
+	fs.Parse(args)
+	if err := checkOutputFormat(format); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(2)
+	}
+
+	environments := []string{*environment}
+	if *environment == "" {
+		var err error
+		environments, err = runningSessions()
+		if err != nil {
+			fmt.Println("Error listing the running sessions:", err)
+			os.Exit(1)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), localCommandTimeout)
+	defer cancel()
+	sessions := []sessionOutput{}
+	var tables [][]tunnelStatus
+	for _, environment := range environments {
+		socket, err := sessionSocket(environment)
+		if err != nil {
+			fmt.Println("Error getting the session directory:", err)
+			os.Exit(1)
+		}
+		client := newControlClient(socket)
+		statuses, err := client.status(ctx)
+		if err != nil {
+			fmt.Printf("Error getting the status of the session of environment %s: %v\n", environment, err)
+			os.Exit(1)
+		}
+		session := newSessionOutput(environment, statuses)
+		// a session started by an older devcli does not count its API calls
+		if rates, err := client.apiCalls(ctx); err == nil {
+			session.APICalls = rates
+		}
+		sessions = append(sessions, session)
+		tables = append(tables, statuses)
+	}
+
+	err := writeOutput(os.Stdout, format, sessions, func(w io.Writer) {
+		if len(sessions) == 0 {
+			fmt.Fprintln(w, "No session is running.")
+		}
+		for i, session := range sessions {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintf(w, "Environment %s:\n", session.Environment)
+			writeStatusTable(w, tables[i])
+			writeAPICalls(w, session.APICalls)
+		}
+	})
+	if err != nil {
+		fmt.Println("Error writing the status:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatusRegistry(t *testing.T) {
+	registry := newStatusRegistry()
+	registry.register("cashfree", kindWorkload, 8080, "http")
+	registry.register("10.120.52.48:5432", kindBastion, 5435, "postgres")
+	registry.register("cashfree", kindWorkload, 9090, "http")
+
+	if previous := registry.setHealth("cashfree", healthNotServing, errors.New("health status NOT_SERVING")); previous != "unknown" {
+		t.Errorf("setHealth failed: expected previous health unknown, got %s", previous)
+	}
+
+	registry.recordLatency("cashfree", 30*time.Millisecond, 10*time.Millisecond)
+	registry.recordLatency("cashfree", 50*time.Millisecond, 20*time.Millisecond)
+
+	statuses := registry.snapshot()
+	if len(statuses) != 2 || statuses[0].Name != "cashfree" || statuses[0].LocalPort != 8080 {
+		t.Fatalf("snapshot failed: unexpected statuses %+v", statuses)
+	}
+
+	var out bytes.Buffer
+	writeStatusTable(&out, statuses)
+	if statuses[0].ConnectP50 != 30*time.Millisecond || statuses[0].RTTP95 != 20*time.Millisecond {
+		t.Errorf("snapshot failed: unexpected latency %+v", statuses[0])
+	}
+	if !strings.Contains(out.String(), "not_serving") || !strings.Contains(out.String(), "10.120.52.48:5432") {
+		t.Errorf("writeStatusTable failed: unexpected output\n%s", out.String())
+	}
+}
+
+func TestStatusTableDegraded(t *testing.T) {
+	registry := newStatusRegistry()
+	registry.register("cashfree", kindWorkload, 8080, "http")
+	for _, err := range []string{"timeout", "pod not found", "pod not found", "connection refused"} {
+		registry.setState("cashfree", stateDegraded, errors.New(err))
+	}
+	statuses := registry.snapshot()
+	if len(statuses[0].RecentErrors) != recentErrorCount || statuses[0].RecentErrors[0] != "pod not found" {
+		t.Errorf("setState failed: unexpected recent errors %v", statuses[0].RecentErrors)
+	}
+	var out bytes.Buffer
+	writeStatusTable(&out, statuses)
+	if !strings.Contains(out.String(), "Tunnel cashfree is degraded, its last errors:\n  pod not found\n") {
+		t.Errorf("writeStatusTable failed: expected the errors of the degraded tunnel\n%s", out.String())
+	}
+}
+
+func TestStatusWatcherCoalesces(t *testing.T) {
+	registry := newStatusRegistry()
+	registry.register("cashfree", kindWorkload, 8080, "http")
+	registry.register("10.120.52.48:5432", kindBastion, 5435, "postgres")
+	statuses, watcher, unwatch := registry.watch()
+	defer unwatch()
+	if len(statuses) != 2 {
+		t.Fatalf("watch failed: expected the initial statuses, got %+v", statuses)
+	}
+
+	// a watcher that does not keep up gets the latest status of each tunnel, none is dropped
+	for range 100 {
+		registry.setState("cashfree", stateBackoff, errors.New("connection refused"))
+		registry.setState("cashfree", stateRunning, nil)
+	}
+	registry.setState("10.120.52.48:5432", stateFailed, errors.New("exit status 255"))
+	registry.setState("cashfree", statePaused, nil)
+	select {
+	case <-watcher.changed():
+	default:
+		t.Fatal("changed failed: expected pending changes")
+	}
+	changes := watcher.take()
+	if len(changes) != 2 || changes[0].Name != "cashfree" || changes[0].State != statePaused || changes[1].State != stateFailed {
+		t.Errorf("take failed: expected the latest status of both tunnels, got %+v", changes)
+	}
+	if changes := watcher.take(); len(changes) != 0 {
+		t.Errorf("take failed: expected no changes left, got %+v", changes)
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"time"
+)
+
+// dumpStatusOnSignal prints a snapshot of every tunnel to out whenever the process
+// receives one of the status signals, until the context is canceled
+func dumpStatusOnSignal(ctx context.Context, registry *statusRegistry, out io.Writer) {
+	if len(statusSignals) == 0 {
+		return
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, statusSignals...)
+	defer signal.Stop(ch)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ch:
+			fmt.Fprintf(out, "Status at %s:\n", time.Now().Format(time.TimeOnly))
+			writeStatusTable(out, registry.snapshot())
+		}
+	}
+}
@@ -0,0 +1,11 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// statusSignals are SIGUSR1 and SIGINFO, which the terminal sends on Ctrl-T
+var statusSignals = []os.Signal{syscall.SIGUSR1, syscall.SIGINFO}
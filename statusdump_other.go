@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// statusSignals is empty, there are no user signals on this platform
+var statusSignals []os.Signal
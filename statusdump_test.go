@@ -0,0 +1,62 @@
+//go:build unix
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer that can be written and read concurrently
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestDumpStatusOnSignal(t *testing.T) {
+	registry := newStatusRegistry()
+	registry.register("cashfree", kindWorkload, 8080, "http")
+	registry.setState("cashfree", stateBackoff, ErrNoRunningPod)
+	registry.addRestart("cashfree")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	out := &syncBuffer{}
+	done := make(chan struct{})
+	go func() {
+		dumpStatusOnSignal(ctx, registry, out)
+		close(done)
+	}()
+	// wait for the handler to be installed, SIGUSR1 would otherwise kill the test binary
+	time.Sleep(100 * time.Millisecond)
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatalf("Error sending SIGUSR1: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(out.String(), "cashfree") && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	dump := out.String()
+	if !strings.HasPrefix(dump, "Status at ") || !strings.Contains(dump, stateBackoff) || !strings.Contains(dump, ErrNoRunningPod.Error()) {
+		t.Errorf("dumpStatusOnSignal failed: unexpected dump %q", dump)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build unix && !(darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// statusSignals is SIGUSR1, there is no SIGINFO on this platform
+var statusSignals = []os.Signal{syscall.SIGUSR1}
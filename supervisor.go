@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	stateStarting = "starting"
+	stateRunning  = "running"
+	stateBackoff  = "backoff"
+	stateFailed   = "failed"
+	stateDegraded = "degraded"
+	stateStopped  = "stopped"
+	statePaused   = "paused"
+)
+
+const (
+	minRestartBackoff = time.Second
+	maxRestartBackoff = time.Minute
+	// a tunnel that ran for stableRunDuration before exiting restarts with the minimum backoff
+	stableRunDuration = time.Minute
+)
+
+// ErrUnknownTunnel is returned for actions on a tunnel that is not part of the session
+var ErrUnknownTunnel = errors.New("unknown tunnel")
+
+// ErrTunnelState is returned for pausing a paused tunnel or resuming a running one
+var ErrTunnelState = errors.New("tunnel is already")
+
+// supervisor runs the child process of every tunnel, restarts the ones that exit, and waits
+// for all of them to terminate when the session's context is canceled
+type supervisor struct {
+	ctx        context.Context
+	registry   *statusRegistry
+	restart    bool
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	stableRun  time.Duration
+	breaker    CircuitBreaker
+	wg         sync.WaitGroup
+
+	mu      sync.Mutex
+	tunnels map[string]*supervisedTunnel
+}
+
+// supervisedTunnel is the child process of one tunnel
+type supervisedTunnel struct {
+	run func(ctx context.Context) error
+	// cancel stops the current run, nil while the tunnel is not supervised
+	cancel context.CancelFunc
+	// restart is signaled to restart the tunnel right away, or to stop it when it is paused
+	restart chan struct{}
+	// paused tunnels keep their slot in the session without a child process
+	paused bool
+	// runs counts the restart loops started, so that a finished loop does not stop the next one
+	runs int
+}
+
+func newSupervisor(ctx context.Context, registry *statusRegistry, restart bool) *supervisor {
+	return &supervisor{ctx: ctx, registry: registry, restart: restart, minBackoff: minRestartBackoff, maxBackoff: maxRestartBackoff,
+		stableRun: stableRunDuration, tunnels: make(map[string]*supervisedTunnel)}
+}
+
+// supervise runs the tunnel in the background. run starts the tunnel's child process and
+// blocks until it exits; it is called again with exponential backoff when it returns
+// before the session ends, unless restarts are disabled.
+func (s *supervisor) supervise(name string, run func(ctx context.Context) error) {
+	tunnel := &supervisedTunnel{run: run, restart: make(chan struct{}, 1)}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tunnels[name] = tunnel
+	s.start(name, tunnel)
+}
+
+// start runs the tunnel's restart loop, the caller holds s.mu
+func (s *supervisor) start(name string, tunnel *supervisedTunnel) {
+	ctx, cancel := context.WithCancel(s.ctx)
+	tunnel.cancel = cancel
+	tunnel.runs++
+	run := tunnel.runs
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer s.stopped(tunnel, run)
+		backoff := s.minBackoff
+		lastHint := ""
+		// failures are the recent failures the circuit breaker counts
+		var failures []time.Time
+		degraded := false
+		for {
+			s.registry.setState(name, stateRunning, nil)
+			started := time.Now()
+			err := tunnel.run(ctx)
+			if s.ctx.Err() != nil {
+				s.registry.setState(name, stateStopped, nil)
+				return
+			}
+			if s.restartRequested(tunnel) {
+				if s.pausedNow(name, tunnel) {
+					return
+				}
+				fmt.Printf("Restarting tunnel %s\n", name)
+				s.registry.addRestart(name)
+				ctx = s.renew(tunnel)
+				continue
+			}
+			if err == nil {
+				err = fmt.Errorf("tunnel exited")
+			}
+			if !s.restart {
+				s.registry.setState(name, stateFailed, err)
+				fmt.Printf("Error: tunnel %s stopped: %v\n", name, err)
+				printHint(err)
+				return
+			}
+			// a stable run only resets the backoff, the failures age out of the breaker's
+			// window so that a tunnel failing every few minutes still trips it
+			if time.Since(started) >= s.stableRun {
+				backoff = s.minBackoff
+			}
+			var tripped bool
+			failures, tripped = s.breaker.record(failures, time.Now())
+			wait := backoff
+			if tripped {
+				wait = s.breaker.retryAfter()
+				s.registry.setState(name, stateDegraded, err)
+				if !degraded {
+					s.reportDegraded(name, len(failures))
+				} else {
+					fmt.Printf("Error: degraded tunnel %s stopped: %v, retrying in %s\n", name, err, wait)
+				}
+				degraded = true
+			} else {
+				degraded = false
+				s.registry.setState(name, stateBackoff, err)
+				fmt.Printf("Error: tunnel %s stopped: %v, restarting in %s\n", name, err, backoff)
+			}
+			// the hint is only repeated when the cause of the failures changes
+			hint := remediationHint(err)
+			if hint != "" && hint != lastHint {
+				fmt.Println("Hint:", hint)
+			}
+			lastHint = hint
+			select {
+			case <-time.After(wait):
+				if !tripped {
+					backoff = min(2*backoff, s.maxBackoff)
+				}
+			case <-tunnel.restart:
+				backoff = s.minBackoff
+				failures, degraded = nil, false
+			case <-s.ctx.Done():
+				s.registry.setState(name, stateStopped, nil)
+				return
+			}
+			if s.pausedNow(name, tunnel) {
+				return
+			}
+			// every reconnection calls the APIs again, a storm of them must not exhaust the quota
+			if !waitQuota(s.ctx, name) {
+				s.registry.setState(name, stateStopped, nil)
+				return
+			}
+			s.registry.addRestart(name)
+			ctx = s.renew(tunnel)
+		}
+	}()
+}
+
+// reportDegraded prints that the tunnel tripped the circuit breaker, with its last errors
+func (s *supervisor) reportDegraded(name string, failures int) {
+	fmt.Printf("Error: tunnel %s failed %d times in %s and is degraded, it is only retried every %s. Its last errors:\n",
+		name, failures, s.breaker.window(), s.breaker.retryAfter())
+	for _, status := range s.registry.snapshot() {
+		if status.Name == name {
+			for _, err := range status.RecentErrors {
+				fmt.Println("  " + err)
+			}
+		}
+	}
+	fmt.Printf("Hint: fix the cause and restart it with devcli restart %s, or r in the session\n", name)
+}
+
+// restartRequested reports whether the last run was stopped by restartTunnel
+func (s *supervisor) restartRequested(tunnel *supervisedTunnel) bool {
+	select {
+	case <-tunnel.restart:
+		return true
+	default:
+		return false
+	}
+}
+
+// renew replaces the context of the tunnel's run after the previous one was canceled
+func (s *supervisor) renew(tunnel *supervisedTunnel) context.Context {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tunnel.cancel()
+	ctx, cancel := context.WithCancel(s.ctx)
+	tunnel.cancel = cancel
+	return ctx
+}
+
+// pausedNow reports whether the tunnel was paused, which ends its restart loop
+func (s *supervisor) pausedNow(name string, tunnel *supervisedTunnel) bool {
+	s.mu.Lock()
+	paused := tunnel.paused
+	if paused {
+		// a resume from now on starts a new restart loop
+		tunnel.cancel()
+		tunnel.cancel = nil
+	}
+	s.mu.Unlock()
+	if paused {
+		s.registry.setState(name, statePaused, nil)
+		fmt.Printf("Paused tunnel %s\n", name)
+	}
+	return paused
+}
+
+// stopped marks the tunnel as no longer supervised when its restart loop ends, unless a
+// newer loop was started since
+func (s *supervisor) stopped(tunnel *supervisedTunnel, run int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if tunnel.runs != run || tunnel.cancel == nil {
+		return
+	}
+	tunnel.cancel()
+	tunnel.cancel = nil
+}
+
+// restartTunnel stops the tunnel's child process and starts it again right away. A tunnel
+// that failed and is no longer supervised is started again.
+func (s *supervisor) restartTunnel(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tunnel, ok := s.tunnels[name]
+	if !ok {
+		return fmt.Errorf("%w %s", ErrUnknownTunnel, name)
+	}
+	if s.ctx.Err() != nil {
+		return s.ctx.Err()
+	}
+	tunnel.paused = false
+	if tunnel.cancel == nil {
+		s.registry.addRestart(name)
+		s.start(name, tunnel)
+		return nil
+	}
+	s.interrupt(tunnel)
+	return nil
+}
+
+// restartFailed restarts every tunnel that failed or waits for its next restart right away,
+// returning their names
+func (s *supervisor) restartFailed() []string {
+	var restarted []string
+	for _, status := range s.registry.snapshot() {
+		if status.State != stateFailed && status.State != stateBackoff && status.State != stateDegraded {
+			continue
+		}
+		if err := s.restartTunnel(status.Name); err == nil {
+			restarted = append(restarted, status.Name)
+		}
+	}
+	return restarted
+}
+
+// interrupt stops the tunnel's current run, or its wait for the next one, the caller holds s.mu
+func (s *supervisor) interrupt(tunnel *supervisedTunnel) {
+	select {
+	case tunnel.restart <- struct{}{}:
+	default:
+	}
+	tunnel.cancel()
+}
+
+// pauseTunnel stops the tunnel's child process and keeps it in the session until it is
+// resumed, freeing its local port in the meantime
+func (s *supervisor) pauseTunnel(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tunnel, ok := s.tunnels[name]
+	if !ok {
+		return fmt.Errorf("%w %s", ErrUnknownTunnel, name)
+	}
+	if tunnel.paused {
+		return fmt.Errorf("%w paused: %s", ErrTunnelState, name)
+	}
+	tunnel.paused = true
+	if tunnel.cancel == nil {
+		// a failed tunnel has no child process left to stop
+		s.registry.setState(name, statePaused, nil)
+		return nil
+	}
+	s.interrupt(tunnel)
+	return nil
+}
+
+// resumeTunnel starts a paused tunnel again
+func (s *supervisor) resumeTunnel(name string) error {
+	s.mu.Lock()
+	tunnel, ok := s.tunnels[name]
+	paused := ok && tunnel.paused
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w %s", ErrUnknownTunnel, name)
+	}
+	if !paused {
+		return fmt.Errorf("%w running: %s", ErrTunnelState, name)
+	}
+	fmt.Printf("Resuming tunnel %s\n", name)
+	return s.restartTunnel(name)
+}
+
+// wait blocks until every supervised tunnel has terminated
+func (s *supervisor) wait() {
+	s.wg.Wait()
+}
+
+// waitStopped blocks until every supervised tunnel has terminated, for at most timeout once
+// the session's context is canceled. It returns false when some tunnel is still running.
+func (s *supervisor) waitStopped(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-s.ctx.Done():
+	}
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSupervisorRestarts(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	registry := newStatusRegistry()
+	registry.register("cashfree", kindWorkload, 8080, "http")
+	s := newSupervisor(ctx, registry, true)
+	s.minBackoff, s.maxBackoff = 10*time.Millisecond, 40*time.Millisecond
+
+	var runs atomic.Int32
+	s.supervise("cashfree", func(ctx context.Context) error {
+		runs.Add(1)
+		return errors.New("port-forward exited")
+	})
+	time.Sleep(200 * time.Millisecond)
+	cancel()
+	s.wait()
+
+	status := registry.snapshot()[0]
+	if runs.Load() < 3 || status.Restarts != int(runs.Load())-1 {
+		t.Errorf("supervisor failed: expected restarts after every run, got %d runs and %d restarts", runs.Load(), status.Restarts)
+	}
+	if status.State != stateStopped || status.LastError != "port-forward exited" {
+		t.Errorf("supervisor failed: unexpected status %+v", status)
+	}
+}
+
+func TestSupervisorWaitsForTunnels(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	registry := newStatusRegistry()
+	registry.register("10.120.52.48:5432", kindBastion, 5435, "postgres")
+	registry.register("cashfree", kindWorkload, 8080, "http")
+	s := newSupervisor(ctx, registry, false)
+
+	var stopped atomic.Bool
+	s.supervise("10.120.52.48:5432", func(ctx context.Context) error {
+		<-ctx.Done()
+		time.Sleep(50 * time.Millisecond)
+		stopped.Store(true)
+		return ctx.Err()
+	})
+	s.supervise("cashfree", func(ctx context.Context) error {
+		return errors.New("no running pod")
+	})
+	time.Sleep(50 * time.Millisecond)
+	if state := registry.snapshot()[1].State; state != stateFailed {
+		t.Errorf("supervisor failed: expected %s without restarts, got %s", stateFailed, state)
+	}
+	cancel()
+	s.wait()
+	if !stopped.Load() {
+		t.Error("supervisor failed: wait returned before the tunnel terminated")
+	}
+}
+
+func TestSupervisorRestartTunnel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	registry := newStatusRegistry()
+	registry.register("cashfree", kindWorkload, 8080, "http")
+	registry.register("10.120.52.48:5432", kindBastion, 5435, "postgres")
+	s := newSupervisor(ctx, registry, false)
+
+	var runs atomic.Int32
+	s.supervise("cashfree", func(ctx context.Context) error {
+		runs.Add(1)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	s.supervise("10.120.52.48:5432", func(ctx context.Context) error {
+		return errors.New("connection refused")
+	})
+	time.Sleep(50 * time.Millisecond)
+
+	if err := s.restartTunnel("cashfree"); err != nil {
+		t.Fatalf("restartTunnel failed: %v", err)
+	}
+	if err := s.restartTunnel("10.120.52.48:5432"); err != nil {
+		t.Fatalf("restartTunnel failed: %v", err)
+	}
+	if err := s.restartTunnel("payments"); !errors.Is(err, ErrUnknownTunnel) {
+		t.Errorf("restartTunnel failed: expected %v, got %v", ErrUnknownTunnel, err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	statuses := registry.snapshot()
+	if runs.Load() != 2 || statuses[0].State != stateRunning || statuses[0].Restarts != 1 {
+		t.Errorf("restartTunnel failed: expected a second run of cashfree, got %d runs and status %+v", runs.Load(), statuses[0])
+	}
+	if statuses[1].State != stateFailed || statuses[1].Restarts != 1 {
+		t.Errorf("restartTunnel failed: expected a failed tunnel to run again, got status %+v", statuses[1])
+	}
+	cancel()
+	s.wait()
+}
+
+func TestSupervisorPauseTunnel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	registry := newStatusRegistry()
+	registry.register("cashfree", kindWorkload, 8080, "http")
+	s := newSupervisor(ctx, registry, true)
+
+	var runs, running atomic.Int32
+	s.supervise("cashfree", func(ctx context.Context) error {
+		runs.Add(1)
+		running.Add(1)
+		defer running.Add(-1)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	time.Sleep(50 * time.Millisecond)
+
+	if err := s.pauseTunnel("cashfree"); err != nil {
+		t.Fatalf("pauseTunnel failed: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if state := registry.snapshot()[0].State; state != statePaused || running.Load() != 0 {
+		t.Errorf("pauseTunnel failed: expected a stopped tunnel in state %s, got %s with %d running", statePaused, state, running.Load())
+	}
+	if err := s.pauseTunnel("cashfree"); !errors.Is(err, ErrTunnelState) {
+		t.Errorf("pauseTunnel failed: expected %v pausing a paused tunnel, got %v", ErrTunnelState, err)
+	}
+
+	if err := s.resumeTunnel("cashfree"); err != nil {
+		t.Fatalf("resumeTunnel failed: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if state := registry.snapshot()[0].State; state != stateRunning || runs.Load() != 2 || running.Load() != 1 {
+		t.Errorf("resumeTunnel failed: expected a second run, got state %s and %d runs", state, runs.Load())
+	}
+	if err := s.resumeTunnel("cashfree"); !errors.Is(err, ErrTunnelState) {
+		t.Errorf("resumeTunnel failed: expected %v resuming a running tunnel, got %v", ErrTunnelState, err)
+	}
+	if err := s.pauseTunnel("payments"); !errors.Is(err, ErrUnknownTunnel) {
+		t.Errorf("pauseTunnel failed: expected %v, got %v", ErrUnknownTunnel, err)
+	}
+	cancel()
+	s.wait()
+}
+
+func TestSupervisorRestartFailed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	registry := newStatusRegistry()
+	registry.register("cashfree", kindWorkload, 8080, "http")
+	registry.register("ledger", kindWorkload, 8081, "http")
+	s := newSupervisor(ctx, registry, false)
+	s.supervise("cashfree", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	s.supervise("ledger", func(ctx context.Context) error {
+		return errors.New("no running pod")
+	})
+	time.Sleep(50 * time.Millisecond)
+
+	if restarted := s.restartFailed(); len(restarted) != 1 || restarted[0] != "ledger" {
+		t.Errorf("restartFailed failed: expected ledger only, got %v", restarted)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if restarts := registry.snapshot()[1].Restarts; restarts != 1 {
+		t.Errorf("restartFailed failed: expected one restart of ledger, got %d", restarts)
+	}
+	cancel()
+	s.wait()
+}
+
+func TestSupervisorCircuitBreaker(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	registry := newStatusRegistry()
+	registry.register("cashfree", kindWorkload, 8080, "http")
+	s := newSupervisor(ctx, registry, true)
+	s.minBackoff, s.maxBackoff = time.Millisecond, time.Millisecond
+	s.breaker = CircuitBreaker{Restarts: 2, Window: time.Minute, RetryAfter: time.Hour}
+
+	var runs atomic.Int32
+	s.supervise("cashfree", func(ctx context.Context) error {
+		runs.Add(1)
+		return errors.New("pod not found")
+	})
+	time.Sleep(100 * time.Millisecond)
+	status := registry.snapshot()[0]
+	if runs.Load() != 3 || status.State != stateDegraded {
+		t.Errorf("circuit breaker failed: expected a degraded tunnel after 3 runs, got %d runs and %+v", runs.Load(), status)
+	}
+	if len(status.RecentErrors) != 3 || status.RecentErrors[2] != "pod not found" {
+		t.Errorf("circuit breaker failed: unexpected recent errors %v", status.RecentErrors)
+	}
+
+	// a manual restart retries the degraded tunnel right away
+	if got := s.restartFailed(); len(got) != 1 {
+		t.Errorf("restartFailed failed: expected the degraded tunnel, got %v", got)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if runs.Load() != 6 {
+		t.Errorf("circuit breaker failed: expected the restart to reset the breaker, got %d runs", runs.Load())
+	}
+}
+
+func TestSupervisorBreakerAfterStableRuns(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	registry := newStatusRegistry()
+	registry.register("cashfree", kindWorkload, 8080, "http")
+	s := newSupervisor(ctx, registry, true)
+	s.minBackoff, s.maxBackoff, s.stableRun = time.Millisecond, time.Millisecond, 10*time.Millisecond
+	s.breaker = CircuitBreaker{Restarts: 2, Window: time.Minute, RetryAfter: time.Hour}
+
+	// every run is stable, yet the failures stay within the window
+	var runs atomic.Int32
+	s.supervise("cashfree", func(ctx context.Context) error {
+		runs.Add(1)
+		time.Sleep(20 * time.Millisecond)
+		return errors.New("connection reset")
+	})
+	time.Sleep(200 * time.Millisecond)
+	if status := registry.snapshot()[0]; runs.Load() != 3 || status.State != stateDegraded {
+		t.Errorf("circuit breaker failed: expected a degraded tunnel after 3 stable runs, got %d runs and %+v", runs.Load(), status)
+	}
+}
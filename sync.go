@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// SyncItem is a ConfigMap or Secret of the environment's cluster written to local files,
+// one per key, so that a service run locally gets the configuration of its pods
+type SyncItem struct {
+	Namespace string `yaml:"namespace"`
+	ConfigMap string `yaml:"configmap"`
+	Secret    string `yaml:"secret"`
+	// Path is the directory of the files, ~ standing for the home directory
+	Path string `yaml:"path"`
+	// Keys are the keys written, every key when empty
+	Keys []string `yaml:"keys"`
+}
+
+// kind returns the kubectl resource kind and name of the item
+func (s SyncItem) kind() (string, string) {
+	if s.Secret != "" {
+		return "secret", s.Secret
+	}
+	return "configmap", s.ConfigMap
+}
+
+func (s SyncItem) String() string {
+	kind, name := s.kind()
+	return fmt.Sprintf("%s %s/%s", kind, s.Namespace, name)
+}
+
+// validateSync checks that every item names a single ConfigMap or Secret and a directory of
+// its own
+func validateSync(config ProxyConfig) error {
+	paths := make(map[string]bool)
+	for _, item := range config.Sync {
+		if (item.ConfigMap == "") == (item.Secret == "") {
+			return errors.New("every sync item sets one of configmap and secret")
+		}
+		if item.Namespace == "" || item.Path == "" {
+			return fmt.Errorf("sync of %s needs a namespace and a path", item)
+		}
+		if paths[item.Path] {
+			return fmt.Errorf("sync path %s is used more than once", item.Path)
+		}
+		paths[item.Path] = true
+	}
+	return nil
+}
+
+// syncArgs are the kubectl arguments getting the item as json
+func syncArgs(item SyncItem) []string {
+	kind, name := item.kind()
+	return []string{"get", kind, name, "-n", item.Namespace, "-o", "json"}
+}
+
+// syncedData returns the content of every key of the ConfigMap or Secret of the output of
+// syncArgs, only the item's keys when it has some
+func syncedData(item SyncItem, out []byte) (map[string][]byte, error) {
+	var resource struct {
+		Data       map[string]string `json:"data"`
+		BinaryData map[string]string `json:"binaryData"`
+	}
+	if err := json.Unmarshal(out, &resource); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", item, err)
+	}
+	data := make(map[string][]byte)
+	for key, value := range resource.Data {
+		if item.Secret == "" {
+			data[key] = []byte(value)
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("decoding key %s of %s: %w", key, item, err)
+		}
+		data[key] = decoded
+	}
+	for key, value := range resource.BinaryData {
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("decoding key %s of %s: %w", key, item, err)
+		}
+		data[key] = decoded
+	}
+	for _, key := range item.Keys {
+		if _, ok := data[key]; !ok {
+			return nil, fmt.Errorf("%s has no key %s", item, key)
+		}
+	}
+	if len(item.Keys) > 0 {
+		maps.DeleteFunc(data, func(key string, _ []byte) bool { return !slices.Contains(item.Keys, key) })
+	}
+	return data, nil
+}
+
+// syncDir returns the directory of the item, ~ standing for the home directory
+func syncDir(item SyncItem) (string, error) {
+	dir := item.Path
+	if dir == "~" || strings.HasPrefix(dir, "~/") {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(homeDir, dir[1:])
+	}
+	return dir, nil
+}
+
+// writeSynced writes every key to a file of the directory, readable by the user only, and
+// returns the keys whose content changed. A file is replaced at once so that a service
+// reading it never sees half of it.
+func writeSynced(dir string, data map[string][]byte) ([]string, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	var changed []string
+	for _, key := range slices.Sorted(maps.Keys(data)) {
+		if strings.ContainsAny(key, `/\`) || key == "." || key == ".." {
+			return nil, fmt.Errorf("key %s is not a valid file name", key)
+		}
+		file := filepath.Join(dir, key)
+		if current, err := os.ReadFile(file); err == nil && bytes.Equal(current, data[key]) {
+			continue
+		}
+		tmp := file + ".tmp"
+		if err := os.WriteFile(tmp, data[key], 0o600); err != nil {
+			return nil, err
+		}
+		if err := os.Rename(tmp, file); err != nil {
+			os.Remove(tmp)
+			return nil, err
+		}
+		changed = append(changed, key)
+	}
+	return changed, nil
+}
+
+// syncItem fetches the item and writes its keys, printing the keys that changed
+func syncItem(ctx context.Context, runner *commandRunner, kubeContext string, item SyncItem) error {
+	out, err := runner.output(ctx, kubectlCommand(ctx, Workload{kubeContext: kubeContext}, syncArgs(item)...))
+	if err != nil {
+		return fmt.Errorf("getting %s: %w", item, err)
+	}
+	data, err := syncedData(item, out)
+	if err != nil {
+		return err
+	}
+	dir, err := syncDir(item)
+	if err != nil {
+		return err
+	}
+	changed, err := writeSynced(dir, data)
+	if err != nil {
+		return fmt.Errorf("writing %s to %s: %w", item, dir, err)
+	}
+	if len(changed) > 0 {
+		fmt.Printf("Synced %s to %s: %s\n", item, dir, strings.Join(changed, ", "))
+	}
+	return nil
+}
+
+// syncResources writes the ConfigMaps and Secrets of the environment to their files. A
+// failed item keeps the files of its last sync.
+func syncResources(ctx context.Context, runner *commandRunner, kubeContext string, items []SyncItem) {
+	for _, item := range items {
+		if err := syncItem(ctx, runner, kubeContext, item); err != nil && ctx.Err() == nil {
+			fmt.Println("Error:", err)
+			printHint(err)
+		}
+	}
+}
+
+// refreshSynced syncs the ConfigMaps and Secrets again every interval until the context is
+// canceled, so that the local files follow the cluster's
+func refreshSynced(ctx context.Context, runner *commandRunner, kubeContext string, items []SyncItem, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		syncResources(ctx, runner, kubeContext, items)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSyncedData(t *testing.T) {
+	secret := SyncItem{Namespace: "enr", Secret: "cashfree-credentials", Path: "secrets"}
+	data, err := syncedData(secret, []byte(`{"kind": "Secret", "data": {"api-key": "c2VjcmV0", "webhook-key": "d2g="}}`))
+	if err != nil || string(data["api-key"]) != "secret" || string(data["webhook-key"]) != "wh" {
+		t.Errorf("syncedData failed: unexpected data %q, %v", data, err)
+	}
+	secret.Keys = []string{"api-key"}
+	if data, err := syncedData(secret, []byte(`{"data": {"api-key": "c2VjcmV0", "webhook-key": "d2g="}}`)); err != nil || len(data) != 1 {
+		t.Errorf("syncedData failed: expected only api-key, got %q, %v", data, err)
+	}
+	secret.Keys = []string{"token"}
+	if _, err := syncedData(secret, []byte(`{"data": {"api-key": "c2VjcmV0"}}`)); err == nil || !strings.Contains(err.Error(), "no key token") {
+		t.Errorf("syncedData failed: expected a missing key, got %v", err)
+	}
+
+	configMap := SyncItem{Namespace: "enr", ConfigMap: "cashfree-config", Path: "config"}
+	data, err = syncedData(configMap, []byte(`{"data": {"application.yaml": "port: 8080\n"}, "binaryData": {"ca.der": "AAE="}}`))
+	if err != nil || string(data["application.yaml"]) != "port: 8080\n" || !slices.Equal(data["ca.der"], []byte{0, 1}) {
+		t.Errorf("syncedData failed: unexpected data %q, %v", data, err)
+	}
+	if args := strings.Join(syncArgs(configMap), " "); args != "get configmap cashfree-config -n enr -o json" {
+		t.Errorf("syncArgs failed: unexpected arguments %s", args)
+	}
+}
+
+func TestWriteSynced(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "cashfree")
+	changed, err := writeSynced(dir, map[string][]byte{"api-key": []byte("secret"), "webhook-key": []byte("wh")})
+	if err != nil || !slices.Equal(changed, []string{"api-key", "webhook-key"}) {
+		t.Fatalf("writeSynced failed: unexpected changes %v, %v", changed, err)
+	}
+	info, err := os.Stat(filepath.Join(dir, "api-key"))
+	if err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("writeSynced failed: expected a file readable by the user only, got %v, %v", info, err)
+	}
+	changed, err = writeSynced(dir, map[string][]byte{"api-key": []byte("rotated"), "webhook-key": []byte("wh")})
+	if err != nil || !slices.Equal(changed, []string{"api-key"}) {
+		t.Errorf("writeSynced failed: expected only the rotated key to change, got %v, %v", changed, err)
+	}
+	if _, err := writeSynced(dir, map[string][]byte{"../escape": nil}); err == nil {
+		t.Error("writeSynced failed: expected a key outside the directory to be refused")
+	}
+}
+
+func TestValidateSync(t *testing.T) {
+	for _, tc := range []struct {
+		items []SyncItem
+		valid bool
+	}{
+		{[]SyncItem{{Namespace: "enr", Secret: "cashfree", Path: "a"}, {Namespace: "enr", ConfigMap: "cashfree", Path: "b"}}, true},
+		{[]SyncItem{{Namespace: "enr", Secret: "cashfree", ConfigMap: "cashfree", Path: "a"}}, false},
+		{[]SyncItem{{Namespace: "enr", Secret: "cashfree"}}, false},
+		{[]SyncItem{{Namespace: "enr", Secret: "cashfree", Path: "a"}, {Namespace: "enr", ConfigMap: "cashfree", Path: "a"}}, false},
+	} {
+		if err := validateSync(ProxyConfig{Sync: tc.items}); (err == nil) != tc.valid {
+			t.Errorf("validateSync(%+v) failed: expected valid %v, got %v", tc.items, tc.valid, err)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+)
+
+// tmuxLayouts are the tmux layouts the panes of the tunnel logs may be arranged in
+var tmuxLayouts = []string{"tiled", "even-horizontal", "even-vertical", "main-horizontal", "main-vertical"}
+
+// Tmux lays out the tmux session of devcli tmux: the dashboard window and a window with a
+// pane tailing each tunnel's output
+type Tmux struct {
+	// Layout is the tmux layout of the panes, tiled by default
+	Layout string `yaml:"layout"`
+	// Tunnels are the tunnels with a pane, every tunnel of the session when empty
+	Tunnels []string `yaml:"tunnels"`
+}
+
+func (t Tmux) layout() string {
+	if t.Layout == "" {
+		return "tiled"
+	}
+	return t.Layout
+}
+
+// validate checks the layout
+func (t Tmux) validate() error {
+	if !slices.Contains(tmuxLayouts, t.layout()) {
+		return fmt.Errorf("unknown tmux layout %q, expected one of %s", t.Layout, strings.Join(tmuxLayouts, ", "))
+	}
+	return nil
+}
+
+// tmuxSession is the name of the tmux session of the environment
+func tmuxSession(environment string) string {
+	return "devcli-" + environment
+}
+
+// tmuxCommands returns the tmux commands creating the session of the environment: the
+// dashboard window runs the session in the foreground, or attaches to the running one, and
+// the logs window has a pane tailing each tunnel
+func tmuxCommands(environment, executable string, startArgs, tunnels []string, layout string, running bool) [][]string {
+	session := tmuxSession(environment)
+	dashboard := append([]string{executable, "start", "-env", environment}, startArgs...)
+	if running {
+		dashboard = []string{executable, "attach", "-env", environment}
+	}
+	commands := [][]string{{"new-session", "-d", "-s", session, "-n", "dashboard", shellJoin(dashboard)}}
+	for i, tunnel := range tunnels {
+		tail := shellJoin([]string{executable, "attach", "-env", environment, "-wait", "-tunnel", tunnel})
+		if i == 0 {
+			commands = append(commands, []string{"new-window", "-d", "-t", session, "-n", "logs", tail})
+			continue
+		}
+		// the layout is applied after every split so that there is room for the next pane
+		commands = append(commands,
+			[]string{"split-window", "-d", "-t", session + ":logs", tail},
+			[]string{"select-layout", "-t", session + ":logs", layout})
+	}
+	return commands
+}
+
+// shellJoin quotes the arguments into the shell command line tmux runs
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// runTmux implements devcli tmux, which creates the tmux session of an environment, or
+// reuses it, and attaches to it
+func runTmux(args []string) {
+	var opts options
+	fs := flag.NewFlagSet("devcli tmux", flag.ExitOnError)
+	startFlags(fs, &opts)
+	parseStartArgs(fs, &opts, args)
+	if _, err := exec.LookPath("tmux"); err != nil {
+		fmt.Println("Error: tmux is not installed or not in the PATH.")
+		os.Exit(1)
+	}
+
+	confFile, err := configPath(opts.confFile)
+	if err != nil {
+		fmt.Println("Error getting user home directory:", err)
+		os.Exit(1)
+	}
+	config, err := readConfig(confFile)
+	if err != nil {
+		fmt.Println("Error reading configuration file:", err)
+		os.Exit(1)
+	}
+	err = selectEnvironment(&config, opts)
+	if err == nil {
+		err = chooseEnvironment(&config)
+	}
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	proxyConfig, err := findProxyConfig(config)
+	if err == nil {
+		proxyConfig, err = applyProfile(config, proxyConfig, opts)
+	}
+	if err == nil {
+		err = proxyConfig.Tmux.validate()
+	}
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	tunnels := sessionTunnels(proxyConfig)
+	if len(proxyConfig.Tmux.Tunnels) > 0 {
+		tunnels = slices.DeleteFunc(tunnels, func(name string) bool { return !slices.Contains(proxyConfig.Tmux.Tunnels, name) })
+	}
+
+	session := tmuxSession(proxyConfig.Environment)
+	if exec.Command("tmux", "has-session", "-t", "="+session).Run() != nil {
+		executable, err := os.Executable()
+		if err != nil {
+			fmt.Println("Error finding the devcli executable:", err)
+			os.Exit(1)
+		}
+		running := false
+		if socket, err := sessionSocket(proxyConfig.Environment); err == nil {
+			if conn, err := net.DialTimeout("unix", socket, time.Second); err == nil {
+				conn.Close()
+				running = true
+			}
+		}
+		for _, command := range tmuxCommands(proxyConfig.Environment, executable, args, tunnels, proxyConfig.Tmux.layout(), running) {
+			if out, err := exec.Command("tmux", command...).CombinedOutput(); err != nil {
+				fmt.Printf("Error running tmux %s: %v: %s\n", command[0], err, strings.TrimSpace(string(out)))
+				os.Exit(1)
+			}
+		}
+	}
+
+	// inside tmux the client switches to the session, it cannot attach to another one
+	action := "attach-session"
+	if os.Getenv("TMUX") != "" {
+		action = "switch-client"
+	}
+	cmd := exec.Command("tmux", action, "-t", session)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		fmt.Printf("Error attaching to tmux session %s: %v\n", session, err)
+		os.Exit(1)
+	}
+}
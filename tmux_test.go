@@ -0,0 +1,37 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTmuxCommands(t *testing.T) {
+	commands := tmuxCommands("staging", "/usr/local/bin/devcli", []string{"-tags", "db"}, []string{"cashfree", "10.120.52.48:5432"}, "tiled", false)
+	var lines []string
+	for _, command := range commands {
+		lines = append(lines, strings.Join(command, " "))
+	}
+	expected := []string{
+		"new-session -d -s devcli-staging -n dashboard '/usr/local/bin/devcli' 'start' '-env' 'staging' '-tags' 'db'",
+		"new-window -d -t devcli-staging -n logs '/usr/local/bin/devcli' 'attach' '-env' 'staging' '-wait' '-tunnel' 'cashfree'",
+		"split-window -d -t devcli-staging:logs '/usr/local/bin/devcli' 'attach' '-env' 'staging' '-wait' '-tunnel' '10.120.52.48:5432'",
+		"select-layout -t devcli-staging:logs tiled",
+	}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("tmuxCommands failed: expected\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(lines, "\n"))
+	}
+
+	commands = tmuxCommands("staging", "devcli", nil, nil, "tiled", true)
+	if len(commands) != 1 || !strings.Contains(commands[0][len(commands[0])-1], "'attach'") {
+		t.Errorf("tmuxCommands failed: expected the dashboard to attach to the running session, got %v", commands)
+	}
+}
+
+func TestTmuxValidate(t *testing.T) {
+	if err := (Tmux{}).validate(); err != nil {
+		t.Errorf("validate failed: expected the default layout to be valid, got %v", err)
+	}
+	if err := (Tmux{Layout: "grid"}).validate(); err == nil {
+		t.Error("validate failed: expected an unknown layout to be rejected")
+	}
+}
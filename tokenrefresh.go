@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	// tokenRefreshMargin is how long before the gcloud access token expires it is refreshed,
+	// so that a failed refresh is noticed while the tunnels still work
+	tokenRefreshMargin = 5 * time.Minute
+	// tokenRetryInterval is how soon a failed refresh is tried again
+	tokenRetryInterval = time.Minute
+)
+
+// configHelperArgs are the gcloud arguments printing the access token and its expiry,
+// refreshing the token first when force is set
+func configHelperArgs(force bool) []string {
+	args := []string{"config", "config-helper", "--format", "json"}
+	if force {
+		args = append(args, "--force-auth-refresh")
+	}
+	return args
+}
+
+// parseTokenExpiry returns the expiry of the access token of the output of configHelperArgs
+func parseTokenExpiry(out []byte) (time.Time, error) {
+	var helper struct {
+		Credential struct {
+			TokenExpiry string `json:"token_expiry"`
+		} `json:"credential"`
+	}
+	if err := json.Unmarshal(out, &helper); err != nil {
+		return time.Time{}, err
+	}
+	if helper.Credential.TokenExpiry == "" {
+		return time.Time{}, errors.New("gcloud did not report the expiry of the access token")
+	}
+	return time.Parse(time.RFC3339, helper.Credential.TokenExpiry)
+}
+
+// tokenRefreshWait returns how long to wait before the next refresh of the token expiring
+// at expiry, never less than tokenRetryInterval
+func tokenRefreshWait(expiry, now time.Time) time.Duration {
+	return max(expiry.Sub(now)-tokenRefreshMargin, tokenRetryInterval)
+}
+
+// authFailed reports whether the tunnel stopped because the credentials expired
+func authFailed(status tunnelStatus) bool {
+	switch status.State {
+	case stateFailed, stateBackoff, stateDegraded:
+		return strings.Contains(status.LastError, "["+string(ClassAuthExpired)+"]")
+	}
+	return false
+}
+
+// refreshCredentials refreshes the gcloud access token the cluster credentials and the
+// bastion connections are derived from shortly before it expires, for as long as the
+// session runs. The runner asks the user to log in again when the refresh needs it, and
+// the tunnels that failed on the expired credentials meanwhile are restarted right away.
+func refreshCredentials(ctx context.Context, runner *commandRunner, supervisor *supervisor) {
+	refresh := func(force bool) (time.Time, error) {
+		cmd := exec.CommandContext(ctx, "gcloud", configHelperArgs(force)...)
+		cmd.Stderr = logger.Writer("gcloud")
+		out, err := runner.output(ctx, cmd)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return parseTokenExpiry(out)
+	}
+	expiry, err := refresh(false)
+	for {
+		wait := tokenRetryInterval
+		if err == nil {
+			wait = tokenRefreshWait(expiry, time.Now())
+			narratef("The gcloud access token expires at %s, refreshing it in %s\n", expiry.Local().Format(time.Kitchen), wait.Round(time.Second))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		if expiry, err = refresh(true); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			fmt.Printf("Warning: refreshing the gcloud credentials failed, the tunnels may fail once they expire: %v\n", err)
+			printHint(err)
+			continue
+		}
+		var restarted []string
+		for _, status := range supervisor.registry.snapshot() {
+			if authFailed(status) && supervisor.restartTunnel(status.Name) == nil {
+				restarted = append(restarted, status.Name)
+			}
+		}
+		if len(restarted) > 0 {
+			fmt.Printf("Refreshed the gcloud credentials, restarted %s.\n", strings.Join(restarted, ", "))
+		}
+	}
+}
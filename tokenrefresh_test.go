@@ -0,0 +1,46 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTokenExpiry(t *testing.T) {
+	out := `{"configuration": {"active_configuration": "default"}, "credential": {"access_token": "ya29.token", "token_expiry": "2026-10-15T11:23:45Z"}}`
+	expiry, err := parseTokenExpiry([]byte(out))
+	if err != nil || !expiry.Equal(time.Date(2026, 10, 15, 11, 23, 45, 0, time.UTC)) {
+		t.Errorf("parseTokenExpiry failed: unexpected expiry %v and error %v", expiry, err)
+	}
+	if _, err := parseTokenExpiry([]byte(`{"credential": {"access_token": "ya29.token"}}`)); err == nil {
+		t.Errorf("parseTokenExpiry failed: expected an error without expiry")
+	}
+	if args := strings.Join(configHelperArgs(true), " "); args != "config config-helper --format json --force-auth-refresh" {
+		t.Errorf("configHelperArgs failed: unexpected arguments %s", args)
+	}
+}
+
+func TestTokenRefreshWait(t *testing.T) {
+	now := time.Date(2026, 10, 15, 10, 0, 0, 0, time.UTC)
+	if wait := tokenRefreshWait(now.Add(time.Hour), now); wait != 55*time.Minute {
+		t.Errorf("tokenRefreshWait failed: expected 55m, got %s", wait)
+	}
+	// a token about to expire, or expired, is refreshed after the retry interval
+	if wait := tokenRefreshWait(now.Add(2*time.Minute), now); wait != tokenRetryInterval {
+		t.Errorf("tokenRefreshWait failed: expected %s, got %s", tokenRetryInterval, wait)
+	}
+}
+
+func TestAuthFailed(t *testing.T) {
+	expired := "kubectl port-forward: exit status 1 [auth_expired]: error: You must be logged in to the server (Unauthorized)"
+	for status, expected := range map[*tunnelStatus]bool{
+		{State: stateBackoff, LastError: expired}:                      true,
+		{State: stateDegraded, LastError: expired}:                     true,
+		{State: stateRunning, LastError: expired}:                      false,
+		{State: stateFailed, LastError: "exit status 1 [broken_pipe]"}: false,
+	} {
+		if got := authFailed(*status); got != expected {
+			t.Errorf("authFailed(%+v) failed: expected %v, got %v", *status, expected, got)
+		}
+	}
+}
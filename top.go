@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"slices"
+	"text/tabwriter"
+	"time"
+)
+
+// tunnelMeter counts the traffic of a tunnel relayed by its meter relay
+type tunnelMeter struct {
+	registry *statusRegistry
+	name     string
+}
+
+func (m *tunnelMeter) connOpened(int, net.Addr) {
+	m.registry.recordTraffic(m.name, 1, 0, 0)
+}
+
+func (m *tunnelMeter) connData(_ int, fromClient bool, data []byte) {
+	if fromClient {
+		m.registry.recordTraffic(m.name, 0, int64(len(data)), 0)
+	} else {
+		m.registry.recordTraffic(m.name, 0, 0, int64(len(data)))
+	}
+}
+
+func (m *tunnelMeter) connClosed(int) {
+	m.registry.recordTraffic(m.name, -1, 0, 0)
+}
+
+// runMeterRelay serves the tunnel's local port through a relay counting its traffic and
+// limiting its connections, either may be nil, until the context is canceled or the session
+// drains its connections
+func runMeterRelay(ctx context.Context, draining <-chan struct{}, name string, localPort, targetPort int, meter relayObserver, limit *connectionLimit) {
+	r := &relay{listenPort: localPort, targetPort: targetPort, observer: meter, limit: limit, draining: draining}
+	if err := r.run(ctx); err != nil {
+		fmt.Printf("Error running the meter relay of %s: %v\n", name, err)
+	}
+}
+
+// topRow is the throughput of a tunnel between two status samples, in bytes per second
+type topRow struct {
+	status   tunnelStatus
+	sent     float64
+	received float64
+}
+
+// topRows returns the throughput of every tunnel since the previous sample, the busiest
+// tunnels first, then the ones with the most open connections
+func topRows(previous, current []tunnelStatus, elapsed time.Duration) []topRow {
+	last := make(map[string]tunnelStatus, len(previous))
+	for _, status := range previous {
+		last[status.Name] = status
+	}
+	rows := make([]topRow, 0, len(current))
+	for _, status := range current {
+		row := topRow{status: status}
+		if before, ok := last[status.Name]; ok && elapsed > 0 {
+			// the counters of a tunnel only grow, unless its session was restarted
+			if status.BytesSent >= before.BytesSent && status.BytesReceived >= before.BytesReceived {
+				row.sent = float64(status.BytesSent-before.BytesSent) / elapsed.Seconds()
+				row.received = float64(status.BytesReceived-before.BytesReceived) / elapsed.Seconds()
+			}
+		}
+		rows = append(rows, row)
+	}
+	slices.SortStableFunc(rows, func(a, b topRow) int {
+		if a.sent+a.received != b.sent+b.received {
+			if a.sent+a.received > b.sent+b.received {
+				return -1
+			}
+			return 1
+		}
+		return b.status.Connections - a.status.Connections
+	})
+	return rows
+}
+
+// writeTopTable prints the throughput of the tunnels as an aligned table in a single write
+func writeTopTable(w io.Writer, rows []topRow) {
+	var b bytes.Buffer
+	tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TUNNEL\tLOCAL PORT\tSTATE\tCONNS\tSENT/S\tRECEIVED/S\tSENT\tRECEIVED")
+	for _, row := range rows {
+		s := row.status
+		if !s.Metered {
+			fmt.Fprintf(tw, "%s\t%d\t%s\t-\t-\t-\t-\t-\n", s.Name, s.LocalPort, s.State)
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%d\t%s\t%s\t%s\t%s\n", s.Name, s.LocalPort, s.State, s.Connections,
+			formatBytes(row.sent), formatBytes(row.received), formatBytes(float64(s.BytesSent)), formatBytes(float64(s.BytesReceived)))
+	}
+	tw.Flush()
+	w.Write(b.Bytes())
+}
+
+// formatBytes formats a byte count with a binary unit, e.g. 1.5 MiB
+func formatBytes(n float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	i := 0
+	for n >= 1024 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0f %s", n, units[i])
+	}
+	return fmt.Sprintf("%.1f %s", n, units[i])
+}
+
+// runTop implements devcli top, which shows the throughput and open connections of every
+// tunnel of a running session, refreshed until interrupted. Only the tunnels of sessions
+// started with -meter are measured.
+func runTop(args []string) {
+	fs := flag.NewFlagSet("devcli top", flag.ExitOnError)
+	environment := fs.String("env", "", "Environment of the session, optional when a single session is running")
+	interval := fs.Duration("interval", time.Second, "How often to refresh the view")
+	fs.Parse(args)
+	if *interval <= 0 {
+		fmt.Println("Error: -interval must be positive")
+		os.Exit(2)
+	}
+	name, client := connectSession(*environment)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	var previous []tunnelStatus
+	var sampled time.Time
+	for {
+		requestCtx, cancel := context.WithTimeout(ctx, localCommandTimeout)
+		statuses, err := client.status(requestCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			fmt.Printf("Error getting the status of the session of environment %s: %v\n", name, err)
+			os.Exit(1)
+		}
+		now := time.Now()
+		var b bytes.Buffer
+		if stdoutTerminal {
+			// move to the top left corner and clear the screen, like top
+			b.WriteString("\x1b[H\x1b[2J")
+		}
+		fmt.Fprintf(&b, "Environment %s, every %s:\n", name, *interval)
+		writeTopTable(&b, topRows(previous, statuses, now.Sub(sampled)))
+		if !slices.ContainsFunc(statuses, func(s tunnelStatus) bool { return s.Metered }) {
+			fmt.Fprintln(&b, "Hint: start the session with -meter to measure the traffic of its tunnels")
+		}
+		if !stdoutTerminal {
+			fmt.Fprintln(&b)
+		}
+		os.Stdout.Write(b.Bytes())
+		previous, sampled = statuses, now
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
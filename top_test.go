@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMeterRelay(t *testing.T) {
+	echo, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Error creating listener: %v", err)
+	}
+	defer echo.Close()
+	go func() {
+		for {
+			conn, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	port, err := freeLocalPort()
+	if err != nil {
+		t.Fatalf("Error allocating port: %v", err)
+	}
+	registry := newStatusRegistry()
+	registry.register("cashfree", kindWorkload, port, "http")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go runMeterRelay(ctx, nil, "cashfree", port, echo.Addr().(*net.TCPAddr).Port, registry.meter("cashfree"), nil)
+
+	conn := dialRelay(t, port)
+	conn.Write([]byte("ping"))
+	reply := make([]byte, 4)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		t.Fatalf("meter relay failed: %v", err)
+	}
+	status := registry.snapshot()[0]
+	if !status.Metered || status.Connections != 1 || status.BytesSent != 4 || status.BytesReceived != 4 {
+		t.Errorf("meter relay failed: unexpected status %+v", status)
+	}
+	conn.Close()
+	time.Sleep(50 * time.Millisecond)
+	if status := registry.snapshot()[0]; status.Connections != 0 {
+		t.Errorf("meter relay failed: expected no open connection, got %d", status.Connections)
+	}
+}
+
+func TestTopRows(t *testing.T) {
+	previous := []tunnelStatus{
+		{Name: "cashfree", Metered: true, BytesSent: 100, BytesReceived: 1000},
+		{Name: "payments", Metered: true, BytesReceived: 5000},
+	}
+	current := []tunnelStatus{
+		{Name: "cashfree", Metered: true, BytesSent: 300, BytesReceived: 5000, Connections: 1},
+		{Name: "payments", Metered: true, BytesReceived: 5000, Connections: 3},
+		{Name: "10.120.52.48:5432", Metered: true, BytesReceived: 10},
+		{Name: "api-server"},
+	}
+	rows := topRows(previous, current, 2*time.Second)
+	var names []string
+	for _, row := range rows {
+		names = append(names, row.status.Name)
+	}
+	if strings.Join(names, ",") != "cashfree,payments,10.120.52.48:5432,api-server" {
+		t.Errorf("topRows failed: unexpected order %v", names)
+	}
+	if rows[0].sent != 100 || rows[0].received != 2000 {
+		t.Errorf("topRows failed: expected 100 B/s sent and 2000 B/s received, got %v and %v", rows[0].sent, rows[0].received)
+	}
+
+	var b strings.Builder
+	writeTopTable(&b, rows)
+	if !strings.Contains(b.String(), "2.0 KiB") || !strings.Contains(b.String(), "api-server") {
+		t.Errorf("writeTopTable failed: unexpected table\n%s", b.String())
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	for n, expected := range map[float64]string{0: "0 B", 1023: "1023 B", 1536: "1.5 KiB", 3 << 30: "3.0 GiB"} {
+		if got := formatBytes(n); got != expected {
+			t.Errorf("formatBytes(%v) failed: expected %s, got %s", n, expected, got)
+		}
+	}
+}
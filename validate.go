@@ -0,0 +1,273 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// runValidate implements devcli validate, which checks the configuration file without
+// starting anything. With -lint it also warns about setups that work but are likely mistakes.
+func runValidate(args []string) {
+	fs := flag.NewFlagSet("devcli validate", flag.ExitOnError)
+	confFile := fs.String("conf", "", "Path to the configuration file")
+	lint := fs.Bool("lint", false, "Also warn about likely mistakes that do not stop a session")
+	fs.Parse(args)
+
+	path, err := configPath(*confFile)
+	if err != nil {
+		fmt.Println("Error getting user home directory:", err)
+		os.Exit(1)
+	}
+	config, err := readConfig(path)
+	if err != nil {
+		fmt.Println("Error reading configuration file:", err)
+		os.Exit(1)
+	}
+
+	problems := validateConfig(config)
+	for _, problem := range problems {
+		fmt.Println("Error:", problem)
+	}
+	var warnings []string
+	if *lint {
+		warnings = lintConfig(config)
+		for _, warning := range warnings {
+			fmt.Println("Warning:", warning)
+		}
+	}
+	if len(problems) > 0 {
+		fmt.Printf("%s has %s and %s.\n", path, count(len(problems), "error"), count(len(warnings), "warning"))
+		os.Exit(1)
+	}
+	fmt.Printf("%s is valid, with %s.\n", path, count(len(warnings), "warning"))
+}
+
+// count returns n followed by the noun, in plural unless n is 1
+func count(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// validateConfig returns the errors that stop a session of any of the environments
+func validateConfig(config Config) []string {
+	var problems []string
+	environments := make(map[string]bool)
+	for _, proxy := range config.Proxies {
+		if environments[proxy.Environment] {
+			problems = append(problems, fmt.Sprintf("environment %s is configured more than once", proxy.Environment))
+		}
+		environments[proxy.Environment] = true
+		if _, err := validateLocalPorts(proxy); err != nil {
+			problems = append(problems, fmt.Sprintf("environment %s: %v", proxy.Environment, err))
+		}
+		for _, err := range validateEnvironment(proxy) {
+			problems = append(problems, fmt.Sprintf("environment %s: %v", proxy.Environment, err))
+		}
+	}
+	for _, err := range validateSections(config) {
+		problems = append(problems, err.Error())
+	}
+	if config.Environment != "" && !environments[config.Environment] {
+		problems = append(problems, fmt.Sprintf("default environment %s is not configured", config.Environment))
+	}
+	for _, profile := range config.Profiles {
+		if profile.Environment != "" && !environments[profile.Environment] {
+			problems = append(problems, fmt.Sprintf("profile %s uses environment %s, which is not configured", profile.Name, profile.Environment))
+		}
+	}
+	for _, policy := range config.Policies {
+		for _, environment := range policy.Environments {
+			if !environments[environment] {
+				problems = append(problems, fmt.Sprintf("policy %s applies to environment %s, which is not configured", policy.Name, environment))
+			}
+		}
+	}
+	return problems
+}
+
+// validateEnvironment returns the errors of the environment's configuration that stop its
+// session, but for the local ports, which are reported on their own
+func validateEnvironment(proxy ProxyConfig) []error {
+	var errs []error
+	if err := validateWorkloads(proxy); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateKubeContext(proxy); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateMaxSession(proxy); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateShutdownGrace(proxy); err != nil {
+		errs = append(errs, err)
+	}
+	if err := proxy.CircuitBreaker.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateConnectionLimits(proxy); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateBastionType(proxy); err != nil {
+		errs = append(errs, err)
+	}
+	if err := proxy.ServiceManifests.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateSync(proxy); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateHostKeys(proxy); err != nil {
+		errs = append(errs, err)
+	}
+	if err := proxy.APIQuota.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	for _, webhook := range proxy.Webhooks {
+		if err := webhook.validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if proxy.AllowedHours.enabled() {
+		if _, err := proxy.AllowedHours.parse(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := validateChaosRules(proxy); err != nil {
+		errs = append(errs, err)
+	}
+	if err := proxy.Tmux.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := proxy.Approval.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if proxy.APIProxy.enabled() {
+		if err := proxy.APIProxy.validate(proxy); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// validateSections returns the errors of the sections of the configuration shared by the
+// environments
+func validateSections(config Config) []error {
+	var errs []error
+	if err := config.Reporting.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := config.CloudLogging.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	for _, policy := range config.Policies {
+		if err := policy.validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// validateSession returns the errors of the configuration that stop a session of the
+// environment
+func validateSession(config Config, proxy ProxyConfig) []error {
+	return append(validateEnvironment(proxy), validateSections(config)...)
+}
+
+// lintConfig returns warnings about configurations that work but are likely mistakes
+func lintConfig(config Config) []string {
+	var warnings []string
+	warn := func(proxy ProxyConfig, format string, args ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf("environment %s: ", proxy.Environment)+fmt.Sprintf(format, args...))
+	}
+
+	for _, proxy := range config.Proxies {
+		// ports only root can listen on
+		for _, workload := range proxy.Workloads {
+			if workload.LocalPort < 1024 {
+				warn(proxy, "workload %s listens on port %d, ports below 1024 need root", workload.Name(), workload.LocalPort)
+			}
+		}
+		for _, connection := range proxy.Bastion.Connections {
+			if connection.LocalPort < 1024 {
+				warn(proxy, "connection %s listens on port %d, ports below 1024 need root", connection.Name(), connection.LocalPort)
+			}
+		}
+		if proxy.APIProxy.enabled() && proxy.APIProxy.LocalPort < 1024 {
+			warn(proxy, "api_proxy listens on port %d, ports below 1024 need root", proxy.APIProxy.LocalPort)
+		}
+
+		// workloads selecting the same pods, and forwarding the same port of them
+		selectors := make(map[string]Workload)
+		targets := make(map[string]Workload)
+		for _, workload := range proxy.Workloads {
+			pods := workload.pods()
+			selector := fmt.Sprintf("%s/%s/%s/%s", workload.Project, workload.Cluster, workload.Namespace, pods)
+			target := fmt.Sprintf("%s:%d", selector, workload.RemotePort)
+			if other, ok := targets[target]; ok && workload.RemotePort != 0 {
+				warn(proxy, "workloads on ports %d and %d forward the same port %d of %s/%s", other.LocalPort, workload.LocalPort, workload.RemotePort, workload.Namespace, workload.Name())
+			} else if other, ok := selectors[selector]; ok {
+				warn(proxy, "workloads on ports %d and %d select the same pods %s in namespace %s", other.LocalPort, workload.LocalPort, pods, workload.Namespace)
+			}
+			selectors[selector] = workload
+			targets[target] = workload
+		}
+
+		// connections forwarding the same remote address
+		remotes := make(map[string]Connection)
+		for _, connection := range proxy.Bastion.Connections {
+			remote := connection.Project + "/" + connection.Name()
+			if other, ok := remotes[remote]; ok {
+				warn(proxy, "connections on ports %d and %d both forward %s", other.LocalPort, connection.LocalPort, connection.Name())
+			}
+			remotes[remote] = connection
+		}
+
+		// connections reaching a workload's service through the bastion
+		for _, connection := range proxy.Bastion.Connections {
+			for _, workload := range proxy.Workloads {
+				if connection.RemotePort == workload.RemotePort && isServiceHost(connection.RemoteHost, workload) {
+					warn(proxy, "connection %s on port %d duplicates workload %s, which already forwards it on port %d", connection.Name(), connection.LocalPort, workload.Name(), workload.LocalPort)
+				}
+			}
+		}
+
+		// bastions trusting whatever host key they are first shown
+		if usesIAPBastion(proxy) && proxy.Bastion.HostKeyPolicy == "" {
+			warn(proxy, "bastion %s sets no host_key_policy, its host key is trusted on first use", proxy.Bastion.Name)
+		}
+	}
+
+	// environments neither the default nor started by a profile
+	if len(config.Profiles) > 0 {
+		referenced := map[string]bool{config.Environment: true}
+		for _, profile := range config.Profiles {
+			referenced[profile.Environment] = true
+		}
+		for _, proxy := range config.Proxies {
+			if !referenced[proxy.Environment] {
+				warnings = append(warnings, fmt.Sprintf("environment %s is neither the default nor used by a profile", proxy.Environment))
+			}
+		}
+	}
+	return warnings
+}
+
+// isServiceHost reports whether host is the cluster DNS name of a service named after the
+// workload's app
+func isServiceHost(host string, workload Workload) bool {
+	if workload.App == "" {
+		return false
+	}
+	name := workload.App + "." + workload.Namespace
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, suffix := range []string{"", ".svc", ".svc.cluster.local"} {
+		if host == name+suffix {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateConfig(t *testing.T) {
+	config := Config{
+		Environment: "qa",
+		Proxies: []ProxyConfig{
+			{Environment: "staging", Workloads: []Workload{{App: "cashfree", LocalPort: 8080}, {App: "ledger", LocalPort: 8080}}},
+			{Environment: "staging", APIProxy: APIProxy{LocalPort: 8001, Mode: "ssh"}},
+		},
+		Profiles: []Profile{{Name: "payments", Environment: "prod"}},
+	}
+	problems := strings.Join(validateConfig(config), "\n")
+	for _, expected := range []string{
+		"environment staging is configured more than once",
+		"environment staging: duplicate local ports 8080 (workload cashfree, workload ledger)",
+		`unknown api_proxy mode "ssh"`,
+		"default environment qa is not configured",
+		"profile payments uses environment prod, which is not configured",
+	} {
+		if !strings.Contains(problems, expected) {
+			t.Errorf("validateConfig failed: expected %q in\n%s", expected, problems)
+		}
+	}
+	valid := Config{Environment: "staging", Proxies: []ProxyConfig{{Environment: "staging", Workloads: []Workload{{App: "cashfree", LocalPort: 8080}}}}}
+	if problems := validateConfig(valid); len(problems) != 0 {
+		t.Errorf("validateConfig failed: unexpected problems %v", problems)
+	}
+}
+
+func TestLintConfig(t *testing.T) {
+	config := Config{
+		Environment: "staging",
+		Proxies: []ProxyConfig{
+			{
+				Environment: "staging",
+				Workloads: []Workload{
+					{Namespace: "enr", App: "cashfree", LocalPort: 80, RemotePort: 8080},
+					{Namespace: "enr", App: "cashfree", LocalPort: 8081, RemotePort: 8080},
+					{Namespace: "enr", App: "cashfree", LocalPort: 9090, RemotePort: 9090},
+				},
+				Bastion: Bastion{Connections: []Connection{
+					{LocalPort: 5435, RemoteHost: "10.120.52.48", RemotePort: 5432},
+					{LocalPort: 5436, RemoteHost: "10.120.52.48", RemotePort: 5432},
+					{LocalPort: 8090, RemoteHost: "cashfree.enr.svc.cluster.local", RemotePort: 9090},
+				}},
+			},
+			{Environment: "prod"},
+		},
+		Profiles: []Profile{{Name: "payments", Tags: []string{"payments"}}},
+	}
+	warnings := strings.Join(lintConfig(config), "\n")
+	for _, expected := range []string{
+		"workload cashfree listens on port 80, ports below 1024 need root",
+		"workloads on ports 80 and 8081 forward the same port 8080 of enr/cashfree",
+		"workloads on ports 8081 and 9090 select the same pods app=cashfree in namespace enr",
+		"connections on ports 5435 and 5436 both forward 10.120.52.48:5432",
+		"connection cashfree.enr.svc.cluster.local:9090 on port 8090 duplicates workload cashfree, which already forwards it on port 9090",
+		"environment prod is neither the default nor used by a profile",
+	} {
+		if !strings.Contains(warnings, expected) {
+			t.Errorf("lintConfig failed: expected %q in\n%s", expected, warnings)
+		}
+	}
+	if strings.Contains(warnings, "environment staging is neither") {
+		t.Errorf("lintConfig failed: the default environment is referenced\n%s", warnings)
+	}
+}
+
+func TestValidateSession(t *testing.T) {
+	proxy := ProxyConfig{
+		Environment:    "staging",
+		Workloads:      []Workload{{App: "cashfree", LocalPort: 8080}},
+		Bastion:        Bastion{Type: "cloudflare"},
+		CircuitBreaker: CircuitBreaker{Restarts: -1},
+		Webhooks:       []Webhook{{URL: "https://hooks.slack.com/services/T0", Payload: "{{.Tunnel"}},
+	}
+	config := Config{
+		Proxies:   []ProxyConfig{proxy},
+		Reporting: Reporting{BigQuery: "devcli.sessions"},
+		Policies:  []Policy{{Name: "payments"}},
+	}
+	var problems []string
+	for _, err := range validateSession(config, proxy) {
+		problems = append(problems, err.Error())
+	}
+	joined := strings.Join(problems, "\n")
+	for _, expected := range []string{"cloudflare", "circuit_breaker", "webhook", "bigquery", "policy payments"} {
+		if !strings.Contains(joined, expected) {
+			t.Errorf("validateSession failed: expected %q in\n%s", expected, joined)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// MinVersions are the oldest versions of the tools a session accepts. Older tools are
+// reported with a warning, or stop the session when Enforce is set.
+type MinVersions struct {
+	Gcloud     string `yaml:"gcloud"`
+	Kubectl    string `yaml:"kubectl"`
+	AuthPlugin string `yaml:"gke_gcloud_auth_plugin"`
+	Enforce    bool   `yaml:"enforce"`
+}
+
+// toolVersion is how the version of a tool is read and upgraded
+type toolVersion struct {
+	name    string
+	args    []string
+	parse   func(out []byte) (string, error)
+	minimum string
+	upgrade string
+}
+
+// versionPattern matches the first dotted version number of a tool's output
+var versionPattern = regexp.MustCompile(`v?(\d+(?:\.\d+)+)`)
+
+// parseVersionText returns the first version number of the output
+func parseVersionText(out []byte) (string, error) {
+	match := versionPattern.FindSubmatch(out)
+	if match == nil {
+		return "", fmt.Errorf("no version in %q", strings.TrimSpace(string(out)))
+	}
+	return string(match[1]), nil
+}
+
+// parseKubectlVersion returns the client version of kubectl version --client -o json
+func parseKubectlVersion(out []byte) (string, error) {
+	var version struct {
+		ClientVersion struct {
+			GitVersion string `json:"gitVersion"`
+		} `json:"clientVersion"`
+	}
+	if err := json.Unmarshal(out, &version); err != nil {
+		return "", err
+	}
+	return parseVersionText([]byte(version.ClientVersion.GitVersion))
+}
+
+// compareVersions compares dotted version numbers, returning -1, 0 or 1. Missing parts
+// count as 0, so 1.28 equals 1.28.0.
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < max(len(as), len(bs)); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// requiredVersions returns the tools of the session that have a minimum version
+func requiredVersions(minimum MinVersions, config ProxyConfig) []toolVersion {
+	var tools []toolVersion
+	if minimum.Gcloud != "" {
+		tools = append(tools, toolVersion{"gcloud", []string{"gcloud", "version"}, parseVersionText, minimum.Gcloud, "gcloud components update"})
+	}
+	if usesClusters(config) && minimum.Kubectl != "" {
+		tools = append(tools, toolVersion{"kubectl", []string{"kubectl", "version", "--client", "-o", "json"}, parseKubectlVersion, minimum.Kubectl, "gcloud components update kubectl, or upgrade the kubectl of your package manager"})
+	}
+	if usesClusters(config) && minimum.AuthPlugin != "" {
+		tools = append(tools, toolVersion{"gke-gcloud-auth-plugin", []string{"gke-gcloud-auth-plugin", "--version"}, parseVersionText, minimum.AuthPlugin, "gcloud components update gke-gcloud-auth-plugin"})
+	}
+	return tools
+}
+
+// checkToolVersions returns a line for every tool of the session older than its minimum
+// version, with the command upgrading it. Tools whose version cannot be read are warned
+// about and skipped.
+func checkToolVersions(ctx context.Context, minimum MinVersions, config ProxyConfig) []string {
+	var outdated []string
+	for _, tool := range requiredVersions(minimum, config) {
+		version, err := readToolVersion(ctx, tool)
+		if err != nil {
+			fmt.Printf("Warning: the version of %s cannot be read: %v\n", tool.name, err)
+			continue
+		}
+		if compareVersions(version, tool.minimum) < 0 {
+			outdated = append(outdated, fmt.Sprintf("%s %s is older than %s, upgrade it with %s", tool.name, version, tool.minimum, tool.upgrade))
+		}
+	}
+	return outdated
+}
+
+// readToolVersion runs the tool's version command and parses its output
+func readToolVersion(ctx context.Context, tool toolVersion) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, localCommandTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, tool.args[0], tool.args[1:]...)
+	started := commandStarted(cmd)
+	out, err := cmd.Output()
+	commandFinished(cmd, started, err)
+	if err != nil {
+		return "", err
+	}
+	return tool.parse(out)
+}
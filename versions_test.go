@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"1.28", "1.28.0", 0},
+		{"1.27.9", "1.28", -1},
+		{"1.30.1", "1.28", 1},
+		{"470.0.0", "470.0.0", 0},
+		{"469.0.0", "470.0.0", -1},
+	}
+	for _, test := range tests {
+		if result := compareVersions(test.a, test.b); result != test.expected {
+			t.Errorf("compareVersions(%s, %s) failed: expected %d, got %d", test.a, test.b, test.expected, result)
+		}
+	}
+}
+
+func TestParseVersions(t *testing.T) {
+	gcloud := "Google Cloud SDK 470.0.0\nbq 2.1.2\ncore 2024.03.29\ngsutil 5.27\n"
+	if version, err := parseVersionText([]byte(gcloud)); err != nil || version != "470.0.0" {
+		t.Errorf("parseVersionText failed for gcloud: got %s, %v", version, err)
+	}
+	plugin := "Kubernetes v1.28.2-alpha+ae4e8e9cd3c6a3fa3e4ff8c0c4ab2a3e1a0fcab0\n"
+	if version, err := parseVersionText([]byte(plugin)); err != nil || version != "1.28.2" {
+		t.Errorf("parseVersionText failed for the auth plugin: got %s, %v", version, err)
+	}
+	if _, err := parseVersionText([]byte("unknown")); err == nil {
+		t.Error("parseVersionText failed: expected an error without a version")
+	}
+	kubectl := `{"clientVersion": {"major": "1", "minor": "27", "gitVersion": "v1.27.3", "platform": "darwin/arm64"}, "kustomizeVersion": "v5.0.1"}`
+	if version, err := parseKubectlVersion([]byte(kubectl)); err != nil || version != "1.27.3" {
+		t.Errorf("parseKubectlVersion failed: got %s, %v", version, err)
+	}
+}
+
+func TestRequiredVersions(t *testing.T) {
+	minimum := MinVersions{Gcloud: "470.0.0", Kubectl: "1.28", AuthPlugin: "1.26"}
+	connections := ProxyConfig{Bastion: Bastion{Connections: []Connection{{LocalPort: 5435}}}}
+	if tools := requiredVersions(minimum, connections); len(tools) != 1 || tools[0].name != "gcloud" {
+		t.Errorf("requiredVersions failed: expected only gcloud without workloads, got %v", tools)
+	}
+	workloads := ProxyConfig{Workloads: []Workload{{App: "cashfree"}}}
+	if tools := requiredVersions(minimum, workloads); len(tools) != 3 {
+		t.Errorf("requiredVersions failed: expected gcloud, kubectl and the auth plugin, got %v", tools)
+	}
+	if tools := requiredVersions(MinVersions{}, workloads); len(tools) != 0 {
+		t.Errorf("requiredVersions failed: expected no tools without minimum versions, got %v", tools)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+// eventTypes are the events webhooks can filter on
+var eventTypes = []string{eventTunnelStarted, eventTunnelFailed, eventTunnelStopped, eventPodSwitched, eventSessionReady, eventSessionEnded}
+
+// Webhook posts the lifecycle events of the sessions of an environment to a URL, e.g. a
+// Slack incoming webhook or a team's own automation
+type Webhook struct {
+	URL string `yaml:"url"`
+	// Events are the types of the events posted, every event when empty
+	Events []string `yaml:"events"`
+	// Payload is the body posted, a text/template executed with the event. The event is
+	// posted as JSON when it is empty.
+	Payload string `yaml:"payload"`
+	// ContentType is the content type of the body, application/json when empty
+	ContentType string `yaml:"content_type"`
+	// Headers are added to the request, $VARIABLES in their values are expanded from the
+	// environment so that tokens stay out of the configuration
+	Headers map[string]string `yaml:"headers"`
+}
+
+// webhookFuncs are the functions available in payload templates
+var webhookFuncs = template.FuncMap{
+	// json quotes a value as JSON, e.g. an error message in a JSON payload
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// validate checks the URL, the event types and the payload template of the webhook
+func (w Webhook) validate() error {
+	if !strings.HasPrefix(w.URL, "https://") && !strings.HasPrefix(w.URL, "http://") {
+		return fmt.Errorf("webhook url %q is not an http(s) URL", w.URL)
+	}
+	for _, event := range w.Events {
+		if !slices.Contains(eventTypes, event) {
+			return fmt.Errorf("webhook %s: unknown event %q, expected one of %s", w.URL, event, strings.Join(eventTypes, ", "))
+		}
+	}
+	if _, err := w.template(); err != nil {
+		return fmt.Errorf("webhook %s: %w", w.URL, err)
+	}
+	return nil
+}
+
+// template parses the payload template, nil when the event is posted as JSON
+func (w Webhook) template() (*template.Template, error) {
+	if w.Payload == "" {
+		return nil, nil
+	}
+	return template.New("payload").Funcs(webhookFuncs).Option("missingkey=error").Parse(w.Payload)
+}
+
+// matches reports whether the webhook posts events of the type
+func (w Webhook) matches(eventType string) bool {
+	return len(w.Events) == 0 || slices.Contains(w.Events, eventType)
+}
+
+// body returns the payload posted for the event
+func (w Webhook) body(tmpl *template.Template, event lifecycleEvent) ([]byte, error) {
+	if tmpl == nil {
+		return json.Marshal(event)
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, event); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// post posts the event to the webhook
+func (w Webhook) post(ctx context.Context, tmpl *template.Template, event lifecycleEvent) error {
+	body, err := w.body(tmpl, event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	contentType := w.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	req.Header.Set("Content-Type", contentType)
+	for name, value := range w.Headers {
+		req.Header.Set(name, os.ExpandEnv(value))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// postTo posts the events to the webhooks, each one in order. A failure is only warned
+// about, webhooks never stop a session.
+func (l *eventLog) postTo(webhooks []Webhook) {
+	for _, webhook := range webhooks {
+		tmpl, err := webhook.template()
+		if err != nil {
+			fmt.Printf("Error: the payload of webhook %s is not a valid template, not posting to it: %v\n", webhook.URL, err)
+			continue
+		}
+		l.addOutput("webhook "+webhook.URL, reportTimeout, func(events <-chan lifecycleEvent) {
+			for event := range events {
+				if !webhook.matches(event.Type) {
+					continue
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), reportTimeout)
+				if err := webhook.post(ctx, tmpl, event); err != nil {
+					fmt.Printf("Warning: posting the %s event to webhook %s failed: %v\n", event.Type, webhook.URL, err)
+				}
+				cancel()
+			}
+		})
+	}
+}
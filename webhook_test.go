@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebhookPost(t *testing.T) {
+	t.Setenv("DEVCLI_TEST_TOKEN", "secret")
+	bodies := make(chan string, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("webhook failed: unexpected authorization %q", r.Header.Get("Authorization"))
+		}
+		body, _ := io.ReadAll(r.Body)
+		bodies <- string(body)
+	}))
+	defer server.Close()
+
+	log := newEventLog("staging")
+	log.postTo([]Webhook{{
+		URL:     server.URL,
+		Events:  []string{eventTunnelFailed},
+		Payload: `{"text": {{json (printf "%s: tunnel %s failed: %s" .Environment .Tunnel .Error)}}}`,
+		Headers: map[string]string{"Authorization": "Bearer $DEVCLI_TEST_TOKEN"},
+	}})
+	log.tunnelState("cashfree", stateStarting, stateRunning, nil)
+	log.tunnelState("cashfree", stateRunning, stateBackoff, errors.New(`pod "cashfree-1" not found`))
+	log.close()
+
+	if len(bodies) != 1 {
+		t.Fatalf("webhook failed: expected only the failure to be posted, got %d events", len(bodies))
+	}
+	expected := `{"text": "staging: tunnel cashfree failed: pod \"cashfree-1\" not found"}`
+	if body := <-bodies; body != expected {
+		t.Errorf("webhook failed: expected body %s, got %s", expected, body)
+	}
+}
+
+func TestWebhookValidate(t *testing.T) {
+	for _, webhook := range []Webhook{
+		{URL: "hooks.slack.com/services/T0"},
+		{URL: "https://hooks.slack.com/services/T0", Events: []string{"tunnel_exploded"}},
+		{URL: "https://hooks.slack.com/services/T0", Payload: "{{.Tunnel"},
+	} {
+		if err := webhook.validate(); err == nil {
+			t.Errorf("validate failed: expected an error for %+v", webhook)
+		}
+	}
+	if err := (Webhook{URL: "https://hooks.slack.com/services/T0", Events: []string{eventSessionReady}}).validate(); err != nil {
+		t.Errorf("validate failed: unexpected error %v", err)
+	}
+}
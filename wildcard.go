@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// wildcard reports whether the workload's app is a pattern like payments-*, expanded at
+// startup to a workload per matching Deployment
+func (w Workload) wildcard() bool {
+	return strings.ContainsAny(w.App, "*?[")
+}
+
+// validateWildcard checks the pattern of a wildcard workload, which forwards its apps to
+// the local ports from its local_port on
+func validateWildcard(workload Workload) error {
+	if !workload.wildcard() {
+		return nil
+	}
+	if _, err := path.Match(workload.App, ""); err != nil {
+		return fmt.Errorf("workload %s has an invalid app pattern: %w", workload.App, err)
+	}
+	if workload.pinnedPod() != "" {
+		return fmt.Errorf("workload %s cannot select a pod or statefulset with an app pattern", workload.App)
+	}
+	if workload.LocalPort == 0 {
+		return fmt.Errorf("workload %s needs the local_port the local ports of its apps start from", workload.App)
+	}
+	return nil
+}
+
+// deploymentsArgs are the kubectl arguments listing the Deployments of the namespace as
+// their name and the app label of their pods, a line per Deployment
+func deploymentsArgs(namespace string) []string {
+	return []string{"get", "deployments", "-n", namespace,
+		"-o", `jsonpath={range .items[*]}{.metadata.name}{"\t"}{.spec.selector.matchLabels.app}{"\n"}{end}`}
+}
+
+// matchDeployments returns the apps of the Deployments of the output of deploymentsArgs whose
+// name matches the pattern, sorted. A Deployment without an app label is named after its app.
+func matchDeployments(out, pattern string) []string {
+	var apps []string
+	for _, line := range strings.Split(out, "\n") {
+		name, app, _ := strings.Cut(strings.TrimSpace(line), "\t")
+		if name == "" {
+			continue
+		}
+		if matched, _ := path.Match(pattern, name); !matched {
+			continue
+		}
+		if app == "" {
+			app = name
+		}
+		if !slices.Contains(apps, app) {
+			apps = append(apps, app)
+		}
+	}
+	slices.Sort(apps)
+	return apps
+}
+
+// wildcardKey identifies an app of a wildcard workload in the saved local ports
+func wildcardKey(wildcard Workload, app string) string {
+	return wildcard.kubeContext + "/" + wildcard.Namespace + "/" + app
+}
+
+// wildcardPortsPath is the file of the local ports the apps of the environment's wildcard
+// workloads were given
+func wildcardPortsPath(environment string) (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, ".devcli", "wildcard-ports", environment+".json"), nil
+}
+
+// loadWildcardPorts returns the saved local ports of the environment's wildcard apps by
+// wildcardKey, empty when there are none
+func loadWildcardPorts(environment string) map[string]int {
+	ports := make(map[string]int)
+	path, err := wildcardPortsPath(environment)
+	if err != nil {
+		return ports
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ports
+	}
+	if err := json.Unmarshal(data, &ports); err != nil {
+		return make(map[string]int)
+	}
+	return ports
+}
+
+// saveWildcardPorts writes the local ports of the environment's wildcard apps
+func saveWildcardPorts(environment string, ports map[string]int) error {
+	path, err := wildcardPortsPath(environment)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(ports, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// expandWildcard returns a workload per app, in the order of the apps. An app keeps the
+// local port of ports it was given before, unless another tunnel uses it now; a new app is
+// given the next local port from the wildcard's local_port on that no other tunnel uses,
+// no other app was given and is free, and is added to ports. Apps that come and go thus
+// never move the ports of the others.
+func expandWildcard(wildcard Workload, apps []string, used []int, free func(int) bool, ports map[string]int) ([]Workload, error) {
+	var workloads []Workload
+	used = slices.Clone(used)
+	given := slices.Collect(maps.Values(ports))
+	port := wildcard.LocalPort
+	for _, app := range apps {
+		key := wildcardKey(wildcard, app)
+		assigned, ok := ports[key]
+		if !ok || slices.Contains(used, assigned) {
+			for port <= 65535 && (slices.Contains(used, port) || slices.Contains(given, port) || !free(port)) {
+				port++
+			}
+			if port > 65535 {
+				return nil, fmt.Errorf("no local port is left for app %s of workload %s", app, wildcard.App)
+			}
+			assigned = port
+			ports[key] = port
+			given = append(given, port)
+		} else if !free(assigned) {
+			fmt.Printf("Warning: local port %d of app %s is used by another process. Its tunnel fails until the port is freed.\n", assigned, app)
+		}
+		workload := wildcard
+		workload.App = app
+		workload.LocalPort = assigned
+		workload.Tags = slices.Clone(wildcard.Tags)
+		workloads = append(workloads, workload)
+		used = append(used, assigned)
+	}
+	return workloads, nil
+}
+
+// expandWildcards replaces the wildcard workloads of the environment by a workload per
+// Deployment of their namespace whose name matches, leaving out the apps the environment
+// already forwards. The local ports of the other tunnels are kept, and the apps keep the
+// local ports they were given by the earlier sessions of the environment.
+func expandWildcards(ctx context.Context, runner *commandRunner, config ProxyConfig, free func(int) bool) ([]Workload, error) {
+	wildcards := slices.DeleteFunc(slices.Clone(config.Workloads), func(w Workload) bool { return !w.wildcard() })
+	if len(wildcards) == 0 {
+		return config.Workloads, nil
+	}
+	config.Workloads = slices.DeleteFunc(slices.Clone(config.Workloads), Workload.wildcard)
+	used, err := validateLocalPorts(config)
+	if err != nil {
+		return nil, err
+	}
+	ports := loadWildcardPorts(config.Environment)
+	for _, wildcard := range wildcards {
+		cmd := kubectlCommand(ctx, wildcard, deploymentsArgs(wildcard.Namespace)...)
+		out, err := runner.output(ctx, cmd)
+		if err != nil {
+			return nil, fmt.Errorf("listing the deployments of namespace %s for workload %s: %w", wildcard.Namespace, wildcard.App, err)
+		}
+		apps := slices.DeleteFunc(matchDeployments(string(out), wildcard.App), func(app string) bool {
+			return slices.ContainsFunc(config.Workloads, func(w Workload) bool {
+				return w.App == app && w.Namespace == wildcard.Namespace && w.kubeContext == wildcard.kubeContext
+			})
+		})
+		if len(apps) == 0 {
+			fmt.Printf("Warning: workload %s matches no deployment in namespace %s.\n", wildcard.App, wildcard.Namespace)
+			continue
+		}
+		workloads, err := expandWildcard(wildcard, apps, used, free, ports)
+		if err != nil {
+			return nil, err
+		}
+		for _, workload := range workloads {
+			narratef("Workload %s forwards app %s to local port %d\n", wildcard.App, workload.App, workload.LocalPort)
+			used = append(used, workload.LocalPort)
+		}
+		config.Workloads = append(config.Workloads, workloads...)
+	}
+	if err := saveWildcardPorts(config.Environment, ports); err != nil {
+		fmt.Println("Warning: saving the local ports of the wildcard workloads failed:", err)
+	}
+	return config.Workloads, nil
+}
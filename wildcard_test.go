@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatchDeployments(t *testing.T) {
+	out := "payments-ledger\tpayments-ledger\npayments-api\t\nrefunds\trefunds\npayments-api-v2\tpayments-api\n"
+	if apps := matchDeployments(out, "payments-*"); !slices.Equal(apps, []string{"payments-api", "payments-ledger"}) {
+		t.Errorf("matchDeployments failed: unexpected apps %v", apps)
+	}
+	if apps := matchDeployments(out, "billing-*"); len(apps) != 0 {
+		t.Errorf("matchDeployments failed: expected no app, got %v", apps)
+	}
+}
+
+func TestExpandWildcard(t *testing.T) {
+	wildcard := Workload{Namespace: "enr", App: "payments-*", LocalPort: 9000, RemotePort: 8080, Protocol: "http", Tags: []string{"payments"}}
+	// 9001 is used by another tunnel and 9002 by another process
+	given := make(map[string]int)
+	workloads, err := expandWildcard(wildcard, []string{"payments-api", "payments-ledger", "payments-risk"}, []int{9001}, func(port int) bool { return port != 9002 }, given)
+	if err != nil {
+		t.Fatalf("expandWildcard failed: %v", err)
+	}
+	var ports []int
+	for _, workload := range workloads {
+		ports = append(ports, workload.LocalPort)
+	}
+	if !slices.Equal(ports, []int{9000, 9003, 9004}) || workloads[1].App != "payments-ledger" || workloads[1].RemotePort != 8080 || workloads[1].Tags[0] != "payments" {
+		t.Errorf("expandWildcard failed: unexpected workloads %+v", workloads)
+	}
+
+	// a new app sorted first and a free 9002 do not move the ports of the others
+	workloads, err = expandWildcard(wildcard, []string{"payments-abc", "payments-api", "payments-ledger", "payments-risk"}, []int{9001}, func(int) bool { return true }, given)
+	if err != nil {
+		t.Fatalf("expandWildcard failed: %v", err)
+	}
+	ports = nil
+	for _, workload := range workloads {
+		ports = append(ports, workload.LocalPort)
+	}
+	if !slices.Equal(ports, []int{9002, 9000, 9003, 9004}) || given["/enr/payments-abc"] != 9002 {
+		t.Errorf("expandWildcard failed: expected stable ports, got %v and %v", ports, given)
+	}
+}
+
+func TestValidateWildcard(t *testing.T) {
+	for _, tc := range []struct {
+		workload Workload
+		valid    bool
+	}{
+		{Workload{App: "payments-*", LocalPort: 9000}, true},
+		{Workload{App: "cashfree"}, true},
+		{Workload{App: "payments-[", LocalPort: 9000}, false},
+		{Workload{App: "payments-*"}, false},
+		{Workload{App: "kafka-*", StatefulSet: "kafka", LocalPort: 9092}, false},
+	} {
+		if err := validateWildcard(tc.workload); (err == nil) != tc.valid {
+			t.Errorf("validateWildcard(%+v) failed: expected valid %v, got %v", tc.workload, tc.valid, err)
+		}
+	}
+}
+
+func TestExpandWildcards(t *testing.T) {
+	dir := t.TempDir()
+	script := `#!/bin/sh
+case "$*" in
+*"get deployments -n enr "*) printf 'payments-api\tpayments-api\npayments-ledger\tpayments-ledger\ncashfree\tcashfree\n' ;;
+*) exit 1 ;;
+esac
+`
+	if err := os.WriteFile(filepath.Join(dir, "kubectl"), []byte(script), 0755); err != nil {
+		t.Fatalf("Error writing the fake kubectl: %v", err)
+	}
+	t.Setenv("PATH", dir+string(filepath.ListSeparator)+os.Getenv("PATH"))
+	t.Setenv("HOME", t.TempDir())
+	config := ProxyConfig{Environment: "staging", Workloads: []Workload{
+		{Namespace: "enr", App: "payments-*", LocalPort: 9000, RemotePort: 8080},
+		{Namespace: "enr", App: "payments-api", LocalPort: 9000, RemotePort: 8080},
+		{Namespace: "enr", App: "billing-*", LocalPort: 9100, RemotePort: 8080},
+	}}
+	workloads, err := expandWildcards(context.Background(), newCommandRunner(2, 0).withTimeout(time.Minute, 0), config, func(int) bool { return true })
+	if err != nil {
+		t.Fatalf("expandWildcards failed: %v", err)
+	}
+	var names []string
+	for _, workload := range workloads {
+		names = append(names, fmt.Sprintf("%s:%d", workload.App, workload.LocalPort))
+	}
+	if strings.Join(names, ",") != "payments-api:9000,payments-ledger:9001" {
+		t.Errorf("expandWildcards failed: unexpected workloads %v", names)
+	}
+	if ports := loadWildcardPorts("staging"); ports["/enr/payments-ledger"] != 9001 {
+		t.Errorf("expandWildcards failed: expected the ports to be saved, got %v", ports)
+	}
+}